@@ -11,6 +11,8 @@ func MethodToAction(method string) byte {
 		return 'u'
 	case "DELETE":
 		return 'd'
+	case "PATCH":
+		return ActionPatch
 	default:
 		return 0
 	}
@@ -27,6 +29,8 @@ func ActionToMethod(action byte) string {
 		return "PUT"
 	case 'd':
 		return "DELETE"
+	case ActionPatch:
+		return "PATCH"
 	default:
 		return ""
 	}
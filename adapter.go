@@ -0,0 +1,449 @@
+package crudp
+
+import (
+	"encoding"
+	"encoding/base64"
+	"reflect"
+	"sync"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// TypeAdapter encodes a field type the codecs cannot represent, e.g.
+// time.Time or a decimal, as a string. Values of the type are adapted at any
+// depth (fields, pointers, slices, maps), so they round-trip identically in
+// JSON and binary mode (items of the binary framing use the same codec).
+type TypeAdapter struct {
+	Type      any                         // A value of the adapted type, e.g. time.Time{}
+	Marshal   func(v any) (string, error) // v holds a value of Type
+	Unmarshal func(s string) (any, error) // Must return a value of Type
+}
+
+// TextAdapter adapts a type implementing encoding.TextMarshaler, with
+// encoding.TextUnmarshaler on its pointer, e.g. TextAdapter(time.Time{})
+// (RFC 3339) or most decimal types
+func TextAdapter(v any) TypeAdapter {
+	t := reflect.TypeOf(v)
+	return TypeAdapter{
+		Type: v,
+		Marshal: func(v any) (string, error) {
+			m, ok := v.(encoding.TextMarshaler)
+			if !ok {
+				return "", Err(Fmt("type adapter: %s is not a TextMarshaler", typeName(v)))
+			}
+			text, err := m.MarshalText()
+			return string(text), err
+		},
+		Unmarshal: func(s string) (any, error) {
+			ptr := reflect.New(t)
+			u, ok := ptr.Interface().(encoding.TextUnmarshaler)
+			if !ok {
+				return nil, Err(Fmt("type adapter: *%s is not a TextUnmarshaler", t))
+			}
+			if err := u.UnmarshalText([]byte(s)); err != nil {
+				return nil, err
+			}
+			return ptr.Elem().Interface(), nil
+		},
+	}
+}
+
+// typeAdapters is the process-wide registry of adapters and RegisterType
+// types, copy-on-write so codecs read it without holding the lock
+var typeAdapters struct {
+	mu       sync.Mutex
+	adapters []adapterEntry
+	types    []typeEntry
+	scanned  []adaptedType // Cache of usesAdapters
+}
+
+type adapterEntry struct {
+	t reflect.Type
+	a TypeAdapter
+}
+
+type adaptedType struct {
+	t   reflect.Type
+	has bool
+}
+
+// RegisterTypeAdapter makes the default codec and AdaptCodec codecs encode
+// values of a.Type with a; registering a type again replaces its adapter
+// Register the same adapters on server and client (e.g. in a shared init) so
+// both sides agree on the representation.
+func RegisterTypeAdapter(a TypeAdapter) error {
+	t := reflect.TypeOf(a.Type)
+	if t == nil || a.Marshal == nil || a.Unmarshal == nil {
+		return Errf("type adapter: Type, Marshal and Unmarshal are required")
+	}
+
+	typeAdapters.mu.Lock()
+	defer typeAdapters.mu.Unlock()
+	adapters := make([]adapterEntry, 0, len(typeAdapters.adapters)+1)
+	for _, e := range typeAdapters.adapters {
+		if e.t != t {
+			adapters = append(adapters, e)
+		}
+	}
+	typeAdapters.adapters = append(adapters, adapterEntry{t: t, a: a})
+	typeAdapters.scanned = nil // Types may hold the new one
+	return nil
+}
+
+// adapterFor returns the adapter registered for t
+func adapterFor(t reflect.Type) (TypeAdapter, bool) {
+	typeAdapters.mu.Lock()
+	adapters := typeAdapters.adapters
+	typeAdapters.mu.Unlock()
+	for _, e := range adapters {
+		if e.t == t {
+			return e.a, true
+		}
+	}
+	return TypeAdapter{}, false
+}
+
+// usesAdapters reports whether values of t can hold adapted types
+func usesAdapters(t reflect.Type) bool {
+	typeAdapters.mu.Lock()
+	if len(typeAdapters.adapters) == 0 && len(typeAdapters.types) == 0 {
+		typeAdapters.mu.Unlock()
+		return false
+	}
+	scanned := typeAdapters.scanned
+	typeAdapters.mu.Unlock()
+	for _, s := range scanned {
+		if s.t == t {
+			return s.has
+		}
+	}
+
+	has := scanAdapted(t, nil)
+	typeAdapters.mu.Lock()
+	typeAdapters.scanned = append(typeAdapters.scanned[:len(typeAdapters.scanned):len(typeAdapters.scanned)], adaptedType{t: t, has: has})
+	typeAdapters.mu.Unlock()
+	return has
+}
+
+// scanAdapted walks t; seen guards recursive types
+func scanAdapted(t reflect.Type, seen []reflect.Type) bool {
+	if _, ok := adapterFor(t); ok {
+		return true
+	}
+	for _, s := range seen {
+		if s == t {
+			return false
+		}
+	}
+	seen = append(seen, t)
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return hasRegisteredTypes()
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return scanAdapted(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).IsExported() && scanAdapted(t.Field(i).Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AdaptCodec applies the registered type adapters and RegisterType types
+// around a custom item codec
+// The inner codec must encode and decode generic values (map[string]any,
+// []any, strings, numbers, bools); the default codec is adapted already.
+func AdaptCodec(inner Codec) Codec {
+	return &adaptCodec{inner: inner}
+}
+
+type adaptCodec struct {
+	inner Codec
+}
+
+func (c *adaptCodec) Encode(v any) ([]byte, error) {
+	return encodeAdapted(c.inner, v)
+}
+
+func (c *adaptCodec) Decode(data []byte, v any) error {
+	return decodeAdapted(c.inner, data, v)
+}
+
+// encodeAdapted encodes v with codec, first turning it into a generic tree
+// when it holds adapted types
+func encodeAdapted(codec Codec, v any) ([]byte, error) {
+	if v == nil || !usesAdapters(reflect.TypeOf(v)) {
+		return codec.Encode(v)
+	}
+	tree, err := toTree(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	return codec.Encode(tree)
+}
+
+// decodeAdapted decodes into a generic tree when v holds adapted types and
+// then fills v from it
+func decodeAdapted(codec Codec, data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || !usesAdapters(rv.Type().Elem()) {
+		return codec.Decode(data, v)
+	}
+
+	target := rv.Elem()
+	for target.Kind() == reflect.Ptr {
+		if _, ok := adapterFor(target.Type()); ok {
+			break
+		}
+		if target.IsNil() {
+			target.Set(reflect.New(target.Type().Elem()))
+		}
+		target = target.Elem()
+	}
+
+	if _, ok := adapterFor(target.Type()); ok {
+		var s string
+		if err := codec.Decode(data, &s); err != nil {
+			return err
+		}
+		return fromTree(target, s)
+	}
+	switch target.Kind() {
+	case reflect.Struct, reflect.Map:
+		m := map[string]any{}
+		if err := codec.Decode(data, &m); err != nil {
+			return err
+		}
+		return fromTree(target, m)
+	case reflect.Slice, reflect.Array:
+		var s []any
+		if err := codec.Decode(data, &s); err != nil {
+			return err
+		}
+		return fromTree(target, s)
+	case reflect.Interface:
+		var tree any
+		if err := codec.Decode(data, &tree); err != nil {
+			return err
+		}
+		return fromTree(target, tree)
+	}
+	return codec.Decode(data, v)
+}
+
+// toTree converts v to maps keyed by json name, slices and leaf values,
+// adapted types becoming strings
+func toTree(v reflect.Value) (any, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if a, ok := adapterFor(v.Type()); ok {
+		return a.Marshal(v.Interface())
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if name, ok := registeredName(v.Elem().Type()); ok {
+			value, err := toTree(v.Elem())
+			if err != nil {
+				return nil, err
+			}
+			return map[string]any{typeKey: name, valueKey: value}, nil
+		}
+		return toTree(v.Elem())
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return toTree(v.Elem())
+	case reflect.Struct:
+		out := make(map[string]any, v.NumField())
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() || sf.Tag.Get("json") == "-" {
+				continue
+			}
+			f, err := toTree(v.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			out[jsonName(sf)] = f
+		}
+		return out, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, Err(Fmt("type adapter: map key of %s must be a string", v.Type()))
+		}
+		out := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			e, err := toTree(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			out[iter.Key().String()] = e
+		}
+		return out, nil
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface(), nil // Bytes stay a leaf
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		out := make([]any, v.Len())
+		for i := range out {
+			e, err := toTree(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = e
+		}
+		return out, nil
+	}
+	return v.Interface(), nil
+}
+
+// fromTree sets dst from a generic tree built by toTree after decoding
+// Numbers may come back as any numeric type and are converted.
+func fromTree(dst reflect.Value, tree any) error {
+	if tree == nil {
+		return nil
+	}
+	if a, ok := adapterFor(dst.Type()); ok {
+		s, ok := tree.(string)
+		if !ok {
+			return Err(Fmt("type adapter: %s expects a string, got %s", dst.Type(), typeName(tree)))
+		}
+		v, err := a.Unmarshal(s)
+		if err != nil {
+			return err
+		}
+		rv := reflect.ValueOf(v)
+		if !rv.IsValid() || rv.Type() != dst.Type() {
+			return Err(Fmt("type adapter: Unmarshal of %s returned %s", dst.Type(), typeName(v)))
+		}
+		dst.Set(rv)
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return fromTree(dst.Elem(), tree)
+	case reflect.Struct:
+		m, ok := tree.(map[string]any)
+		if !ok {
+			return Err(Fmt("type adapter: %s expects an object, got %s", dst.Type(), typeName(tree)))
+		}
+		t := dst.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() || sf.Tag.Get("json") == "-" {
+				continue
+			}
+			if e, ok := m[jsonName(sf)]; ok {
+				if err := fromTree(dst.Field(i), e); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case reflect.Map:
+		m, ok := tree.(map[string]any)
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			return Err(Fmt("type adapter: %s expects an object, got %s", dst.Type(), typeName(tree)))
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(dst.Type(), len(m)))
+		}
+		for k, e := range m {
+			ev := reflect.New(dst.Type().Elem()).Elem()
+			if err := fromTree(ev, e); err != nil {
+				return err
+			}
+			dst.SetMapIndex(reflect.ValueOf(k).Convert(dst.Type().Key()), ev)
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		if dst.Type().Elem().Kind() == reflect.Uint8 {
+			return bytesFromTree(dst, tree)
+		}
+		s, ok := tree.([]any)
+		if !ok {
+			return Err(Fmt("type adapter: %s expects an array, got %s", dst.Type(), typeName(tree)))
+		}
+		if dst.Kind() == reflect.Slice {
+			dst.Set(reflect.MakeSlice(dst.Type(), len(s), len(s)))
+		}
+		for i := 0; i < len(s) && i < dst.Len(); i++ {
+			if err := fromTree(dst.Index(i), s[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Interface:
+		v, err := typedFromTree(dst.Type(), tree)
+		if err != nil {
+			return err
+		}
+		dst.Set(v)
+		return nil
+	}
+
+	rv := reflect.ValueOf(tree)
+	if !rv.Type().ConvertibleTo(dst.Type()) || (rv.Kind() == reflect.String) != (dst.Kind() == reflect.String) {
+		return Err(Fmt("type adapter: cannot set %s from %s", dst.Type(), typeName(tree)))
+	}
+	dst.Set(rv.Convert(dst.Type()))
+	return nil
+}
+
+// bytesFromTree sets a byte slice or array from base64 text or a number array
+func bytesFromTree(dst reflect.Value, tree any) error {
+	var b []byte
+	switch v := tree.(type) {
+	case []byte:
+		b = v
+	case string:
+		decoded, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return err
+		}
+		b = decoded
+	case []any:
+		b = make([]byte, len(v))
+		for i, e := range v {
+			n := reflect.ValueOf(e)
+			if !n.IsValid() || !n.Type().ConvertibleTo(reflect.TypeOf(byte(0))) || n.Kind() == reflect.String {
+				return Err(Fmt("type adapter: byte %d of %s is %s", i, dst.Type(), typeName(e)))
+			}
+			b[i] = byte(n.Convert(reflect.TypeOf(byte(0))).Uint())
+		}
+	default:
+		return Err(Fmt("type adapter: %s expects bytes, got %s", dst.Type(), typeName(tree)))
+	}
+	if dst.Kind() == reflect.Slice {
+		dst.SetBytes(b)
+		return nil
+	}
+	reflect.Copy(dst, reflect.ValueOf(b))
+	return nil
+}
+
+// typeName names the dynamic type of v in errors (Fmt has no %T)
+func typeName(v any) string {
+	if v == nil {
+		return "nil"
+	}
+	return reflect.TypeOf(v).String()
+}
@@ -0,0 +1,97 @@
+package crudp_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+// Money keeps cents in an unexported field, which codecs cannot see
+type Money struct{ cents int64 }
+
+func (m Money) MarshalText() ([]byte, error) {
+	cents := strconv.FormatInt(100+m.cents%100, 10)[1:]
+	return []byte(strconv.FormatInt(m.cents/100, 10) + "." + cents), nil
+}
+
+func (m *Money) UnmarshalText(text []byte) error {
+	cents, err := strconv.ParseInt(strings.Replace(string(text), ".", "", 1), 10, 64)
+	m.cents = cents
+	return err
+}
+
+type Bill struct {
+	ID    string  `json:"id"`
+	Total Money   `json:"total"`
+	Lines []Money `json:"lines"`
+	Tip   *Money  `json:"tip"`
+}
+
+func AdapterShared(t *testing.T) {
+	if err := crudp.RegisterTypeAdapter(crudp.TextAdapter(Money{})); err != nil {
+		t.Fatal(err)
+	}
+	want := Bill{ID: "i1", Total: Money{1250}, Lines: []Money{{1000}, {250}}, Tip: &Money{99}}
+
+	check := func(t *testing.T, got Bill) {
+		t.Helper()
+		if got.ID != "i1" || got.Total != want.Total || len(got.Lines) != 2 || got.Lines[1] != want.Lines[1] || got.Tip == nil || *got.Tip != *want.Tip {
+			t.Errorf("unexpected round trip: %+v", got)
+		}
+	}
+
+	t.Run("Same Values In JSON And Binary", func(t *testing.T) {
+		for _, binary := range []bool{false, true} {
+			cfg := crudp.DefaultConfig()
+			cfg.UseBinary = binary
+			cp := crudp.New(cfg)
+
+			encoded, err := cp.EncodePacket('c', 0, "a", want)
+			if err != nil {
+				t.Fatalf("binary=%v encode: %v", binary, err)
+			}
+			var packet crudp.Packet
+			if err := cp.DecodePacket(encoded, &packet); err != nil {
+				t.Fatalf("binary=%v decode packet: %v", binary, err)
+			}
+			if got := string(packet.Data[0]); !strings.Contains(got, `"12.50"`) {
+				t.Errorf("binary=%v: total not encoded as a string: %s", binary, got)
+			}
+			var got Bill
+			if err := cp.DecodeData(&packet, 0, &got); err != nil {
+				t.Fatalf("binary=%v decode data: %v", binary, err)
+			}
+			check(t, got)
+		}
+	})
+
+	t.Run("Custom Codec", func(t *testing.T) {
+		codec := crudp.AdaptCodec(crudp.NewDefault().Codec())
+		encoded, err := codec.Encode(&want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Bill
+		if err := codec.Decode(encoded, &got); err != nil {
+			t.Fatal(err)
+		}
+		check(t, got)
+	})
+
+	t.Run("Decode Error Names The Types", func(t *testing.T) {
+		codec := crudp.AdaptCodec(crudp.NewDefault().Codec())
+		var got Bill
+		err := codec.Decode([]byte(`{"id":"i1","total":true}`), &got)
+		if err == nil || !strings.Contains(err.Error(), "crudp_test.Money expects a string, got bool") {
+			t.Errorf("expected the adapted and sent types, got %v", err)
+		}
+	})
+
+	t.Run("Invalid Adapter", func(t *testing.T) {
+		if err := crudp.RegisterTypeAdapter(crudp.TypeAdapter{Type: Money{}}); err == nil {
+			t.Error("expected an error without Marshal and Unmarshal")
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package crudp
+
+import "context"
+
+// Attachments are opaque blobs (images, PDFs...) sent alongside the items of
+// a packet. They bypass the item codec: the binary framing and protocodec
+// carry them as raw length-prefixed bytes, JSON as base64 strings.
+
+type attachmentsKey struct{}
+
+// WithAttachments sends blobs with the packet (EncodePacket/EnqueuePacket)
+// Packets with attachments are never consolidated by the broker.
+func WithAttachments(blobs ...[]byte) CallOption {
+	return callOptionFunc(func(co *callOptions) {
+		co.attachments = append(co.attachments, blobs...)
+	})
+}
+
+// AttachmentsFrom returns the attachments of the packet being processed
+// With the binary framing they are sub-slices of the request: copy them to
+// keep them after the handler returns.
+func AttachmentsFrom(ctx context.Context) [][]byte {
+	blobs, _ := ctx.Value(attachmentsKey{}).([][]byte)
+	return blobs
+}
+
+// withAttachments exposes packet.Attachments to handlers through ctx
+func withAttachments(ctx context.Context, packet *Packet) context.Context {
+	if len(packet.Attachments) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, attachmentsKey{}, packet.Attachments)
+}
+
+// AttachmentResult is returned by handlers that answer with blobs, e.g. a
+// generated PDF: Data is encoded as usual and Attachments travel raw in
+// PacketResult.Attachments
+type AttachmentResult struct {
+	Data        any
+	Attachments [][]byte
+}
+
+// echo copies packet into a result; request attachments are not sent back
+func (p *Packet) echo() Packet {
+	echoed := *p
+	echoed.Attachments = nil
+	return echoed
+}
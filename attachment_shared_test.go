@@ -0,0 +1,81 @@
+package crudp_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Scan stores the attached page images and answers with a rendered PDF
+type Scan struct {
+	Title string `json:"title"`
+	Pages int    `json:"pages"`
+}
+
+func (h *Scan) Create(ctx context.Context, data ...any) any {
+	scan := data[0].(*Scan)
+	var pdf []byte
+	for _, page := range crudp.AttachmentsFrom(ctx) {
+		scan.Pages++
+		pdf = append(pdf, page...)
+	}
+	return crudp.AttachmentResult{Data: scan, Attachments: [][]byte{pdf}}
+}
+
+func AttachmentShared(t *testing.T) {
+	page1, page2 := []byte{0x89, 'P', 'N', 'G', 0}, bytes.Repeat([]byte{0xff}, 300)
+
+	for _, binary := range []bool{false, true} {
+		cfg := crudp.DefaultConfig()
+		cfg.UseBinary = binary
+		cp := crudp.New(cfg, crudp.WithHandlers(&Scan{}))
+
+		t.Run(Fmt("Round Trip binary=%v", binary), func(t *testing.T) {
+			data, _ := cp.Codec().Encode(&Scan{Title: "invoice"})
+			r := processOne(t, cp, crudp.Packet{Action: 'c', ReqID: "s1", Data: [][]byte{data}, Attachments: [][]byte{page1, page2}})
+			if r.MessageType != uint8(Msg.Success) {
+				t.Fatalf("unexpected result %d %q", r.MessageType, r.Message)
+			}
+			var scan Scan
+			if err := cp.Codec().Decode(r.Data[0], &scan); err != nil || scan.Pages != 2 {
+				t.Errorf("handler saw %d attachments (%v)", scan.Pages, err)
+			}
+			if len(r.Attachments) != 1 || !bytes.Equal(r.Attachments[0], append(append([]byte{}, page1...), page2...)) {
+				t.Errorf("unexpected result attachments %v", r.Attachments)
+			}
+		})
+
+		t.Run(Fmt("Not Echoed On Error binary=%v", binary), func(t *testing.T) {
+			r := processOne(t, cp, crudp.Packet{Action: 'c', ReqID: "s2", Data: [][]byte{[]byte("not a scan")}, Attachments: [][]byte{page1}})
+			if r.MessageType != uint8(Msg.Error) || len(r.Attachments) != 0 {
+				t.Errorf("expected error without attachments, got %d %v", r.MessageType, r.Attachments)
+			}
+		})
+	}
+
+	t.Run("Encoded With Packet", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&Scan{}))
+		encoded, err := cp.EncodePacket('c', 0, "s3", &Scan{Title: "a"}, crudp.WithAttachments(page1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var p crudp.Packet
+		if err := cp.DecodePacket(encoded, &p); err != nil || len(p.Attachments) != 1 || !bytes.Equal(p.Attachments[0], page1) {
+			t.Errorf("attachments lost: %v (%v)", p.Attachments, err)
+		}
+	})
+
+	t.Run("Not Consolidated", func(t *testing.T) {
+		client := crudp.New(crudp.WithHandlers(&Scan{}))
+		client.EnqueuePacket(0, 'c', "", &Scan{Title: "a"}, crudp.WithAttachments(page1))
+		client.EnqueuePacket(0, 'c', "", &Scan{Title: "b"}, crudp.WithAttachments(page2))
+		client.EnqueuePacket(0, 'c', "", &Scan{Title: "c"})
+		if n := client.Broker().QueueLength(); n != 3 {
+			t.Errorf("expected 3 queued packets, got %d", n)
+		}
+		client.Broker().Clear()
+	})
+}
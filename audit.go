@@ -0,0 +1,184 @@
+package crudp
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// AuditRecord describes one processed packet
+type AuditRecord struct {
+	Time     time.Time // When processing started
+	Handler  string    // Handler name, "" if the ID was unknown
+	Action   byte
+	ReqID    string
+	User     string // UserProvider user ID, "" if none
+	Remote   string // RemoteAddr(ctx)
+	Success  bool
+	Duration time.Duration
+	Message  string // Result message when Success is false
+}
+
+// Auditor receives a record after each packet (optional, server only)
+// Set it in Config.Auditor; errors are logged and never fail the packet.
+type Auditor interface {
+	Audit(ctx context.Context, rec AuditRecord) error
+}
+
+// AuditFunc adapts a function to Auditor, e.g. to insert records into a database
+type AuditFunc func(ctx context.Context, rec AuditRecord) error
+
+func (f AuditFunc) Audit(ctx context.Context, rec AuditRecord) error {
+	return f(ctx, rec)
+}
+
+// audit passes the outcome of a packet to Config.Auditor
+func (cp *CrudP) audit(ctx context.Context, packet *Packet, pr *PacketResult, start time.Time) {
+	rec := AuditRecord{
+		Time:     start,
+		Handler:  cp.GetHandlerName(packet.HandlerID),
+		Action:   packet.Action,
+		ReqID:    packet.ReqID,
+		Remote:   RemoteAddr(ctx),
+		Success:  pr.MessageType != uint8(Msg.Error) && pr.MessageType != uint8(Msg.Warning),
+		Duration: time.Since(start),
+	}
+	if cp.config.UserProvider != nil {
+		rec.User = cp.config.UserProvider.GetUserID(ctx)
+	}
+	if !rec.Success {
+		rec.Message = pr.Message
+	}
+	if err := cp.config.Auditor.Audit(ctx, rec); err != nil {
+		cp.log.Error("auditor failed", "handler", rec.Handler, "action", string(rec.Action), "error", err)
+	}
+}
+
+// AuditLog is a tamper-evident Auditor writing one line per record
+// Each line ends with sha256(previous hash + line), so editing, removing or
+// reordering records breaks the chain reported by VerifyAuditLog.
+type AuditLog struct {
+	mu   sync.Mutex
+	w    io.Writer
+	seq  int
+	head string // Hash of the last line, "" before the first
+}
+
+// NewAuditLog returns an AuditLog appending to w (e.g. an *os.File)
+// Call Resume when appending to an existing log.
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{w: w}
+}
+
+// Resume verifies an existing log and continues its chain
+func (l *AuditLog) Resume(r io.Reader) error {
+	seq, head, err := verifyAuditChain(r)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.seq, l.head = seq, head
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *AuditLog) Audit(ctx context.Context, rec AuditRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	body := appendAuditBody(nil, l.seq+1, rec)
+	hash := chainHash(l.head, body)
+	line := append(append(append(body, '\t'), hash...), '\n')
+
+	if _, err := l.w.Write(line); err != nil {
+		return err
+	}
+	l.seq++
+	l.head = hash
+	return nil
+}
+
+// VerifyAuditLog checks the hash chain of a log written by AuditLog
+// Returns the number of valid records.
+func VerifyAuditLog(r io.Reader) (int, error) {
+	seq, _, err := verifyAuditChain(r)
+	return seq, err
+}
+
+func verifyAuditChain(r io.Reader) (int, string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+
+	seq, head := 0, ""
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		cut := lastTab(line)
+		if cut < 0 {
+			return seq, head, Err(Fmt("audit log: record %d is corrupt", seq+1))
+		}
+		body, hash := line[:cut], string(line[cut+1:])
+		if !hasSeq(body, seq+1) {
+			return seq, head, Err(Fmt("audit log: record %d is out of sequence", seq+1))
+		}
+		if chainHash(head, body) != hash {
+			return seq, head, Err(Fmt("audit log: record %d was modified", seq+1))
+		}
+		seq++
+		head = hash
+	}
+	return seq, head, scanner.Err()
+}
+
+// appendAuditBody writes the tab-separated fields of a record
+func appendAuditBody(dst []byte, seq int, rec AuditRecord) []byte {
+	dst = strconv.AppendInt(dst, int64(seq), 10)
+	dst = append(dst, '\t')
+	dst = rec.Time.UTC().AppendFormat(dst, time.RFC3339Nano)
+	dst = append(dst, '\t')
+	dst = strconv.AppendQuote(dst, rec.Handler)
+	dst = append(dst, '\t', rec.Action, '\t')
+	dst = strconv.AppendQuote(dst, rec.ReqID)
+	dst = append(dst, '\t')
+	dst = strconv.AppendQuote(dst, rec.User)
+	dst = append(dst, '\t')
+	dst = strconv.AppendQuote(dst, rec.Remote)
+	dst = append(dst, '\t')
+	dst = strconv.AppendBool(dst, rec.Success)
+	dst = append(dst, '\t')
+	dst = strconv.AppendInt(dst, rec.Duration.Microseconds(), 10)
+	dst = append(dst, "us\t"...)
+	return strconv.AppendQuote(dst, rec.Message)
+}
+
+func chainHash(prev string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(prev))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func lastTab(line []byte) int {
+	for i := len(line) - 1; i >= 0; i-- {
+		if line[i] == '\t' {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasSeq reports whether body starts with the sequence number seq
+func hasSeq(body []byte, seq int) bool {
+	prefix := strconv.AppendInt(nil, int64(seq), 10)
+	prefix = append(prefix, '\t')
+	if len(body) < len(prefix) {
+		return false
+	}
+	return string(body[:len(prefix)]) == string(prefix)
+}
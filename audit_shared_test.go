@@ -0,0 +1,73 @@
+package crudp_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+func AuditShared(t *testing.T) {
+	t.Run("Record Per Packet", func(t *testing.T) {
+		var records []crudp.AuditRecord
+		cfg := crudp.DefaultConfig()
+		cfg.Auditor = crudp.AuditFunc(func(ctx context.Context, rec crudp.AuditRecord) error {
+			records = append(records, rec)
+			return nil
+		})
+		cp := crudp.New(cfg, crudp.WithHandlers(&Note{}))
+
+		data, _ := cp.Codec().Encode(&Note{Text: "hi"})
+		processOne(t, cp, crudp.Packet{Action: 'c', ReqID: "req-1", Data: [][]byte{data}})
+		processOne(t, cp, crudp.Packet{Action: 'r', ReqID: "req-2"}) // Note has no Read
+
+		if len(records) != 2 {
+			t.Fatalf("expected 2 records, got %d", len(records))
+		}
+		if r := records[0]; r.Handler != "note" || r.Action != 'c' || r.ReqID != "req-1" || !r.Success || r.Time.IsZero() {
+			t.Errorf("unexpected create record: %+v", r)
+		}
+		if r := records[1]; r.Success || r.Message == "" {
+			t.Errorf("expected failed read record with message, got %+v", r)
+		}
+	})
+
+	t.Run("AuditLog Chain", func(t *testing.T) {
+		var file bytes.Buffer
+		cfg := crudp.DefaultConfig()
+		cfg.Auditor = crudp.NewAuditLog(&file)
+		cp := crudp.New(cfg, crudp.WithHandlers(&Note{}))
+
+		data, _ := cp.Codec().Encode(&Note{Text: "hi"})
+		for i := 0; i < 3; i++ {
+			processOne(t, cp, crudp.Packet{Action: 'c', ReqID: "req", Data: [][]byte{data}})
+		}
+
+		n, err := crudp.VerifyAuditLog(bytes.NewReader(file.Bytes()))
+		if err != nil || n != 3 {
+			t.Fatalf("expected 3 valid records, got %d, %v", n, err)
+		}
+
+		// Resume continues the chain
+		resumed := crudp.NewAuditLog(&file)
+		if err := resumed.Resume(bytes.NewReader(file.Bytes())); err != nil {
+			t.Fatalf("Resume error: %v", err)
+		}
+		resumed.Audit(context.Background(), crudp.AuditRecord{Handler: "note", Action: 'd', Success: true})
+		if n, err := crudp.VerifyAuditLog(bytes.NewReader(file.Bytes())); err != nil || n != 4 {
+			t.Fatalf("expected 4 valid records after resume, got %d, %v", n, err)
+		}
+
+		tampered := bytes.Replace(file.Bytes(), []byte("true"), []byte("fals"), 1)
+		if n, err := crudp.VerifyAuditLog(bytes.NewReader(tampered)); err == nil || n != 0 {
+			t.Errorf("expected tampering detected at first record, got %d, %v", n, err)
+		}
+
+		lines := bytes.SplitAfter(file.Bytes(), []byte("\n"))
+		removed := append(append([]byte{}, lines[0]...), bytes.Join(lines[2:], nil)...)
+		if n, err := crudp.VerifyAuditLog(bytes.NewReader(removed)); err == nil || n != 1 {
+			t.Errorf("expected removal detected after first record, got %d, %v", n, err)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+// Package auth adds JWT authentication to crudp.
+//
+// Server: JWT.Middleware verifies the bearer token (or session cookie) and
+// stores its Claims in the request context, where Provider exposes them as
+// the crudp UserProvider and TenantProvider. Register JWT.RefreshHandler to
+// renew tokens, or JWT.SessionHandler for login, refresh and logout.
+//
+//	jwt := auth.New(secret)
+//	cfg.UserProvider = auth.Provider{}
+//	cp := crudp.New(cfg, crudp.WithHandlers(jwt.SessionHandler(verifier), &User{}))
+//	http.ListenAndServe(":6060", jwt.Middleware(cp.BuildRouter()))
+//
+// Client: Client keeps the tokens in a TokenStore (LocalStorage on WASM),
+// renews them before they expire and provides the Authorization header;
+// on WASM, Transport sends the batches with it.
+package auth
+
+import (
+	"context"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// HandlerName of the refresh handler; register it on client and server
+const HandlerName = "auth_refresh"
+
+// Claims is the identity carried by a token
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Tenant    string   `json:"tenant,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`           // Unix seconds
+	Type      string   `json:"typ,omitempty"` // "refresh" for refresh tokens
+}
+
+// HasRole reports whether the claims include role
+func (c Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Tokens is issued at login and by the refresh handler
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresAt    int64  `json:"expires_at"` // Access token expiry, unix seconds
+}
+
+type claimsKey struct{}
+
+// WithClaims stores the verified claims in ctx (done by JWT.Middleware)
+func WithClaims(ctx context.Context, c Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, c)
+}
+
+// FromContext returns the claims of the caller, false if anonymous
+func FromContext(ctx context.Context) (Claims, bool) {
+	c, ok := ctx.Value(claimsKey{}).(Claims)
+	return c, ok
+}
+
+// HasRole reports whether the caller has role
+func HasRole(ctx context.Context, role string) bool {
+	c, _ := FromContext(ctx)
+	return c.HasRole(role)
+}
+
+// Provider is the crudp.UserProvider and crudp.TenantProvider for the claims
+// stored by JWT.Middleware
+type Provider struct{}
+
+var (
+	_ crudp.UserProvider   = Provider{}
+	_ crudp.TenantProvider = Provider{}
+)
+
+// GetUserID returns the token subject, "" if anonymous
+func (Provider) GetUserID(ctx context.Context) string {
+	c, _ := FromContext(ctx)
+	return c.Subject
+}
+
+// GetTenantID returns the tenant claim, "" if none
+func (Provider) GetTenantID(ctx context.Context) string {
+	c, _ := FromContext(ctx)
+	return c.Tenant
+}
+
+// Refresh is the crudp handler ("auth_refresh") exchanging a refresh token
+// for new Tokens. Register JWT.RefreshHandler() on the server and
+// &auth.Refresh{} on the client, at the same position.
+type Refresh struct {
+	RefreshToken string `json:"refresh_token"`
+
+	issuer interface {
+		refresh(token string) (Tokens, error)
+	} // Nil on the client
+}
+
+func (r *Refresh) HandlerName() string { return HandlerName }
+
+// Validate rejects packets other than a create with one refresh token
+func (r *Refresh) Validate(action byte, data ...any) error {
+	if r.issuer == nil {
+		return Errf("auth: refresh handler not configured, use JWT.RefreshHandler")
+	}
+	if action != 'c' || len(data) != 1 {
+		return Errf("auth: refresh expects one create item")
+	}
+	if _, ok := data[0].(*Refresh); !ok {
+		return Errf("auth: unexpected refresh data")
+	}
+	return nil
+}
+
+// Create issues new Tokens for the refresh token
+func (r *Refresh) Create(ctx context.Context, data ...any) any {
+	tokens, err := r.issuer.refresh(data[0].(*Refresh).RefreshToken)
+	if err != nil {
+		return failed{err}
+	}
+	return tokens
+}
+
+// failed reports an error as the packet result
+type failed struct{ err error }
+
+func (f failed) Response() (any, []string, error) { return nil, nil, f.err }
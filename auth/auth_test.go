@@ -0,0 +1,332 @@
+//go:build !wasm
+
+package auth
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Whoami answers with the subject of the caller
+type Whoami struct {
+	Subject string
+}
+
+func (h *Whoami) Read(ctx context.Context, data ...any) any {
+	c, _ := FromContext(ctx)
+	return &Whoami{Subject: c.Subject}
+}
+
+func newJWT(now time.Time) *JWT {
+	j := New([]byte("secret"))
+	j.Issuer = "crudp-test"
+	j.now = func() time.Time { return now }
+	return j
+}
+
+func TestSignParse(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	j := newJWT(now)
+
+	tokens, err := j.Issue(Claims{Subject: "alice", Tenant: "acme", Roles: []string{"admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := j.Parse(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Subject != "alice" || c.Tenant != "acme" || !c.HasRole("admin") || c.Type != "" {
+		t.Errorf("unexpected claims %+v", c)
+	}
+	if tokens.ExpiresAt != now.Add(15*time.Minute).Unix() {
+		t.Errorf("unexpected expiry %d", tokens.ExpiresAt)
+	}
+
+	tampered := tokens.AccessToken[:len(tokens.AccessToken)-2] + "xx"
+	if _, err := j.Parse(tampered); err == nil {
+		t.Error("tampered token accepted")
+	}
+	if _, err := New([]byte("other")).Parse(tokens.AccessToken); err == nil {
+		t.Error("token accepted with another secret")
+	}
+
+	j.now = func() time.Time { return now.Add(16 * time.Minute) }
+	if _, err := j.Parse(tokens.AccessToken); err == nil {
+		t.Error("expired token accepted")
+	}
+	j.Leeway = 2 * time.Minute
+	if _, err := j.Parse(tokens.AccessToken); err != nil {
+		t.Errorf("token within leeway rejected: %v", err)
+	}
+
+	other := newJWT(now)
+	other.Issuer = "someone-else"
+	if _, err := other.Parse(tokens.AccessToken); err == nil {
+		t.Error("unexpected issuer accepted")
+	}
+}
+
+func TestLiteralJWT(t *testing.T) {
+	j := &JWT{Secret: []byte("secret")}
+	tokens, err := j.Issue(Claims{Subject: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl := time.Until(time.Unix(tokens.ExpiresAt, 0)); ttl < 14*time.Minute || ttl > DefaultAccessTTL {
+		t.Errorf("expected the default access lifetime, got %v", ttl)
+	}
+	if c, err := j.Parse(tokens.AccessToken); err != nil || c.Subject != "bob" {
+		t.Errorf("parse: %+v, %v", c, err)
+	}
+
+	forever, _ := j.Sign(Claims{Subject: "bob"})
+	if _, err := j.Parse(forever); err == nil {
+		t.Error("token without expiry accepted")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	j := newJWT(time.Now())
+	cfg := crudp.DefaultConfig()
+	cfg.UserProvider = Provider{}
+	cp := crudp.New(cfg, crudp.WithHandlers(j.RefreshHandler(), &Whoami{}))
+	srv := httptest.NewServer(j.Middleware(cp.BuildRouter()))
+	defer srv.Close()
+
+	whoami := func(header, query string) (int, string) {
+		batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'r', HandlerID: 1}}})
+		req, _ := http.NewRequest("POST", srv.URL+"/api"+query, bytes.NewReader(batch))
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			return resp.StatusCode, ""
+		}
+		var out crudp.BatchResponse
+		if err := cp.Codec().Decode(data, &out); err != nil || len(out.Results) != 1 {
+			t.Fatalf("decode: %v", err)
+		}
+		var w Whoami
+		cp.DecodeData(&out.Results[0].Packet, 0, &w)
+		return resp.StatusCode, w.Subject
+	}
+
+	tokens, _ := j.Issue(Claims{Subject: "alice"})
+	if code, sub := whoami("Bearer "+tokens.AccessToken, ""); code != 200 || sub != "alice" {
+		t.Errorf("bearer: got %d %q", code, sub)
+	}
+	if code, sub := whoami("", "?access_token="+tokens.AccessToken); code != 200 || sub != "alice" {
+		t.Errorf("query token: got %d %q", code, sub)
+	}
+	if code, sub := whoami("", ""); code != 200 || sub != "" {
+		t.Errorf("anonymous: got %d %q", code, sub)
+	}
+	if code, _ := whoami("Bearer "+tokens.RefreshToken, ""); code != http.StatusUnauthorized {
+		t.Errorf("refresh token used as access token: got %d", code)
+	}
+	if code, _ := whoami("Bearer garbage", ""); code != http.StatusUnauthorized {
+		t.Errorf("invalid token: got %d", code)
+	}
+}
+
+func TestClientRefresh(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	j := newJWT(now)
+	server := crudp.New(crudp.WithHandlers(j.RefreshHandler()))
+	client := crudp.NewLoopback(server, crudp.WithHandlers(&Refresh{}))
+
+	store := &MemoryStore{}
+	c := NewClient(client, store)
+	logouts := 0
+	c.OnLogout = func() { logouts++ }
+	c.now = func() time.Time { return now }
+
+	tokens, _ := j.Issue(Claims{Subject: "alice"})
+	c.Login(tokens)
+	if c.Header() != "Bearer "+tokens.AccessToken {
+		t.Fatalf("unexpected header %q", c.Header())
+	}
+
+	// 30s before expiry: still sent, but renewed
+	later := now.Add(14*time.Minute + 30*time.Second)
+	c.now = func() time.Time { return later }
+	j.now = c.now
+	if c.Header() != "Bearer "+tokens.AccessToken {
+		t.Fatal("token close to expiry not sent")
+	}
+	client.Broker().FlushNow()
+
+	renewed := c.Tokens()
+	if renewed.AccessToken == tokens.AccessToken || renewed.ExpiresAt != later.Add(15*time.Minute).Unix() {
+		t.Fatalf("tokens not renewed: %+v", renewed)
+	}
+	if saved, ok := store.Load(); !ok || saved != renewed {
+		t.Error("renewed tokens not saved")
+	}
+
+	// Expired: no header, and a rejected refresh logs out
+	c.now = func() time.Time { return later.Add(8 * 24 * time.Hour) }
+	j.now = c.now
+	if h := c.Header(); h != "" {
+		t.Errorf("expired token sent: %q", h)
+	}
+	client.Broker().FlushNow()
+	if logouts != 1 || c.Tokens().RefreshToken != "" {
+		t.Errorf("expected logout, got %d logouts, tokens %+v", logouts, c.Tokens())
+	}
+	if _, ok := store.Load(); ok {
+		t.Error("store not cleared")
+	}
+}
+
+func TestEventsURL(t *testing.T) {
+	cfg := crudp.DefaultConfig()
+	cp := crudp.New(cfg, crudp.WithHandlers(&Refresh{}))
+	c := NewClient(cp, nil)
+	if got := c.EventsURL(); got != "/events" {
+		t.Errorf("anonymous: %q", got)
+	}
+	c.Login(Tokens{AccessToken: "a.b+c", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	if got := c.EventsURL(); got != "/events?access_token=a.b%2Bc" {
+		t.Errorf("with token: %q", got)
+	}
+}
+
+// call posts one packet to srv and returns its result
+func call(t *testing.T, hc *http.Client, url string, cp *crudp.CrudP, action byte, id uint8, item any) crudp.PacketResult {
+	t.Helper()
+	p := crudp.Packet{Action: action, HandlerID: id}
+	if item != nil {
+		data, err := cp.Codec().Encode(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Data = [][]byte{data}
+	}
+	batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{p}})
+	resp, err := hc.Post(url+"/api", "application/octet-stream", bytes.NewReader(batch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	var out crudp.BatchResponse
+	if err := cp.Codec().Decode(body, &out); err != nil || len(out.Results) != 1 {
+		t.Fatalf("status %d, decode: %v", resp.StatusCode, err)
+	}
+	return out.Results[0]
+}
+
+func TestSessionCookie(t *testing.T) {
+	j := newJWT(time.Now())
+	j.Cookie = "session"
+	verifier := VerifierFunc(func(ctx context.Context, username, password string) (Claims, error) {
+		if password != "pw" {
+			return Claims{}, Errf("invalid credentials")
+		}
+		return Claims{Subject: username}, nil
+	})
+	cfg := crudp.DefaultConfig()
+	cfg.UserProvider = Provider{}
+	cp := crudp.New(cfg, crudp.WithHandlers(j.SessionHandler(verifier), &Whoami{}))
+	srv := httptest.NewServer(j.Middleware(cp.BuildRouter()))
+	defer srv.Close()
+
+	cookies, _ := cookiejar.New(nil)
+	hc := &http.Client{Jar: cookies}
+	whoami := func() string {
+		var w Whoami
+		pr := call(t, hc, srv.URL, cp, 'r', 1, nil)
+		cp.DecodeData(&pr.Packet, 0, &w)
+		return w.Subject
+	}
+
+	if pr := call(t, hc, srv.URL, cp, 'c', 0, &Session{Username: "alice", Password: "bad"}); pr.MessageType != uint8(Msg.Error) {
+		t.Errorf("bad password accepted: %+v", pr)
+	}
+	if sub := whoami(); sub != "" {
+		t.Fatalf("anonymous caller seen as %q", sub)
+	}
+
+	pr := call(t, hc, srv.URL, cp, 'c', 0, &Session{Username: "alice", Password: "pw"})
+	var tokens Tokens
+	if err := cp.DecodeData(&pr.Packet, 0, &tokens); err != nil {
+		t.Fatal(err)
+	}
+	if tokens.AccessToken != "" || tokens.RefreshToken != "" || tokens.ExpiresAt == 0 {
+		t.Errorf("cookie session returned tokens: %+v", tokens)
+	}
+	if sub := whoami(); sub != "alice" {
+		t.Errorf("after login: %q", sub)
+	}
+
+	// Refresh from the refresh cookie
+	pr = call(t, hc, srv.URL, cp, 'u', 0, &Session{})
+	if pr.MessageType == uint8(Msg.Error) {
+		t.Errorf("refresh failed: %s", pr.Message)
+	}
+
+	call(t, hc, srv.URL, cp, 'd', 0, &Session{})
+	if sub := whoami(); sub != "" {
+		t.Errorf("after logout: %q", sub)
+	}
+	if pr := call(t, hc, srv.URL, cp, 'u', 0, &Session{}); pr.MessageType != uint8(Msg.Error) {
+		t.Error("refresh accepted after logout")
+	}
+}
+
+func TestClientSignIn(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	j := newJWT(now)
+	verifier := VerifierFunc(func(ctx context.Context, username, password string) (Claims, error) {
+		return Claims{Subject: username}, nil
+	})
+	server := crudp.New(crudp.WithHandlers(j.SessionHandler(verifier)))
+	client := crudp.NewLoopback(server, crudp.WithHandlers(&Session{}))
+
+	c := NewClient(client, nil)
+	c.now = func() time.Time { return now }
+	if err := c.SignIn("alice", "pw"); err != nil {
+		t.Fatal(err)
+	}
+	client.Broker().FlushNow()
+
+	tokens := c.Tokens()
+	claims, err := j.Parse(tokens.AccessToken)
+	if err != nil || claims.Subject != "alice" {
+		t.Fatalf("sign in: %+v %v", claims, err)
+	}
+
+	later := now.Add(14*time.Minute + 30*time.Second)
+	c.now = func() time.Time { return later }
+	j.now = c.now
+	c.Header()
+	client.Broker().FlushNow()
+	if renewed := c.Tokens(); renewed.ExpiresAt != later.Add(15*time.Minute).Unix() {
+		t.Errorf("not renewed through the session handler: %+v", renewed)
+	}
+
+	if err := c.SignOut(); err != nil {
+		t.Fatal(err)
+	}
+	client.Broker().FlushNow()
+	if c.Tokens() != (Tokens{}) {
+		t.Error("tokens kept after sign out")
+	}
+}
@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// TokenStore persists tokens between sessions (LocalStorage on WASM)
+type TokenStore interface {
+	Load() (Tokens, bool)
+	Save(Tokens)
+	Clear()
+}
+
+// MemoryStore keeps tokens for the life of the process
+type MemoryStore struct {
+	mu     sync.Mutex
+	tokens Tokens
+	ok     bool
+}
+
+func (s *MemoryStore) Load() (Tokens, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens, s.ok
+}
+
+func (s *MemoryStore) Save(t Tokens) {
+	s.mu.Lock()
+	s.tokens, s.ok = t, true
+	s.mu.Unlock()
+}
+
+func (s *MemoryStore) Clear() {
+	s.mu.Lock()
+	s.tokens, s.ok = Tokens{}, false
+	s.mu.Unlock()
+}
+
+// Client holds the tokens of a crudp client and renews them through the
+// refresh handler before the access token expires
+type Client struct {
+	Skew     time.Duration // Renew this long before expiry. Default: 1 minute
+	OnLogout func()        // Called when a refresh is rejected
+
+	cp         *crudp.CrudP
+	store      TokenStore
+	mu         sync.Mutex
+	tokens     Tokens
+	refreshing bool
+	now        func() time.Time
+}
+
+// NewClient loads the tokens from store (nil = MemoryStore) and watches the
+// results of cp, which must register &auth.Session{} or &auth.Refresh{}
+func NewClient(cp *crudp.CrudP, store TokenStore) *Client {
+	if store == nil {
+		store = &MemoryStore{}
+	}
+	c := &Client{Skew: time.Minute, cp: cp, store: store, now: time.Now}
+	c.tokens, _ = store.Load()
+	cp.OnResult(c.result)
+	return c
+}
+
+// Login stores the tokens returned by the application login
+func (c *Client) Login(t Tokens) {
+	c.mu.Lock()
+	c.tokens = t
+	c.mu.Unlock()
+	c.store.Save(t)
+}
+
+// SignIn queues a login on the session handler; the result stores the tokens
+func (c *Client) SignIn(username, password string) error {
+	id, ok := c.cp.HandlerID(SessionHandlerName)
+	if !ok {
+		return Errf("auth: register &auth.Session{} on the client")
+	}
+	return c.cp.EnqueuePacket(id, 'c', "", &Session{Username: username, Password: password})
+}
+
+// SignOut queues a logout on the session handler (which expires the session
+// cookies) and forgets the tokens
+func (c *Client) SignOut() error {
+	c.Logout()
+	id, ok := c.cp.HandlerID(SessionHandlerName)
+	if !ok {
+		return nil
+	}
+	return c.cp.EnqueuePacket(id, 'd', "", &Session{})
+}
+
+// Logout forgets the tokens
+func (c *Client) Logout() {
+	c.mu.Lock()
+	c.tokens = Tokens{}
+	c.refreshing = false
+	c.mu.Unlock()
+	c.store.Clear()
+}
+
+// Tokens returns the current tokens
+func (c *Client) Tokens() Tokens {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens
+}
+
+// Header returns the Authorization header value, "" without a valid access
+// token. Close to expiry it queues a refresh; expired tokens are not sent so
+// the refresh reaches the server.
+func (c *Client) Header() string {
+	c.mu.Lock()
+	t := c.tokens
+	now := c.now().Unix()
+	renew := t.ExpiresAt > 0 && !c.refreshing && now >= t.ExpiresAt-int64(c.Skew/time.Second)
+	c.mu.Unlock()
+
+	if renew {
+		if err := c.Refresh(); err != nil {
+			return ""
+		}
+	}
+	if t.AccessToken == "" || now >= t.ExpiresAt {
+		return ""
+	}
+	return "Bearer " + t.AccessToken
+}
+
+// Refresh queues a refresh packet; the result updates the tokens
+// The session handler is used when registered: its refresh token may be ""
+// when the session lives in cookies.
+func (c *Client) Refresh() error {
+	sessionID, session := c.cp.HandlerID(SessionHandlerName)
+	refreshID, ok := c.cp.HandlerID(HandlerName)
+	if !session && !ok {
+		return Errf("auth: register &auth.Session{} or &auth.Refresh{} on the client")
+	}
+
+	c.mu.Lock()
+	token := c.tokens.RefreshToken
+	if c.refreshing || (token == "" && !session) {
+		c.mu.Unlock()
+		return nil
+	}
+	c.refreshing = true
+	c.mu.Unlock()
+
+	if session {
+		return c.cp.EnqueuePacket(sessionID, 'u', "", &Session{RefreshToken: token})
+	}
+	return c.cp.EnqueuePacket(refreshID, 'c', "", &Refresh{RefreshToken: token})
+}
+
+// EventsURL is cp.EventsURL with the access token, as EventSource can't
+// send headers
+func (c *Client) EventsURL() string {
+	u := c.cp.EventsURL()
+	header := c.Header()
+	if header == "" {
+		return u
+	}
+	sep := "?"
+	for i := 0; i < len(u); i++ {
+		if u[i] == '?' {
+			sep = "&"
+			break
+		}
+	}
+	return u + sep + "access_token=" + url.QueryEscape(header[len("Bearer "):])
+}
+
+// result applies login and refresh results
+// A failed login leaves the tokens alone; the application sees it through
+// its own OnResult.
+func (c *Client) result(pr crudp.PacketResult) {
+	refreshID, hasRefresh := c.cp.HandlerID(HandlerName)
+	sessionID, hasSession := c.cp.HandlerID(SessionHandlerName)
+	var refresh bool
+	switch {
+	case hasRefresh && pr.HandlerID == refreshID && pr.Action == 'c':
+		refresh = true
+	case hasSession && pr.HandlerID == sessionID && (pr.Action == 'c' || pr.Action == 'u'):
+		refresh = pr.Action == 'u'
+	default:
+		return
+	}
+
+	var t Tokens
+	if pr.MessageType == uint8(Msg.Error) || len(pr.Data) == 0 || c.cp.DecodeData(&pr.Packet, 0, &t) != nil {
+		if !refresh {
+			return
+		}
+		c.Logout()
+		if c.OnLogout != nil {
+			c.OnLogout()
+		}
+		return
+	}
+	c.mu.Lock()
+	c.refreshing = false
+	c.mu.Unlock()
+	c.Login(t)
+}
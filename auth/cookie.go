@@ -0,0 +1,164 @@
+//go:build !wasm
+
+package auth
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// SessionHandler returns the session handler logging in with v and issuing
+// tokens with j. With j.Cookie set the tokens are sent as HttpOnly cookies
+// and the response only carries their expiry.
+func (j *JWT) SessionHandler(v Verifier) *Session {
+	return &Session{issuer: &sessionIssuer{jwt: j, verifier: v}}
+}
+
+type sessionIssuer struct {
+	jwt      *JWT
+	verifier Verifier
+}
+
+func (s *sessionIssuer) login(ctx context.Context, username, password string) (Tokens, error) {
+	c, err := s.verifier.Verify(ctx, username, password)
+	if err != nil {
+		return Tokens{}, err
+	}
+	tokens, err := s.jwt.Issue(c)
+	if err != nil {
+		return Tokens{}, err
+	}
+	return s.jwt.deliver(ctx, tokens), nil
+}
+
+func (s *sessionIssuer) refreshSession(ctx context.Context, token string) (Tokens, error) {
+	if token == "" && s.jwt.Cookie != "" {
+		if j := jarFrom(ctx); j != nil {
+			if ck, err := j.r.Cookie(s.jwt.Cookie + "_refresh"); err == nil {
+				token = ck.Value
+			}
+		}
+	}
+	if token == "" {
+		return Tokens{}, Errf("auth: no refresh token")
+	}
+	tokens, err := s.jwt.refresh(token)
+	if err != nil {
+		return Tokens{}, err
+	}
+	return s.jwt.deliver(ctx, tokens), nil
+}
+
+func (s *sessionIssuer) logout(ctx context.Context) {
+	if s.jwt.Cookie == "" {
+		return
+	}
+	if j := jarFrom(ctx); j != nil {
+		j.set(s.jwt.cookie(j.r, s.jwt.Cookie, "", -1))
+		j.set(s.jwt.cookie(j.r, s.jwt.Cookie+"_refresh", "", -1))
+	}
+}
+
+// deliver sets the session cookies, leaving only the expiry in the response
+// Without Cookie (or outside JWT.Middleware) tokens are returned as is.
+func (j *JWT) deliver(ctx context.Context, t Tokens) Tokens {
+	jar := jarFrom(ctx)
+	if j.Cookie == "" || jar == nil {
+		return t
+	}
+	jar.set(j.cookie(jar.r, j.Cookie, t.AccessToken, int(j.refreshTTL()/time.Second)))
+	jar.set(j.cookie(jar.r, j.Cookie+"_refresh", t.RefreshToken, int(j.refreshTTL()/time.Second)))
+	return Tokens{ExpiresAt: t.ExpiresAt}
+}
+
+// cookie builds a session cookie; maxAge < 0 deletes it
+// The access cookie outlives the token so an expired one still reaches the
+// middleware, which treats it as anonymous.
+func (j *JWT) cookie(r *http.Request, name, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   crudp.RequestScheme(r) == "https", // Also behind a TLS proxy
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// cookieClaims parses the access token in the session cookie
+func (j *JWT) cookieClaims(r *http.Request) (Claims, bool) {
+	if j.Cookie == "" {
+		return Claims{}, false
+	}
+	ck, err := r.Cookie(j.Cookie)
+	if err != nil || ck.Value == "" {
+		return Claims{}, false
+	}
+	c, err := j.Parse(ck.Value)
+	if err != nil || c.Type != "" {
+		return Claims{}, false
+	}
+	return c, true
+}
+
+// jar collects the cookies set by the session handler during a request
+type jar struct {
+	r       *http.Request
+	mu      sync.Mutex
+	cookies []*http.Cookie
+}
+
+type jarKey struct{}
+
+func jarFrom(ctx context.Context) *jar {
+	j, _ := ctx.Value(jarKey{}).(*jar)
+	return j
+}
+
+func (j *jar) set(c *http.Cookie) {
+	j.mu.Lock()
+	j.cookies = append(j.cookies, c)
+	j.mu.Unlock()
+}
+
+// withJar installs a jar whose cookies are written with the response headers
+func withJar(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request) {
+	j := &jar{r: r}
+	return &jarWriter{ResponseWriter: w, jar: j}, r.WithContext(context.WithValue(r.Context(), jarKey{}, j))
+}
+
+type jarWriter struct {
+	http.ResponseWriter
+	jar   *jar
+	wrote bool
+}
+
+func (w *jarWriter) WriteHeader(code int) {
+	if !w.wrote {
+		w.wrote = true
+		w.jar.mu.Lock()
+		for _, c := range w.jar.cookies {
+			http.SetCookie(w.ResponseWriter, c)
+		}
+		w.jar.mu.Unlock()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *jarWriter) Write(b []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach Flush for SSE
+func (w *jarWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,241 @@
+//go:build !wasm
+
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/cdvelop/tinyjson"
+	. "github.com/cdvelop/tinystring"
+)
+
+// jwtHeader is the encoded {"alg":"HS256","typ":"JWT"}
+const jwtHeader = "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9"
+
+var b64 = base64.RawURLEncoding
+
+// Default token lifetimes, used when AccessTTL or RefreshTTL is 0
+const (
+	DefaultAccessTTL  = 15 * time.Minute
+	DefaultRefreshTTL = 7 * 24 * time.Hour
+)
+
+// defaultJSON encodes claims of a JWT built without New
+var defaultJSON = tinyjson.New()
+
+// JWT signs and verifies HS256 tokens
+// A literal JWT{Secret: s} works the same as New(s).
+type JWT struct {
+	Secret     []byte
+	Issuer     string        // Set in issued tokens and required when parsing, "" = any
+	AccessTTL  time.Duration // Default: 15 minutes
+	RefreshTTL time.Duration // Default: 7 days
+	Leeway     time.Duration // Clock skew tolerated on expiry
+	Cookie     string        // SessionHandler issues HttpOnly cookies with this name, "" = tokens in the response
+
+	json *tinyjson.TinyJSON // nil = defaultJSON
+	now  func() time.Time   // nil = time.Now
+}
+
+// New returns a JWT signer with default lifetimes
+func New(secret []byte) *JWT {
+	return &JWT{
+		Secret:     secret,
+		AccessTTL:  DefaultAccessTTL,
+		RefreshTTL: DefaultRefreshTTL,
+		json:       tinyjson.New(),
+		now:        time.Now,
+	}
+}
+
+func (j *JWT) codec() *tinyjson.TinyJSON {
+	if j.json == nil {
+		return defaultJSON
+	}
+	return j.json
+}
+
+func (j *JWT) clock() time.Time {
+	if j.now == nil {
+		return time.Now()
+	}
+	return j.now()
+}
+
+func (j *JWT) accessTTL() time.Duration {
+	if j.AccessTTL <= 0 {
+		return DefaultAccessTTL
+	}
+	return j.AccessTTL
+}
+
+func (j *JWT) refreshTTL() time.Duration {
+	if j.RefreshTTL <= 0 {
+		return DefaultRefreshTTL
+	}
+	return j.RefreshTTL
+}
+
+// Sign encodes and signs claims as is
+// Parse rejects tokens without ExpiresAt; Issue always sets it.
+func (j *JWT) Sign(c Claims) (string, error) {
+	payload, err := j.codec().Encode(c)
+	if err != nil {
+		return "", err
+	}
+	token := jwtHeader + "." + b64.EncodeToString(payload)
+	return token + "." + j.signature(token), nil
+}
+
+func (j *JWT) signature(signed string) string {
+	mac := hmac.New(sha256.New, j.Secret)
+	mac.Write([]byte(signed))
+	return b64.EncodeToString(mac.Sum(nil))
+}
+
+// Parse verifies the signature, issuer and expiry of token
+// Tokens without an expiry are rejected, they would be valid forever.
+func (j *JWT) Parse(token string) (Claims, error) {
+	var c Claims
+	dot1, dot2 := -1, -1
+	for i := 0; i < len(token); i++ {
+		if token[i] == '.' {
+			if dot1 < 0 {
+				dot1 = i
+			} else if dot2 < 0 {
+				dot2 = i
+			} else {
+				return c, Errf("auth: malformed token")
+			}
+		}
+	}
+	if dot2 < 0 {
+		return c, Errf("auth: malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	raw, err := b64.DecodeString(token[:dot1])
+	if err != nil || j.codec().Decode(raw, &header) != nil || header.Alg != "HS256" {
+		return c, Errf("auth: unsupported token algorithm")
+	}
+	if !hmac.Equal([]byte(token[dot2+1:]), []byte(j.signature(token[:dot2]))) {
+		return c, Errf("auth: invalid signature")
+	}
+
+	raw, err = b64.DecodeString(token[dot1+1 : dot2])
+	if err != nil {
+		return c, Errf("auth: malformed token")
+	}
+	if err := j.codec().Decode(raw, &c); err != nil {
+		return c, Err(Fmt("auth: malformed claims: %v", err))
+	}
+	if j.Issuer != "" && c.Issuer != j.Issuer {
+		return c, Err(Fmt("auth: unexpected issuer %s", c.Issuer))
+	}
+	if c.ExpiresAt <= 0 {
+		return c, Errf("auth: token without expiry")
+	}
+	if j.clock().Add(-j.Leeway).Unix() > c.ExpiresAt {
+		return c, Errf("auth: token expired")
+	}
+	return c, nil
+}
+
+// Issue returns an access and a refresh token for claims (e.g. after login)
+func (j *JWT) Issue(c Claims) (Tokens, error) {
+	now := j.clock()
+	c.Issuer = j.Issuer
+	c.IssuedAt = now.Unix()
+
+	access := c
+	access.Type = ""
+	access.ExpiresAt = now.Add(j.accessTTL()).Unix()
+	refresh := c
+	refresh.Type = "refresh"
+	refresh.ExpiresAt = now.Add(j.refreshTTL()).Unix()
+
+	var t Tokens
+	var err error
+	if t.AccessToken, err = j.Sign(access); err != nil {
+		return t, err
+	}
+	if t.RefreshToken, err = j.Sign(refresh); err != nil {
+		return t, err
+	}
+	t.ExpiresAt = access.ExpiresAt
+	return t, nil
+}
+
+// Middleware stores the claims of a valid access token in the request context
+// The token is read from "Authorization: Bearer <token>", or from the
+// access_token query parameter for EventSource (which can't set headers).
+// Invalid or expired tokens are rejected with 401; requests without a token
+// continue anonymously (so clients can refresh), handlers and
+// SubscriptionAuthorizer decide what anonymous callers may do.
+// With Cookie set, the session cookie is read last; an expired cookie counts
+// as anonymous so the session can still be refreshed.
+func (j *JWT) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if j.Cookie != "" {
+			w, r = withJar(w, r)
+		}
+
+		token := bearer(r.Header.Get("Authorization"))
+		if token == "" {
+			token = r.URL.Query().Get("access_token")
+		}
+		if token == "" {
+			if c, ok := j.cookieClaims(r); ok {
+				r = r.WithContext(WithClaims(r.Context(), c))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		c, err := j.Parse(token)
+		if err == nil && c.Type != "" {
+			err = Errf("auth: not an access token")
+		}
+		if err != nil {
+			unauthorized(w, err.Error())
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), c)))
+	})
+}
+
+func bearer(header string) string {
+	const prefix = "Bearer "
+	if len(header) > len(prefix) && header[:len(prefix)] == prefix {
+		return header[len(prefix):]
+	}
+	return ""
+}
+
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="crudp"`)
+	http.Error(w, message, http.StatusUnauthorized)
+}
+
+// RefreshHandler returns the refresh handler issuing tokens with j
+func (j *JWT) RefreshHandler() *Refresh {
+	return &Refresh{issuer: j}
+}
+
+// refresh issues new Tokens with the claims of a valid refresh token
+func (j *JWT) refresh(token string) (Tokens, error) {
+	c, err := j.Parse(token)
+	if err != nil {
+		return Tokens{}, err
+	}
+	if c.Type != "refresh" {
+		return Tokens{}, Errf("auth: not a refresh token")
+	}
+	return j.Issue(c)
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// SessionHandlerName of the session handler; register it on client and server
+const SessionHandlerName = "auth_session"
+
+// Verifier checks login credentials and returns the identity to issue
+type Verifier interface {
+	Verify(ctx context.Context, username, password string) (Claims, error)
+}
+
+// VerifierFunc adapts a function to Verifier
+type VerifierFunc func(ctx context.Context, username, password string) (Claims, error)
+
+func (f VerifierFunc) Verify(ctx context.Context, username, password string) (Claims, error) {
+	return f(ctx, username, password)
+}
+
+// Session is the crudp handler ("auth_session") for login (Create), refresh
+// (Update) and logout (Delete). Register JWT.SessionHandler(verifier) on the
+// server and &auth.Session{} on the client, at the same position.
+type Session struct {
+	Username     string `json:"username,omitempty"`
+	Password     string `json:"password,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"` // Update; "" = refresh cookie
+
+	issuer interface {
+		login(ctx context.Context, username, password string) (Tokens, error)
+		refreshSession(ctx context.Context, token string) (Tokens, error)
+		logout(ctx context.Context)
+	} // Nil on the client
+}
+
+func (s *Session) HandlerName() string { return SessionHandlerName }
+
+// Validate rejects packets without one session item
+func (s *Session) Validate(action byte, data ...any) error {
+	if s.issuer == nil {
+		return Errf("auth: session handler not configured, use JWT.SessionHandler")
+	}
+	if len(data) != 1 {
+		return Errf("auth: session expects one item")
+	}
+	in, ok := data[0].(*Session)
+	if !ok {
+		return Errf("auth: unexpected session data")
+	}
+	if action == 'c' && in.Username == "" {
+		return Errf("auth: username required")
+	}
+	return nil
+}
+
+// Create logs in with the credentials and returns the issued Tokens
+func (s *Session) Create(ctx context.Context, data ...any) any {
+	in := data[0].(*Session)
+	tokens, err := s.issuer.login(ctx, in.Username, in.Password)
+	if err != nil {
+		return failed{err}
+	}
+	return tokens
+}
+
+// Update exchanges the refresh token for new Tokens
+func (s *Session) Update(ctx context.Context, data ...any) any {
+	tokens, err := s.issuer.refreshSession(ctx, data[0].(*Session).RefreshToken)
+	if err != nil {
+		return failed{err}
+	}
+	return tokens
+}
+
+// Delete logs out, expiring the session cookies
+func (s *Session) Delete(ctx context.Context, data ...any) any {
+	s.issuer.logout(ctx)
+	return nil
+}
@@ -0,0 +1,48 @@
+//go:build wasm
+
+package auth
+
+import (
+	"syscall/js"
+
+	"github.com/cdvelop/tinyjson"
+)
+
+// LocalStorage keeps tokens in the browser localStorage under Key
+type LocalStorage struct {
+	Key  string
+	json *tinyjson.TinyJSON
+}
+
+// NewLocalStorage returns a TokenStore saving under key
+func NewLocalStorage(key string) *LocalStorage {
+	return &LocalStorage{Key: key, json: tinyjson.New()}
+}
+
+func (s *LocalStorage) storage() js.Value {
+	return js.Global().Get("localStorage")
+}
+
+func (s *LocalStorage) Load() (Tokens, bool) {
+	var t Tokens
+	v := s.storage().Call("getItem", s.Key)
+	if v.IsNull() || v.IsUndefined() {
+		return t, false
+	}
+	if err := s.json.Decode([]byte(v.String()), &t); err != nil {
+		return t, false
+	}
+	return t, true
+}
+
+func (s *LocalStorage) Save(t Tokens) {
+	encoded, err := s.json.Encode(t)
+	if err != nil {
+		return
+	}
+	s.storage().Call("setItem", s.Key, string(encoded))
+}
+
+func (s *LocalStorage) Clear() {
+	s.storage().Call("removeItem", s.Key)
+}
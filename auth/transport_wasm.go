@@ -0,0 +1,78 @@
+//go:build wasm
+
+package auth
+
+import (
+	"syscall/js"
+
+	"github.com/cdvelop/crudp"
+)
+
+// Transport sends the batches of cp to EndpointURL(APIEndpoint) with
+// fetch, adding the Authorization header of c, and passes the responses to
+// cp.ReceiveBatch. A 401 logs the client out.
+func Transport(cp *crudp.CrudP, c *Client) {
+	endpoint := cp.EndpointURL(cp.Config().APIEndpoint)
+	cp.Broker().SetOnFlush(func(batch []byte) {
+		c.send(endpoint, batch)
+	})
+}
+
+// send posts batch and feeds the response to ReceiveBatch
+func (c *Client) send(endpoint string, batch []byte) {
+	headers := js.Global().Get("Object").New()
+	headers.Set("Content-Type", "application/octet-stream")
+	if auth := c.Header(); auth != "" {
+		headers.Set("Authorization", auth)
+	}
+
+	body := js.Global().Get("Uint8Array").New(len(batch))
+	js.CopyBytesToJS(body, batch)
+
+	init := js.Global().Get("Object").New()
+	init.Set("method", "POST")
+	init.Set("headers", headers)
+	init.Set("body", body)
+
+	var onResponse, onBody, onError js.Func
+	release := func() {
+		onResponse.Release()
+		onBody.Release()
+		onError.Release()
+	}
+	onError = js.FuncOf(func(this js.Value, args []js.Value) any {
+		release()
+		c.cp.Broker().Nack(batch) // Sent again after Config.RetryInterval
+		c.mu.Lock()
+		c.refreshing = false // A refresh in this batch may be retried
+		c.mu.Unlock()
+		return nil
+	})
+	onBody = js.FuncOf(func(this js.Value, args []js.Value) any {
+		data := js.Global().Get("Uint8Array").New(args[0])
+		response := make([]byte, data.Get("length").Int())
+		js.CopyBytesToGo(response, data)
+		release()
+		c.cp.ReceiveBatch(response)
+		return nil
+	})
+	onResponse = js.FuncOf(func(this js.Value, args []js.Value) any {
+		resp := args[0]
+		if resp.Get("status").Int() == 401 {
+			release()
+			c.Logout()
+			if c.OnLogout != nil {
+				c.OnLogout()
+			}
+			return nil
+		}
+		if !resp.Get("ok").Bool() {
+			release()
+			c.cp.Broker().Nack(batch)
+			return nil
+		}
+		return resp.Call("arrayBuffer").Call("then", onBody, onError)
+	})
+
+	js.Global().Call("fetch", endpoint, init).Call("then", onResponse).Call("catch", onError)
+}
@@ -273,3 +273,40 @@ func BenchmarkCrudPLargePayloadShared(b *testing.B) {
 
 	globalResponse = response // Prevent optimization
 }
+
+// BenchmarkCrudP_Batch measures ProcessBatch for a multi-item batch, JSON or binary framing
+func benchmarkCrudPBatch(b *testing.B, binary bool) {
+	cfg := DefaultConfig()
+	cfg.UseBinary = binary
+	cp := New(cfg)
+	if err := cp.RegisterHandler(&BenchUser{}); err != nil {
+		b.Fatalf("RegisterHandler failed: %v", err)
+	}
+
+	data := make([][]byte, 0, 20)
+	for i := 0; i < cap(data); i++ {
+		item, err := cp.Codec().Encode(globalUser)
+		if err != nil {
+			b.Fatalf("Encode failed: %v", err)
+		}
+		data = append(data, item)
+	}
+	batch, err := cp.Codec().Encode(BatchRequest{Packets: []Packet{{Action: 'r', Data: data}}})
+	if err != nil {
+		b.Fatalf("Encode batch failed: %v", err)
+	}
+
+	var response []byte
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		response, err = cp.ProcessBatch(context.Background(), batch)
+		if err != nil {
+			b.Fatalf("ProcessBatch failed: %v", err)
+		}
+	}
+
+	globalResponse = response // Prevent optimization
+}
@@ -33,3 +33,11 @@ func BenchmarkCrudP_AllOperations(b *testing.B) {
 func BenchmarkCrudP_LargePayload(b *testing.B) {
 	BenchmarkCrudPLargePayloadShared(b)
 }
+
+func BenchmarkCrudP_BatchJSON(b *testing.B) {
+	benchmarkCrudPBatch(b, false)
+}
+
+func BenchmarkCrudP_BatchBinary(b *testing.B) {
+	benchmarkCrudPBatch(b, true)
+}
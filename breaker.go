@@ -0,0 +1,196 @@
+package crudp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// CircuitBreakerConfig tracks handler latency and fast-fails handlers that
+// keep failing (Config.CircuitBreaker)
+// A handler call fails when it times out, returns an error through its
+// Response, or runs longer than SlowCall. After Failures consecutive failures
+// its packets get a Msg.Warning "temporarily unavailable" result for OpenFor;
+// then one packet probes the handler: success closes the circuit, failure
+// opens it again.
+type CircuitBreakerConfig struct {
+	// Failures in a row opening the circuit. Default: 5
+	Failures int
+
+	// SlowCall in milliseconds; longer calls count as failures and are
+	// logged. Default: 0 (only timeouts and errors)
+	SlowCall int
+
+	// OpenFor in milliseconds before a probe is let through. Default: 30000
+	OpenFor int
+}
+
+// Circuit states reported by HandlerStats
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open" // A probe is running
+)
+
+// HandlerStats is the latency and circuit state of a handler
+type HandlerStats struct {
+	Handler     string
+	Calls       int
+	Failures    int           // Total failed calls
+	Consecutive int           // Failures since the last success
+	AvgLatency  time.Duration // Over all calls
+	MaxLatency  time.Duration
+	State       string
+}
+
+// HandlerUnavailableError is the result of a packet fast-failed by an open
+// circuit; the client may retry after RetryAfter
+type HandlerUnavailableError struct {
+	Handler    string
+	RetryAfter time.Duration
+}
+
+func (e *HandlerUnavailableError) Error() string {
+	return Fmt("handler %s temporarily unavailable: retry after %dms", e.Handler, e.RetryAfter.Milliseconds())
+}
+
+// breakers holds the per-handler state (slice, no maps for TinyGo)
+type breakers struct {
+	mu    sync.Mutex
+	stats []breakerState
+}
+
+type breakerState struct {
+	HandlerStats
+	total    time.Duration
+	openedAt time.Time
+	probing  bool
+}
+
+// find returns the state of handler, adding it (must hold mu)
+func (b *breakers) find(handler string) *breakerState {
+	for i := range b.stats {
+		if b.stats[i].Handler == handler {
+			return &b.stats[i]
+		}
+	}
+	b.stats = append(b.stats, breakerState{HandlerStats: HandlerStats{Handler: handler, State: CircuitClosed}})
+	return &b.stats[len(b.stats)-1]
+}
+
+func (c *CircuitBreakerConfig) failures() int {
+	if c.Failures > 0 {
+		return c.Failures
+	}
+	return 5
+}
+
+func (c *CircuitBreakerConfig) openFor() time.Duration {
+	if c.OpenFor > 0 {
+		return time.Duration(c.OpenFor) * time.Millisecond
+	}
+	return 30 * time.Second
+}
+
+// HandlerStats returns the latency and circuit state of the handlers called
+// since start, nil without Config.CircuitBreaker
+func (cp *CrudP) HandlerStats() []HandlerStats {
+	cp.breakers.mu.Lock()
+	defer cp.breakers.mu.Unlock()
+	var out []HandlerStats
+	for _, s := range cp.breakers.stats {
+		out = append(out, s.HandlerStats)
+	}
+	return out
+}
+
+// checkCircuit fast-fails packets of a handler whose circuit is open, letting
+// one probe through once OpenFor has passed
+func (cp *CrudP) checkCircuit(handler *actionHandler, packet *Packet) (PacketResult, error) {
+	cb := cp.config.CircuitBreaker
+	if cb == nil {
+		return PacketResult{}, nil
+	}
+
+	b := &cp.breakers
+	b.mu.Lock()
+	s := b.find(handler.name)
+	var wait time.Duration
+	switch s.State {
+	case CircuitOpen:
+		if wait = cb.openFor() - time.Since(s.openedAt); wait <= 0 {
+			s.State = CircuitHalfOpen
+			s.probing = true
+			s.openedAt = time.Now()
+		}
+	case CircuitHalfOpen:
+		// Until the probe reports; a probe rejected before reaching the
+		// handler (e.g. invalid data) is replaced after OpenFor
+		if wait = cb.openFor() - time.Since(s.openedAt); wait <= 0 {
+			s.openedAt = time.Now()
+		}
+	}
+	b.mu.Unlock()
+
+	if wait <= 0 {
+		return PacketResult{}, nil
+	}
+	err := &HandlerUnavailableError{Handler: handler.name, RetryAfter: wait}
+	return PacketResult{
+		Packet:      packet.echo(),
+		MessageType: uint8(Msg.Warning),
+		Message:     err.Error(),
+		RetryAfter:  retryAfterMs(wait),
+	}, err
+}
+
+// recordCall updates the stats of handler after a call that took d
+// failed reports a timeout or handler error; slow calls fail too.
+func (cp *CrudP) recordCall(handler *actionHandler, d time.Duration, failed bool) {
+	cb := cp.config.CircuitBreaker
+	if cb == nil {
+		return
+	}
+	if cb.SlowCall > 0 && d > time.Duration(cb.SlowCall)*time.Millisecond {
+		cp.log.Warn("slow handler", "handler", handler.name, "ms", d.Milliseconds())
+		failed = true
+	}
+
+	b := &cp.breakers
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.find(handler.name)
+	s.Calls++
+	s.total += d
+	s.AvgLatency = s.total / time.Duration(s.Calls)
+	if d > s.MaxLatency {
+		s.MaxLatency = d
+	}
+
+	if !failed {
+		if s.State != CircuitClosed {
+			cp.log.Info("circuit closed", "handler", handler.name)
+		}
+		s.Consecutive = 0
+		s.State = CircuitClosed
+		s.probing = false
+		return
+	}
+
+	s.Failures++
+	s.Consecutive++
+	if s.probing || (s.State == CircuitClosed && s.Consecutive >= cb.failures()) {
+		cp.log.Warn("circuit open", "handler", handler.name, "failures", s.Consecutive)
+		s.State = CircuitOpen
+		s.openedAt = time.Now()
+		s.probing = false
+	}
+}
+
+// timedOut reports whether err comes from the call deadline
+func timedOut(ctx context.Context, err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
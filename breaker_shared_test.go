@@ -0,0 +1,102 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Flaky fails while failing is set
+type Flaky struct{}
+
+var flakyFailing bool
+var flakyCalls int
+
+type flakyResult struct{ err error }
+
+func (r flakyResult) Response() (any, []string, error) { return nil, nil, r.err }
+
+func (h *Flaky) Read(ctx context.Context, data ...any) any {
+	flakyCalls++
+	if flakyFailing {
+		return flakyResult{err: Errf("database down")}
+	}
+	return "ok"
+}
+
+// Sleepy takes longer than the SlowCall threshold
+type Sleepy struct{}
+
+func (h *Sleepy) Read(ctx context.Context, data ...any) any {
+	time.Sleep(15 * time.Millisecond)
+	return "ok"
+}
+
+func CircuitBreakerShared(t *testing.T) {
+	t.Run("Opens Fast Fails And Recovers", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.CircuitBreaker = &crudp.CircuitBreakerConfig{Failures: 3, OpenFor: 40}
+		cp := crudp.New(cfg, crudp.WithHandlers(&Flaky{}, &UserController{}))
+
+		flakyFailing, flakyCalls = true, 0
+		for i := 0; i < 3; i++ {
+			if pr := processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 0}); pr.MessageType != uint8(Msg.Error) {
+				t.Fatalf("call %d: expected handler error, got %q", i, pr.Message)
+			}
+		}
+
+		pr := processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 0})
+		if pr.MessageType != uint8(Msg.Warning) || pr.RetryAfter <= 0 || flakyCalls != 3 {
+			t.Fatalf("expected fast fail, got %d %q retry %d, %d calls", pr.MessageType, pr.Message, pr.RetryAfter, flakyCalls)
+		}
+		if pr := processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 1}); pr.MessageType != uint8(Msg.Success) {
+			t.Errorf("other handler affected: %q", pr.Message)
+		}
+
+		// Failed probe: open again
+		time.Sleep(50 * time.Millisecond)
+		processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 0})
+		if flakyCalls != 4 || stateOf(cp, "flaky") != crudp.CircuitOpen {
+			t.Fatalf("probe: %d calls, state %s", flakyCalls, stateOf(cp, "flaky"))
+		}
+
+		// Successful probe: closed
+		flakyFailing = false
+		time.Sleep(50 * time.Millisecond)
+		if pr := processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 0}); pr.MessageType != uint8(Msg.Success) {
+			t.Fatalf("probe after recovery: %q", pr.Message)
+		}
+		if stateOf(cp, "flaky") != crudp.CircuitClosed {
+			t.Errorf("circuit not closed: %s", stateOf(cp, "flaky"))
+		}
+	})
+
+	t.Run("Slow Calls Count As Failures", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.CircuitBreaker = &crudp.CircuitBreakerConfig{Failures: 2, SlowCall: 5}
+		cp := crudp.New(cfg, crudp.WithHandlers(&Sleepy{}))
+
+		processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 0})
+		processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 0})
+		if pr := processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 0}); pr.MessageType != uint8(Msg.Warning) {
+			t.Errorf("expected slow handler to be fast-failed, got %q", pr.Message)
+		}
+
+		stats := cp.HandlerStats()
+		if len(stats) != 1 || stats[0].Calls != 2 || stats[0].Failures != 2 || stats[0].MaxLatency < 15*time.Millisecond {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+	})
+}
+
+func stateOf(cp *crudp.CrudP, handler string) string {
+	for _, s := range cp.HandlerStats() {
+		if s.Handler == handler {
+			return s.State
+		}
+	}
+	return ""
+}
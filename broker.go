@@ -1,7 +1,9 @@
 package crudp
 
 import (
+    "io"
     "sync"
+    "time"
 
     "github.com/cdvelop/tinytime"
 )
@@ -10,18 +12,62 @@ import (
 type broker struct {
     mu          sync.Mutex
     queue       []Packet      // Queue of pending packets
-    batchWindow int
+    tries       []uint8       // Send attempts, aligned with queue
+    inflight    []inflight    // Flushed batches waiting for ReceiveBatch
+    maxRetries  int
+    retryInterval int
+    ttl         int           // Config.PacketTTL, ms
+    strategy    FlushStrategy
     timer       tinytime.Timer
     tp          tinytime.TimeProvider
     codec       Codec
     onFlush     func([]byte) // Callback to send batch
+    paused      bool         // Packets are kept until Resume
+    offline     uint8        // offlineStream | offlineNetwork, kept until 0
+    canceled    []string     // ReqIDs passed to Cancel while in flight, never retried
+    sentAt      time.Time    // Last flush, for LatencyObserver strategies
+    stats       BrokerStats  // Counters, see Stats
+}
+
+// BrokerStats describes the broker state for debugging (see Broker().Stats)
+type BrokerStats struct {
+    Queued       int            // Packets waiting to be flushed
+    Items        int            // Data items in those packets
+    ByHandler    []HandlerQueue // Queued packets per handler, in queue order
+    Enqueued     uint64         // Items enqueued since start
+    Consolidated uint64         // Items merged into an already queued packet
+    Superseded   uint64         // Queued Update items replaced or dropped by a newer mutation, see Keyer
+    Flushes      uint64         // Batches sent
+    InFlight     int            // Batches sent and not answered yet
+    Requeued     uint64         // Items sent again after a failure
+    Dropped      uint64         // Items given up after MaxRetries
+    LastFlush    time.Time      // Zero if nothing was sent yet
+    LastPackets  int            // Packets in the last batch
+    LastBytes    int            // Encoded size of the last batch
+    Paused       bool
+    Offline      bool // No event transport connected or no network, see Connect and WatchNetwork
+    Scheduled    bool // A flush timer is pending
+}
+
+// HandlerQueue counts the queued packets of one handler
+type HandlerQueue struct {
+    HandlerID uint8
+    Packets   int
+    Items     int
 }
 
 // newBroker creates a new broker
 func newBroker(cfg *Config, codec Codec) *broker {
+    strategy := cfg.FlushStrategy
+    if strategy == nil {
+        strategy = Debounce(cfg.BatchWindow)
+    }
     return &broker{
         queue:       make([]Packet, 0, 16), // Typical pre-alloc
-        batchWindow: cfg.BatchWindow,
+        strategy:    strategy,
+        maxRetries:  cfg.MaxRetries,
+        retryInterval: cfg.RetryInterval,
+        ttl:         cfg.PacketTTL,
         tp:          tinytime.NewTimeProvider(),
         codec:       codec,
     }
@@ -34,47 +80,157 @@ func (b *broker) SetOnFlush(fn func([]byte)) {
     b.mu.Unlock()
 }
 
+// SetFlushStrategy replaces the flush policy at runtime (nil is ignored)
+func (b *broker) SetFlushStrategy(s FlushStrategy) {
+    if s == nil {
+        return
+    }
+    b.mu.Lock()
+    b.strategy = s
+    b.mu.Unlock()
+}
+
 // Enqueue adds a packet to the queue, consolidating by Handler+Action
 func (b *broker) Enqueue(handlerID uint8, action byte, reqID string, data []byte) {
+    b.enqueue(Packet{Action: action, HandlerID: handlerID, ReqID: reqID}, data)
+}
+
+// enqueue adds data under head, consolidating by Handler+Action+Version
+// Paged, conditional and deferred packets (head.Page, head.IfNoneMatch,
+// head.Deferred set), patches, syncs and packets with attachments are always
+// sent on their own. Items
+// with an entity key (see Keyer) supersede the queued Update of the entity.
+func (b *broker) enqueue(head Packet, data ...[]byte) {
     b.mu.Lock()
     defer b.mu.Unlock()
+    b.stampLocked(&head)
 
     // Find existing packet with same handler+action to consolidate
-    for i := range b.queue {
-        p := &b.queue[i]
-        if p.HandlerID == handlerID && p.Action == action {
-            // Consolidate: add data to existing packet
-            p.Data = append(p.Data, data)
-            b.resetTimerLocked()
+    // Packets with dependencies keep their own ReqID and item indexes,
+    // attachments belong to the packet they were sent with
+    if mergeable(&head) && head.Action != ActionPatch && head.Action != ActionSync {
+        if b.supersedeLocked(&head, data) {
             return
         }
+        for i := range b.queue {
+            p := &b.queue[i]
+            if mergeable(p) && p.HandlerID == head.HandlerID && p.Action == head.Action && p.Version == head.Version {
+                // Consolidate: add data to existing packet
+                // head.Data is not set yet: align its keys with data
+                p.keys = append(p.itemKeys(), alignKeys(head.keys, len(data))...)
+                p.Data = append(p.Data, data...)
+                p.Deadline = laterDeadline(p.Deadline, head.Deadline)
+                if head.ReadAfter != "" { // Tokens of a handler only grow
+                    p.ReadAfter = head.ReadAfter
+                }
+                b.stats.Enqueued += uint64(len(data))
+                b.stats.Consolidated += uint64(len(data))
+                b.scheduleLocked()
+                return
+            }
+        }
     }
 
-    // New packet
-    b.queue = append(b.queue, Packet{
-        Action:    action,
-        HandlerID: handlerID,
-        ReqID:     reqID,
-        Data:      [][]byte{data},
-    })
+    b.pushLocked(head, data)
+}
 
-    b.resetTimerLocked()
+// mergeable reports whether a queued packet may take the items of others
+func mergeable(p *Packet) bool {
+    return p.Page == nil && p.IfNoneMatch == "" && !p.hasDeps() && len(p.Attachments) == 0 && !p.Deferred
 }
 
-// resetTimerLocked resets the flush timer (must be called with lock)
-func (b *broker) resetTimerLocked() {
+// supersedeLocked applies a keyed Update or Delete to the queued Updates of
+// the same entity (must be called with lock): an Update replaces the queued
+// item in place and is done; a Delete drops it and is still queued.
+func (b *broker) supersedeLocked(head *Packet, data [][]byte) bool {
+    if (head.Action != 'u' && head.Action != 'd') || len(head.keys) != 1 || head.keys[0] == "" || len(data) != 1 {
+        return false
+    }
+    key := head.keys[0]
+    for i := 0; i < len(b.queue); i++ {
+        p := &b.queue[i]
+        if p.Action != 'u' || p.HandlerID != head.HandlerID || p.Version != head.Version || !mergeable(p) {
+            continue
+        }
+        for j, k := range p.keys {
+            if k != key {
+                continue
+            }
+            b.stats.Superseded++
+            if head.Action == 'u' {
+                p.Data[j] = data[0]
+                p.Deadline = laterDeadline(p.Deadline, head.Deadline)
+                b.stats.Enqueued++
+                b.scheduleLocked()
+                return true
+            }
+            p.Data = append(p.Data[:j:j], p.Data[j+1:]...)
+            p.keys = append(p.keys[:j:j], p.keys[j+1:]...)
+            if len(p.Data) == 0 {
+                b.queue = append(b.queue[:i:i], b.queue[i+1:]...)
+                b.tries = append(b.tries[:i:i], b.tries[i+1:]...)
+            }
+            return false
+        }
+    }
+    return false
+}
+
+// enqueueOwn adds a packet that is never consolidated, so its result keeps
+// its ReqID (see HandlerClient)
+func (b *broker) enqueueOwn(head Packet, data ...[]byte) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    b.stampLocked(&head)
+    b.pushLocked(head, data)
+}
+
+// stampLocked sets the Config.PacketTTL deadline of a packet without WithTTL (must be called with lock)
+func (b *broker) stampLocked(head *Packet) {
+    if head.Deadline == 0 {
+        head.Deadline = deadlineIn(b.ttl)
+    }
+}
+
+// pushLocked appends a new packet to the queue (must be called with lock)
+func (b *broker) pushLocked(head Packet, data [][]byte) {
+    head.Data = data
+    b.queue = append(b.queue, head)
+    b.tries = append(b.tries, 0)
+    b.stats.Enqueued += uint64(len(data))
+
+    b.scheduleLocked()
+}
+
+// scheduleLocked (re)starts the flush timer as the strategy says (must be called with lock)
+func (b *broker) scheduleLocked() {
+    delay := b.strategy.Delay(len(b.queue), b.timer != nil)
+    if delay < 0 {
+        return
+    }
     if b.timer != nil {
         b.timer.Stop()
     }
-    b.timer = b.tp.AfterFunc(b.batchWindow, b.flush)
+    b.timer = b.tp.AfterFunc(delay, b.flush)
+}
+
+// received reports the round trip of the last flush to the strategy
+func (b *broker) received() {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if o, ok := b.strategy.(LatencyObserver); ok && !b.sentAt.IsZero() {
+        o.ObserveLatency(int(time.Since(b.sentAt).Milliseconds()))
+        b.sentAt = time.Time{}
+    }
 }
 
 // flush sends all packets in queue
 func (b *broker) flush() {
     b.mu.Lock()
-    defer b.mu.Unlock()
+    b.timer = nil // Fired or stopped by FlushNow
 
-    if len(b.queue) == 0 {
+    if len(b.queue) == 0 || b.paused || b.offline != 0 {
+        b.mu.Unlock()
         return
     }
 
@@ -83,26 +239,156 @@ func (b *broker) flush() {
     encoded, err := b.codec.Encode(batch)
     if err != nil {
         // Log error but don't panic
+        b.mu.Unlock()
         return
     }
 
-    // Clear queue (keep capacity)
-    b.queue = b.queue[:0]
+    b.stats.Flushes++
+    b.stats.LastPackets = len(b.queue)
+    b.stats.LastBytes = len(encoded)
 
-    // Send if callback exists
-    if b.onFlush != nil {
-        b.onFlush(encoded)
+    b.sentLocked(time.Now())
+    b.stats.LastFlush = b.sentAt
+    onFlush := b.onFlush
+    b.mu.Unlock()
+
+    // Send outside the lock so the callback may enqueue again
+    if onFlush != nil {
+        onFlush(encoded)
     }
 }
 
 // FlushNow forces an immediate flush (useful for testing or shutdown)
 func (b *broker) FlushNow() {
+    b.mu.Lock()
     if b.timer != nil {
         b.timer.Stop()
     }
+    b.mu.Unlock()
     b.flush()
 }
 
+// Pause keeps enqueued packets instead of sending them (e.g. server maintenance)
+func (b *broker) Pause() {
+    b.mu.Lock()
+    b.paused = true
+    b.mu.Unlock()
+}
+
+// Resume sends the packets kept while paused
+func (b *broker) Resume() {
+    b.mu.Lock()
+    b.paused = false
+    b.mu.Unlock()
+    b.flush()
+}
+
+// Reasons for the broker to hold flushes, see setOffline
+const (
+    offlineStream  uint8 = 1 << iota // Connection found no working transport
+    offlineNetwork                   // The browser reports no network
+)
+
+// setOffline holds flushes while any reason is set; clearing the last one
+// sends the queue at once
+func (b *broker) setOffline(reason uint8, offline bool) {
+    b.mu.Lock()
+    was := b.offline
+    if offline {
+        b.offline |= reason
+    } else {
+        b.offline &^= reason
+    }
+    back := was != 0 && b.offline == 0
+    b.mu.Unlock()
+    if back {
+        b.flush()
+    }
+}
+
+// offlineFor reports whether reason is holding flushes
+func (b *broker) offlineFor(reason uint8) bool {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    return b.offline&reason != 0
+}
+
+// Paused reports whether the broker is paused
+func (b *broker) Paused() bool {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    return b.paused
+}
+
+// rewrite lets fn modify every queued packet (e.g. temporary IDs)
+func (b *broker) rewrite(fn func(p *Packet)) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    for i := range b.queue {
+        fn(&b.queue[i])
+    }
+    for _, f := range b.inflight { // Sent again if re-queued
+        for i := range f.packets {
+            fn(&f.packets[i])
+        }
+    }
+}
+
+// Stats returns a snapshot of the queue and the broker counters
+func (b *broker) Stats() BrokerStats {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    s := b.stats
+    s.Queued = len(b.queue)
+    s.Paused = b.paused
+    s.Offline = b.offline != 0
+    s.Scheduled = b.timer != nil
+    s.InFlight = len(b.inflight)
+    s.ByHandler = nil
+    for _, p := range b.queue {
+        s.Items += len(p.Data)
+        i := 0
+        for i < len(s.ByHandler) && s.ByHandler[i].HandlerID != p.HandlerID {
+            i++
+        }
+        if i == len(s.ByHandler) {
+            s.ByHandler = append(s.ByHandler, HandlerQueue{HandlerID: p.HandlerID})
+        }
+        s.ByHandler[i].Packets++
+        s.ByHandler[i].Items += len(p.Data)
+    }
+    return s
+}
+
+// DrainTo writes the queue to w as an encoded BatchRequest and empties it
+// The dump can be decoded with the codec or sent later with ProcessBatch,
+// e.g. to inspect a stuck client or keep its packets across a page reload.
+// The queue is kept if encoding or writing fails.
+func (b *broker) DrainTo(w io.Writer) (int, error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    if len(b.queue) == 0 {
+        return 0, nil
+    }
+    encoded, err := b.codec.Encode(BatchRequest{Packets: b.queue})
+    if err != nil {
+        return 0, err
+    }
+    n, err := w.Write(encoded)
+    if err != nil {
+        return n, err
+    }
+    if b.timer != nil {
+        b.timer.Stop()
+        b.timer = nil
+    }
+    b.queue = b.queue[:0]
+    b.tries = b.tries[:0]
+    return n, nil
+}
+
 // QueueLength returns the current queue size (for testing)
 func (b *broker) QueueLength() int {
     b.mu.Lock()
@@ -120,4 +406,7 @@ func (b *broker) Clear() {
         b.timer = nil
     }
     b.queue = b.queue[:0]
+    b.tries = b.tries[:0]
+    b.inflight = nil
+    b.canceled = nil
 }
@@ -1,6 +1,8 @@
 package crudp_test
 
 import (
+    "bytes"
+    "strconv"
     "sync"
     "testing"
     "time"
@@ -64,6 +66,68 @@ func BrokerConsolidationShared(t *testing.T) {
     })
 }
 
+// keyedNote identifies its entity for broker supersession
+type keyedNote struct {
+    ID   int    `json:"id"`
+    Text string `json:"text"`
+}
+
+func (n keyedNote) EntityKey() string {
+    if n.ID == 0 {
+        return ""
+    }
+    return "note:" + strconv.Itoa(n.ID)
+}
+
+func BrokerSupersedeShared(t *testing.T) {
+    t.Run("Newer Update Replaces Queued One", func(t *testing.T) {
+        cfg := crudp.DefaultConfig()
+        cfg.FlushStrategy = crudp.ManualFlush()
+        cp := crudp.New(cfg)
+        broker := cp.Broker()
+
+        cp.EnqueuePacket(0, 'u', "u1", keyedNote{ID: 1, Text: "a"})
+        cp.EnqueuePacket(0, 'u', "u2", keyedNote{ID: 2, Text: "b"})
+        cp.EnqueuePacket(0, 'u', "u3", keyedNote{ID: 1, Text: "c"})
+        cp.EnqueuePacket(0, 'u', "u4", keyedNote{Text: "unsaved"})
+
+        if s := broker.Stats(); s.Queued != 1 || s.Items != 3 || s.Superseded != 1 {
+            t.Fatalf("expected 3 items after supersession, got %+v", s)
+        }
+        var buf bytes.Buffer
+        broker.DrainTo(&buf)
+        var req crudp.BatchRequest
+        if err := cp.Codec().Decode(buf.Bytes(), &req); err != nil {
+            t.Fatal(err)
+        }
+        var first keyedNote
+        cp.DecodeData(&req.Packets[0], 0, &first)
+        if first.ID != 1 || first.Text != "c" {
+            t.Errorf("expected the newer update in place, got %+v", first)
+        }
+    })
+
+    t.Run("Delete Drops Queued Updates", func(t *testing.T) {
+        cfg := crudp.DefaultConfig()
+        cfg.FlushStrategy = crudp.ManualFlush()
+        cp := crudp.New(cfg)
+        broker := cp.Broker()
+
+        cp.EnqueuePacket(0, 'u', "u1", keyedNote{ID: 1, Text: "a"})
+        cp.EnqueuePacket(0, 'u', "u2", keyedNote{ID: 2, Text: "b"})
+        cp.EnqueuePacket(0, 'd', "d1", keyedNote{ID: 2})
+        if s := broker.Stats(); s.Queued != 2 || s.Items != 2 || s.Superseded != 1 {
+            t.Fatalf("expected the update of note 2 dropped, got %+v", s)
+        }
+
+        cp.EnqueuePacket(0, 'd', "d2", keyedNote{ID: 1})
+        s := broker.Stats()
+        if s.Queued != 1 || s.Items != 2 || s.Superseded != 2 || s.ByHandler[0].Packets != 1 {
+            t.Errorf("expected only the deletes queued, got %+v", s)
+        }
+    })
+}
+
 func BrokerFlushShared(t *testing.T) {
     t.Run("Flush After BatchWindow", func(t *testing.T) {
         cfg := crudp.DefaultConfig()
@@ -195,3 +259,52 @@ func EnqueuePacketShared(t *testing.T) {
         }
     })
 }
+
+func BrokerStatsShared(t *testing.T) {
+    t.Run("Queue And Flush Counters", func(t *testing.T) {
+        cfg := crudp.DefaultConfig()
+        cfg.FlushStrategy = crudp.ManualFlush()
+        cp := crudp.New(cfg)
+        broker := cp.Broker()
+        var sent int
+        broker.SetOnFlush(func(batch []byte) { sent = len(batch) })
+
+        broker.Enqueue(0, 'c', "", []byte(`{"name":"A"}`))
+        broker.Enqueue(0, 'c', "", []byte(`{"name":"B"}`))
+        broker.Enqueue(2, 'd', "", []byte(`{}`))
+
+        s := broker.Stats()
+        if s.Queued != 2 || s.Items != 3 || s.Enqueued != 3 || s.Consolidated != 1 || s.Scheduled {
+            t.Fatalf("unexpected stats %+v", s)
+        }
+        if len(s.ByHandler) != 2 || s.ByHandler[0] != (crudp.HandlerQueue{HandlerID: 0, Packets: 1, Items: 2}) || s.ByHandler[1].HandlerID != 2 {
+            t.Errorf("unexpected per-handler counts %+v", s.ByHandler)
+        }
+
+        broker.FlushNow()
+        s = broker.Stats()
+        if s.Queued != 0 || s.Flushes != 1 || s.LastPackets != 2 || s.LastBytes != sent || s.LastFlush.IsZero() {
+            t.Errorf("unexpected stats after flush %+v", s)
+        }
+    })
+
+    t.Run("DrainTo", func(t *testing.T) {
+        cfg := crudp.DefaultConfig()
+        cfg.FlushStrategy = crudp.ManualFlush()
+        cp := crudp.New(cfg)
+        broker := cp.Broker()
+        broker.Enqueue(1, 'u', "req1", []byte(`{}`))
+
+        var dump bytes.Buffer
+        if n, err := broker.DrainTo(&dump); err != nil || n != dump.Len() {
+            t.Fatalf("DrainTo: %d %v", n, err)
+        }
+        if broker.QueueLength() != 0 {
+            t.Error("queue not drained")
+        }
+        var batch crudp.BatchRequest
+        if err := cp.Codec().Decode(dump.Bytes(), &batch); err != nil || len(batch.Packets) != 1 || batch.Packets[0].ReqID != "req1" {
+            t.Errorf("unexpected dump %+v %v", batch, err)
+        }
+    })
+}
@@ -9,6 +9,10 @@ func TestBroker_WASM(t *testing.T) {
         BrokerConsolidationShared(t)
     })
 
+    t.Run("Supersede", func(t *testing.T) {
+        BrokerSupersedeShared(t)
+    })
+
     t.Run("Flush", func(t *testing.T) {
         BrokerFlushShared(t)
     })
@@ -20,4 +24,8 @@ func TestBroker_WASM(t *testing.T) {
     t.Run("EnqueuePacket", func(t *testing.T) {
         EnqueuePacketShared(t)
     })
+
+    t.Run("Stats", func(t *testing.T) {
+        BrokerStatsShared(t)
+    })
 }
@@ -0,0 +1,159 @@
+package crudp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// ActionContinue asks for the rest of a response cut by Config.MaxResponseBytes;
+// the packet ReqID is BatchResponse.Continuation. ReceiveBatch sends it itself.
+const ActionContinue byte = 'n'
+
+// CodeTooLarge marks a result whose data alone exceeds Config.MaxResponseBytes;
+// it is sent without Data
+const CodeTooLarge = "too_large"
+
+// continuationTTL is how long the rest of a cut response is kept
+const continuationTTL = 5 * time.Minute
+
+// continuationLimit bounds the cut responses kept at once
+const continuationLimit = 64
+
+// continuation is the rest of a cut response
+type continuation struct {
+	key     string
+	results []PacketResult
+	expires time.Time
+}
+
+// continuations keeps cut responses by cursor (slice, no maps for TinyGo)
+type continuations struct {
+	mu      sync.Mutex
+	entries []continuation
+}
+
+func (c *continuations) put(key string, results []PacketResult, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	live := c.entries[:0]
+	for _, e := range c.entries {
+		if now.Before(e.expires) {
+			live = append(live, e)
+		}
+	}
+	if len(live) >= continuationLimit {
+		live = append(live[:0], live[1:]...) // Drop oldest
+	}
+	c.entries = append(live, continuation{key: key, results: results, expires: now.Add(continuationTTL)})
+}
+
+// take removes and returns the results kept under key
+func (c *continuations) take(key string, now time.Time) ([]PacketResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, e := range c.entries {
+		if e.key == key {
+			c.entries = append(c.entries[:i:i], c.entries[i+1:]...)
+			return e.results, now.Before(e.expires)
+		}
+	}
+	return nil, false
+}
+
+// budgetResponse encodes head and as many results as fit in
+// Config.MaxResponseBytes; the rest is kept for an ActionContinue packet
+// Results are never split and the first one is always sent so the response
+// still advances; one larger than the budget on its own is sent without Data
+// and with Code CodeTooLarge.
+func (cp *CrudP) budgetResponse(ctx context.Context, codec Codec, head []PacketResult, results []PacketResult) ([]byte, error) {
+	cursor := randomID()
+	fixed, err := codec.Encode(BatchResponse{Results: head, Continuation: cursor})
+	if err != nil {
+		return nil, err
+	}
+	empty, err := codec.Encode(BatchResponse{})
+	if err != nil {
+		return nil, err
+	}
+
+	size, n := len(fixed), 0
+	for ; n < len(results); n++ {
+		one, err := codec.Encode(BatchResponse{Results: results[n : n+1]})
+		if err != nil {
+			return nil, err
+		}
+		grow := len(one) - len(empty) + 1 // +1 for a separator
+		if size+grow > cp.config.MaxResponseBytes {
+			break
+		}
+		size += grow
+	}
+
+	// head and the cursor are not counted against a single result: the first
+	// result is always sent, without Data only if it alone is over the limit
+	if n == 0 && len(results) > 0 {
+		n = 1
+		alone, err := codec.Encode(BatchResponse{Results: results[:1]})
+		if err != nil {
+			return nil, err
+		}
+		if len(alone) > cp.config.MaxResponseBytes {
+			results = append([]PacketResult{cp.tooLarge(results[0])}, results[1:]...)
+		}
+	}
+	if n == len(results) {
+		return codec.Encode(BatchResponse{Results: append(head[:len(head):len(head)], results...)})
+	}
+
+	// Sizes are estimated per result: drop more if the total is still over
+	var response []byte
+	for ; n > 0; n-- {
+		response, err = codec.Encode(BatchResponse{Results: append(head[:len(head):len(head)], results[:n]...), Continuation: cursor})
+		if err != nil || len(response) <= cp.config.MaxResponseBytes || n == 1 {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rest := append([]PacketResult(nil), results[n:]...) // results may be pooled
+	cp.continuations.put(tenantScoped(ctx, cursor), rest, time.Now())
+	cp.log.Debug("ProcessBatch response cut", "sent", n, "kept", len(rest))
+	return response, nil
+}
+
+// tooLarge replaces the data of a result over Config.MaxResponseBytes with CodeTooLarge
+func (cp *CrudP) tooLarge(big PacketResult) PacketResult {
+	cp.log.Warn("result exceeds MaxResponseBytes", "req_id", big.ReqID, "limit", cp.config.MaxResponseBytes)
+	big.Data = nil
+	big.MessageType = uint8(Msg.Error)
+	big.Message = Fmt("result exceeds %d bytes", cp.config.MaxResponseBytes)
+	big.Code = CodeTooLarge
+	return big
+}
+
+// continueResponse answers an ActionContinue packet with the echo of the
+// packet followed by the next part of the kept results
+func (cp *CrudP) continueResponse(ctx context.Context, codec Codec, packet *Packet) ([]byte, error) {
+	echo := PacketResult{Packet: packet.echo(), MessageType: uint8(Msg.Success)}
+	rest, ok := cp.continuations.take(tenantScoped(ctx, packet.ReqID), time.Now())
+	if !ok {
+		echo.MessageType = uint8(Msg.Error)
+		echo.Message = "continuation expired"
+		return codec.Encode(BatchResponse{Results: []PacketResult{echo}})
+	}
+	if cp.config.MaxResponseBytes <= 0 {
+		return codec.Encode(BatchResponse{Results: append([]PacketResult{echo}, rest...)})
+	}
+	return cp.budgetResponse(ctx, codec, []PacketResult{echo}, rest)
+}
+
+// continueBatch asks the server for the rest of a cut response (client side)
+func (cp *CrudP) continueBatch(cursor string) {
+	cp.broker.enqueueOwn(Packet{Action: ActionContinue, ReqID: cursor})
+	cp.broker.FlushNow()
+}
@@ -0,0 +1,61 @@
+package crudp_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+type Blob struct{}
+
+func (h *Blob) Read(ctx context.Context, data ...any) any { return strings.Repeat("x", 100) }
+
+func BudgetShared(t *testing.T) {
+	run := func(t *testing.T, limit int) []crudp.PacketResult {
+		cfg := crudp.DefaultConfig()
+		cfg.MaxResponseBytes = limit
+		server := crudp.New(cfg, crudp.WithHandlers(&Blob{}))
+		client := crudp.NewLoopback(server, crudp.WithHandlers(&Blob{}))
+
+		var results []crudp.PacketResult
+		client.OnResult(func(pr crudp.PacketResult) { results = append(results, pr) })
+		// DependsOn keeps the packets apart instead of consolidated
+		client.EnqueuePacket(0, 'r', "r0", nil)
+		for i := 1; i < 10; i++ {
+			client.EnqueuePacket(0, 'r', Fmt("r%d", i), nil, crudp.WithDependsOn(Fmt("r%d", i-1)))
+		}
+		client.Broker().FlushNow()
+
+		if len(results) != 10 {
+			t.Fatalf("expected 10 results, got %d", len(results))
+		}
+		for i, pr := range results {
+			if pr.ReqID != Fmt("r%d", i) {
+				t.Errorf("result %d out of order: %s", i, pr.ReqID)
+			}
+		}
+		if n := client.Broker().Stats().InFlight; n != 0 {
+			t.Errorf("%d batches still in flight", n)
+		}
+		return results
+	}
+
+	t.Run("Cut Responses Continue In Order", func(t *testing.T) {
+		for _, pr := range run(t, 700) {
+			if pr.MessageType == uint8(Msg.Error) || len(pr.Data) != 1 {
+				t.Errorf("%s: unexpected result %q", pr.ReqID, pr.Message)
+			}
+		}
+	})
+
+	t.Run("Oversized Results", func(t *testing.T) {
+		for _, pr := range run(t, 50) {
+			if pr.Code != crudp.CodeTooLarge || len(pr.Data) != 0 {
+				t.Errorf("%s: expected too_large, got %q %q", pr.ReqID, pr.Code, pr.Message)
+			}
+		}
+	})
+}
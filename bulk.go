@@ -0,0 +1,66 @@
+package crudp
+
+import . "github.com/cdvelop/tinystring"
+
+// ItemResult reports the outcome of one input item of a packet
+type ItemResult struct {
+	Index   int    `json:"index"`   // Position in Packet.Data
+	Status  uint8  `json:"status"`  // tinystring.MessageType
+	Message string `json:"message"` // Why the item failed
+}
+
+// Failed reports whether the item was rejected
+func (r ItemResult) Failed() bool {
+	return r.Status == uint8(Msg.Error)
+}
+
+// ItemOK reports a successful item
+func ItemOK(index int) ItemResult {
+	return ItemResult{Index: index, Status: uint8(Msg.Success)}
+}
+
+// ItemError reports a failed item
+func ItemError(index int, err error) ItemResult {
+	return ItemResult{Index: index, Status: uint8(Msg.Error), Message: err.Error()}
+}
+
+// BulkResult is returned by handlers processing several items to report
+// each one. Data is encoded like any other result (e.g. the created rows).
+//
+//	func (h *User) Create(ctx context.Context, data ...any) any {
+//		var bulk crudp.BulkResult
+//		for i, item := range data {
+//			if err := h.insert(item.(*User)); err != nil {
+//				bulk.Items = append(bulk.Items, crudp.ItemError(i, err))
+//				continue
+//			}
+//			bulk.Items = append(bulk.Items, crudp.ItemOK(i))
+//		}
+//		return bulk
+//	}
+type BulkResult struct {
+	Data  any
+	Items []ItemResult
+}
+
+// bulkStatus sets the packet status from its items: Success if none failed,
+// Warning if some failed and Error if all failed
+func bulkStatus(pr *PacketResult) {
+	failed := 0
+	for _, item := range pr.Items {
+		if item.Failed() {
+			failed++
+		}
+	}
+	switch {
+	case failed == 0:
+		pr.MessageType = uint8(Msg.Success)
+		pr.Message = "OK"
+	case failed == len(pr.Items):
+		pr.MessageType = uint8(Msg.Error)
+		pr.Message = Fmt("all %d items failed", failed)
+	default:
+		pr.MessageType = uint8(Msg.Warning)
+		pr.Message = Fmt("%d of %d items failed", failed, len(pr.Items))
+	}
+}
@@ -0,0 +1,76 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Row rejects items without a name
+type Row struct {
+	Name string
+}
+
+func (r *Row) Create(ctx context.Context, data ...any) any {
+	var bulk crudp.BulkResult
+	var created []*Row
+	for i, item := range data {
+		row := item.(*Row)
+		if row.Name == "" {
+			bulk.Items = append(bulk.Items, crudp.ItemError(i, Err("name is required")))
+			continue
+		}
+		created = append(created, row)
+		bulk.Items = append(bulk.Items, crudp.ItemOK(i))
+	}
+	bulk.Data = created
+	return bulk
+}
+
+func BulkResultsShared(t *testing.T) {
+	for _, binary := range []bool{false, true} {
+		cfg := crudp.DefaultConfig()
+		cfg.UseBinary = binary
+		cp := crudp.New(cfg, crudp.WithHandlers(&Row{}))
+
+		create := func(names ...string) crudp.PacketResult {
+			data := make([][]byte, len(names))
+			for i, name := range names {
+				data[i], _ = cp.Codec().Encode(&Row{Name: name})
+			}
+			return processOne(t, cp, crudp.Packet{Action: 'c', Data: data})
+		}
+
+		t.Run(Fmt("Partial Failure binary=%v", binary), func(t *testing.T) {
+			r := create("a", "", "c", "")
+			if r.MessageType != uint8(Msg.Warning) || r.Message != "2 of 4 items failed" {
+				t.Errorf("expected warning for partial failure, got %d %q", r.MessageType, r.Message)
+			}
+			if len(r.Items) != 4 {
+				t.Fatalf("expected 4 item results, got %+v", r.Items)
+			}
+			for i, item := range r.Items {
+				if item.Index != i || item.Failed() != (i%2 == 1) {
+					t.Errorf("unexpected item %d: %+v", i, item)
+				}
+			}
+			if r.Items[1].Message != "name is required" {
+				t.Errorf("expected item message, got %q", r.Items[1].Message)
+			}
+		})
+
+		t.Run(Fmt("All Succeed binary=%v", binary), func(t *testing.T) {
+			if r := create("a", "b"); r.MessageType != uint8(Msg.Success) || len(r.Items) != 2 {
+				t.Errorf("expected success, got %d %q %+v", r.MessageType, r.Message, r.Items)
+			}
+		})
+
+		t.Run(Fmt("All Fail binary=%v", binary), func(t *testing.T) {
+			if r := create("", ""); r.MessageType != uint8(Msg.Error) || r.Message != "all 2 items failed" {
+				t.Errorf("expected error, got %d %q", r.MessageType, r.Message)
+			}
+		})
+	}
+}
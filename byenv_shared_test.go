@@ -0,0 +1,75 @@
+package crudp_test
+
+import (
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+func newUserController() any { return &UserController{} }
+
+func ByEnvShared(t *testing.T) {
+	t.Run("IDs Aligned Across Builds", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		err := cp.RegisterHandler(
+			crudp.ServerOnly("user_controller", newUserController),
+			crudp.ByEnv("validated_handler", func() any { return &ValidatedHandler{} }, func() any { return &ValidatedHandler{} }),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if id, ok := cp.HandlerID("validated_handler"); !ok || id != 1 {
+			t.Errorf("expected validated_handler at 1, got %d (%v)", id, ok)
+		}
+
+		id, err := cp.AddHandler(&explicitNameHandler{})
+		if err != nil || id != 2 {
+			t.Errorf("expected added handler at 2, got %d (%v)", id, err)
+		}
+	})
+
+	t.Run("Manifest", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		err := cp.RegisterFromManifest([]crudp.HandlerSpec{
+			{ID: 3, Name: "user_controller", Handler: crudp.ServerOnly("user_controller", newUserController)},
+			{ID: 5, Name: "validated_handler", Handler: &ValidatedHandler{}},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if id, ok := cp.HandlerID("validated_handler"); !ok || id != 5 {
+			t.Errorf("expected validated_handler at 5, got %d (%v)", id, ok)
+		}
+	})
+
+	t.Run("Stable IDs", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.HandlerIDs = []string{"validated_handler", "user_controller"}
+		cp := crudp.New(cfg, crudp.WithHandlers(
+			crudp.ServerOnly("user_controller", newUserController),
+			&ValidatedHandler{},
+		))
+		if err := cp.Err(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if id, ok := cp.HandlerID("validated_handler"); !ok || id != 0 {
+			t.Errorf("expected validated_handler at 0, got %d (%v)", id, ok)
+		}
+	})
+
+	t.Run("Builder Errors", func(t *testing.T) {
+		nilBuilder := func() any { return nil }
+		cp := crudp.NewDefault()
+		if err := cp.RegisterHandler(crudp.ByEnv("user_controller", nilBuilder, nilBuilder)); err == nil {
+			t.Error("expected error for a builder returning nil")
+		}
+
+		wrong := func() any { return &ValidatedHandler{} }
+		if err := cp.RegisterHandler(crudp.ByEnv("user_controller", wrong, wrong)); err == nil {
+			t.Error("expected error for a handler with another name")
+		}
+		if _, err := cp.AddHandler(crudp.ByEnv("user_controller", wrong, wrong)); err == nil {
+			t.Error("expected error adding a handler with another name")
+		}
+	})
+}
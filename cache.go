@@ -0,0 +1,233 @@
+package crudp
+
+import (
+	"reflect"
+	"sync"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// EntityCache keeps the entities decoded from results on the client
+// Enabled with Config.EntityCache. Entities are identified by EntityKey.
+type EntityCache struct {
+	mu       sync.RWMutex
+	entries  []cacheEntry // Slice, no maps for TinyGo
+	watchers []cacheWatcher
+	lastID   int
+	dirty    []uint8 // Handlers changed since the last notify
+}
+
+type cacheEntry struct {
+	handlerID uint8
+	id        string
+	value     any
+}
+
+type cacheWatcher struct {
+	id        int
+	handlerID uint8
+	render    func(items []any)
+}
+
+// Cache returns the client entity cache (empty unless Config.EntityCache is set)
+func (cp *CrudP) Cache() *EntityCache {
+	return &cp.cache
+}
+
+// Get returns the cached entity of a handler by EntityKey (the ID field for
+// types that do not implement Keyer)
+func (c *EntityCache) Get(handlerID uint8, id string) (any, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, e := range c.entries {
+		if e.handlerID == handlerID && e.id == id {
+			return e.value, true
+		}
+	}
+	return nil, false
+}
+
+// List returns the cached entities of a handler in insertion order
+func (c *EntityCache) List(handlerID uint8) []any {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var list []any
+	for _, e := range c.entries {
+		if e.handlerID == handlerID {
+			list = append(list, e.value)
+		}
+	}
+	return list
+}
+
+// Watch calls render with the cached entities of a handler now and after
+// every change: results, SSE events, syncs, generated IDs or Invalidate.
+// render runs on the goroutine that received the update, once per update
+// even if it touched several entities. Call stop to unregister.
+func (c *EntityCache) Watch(handlerID uint8, render func(items []any)) (stop func()) {
+	c.mu.Lock()
+	c.lastID++
+	id := c.lastID
+	c.watchers = append(c.watchers, cacheWatcher{id: id, handlerID: handlerID, render: render})
+	c.mu.Unlock()
+
+	render(c.List(handlerID))
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i := range c.watchers {
+			if c.watchers[i].id == id {
+				c.watchers = append(c.watchers[:i], c.watchers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// notify calls the watchers of the handlers changed since the last call
+func (c *EntityCache) notify() {
+	c.mu.Lock()
+	dirty := c.dirty
+	c.dirty = nil
+	watchers := c.watchers
+	c.mu.Unlock()
+
+	for _, handlerID := range dirty {
+		var items []any
+		listed := false
+		for _, w := range watchers {
+			if w.handlerID != handlerID {
+				continue
+			}
+			if !listed {
+				items, listed = c.List(handlerID), true
+			}
+			w.render(items)
+		}
+	}
+}
+
+// touch marks a handler as changed (must hold mu)
+func (c *EntityCache) touch(handlerID uint8) {
+	for _, h := range c.dirty {
+		if h == handlerID {
+			return
+		}
+	}
+	c.dirty = append(c.dirty, handlerID)
+}
+
+// Invalidate drops every cached entity of a handler
+func (c *EntityCache) Invalidate(handlerID uint8) {
+	c.invalidate(handlerID)
+	c.notify()
+}
+
+func (c *EntityCache) invalidate(handlerID uint8) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.touch(handlerID)
+	kept := c.entries[:0]
+	for _, e := range c.entries {
+		if e.handlerID != handlerID {
+			kept = append(kept, e)
+		}
+	}
+	c.entries = kept
+}
+
+// Clear drops all cached entities
+func (c *EntityCache) Clear() {
+	c.mu.Lock()
+	for _, e := range c.entries {
+		c.touch(e.handlerID)
+	}
+	c.entries = nil
+	c.mu.Unlock()
+	c.notify()
+}
+
+func (c *EntityCache) put(handlerID uint8, id string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.touch(handlerID)
+	for i := range c.entries {
+		if c.entries[i].handlerID == handlerID && c.entries[i].id == id {
+			c.entries[i].value = value
+			return
+		}
+	}
+	c.entries = append(c.entries, cacheEntry{handlerID: handlerID, id: id, value: value})
+}
+
+func (c *EntityCache) remove(handlerID uint8, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.entries {
+		if c.entries[i].handlerID == handlerID && c.entries[i].id == id {
+			c.entries = append(c.entries[:i], c.entries[i+1:]...)
+			c.touch(handlerID)
+			return
+		}
+	}
+}
+
+// cacheResult updates the cache from a successful result
+func (cp *CrudP) cacheResult(pr *PacketResult) {
+	if !cp.config.EntityCache || pr.MessageType == uint8(Msg.Error) {
+		return
+	}
+	switch pr.Action {
+	case ActionSync:
+		cp.cacheSync(pr)
+		cp.cache.notify()
+		return
+	case 'c', 'r', 'u', ActionPatch, 'd':
+	default:
+		return
+	}
+
+	for _, item := range pr.Data {
+		value, id := cp.decodeEntity(cp.codec, pr.HandlerID, pr.Version, item)
+		if id == "" {
+			continue
+		}
+		if pr.Action == 'd' {
+			cp.cache.remove(pr.HandlerID, id)
+		} else {
+			cp.cache.put(pr.HandlerID, id, value)
+		}
+	}
+	cp.cache.notify()
+}
+
+// cacheEvent invalidates the entity broadcast by the server
+// Events without an identifiable entity invalidate the whole handler.
+func (cp *CrudP) cacheEvent(ev Event) {
+	if !cp.config.EntityCache {
+		return
+	}
+	if _, id := cp.decodeEntity(cp.codec, ev.HandlerID, 0, ev.Data); id != "" {
+		cp.cache.remove(ev.HandlerID, id)
+		cp.cache.notify()
+		return
+	}
+	cp.cache.Invalidate(ev.HandlerID)
+}
+
+// decodeEntity decodes data into a new value of the handler type and returns its EntityKey
+func (cp *CrudP) decodeEntity(codec Codec, handlerID uint8, version byte, data []byte) (any, string) {
+	handler, err := cp.resolve(handlerID, version)
+	if err != nil {
+		return nil, ""
+	}
+	t := handlerType(handler.handler)
+	if t.Kind() != reflect.Struct {
+		return nil, ""
+	}
+	value := reflect.New(t).Interface()
+	if err := codec.Decode(data, value); err != nil {
+		return nil, ""
+	}
+	return value, EntityKey(value)
+}
@@ -0,0 +1,153 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+// Note is a simple entity with an ID assigned on create
+type Note struct {
+	ID   int
+	Text string
+}
+
+func (n *Note) Create(ctx context.Context, data ...any) any {
+	note := *data[0].(*Note)
+	note.ID = 1
+	return note
+}
+
+func (n *Note) Update(ctx context.Context, data ...any) any {
+	return *data[0].(*Note)
+}
+
+func (n *Note) Delete(ctx context.Context, data ...any) any {
+	return *data[0].(*Note)
+}
+
+// Sku is identified by its code through Keyer, not by an ID field
+type Sku struct {
+	Code  string
+	Price int
+}
+
+func (s *Sku) EntityKey() string { return s.Code }
+
+func (s *Sku) Create(ctx context.Context, data ...any) any {
+	return *data[0].(*Sku)
+}
+
+func EntityCacheShared(t *testing.T) {
+	newClient := func() *crudp.CrudP {
+		server := crudp.NewDefault()
+		server.RegisterHandler(&Note{})
+
+		cfg := crudp.DefaultConfig()
+		cfg.EntityCache = true
+		return crudp.NewLoopback(server, cfg, crudp.WithHandlers(&Note{}))
+	}
+
+	t.Run("Create Update Delete", func(t *testing.T) {
+		client := newClient()
+
+		client.EnqueuePacket(0, 'c', "n1", &Note{Text: "draft"})
+		client.Broker().FlushNow()
+
+		got, ok := client.Cache().Get(0, "1")
+		if !ok || got.(*Note).Text != "draft" {
+			t.Fatalf("expected cached note 1, got %v %v", got, ok)
+		}
+
+		client.EnqueuePacket(0, 'u', "n2", &Note{ID: 1, Text: "final"})
+		client.Broker().FlushNow()
+
+		if list := client.Cache().List(0); len(list) != 1 || list[0].(*Note).Text != "final" {
+			t.Errorf("expected updated note, got %v", list)
+		}
+
+		client.EnqueuePacket(0, 'd', "n3", &Note{ID: 1})
+		client.Broker().FlushNow()
+
+		if _, ok := client.Cache().Get(0, "1"); ok {
+			t.Error("expected note removed after delete")
+		}
+	})
+
+	t.Run("SSE Invalidation", func(t *testing.T) {
+		client := newClient()
+		client.EnqueuePacket(0, 'c', "n1", &Note{Text: "draft"})
+		client.Broker().FlushNow()
+
+		data, _ := client.Codec().Encode(&Note{ID: 1, Text: "changed elsewhere"})
+		client.ReceiveEvent(crudp.Event{Channel: "notes", HandlerID: 0, Data: data})
+
+		if _, ok := client.Cache().Get(0, "1"); ok {
+			t.Error("expected note invalidated by broadcast")
+		}
+	})
+
+	t.Run("Watch Renders Changes", func(t *testing.T) {
+		client := newClient()
+		var renders [][]any
+		stop := client.Cache().Watch(0, func(items []any) {
+			renders = append(renders, items)
+		})
+		if len(renders) != 1 || len(renders[0]) != 0 {
+			t.Fatalf("expected an initial empty render, got %v", renders)
+		}
+
+		client.EnqueuePacket(0, 'c', "n1", &Note{Text: "draft"})
+		client.Broker().FlushNow()
+		client.EnqueuePacket(0, 'u', "n2", &Note{ID: 1, Text: "final"})
+		client.Broker().FlushNow()
+		if len(renders) != 3 || len(renders[2]) != 1 || renders[2][0].(*Note).Text != "final" {
+			t.Fatalf("expected a render per result, got %v", renders)
+		}
+
+		data, _ := client.Codec().Encode(&Note{ID: 1})
+		client.ReceiveEvent(crudp.Event{Channel: "notes", HandlerID: 0, Data: data})
+		if len(renders) != 4 || len(renders[3]) != 0 {
+			t.Errorf("expected a render after the broadcast, got %v", renders)
+		}
+
+		stop()
+		client.Cache().Clear()
+		if len(renders) != 4 {
+			t.Errorf("render called after stop: %v", renders)
+		}
+	})
+
+	t.Run("Disabled By Default", func(t *testing.T) {
+		server := crudp.NewDefault()
+		server.RegisterHandler(&Note{})
+		client := crudp.NewLoopback(server, crudp.WithHandlers(&Note{}))
+
+		client.EnqueuePacket(0, 'c', "n1", &Note{Text: "draft"})
+		client.Broker().FlushNow()
+
+		if len(client.Cache().List(0)) != 0 {
+			t.Error("cache must stay empty without Config.EntityCache")
+		}
+	})
+
+	t.Run("Keyer Identifies Entities", func(t *testing.T) {
+		if key := crudp.EntityKey(&Note{ID: 3}); key != "3" {
+			t.Errorf("expected the ID field as key, got %q", key)
+		}
+
+		server := crudp.New(crudp.WithHandlers(&Sku{}))
+		cfg := crudp.DefaultConfig()
+		cfg.EntityCache = true
+		client := crudp.NewLoopback(server, cfg, crudp.WithHandlers(&Sku{}))
+
+		client.EnqueuePacket(0, 'c', "s1", &Sku{Code: "A-1", Price: 10})
+		client.Broker().FlushNow()
+
+		got, ok := client.Cache().Get(0, "A-1")
+		if !ok || got.(*Sku).Price != 10 {
+			t.Errorf("expected the sku cached by its code, got %v %v", got, ok)
+		}
+	})
+}
@@ -0,0 +1,9 @@
+//go:build !wasm
+
+package crudp_test
+
+import "testing"
+
+func TestEntityCache_Stdlib(t *testing.T) {
+	EntityCacheShared(t)
+}
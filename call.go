@@ -0,0 +1,280 @@
+package crudp
+
+import (
+	"context"
+	"sync"
+
+	. "github.com/cdvelop/tinystring"
+	"github.com/cdvelop/tinytime"
+)
+
+// Promise is the pending result of a Call
+type Promise struct {
+	reqID  string
+	done   chan struct{}
+	once   sync.Once
+	mu     sync.Mutex
+	result PacketResult
+	err    error
+	then   []func(PacketResult, error)
+}
+
+// ReqID returns the ReqID of the packet sent by the Call
+func (p *Promise) ReqID() string { return p.reqID }
+
+// Done is closed once the result arrived or the Call ended with an error
+func (p *Promise) Done() <-chan struct{} { return p.done }
+
+// Result returns the outcome once Done is closed, an error before
+// Error results are *ResultError; calls ended by their context return ctx.Err().
+func (p *Promise) Result() (PacketResult, error) {
+	select {
+	case <-p.done:
+		return p.result, p.err
+	default:
+		return PacketResult{}, Err(Fmt("call %s pending", p.reqID))
+	}
+}
+
+// Wait blocks until the result arrives or ctx ends
+// Wait must not run on the goroutine that calls ReceiveBatch (on WASM, the
+// main one); use Then there.
+func (p *Promise) Wait(ctx context.Context) (PacketResult, error) {
+	select {
+	case <-p.done:
+		return p.result, p.err
+	case <-ctx.Done():
+		return PacketResult{}, ctx.Err()
+	}
+}
+
+// Then calls fn with the outcome once settled, at once if it already is
+// fn runs on the goroutine that settles the promise, usually ReceiveBatch.
+func (p *Promise) Then(fn func(PacketResult, error)) {
+	p.mu.Lock()
+	select {
+	case <-p.done:
+		p.mu.Unlock()
+		fn(p.result, p.err)
+		return
+	default:
+	}
+	p.then = append(p.then, fn)
+	p.mu.Unlock()
+}
+
+// settle records the outcome and runs the Then callbacks, only the first time
+func (p *Promise) settle(pr PacketResult, err error) {
+	p.once.Do(func() {
+		p.mu.Lock()
+		p.result, p.err = pr, err
+		close(p.done)
+		then := p.then
+		p.then = nil
+		p.mu.Unlock()
+		for _, fn := range then {
+			fn(pr, err)
+		}
+	})
+}
+
+// Call enqueues data (nil = no items) for action on handlerID and returns a
+// Promise settled when the matching PacketResult arrives through ReceiveBatch,
+// so callers need not correlate batched responses by hand. The packet is never
+// consolidated with others, so the result keeps its ReqID. Call does not
+// block: it suits the WASM main goroutine. When ctx ends first, the promise
+// settles with ctx.Err() and a late result only reaches OnResult.
+//
+// WithTimeout(ms) bounds the wait for each attempt. Idempotent calls (Read,
+// Update, Delete, patches) are sent again with the same ReqID up to
+// Config.MaxRetries times; then the promise settles with a *ResultError of
+// Code CodeTimeout, also passed to Config.OnMessage. Other actions are sent
+// once, even WithIdempotencyKey: BuildRouter does not dedupe a resent packet.
+func (cp *CrudP) Call(ctx context.Context, handlerID uint8, action byte, data any, opts ...CallOption) *Promise {
+	var items []any
+	if data != nil {
+		items = []any{data}
+	}
+	return cp.call(ctx, handlerID, action, items, opts)
+}
+
+// call is Call sending each of data as an item of the packet
+func (cp *CrudP) call(ctx context.Context, handlerID uint8, action byte, data []any, opts []CallOption) *Promise {
+	co := cp.newCallOptions(opts)
+	reqID := co.idempotencyKey
+	if reqID == "" {
+		reqID = cp.nextReqID()
+	}
+	p := &Promise{reqID: reqID, done: make(chan struct{})}
+
+	var items [][]byte
+	for _, item := range data {
+		encoded, err := co.codec.Encode(item)
+		if err != nil {
+			p.settle(PacketResult{}, err)
+			return p
+		}
+		items = append(items, encoded)
+	}
+
+	cp.listeners.mu.Lock()
+	cp.listeners.calls = append(cp.listeners.calls, pendingCall{reqID: reqID, promise: p})
+	cp.listeners.mu.Unlock()
+	stop := context.AfterFunc(ctx, func() {
+		cp.dropCall(reqID)
+		p.settle(PacketResult{}, ctx.Err())
+	})
+	p.Then(func(PacketResult, error) { stop() })
+
+	head := Packet{
+		Action:      action,
+		HandlerID:   handlerID,
+		Version:     co.version,
+		ReqID:       reqID,
+		Page:        co.page,
+		Attachments: co.attachments,
+		IfNoneMatch: co.ifNoneMatch,
+		Deadline:    deadlineIn(co.ttl),
+		Deferred:    co.deferred,
+		ReadAfter:   cp.readAfter(&co, action, handlerID),
+	}
+	send := func() {
+		cp.broker.enqueueOwn(head, items...)
+		if co.priority >= PriorityHigh {
+			cp.broker.FlushNow()
+		}
+	}
+	send()
+	if co.timeout > 0 {
+		r := &callRetry{cp: cp, p: p, head: head, send: send, ms: co.timeout, retries: cp.config.MaxRetries}
+		if !idempotent(action) {
+			r.retries = 0
+		}
+		r.start()
+		p.Then(func(PacketResult, error) { r.stop() })
+	}
+	return p
+}
+
+// idempotent reports whether sending a packet twice does no harm
+// An idempotency key is not enough: only ProcessBatch WithIdempotencyKey
+// replays a batch, and the packets sent by the broker do not carry one.
+func idempotent(action byte) bool {
+	switch action {
+	case 'r', 'u', 'd', ActionPatch:
+		return true
+	}
+	return false
+}
+
+// callRetry resends a Call whose result did not arrive within ms
+type callRetry struct {
+	cp      *CrudP
+	p       *Promise
+	head    Packet // Without Data, echoed by the timeout result
+	send    func()
+	ms      int
+	retries int // Attempts left
+
+	mu    sync.Mutex
+	timer tinytime.Timer
+	done  bool
+}
+
+func (r *callRetry) start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.done {
+		r.timer = r.cp.broker.tp.AfterFunc(r.ms, r.expire)
+	}
+}
+
+func (r *callRetry) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done = true
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+}
+
+// expire sends the packet again, or settles the promise once out of retries
+func (r *callRetry) expire() {
+	r.mu.Lock()
+	if r.done {
+		r.mu.Unlock()
+		return
+	}
+	retry := r.retries > 0
+	r.retries--
+	r.mu.Unlock()
+
+	reqID := r.head.ReqID
+	if retry {
+		r.cp.log.Warn("Call retry", "req_id", reqID, "timeout", r.ms)
+		if !r.cp.broker.queued(reqID) { // Still queued: the flush is late, not the response
+			r.send()
+		}
+		r.start()
+		return
+	}
+
+	r.cp.dropCall(reqID)
+	pr := PacketResult{
+		Packet:      r.head,
+		MessageType: uint8(Msg.Error),
+		Message:     Fmt("no result for %s within %d ms", reqID, r.ms),
+		Code:        CodeTimeout,
+	}
+	err := &ResultError{Handler: r.cp.GetHandlerName(r.head.HandlerID), Code: pr.Code, Message: pr.Message}
+	r.cp.log.Warn("Call timed out", "req_id", reqID, "timeout", r.ms)
+	if r.cp.config.OnMessage != nil {
+		r.cp.config.OnMessage(pr.MessageType, err.Error())
+	}
+	r.p.settle(pr, err)
+}
+
+// pendingCall is a Call waiting for its result
+type pendingCall struct {
+	reqID   string
+	promise *Promise
+}
+
+// resolveCall settles the Call waiting for the ReqID of pr
+// Results the broker re-queued for a retry wait for the next attempt.
+func (cp *CrudP) resolveCall(pr PacketResult) {
+	if pr.ReqID == "" || (retryable(&pr) && cp.broker.queued(pr.ReqID)) {
+		return
+	}
+	cp.listeners.mu.Lock()
+	var p *Promise
+	for i, call := range cp.listeners.calls {
+		if call.reqID == pr.ReqID {
+			p = call.promise
+			cp.listeners.calls = append(cp.listeners.calls[:i], cp.listeners.calls[i+1:]...)
+			break
+		}
+	}
+	cp.listeners.mu.Unlock()
+	if p == nil {
+		return // Not a Call, or already settled (e.g. a duplicate delivery)
+	}
+
+	var err error
+	if pr.MessageType == uint8(Msg.Error) {
+		err = &ResultError{Handler: cp.GetHandlerName(pr.HandlerID), Code: pr.Code, Message: pr.Message}
+	}
+	p.settle(pr, err) // Outside the lock: Then callbacks may Call again
+}
+
+// dropCall forgets an abandoned call
+func (cp *CrudP) dropCall(reqID string) {
+	cp.listeners.mu.Lock()
+	defer cp.listeners.mu.Unlock()
+	for i, call := range cp.listeners.calls {
+		if call.reqID == reqID {
+			cp.listeners.calls = append(cp.listeners.calls[:i], cp.listeners.calls[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package crudp_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cdvelop/crudp"
+)
+
+func CallShared(t *testing.T) {
+	newClient := func() *crudp.CrudP {
+		server := crudp.New(crudp.WithHandlers(&UserController{}))
+		cfg := crudp.DefaultConfig()
+		cfg.FlushStrategy = crudp.ManualFlush()
+		return crudp.NewLoopback(server, cfg, crudp.WithHandlers(&UserController{}))
+	}
+
+	t.Run("Then Receives The Matching Result", func(t *testing.T) {
+		client := newClient()
+		first := client.Call(context.Background(), 0, 'c', &User{Name: "Ana"})
+		second := client.Call(context.Background(), 0, 'r', nil)
+
+		var got crudp.PacketResult
+		first.Then(func(pr crudp.PacketResult, err error) {
+			if err != nil {
+				t.Errorf("first: %v", err)
+			}
+			got = pr
+		})
+		if _, err := first.Result(); err == nil {
+			t.Fatal("expected the call pending before the flush")
+		}
+		client.Broker().FlushNow()
+
+		if got.ReqID != first.ReqID() || got.Action != 'c' {
+			t.Errorf("first resolved with %q %c", got.ReqID, got.Action)
+		}
+		pr, err := second.Result()
+		if err != nil || pr.ReqID != second.ReqID() || pr.Action != 'r' {
+			t.Errorf("second resolved with %q %c, %v", pr.ReqID, pr.Action, err)
+		}
+	})
+
+	t.Run("Error Results And Canceled Calls", func(t *testing.T) {
+		client := newClient()
+		p := client.Call(context.Background(), 0, 'd', &User{ID: 1}) // Delete not implemented
+		client.Broker().FlushNow()
+		var re *crudp.ResultError
+		if _, err := p.Result(); !errors.As(err, &re) {
+			t.Errorf("expected a ResultError, got %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		p = client.Call(ctx, 0, 'r', nil)
+		cancel()
+		if _, err := p.Wait(context.Background()); err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+		client.Broker().FlushNow() // The late result only reaches OnResult
+	})
+
+	t.Run("Timeouts Retry Idempotent Calls", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.BatchWindow = 1
+		cfg.MaxRetries = 2
+		var messages atomic.Int32
+		cfg.OnMessage = func(msgType uint8, message string) { messages.Add(1) }
+		client := crudp.New(cfg, crudp.WithHandlers(&UserController{}))
+		var sends atomic.Int32
+		client.Broker().SetOnFlush(func([]byte) { sends.Add(1) }) // Responses are lost
+
+		read := client.Call(context.Background(), 0, 'r', nil, crudp.WithTimeout(20))
+		create := client.Call(context.Background(), 0, 'c', &User{Name: "Ana"}, crudp.WithTimeout(20))
+		keyed := client.Call(context.Background(), 0, 'c', &User{Name: "Bo"}, crudp.WithTimeout(20), crudp.WithIdempotencyKey("bo-1"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		pr, err := read.Wait(ctx)
+		var re *crudp.ResultError
+		if !errors.As(err, &re) || re.Code != crudp.CodeTimeout || pr.ReqID != read.ReqID() {
+			t.Fatalf("expected a timeout result, got %+v %v", pr, err)
+		}
+		if _, err := create.Wait(ctx); !errors.As(err, &re) || re.Code != crudp.CodeTimeout {
+			t.Fatalf("expected the create to time out, got %v", err)
+		}
+		if _, err := keyed.Wait(ctx); !errors.As(err, &re) || re.Code != crudp.CodeTimeout {
+			t.Fatalf("expected the keyed create to time out, got %v", err)
+		}
+		// 1 batch with every packet, then 2 retries of the read only: a
+		// create is never resent, even with an idempotency key
+		if n := sends.Load(); n != 3 {
+			t.Errorf("expected 3 sends, got %d", n)
+		}
+		if n := messages.Load(); n != 3 {
+			t.Errorf("expected a message per failed call, got %d", n)
+		}
+	})
+}
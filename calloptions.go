@@ -0,0 +1,233 @@
+package crudp
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Priority levels for WithPriority
+const (
+	PriorityNormal uint8 = iota
+	PriorityHigh         // Flushes the broker queue immediately
+)
+
+// CallOption tweaks a single EncodePacket, EnqueuePacket or ProcessBatch call
+type CallOption interface {
+	applyCall(co *callOptions)
+}
+
+// callOptions holds the per-call overrides
+type callOptions struct {
+	timeout        int // milliseconds, 0 = none
+	priority       uint8
+	codec          Codec
+	idempotencyKey string
+	version        byte
+	page           *Page
+	dependsOn      []string
+	refs           []Ref
+	attachments    [][]byte
+	ifNoneMatch    string
+	chunk          *chunkCall // WithChunk, nil for whole batches
+	ttl            int        // WithTTL in ms, 0 = Config.PacketTTL
+	deferred       bool
+	readAfter      string
+}
+
+type callOptionFunc func(co *callOptions)
+
+func (f callOptionFunc) applyCall(co *callOptions) { f(co) }
+
+// WithTimeout bounds ProcessBatch with a deadline in milliseconds, and each
+// attempt of a Call waiting for its result
+func WithTimeout(ms int) CallOption {
+	return callOptionFunc(func(co *callOptions) {
+		co.timeout = ms
+	})
+}
+
+// WithPriority sets the queue priority for EnqueuePacket
+func WithPriority(p uint8) CallOption {
+	return callOptionFunc(func(co *callOptions) {
+		co.priority = p
+	})
+}
+
+// WithIdempotencyKey marks a call as idempotent
+// EncodePacket/EnqueuePacket use it as ReqID when none is given,
+// ProcessBatch returns the cached response for a key repeated by the same
+// client (see ClientKey); a repeat sent while the first batch runs waits for it
+func WithIdempotencyKey(key string) CallOption {
+	return callOptionFunc(func(co *callOptions) {
+		co.idempotencyKey = key
+	})
+}
+
+// WithVersion targets a specific handler version (see RegisterVersion)
+func WithVersion(v byte) CallOption {
+	return callOptionFunc(func(co *callOptions) {
+		co.version = v
+	})
+}
+
+// CodecOption overrides the codec, both in New and per call
+type CodecOption struct {
+	codec Codec
+}
+
+// WithCodec overrides the codec. Nil is ignored
+func WithCodec(codec Codec) CodecOption {
+	return CodecOption{codec: codec}
+}
+
+func (o CodecOption) apply(cp *CrudP) {
+	if o.codec != nil {
+		cp.codec = o.codec
+	}
+}
+
+func (o CodecOption) applyCall(co *callOptions) {
+	if o.codec != nil {
+		co.codec = o.codec
+	}
+}
+
+// newCallOptions applies opts over the instance defaults
+func (cp *CrudP) newCallOptions(opts []CallOption) callOptions {
+	co := callOptions{codec: cp.codec}
+	for _, opt := range opts {
+		if opt != nil {
+			opt.applyCall(&co)
+		}
+	}
+	return co
+}
+
+// splitCallOptions separates CallOption values mixed into variadic data
+func splitCallOptions(data []any) ([]any, []CallOption) {
+	var opts []CallOption
+	for _, item := range data {
+		if opt, ok := item.(CallOption); ok {
+			opts = append(opts, opt)
+		}
+	}
+	if len(opts) == 0 {
+		return data, nil
+	}
+
+	items := make([]any, 0, len(data)-len(opts))
+	for _, item := range data {
+		if _, ok := item.(CallOption); !ok {
+			items = append(items, item)
+		}
+	}
+	return items, opts
+}
+
+// context derives the call context, applying the timeout if set
+func (co *callOptions) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if co.timeout > 0 {
+		return context.WithTimeout(ctx, time.Duration(co.timeout)*time.Millisecond)
+	}
+	return ctx, func() {}
+}
+
+// idempotencyEntry stores the response produced for a key
+type idempotencyEntry struct {
+	key      string
+	response []byte
+	ready    bool          // response is set; otherwise the batch is still running
+	done     chan struct{} // Closed once ready or released
+}
+
+// idempotencyCache keeps the last responses by key (slice, no maps for TinyGo)
+// A key is reserved while its batch runs, so a repeat waits for the response
+// instead of running the batch again.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	entries []idempotencyEntry
+	limit   int
+}
+
+// idempotencyCacheLimit is the number of keys remembered
+const idempotencyCacheLimit = 64
+
+func (c *idempotencyCache) index(key string) int {
+	for i := range c.entries {
+		if c.entries[i].key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// reserve returns the cached response for key, waiting while another batch
+// holds it; ok false means key is now reserved by the caller, who must put
+// a response or release it
+func (c *idempotencyCache) reserve(ctx context.Context, key string) (response []byte, ok bool, err error) {
+	for {
+		c.mu.Lock()
+		i := c.index(key)
+		if i < 0 {
+			c.evict()
+			c.entries = append(c.entries, idempotencyEntry{key: key, done: make(chan struct{})})
+			c.mu.Unlock()
+			return nil, false, nil
+		}
+		e := c.entries[i]
+		c.mu.Unlock()
+		if e.ready {
+			return e.response, true, nil
+		}
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+}
+
+// put stores the response of a reserved key and wakes its waiters
+func (c *idempotencyCache) put(key string, response []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.index(key)
+	if i < 0 {
+		c.evict()
+		c.entries = append(c.entries, idempotencyEntry{key: key, done: make(chan struct{})})
+		i = len(c.entries) - 1
+	} else if c.entries[i].ready {
+		return
+	}
+	c.entries[i].response, c.entries[i].ready = response, true
+	close(c.entries[i].done)
+}
+
+// release drops a reservation left without response, e.g. a failed batch,
+// so the next waiter runs the batch itself
+func (c *idempotencyCache) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i := c.index(key); i >= 0 && !c.entries[i].ready {
+		close(c.entries[i].done)
+		c.entries = append(c.entries[:i], c.entries[i+1:]...)
+	}
+}
+
+// evict drops the oldest response once the limit is reached; running
+// batches keep their reservation
+func (c *idempotencyCache) evict() {
+	if c.limit == 0 {
+		c.limit = idempotencyCacheLimit
+	}
+	if len(c.entries) < c.limit {
+		return
+	}
+	for i := range c.entries {
+		if c.entries[i].ready {
+			c.entries = append(c.entries[:i], c.entries[i+1:]...)
+			return
+		}
+	}
+}
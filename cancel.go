@@ -0,0 +1,163 @@
+package crudp
+
+import (
+	"context"
+	"sync"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// ActionCancel asks the server to abort the packet sent with the same ReqID
+// by the same client (see Cancel). Cancel sends it itself.
+const ActionCancel byte = 'x'
+
+// CodeNotRunning answers an ActionCancel packet whose target is not running
+// (already finished, or never received)
+const CodeNotRunning = "not_running"
+
+// canceledLimit bounds the ReqIDs the broker remembers as canceled
+const canceledLimit = 64
+
+// runningPacket is a packet whose handler is running, see runningPackets
+type runningPacket struct {
+	key      string
+	cancel   context.CancelFunc
+	canceled bool // By an ActionCancel packet
+}
+
+// runningPackets lets ActionCancel reach handlers of other batches (slice, no maps for TinyGo)
+type runningPackets struct {
+	mu      sync.Mutex
+	entries []runningPacket
+}
+
+// runningKey identifies the packet with reqID of the client of ctx
+func runningKey(ctx context.Context, reqID string) string {
+	return tenantScoped(ctx, ClientKey(ctx)+"|"+reqID)
+}
+
+// track derives the handler ctx of packet; stop forgets it and reports
+// whether an ActionCancel packet canceled it
+func (r *runningPackets) track(ctx context.Context, packet *Packet) (context.Context, func() bool) {
+	if packet.ReqID == "" || packet.Action == ActionCancel {
+		return ctx, func() bool { return false }
+	}
+	key := runningKey(ctx, packet.ReqID)
+	ctx, cancel := context.WithCancel(ctx)
+	r.mu.Lock()
+	r.entries = append(r.entries, runningPacket{key: key, cancel: cancel})
+	r.mu.Unlock()
+
+	return ctx, func() bool {
+		defer cancel()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for i := range r.entries {
+			if r.entries[i].key == key {
+				canceled := r.entries[i].canceled
+				r.entries = append(r.entries[:i], r.entries[i+1:]...)
+				return canceled
+			}
+		}
+		return false
+	}
+}
+
+// cancel cancels the running packets under key
+func (r *runningPackets) cancel(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	found := false
+	for i := range r.entries {
+		if r.entries[i].key == key {
+			r.entries[i].canceled = true
+			r.entries[i].cancel()
+			found = true
+		}
+	}
+	return found
+}
+
+// processCancel answers an ActionCancel packet
+func (cp *CrudP) processCancel(ctx context.Context, packet *Packet) PacketResult {
+	pr := PacketResult{Packet: packet.echo(), MessageType: uint8(Msg.Success)}
+	if !cp.running.cancel(runningKey(ctx, packet.ReqID)) {
+		pr.MessageType = uint8(Msg.Normal)
+		pr.Code = CodeNotRunning
+	}
+	cp.log.Debug("ProcessBatch cancel", "req_id", packet.ReqID, "running", pr.Code == "")
+	return pr
+}
+
+// Cancel aborts the request sent with reqID (client side)
+// Queued packets with reqID are dropped and a pending Call settles with
+// context.Canceled. When the packet was already sent, an ActionCancel notice
+// follows it so the server cancels the handler ctx; the packet gets a result
+// with Code CodeCanceled and is not retried. It reports whether anything
+// with reqID was queued, in flight or pending.
+func (cp *CrudP) Cancel(reqID string) bool {
+	if reqID == "" {
+		return false
+	}
+	queued, sent := cp.broker.cancel(reqID)
+
+	cp.listeners.mu.Lock()
+	var p *Promise
+	for _, call := range cp.listeners.calls {
+		if call.reqID == reqID {
+			p = call.promise
+			break
+		}
+	}
+	cp.listeners.mu.Unlock()
+	if p != nil {
+		cp.dropCall(reqID)
+		p.settle(PacketResult{}, context.Canceled)
+	}
+
+	if sent {
+		cp.log.Debug("Cancel sent", "req_id", reqID)
+		cp.broker.enqueueOwn(Packet{Action: ActionCancel, ReqID: reqID})
+		cp.broker.FlushNow()
+	}
+	return queued || sent || p != nil
+}
+
+// cancel drops the queued packets with reqID and remembers reqID as canceled
+// when a batch in flight holds it, so its result is not retried
+func (b *broker) cancel(reqID string) (queued, sent bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := 0; i < len(b.queue); i++ {
+		if b.queue[i].ReqID == reqID && b.queue[i].Action != ActionCancel {
+			b.queue = append(b.queue[:i:i], b.queue[i+1:]...)
+			b.tries = append(b.tries[:i:i], b.tries[i+1:]...)
+			i--
+			queued = true
+		}
+	}
+	for _, f := range b.inflight {
+		for _, p := range f.packets {
+			if p.ReqID == reqID && p.Action != ActionCancel {
+				sent = true
+			}
+		}
+	}
+	if sent {
+		if len(b.canceled) >= canceledLimit {
+			b.canceled = b.canceled[1:]
+		}
+		b.canceled = append(b.canceled, reqID)
+	}
+	return queued, sent
+}
+
+// wasCanceled reports whether Cancel was called for reqID (must be called with lock)
+func (b *broker) wasCanceled(reqID string) bool {
+	for _, c := range b.canceled {
+		if c == reqID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package crudp_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Aborter cancels the batch context while it runs, like a client disconnect
+type Aborter struct{}
+
+type abortKey struct{}
+
+func (h *Aborter) Read(ctx context.Context, data ...any) any {
+	ctx.Value(abortKey{}).(context.CancelFunc)()
+	return "ok"
+}
+
+func CancellationShared(t *testing.T) {
+	t.Run("Skips Remaining Packets", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&Aborter{}, &Chart{}))
+		chartCalls = 0
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{
+			{Action: 'r', HandlerID: 0, ReqID: "1"},
+			{Action: 'r', HandlerID: 1, ReqID: "2"},
+			{Action: 'd', HandlerID: 1, ReqID: "3"},
+		}})
+		resp, err := cp.ProcessBatch(context.WithValue(ctx, abortKey{}, cancel), batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out crudp.BatchResponse
+		if err := cp.Codec().Decode(resp, &out); err != nil || len(out.Results) != 3 {
+			t.Fatalf("decode response: %v", err)
+		}
+
+		if chartCalls != 0 {
+			t.Errorf("skipped packets reached the handler %d times", chartCalls)
+		}
+		for _, pr := range out.Results[1:] {
+			if pr.MessageType != uint8(Msg.Error) || pr.Code != crudp.CodeCanceled {
+				t.Errorf("packet %s: expected canceled result, got %d %q code %q", pr.ReqID, pr.MessageType, pr.Message, pr.Code)
+			}
+		}
+	})
+
+	t.Run("Aborted Batch Not Cached", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&Aborter{}, &Chart{}))
+		chartCalls = 0
+		batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'r', HandlerID: 1}}})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		cp.ProcessBatch(ctx, batch, crudp.WithIdempotencyKey("k1"))
+		cp.ProcessBatch(context.Background(), batch, crudp.WithIdempotencyKey("k1"))
+		if chartCalls != 1 {
+			t.Errorf("expected the retry to run, got %d calls", chartCalls)
+		}
+	})
+
+	t.Run("Client Cancel Drops Queued Packets", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.FlushStrategy = crudp.ManualFlush()
+		client := crudp.New(cfg, crudp.WithHandlers(&Chart{}))
+
+		p := client.Call(context.Background(), 0, 'r', nil)
+		if !client.Cancel(p.ReqID()) {
+			t.Fatal("expected the queued call canceled")
+		}
+		if _, err := p.Result(); err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+		if s := client.Broker().Stats(); s.Queued != 0 {
+			t.Errorf("expected the packet dropped, got %+v", s)
+		}
+		if client.Cancel(p.ReqID()) {
+			t.Error("nothing left to cancel")
+		}
+	})
+
+	t.Run("Client Cancel Aborts Running Handler", func(t *testing.T) {
+		h := &Sleeper{started: make(chan struct{}), stopped: make(chan error, 1)}
+		server := crudp.New(crudp.WithHandlers(h))
+		cfg := crudp.DefaultConfig()
+		cfg.BatchWindow = 1
+		client := crudp.NewLoopback(server, cfg, crudp.WithHandlers(h))
+
+		var results []crudp.PacketResult
+		var mu sync.Mutex
+		client.OnResult(func(pr crudp.PacketResult) {
+			mu.Lock()
+			results = append(results, pr)
+			mu.Unlock()
+		})
+		p := client.Call(context.Background(), 0, 'r', nil)
+		<-h.started
+		if !client.Cancel(p.ReqID()) {
+			t.Fatal("expected the running call canceled")
+		}
+		select {
+		case err := <-h.stopped:
+			if err != context.Canceled {
+				t.Errorf("handler ctx ended with %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("handler not canceled")
+		}
+
+		time.Sleep(20 * time.Millisecond) // The canceled result travels back
+		mu.Lock()
+		defer mu.Unlock()
+		if len(results) != 1 || results[0].Code != crudp.CodeCanceled {
+			t.Errorf("expected one canceled result, got %+v", results)
+		}
+		if s := client.Broker().Stats(); s.Queued != 0 || s.InFlight != 0 || s.Requeued != 0 {
+			t.Errorf("canceled packet must not be retried: %+v", s)
+		}
+	})
+}
+
+// Sleeper blocks its Read until ctx ends
+type Sleeper struct {
+	started chan struct{}
+	stopped chan error
+}
+
+func (h *Sleeper) Read(ctx context.Context, data ...any) any {
+	close(h.started)
+	select {
+	case <-ctx.Done():
+		h.stopped <- ctx.Err()
+	case <-time.After(2 * time.Second):
+		h.stopped <- nil
+	}
+	return "done"
+}
@@ -0,0 +1,127 @@
+package crudp
+
+import (
+	"sync"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// Message catalog shared by server and client
+//
+// Both sides compile the same catalog, so with Config.MessageKeys the server
+// sends PacketResult.MessageKey and MessageArgs instead of a formatted
+// Message, and the client renders the text in its own Config.Locale.
+var catalog = struct {
+	sync.RWMutex
+	texts map[string]LocStr
+	keys  map[LocStr]string
+}{texts: map[string]LocStr{}, keys: map[LocStr]string{}}
+
+// Message keys of the texts CRUDP answers itself
+const (
+	MsgNotImplemented   = "crudp.not_implemented"
+	MsgNoHandler        = "crudp.no_handler"
+	MsgNoVersion        = "crudp.no_version"
+	MsgExpired          = "crudp.expired"
+	MsgDependencyFailed = "crudp.dependency_failed"
+	MsgAborted          = "crudp.aborted"
+	MsgRefsInStream     = "crudp.refs_in_stream"
+)
+
+func init() {
+	RegisterMessages(map[string]LocStr{
+		MsgNotImplemented:   msgNotImplemented,
+		MsgNoHandler:        msgNoHandler,
+		MsgNoVersion:        msgNoVersion,
+		MsgExpired:          msgExpired,
+		MsgDependencyFailed: msgDependencyFailed,
+		MsgAborted:          msgAborted,
+		MsgRefsInStream:     msgRefsInStream,
+	})
+}
+
+// RegisterMessages adds texts to the message catalog by key, e.g. from an
+// init function of a package built into both server and client. A LocError
+// of a registered text is sent with its key.
+func RegisterMessages(texts map[string]LocStr) {
+	catalog.Lock()
+	defer catalog.Unlock()
+	for key, text := range texts {
+		catalog.texts[key] = text
+		catalog.keys[text] = key
+	}
+}
+
+// MessageText returns the catalog text of key in locale, with args in the
+// place of its verbs; false if key is not registered
+func MessageText(key, locale string, args ...string) (string, bool) {
+	catalog.RLock()
+	text, ok := catalog.texts[key]
+	catalog.RUnlock()
+	if !ok {
+		return "", false
+	}
+	return fill(localized(text, locale), args), true
+}
+
+// messageKey returns the catalog key of text, "" if not registered
+func messageKey(text LocStr) string {
+	catalog.RLock()
+	defer catalog.RUnlock()
+	return catalog.keys[text]
+}
+
+// formatArgs formats each arg with its verb in the English text, so a
+// client can put them into a translation with fill
+func formatArgs(text LocStr, args []any) []string {
+	if len(args) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(args))
+	tmpl := text[EN]
+	for i := 0; i < len(tmpl) && len(out) < len(args); i++ {
+		if tmpl[i] != '%' || i+1 == len(tmpl) {
+			continue
+		}
+		i++
+		if tmpl[i] == '%' {
+			continue
+		}
+		out = append(out, Fmt("%"+string(tmpl[i]), args[len(out)]))
+	}
+	return out
+}
+
+// fill replaces the verbs of tmpl with args in order
+func fill(tmpl string, args []string) string {
+	b := make([]byte, 0, len(tmpl))
+	n := 0
+	for i := 0; i < len(tmpl); i++ {
+		if tmpl[i] != '%' || i+1 == len(tmpl) {
+			b = append(b, tmpl[i])
+			continue
+		}
+		i++
+		switch {
+		case tmpl[i] == '%':
+			b = append(b, '%')
+		case n < len(args):
+			b = append(b, args[n]...)
+			n++
+		}
+	}
+	return string(b)
+}
+
+// renderMessage sets the Message of a result sent with only its MessageKey
+// (Config.MessageKeys on the server) in the client Config.Locale
+func (cp *CrudP) renderMessage(pr *PacketResult) {
+	if pr.Message != "" || pr.MessageKey == "" {
+		return
+	}
+	if text, ok := MessageText(pr.MessageKey, cp.config.Locale, pr.MessageArgs...); ok {
+		pr.Message = text
+	} else {
+		pr.Message = pr.MessageKey // Catalog of an older client
+	}
+}
@@ -0,0 +1,59 @@
+package crudp_test
+
+import (
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+func CatalogShared(t *testing.T) {
+	t.Run("Server Sends Keys", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.MessageKeys = true
+		cp := crudp.New(crudp.WithConfig(cfg), crudp.WithHandlers(&Flaky{}))
+
+		pr := processOne(t, cp, crudp.Packet{Action: 'd', HandlerID: 0})
+		if pr.Message != "" || pr.MessageKey != crudp.MsgNotImplemented || len(pr.MessageArgs) != 2 || pr.MessageArgs[0] != "d" || pr.MessageArgs[1] != "flaky" {
+			t.Fatalf("unexpected result %q %q %v", pr.Message, pr.MessageKey, pr.MessageArgs)
+		}
+		if text, ok := crudp.MessageText(pr.MessageKey, "es", pr.MessageArgs...); !ok || text != "acción 'd' no implementada para el manejador: flaky" {
+			t.Errorf("MessageText = %q, %v", text, ok)
+		}
+	})
+
+	t.Run("Keys Without MessageKeys Keep Message", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&Flaky{}))
+		pr := processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 0, Deadline: 1})
+		if pr.Message != "packet expired" || pr.MessageKey != crudp.MsgExpired {
+			t.Errorf("unexpected result %q %q", pr.Message, pr.MessageKey)
+		}
+	})
+
+	t.Run("Client Renders In Its Locale", func(t *testing.T) {
+		serverCfg := crudp.DefaultConfig()
+		serverCfg.MessageKeys = true
+		server := crudp.New(crudp.WithConfig(serverCfg))
+		server.RegisterHandler(&UserController{})
+
+		var messages []string
+		cfg := crudp.DefaultConfig()
+		cfg.Locale = "es"
+		cfg.OnMessage = func(msgType uint8, message string) {
+			messages = append(messages, message)
+		}
+		client := crudp.NewLoopback(server, cfg)
+
+		client.EnqueuePacket(0, 'd', "loop-1", &UserController{}) // Delete not implemented
+		client.Broker().FlushNow()
+
+		if len(messages) != 1 || messages[0] != "acción 'd' no implementada para el manejador: user_controller" {
+			t.Fatalf("unexpected messages %q", messages)
+		}
+	})
+
+	t.Run("Unknown Key", func(t *testing.T) {
+		if _, ok := crudp.MessageText("app.missing", "es"); ok {
+			t.Error("expected an unknown key")
+		}
+	})
+}
@@ -0,0 +1,9 @@
+//go:build !wasm
+
+package crudp_test
+
+import "testing"
+
+func TestCatalog_Stdlib(t *testing.T) {
+	CatalogShared(t)
+}
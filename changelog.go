@@ -0,0 +1,172 @@
+package crudp
+
+import (
+	"context"
+	"sync"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// ActionSync requests the changes of a handler after a sequence number
+// Data[0] is a SyncCursor; the result carries a single SyncDelta.
+const ActionSync byte = 'y'
+
+// Change is one entry of the change log
+type Change struct {
+	Seq    uint64 `json:"seq"`
+	Action byte   `json:"action"`
+	Data   []byte `json:"data"` // Encoded entity as returned by the handler
+}
+
+// SyncCursor is sent by the client with the last sequence it has seen
+type SyncCursor struct {
+	Since    uint64 `json:"since"`
+	Snapshot bool   `json:"snapshot"` // Ask for a Snapshotter snapshot first (see Bootstrap)
+}
+
+// SyncDelta is the answer to a sync packet
+type SyncDelta struct {
+	Changes []Change `json:"changes"`
+	Seq     uint64   `json:"seq"`   // Latest sequence, use as the next Since
+	Reset   bool     `json:"reset"` // Since is too old: refetch everything, then sync from Seq
+
+	// Snapshot holds the encoded entities of a Snapshotter when requested or
+	// instead of Reset; Changes then follow the snapshot
+	Snapshot [][]byte `json:"snapshot"`
+}
+
+// changeEntry is a Change tagged with its handler and tenant
+type changeEntry struct {
+	handlerID uint8
+	tenant    string
+	change    Change
+}
+
+// changeLog keeps the last changes of every handler (slice, no maps for TinyGo)
+type changeLog struct {
+	mu      sync.Mutex
+	limit   int
+	entries []changeEntry
+	seq     [maxHandlers]uint64 // Last sequence per handler
+	floor   [maxHandlers]uint64 // Last evicted sequence per handler
+}
+
+func (l *changeLog) record(tenant string, handlerID uint8, action byte, data [][]byte) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, item := range data {
+		l.seq[handlerID]++
+		if len(l.entries) >= l.limit {
+			// Drop oldest
+			oldest := l.entries[0]
+			l.floor[oldest.handlerID] = oldest.change.Seq
+			l.entries = append(l.entries[:0], l.entries[1:]...)
+		}
+		l.entries = append(l.entries, changeEntry{
+			handlerID: handlerID,
+			tenant:    tenant,
+			change:    Change{Seq: l.seq[handlerID], Action: action, Data: item},
+		})
+	}
+	return l.seq[handlerID]
+}
+
+// last returns the latest sequence of a handler
+func (l *changeLog) last(handlerID uint8) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seq[handlerID]
+}
+
+// since returns the changes of tenant; sequences are shared by all tenants,
+// so a tenant may see gaps
+func (l *changeLog) since(tenant string, handlerID uint8, since uint64) SyncDelta {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delta := SyncDelta{Seq: l.seq[handlerID]}
+	if since < l.floor[handlerID] || since > delta.Seq {
+		delta.Reset = true
+		return delta
+	}
+	for _, e := range l.entries {
+		if e.handlerID == handlerID && e.tenant == tenant && e.change.Seq > since {
+			delta.Changes = append(delta.Changes, e.change)
+		}
+	}
+	return delta
+}
+
+// RecordChange adds changes made outside of packets (e.g. background jobs)
+// to the change log of a handler and returns the new sequence number.
+// They belong to the "" tenant, see RecordTenantChange.
+func (cp *CrudP) RecordChange(handlerID uint8, action byte, data any) (uint64, error) {
+	return cp.RecordTenantChange("", handlerID, action, data)
+}
+
+// RecordTenantChange is RecordChange for the changes of a tenant
+func (cp *CrudP) RecordTenantChange(tenant string, handlerID uint8, action byte, data any) (uint64, error) {
+	if cp.changes == nil {
+		return 0, Errf("change log disabled: set Config.ChangeLogSize")
+	}
+	encoded, err := cp.codec.Encode(data)
+	if err != nil {
+		return 0, err
+	}
+	return cp.changes.record(tenant, handlerID, action, [][]byte{encoded}), nil
+}
+
+// Sync queues a sync packet asking for the changes of a handler after since
+// The result Data[0] decodes into a SyncDelta.
+func (cp *CrudP) Sync(handlerID uint8, since uint64, opts ...CallOption) error {
+	return cp.EnqueuePacket(handlerID, ActionSync, "", SyncCursor{Since: since}, opts...)
+}
+
+// recordResult logs the data of a successful write packet
+func (cp *CrudP) recordResult(ctx context.Context, pr *PacketResult) {
+	if cp.changes == nil {
+		return
+	}
+	switch pr.Action {
+	case 'c', 'u', 'd', ActionPatch:
+		cp.changes.record(Tenant(ctx), pr.HandlerID, pr.Action, pr.Data)
+	}
+}
+
+// processSync answers a sync packet from the change log
+func (cp *CrudP) processSync(ctx context.Context, codec Codec, handler *actionHandler, packet *Packet) (PacketResult, error) {
+	pr := PacketResult{Packet: *packet}
+	pr.Data = nil
+
+	if cp.changes == nil {
+		err := Errf("change log disabled: set Config.ChangeLogSize")
+		return errorResult(packet, err), err
+	}
+
+	var cursor SyncCursor
+	if len(packet.Data) > 0 {
+		if err := codec.Decode(packet.Data[0], &cursor); err != nil {
+			return errorResult(packet, err), err
+		}
+	}
+
+	delta := cp.changes.since(Tenant(ctx), packet.HandlerID, cursor.Since)
+	if handler.Snapshot != nil && (cursor.Snapshot || delta.Reset) {
+		var err error
+		if delta, err = cp.snapshotDelta(ctx, codec, handler, packet.HandlerID); err != nil {
+			cp.log.Error("snapshot failed", "handler", handler.name, "error", err)
+			return errorResult(packet, err), err
+		}
+	}
+
+	encoded, err := codec.Encode(delta)
+	if err != nil {
+		return errorResult(packet, err), err
+	}
+
+	pr.Data = [][]byte{encoded}
+	pr.MessageType = uint8(Msg.Success)
+	pr.Message = "OK"
+	return pr, nil
+}
@@ -0,0 +1,103 @@
+package crudp_test
+
+import (
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+func syncDelta(t *testing.T, cp *crudp.CrudP, since uint64) crudp.SyncDelta {
+	t.Helper()
+	cursor, _ := cp.Codec().Encode(crudp.SyncCursor{Since: since})
+	result := processOne(t, cp, crudp.Packet{Action: crudp.ActionSync, Data: [][]byte{cursor}})
+	if result.MessageType != uint8(Msg.Success) {
+		t.Fatalf("sync failed: %s", result.Message)
+	}
+	var delta crudp.SyncDelta
+	if err := cp.Codec().Decode(result.Data[0], &delta); err != nil {
+		t.Fatalf("decode delta: %v", err)
+	}
+	return delta
+}
+
+func createUsers(t *testing.T, cp *crudp.CrudP, names ...string) {
+	t.Helper()
+	data := make([][]byte, len(names))
+	for i, name := range names {
+		data[i], _ = cp.Codec().Encode(&User{Name: name})
+	}
+	if r := processOne(t, cp, crudp.Packet{Action: 'c', Data: data}); r.MessageType != uint8(Msg.Success) {
+		t.Fatalf("create failed: %s", r.Message)
+	}
+}
+
+func DeltaSyncShared(t *testing.T) {
+	t.Run("Deltas Since Last Seen", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.ChangeLogSize = 3
+		cp := crudp.New(cfg)
+		cp.RegisterHandler(&User{})
+
+		createUsers(t, cp, "a", "b")
+
+		delta := syncDelta(t, cp, 0)
+		if delta.Seq != 2 || len(delta.Changes) != 2 || delta.Reset {
+			t.Fatalf("expected 2 changes up to seq 2, got %+v", delta)
+		}
+		if delta.Changes[0].Action != 'c' || delta.Changes[1].Seq != 2 {
+			t.Errorf("unexpected changes: %+v", delta.Changes)
+		}
+
+		if delta = syncDelta(t, cp, 2); len(delta.Changes) != 0 || delta.Seq != 2 {
+			t.Errorf("expected no changes after seq 2, got %+v", delta)
+		}
+
+		// Two more changes evict seq 1: clients at 0 must refetch
+		createUsers(t, cp, "c", "d")
+		if delta = syncDelta(t, cp, 0); !delta.Reset || delta.Seq != 4 {
+			t.Errorf("expected reset at seq 4, got %+v", delta)
+		}
+		if delta = syncDelta(t, cp, 2); delta.Reset || len(delta.Changes) != 2 {
+			t.Errorf("expected 2 changes after seq 2, got %+v", delta)
+		}
+	})
+
+	t.Run("RecordChange And Client Sync", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.ChangeLogSize = 10
+		server := crudp.New(cfg)
+		server.RegisterHandler(&User{})
+
+		seq, err := server.RecordChange(0, 'u', &User{ID: 9, Name: "job"})
+		if err != nil || seq != 1 {
+			t.Fatalf("RecordChange: seq %d, err %v", seq, err)
+		}
+
+		client := crudp.NewLoopback(server, crudp.WithHandlers(&User{}))
+		var results []crudp.PacketResult
+		client.OnResult(func(pr crudp.PacketResult) {
+			results = append(results, pr)
+		})
+		client.Sync(0, 0)
+		client.Broker().FlushNow()
+
+		if len(results) != 1 || results[0].Action != crudp.ActionSync {
+			t.Fatalf("expected 1 sync result, got %+v", results)
+		}
+		var delta crudp.SyncDelta
+		client.Codec().Decode(results[0].Data[0], &delta)
+		if len(delta.Changes) != 1 || delta.Changes[0].Action != 'u' {
+			t.Errorf("unexpected delta: %+v", delta)
+		}
+	})
+
+	t.Run("Disabled By Default", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		cp.RegisterHandler(&User{})
+		result := processOne(t, cp, crudp.Packet{Action: crudp.ActionSync})
+		if result.MessageType != uint8(Msg.Error) {
+			t.Errorf("expected error without change log, got %s", result.Message)
+		}
+	})
+}
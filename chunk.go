@@ -0,0 +1,258 @@
+package crudp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// HTTP headers carrying WithChunk on the API endpoint
+const (
+	ChunkBatchHeader = "X-Crudp-Batch" // Batch ID, e.g. a random string per sync
+	ChunkSeqHeader   = "X-Crudp-Seq"   // Chunk number, from 0
+	ChunkFinalHeader = "X-Crudp-Final" // "1" on the last chunk
+)
+
+// chunkTTL is how long an idle chunked batch is remembered
+const chunkTTL = 10 * time.Minute
+
+// chunkLimit bounds the chunked batches remembered at once
+const chunkLimit = 256
+
+// chunkCall is the WithChunk state of one ProcessBatch call
+type chunkCall struct {
+	batchID  string
+	seq      uint32
+	final    bool
+	failed   []string // ReqIDs failed in earlier chunks, then in this one
+	rejected bool     // Not processed (decode error, maintenance): seq not consumed
+}
+
+// WithChunk marks the batch of a ProcessBatch call as chunk seq of the
+// logical batch batchID, letting big syncs travel in small requests
+// Chunks must come in order from 0. Each is processed when it arrives;
+// DependsOn also sees the packets that failed in earlier chunks. Resending
+// the last chunk replays its response; any other sequence gets a result with
+// Code CodeChunkOrder naming the chunk expected, see ExpectedChunk. Batches
+// idle for 10 minutes are forgotten.
+func WithChunk(batchID string, seq uint32, final bool) CallOption {
+	return callOptionFunc(func(co *callOptions) {
+		co.chunk = &chunkCall{batchID: batchID, seq: seq, final: final}
+	})
+}
+
+// failedDep returns the first DependsOn entry of packet failed in an earlier chunk
+func (c *chunkCall) failedDep(packet *Packet) string {
+	if c == nil {
+		return ""
+	}
+	return failedDependency(packet, c.failed)
+}
+
+// track records packet as failed for the next chunks
+func (c *chunkCall) track(packet *Packet, result *PacketResult) {
+	if c != nil && packet.ReqID != "" && failed(result) {
+		c.failed = append(c.failed, packet.ReqID)
+	}
+}
+
+func (c *chunkCall) reject() {
+	if c != nil {
+		c.rejected = true
+	}
+}
+
+// chunkSession is the server state of a chunked batch
+type chunkSession struct {
+	key     string
+	next    uint32   // Chunk expected
+	last    []byte   // Response of chunk next-1, replayed on resend
+	failed  []string // See chunkCall.failed
+	busy    bool     // A chunk is being processed
+	done    bool     // Final chunk processed
+	expires time.Time
+}
+
+// chunkTable keeps the chunked batches in progress (slice, no maps for TinyGo)
+type chunkTable struct {
+	mu       sync.Mutex
+	sessions []chunkSession
+}
+
+// begin claims chunk seq of key; it returns the response to replay, or
+// ok=false with the chunk expected
+func (t *chunkTable) begin(key string, seq uint32, now time.Time) (replay []byte, failed []string, expected uint32, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	live := t.sessions[:0]
+	for _, s := range t.sessions {
+		if s.busy || now.Before(s.expires) {
+			live = append(live, s)
+		}
+	}
+	t.sessions = live
+
+	i := t.find(key)
+	if i < 0 {
+		if seq != 0 {
+			return nil, nil, 0, false
+		}
+		if len(t.sessions) >= chunkLimit {
+			t.sessions = append(t.sessions[:0], t.sessions[1:]...) // Drop oldest
+		}
+		t.sessions = append(t.sessions, chunkSession{key: key})
+		i = len(t.sessions) - 1
+	}
+
+	s := &t.sessions[i]
+	switch {
+	case s.busy:
+		return nil, nil, s.next, false
+	case s.last != nil && seq+1 == s.next:
+		return s.last, nil, 0, true
+	case s.done || seq != s.next:
+		return nil, nil, s.next, false
+	}
+	s.busy = true
+	return nil, append([]string(nil), s.failed...), 0, true
+}
+
+// finish releases the chunk claimed by begin, consuming it unless rejected
+func (t *chunkTable) finish(key string, c *chunkCall, response []byte, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	i := t.find(key)
+	if i < 0 {
+		return
+	}
+	s := &t.sessions[i]
+	s.busy = false
+	s.expires = now.Add(chunkTTL)
+	if c.rejected || response == nil {
+		return
+	}
+	s.next++
+	s.last = response
+	s.failed = c.failed
+	s.done = c.final
+}
+
+func (t *chunkTable) find(key string) int {
+	for i := range t.sessions {
+		if t.sessions[i].key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// processChunk runs one chunk of a WithChunk batch
+func (cp *CrudP) processChunk(ctx context.Context, requestBytes []byte, co callOptions) ([]byte, error) {
+	key := tenantScoped(ctx, co.chunk.batchID)
+	replay, failed, expected, ok := cp.chunks.begin(key, co.chunk.seq, time.Now())
+	if !ok {
+		cp.log.Warn("ProcessBatch chunk out of order", "batch", co.chunk.batchID, "seq", co.chunk.seq, "expected", expected)
+		return co.codec.Encode(BatchResponse{Results: []PacketResult{{
+			MessageType: uint8(Msg.Error),
+			Message:     Fmt("expected chunk %d", expected),
+			Code:        CodeChunkOrder,
+		}}})
+	}
+	if replay != nil {
+		cp.log.Debug("ProcessBatch chunk replay", "batch", co.chunk.batchID, "seq", co.chunk.seq)
+		return replay, nil
+	}
+
+	co.chunk.failed = failed
+	response, err := cp.runBatch(ctx, requestBytes, co)
+	if err != nil {
+		response = nil
+	}
+	cp.chunks.finish(key, co.chunk, response, time.Now())
+	return response, err
+}
+
+// ExpectedChunk returns the chunk a server asked for in a CodeChunkOrder result
+func ExpectedChunk(pr PacketResult) (uint32, bool) {
+	const prefix = "expected chunk "
+	if pr.Code != CodeChunkOrder || len(pr.Message) <= len(prefix) || pr.Message[:len(prefix)] != prefix {
+		return 0, false
+	}
+	var n uint32
+	for _, c := range pr.Message[len(prefix):] {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + uint32(c-'0')
+	}
+	return n, true
+}
+
+// SendChunked sends batch, an encoded BatchRequest (e.g. from DrainTo), as
+// chunks of size packets of the logical batch batchID (client side)
+// send posts one chunk with the Chunk headers and returns the response body,
+// which is passed to ReceiveBatch. A failed send is retried up to
+// Config.MaxRetries times, waiting Config.RetryInterval ms. When the server
+// expects another chunk, sending resumes there, so calling SendChunked again
+// with the same batchID after an error continues where the server stopped.
+func (cp *CrudP) SendChunked(batchID string, batch []byte, size int, send func(seq uint32, final bool, chunk []byte) ([]byte, error)) error {
+	var req BatchRequest
+	if err := cp.codec.Decode(batch, &req); err != nil {
+		return err
+	}
+	if size <= 0 {
+		size = len(req.Packets)
+	}
+	count := (len(req.Packets) + size - 1) / size
+	if count == 0 {
+		count = 1 // An empty batch is still one chunk
+	}
+
+	tries := 0
+	for seq := 0; seq < count; {
+		end := (seq + 1) * size
+		if end > len(req.Packets) {
+			end = len(req.Packets)
+		}
+		chunk, err := cp.codec.Encode(BatchRequest{Packets: req.Packets[seq*size : end]})
+		if err != nil {
+			return err
+		}
+
+		response, err := send(uint32(seq), seq == count-1, chunk)
+		var resp BatchResponse
+		if err == nil {
+			err = cp.codec.Decode(response, &resp)
+		}
+		if err != nil {
+			if tries++; tries > cp.config.MaxRetries {
+				return Err(Fmt("chunk %d of %s: %v", seq, batchID, err))
+			}
+			cp.log.Warn("SendChunked retry", "batch", batchID, "seq", seq, "error", err)
+			time.Sleep(time.Duration(cp.config.RetryInterval) * time.Millisecond)
+			continue
+		}
+
+		if len(resp.Results) == 1 {
+			if next, ok := ExpectedChunk(resp.Results[0]); ok {
+				if tries++; tries > cp.config.MaxRetries || int(next) > count {
+					return Err(Fmt("chunk %d of %s: server expects chunk %d", seq, batchID, next))
+				}
+				if int(next) == count {
+					return nil // Every chunk was processed already
+				}
+				seq = int(next)
+				continue
+			}
+		}
+		if err := cp.ReceiveBatch(response); err != nil {
+			return err
+		}
+		seq++
+		tries = 0
+	}
+	return nil
+}
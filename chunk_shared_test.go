@@ -0,0 +1,87 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+func ChunkShared(t *testing.T) {
+	newPair := func() (server, client *crudp.CrudP) {
+		cfg := crudp.DefaultConfig()
+		cfg.RetryInterval = 1
+		return crudp.New(crudp.WithHandlers(&Chart{})), crudp.New(cfg, crudp.WithHandlers(&Chart{}))
+	}
+	encodeBatch := func(t *testing.T, cp *crudp.CrudP, packets ...crudp.Packet) []byte {
+		t.Helper()
+		batch, err := cp.Codec().Encode(crudp.BatchRequest{Packets: packets})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return batch
+	}
+
+	t.Run("Resends Replay Instead Of Reprocessing", func(t *testing.T) {
+		server, client := newPair()
+		var packets []crudp.Packet
+		for i := 0; i < 10; i++ {
+			packets = append(packets, crudp.Packet{Action: 'c', ReqID: Fmt("p%d", i)})
+		}
+		packets[3].HandlerID = 9 // Unknown handler: fails
+		packets[3].ReqID = "bad"
+		packets[7].DependsOn = []string{"bad"} // In a later chunk
+
+		var results []crudp.PacketResult
+		client.OnResult(func(pr crudp.PacketResult) { results = append(results, pr) })
+		lost := false
+		var seqs []uint32
+		send := func(seq uint32, final bool, chunk []byte) ([]byte, error) {
+			seqs = append(seqs, seq)
+			response, err := server.ProcessBatch(context.Background(), chunk, crudp.WithChunk("b1", seq, final))
+			if seq == 1 && !lost {
+				lost = true
+				return nil, Errf("connection reset") // Processed, response lost
+			}
+			return response, err
+		}
+
+		chartCalls = 0
+		if err := client.SendChunked("b1", encodeBatch(t, client, packets...), 4, send); err != nil {
+			t.Fatal(err)
+		}
+		if chartCalls != 8 {
+			t.Errorf("expected 8 handler calls, got %d", chartCalls)
+		}
+		if len(seqs) != 4 || seqs[1] != 1 || seqs[2] != 1 {
+			t.Errorf("unexpected sends %v", seqs)
+		}
+		if len(results) != 10 || results[7].Message != "dependency bad failed" {
+			t.Fatalf("unexpected results (%d)", len(results))
+		}
+
+		// Sending again finds every chunk done
+		seqs = nil
+		if err := client.SendChunked("b1", encodeBatch(t, client, packets...), 4, send); err != nil || chartCalls != 8 {
+			t.Errorf("resend processed again: %v, %d calls", err, chartCalls)
+		}
+	})
+
+	t.Run("Out Of Order", func(t *testing.T) {
+		server, client := newPair()
+		batch := encodeBatch(t, client, crudp.Packet{Action: 'c', ReqID: "a"})
+		response, err := server.ProcessBatch(context.Background(), batch, crudp.WithChunk("b2", 2, false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp crudp.BatchResponse
+		server.Codec().Decode(response, &resp)
+		if len(resp.Results) != 1 {
+			t.Fatalf("unexpected response %+v", resp)
+		}
+		if next, ok := crudp.ExpectedChunk(resp.Results[0]); !ok || next != 0 {
+			t.Errorf("expected chunk 0, got %d %v (%q)", next, ok, resp.Results[0].Message)
+		}
+	})
+}
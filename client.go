@@ -0,0 +1,208 @@
+package crudp
+
+import (
+	"encoding/base64"
+	"sync"
+)
+
+// listeners holds client-side callbacks for results and events
+type listeners struct {
+	mu         sync.Mutex
+	onResult   []func(PacketResult)
+	onEvent    []func(Event)
+	onProgress []func(ProgressEvent)
+	onChannel  []channelListener // Copy-on-write
+	calls      []pendingCall     // HandlerClient calls waiting for a result
+	nextID     int
+}
+
+// channelListener is a callback registered with Subscribe
+type channelListener struct {
+	id      int
+	pattern string
+	fn      func(Event)
+}
+
+// OnResult registers a callback invoked for every PacketResult received by ReceiveBatch
+func (cp *CrudP) OnResult(fn func(PacketResult)) {
+	if fn == nil {
+		return
+	}
+	cp.listeners.mu.Lock()
+	cp.listeners.onResult = append(cp.listeners.onResult, fn)
+	cp.listeners.mu.Unlock()
+}
+
+// OnEvent registers a callback invoked for every Event received by ReceiveEvent
+func (cp *CrudP) OnEvent(fn func(Event)) {
+	if fn == nil {
+		return
+	}
+	cp.listeners.mu.Lock()
+	cp.listeners.onEvent = append(cp.listeners.onEvent, fn)
+	cp.listeners.mu.Unlock()
+}
+
+// Subscribe registers a callback for events on channels matching pattern
+// (see MatchChannel) and returns a function removing it. Open the SSE stream
+// with Channels() so the server sends them.
+func (cp *CrudP) Subscribe(pattern string, fn func(Event)) (unsubscribe func()) {
+	if fn == nil {
+		return func() {}
+	}
+	cp.listeners.mu.Lock()
+	defer cp.listeners.mu.Unlock()
+	cp.listeners.nextID++
+	id := cp.listeners.nextID
+	channels := make([]channelListener, len(cp.listeners.onChannel), len(cp.listeners.onChannel)+1)
+	copy(channels, cp.listeners.onChannel)
+	cp.listeners.onChannel = append(channels, channelListener{id: id, pattern: pattern, fn: fn})
+
+	return func() {
+		cp.listeners.mu.Lock()
+		defer cp.listeners.mu.Unlock()
+		kept := make([]channelListener, 0, len(cp.listeners.onChannel))
+		for _, l := range cp.listeners.onChannel {
+			if l.id != id {
+				kept = append(kept, l)
+			}
+		}
+		cp.listeners.onChannel = kept
+	}
+}
+
+// Channels returns the distinct patterns registered with Subscribe
+func (cp *CrudP) Channels() []string {
+	cp.listeners.mu.Lock()
+	defer cp.listeners.mu.Unlock()
+	var patterns []string
+	for _, l := range cp.listeners.onChannel {
+		if !contains(patterns, l.pattern) {
+			patterns = append(patterns, l.pattern)
+		}
+	}
+	return patterns
+}
+
+// EndpointURL returns the URL clients reach endpoint at:
+// ServerURL + BasePath + endpoint, e.g. EndpointURL(cfg.APIEndpoint)
+func (cp *CrudP) EndpointURL(endpoint string) string {
+	return cp.config.ServerURL + cp.config.BasePath + endpoint
+}
+
+// EventsURL returns the SSE stream URL for the Subscribe patterns
+// (all channels when none), e.g. "/events?channels=patient:*,news"
+func (cp *CrudP) EventsURL() string {
+	url := cp.EndpointURL(cp.config.SSEEndpoint)
+	for i, p := range cp.Channels() {
+		if i == 0 {
+			url += "?channels="
+		} else {
+			url += ","
+		}
+		url += p
+	}
+	return url
+}
+
+// ReceiveBatch processes an encoded BatchResponse received from the server
+// Results are passed to OnResult callbacks and messages to Config.OnMessage
+// Generated IDs (see IDResult) are applied to queued packets and the cache first.
+// Results come in batch order with the ReqID of their packet; a batch the
+// server could not decode yields one CodeDecode result per packet sent.
+func (cp *CrudP) ReceiveBatch(data []byte) error {
+	var resp BatchResponse
+	if err := cp.codec.Decode(data, &resp); err != nil {
+		cp.log.Error("ReceiveBatch decode failed", "error", err)
+		return err
+	}
+	cp.broker.received()
+	if len(resp.Results) == 1 && resp.Results[0].Code == CodeDecode && resp.Results[0].ReqID == "" {
+		resp.Results = cp.broker.undecoded(resp.Results[0])
+	} else {
+		cp.broker.ack(resp.Results, resp.Continuation != "")
+	}
+
+	cp.deliverResults(resp.Results)
+	if resp.Continuation != "" {
+		cp.continueBatch(resp.Continuation)
+	}
+	return nil
+}
+
+// deliverResults passes received results to the cache, OnMessage, OnResult
+// callbacks and pending calls
+func (cp *CrudP) deliverResults(results []PacketResult) {
+	cp.listeners.mu.Lock()
+	callbacks := cp.listeners.onResult
+	cp.listeners.mu.Unlock()
+
+	for _, result := range results {
+		if result.Action == ActionContinue || result.Action == ActionCancel {
+			continue // Echo of a request sent by ReceiveBatch or Cancel
+		}
+		if len(result.IDs) > 0 {
+			cp.applyIDs(result.IDs)
+		}
+		cp.renderMessage(&result)
+		cp.writeTokens.set(&result)
+		cp.cacheResult(&result)
+		if cp.config.OnMessage != nil && result.Message != "" {
+			cp.config.OnMessage(result.MessageType, result.Message)
+		}
+		for _, fn := range callbacks {
+			fn(result)
+		}
+		if result.Code != CodeDeferred { // Calls wait for the job result
+			cp.resolveCall(result)
+		}
+	}
+}
+
+// ReceiveEventData decodes the data field of an SSE message sent by the
+// server SSEEndpoint (base64 of the encoded Event) and calls ReceiveEvent
+func (cp *CrudP) ReceiveEventData(data string) error {
+	encoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return err
+	}
+	var ev Event
+	if err := cp.codec.Decode(encoded, &ev); err != nil {
+		return err
+	}
+	cp.ReceiveEvent(ev)
+	return nil
+}
+
+// ReceiveEvent processes an Event received over SSE
+func (cp *CrudP) ReceiveEvent(ev Event) {
+	switch ev.Channel {
+	case PresenceChannel:
+		cp.receivePresence(ev)
+	case MaintenanceChannel:
+		cp.receiveMaintenance(ev)
+	default:
+		if isNotification(ev) {
+			cp.receiveNotification(ev)
+		} else if isProgress(ev) {
+			cp.receiveProgress(ev)
+		} else if isJob(ev) {
+			cp.receiveJob(ev)
+		}
+	}
+	cp.cacheEvent(ev)
+
+	cp.listeners.mu.Lock()
+	callbacks := cp.listeners.onEvent
+	channels := cp.listeners.onChannel
+	cp.listeners.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(ev)
+	}
+	for _, l := range channels {
+		if MatchChannel(l.pattern, ev.Channel) {
+			l.fn(ev)
+		}
+	}
+}
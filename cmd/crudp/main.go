@@ -0,0 +1,88 @@
+// Command crudp scaffolds CRUDP applications.
+//
+// Usage:
+//
+//	crudp new <dir> [module]
+//
+// Generates a server + WASM client with two sample modules (user, patient)
+// in <dir>. module defaults to the directory name.
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+//go:embed all:template
+var templates embed.FS
+
+// scaffold holds the template variables
+type scaffold struct {
+	Name   string
+	Module string
+}
+
+func main() {
+	if len(os.Args) < 3 || os.Args[1] != "new" {
+		fmt.Fprintln(os.Stderr, "usage: crudp new <dir> [module]")
+		os.Exit(2)
+	}
+
+	dir := os.Args[2]
+	module := filepath.Base(dir)
+	if len(os.Args) > 3 {
+		module = os.Args[3]
+	}
+
+	if err := generate(dir, module); err != nil {
+		fmt.Fprintln(os.Stderr, "crudp:", err)
+		os.Exit(1)
+	}
+	fmt.Println("created", module, "in", dir)
+	fmt.Println("next: cd", dir, "&& go mod tidy && cd web && go run .")
+}
+
+// generate renders every template into dir, refusing to overwrite a non-empty directory
+func generate(dir, module string) error {
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return fmt.Errorf("directory %s is not empty", dir)
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	data := scaffold{
+		Name:   filepath.Base(module),
+		Module: module,
+	}
+
+	return fs.WalkDir(templates, "template", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel := strings.TrimSuffix(strings.TrimPrefix(path, "template/"), ".tmpl")
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+
+		tmpl, err := template.ParseFS(templates, path)
+		if err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		f, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		return tmpl.Execute(f, data)
+	})
+}
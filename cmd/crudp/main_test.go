@@ -0,0 +1,104 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "myapp")
+
+	if err := generate(dir, "example.com/myapp"); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+
+	want := []string{
+		"go.mod",
+		"modules/modules.go",
+		"modules/user/user.go",
+		"modules/user/back.go",
+		"modules/user/front.go",
+		"modules/patient/patient.go",
+		"modules/patient/back.go",
+		"modules/patient/front.go",
+		"pkg/router/router.go",
+		"web/server.go",
+		"web/client.go",
+		"web/public/index.html",
+	}
+
+	fset := token.NewFileSet()
+	for _, rel := range want {
+		path := filepath.Join(dir, rel)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("missing %s: %v", rel, err)
+			continue
+		}
+		if strings.Contains(string(content), "{{") {
+			t.Errorf("%s has unrendered template actions", rel)
+		}
+		if strings.HasSuffix(rel, ".go") {
+			if _, err := parser.ParseFile(fset, path, content, parser.ImportsOnly); err != nil {
+				t.Errorf("%s does not parse: %v", rel, err)
+			}
+		}
+	}
+
+	router, _ := os.ReadFile(filepath.Join(dir, "pkg/router/router.go"))
+	if !strings.Contains(string(router), `"example.com/myapp/modules"`) {
+		t.Error("module path not applied to imports")
+	}
+
+	if err := generate(dir, "example.com/myapp"); err == nil {
+		t.Error("expected error for non-empty directory")
+	}
+}
+
+// TestGenerateBuilds vets the generated server and WASM client in a module
+// using this checkout of crudp
+func TestGenerateBuilds(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go vet on a generated module")
+	}
+	goBin := filepath.Join(runtime.GOROOT(), "bin", "go")
+	if _, err := os.Stat(goBin); err != nil {
+		t.Skip("go command not found")
+	}
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "myapp")
+	if err := generate(dir, "example.com/myapp"); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	gomod, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gomod = append(gomod, "\nrequire github.com/cdvelop/crudp v0.0.0\n\nreplace github.com/cdvelop/crudp => "+root+"\n"...)
+	sum, _ := os.ReadFile(filepath.Join(root, "go.sum"))
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), gomod, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.sum"), sum, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, env := range [][]string{nil, {"GOOS=js", "GOARCH=wasm"}} {
+		cmd := exec.Command(goBin, "vet", "./...")
+		cmd.Dir = dir
+		cmd.Env = append(append(os.Environ(), "GOFLAGS=-mod=mod"), env...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("generated app %v failed: %v\n%s", env, err, out)
+		}
+	}
+}
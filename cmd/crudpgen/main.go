@@ -0,0 +1,376 @@
+// Command crudpgen generates CRUDP handler skeletons for a struct.
+//
+// Usage, next to the struct:
+//
+//	//go:generate go run github.com/cdvelop/crudp/cmd/crudpgen -type Contact
+//
+// Writes contact_crud.go with the HandlerName, Create, Read, Update and
+// Delete methods the type does not declare yet, plus a contactItems
+// wrapper converting the decoded packet data to []*Contact, and
+// contact_crud_test.go with a test stub per generated method. Existing
+// files are kept unless -force is set.
+//
+// With -client it also writes contact_client.go, a typed client for the
+// WASM side that hides action bytes and handler IDs:
+//
+//	contacts := contact.NewContactClient(cp)
+//	created, err := contacts.Create(ctx, &contact.Contact{Email: "a@b.c"})
+//
+// The client is regenerated on every run and must not be edited.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// crudMethods in generation order, selected by their initial in -actions
+var crudMethods = []string{"Create", "Read", "Update", "Delete"}
+
+// options of one run
+type options struct {
+	Dir     string
+	Type    string
+	Name    string // Handler name, default snake_case of Type
+	Actions string // Subset of "crud"
+	Tests   bool
+	Client  bool
+	Force   bool
+}
+
+// handlerFile holds the template variables
+type handlerFile struct {
+	Package     string
+	Type        string
+	Name        string
+	Items       string // Name of the typed decode wrapper
+	HandlerName bool   // Generate HandlerName
+	Wrapper     bool   // Generate the decode wrapper
+	Methods     []string
+	Actions     []string // Methods of the typed client
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.Dir, "dir", ".", "package directory")
+	flag.StringVar(&opts.Type, "type", "", "struct type to generate the handler for (required)")
+	flag.StringVar(&opts.Name, "name", "", "handler name (default snake_case of -type)")
+	flag.StringVar(&opts.Actions, "actions", "crud", "actions to generate: c, r, u, d")
+	flag.BoolVar(&opts.Tests, "tests", true, "generate test stubs")
+	flag.BoolVar(&opts.Client, "client", false, "generate a typed client")
+	flag.BoolVar(&opts.Force, "force", false, "overwrite existing generated files")
+	flag.Parse()
+
+	if opts.Type == "" {
+		fmt.Fprintln(os.Stderr, "usage: crudpgen -type <Struct> [-dir .] [-name handler] [-actions crud] [-tests=false] [-client] [-force]")
+		os.Exit(2)
+	}
+
+	files, err := generate(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "crudpgen:", err)
+		os.Exit(1)
+	}
+	for _, f := range files {
+		fmt.Println("wrote", f)
+	}
+}
+
+// generate writes the handler and test files of opts.Type, returning their paths
+func generate(opts options) ([]string, error) {
+	data, err := inspect(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	base := filepath.Join(opts.Dir, snakeCase(opts.Type)+"_crud")
+	var written []string
+
+	if data.HandlerName || data.Wrapper || len(data.Methods) > 0 {
+		if err := render(base+".go", handlerTemplate, data, opts.Force); err != nil {
+			return written, err
+		}
+		written = append(written, base+".go")
+	}
+
+	if opts.Tests && len(data.Methods) > 0 {
+		if err := render(base+"_test.go", testTemplate, data, opts.Force); err != nil {
+			return written, err
+		}
+		written = append(written, base+"_test.go")
+	}
+
+	if opts.Client {
+		path := filepath.Join(opts.Dir, snakeCase(opts.Type)+"_client.go")
+		if err := render(path, clientTemplate, data, true); err != nil {
+			return written, err
+		}
+		written = append(written, path)
+	}
+
+	if len(written) == 0 {
+		return nil, fmt.Errorf("%s already declares every requested method", opts.Type)
+	}
+	return written, nil
+}
+
+// inspect parses the package in opts.Dir and collects what to generate
+// Files written by a previous run are ignored with -force so it regenerates them.
+func inspect(opts options) (handlerFile, error) {
+	generated := snakeCase(opts.Type) + "_crud"
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, opts.Dir, func(fi fs.FileInfo) bool {
+		name := fi.Name()
+		return !strings.HasSuffix(name, "_test.go") && !(opts.Force && name == generated+".go")
+	}, 0)
+	if err != nil {
+		return handlerFile{}, err
+	}
+
+	data := handlerFile{
+		Type:  opts.Type,
+		Name:  opts.Name,
+		Items: lowerFirst(opts.Type) + "Items",
+	}
+	if data.Name == "" {
+		data.Name = snakeCase(opts.Type)
+	}
+
+	found := false
+	declared := map[string]bool{}
+	for name, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				switch d := decl.(type) {
+				case *ast.GenDecl:
+					for _, spec := range d.Specs {
+						ts, ok := spec.(*ast.TypeSpec)
+						if !ok || ts.Name.Name != opts.Type {
+							continue
+						}
+						if _, ok := ts.Type.(*ast.StructType); !ok {
+							return data, fmt.Errorf("%s is not a struct", opts.Type)
+						}
+						found = true
+						data.Package = name
+					}
+				case *ast.FuncDecl:
+					recv := receiverType(d)
+					if recv == opts.Type || (recv == "" && d.Name.Name == data.Items) {
+						declared[d.Name.Name] = true
+					}
+				}
+			}
+		}
+	}
+	if !found {
+		return data, fmt.Errorf("struct %s not found in %s", opts.Type, opts.Dir)
+	}
+
+	data.HandlerName = !declared["HandlerName"]
+	for _, m := range crudMethods {
+		if !strings.ContainsRune(opts.Actions, unicode.ToLower(rune(m[0]))) {
+			continue
+		}
+		data.Actions = append(data.Actions, m)
+		if !declared[m] {
+			data.Methods = append(data.Methods, m)
+		}
+	}
+	data.Wrapper = len(data.Methods) > 0 && !declared[data.Items]
+	return data, nil
+}
+
+// receiverType returns the receiver type name of a method, "" for functions
+func receiverType(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return ""
+	}
+	expr := fn.Recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return "-"
+}
+
+// render executes tmpl with data, formats it and writes it to path
+func render(path string, tmpl *template.Template, data handlerFile, force bool) error {
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("%s exists, use -force to overwrite", path)
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("format %s: %w", path, err)
+	}
+	return os.WriteFile(path, src, 0o644)
+}
+
+// snakeCase mirrors the handler naming convention: UserHandler -> user_handler
+func snakeCase(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
+
+var handlerTemplate = template.Must(template.New("handler").Parse(`// Code generated by crudpgen -type {{.Type}}; fill in the TODOs.
+// Rerunning with -force replaces this file.
+
+package {{.Package}}
+{{if .Methods}}
+import "context"
+{{end}}
+{{- if .HandlerName}}
+func (h *{{.Type}}) HandlerName() string { return "{{.Name}}" }
+{{end}}
+{{- range .Methods}}
+func (h *{{$.Type}}) {{.}}(ctx context.Context, data ...any) any {
+	items := {{$.Items}}(data)
+	for _, item := range items {
+		// TODO: {{.}} item
+		_ = item
+	}
+	return items
+}
+{{end}}
+{{- if .Wrapper}}
+// {{.Items}} returns the packet data decoded as *{{.Type}}, skipping other values
+func {{.Items}}(data []any) []*{{.Type}} {
+	items := make([]*{{.Type}}, 0, len(data))
+	for _, item := range data {
+		if v, ok := item.(*{{.Type}}); ok {
+			items = append(items, v)
+		}
+	}
+	return items
+}
+{{end}}`))
+
+var testTemplate = template.Must(template.New("test").Parse(`package {{.Package}}
+
+import (
+	"context"
+	"testing"
+)
+{{range .Methods}}
+func Test{{$.Type}}{{.}}(t *testing.T) {
+	h := &{{$.Type}}{}
+
+	got, ok := h.{{.}}(context.Background(), &{{$.Type}}{}).([]*{{$.Type}})
+	if !ok || len(got) != 1 {
+		t.Fatalf("{{.}} returned %#v", got)
+	}
+	// TODO: assert the {{.}} result
+}
+{{end}}`))
+
+var clientTemplate = template.Must(template.New("client").Funcs(template.FuncMap{
+	"action": func(method string) string { return strings.ToLower(method[:1]) },
+}).Parse(`// Code generated by crudpgen -type {{.Type}} -client. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+
+	"github.com/cdvelop/crudp"
+)
+
+// {{.Type}}Client calls the "{{.Name}}" handler with typed values
+type {{.Type}}Client struct {
+	crudp.HandlerClient
+}
+
+// New{{.Type}}Client returns a {{.Type}}Client sending through the broker of cp
+func New{{.Type}}Client(cp *crudp.CrudP) {{.Type}}Client {
+	return {{.Type}}Client{cp.Client("{{.Name}}")}
+}
+{{range .Actions}}
+{{- if eq . "Read"}}
+// Read returns the entities matching query, nil sends no item
+func (c {{$.Type}}Client) Read(ctx context.Context, query *{{$.Type}}, opts ...crudp.CallOption) ([]*{{$.Type}}, error) {
+	return c.call(ctx, 'r', query, opts)
+}
+{{else if eq . "Delete"}}
+// Delete removes item
+func (c {{$.Type}}Client) Delete(ctx context.Context, item *{{$.Type}}, opts ...crudp.CallOption) error {
+	_, err := c.call(ctx, 'd', item, opts)
+	return err
+}
+{{else}}
+// {{.}} sends item and returns the first entity of the result, nil if none
+func (c {{$.Type}}Client) {{.}}(ctx context.Context, item *{{$.Type}}, opts ...crudp.CallOption) (*{{$.Type}}, error) {
+	items, err := c.call(ctx, '{{action .}}', item, opts)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+{{end}}
+{{- end}}
+// call sends one packet and decodes every result item
+// Handlers returning a slice send it as a single item, which is flattened.
+func (c {{.Type}}Client) call(ctx context.Context, action byte, item *{{.Type}}, opts []crudp.CallOption) ([]*{{.Type}}, error) {
+	var data any
+	if item != nil {
+		data = item
+	}
+	pr, err := c.Do(ctx, action, data, opts...)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*{{.Type}}, 0, len(pr.Data))
+	for i := range pr.Data {
+		var list []*{{.Type}}
+		if err := c.DecodeData(&pr, i, &list); err == nil {
+			items = append(items, list...)
+			continue
+		}
+		one := &{{.Type}}{}
+		if err := c.DecodeData(&pr, i, one); err != nil {
+			return nil, err
+		}
+		items = append(items, one)
+	}
+	return items, nil
+}
+`))
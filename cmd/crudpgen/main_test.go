@@ -0,0 +1,230 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const contactSrc = `package contact
+
+type Contact struct {
+	ID    int
+	Email string
+}
+
+func (c *Contact) Read(ctx any, data ...any) any { return nil }
+`
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "contact.go"), []byte(contactSrc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := generate(options{Dir: dir, Type: "Contact", Actions: "crud", Tests: true})
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("wrote %v, want handler and test files", files)
+	}
+
+	fset := token.NewFileSet()
+	for _, f := range files {
+		if _, err := parser.ParseFile(fset, f, nil, 0); err != nil {
+			t.Errorf("%s does not parse: %v", f, err)
+		}
+	}
+
+	src, _ := os.ReadFile(filepath.Join(dir, "contact_crud.go"))
+	code := string(src)
+	for _, want := range []string{
+		`return "contact"`,
+		"func (h *Contact) Create(",
+		"func (h *Contact) Update(",
+		"func (h *Contact) Delete(",
+		"func contactItems(data []any) []*Contact",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("contact_crud.go missing %q", want)
+		}
+	}
+	if strings.Contains(code, "func (h *Contact) Read(") {
+		t.Error("Read is already declared and must not be generated")
+	}
+
+	tests, _ := os.ReadFile(filepath.Join(dir, "contact_crud_test.go"))
+	if !strings.Contains(string(tests), "func TestContactCreate(") || strings.Contains(string(tests), "TestContactRead") {
+		t.Errorf("unexpected test stubs:\n%s", tests)
+	}
+
+	if _, err := generate(options{Dir: dir, Type: "Contact", Actions: "crud", Tests: true}); err == nil {
+		t.Error("expected error for existing files without -force")
+	}
+	if _, err := generate(options{Dir: dir, Type: "Contact", Actions: "c", Tests: true, Force: true}); err != nil {
+		t.Fatalf("-force regenerate failed: %v", err)
+	}
+	src, _ = os.ReadFile(filepath.Join(dir, "contact_crud.go"))
+	if strings.Contains(string(src), "Update(") {
+		t.Error("-force did not replace the generated file")
+	}
+}
+
+func TestGenerateClient(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "contact.go"), []byte(contactSrc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := options{Dir: dir, Type: "Contact", Actions: "crd", Client: true}
+	if _, err := generate(opts); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	// The skeletons exist now, a second run only rewrites the client
+	files, err := generate(opts)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("regenerate client: %v, %v", files, err)
+	}
+
+	src, err := os.ReadFile(filepath.Join(dir, "contact_client.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "contact_client.go", src, 0); err != nil {
+		t.Fatalf("client does not parse: %v", err)
+	}
+	code := string(src)
+	for _, want := range []string{
+		"DO NOT EDIT",
+		"func NewContactClient(cp *crudp.CrudP) ContactClient",
+		`cp.Client("contact")`,
+		"Create(ctx context.Context, item *Contact, opts ...crudp.CallOption) (*Contact, error)",
+		"Read(ctx context.Context, query *Contact, opts ...crudp.CallOption) ([]*Contact, error)",
+		"Delete(ctx context.Context, item *Contact, opts ...crudp.CallOption) error",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("contact_client.go missing %q", want)
+		}
+	}
+	if strings.Contains(code, "Update(") {
+		t.Error("Update is not in -actions")
+	}
+}
+
+const listSrc = `package contact
+
+import "context"
+
+type Contact struct {
+	ID    int
+	Email string
+}
+
+func (c *Contact) Read(ctx context.Context, data ...any) any {
+	return []*Contact{{ID: 1, Email: "a@x"}, {ID: 2, Email: "b@x"}}
+}
+`
+
+const clientTestSrc = `package contact
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+func TestContactClient(t *testing.T) {
+	server := crudp.New(crudp.WithHandlers(&Contact{}))
+	cfg := crudp.DefaultConfig()
+	cfg.BatchWindow = 5
+	contacts := NewContactClient(crudp.NewLoopback(server, cfg, crudp.WithHandlers(&Contact{})))
+
+	list, err := contacts.Read(context.Background(), nil)
+	if err != nil || len(list) != 2 || list[1].Email != "b@x" {
+		t.Fatalf("Read: %v, %+v", err, list)
+	}
+	created, err := contacts.Create(context.Background(), &Contact{Email: "c@x"})
+	if err != nil || created == nil || created.Email != "c@x" {
+		t.Fatalf("Create: %v, %+v", err, created)
+	}
+}
+`
+
+// TestGenerateClientRuns builds the generated client in a module using this
+// checkout of crudp and runs it against a loopback server
+func TestGenerateClientRuns(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go test on a generated module")
+	}
+	goBin := filepath.Join(runtime.GOROOT(), "bin", "go")
+	if _, err := os.Stat(goBin); err != nil {
+		t.Skip("go command not found")
+	}
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	goVersion := "go 1.25"
+	if mod, err := os.ReadFile(filepath.Join(root, "go.mod")); err == nil {
+		for _, line := range strings.Split(string(mod), "\n") {
+			if strings.HasPrefix(line, "go ") {
+				goVersion = line
+			}
+		}
+	}
+	gomod := "module example.com/contact\n\n" + goVersion + "\n\nrequire github.com/cdvelop/crudp v0.0.0\n\nreplace github.com/cdvelop/crudp => " + root + "\n"
+	sum, _ := os.ReadFile(filepath.Join(root, "go.sum"))
+	for name, src := range map[string]string{
+		"go.mod":              gomod,
+		"go.sum":              string(sum),
+		"contact.go":          listSrc,
+		"contact_run_test.go": clientTestSrc,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := generate(options{Dir: dir, Type: "Contact", Actions: "cr", Client: true}); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+
+	cmd := exec.Command(goBin, "test", "-count=1", "./...")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("generated client failed: %v\n%s", err, out)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "x.go"), []byte("package x\n\ntype Alias int\n"), 0o644)
+
+	if _, err := generate(options{Dir: dir, Type: "Missing", Actions: "crud"}); err == nil {
+		t.Error("expected error for a missing type")
+	}
+	if _, err := generate(options{Dir: dir, Type: "Alias", Actions: "crud"}); err == nil {
+		t.Error("expected error for a non-struct type")
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for in, want := range map[string]string{
+		"User":        "user",
+		"UserHandler": "user_handler",
+		"HTTPRoute":   "http_route",
+	} {
+		if got := snakeCase(in); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 )
 
 // tinyjsonCodec adapts TinyJSON to the Codec interface
+// Values holding types registered with RegisterTypeAdapter go through a
+// generic tree, see AdaptCodec.
 type tinyjsonCodec struct {
 	tj *tinyjson.TinyJSON
 }
@@ -18,7 +20,7 @@ func getDefaultCodec() Codec {
 }
 
 func (c *tinyjsonCodec) Encode(data any) ([]byte, error) {
-	return c.tj.Encode(data)
+	return encodeAdapted(tinyjsonRaw{c.tj}, data)
 }
 
 func (c *tinyjsonCodec) Decode(data []byte, v any) (err error) {
@@ -27,5 +29,14 @@ func (c *tinyjsonCodec) Decode(data []byte, v any) (err error) {
 			err = Errf("panic in decode: %v", r)
 		}
 	}()
-	return c.tj.Decode(data, v)
+	return decodeAdapted(tinyjsonRaw{c.tj}, data, v)
 }
+
+// tinyjsonRaw is TinyJSON without type adapters
+type tinyjsonRaw struct {
+	tj *tinyjson.TinyJSON
+}
+
+func (r tinyjsonRaw) Encode(data any) ([]byte, error) { return r.tj.Encode(data) }
+
+func (r tinyjsonRaw) Decode(data []byte, v any) error { return r.tj.Decode(data, v) }
@@ -0,0 +1,104 @@
+package crudp
+
+import "reflect"
+
+// Content types with a built-in codec
+const (
+	ContentTypeJSON  = "application/json"
+	ContentTypeFrame = "application/x-crudp-frame" // Binary framing over JSON items
+)
+
+// codecEntry maps a content type to a codec
+type codecEntry struct {
+	contentType string
+	codec       Codec
+}
+
+// RegisterCodec makes codec available to clients sending contentType
+// (e.g. "application/x-tinybin", "application/msgpack"). BuildRouter picks the
+// codec from the request Content-Type and responds in kind; unknown types use
+// the default codec. Registering an existing content type replaces its codec.
+func (cp *CrudP) RegisterCodec(contentType string, codec Codec) {
+	if contentType == "" || codec == nil {
+		return
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	codecs := make([]codecEntry, 0, len(cp.codecs)+1)
+	for _, e := range cp.codecs {
+		if e.contentType != contentType {
+			codecs = append(codecs, e)
+		}
+	}
+	cp.codecs = append(codecs, codecEntry{contentType: contentType, codec: codec})
+}
+
+// CodecFor returns the codec registered for a Content-Type header value
+// Parameters such as "; charset=utf-8" are ignored.
+func (cp *CrudP) CodecFor(contentType string) (Codec, bool) {
+	contentType = mediaType(contentType)
+
+	cp.mu.RLock()
+	codecs := cp.codecs
+	cp.mu.RUnlock()
+
+	for _, e := range codecs {
+		if e.contentType == contentType {
+			return e.codec, true
+		}
+	}
+	return nil, false
+}
+
+// codecContentType returns the content type of the instance codec: the
+// built-in type of the default codecs, else the type a codec of the same Go
+// type is registered under, "application/octet-stream" if none
+func (cp *CrudP) codecContentType() string {
+	switch c := cp.codec.(type) {
+	case *tinyjsonCodec:
+		return ContentTypeJSON
+	case *frameCodec:
+		if _, ok := c.inner.(*tinyjsonCodec); ok {
+			return ContentTypeFrame
+		}
+		return "application/octet-stream"
+	}
+
+	cp.mu.RLock()
+	codecs := cp.codecs
+	cp.mu.RUnlock()
+	t := reflect.TypeOf(cp.codec)
+	for _, e := range codecs {
+		if reflect.TypeOf(e.codec) == t {
+			return e.contentType
+		}
+	}
+	return "application/octet-stream"
+}
+
+// registerDefaultCodecs adds the built-in content types
+func (cp *CrudP) registerDefaultCodecs() {
+	json := getDefaultCodec()
+	cp.RegisterCodec(ContentTypeJSON, json)
+	cp.RegisterCodec(ContentTypeFrame, NewFrameCodec(json))
+}
+
+// mediaType strips parameters and surrounding spaces from a Content-Type value
+func mediaType(contentType string) string {
+	for i := 0; i < len(contentType); i++ {
+		if contentType[i] == ';' {
+			contentType = contentType[:i]
+			break
+		}
+	}
+	start, end := 0, len(contentType)
+	for start < end && contentType[start] == ' ' {
+		start++
+	}
+	for end > start && contentType[end-1] == ' ' {
+		end--
+	}
+	return contentType[start:end]
+}
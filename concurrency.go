@@ -0,0 +1,110 @@
+package crudp
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// VersionedEntity is implemented by entities using optimistic concurrency
+// The version sent by the client is the one it last read (the expected version).
+type VersionedEntity interface {
+	GetVersion() uint64
+	SetVersion(v uint64)
+}
+
+// VersionLoader returns the stored version of an entity (optional, server side)
+// When a handler implements it, Update and Patch packets carrying a
+// VersionedEntity are rejected with a *ConflictError if the versions differ.
+// On match the entity version is incremented before the handler runs.
+// The check is not atomic with the handler's write: two updates may both
+// pass it. Write with a condition on the version (e.g. UPDATE ... WHERE
+// version = ?, as store/sql does) and return a *ConflictError when no row
+// matched to rule that out.
+type VersionLoader interface {
+	LoadVersion(ctx context.Context, entity any) (uint64, error)
+}
+
+// conflictPrefix starts the message of every ConflictError
+const conflictPrefix = "version conflict"
+
+// ConflictError reports a stale update
+type ConflictError struct {
+	Key      string // EntityKey of the stale entity, "" if none
+	Expected uint64
+	Current  uint64
+}
+
+func (e *ConflictError) Error() string {
+	if e.Key != "" {
+		return Fmt("%s on %s: expected %d, current %d", conflictPrefix, e.Key, e.Expected, e.Current)
+	}
+	return Fmt("%s: expected %d, current %d", conflictPrefix, e.Expected, e.Current)
+}
+
+// IsConflict reports whether a result was rejected by a version conflict
+func IsConflict(pr PacketResult) bool {
+	return pr.MessageType == uint8(Msg.Error) && pr.Code == CodeConflict
+}
+
+// conflictCode sets CodeConflict on pr when err is a *ConflictError, found
+// by checkVersions or returned by the handler's own conditional write
+func conflictCode(pr *PacketResult, err error) {
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		pr.Code = CodeConflict
+	}
+}
+
+// Refetch queues a Read for the entities of a conflicting result, keeping its ReqID
+// The fresh copy arrives through OnResult so the client can merge and retry.
+func (cp *CrudP) Refetch(pr PacketResult) error {
+	if !IsConflict(pr) {
+		return Err(Fmt("result %s is not a version conflict", pr.ReqID))
+	}
+
+	data := pr.Data
+	if pr.Action == ActionPatch && len(data) > 0 {
+		data = data[1:] // Drop the field mask
+	}
+	if len(data) == 0 {
+		return Err(Fmt("result %s has no entity to refetch", pr.ReqID))
+	}
+
+	cp.broker.enqueue(Packet{
+		Action:    'r',
+		HandlerID: pr.HandlerID,
+		Version:   pr.Version,
+		ReqID:     pr.ReqID,
+	}, data...)
+	return nil
+}
+
+// checkVersions compares the expected version of each entity with the stored one
+// See VersionLoader: the handler's write must still be conditional.
+func checkVersions(ctx context.Context, handler *actionHandler, action byte, data []any) error {
+	if action != 'u' && action != ActionPatch {
+		return nil
+	}
+	loader, ok := handler.handler.(VersionLoader)
+	if !ok {
+		return nil
+	}
+
+	for _, item := range data {
+		entity, ok := item.(VersionedEntity)
+		if !ok {
+			continue
+		}
+		current, err := loader.LoadVersion(ctx, item)
+		if err != nil {
+			return err
+		}
+		if expected := entity.GetVersion(); expected != current {
+			return &ConflictError{Key: EntityKey(item), Expected: expected, Current: current}
+		}
+		entity.SetVersion(current + 1)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Document is a versioned entity backed by a single stored copy
+type Document struct {
+	ID   int
+	Body string
+	Rev  uint64
+
+	stored *Document
+}
+
+func (d *Document) GetVersion() uint64  { return d.Rev }
+func (d *Document) SetVersion(v uint64) { d.Rev = v }
+
+func (d *Document) LoadVersion(ctx context.Context, entity any) (uint64, error) {
+	return d.stored.Rev, nil
+}
+
+func (d *Document) Update(ctx context.Context, data ...any) any {
+	in := data[0].(*Document)
+	d.stored.Body, d.stored.Rev = in.Body, in.Rev
+	return "saved"
+}
+
+func (d *Document) Read(ctx context.Context, data ...any) any {
+	return *d.stored
+}
+
+// conditionalDocument checks the version in its own write, like UPDATE ... WHERE rev = ?
+type conditionalDocument struct {
+	ID  int
+	Rev uint64
+}
+
+func (d *conditionalDocument) Update(ctx context.Context, data ...any) any {
+	in := data[0].(*conditionalDocument)
+	return staleWrite{&crudp.ConflictError{Key: "1", Expected: in.Rev, Current: 3}}
+}
+
+// staleWrite reports the conflict as the handler's error
+type staleWrite struct{ err error }
+
+func (s staleWrite) Response() (any, []string, error) { return nil, nil, s.err }
+
+func OptimisticConcurrencyShared(t *testing.T) {
+	t.Run("Conflict Then Refetch And Retry", func(t *testing.T) {
+		stored := &Document{ID: 1, Body: "server edit", Rev: 3}
+		server := crudp.NewDefault()
+		server.RegisterHandler(&Document{stored: stored})
+
+		client := crudp.NewLoopback(server, crudp.WithHandlers(&Document{}))
+		var results []crudp.PacketResult
+		client.OnResult(func(pr crudp.PacketResult) {
+			results = append(results, pr)
+		})
+
+		// Stale write based on revision 2
+		client.EnqueuePacket(0, 'u', "doc-1", &Document{ID: 1, Body: "client edit", Rev: 2})
+		client.Broker().FlushNow()
+
+		if len(results) != 1 || !crudp.IsConflict(results[0]) || results[0].Code != crudp.CodeConflict {
+			t.Fatalf("expected conflict result, got %+v", results)
+		}
+		if stored.Body != "server edit" {
+			t.Errorf("stale update must not be applied, got %q", stored.Body)
+		}
+
+		if err := client.Refetch(results[0]); err != nil {
+			t.Fatalf("Refetch error: %v", err)
+		}
+		client.Broker().FlushNow()
+
+		if len(results) != 2 || results[1].Action != 'r' || results[1].ReqID != "doc-1" {
+			t.Fatalf("expected refetch result for doc-1, got %+v", results)
+		}
+		var fresh Document
+		if err := client.Codec().Decode(results[1].Data[0], &fresh); err != nil {
+			t.Fatalf("decode fresh copy: %v", err)
+		}
+		if fresh.Rev != 3 {
+			t.Errorf("expected fresh revision 3, got %d", fresh.Rev)
+		}
+
+		// Merge and retry with the fresh revision
+		fresh.Body = "merged edit"
+		client.EnqueuePacket(0, 'u', "doc-2", &fresh)
+		client.Broker().FlushNow()
+
+		if len(results) != 3 || results[2].MessageType != uint8(Msg.Success) {
+			t.Fatalf("expected successful retry, got %+v", results[len(results)-1])
+		}
+		if stored.Body != "merged edit" || stored.Rev != 4 {
+			t.Errorf("expected merged edit at revision 4, got %+v", *stored)
+		}
+	})
+
+	t.Run("Conflict Returned By Handler", func(t *testing.T) {
+		server := crudp.NewDefault()
+		server.RegisterHandler(&conditionalDocument{})
+
+		client := crudp.NewLoopback(server, crudp.WithHandlers(&conditionalDocument{}))
+		var result crudp.PacketResult
+		client.OnResult(func(pr crudp.PacketResult) { result = pr })
+		client.EnqueuePacket(0, 'u', "doc-1", &conditionalDocument{ID: 1, Rev: 2})
+		client.Broker().FlushNow()
+
+		if !crudp.IsConflict(result) || result.Code != crudp.CodeConflict {
+			t.Errorf("expected the handler's conflict to be reported, got %+v", result)
+		}
+	})
+
+	t.Run("Conflict Is Told By Code", func(t *testing.T) {
+		pr := crudp.PacketResult{MessageType: uint8(Msg.Error), Message: "version conflict: expected 1, current 2"}
+		if crudp.IsConflict(pr) {
+			t.Error("a message alone must not make a conflict")
+		}
+	})
+
+	t.Run("Refetch Rejects Non Conflicts", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		if err := cp.Refetch(crudp.PacketResult{MessageType: uint8(Msg.Success)}); err == nil {
+			t.Error("expected error for a non-conflict result")
+		}
+	})
+}
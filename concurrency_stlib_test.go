@@ -0,0 +1,9 @@
+//go:build !wasm
+
+package crudp_test
+
+import "testing"
+
+func TestOptimisticConcurrency_Stdlib(t *testing.T) {
+	OptimisticConcurrencyShared(t)
+}
@@ -1,6 +1,10 @@
 package crudp
 
-import "context"
+import (
+	"context"
+
+	. "github.com/cdvelop/tinystring"
+)
 
 // UserProvider provides user identification for SSE routing
 type UserProvider interface {
@@ -8,12 +12,13 @@ type UserProvider interface {
 }
 
 // Config contains CrudP configuration
-// NOTE: Logger is NOT here - configured via SetLogger()
+// NOTE: Logger is NOT here - configured via SetLogger() or SetLeveledLogger()
 type Config struct {
 	// Codec for serialization. Default: tinyjson.New()
 	Codec Codec
 
-	// UseBinary uses binary encoding. Default: false (JSON)
+	// UseBinary frames packets in binary, items keep using Codec (see NewFrameCodec).
+	// Default: false (JSON)
 	UseBinary bool
 
 	// APIEndpoint for batch requests. Default: "/api"
@@ -22,38 +27,283 @@ type Config struct {
 	// SSEEndpoint for event stream. Default: "/events"
 	SSEEndpoint string
 
+	// UploadEndpoint receives files for FileStore. Default: "/upload"
+	UploadEndpoint string
+
+	// FileStore keeps uploaded files; BuildRouter only serves UploadEndpoint
+	// when set (server only). Default: nil
+	FileStore FileStore
+
+	// MaxUploadBytes bounds each uploaded file (server only). Default: 0 = 32 MiB
+	MaxUploadBytes int64
+
+	// ExportEndpoint prefixes the export routes of Exporter handlers, served
+	// at ExportEndpoint + "/{handler}". Default: "/export"
+	ExportEndpoint string
+
+	// ImportEndpoint prefixes the import routes of handlers with Create,
+	// served at ImportEndpoint + "/{handler}" (server only). Default: "/import", "" = disabled
+	ImportEndpoint string
+
+	// ImportChunk is the number of rows per Create call of an import (server only). Default: 0 = 100
+	ImportChunk int
+
+	// SSEHeartbeat is the interval in milliseconds between keep-alive comments
+	// on the SSE stream (server only). Default: 15000, 0 = disabled
+	SSEHeartbeat int
+
+	// SubscriptionAuthorizer denies channel patterns a caller may not see on the
+	// SSE stream or ListenTo subscriptions (server only). Default: nil (allow all)
+	SubscriptionAuthorizer SubscriptionAuthorizer
+
+	// PubSub relays broadcasts to the other server instances behind a load
+	// balancer, e.g. pubsub/redis or pubsub/nats (server only). Default: nil
+	PubSub PubSub
+
+	// SSEWriteTimeout in milliseconds: SSE subscribers whose writes block longer
+	// are disconnected (server only). Default: 10000, 0 = no deadline
+	SSEWriteTimeout int
+
 	// BatchWindow in milliseconds. Default: 50
 	BatchWindow int
 
-	// MaxRetries for failed requests. Default: 3
+	// FlushStrategy decides when the broker flushes (client only). Default: nil = Debounce(BatchWindow)
+	FlushStrategy FlushStrategy
+
+	// MaxRetries re-sends of a packet after failed deliveries or throttled results (client only). Default: 3
 	MaxRetries int
 
-	// RetryInterval base in ms. Default: 1000
+	// RetryInterval base in ms, doubled per attempt (client only). Default: 1000
 	RetryInterval int
 
+	// ReqIDs generates the ReqID of packets sent without one (client only).
+	// Default: nil = MonotonicReqIDs(""), numbered per instance
+	ReqIDs ReqIDProvider
+
+	// PacketTTL in ms gives each enqueued packet a Deadline, after which the
+	// server skips it with Code CodeExpired (client only). Default: 0 (none)
+	PacketTTL int
+
 	// Port for HTTP server (server only). Default: ":6060"
 	Port string
 
+	// TLSCert and TLSKey are the PEM files of the certificate ListenAndServe
+	// serves HTTPS with (server only). Default: "" (HTTP)
+	TLSCert string
+	TLSKey  string
+
+	// Autocert provides the certificates instead of TLSCert/TLSKey: any value
+	// with TLSConfig() *tls.Config, e.g. *autocert.Manager (server only)
+	Autocert any
+
+	// ReadTimeout, WriteTimeout and IdleTimeout of the server in ms (server
+	// only). SSE streams move their write deadline per event, see
+	// SSEWriteTimeout. Default: 0 (none)
+	ReadTimeout  int
+	WriteTimeout int
+	IdleTimeout  int
+
+	// HTTP2 serves HTTP/2 without TLS too (h2c), e.g. behind a proxy ending
+	// TLS; HTTPS negotiates it already (server only). Default: false
+	HTTP2 bool
+
 	// UserProvider for SSE routing (server only). Default: nil
 	UserProvider UserProvider
 
+	// Presence tracks the UserProvider users with an open SSE or gRPC stream and
+	// broadcasts join/leave events on PresenceChannel (server only). Default: false
+	Presence bool
+
 	// ServerURL base (client only). Default: "" (same origin)
 	ServerURL string
 
+	// Profile names the protocol of an instance when one process serves
+	// several, e.g. "admin" and "public" (see ProfileConfig): instances
+	// ignore the PubSub messages of other profiles. Default: ""
+	Profile string
+
+	// BasePath prefixes every endpoint when a proxy serves the app on a
+	// sub-path without stripping it, e.g. "/app": BuildRouter strips it and
+	// clients add it to their URLs. Default: "" (root)
+	BasePath string
+
+	// TrustedProxies are the IPs or CIDRs of the proxies in front of the
+	// server, e.g. "10.0.0.0/8": their X-Forwarded-For and X-Forwarded-Proto
+	// give the client IP and scheme (server only). Default: nil (ignored)
+	TrustedProxies []string
+
 	// OnMessage callback for notifications (client only)
 	OnMessage func(msgType uint8, message string)
+
+	// MessageKeys sends catalog messages as PacketResult.MessageKey and
+	// MessageArgs without the formatted Message; clients render them from the
+	// shared catalog, see RegisterMessages (server only). Default: false
+	MessageKeys bool
+
+	// Locale renders results received with only a MessageKey in this
+	// language, e.g. "es" (client only). Default: "" (English)
+	Locale string
+
+	// CORS for browser clients on another origin (server only). Default: nil (disabled)
+	CORS *CORSConfig
+
+	// RateLimiter checked before each packet reaches its handler. Default: nil
+	// e.g. crudp.NewTokenBucket(10, 20) keyed by UserProvider identity or remote IP
+	RateLimiter RateLimiter
+
+	// ChangeLogSize is the number of changes kept for delta sync ('y' action,
+	// server only). Default: 0 (disabled)
+	ChangeLogSize int
+
+	// EntityCache keeps decoded entities from results, see Cache() (client only).
+	// Default: false
+	EntityCache bool
+
+	// Recorder receives every raw batch and response handled by ProcessBatch,
+	// e.g. crudp.NewRecorder(file) to capture traffic for Replay. Default: nil
+	Recorder Recorder
+
+	// Auditor receives a record after each processed packet (server only),
+	// e.g. crudp.NewAuditLog(file) for a tamper-evident trail. Default: nil
+	Auditor Auditor
+
+	// SigningKeys verifies HMAC batch signatures before decoding (server only),
+	// e.g. crudp.StaticKey(secret). Tampered batches get 401. Default: nil
+	SigningKeys SigningKeys
+
+	// RequireSignature rejects unsigned batches when SigningKeys is set.
+	// Default: false (unsigned batches use the other authentication)
+	RequireSignature bool
+
+	// Redactor masks fields tagged `crudp:"redact"` in broadcasts and logs,
+	// e.g. to publish them on trusted channels. Default: nil (zero value)
+	Redactor Redactor
+
+	// ActionPolicy disables handler actions (server only), e.g.
+	// {"patient": "d"} rejects deletes with an ActionDisabledError result.
+	// Default: nil (all actions allowed)
+	ActionPolicy ActionPolicy
+
+	// ReadOnly rejects 'c', 'u', 'd' and patch packets (server only), for read
+	// replicas running the same binary. Default: false
+	ReadOnly bool
+
+	// PrimaryURL is sent as PacketResult.Redirect by a ReadOnly replica, e.g.
+	// "https://primary.example.com". Default: ""
+	PrimaryURL string
+
+	// Consistency issues WriteTokens after mutations and waits for the
+	// ReadAfter token of Reads, for handlers without their own
+	// ConsistencyTokens (server only). Default: nil
+	Consistency ConsistencyTokens
+
+	// CircuitBreaker tracks handler latency (see HandlerStats) and fast-fails
+	// handlers after consecutive timeouts or errors (server only). Default: nil
+	CircuitBreaker *CircuitBreakerConfig
+
+	// ReadCache caches Read results by handler name with a TTL in ms, e.g.
+	// {"product": 30000}; mutations of the handler drop them (server only).
+	// Default: nil (no caching)
+	ReadCache ReadCacheTTL
+
+	// MaxResponseBytes bounds each encoded batch response (server only). Longer
+	// responses are cut between results and completed through
+	// BatchResponse.Continuation, protecting memory-constrained clients.
+	// Default: 0 (no limit)
+	MaxResponseBytes int
+
+	// JobWorkers run the packets sent WithDeferred in the background and send
+	// their results on the JobChannel of the user (server only).
+	// Default: 0 (deferred packets run inline)
+	JobWorkers int
+
+	// Schedules are recurring packets processed through ProcessBatch, see
+	// Schedule (server only). Default: nil
+	Schedules []Schedule
+
+	// HandlerTimeout in milliseconds bounds each handler call (server only);
+	// late calls get a result with Code CodeTimeout. Default: 0 (none)
+	HandlerTimeout int
+
+	// Outbox holds the broadcasts of a packet until it succeeds, see DeliverOutbox (server only). Default: nil
+	Outbox Outbox
+
+	// Transactor wraps mutating packets and Outbox.Save in a transaction (server only). Default: nil
+	Transactor Transactor
+
+	// EventSink receives a MutationEvent for every successful 'c', 'u', 'd' and 'p' packet (server only). Default: nil
+	EventSink EventSink
+
+	// Sagas makes a failed 'c', 'u', 'd' or 'p' packet skip the rest of its batch and undo the
+	// earlier ones whose handler is a Compensator, in reverse order (server only). Default: false
+	Sagas bool
+
+	// HandlerIDs pins handler names to IDs (index = ID, "" = unused), e.g. the
+	// persisted output of CrudP.HandlerIDs, so RegisterHandler and AddHandler
+	// do not depend on registration order. Names missing from it get the IDs
+	// after it. Default: nil (IDs follow registration order)
+	HandlerIDs []string
+}
+
+// CORSConfig configures cross-origin access to the API and SSE endpoints
+type CORSConfig struct {
+	// AllowedOrigins e.g. "https://app.example.com". "*" allows any origin,
+	// and is rejected by New together with AllowCredentials
+	AllowedOrigins []string
+
+	// AllowedMethods. Default: POST, GET, OPTIONS
+	AllowedMethods []string
+
+	// AllowedHeaders accepted in requests. Default: Content-Type
+	AllowedHeaders []string
+
+	// AllowCredentials allows cookies/auth headers for the origins listed in
+	// AllowedOrigins (origin is echoed, never "*")
+	AllowCredentials bool
+
+	// MaxAge in seconds for caching preflight responses. Default: 0 (not sent)
+	MaxAge int
+}
+
+// check rejects "*" with AllowCredentials: any site could then send
+// requests carrying the user's cookies
+func (c *CORSConfig) check() error {
+	if c == nil || !c.AllowCredentials {
+		return nil
+	}
+	for _, o := range c.AllowedOrigins {
+		if o == "*" {
+			return Err("cors: origin \"*\" cannot be used with AllowCredentials, list the origins")
+		}
+	}
+	return nil
+}
+
+// ProfileConfig returns the DefaultConfig of the profile name, served
+// under "/" + name (e.g. /admin/api, /admin/events) next to the instances
+// of other profiles, see Mount
+func ProfileConfig(name string) *Config {
+	cfg := DefaultConfig()
+	cfg.Profile = name
+	cfg.BasePath = "/" + name
+	return cfg
 }
 
 // DefaultConfig returns configuration with default values
 func DefaultConfig() *Config {
 	return &Config{
-		Codec:         nil, // Will assign tinyjson in New()
-		UseBinary:     false,
-		APIEndpoint:   "/api",
-		SSEEndpoint:   "/events",
-		BatchWindow:   50,
-		MaxRetries:    3,
-		RetryInterval: 1000,
-		Port:          ":6060",
+		Codec:           nil, // Will assign tinyjson in New()
+		UseBinary:       false,
+		APIEndpoint:     "/api",
+		SSEEndpoint:     "/events",
+		UploadEndpoint:  "/upload",
+		ExportEndpoint:  "/export",
+		ImportEndpoint:  "/import",
+		SSEHeartbeat:    15000,
+		SSEWriteTimeout: 10000,
+		BatchWindow:     50,
+		MaxRetries:      3,
+		RetryInterval:   1000,
+		Port:            ":6060",
 	}
 }
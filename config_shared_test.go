@@ -69,6 +69,63 @@ func NewWithConfigShared(t *testing.T) {
 	})
 }
 
+func FunctionalOptionsShared(t *testing.T) {
+	t.Run("WithConfig And Logger", func(t *testing.T) {
+		var logged []any
+		cp := crudp.New(
+			crudp.WithConfig(&crudp.Config{APIEndpoint: "/opt-api"}),
+			crudp.WithLogger(func(args ...any) {
+				logged = append(logged, args...)
+			}),
+			crudp.WithHandlers(&testLogHandler{}),
+		)
+
+		if cp.Err() != nil {
+			t.Fatalf("unexpected init error: %v", cp.Err())
+		}
+		if cp.Config().APIEndpoint != "/opt-api" {
+			t.Error("WithConfig not applied")
+		}
+		if cp.GetHandlerName(0) != "test_log_handler" {
+			t.Errorf("expected handler registered, got '%s'", cp.GetHandlerName(0))
+		}
+		if len(logged) == 0 {
+			t.Error("expected WithLogger to receive registration logs")
+		}
+	})
+
+	t.Run("WithCodec Overrides Config", func(t *testing.T) {
+		codec := &mockCodec{}
+		cp := crudp.New(crudp.WithCodec(codec))
+
+		if cp.Codec() != codec {
+			t.Error("WithCodec not applied")
+		}
+		if cp.Config().APIEndpoint != "/api" {
+			t.Error("expected default config")
+		}
+	})
+
+	t.Run("WithHandlers Error", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(nil))
+
+		if cp.Err() == nil {
+			t.Error("expected init error for nil handler")
+		}
+	})
+
+	t.Run("LoadHandlers Shim", func(t *testing.T) {
+		cp := crudp.New(crudp.DefaultConfig())
+
+		if err := cp.LoadHandlers(&testLogHandler{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cp.GetHandlerName(0) != "test_log_handler" {
+			t.Error("LoadHandlers should register like RegisterHandler")
+		}
+	})
+}
+
 func LoggerConfigShared(t *testing.T) {
 	t.Run("Logger Disabled By Default", func(t *testing.T) {
 		cp := crudp.NewDefault()
@@ -109,8 +166,46 @@ func LoggerConfigShared(t *testing.T) {
 		// Should not cause panic
 		cp.DisableLogger()
 	})
+
+	t.Run("SetLeveledLogger Fields", func(t *testing.T) {
+		logger := &levelLogger{}
+		cp := crudp.New(crudp.WithLeveledLogger(logger), crudp.WithHandlers(&testLogHandler{}))
+
+		if len(logger.entries["info"]) == 0 {
+			t.Error("expected registration at info level")
+		}
+
+		// testLogHandler has no Read
+		processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 0})
+
+		errs := logger.entries["error"]
+		if len(errs) != 1 {
+			t.Fatalf("expected 1 error entry, got %v", errs)
+		}
+		kv := errs[0][1:]
+		if len(kv) < 4 || kv[0] != "handler" || kv[1] != "test_log_handler" || kv[2] != "action" || kv[3] != "r" {
+			t.Errorf("expected handler and action fields, got %v", kv)
+		}
+	})
 }
 
+// levelLogger records entries (msg followed by fields) per level
+type levelLogger struct {
+	entries map[string][][]any
+}
+
+func (l *levelLogger) add(level, msg string, kv []any) {
+	if l.entries == nil {
+		l.entries = map[string][][]any{}
+	}
+	l.entries[level] = append(l.entries[level], append([]any{msg}, kv...))
+}
+
+func (l *levelLogger) Debug(msg string, kv ...any) { l.add("debug", msg, kv) }
+func (l *levelLogger) Info(msg string, kv ...any)  { l.add("info", msg, kv) }
+func (l *levelLogger) Warn(msg string, kv ...any)  { l.add("warn", msg, kv) }
+func (l *levelLogger) Error(msg string, kv ...any) { l.add("error", msg, kv) }
+
 type testLogHandler struct{}
 
 func (h *testLogHandler) Create(ctx any, data ...any) any {
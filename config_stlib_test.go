@@ -13,6 +13,10 @@ func TestConfig_Stdlib(t *testing.T) {
 		NewWithConfigShared(t)
 	})
 
+	t.Run("FunctionalOptions", func(t *testing.T) {
+		FunctionalOptionsShared(t)
+	})
+
 	t.Run("Logger", func(t *testing.T) {
 		LoggerConfigShared(t)
 	})
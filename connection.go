@@ -0,0 +1,300 @@
+package crudp
+
+import (
+	"sync"
+
+	"github.com/cdvelop/tinytime"
+)
+
+// ConnState is the state of the event stream of a client Connection
+type ConnState uint8
+
+const (
+	ConnOffline      ConnState = iota // Every transport failed; probed again after a backoff
+	ConnReconnecting                  // Probing transports, also on the first connect
+	ConnConnected                     // Events flow over Connection.Transport
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case ConnConnected:
+		return "connected"
+	case ConnReconnecting:
+		return "reconnecting"
+	default:
+		return "offline"
+	}
+}
+
+// maxReconnectDelay caps the backoff between failed probing rounds (ms)
+const maxReconnectDelay = 30000
+
+// EventTransport opens one kind of event stream to the server, e.g.
+// SSETransport, WebSocketTransport or LongPollTransport on WASM
+// Open must not block. It calls opened once the stream works, receive with
+// the data of each event (for ReceiveEventData) and closed exactly once
+// when the stream fails or ends, but not after stop.
+type EventTransport interface {
+	Name() string
+	Open(url string, opened func(), receive func(data string), closed func(err error)) (stop func())
+}
+
+// Connection keeps the event stream of a client open over the first of its
+// transports that works, see Connect
+type Connection struct {
+	cp         *CrudP
+	transports []EventTransport
+	tp         tinytime.TimeProvider
+
+	mu        sync.Mutex
+	state     ConnState
+	current   int // Transport open or being probed
+	preferred int // Last transport that connected, -1 = none
+	tried     int // Transports failed in this probing round
+	failures  int // Failed rounds in a row, for the backoff
+	gen       int // Bumped per Open so callbacks of stale streams are ignored
+	stop      func()
+	timer     tinytime.Timer
+	onState   []func(ConnState)
+	closed    bool
+}
+
+// Connect opens the event stream at EventsURL over the first transport that
+// works, in the order given (client only)
+// The transport that connected is tried first after a drop; when all fail
+// the state goes ConnOffline and a new round starts after Config.RetryInterval
+// ms, doubled per failed round up to 30s. While offline the broker keeps
+// enqueued packets and flushes them once connected again.
+func (cp *CrudP) Connect(transports ...EventTransport) *Connection {
+	c := &Connection{
+		cp:         cp,
+		transports: transports,
+		tp:         tinytime.NewTimeProvider(),
+		state:      ConnReconnecting,
+		preferred:  -1,
+	}
+	if len(transports) == 0 {
+		c.state = ConnOffline
+		return c
+	}
+	c.open(0)
+	return c
+}
+
+// State returns the current connection state
+func (c *Connection) State() ConnState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// Transport returns the name of the transport connected, "" when not connected
+func (c *Connection) Transport() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != ConnConnected {
+		return ""
+	}
+	return c.transports[c.current].Name()
+}
+
+// OnState registers a callback for every state change, e.g. to show a banner
+func (c *Connection) OnState(fn func(ConnState)) {
+	if fn == nil {
+		return
+	}
+	c.mu.Lock()
+	c.onState = append(c.onState, fn)
+	c.mu.Unlock()
+}
+
+// Close stops the stream and any pending retry; the broker is back online
+func (c *Connection) Close() {
+	c.mu.Lock()
+	c.closed = true
+	c.gen++
+	stop, timer := c.stop, c.timer
+	c.stop, c.timer = nil, nil
+	c.mu.Unlock()
+
+	if timer != nil {
+		timer.Stop()
+	}
+	if stop != nil {
+		stop()
+	}
+	c.cp.broker.setOffline(offlineStream, false)
+}
+
+// open starts transport i; callbacks run outside the lock as transports
+// may call them synchronously
+func (c *Connection) open(i int) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.gen++
+	gen := c.gen
+	c.current = i
+	t := c.transports[i]
+	c.mu.Unlock()
+
+	c.cp.log.Debug("connection probing", "transport", t.Name())
+	stop := t.Open(c.cp.EventsURL(),
+		func() { c.opened(gen) },
+		func(data string) { c.receive(gen, data) },
+		func(err error) { c.failed(gen, err) },
+	)
+
+	c.mu.Lock()
+	if c.gen == gen && !c.closed {
+		c.stop = stop
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+	if stop != nil {
+		stop() // Failed or closed while opening
+	}
+}
+
+func (c *Connection) opened(gen int) {
+	c.mu.Lock()
+	if c.gen != gen || c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.preferred, c.tried, c.failures = c.current, 0, 0
+	name := c.transports[c.current].Name()
+	c.mu.Unlock()
+
+	c.cp.log.Info("connection established", "transport", name)
+	c.setState(ConnConnected)
+	c.cp.broker.setOffline(offlineStream, false)
+}
+
+func (c *Connection) receive(gen int, data string) {
+	c.mu.Lock()
+	stale := c.gen != gen || c.closed
+	c.mu.Unlock()
+	if stale {
+		return
+	}
+	if err := c.cp.ReceiveEventData(data); err != nil {
+		c.cp.log.Warn("connection event dropped", "error", err)
+	}
+}
+
+// failed moves to the next transport, or goes offline after a full round
+func (c *Connection) failed(gen int, err error) {
+	c.mu.Lock()
+	if c.gen != gen || c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.gen++ // Ignore anything else from this stream
+	c.stop = nil
+	name := c.transports[c.current].Name()
+
+	if c.state == ConnConnected {
+		// Dropped: try the same transport first, after the base interval
+		c.tried = 0
+		c.mu.Unlock()
+		c.cp.log.Warn("connection lost", "transport", name, "error", err)
+		c.setState(ConnReconnecting)
+		c.retry(c.cp.config.RetryInterval)
+		return
+	}
+
+	c.tried++
+	if c.tried < len(c.transports) {
+		next := (c.current + 1) % len(c.transports)
+		c.mu.Unlock()
+		c.cp.log.Debug("connection probe failed", "transport", name, "error", err)
+		c.open(next)
+		return
+	}
+
+	c.tried = 0
+	c.failures++
+	delay := c.cp.config.RetryInterval
+	for i := 1; i < c.failures && delay < maxReconnectDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxReconnectDelay {
+		delay = maxReconnectDelay
+	}
+	c.mu.Unlock()
+
+	c.cp.log.Warn("connection offline", "error", err, "retry_ms", delay)
+	c.setState(ConnOffline)
+	c.cp.broker.setOffline(offlineStream, true)
+	c.retry(delay)
+}
+
+// retry starts a probing round at the preferred transport after delay ms
+func (c *Connection) retry(delay int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.timer = c.tp.AfterFunc(delay, func() {
+		c.mu.Lock()
+		c.timer = nil
+		start := c.preferred
+		if start < 0 {
+			start = 0
+		}
+		c.mu.Unlock()
+		c.setState(ConnReconnecting)
+		c.open(start)
+	})
+}
+
+func (c *Connection) setState(s ConnState) {
+	c.mu.Lock()
+	if c.state == s || c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.state = s
+	callbacks := c.onState
+	c.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(s)
+	}
+}
+
+// splitSSE calls fn with the data of each complete event in buf and returns
+// the incomplete rest; comments and other fields are skipped
+func splitSSE(buf []byte, fn func(data string)) []byte {
+	for {
+		end := -1
+		for i := 0; i+1 < len(buf); i++ {
+			if buf[i] == '\n' && buf[i+1] == '\n' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return buf
+		}
+
+		event := buf[:end]
+		buf = buf[end+2:]
+		start := 0
+		for i := 0; i <= len(event); i++ {
+			if i < len(event) && event[i] != '\n' {
+				continue
+			}
+			line := event[start:i]
+			start = i + 1
+			if len(line) > 6 && string(line[:6]) == "data: " {
+				fn(string(line[6:]))
+			}
+		}
+	}
+}
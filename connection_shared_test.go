@@ -0,0 +1,143 @@
+package crudp_test
+
+import (
+	"encoding/base64"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// fakeTransport connects at once when up, or fails right away
+type fakeTransport struct {
+	name string
+
+	mu      sync.Mutex
+	up      bool
+	opens   int
+	receive func(string)
+	closed  func(error)
+}
+
+func (f *fakeTransport) Name() string { return f.name }
+
+func (f *fakeTransport) Open(url string, opened func(), receive func(string), closed func(error)) func() {
+	f.mu.Lock()
+	f.opens++
+	up := f.up
+	f.receive, f.closed = receive, closed
+	f.mu.Unlock()
+	if !up {
+		closed(Err(Fmt("%s down", f.name)))
+		return nil
+	}
+	opened()
+	return func() {}
+}
+
+func (f *fakeTransport) set(up bool) {
+	f.mu.Lock()
+	f.up = up
+	f.mu.Unlock()
+}
+
+func (f *fakeTransport) drop() {
+	f.mu.Lock()
+	closed := f.closed
+	f.mu.Unlock()
+	closed(Err(Fmt("%s dropped", f.name)))
+}
+
+func (f *fakeTransport) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.opens
+}
+
+func waitState(t *testing.T, c *crudp.Connection, want crudp.ConnState) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for c.State() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s, got %s", want, c.State())
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func ConnectionShared(t *testing.T) {
+	newCP := func() *crudp.CrudP {
+		cfg := crudp.DefaultConfig()
+		cfg.RetryInterval = 5
+		return crudp.New(cfg)
+	}
+
+	t.Run("Falls Back And Remembers", func(t *testing.T) {
+		cp := newCP()
+		sse := &fakeTransport{name: "sse"}
+		ws := &fakeTransport{name: "websocket", up: true}
+		c := cp.Connect(sse, ws)
+		defer c.Close()
+
+		if c.State() != crudp.ConnConnected || c.Transport() != "websocket" {
+			t.Fatalf("expected websocket, got %s %q", c.State(), c.Transport())
+		}
+
+		var states []crudp.ConnState
+		var mu sync.Mutex
+		c.OnState(func(s crudp.ConnState) { mu.Lock(); states = append(states, s); mu.Unlock() })
+		ws.drop()
+		waitState(t, c, crudp.ConnConnected)
+		if sse.count() != 1 || ws.count() != 2 {
+			t.Errorf("reconnect should try websocket first: sse %d, websocket %d opens", sse.count(), ws.count())
+		}
+		mu.Lock()
+		if len(states) != 2 || states[0] != crudp.ConnReconnecting || states[1] != crudp.ConnConnected {
+			t.Errorf("unexpected states %v", states)
+		}
+		mu.Unlock()
+	})
+
+	t.Run("Offline Holds The Queue", func(t *testing.T) {
+		cp := newCP()
+		var flushes int32
+		cp.Broker().SetOnFlush(func([]byte) { atomic.AddInt32(&flushes, 1) })
+		poll := &fakeTransport{name: "longpoll"}
+		c := cp.Connect(poll)
+		defer c.Close()
+
+		if c.State() != crudp.ConnOffline || !cp.Broker().Stats().Offline {
+			t.Fatalf("expected offline, got %s", c.State())
+		}
+		cp.Broker().Enqueue(0, 'c', "", []byte(`{}`))
+		cp.Broker().FlushNow()
+		if n := atomic.LoadInt32(&flushes); n != 0 {
+			t.Fatalf("flushed %d times while offline", n)
+		}
+
+		poll.set(true)
+		waitState(t, c, crudp.ConnConnected)
+		if n := atomic.LoadInt32(&flushes); n != 1 || cp.Broker().Stats().Offline {
+			t.Errorf("expected the queue flushed on reconnect, got %d flushes", n)
+		}
+	})
+
+	t.Run("Events Reach The Client", func(t *testing.T) {
+		cp := newCP()
+		encoded, _ := cp.Codec().Encode(crudp.Event{Channel: "news"})
+		data := base64.StdEncoding.EncodeToString(encoded)
+		var got []string
+		cp.OnEvent(func(ev crudp.Event) { got = append(got, ev.Channel) })
+		sse := &fakeTransport{name: "sse", up: true}
+		c := cp.Connect(sse)
+		sse.receive(data)
+		c.Close()
+		sse.receive(data) // Stale after Close
+		if len(got) != 1 || got[0] != "news" {
+			t.Errorf("unexpected events %v", got)
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package crudp
+
+import (
+	"context"
+	"sync"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// CodeStale is the Code of a Read whose ReadAfter token the data could not
+// reach, e.g. a replica lagging behind; retrying later may succeed
+const CodeStale = "stale"
+
+// ConsistencyTokens lets clients read their own writes when a handler reads
+// from eventually consistent replicas. Implement it on the handler (see
+// ConsistencyProvider) or set Config.Consistency for every handler.
+type ConsistencyTokens interface {
+	// WriteToken returns a token covering the writes done so far, e.g. the
+	// log position of the primary. Called after each successful mutation;
+	// "" sends none.
+	WriteToken(ctx context.Context) (string, error)
+
+	// WaitFor returns once reads reflect the writes of token, e.g. waiting
+	// for the replica to replay up to it, or an error to fail the Read.
+	WaitFor(ctx context.Context, token string) error
+}
+
+// ConsistencyProvider is implemented by handlers whose ConsistencyTokens
+// depend on their storage, e.g. ready-made stores forwarding those of their
+// backend; nil uses Config.Consistency
+type ConsistencyProvider interface {
+	Consistency() ConsistencyTokens
+}
+
+// WithReadAfter makes a Read reflect the writes of token, e.g. one received
+// by another client. Reads carry the last token of their handler already.
+func WithReadAfter(token string) CallOption {
+	return callOptionFunc(func(co *callOptions) {
+		co.readAfter = token
+	})
+}
+
+type readAfterKey struct{}
+
+// ReadAfter returns the token the Read being processed must reflect, ""
+// if none. Handlers without ConsistencyTokens may use it to read from the
+// primary instead.
+func ReadAfter(ctx context.Context) string {
+	token, _ := ctx.Value(readAfterKey{}).(string)
+	return token
+}
+
+// consistency returns the ConsistencyTokens of handler, nil if none
+func (cp *CrudP) consistency(handler *actionHandler) ConsistencyTokens {
+	switch h := handler.handler.(type) {
+	case ConsistencyTokens:
+		return h
+	case ConsistencyProvider:
+		if tokens := h.Consistency(); tokens != nil {
+			return tokens
+		}
+	}
+	return cp.config.Consistency
+}
+
+// awaitReadAfter waits until the data of handler reflects the ReadAfter
+// token of a Read packet and stores it in ctx
+func (cp *CrudP) awaitReadAfter(ctx context.Context, handler *actionHandler, packet *Packet) (context.Context, PacketResult, error) {
+	if packet.Action != 'r' || packet.ReadAfter == "" {
+		return ctx, PacketResult{}, nil
+	}
+	ctx = context.WithValue(ctx, readAfterKey{}, packet.ReadAfter)
+	tokens := cp.consistency(handler)
+	if tokens == nil {
+		return ctx, PacketResult{}, nil
+	}
+	if err := tokens.WaitFor(ctx, packet.ReadAfter); err != nil {
+		cp.log.Warn("read after token failed", "handler", handler.name, "token", packet.ReadAfter, "error", err)
+		pr := errorResult(packet, err)
+		pr.Code = CodeStale
+		return ctx, pr, err
+	}
+	return ctx, PacketResult{}, nil
+}
+
+// stampWriteToken sets the WriteToken of a successful mutation
+// A failing WriteToken is logged: the write itself succeeded.
+func (cp *CrudP) stampWriteToken(ctx context.Context, handler *actionHandler, packet *Packet, pr *PacketResult) {
+	if !mutating(packet.Action) || pr.MessageType == uint8(Msg.Error) {
+		return
+	}
+	tokens := cp.consistency(handler)
+	if tokens == nil {
+		return
+	}
+	token, err := tokens.WriteToken(ctx)
+	if err != nil {
+		cp.log.Warn("write token failed", "handler", handler.name, "error", err)
+		return
+	}
+	pr.WriteToken = token
+}
+
+// writeTokens keeps the last WriteToken received per handler (client side)
+type writeTokens struct {
+	mu     sync.Mutex
+	tokens map[uint8]string
+}
+
+// set records the WriteToken of a result
+func (w *writeTokens) set(pr *PacketResult) {
+	if pr.WriteToken == "" {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.tokens == nil {
+		w.tokens = map[uint8]string{}
+	}
+	w.tokens[pr.HandlerID] = pr.WriteToken
+}
+
+// readAfter returns the token a packet should carry: WithReadAfter, else
+// the last WriteToken of its handler for Reads
+func (cp *CrudP) readAfter(co *callOptions, action byte, handlerID uint8) string {
+	if co.readAfter != "" || action != 'r' {
+		return co.readAfter
+	}
+	cp.writeTokens.mu.Lock()
+	defer cp.writeTokens.mu.Unlock()
+	return cp.writeTokens.tokens[handlerID]
+}
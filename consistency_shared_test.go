@@ -0,0 +1,96 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Replica reads from a lagging replica: writes get a token, reads wait for it
+type Replica struct {
+	written int
+	waited  []string
+}
+
+func (h *Replica) Create(ctx context.Context, data ...any) any {
+	h.written++
+	return "ok"
+}
+
+func (h *Replica) Read(ctx context.Context, data ...any) any {
+	return crudp.ReadAfter(ctx)
+}
+
+func (h *Replica) WriteToken(ctx context.Context) (string, error) {
+	return Fmt("lsn-%d", h.written), nil
+}
+
+func (h *Replica) WaitFor(ctx context.Context, token string) error {
+	h.waited = append(h.waited, token)
+	if token == "lsn-99" {
+		return Err("replica behind")
+	}
+	return nil
+}
+
+// fixedTokens issues the same token for every write
+type fixedTokens string
+
+func (f fixedTokens) WriteToken(ctx context.Context) (string, error) { return string(f), nil }
+
+func (f fixedTokens) WaitFor(ctx context.Context, token string) error { return nil }
+
+func ConsistencyShared(t *testing.T) {
+	setup := func() (*Replica, *crudp.CrudP, *[]crudp.PacketResult) {
+		replica := &Replica{}
+		server := crudp.New(crudp.WithHandlers(replica))
+		client := crudp.NewLoopback(server, crudp.WithHandlers(&Replica{}))
+		results := &[]crudp.PacketResult{}
+		client.OnResult(func(pr crudp.PacketResult) { *results = append(*results, pr) })
+		return replica, client, results
+	}
+
+	t.Run("Reads Carry The Last Write Token", func(t *testing.T) {
+		replica, client, results := setup()
+		client.EnqueuePacket(0, 'r', "r0", nil)
+		client.Broker().FlushNow()
+		client.EnqueuePacket(0, 'c', "w1", nil)
+		client.Broker().FlushNow()
+		client.EnqueuePacket(0, 'r', "r1", nil)
+		client.Broker().FlushNow()
+
+		if len(*results) != 3 {
+			t.Fatalf("expected 3 results, got %d", len(*results))
+		}
+		if pr := (*results)[1]; pr.WriteToken != "lsn-1" {
+			t.Fatalf("expected write token lsn-1, got %+v", pr)
+		}
+		if len(replica.waited) != 1 || replica.waited[0] != "lsn-1" {
+			t.Fatalf("expected one wait for lsn-1, got %v", replica.waited)
+		}
+		var seen string
+		if err := client.DecodeData(&(*results)[2].Packet, 0, &seen); err != nil || seen != "lsn-1" {
+			t.Fatalf("ReadAfter in handler: %q, %v", seen, err)
+		}
+	})
+
+	t.Run("Stale Replica", func(t *testing.T) {
+		_, client, results := setup()
+		client.EnqueuePacket(0, 'r', "r1", nil, crudp.WithReadAfter("lsn-99"))
+		client.Broker().FlushNow()
+		if len(*results) != 1 || (*results)[0].Code != crudp.CodeStale || (*results)[0].MessageType != uint8(Msg.Error) {
+			t.Fatalf("expected a stale result, got %+v", *results)
+		}
+	})
+
+	t.Run("Config Tokens For Other Handlers", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.Consistency = fixedTokens("t1")
+		server := crudp.New(cfg, crudp.WithHandlers(&Importer{}))
+		if pr := processOne(t, server, crudp.Packet{Action: 'c'}); pr.WriteToken != "t1" {
+			t.Fatalf("expected write token t1, got %+v", pr)
+		}
+	})
+}
@@ -2,65 +2,182 @@ package crudp
 
 import (
 	"context"
+	"sync"
 )
 
 // actionHandler groups CRUD functions for a registration index
 type actionHandler struct {
-	name    string
-	index   uint8
-	handler any
-	Create  func(context.Context, ...any) any
-	Read    func(context.Context, ...any) any
-	Update  func(context.Context, ...any) any
-	Delete  func(context.Context, ...any) any
+	name       string
+	group      string // RegisterGroup namespace, "" = none
+	index      uint8
+	handler    any
+	Create     func(context.Context, ...any) any
+	Read       func(context.Context, ...any) any
+	Update     func(context.Context, ...any) any
+	Delete     func(context.Context, ...any) any
+	ReadPage   func(context.Context, Page, ...any) (any, PageInfo)
+	Patch      func(context.Context, FieldMask, ...any) any
+	Snapshot   func(context.Context) (any, error)
+	Compensate func(context.Context, byte, ...any) error
+	schema     uint32          // Field layout hash (see SchemaTable)
+	version    byte            // 0 = current
+	versions   []actionHandler // Older/newer versions registered via RegisterVersion
 }
 
 // CrudP handles automatic handler processing
 // Uses slices instead of maps for TinyGo compatibility
 type CrudP struct {
-	config   *Config
-	handlers []actionHandler
-	codec    Codec
-	log      func(...any) // Never nil - uses no-op by default
-	broker   *broker      // Add this field
+	config           *Config
+	mu               sync.RWMutex    // Guards handlers (copy-on-write)
+	handlers         []actionHandler // Never mutated in place, see table()
+	codec            Codec
+	log              Logger  // Never nil - uses no-op by default
+	broker           *broker // Add this field
+	pending          []any   // Handlers queued by WithHandlers
+	initErr          error   // First error found while applying options
+	idem             idempotencyCache
+	chunks           chunkTable         // WithChunk batches in progress
+	continuations    continuations      // Rest of responses cut by Config.MaxResponseBytes
+	reads            readCache          // Config.ReadCache results
+	packetMiddleware []PacketMiddleware // Global, guarded by mu
+	groupMiddleware  []groupMiddleware  // By group, guarded by mu (copy-on-write)
+	hub              sseHub             // In-process broadcast fan-out
+	listeners        listeners          // Client-side result/event callbacks
+	presence         Presence           // Connected users, see Config.Presence
+	maint            maintenance        // See SetMaintenance
+	breakers         breakers           // Handler stats, see Config.CircuitBreaker
+	node             string             // Instance ID in Config.PubSub messages
+	stopPubSub       func()             // Nil unless Config.PubSub is set
+	changes          *changeLog         // Nil unless Config.ChangeLogSize > 0
+	cache            EntityCache        // Client-side, filled when Config.EntityCache
+	codecs           []codecEntry       // By content type, guarded by mu (copy-on-write)
+	reqIDs           ReqIDProvider      // Config.ReqIDs or MonotonicReqIDs
+	running          runningPackets     // Handlers ActionCancel may abort
+	errorHooks       []ErrorHook        // See OnError, guarded by mu (copy-on-write)
+	jobs             jobQueue           // Deferred packets, see WithDeferred
+	schedules        schedules          // Stopped by Close, see AddSchedule
+	writeTokens      writeTokens        // Client-side, last WriteToken per handler
+	server           serverState        // See ListenAndServe
 }
 
-// noopLogger is the default logger that does nothing
-func noopLogger(...any) {}
+// New creates a new CrudP instance from options
+// Accepts a *Config directly for backward compatibility: New(cfg), New(nil)
+// Example: New(WithConfig(cfg), WithLogger(log), WithHandlers(&User{}))
+func New(opts ...Option) *CrudP {
+	cp := &CrudP{
+		log: noopLogger{},
+	}
+	cp.presence.cp = cp
 
-// New creates a new CrudP instance with configuration
-func New(cfg *Config) *CrudP {
-	if cfg == nil {
-		cfg = DefaultConfig()
+	for _, opt := range opts {
+		if opt != nil {
+			opt.apply(cp)
+		}
 	}
 
-	codec := cfg.Codec
-	if codec == nil {
-		codec = getDefaultCodec()
+	if cp.config == nil {
+		cp.config = DefaultConfig()
 	}
 
-	cp := &CrudP{
-		config: cfg,
-		codec:  codec,
-		log:    noopLogger,
+	if cp.codec == nil {
+		cp.codec = cp.config.Codec
+	}
+	if cp.codec == nil {
+		cp.codec = getDefaultCodec()
+	}
+	if cp.config.UseBinary {
+		cp.codec = NewFrameCodec(cp.codec)
 	}
 
+	cp.registerDefaultCodecs()
+
 	// Initialize broker
-	cp.broker = newBroker(cfg, codec)
+	cp.broker = newBroker(cp.config, cp.codec)
+	cp.reqIDs = cp.config.ReqIDs
+	if cp.reqIDs == nil {
+		cp.reqIDs = MonotonicReqIDs("")
+	}
+
+	if cp.config.ChangeLogSize > 0 {
+		cp.changes = &changeLog{limit: cp.config.ChangeLogSize}
+	}
+
+	if len(cp.pending) > 0 {
+		if err := cp.RegisterHandler(cp.pending...); err != nil {
+			cp.initErr = err
+			cp.log.Error("handler registration failed", "error", err)
+		}
+		cp.pending = nil
+	}
+
+	if err := cp.addSchedules(); err != nil {
+		if cp.initErr == nil {
+			cp.initErr = err
+		}
+		cp.log.Error("schedule failed", "error", err)
+	}
+
+	if err := cp.config.CORS.check(); err != nil {
+		if cp.initErr == nil {
+			cp.initErr = err
+		}
+		cp.log.Error("cors config invalid", "error", err)
+	}
+
+	if cp.config.PubSub != nil {
+		if err := cp.startPubSub(); err != nil {
+			if cp.initErr == nil {
+				cp.initErr = err
+			}
+			cp.log.Error("pubsub failed", "error", err)
+		}
+	}
 
 	return cp
 }
 
+// table returns a snapshot of the handler table
+// The slice is replaced, never mutated, so it is safe to use without the lock.
+func (cp *CrudP) table() []actionHandler {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	return cp.handlers
+}
+
+// setTable replaces the handler table
+func (cp *CrudP) setTable(table []actionHandler) {
+	cp.mu.Lock()
+	cp.handlers = table
+	cp.mu.Unlock()
+}
+
 // NewDefault creates CrudP with default configuration
 func NewDefault() *CrudP {
-	return New(nil)
+	return New()
+}
+
+// Err returns the first error produced by the options passed to New
+// (handler registration, schedules, Config.CORS, Config.PubSub subscription)
+func (cp *CrudP) Err() error {
+	return cp.initErr
 }
 
 // SetLogger configures a custom logging function
+// All levels are written to it; use SetLeveledLogger to keep severity.
 // Pass nil to restore no-op logger
 func (cp *CrudP) SetLogger(logger func(...any)) {
 	if logger == nil {
-		cp.log = noopLogger
+		cp.log = noopLogger{}
+		return
+	}
+	cp.log = funcLogger(logger)
+}
+
+// SetLeveledLogger configures a Logger with levels and key-value fields
+// Pass nil to restore no-op logger
+func (cp *CrudP) SetLeveledLogger(logger Logger) {
+	if logger == nil {
+		cp.log = noopLogger{}
 		return
 	}
 	cp.log = logger
@@ -68,7 +185,7 @@ func (cp *CrudP) SetLogger(logger func(...any)) {
 
 // DisableLogger disables logging
 func (cp *CrudP) DisableLogger() {
-	cp.log = noopLogger
+	cp.log = noopLogger{}
 }
 
 // Config returns the current configuration (read-only)
@@ -94,11 +211,39 @@ func (cp *CrudP) Broker() *broker {
 }
 
 // EnqueuePacket queues a packet for batch sending
-func (cp *CrudP) EnqueuePacket(handlerID uint8, action byte, reqID string, data any) error {
-	encoded, err := cp.codec.Encode(data)
+func (cp *CrudP) EnqueuePacket(handlerID uint8, action byte, reqID string, data any, opts ...CallOption) error {
+	co := cp.newCallOptions(opts)
+	if reqID == "" {
+		reqID = co.idempotencyKey
+	}
+	if reqID == "" {
+		reqID = cp.nextReqID()
+	}
+
+	encoded, err := co.codec.Encode(data)
 	if err != nil {
 		return err
 	}
-	cp.broker.Enqueue(handlerID, action, reqID, encoded)
+	cp.broker.enqueue(Packet{
+		Action:    action,
+		HandlerID: handlerID,
+		Version:   co.version,
+		ReqID:     reqID,
+		Page:      co.page,
+		DependsOn: co.dependsOn,
+		Refs:      co.refs,
+
+		Attachments: co.attachments,
+		IfNoneMatch: co.ifNoneMatch,
+		Deadline:    deadlineIn(co.ttl),
+		Deferred:    co.deferred,
+		ReadAfter:   cp.readAfter(&co, action, handlerID),
+
+		keys: itemKeys(data),
+	}, encoded)
+
+	if co.priority >= PriorityHigh {
+		cp.broker.FlushNow()
+	}
 	return nil
 }
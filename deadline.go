@@ -0,0 +1,55 @@
+package crudp
+
+import (
+	"time"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// CodeExpired marks a packet skipped because its Deadline had passed
+const CodeExpired = "expired"
+
+// WithTTL gives the packet a Deadline ms from now: a server receiving it
+// later skips it with Code CodeExpired (e.g. offline edits gone stale).
+// Overrides Config.PacketTTL.
+func WithTTL(ms int) CallOption {
+	return callOptionFunc(func(co *callOptions) {
+		co.ttl = ms
+	})
+}
+
+// deadlineIn returns the Packet.Deadline ms from now, 0 = none
+func deadlineIn(ms int) int64 {
+	if ms <= 0 {
+		return 0
+	}
+	return time.Now().Add(time.Duration(ms) * time.Millisecond).UnixMilli()
+}
+
+// laterDeadline is the Deadline of two consolidated packets: the later one,
+// so no item expires before its own deadline; 0 (none) wins
+func laterDeadline(a, b int64) int64 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// expired reports whether the packet Deadline passed at now
+func (p *Packet) expired(now time.Time) bool {
+	return p.Deadline > 0 && now.UnixMilli() > p.Deadline
+}
+
+// expiredResult reports a packet skipped because its Deadline passed
+func expiredResult(packet *Packet) PacketResult {
+	return PacketResult{
+		Packet:      packet.echo(),
+		MessageType: uint8(Msg.Warning),
+		Message:     msgExpired[EN],
+		MessageKey:  MsgExpired,
+		Code:        CodeExpired,
+	}
+}
@@ -0,0 +1,59 @@
+package crudp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+func DeadlineShared(t *testing.T) {
+	for _, binary := range []bool{false, true} {
+		t.Run(Fmt("Expired Packets Are Skipped binary=%v", binary), func(t *testing.T) {
+			h := &Menu{dishes: []string{"soup"}}
+			cfg := crudp.DefaultConfig()
+			cfg.UseBinary = binary
+			cp := crudp.New(cfg, crudp.WithHandlers(h))
+
+			encoded, err := cp.EncodePacket('r', 0, "r1", crudp.WithTTL(60000))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var packet crudp.Packet
+			cp.DecodePacket(encoded, &packet)
+			if packet.Deadline <= time.Now().UnixMilli() {
+				t.Fatalf("deadline not encoded: %d", packet.Deadline)
+			}
+			if pr := processOne(t, cp, packet); pr.Code != "" || len(pr.Data) != 1 {
+				t.Errorf("live packet skipped: %q %q", pr.Code, pr.Message)
+			}
+
+			packet.Deadline = time.Now().Add(-time.Second).UnixMilli()
+			pr := processOne(t, cp, packet)
+			if pr.Code != crudp.CodeExpired || pr.ReqID != "r1" || len(pr.Data) != 0 {
+				t.Errorf("expected expired, got %q %q", pr.Code, pr.Message)
+			}
+		})
+	}
+
+	t.Run("Broker Stamps PacketTTL", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.FlushStrategy = crudp.ManualFlush()
+		cfg.PacketTTL = 1000
+		cp := crudp.New(cfg, crudp.WithHandlers(&Menu{}))
+
+		var sent crudp.BatchRequest
+		cp.Broker().SetOnFlush(func(batch []byte) { cp.Codec().Decode(batch, &sent) })
+		cp.EnqueuePacket(0, 'r', "a", nil)
+		cp.EnqueuePacket(0, 'r', "b", nil, crudp.WithTTL(5000))
+		cp.Broker().FlushNow()
+
+		if len(sent.Packets) != 1 {
+			t.Fatalf("expected one consolidated packet, got %d", len(sent.Packets))
+		}
+		if left := sent.Packets[0].Deadline - time.Now().UnixMilli(); left <= 1000 || left > 5000 {
+			t.Errorf("expected the later deadline kept, %d ms left", left)
+		}
+	})
+}
@@ -0,0 +1,228 @@
+package crudp
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// Ref asks ProcessBatch to set Field of Data[Item] to the ID generated by
+// the packet with ReqID in the same batch (e.g. a child's ParentID).
+// The referenced packet is processed first, as with DependsOn.
+type Ref struct {
+	Item  int    `json:"item"`
+	Field string `json:"field"`
+	ReqID string `json:"req_id"`
+}
+
+// WithDependsOn processes the packet after the packets with these ReqIDs
+// Dependencies outside the batch are assumed already processed.
+func WithDependsOn(reqIDs ...string) CallOption {
+	return callOptionFunc(func(co *callOptions) {
+		co.dependsOn = append(co.dependsOn, reqIDs...)
+	})
+}
+
+// WithRef sets field of data item to the ID generated by the packet reqID
+func WithRef(item int, field, reqID string) CallOption {
+	return callOptionFunc(func(co *callOptions) {
+		co.refs = append(co.refs, Ref{Item: item, Field: field, ReqID: reqID})
+	})
+}
+
+// hasDeps reports whether the packet declares dependencies
+func (p *Packet) hasDeps() bool {
+	return len(p.DependsOn) > 0 || len(p.Refs) > 0
+}
+
+// batchDeps orders the packets of a batch by their dependencies
+type batchDeps struct {
+	order []int   // Packet indexes, dependencies first
+	errs  []error // Per packet: unknown reference or cycle
+}
+
+// newBatchDeps returns nil when no packet declares dependencies
+// Ties keep the batch order (Kahn's algorithm picking the lowest index).
+func newBatchDeps(packets []Packet) *batchDeps {
+	declared := false
+	for i := range packets {
+		if packets[i].hasDeps() {
+			declared = true
+			break
+		}
+	}
+	if !declared {
+		return nil
+	}
+
+	d := &batchDeps{errs: make([]error, len(packets))}
+	pending := make([]int, len(packets)) // Unprocessed dependencies per packet
+	edges := make([][]int, len(packets)) // Dependency -> dependents
+
+	for i := range packets {
+		p := &packets[i]
+		for _, reqID := range p.DependsOn {
+			if dep := findReqID(packets, reqID); dep >= 0 && dep != i {
+				edges[dep] = append(edges[dep], i)
+				pending[i]++
+			}
+		}
+		for _, ref := range p.Refs {
+			dep := findReqID(packets, ref.ReqID)
+			if dep < 0 || dep == i {
+				d.errs[i] = Err(Fmt("unknown reference %s", ref.ReqID))
+				continue
+			}
+			edges[dep] = append(edges[dep], i)
+			pending[i]++
+		}
+	}
+
+	done := make([]bool, len(packets))
+	for len(d.order) < len(packets) {
+		next := -1
+		for i := range packets {
+			if !done[i] && pending[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			break // Cycle among the remaining packets
+		}
+		done[next] = true
+		d.order = append(d.order, next)
+		for _, dependent := range edges[next] {
+			pending[dependent]--
+		}
+	}
+
+	for i := range packets {
+		if !done[i] {
+			d.order = append(d.order, i)
+			d.errs[i] = Err(Fmt("dependency cycle at %s", packets[i].ReqID))
+		}
+	}
+	return d
+}
+
+// at returns the packet index to process at step i
+func (d *batchDeps) at(i int) int {
+	if d == nil {
+		return i
+	}
+	return d.order[i]
+}
+
+// findReqID returns the index of the first packet with reqID, -1 if none
+func findReqID(packets []Packet, reqID string) int {
+	if reqID == "" {
+		return -1
+	}
+	for i := range packets {
+		if packets[i].ReqID == reqID {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolvedRef is a Ref with the generated ID of the referenced packet
+type resolvedRef struct {
+	item  int
+	field string
+	id    string
+}
+
+type refsKey struct{}
+
+// prepareDeps checks that the dependencies of packets[idx] succeeded and
+// exposes its resolved Refs through ctx for applyRefs
+func (cp *CrudP) prepareDeps(ctx context.Context, codec Codec, d *batchDeps, packets []Packet, results []PacketResult, idx int) (context.Context, error) {
+	if d == nil {
+		return ctx, nil
+	}
+	if err := d.errs[idx]; err != nil {
+		return ctx, err
+	}
+
+	p := &packets[idx]
+	for _, reqID := range p.DependsOn {
+		if dep := findReqID(packets, reqID); dep >= 0 && dep != idx && failed(&results[dep]) {
+			return ctx, LocErr(msgDependencyFailed, reqID)
+		}
+	}
+	if len(p.Refs) == 0 {
+		return ctx, nil
+	}
+
+	refs := make([]resolvedRef, 0, len(p.Refs))
+	for _, ref := range p.Refs {
+		dep := findReqID(packets, ref.ReqID)
+		pr := &results[dep]
+		if failed(pr) {
+			return ctx, LocErr(msgDependencyFailed, ref.ReqID)
+		}
+		id := ""
+		if len(pr.Data) > 0 {
+			value, _ := cp.decodeEntity(codec, pr.HandlerID, pr.Version, pr.Data[0])
+			id = entityID(value) // The ID itself is copied, not the entity key
+		}
+		if id == "" {
+			return ctx, Err(Fmt("dependency %s returned no ID", ref.ReqID))
+		}
+		refs = append(refs, resolvedRef{item: ref.Item, field: ref.Field, id: id})
+	}
+	return context.WithValue(ctx, refsKey{}, refs), nil
+}
+
+func failed(pr *PacketResult) bool {
+	return pr.MessageType == uint8(Msg.Error) || pr.MessageType == uint8(Msg.Warning)
+}
+
+// applyRefs sets the generated IDs into the decoded items
+func applyRefs(ctx context.Context, data []any) error {
+	refs, _ := ctx.Value(refsKey{}).([]resolvedRef)
+	for _, ref := range refs {
+		if ref.item < 0 || ref.item >= len(data) {
+			return Err(Fmt("reference to item %d out of range", ref.item))
+		}
+		sv := structValue(data[ref.item])
+		if !sv.IsValid() {
+			return Err(Fmt("reference to item %d: not a struct", ref.item))
+		}
+		f := sv.FieldByName(ref.field)
+		if !f.IsValid() || !f.CanSet() {
+			return Err(Fmt("reference to unknown field %s", ref.field))
+		}
+		if err := setID(f, ref.id); err != nil {
+			return Err(Fmt("reference to field %s: %v", ref.field, err))
+		}
+	}
+	return nil
+}
+
+// setID parses id into a string or integer field
+func setID(f reflect.Value, id string) error {
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(id)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(id, 10, 64)
+		if err != nil || f.OverflowInt(n) {
+			return Err(Fmt("invalid id %s", id))
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(id, 10, 64)
+		if err != nil || f.OverflowUint(n) {
+			return Err(Fmt("invalid id %s", id))
+		}
+		f.SetUint(n)
+	default:
+		return Err(Fmt("unsupported kind %s", f.Kind().String()))
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Folder gets ID 7 on create; an empty name fails validation
+type Folder struct {
+	ID   int
+	Name string
+}
+
+func (f *Folder) Validate(action byte, data ...any) error {
+	if data[0].(*Folder).Name == "" {
+		return Err("name is required")
+	}
+	return nil
+}
+
+func (f *Folder) Create(ctx context.Context, data ...any) any {
+	folder := *data[0].(*Folder)
+	folder.ID = 7
+	return folder
+}
+
+// FolderFile echoes the created file, including the FolderID set by a Ref
+type FolderFile struct {
+	ID       int
+	FolderID int
+	Title    string
+}
+
+func (f *FolderFile) Create(ctx context.Context, data ...any) any {
+	return *data[0].(*FolderFile)
+}
+
+func DependenciesShared(t *testing.T) {
+	for _, binary := range []bool{false, true} {
+		cfg := crudp.DefaultConfig()
+		cfg.UseBinary = binary
+		cp := crudp.New(cfg, crudp.WithHandlers(&Folder{}, &FolderFile{}))
+		codec := cp.Codec()
+
+		process := func(packets ...crudp.Packet) []crudp.PacketResult {
+			t.Helper()
+			batch, _ := codec.Encode(crudp.BatchRequest{Packets: packets})
+			resp, err := cp.ProcessBatch(context.Background(), batch)
+			if err != nil {
+				t.Fatalf("ProcessBatch error: %v", err)
+			}
+			var out crudp.BatchResponse
+			if err := codec.Decode(resp, &out); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			return out.Results
+		}
+		folder := func(reqID, name string) crudp.Packet {
+			data, _ := codec.Encode(&Folder{Name: name})
+			return crudp.Packet{Action: 'c', HandlerID: 0, ReqID: reqID, Data: [][]byte{data}}
+		}
+		file := func(reqID string, refs ...crudp.Ref) crudp.Packet {
+			data, _ := codec.Encode(&FolderFile{Title: "a"})
+			return crudp.Packet{Action: 'c', HandlerID: 1, ReqID: reqID, Refs: refs, Data: [][]byte{data}}
+		}
+		parentRef := crudp.Ref{Item: 0, Field: "FolderID", ReqID: "folder"}
+
+		t.Run(Fmt("Ref Substitutes Generated ID binary=%v", binary), func(t *testing.T) {
+			// Child first in the batch: processed after its parent
+			results := process(file("file", parentRef), folder("folder", "docs"))
+
+			if len(results) != 2 || results[0].ReqID != "file" || results[1].ReqID != "folder" {
+				t.Fatalf("expected results in batch order, got %+v", results)
+			}
+			if results[0].MessageType != uint8(Msg.Success) {
+				t.Fatalf("expected child success, got %s", results[0].Message)
+			}
+			var created FolderFile
+			codec.Decode(results[0].Data[0], &created)
+			if created.FolderID != 7 {
+				t.Errorf("expected FolderID 7 from parent, got %d", created.FolderID)
+			}
+		})
+
+		t.Run(Fmt("Failed Dependency binary=%v", binary), func(t *testing.T) {
+			results := process(folder("folder", ""), file("file", parentRef))
+			if results[1].MessageType != uint8(Msg.Error) || results[1].Message != "dependency folder failed" {
+				t.Errorf("expected dependency failure, got %q", results[1].Message)
+			}
+		})
+
+		t.Run(Fmt("Unknown Reference binary=%v", binary), func(t *testing.T) {
+			results := process(file("file", crudp.Ref{Field: "FolderID", ReqID: "missing"}))
+			if results[0].MessageType != uint8(Msg.Error) || results[0].Message != "unknown reference missing" {
+				t.Errorf("expected error for unknown reference, got %q", results[0].Message)
+			}
+		})
+
+		t.Run(Fmt("Cycle binary=%v", binary), func(t *testing.T) {
+			a, b := folder("a", "x"), folder("b", "y")
+			a.DependsOn, b.DependsOn = []string{"b"}, []string{"a"}
+			c := folder("c", "z")
+			results := process(a, b, c)
+			if results[0].MessageType != uint8(Msg.Error) || results[1].MessageType != uint8(Msg.Error) ||
+				!HasPrefix(results[0].Message, "dependency cycle at ") {
+				t.Errorf("expected cycle errors, got %q %q", results[0].Message, results[1].Message)
+			}
+			if results[2].MessageType != uint8(Msg.Success) {
+				t.Errorf("expected independent packet to succeed, got %q", results[2].Message)
+			}
+		})
+	}
+
+	t.Run("Enqueue Keeps Dependent Packets Apart", func(t *testing.T) {
+		server := crudp.New(crudp.WithHandlers(&Folder{}, &FolderFile{}))
+		client := crudp.NewLoopback(server, crudp.WithHandlers(&Folder{}, &FolderFile{}))
+		var results []crudp.PacketResult
+		client.OnResult(func(pr crudp.PacketResult) {
+			results = append(results, pr)
+		})
+
+		client.EnqueuePacket(1, 'c', "file", &FolderFile{Title: "a"}, crudp.WithRef(0, "FolderID", "folder"))
+		client.EnqueuePacket(1, 'c', "other", &FolderFile{Title: "b"})
+		client.EnqueuePacket(0, 'c', "folder", &Folder{Name: "docs"})
+		client.Broker().FlushNow()
+
+		if len(results) != 3 {
+			t.Fatalf("expected 3 results, got %+v", results)
+		}
+		var created FolderFile
+		client.Codec().Decode(results[0].Data[0], &created)
+		if results[0].ReqID != "file" || created.FolderID != 7 {
+			t.Errorf("expected file in folder 7, got %+v", created)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package crudp
+
+import (
+	"context"
+	"sync"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// maxDispatchDepth bounds follow-up packets emitting follow-up packets
+const maxDispatchDepth = 8
+
+// Dispatcher lets a handler emit follow-up packets to other handlers
+// (e.g. creating a User also creates a Profile). Get it with DispatcherFrom.
+type Dispatcher struct {
+	batch  *dispatchBatch
+	parent *Packet
+	depth  int
+	sent   int // Follow-ups numbered so far, guarded by batch.mu
+}
+
+// dispatchBatch collects the follow-up results of one ProcessBatch call
+type dispatchBatch struct {
+	cp      *CrudP
+	co      *callOptions
+	mu      sync.Mutex
+	results []PacketResult
+	settled int  // Results already confirmed by their top-level packet
+	closed  bool // Response encoded: late dispatches are not reported
+}
+
+type dispatcherKey struct{}
+
+// DispatcherFrom returns the Dispatcher of a packet being processed by
+// ProcessBatch, nil in other contexts (e.g. CallHandler)
+func DispatcherFrom(ctx context.Context) *Dispatcher {
+	d, _ := ctx.Value(dispatcherKey{}).(*Dispatcher)
+	return d
+}
+
+// with attaches a Dispatcher for the follow-ups of packet to ctx
+func (b *dispatchBatch) with(ctx context.Context, packet *Packet, depth int) context.Context {
+	return context.WithValue(ctx, dispatcherKey{}, &Dispatcher{batch: b, parent: packet, depth: depth})
+}
+
+// Dispatch processes a packet for the handler called name right away, in
+// the ctx of the calling handler (same tenant, user and Config.Transactor
+// transaction). data items are encoded with the batch codec. The result is
+// also appended to the batch response with ReqID "<parent ReqID>.<n>".
+func (d *Dispatcher) Dispatch(ctx context.Context, name string, action byte, data ...any) (PacketResult, error) {
+	b := d.batch
+	id, ok := b.cp.HandlerID(name)
+	if !ok {
+		return PacketResult{}, Err(Fmt("dispatch: unknown handler %s", name))
+	}
+	if d.depth >= maxDispatchDepth {
+		return PacketResult{}, Err(Fmt("dispatch: more than %d nested packets", maxDispatchDepth))
+	}
+
+	packet := &Packet{Action: action, HandlerID: id, ReqID: Fmt("%s.%d", d.parent.ReqID, d.next())}
+	for _, item := range data {
+		encoded, err := b.co.codec.Encode(item)
+		if err != nil {
+			return PacketResult{}, err
+		}
+		packet.Data = append(packet.Data, encoded)
+	}
+
+	result, err := b.cp.processSinglePacket(b.with(ctx, packet, d.depth+1), b.co, packet)
+
+	b.mu.Lock()
+	if !b.closed {
+		b.results = append(b.results, result)
+	}
+	b.mu.Unlock()
+	return result, err
+}
+
+// next numbers the follow-ups of the parent packet
+func (d *Dispatcher) next() int {
+	d.batch.mu.Lock()
+	defer d.batch.mu.Unlock()
+	d.sent++
+	return d.sent
+}
+
+// settle confirms the follow-ups dispatched by a top-level packet
+// When the packet failed inside a Config.Transactor transaction they were
+// rolled back with it and are reported as errors.
+func (b *dispatchBatch) settle(packet *Packet, result *PacketResult) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if result.MessageType == uint8(Msg.Error) && b.cp.config.Transactor != nil && mutating(packet.Action) {
+		for i := b.settled; i < len(b.results); i++ {
+			if b.results[i].MessageType != uint8(Msg.Error) {
+				b.results[i].MessageType = uint8(Msg.Error)
+				b.results[i].Message = Fmt("rolled back with %s", packet.ReqID)
+				b.results[i].Data = nil
+			}
+		}
+	}
+	b.settled = len(b.results)
+}
+
+// close returns the follow-up results and stops collecting
+func (b *dispatchBatch) close() []PacketResult {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return b.results
+}
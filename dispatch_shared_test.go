@@ -0,0 +1,112 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Signup creates a Wallet for every new account through the Dispatcher
+type Signup struct {
+	Name string `json:"name"`
+	Fail bool   `json:"fail"`
+}
+
+type Wallet struct {
+	Owner string `json:"owner"`
+}
+
+var signupFollowUp crudp.PacketResult
+
+func (h *Signup) Create(ctx context.Context, data ...any) any {
+	s := data[0].(*Signup)
+	pr, err := crudp.DispatcherFrom(ctx).Dispatch(ctx, "wallet", 'c', &Wallet{Owner: s.Name})
+	if err != nil {
+		return flakyResult{err: err}
+	}
+	signupFollowUp = pr
+	if s.Fail {
+		return flakyResult{err: Errf("signup failed after the wallet")}
+	}
+	return s
+}
+
+func (h *Wallet) Create(ctx context.Context, data ...any) any { return data[0] }
+
+// Looper dispatches to itself forever
+type Looper struct{}
+
+func (h *Looper) Create(ctx context.Context, data ...any) any {
+	if _, err := crudp.DispatcherFrom(ctx).Dispatch(ctx, "looper", 'c'); err != nil {
+		return flakyResult{err: err}
+	}
+	return "ok"
+}
+
+func processBatchResults(t *testing.T, cp *crudp.CrudP, packets ...crudp.Packet) []crudp.PacketResult {
+	t.Helper()
+	batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: packets})
+	resp, err := cp.ProcessBatch(context.Background(), batch)
+	if err != nil {
+		t.Fatalf("ProcessBatch: %v", err)
+	}
+	var out crudp.BatchResponse
+	if err := cp.Codec().Decode(resp, &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return out.Results
+}
+
+func DispatcherShared(t *testing.T) {
+	signup := func(cp *crudp.CrudP, reqID string, s Signup) crudp.Packet {
+		data, _ := cp.Codec().Encode(&s)
+		return crudp.Packet{Action: 'c', HandlerID: 0, ReqID: reqID, Data: [][]byte{data}}
+	}
+
+	t.Run("Follow-Up Results In Response", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&Signup{}, &Wallet{}))
+		results := processBatchResults(t, cp, signup(cp, "s1", Signup{Name: "ana"}), signup(cp, "s2", Signup{Name: "bob"}))
+
+		if len(results) != 4 {
+			t.Fatalf("expected 2 results plus 2 follow-ups, got %d", len(results))
+		}
+		if results[0].ReqID != "s1" || results[2].ReqID != "s1.1" || results[3].ReqID != "s2.1" {
+			t.Errorf("unexpected order: %s %s %s %s", results[0].ReqID, results[1].ReqID, results[2].ReqID, results[3].ReqID)
+		}
+		var w Wallet
+		if err := cp.Codec().Decode(results[3].Data[0], &w); err != nil || w.Owner != "bob" || results[3].HandlerID != 1 {
+			t.Errorf("unexpected follow-up %+v %v", w, err)
+		}
+		if signupFollowUp.MessageType != uint8(Msg.Success) {
+			t.Errorf("Dispatch result not returned to the handler: %q", signupFollowUp.Message)
+		}
+	})
+
+	t.Run("Rolled Back With Parent", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.Transactor = &txStore{}
+		cfg.Outbox = cfg.Transactor.(*txStore)
+		cp := crudp.New(cfg, crudp.WithHandlers(&Signup{}, &Wallet{}))
+		results := processBatchResults(t, cp, signup(cp, "s1", Signup{Name: "ana", Fail: true}))
+
+		if len(results) != 2 || results[1].MessageType != uint8(Msg.Error) || results[1].Message != "rolled back with s1" {
+			t.Fatalf("expected the follow-up rolled back, got %+v", results)
+		}
+	})
+
+	t.Run("Depth Limit", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&Looper{}))
+		results := processBatchResults(t, cp, crudp.Packet{Action: 'c', ReqID: "l"})
+		if results[0].MessageType != uint8(Msg.Error) || len(results) != 9 {
+			t.Errorf("expected nested dispatch to stop, got %d results: %q", len(results), results[0].Message)
+		}
+	})
+
+	t.Run("Unavailable Outside Batches", func(t *testing.T) {
+		if crudp.DispatcherFrom(context.Background()) != nil {
+			t.Error("expected nil dispatcher")
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package crudp
+
+import . "github.com/cdvelop/tinystring"
+
+// maxHandlers is the size of the uint8 handler ID space
+const maxHandlers = 256
+
+// AddHandler registers a handler at runtime and returns its ID
+// IDs are stable: new handlers are appended and removed IDs are never reused.
+// Names in Config.HandlerIDs get their pinned ID, others come after the table.
+func (cp *CrudP) AddHandler(handler any) (uint8, error) {
+	if handler == nil {
+		return 0, Errf("handler is nil")
+	}
+	return cp.addHandler(handler, "")
+}
+
+// addHandler appends handler to the table under group (see RegisterGroup)
+// A ServerOnly handler takes its ID in WASM builds too, left free.
+func (cp *CrudP) addHandler(handler any, group string) (uint8, error) {
+	name, handler, err := envEntry(handler)
+	if err != nil {
+		return 0, err
+	}
+	name = groupName(group, name)
+	pinned := cp.stableID(name)
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	slot := pinned
+	if slot < 0 {
+		slot = len(cp.handlers)
+		if cp.config != nil && len(cp.config.HandlerIDs) > slot {
+			slot = len(cp.config.HandlerIDs)
+		}
+	}
+	if slot >= maxHandlers {
+		return 0, Err(Fmt("handler table full: cannot add %s", name))
+	}
+	for i := range cp.handlers {
+		if handler != nil && cp.handlers[i].handler != nil && cp.handlers[i].name == name {
+			return 0, duplicateNameError(name, cp.handlers[i].handler, handler)
+		}
+	}
+	if slot < len(cp.handlers) && cp.handlers[slot].handler != nil {
+		return 0, Err(Fmt("handler id %d pinned to %s is used by %s", slot, name, cp.handlers[slot].name))
+	}
+
+	id := uint8(slot)
+	ah := actionHandler{index: id} // Server only: the ID stays free
+	if handler != nil {
+		ah = actionHandler{
+			name:    name,
+			group:   group,
+			index:   id,
+			handler: handler,
+		}
+		cp.bindTo(&ah, handler)
+	}
+
+	size := len(cp.handlers)
+	if slot >= size {
+		size = slot + 1
+	}
+	table := make([]actionHandler, size)
+	copy(table, cp.handlers)
+	for i := len(cp.handlers); i < slot; i++ {
+		table[i] = actionHandler{index: uint8(i)} // Gap up to the pinned ID
+	}
+	table[slot] = ah
+	cp.handlers = table
+
+	cp.log.Info("added handler", "handler", name, "index", id)
+	return id, nil
+}
+
+// RemoveHandler unregisters a handler at runtime
+// The ID is left empty so the remaining handlers keep their IDs.
+func (cp *CrudP) RemoveHandler(handlerID uint8) error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	if int(handlerID) >= len(cp.handlers) || cp.handlers[handlerID].handler == nil {
+		return Err(Fmt("no handler found for id: %d", handlerID))
+	}
+
+	name := cp.handlers[handlerID].name
+	table := make([]actionHandler, len(cp.handlers))
+	copy(table, cp.handlers)
+	table[handlerID] = actionHandler{index: handlerID}
+	cp.handlers = table
+	cp.reads.invalidate(handlerID)
+
+	cp.log.Info("removed handler", "handler", name, "index", handlerID)
+	return nil
+}
+
+// ReplaceHandler swaps the implementation behind an ID at runtime
+// The new handler must resolve to the same name (within the same group).
+// Registered versions are kept.
+func (cp *CrudP) ReplaceHandler(handlerID uint8, handler any) error {
+	if handler == nil {
+		return Errf("handler is nil")
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	if int(handlerID) >= len(cp.handlers) || cp.handlers[handlerID].handler == nil {
+		return Err(Fmt("no handler found for id: %d", handlerID))
+	}
+	current := cp.handlers[handlerID]
+	name := groupName(current.group, getHandlerName(handler))
+	if current.name != name {
+		return Err(Fmt("cannot replace handler %s with %s at id %d", current.name, name, handlerID))
+	}
+
+	ah := actionHandler{
+		name:     name,
+		group:    current.group,
+		index:    handlerID,
+		handler:  handler,
+		versions: current.versions,
+	}
+	cp.bindTo(&ah, handler)
+
+	table := make([]actionHandler, len(cp.handlers))
+	copy(table, cp.handlers)
+	table[handlerID] = ah
+	cp.handlers = table
+	cp.reads.invalidate(handlerID)
+
+	cp.log.Info("replaced handler", "handler", name, "index", handlerID)
+	return nil
+}
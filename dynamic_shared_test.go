@@ -0,0 +1,96 @@
+package crudp_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+// Replacement for UserController with the same name
+type userControllerHot struct{}
+
+func (h *userControllerHot) HandlerName() string { return "user_controller" }
+func (h *userControllerHot) Read(ctx context.Context, data ...any) any {
+	return ReadResponse{ID: 2, Name: "hot"}
+}
+
+func DynamicHandlersShared(t *testing.T) {
+	t.Run("Add Remove Keeps IDs Stable", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		cp.RegisterHandler(&UserController{})
+
+		id, err := cp.AddHandler(&ValidatedHandler{})
+		if err != nil || id != 1 {
+			t.Fatalf("expected id 1, got %d (%v)", id, err)
+		}
+
+		if err := cp.RemoveHandler(0); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := cp.CallHandler(context.Background(), 0, 'r'); err == nil {
+			t.Error("expected error calling removed handler")
+		}
+		if cp.GetHandlerName(1) != "validated_handler" {
+			t.Error("remaining handler must keep its id")
+		}
+
+		id, _ = cp.AddHandler(&explicitNameHandler{})
+		if id != 2 {
+			t.Errorf("removed ids must not be reused, got %d", id)
+		}
+
+		if err := cp.RemoveHandler(0); err == nil {
+			t.Error("expected error removing twice")
+		}
+	})
+
+	t.Run("Replace Requires Same Name", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		cp.RegisterHandler(&UserController{})
+
+		if err := cp.ReplaceHandler(0, &ValidatedHandler{}); err == nil {
+			t.Error("expected error for different name")
+		}
+		if err := cp.ReplaceHandler(0, &userControllerHot{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		result, err := cp.CallHandler(context.Background(), 0, 'r')
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp, ok := result.(ReadResponse); !ok || resp.Name != "hot" {
+			t.Errorf("expected replaced handler result, got %v", result)
+		}
+	})
+
+	t.Run("Concurrent Access", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		cp.RegisterHandler(&UserController{})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					cp.CallHandler(context.Background(), 0, 'r')
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					id, _ := cp.AddHandler(&ValidatedHandler{})
+					cp.RemoveHandler(id)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if cp.GetHandlerName(0) != "user_controller" {
+			t.Error("handler 0 must survive concurrent changes")
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package crudp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// encryptedVersion prefixes encrypted items so the format can evolve
+const encryptedVersion byte = 1
+
+// EncryptionKeys provisions AES keys (16, 24 or 32 bytes) for
+// NewEncryptedCodec. Keys are named so they can be rotated: new items use
+// the current key, older items name the key that encrypted them.
+type EncryptionKeys interface {
+	// EncryptionKey returns the ID and key that encrypt new items
+	EncryptionKey() (id string, key []byte, err error)
+	// DecryptionKey returns the key with id, current or rotated out
+	DecryptionKey(id string) ([]byte, error)
+}
+
+// StaticEncryptionKey returns EncryptionKeys with one key and no rotation
+func StaticEncryptionKey(key []byte) EncryptionKeys {
+	return staticEncryptionKey(key)
+}
+
+type staticEncryptionKey []byte
+
+func (k staticEncryptionKey) EncryptionKey() (string, []byte, error) { return "", k, nil }
+
+func (k staticEncryptionKey) DecryptionKey(id string) ([]byte, error) {
+	if id != "" {
+		return nil, Err(Fmt("encryption key %s not found", id))
+	}
+	return k, nil
+}
+
+// encryptedCodec encrypts Packet.Data items with AES-GCM
+// Envelopes (BatchRequest, BatchResponse, Packet) stay readable so the
+// protocol is unchanged; only handler data is sealed.
+//
+// Item layout: version len(keyID) keyID nonce ciphertext
+type encryptedCodec struct {
+	inner Codec
+	keys  EncryptionKeys
+}
+
+// NewEncryptedCodec returns a codec encrypting items encoded with inner
+// (nil = default codec) with keys; client and server must share the keys.
+//
+//	cfg.Codec = crudp.NewEncryptedCodec(nil, crudp.StaticEncryptionKey(key))
+func NewEncryptedCodec(inner Codec, keys EncryptionKeys) Codec {
+	if inner == nil {
+		inner = getDefaultCodec()
+	}
+	return &encryptedCodec{inner: inner, keys: keys}
+}
+
+// envelope reports whether v is a protocol envelope, encoded in clear
+func envelope(v any) bool {
+	switch v.(type) {
+	case BatchRequest, *BatchRequest, BatchResponse, *BatchResponse, Packet, *Packet:
+		return true
+	}
+	return false
+}
+
+func (c *encryptedCodec) Encode(v any) ([]byte, error) {
+	plain, err := c.inner.Encode(v)
+	if err != nil || envelope(v) {
+		return plain, err
+	}
+
+	id, key, err := c.keys.EncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(id) > 255 {
+		return nil, Errf("encryption key ID too long")
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, 2+len(id)+aead.NonceSize()+len(plain)+aead.Overhead())
+	out = append(out, encryptedVersion, byte(len(id)))
+	out = append(out, id...)
+	nonce := out[len(out) : len(out)+aead.NonceSize()]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out = out[:len(out)+aead.NonceSize()]
+	return aead.Seal(out, nonce, plain, nil), nil
+}
+
+func (c *encryptedCodec) Decode(data []byte, v any) error {
+	if envelope(v) {
+		return c.inner.Decode(data, v)
+	}
+
+	if len(data) < 2 || data[0] != encryptedVersion {
+		return Errf("encrypted item: unknown version")
+	}
+	n := int(data[1])
+	if len(data) < 2+n {
+		return Errf("encrypted item: truncated")
+	}
+	key, err := c.keys.DecryptionKey(string(data[2 : 2+n]))
+	if err != nil {
+		return err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	data = data[2+n:]
+	if len(data) < aead.NonceSize() {
+		return Errf("encrypted item: truncated")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return Err(Fmt("encrypted item: %v", err))
+	}
+	return c.inner.Decode(plain, v)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,128 @@
+package crudp_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Diagnosis is sensitive data echoed by Create
+type Diagnosis struct {
+	Patient string
+	Notes   string
+}
+
+func (h *Diagnosis) Create(ctx context.Context, data ...any) any {
+	return data[0]
+}
+
+// captured keeps the raw batches seen by the server
+type captured struct{ raw [][]byte }
+
+func (c *captured) Record(request, response []byte) error {
+	c.raw = append(c.raw, request, response)
+	return nil
+}
+
+// rotatingKeys encrypts with current and decrypts with any known key
+type rotatingKeys struct {
+	current string
+	keys    map[string][]byte
+}
+
+func (k *rotatingKeys) EncryptionKey() (string, []byte, error) {
+	return k.current, k.keys[k.current], nil
+}
+
+func (k *rotatingKeys) DecryptionKey(id string) ([]byte, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, Err(Fmt("unknown key %s", id))
+	}
+	return key, nil
+}
+
+func EncryptedCodecShared(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	t.Run("Loopback Round Trip", func(t *testing.T) {
+		rec := &captured{}
+		serverCfg := crudp.DefaultConfig()
+		serverCfg.Codec = crudp.NewEncryptedCodec(nil, crudp.StaticEncryptionKey(key))
+		serverCfg.Recorder = rec
+		server := crudp.New(serverCfg, crudp.WithHandlers(&Diagnosis{}))
+
+		clientCfg := crudp.DefaultConfig()
+		clientCfg.Codec = crudp.NewEncryptedCodec(nil, crudp.StaticEncryptionKey(key))
+		client := crudp.NewLoopback(server, clientCfg, crudp.WithHandlers(&Diagnosis{}))
+
+		var got Diagnosis
+		client.OnResult(func(pr crudp.PacketResult) {
+			if err := client.DecodeData(&pr.Packet, 0, &got); err != nil {
+				t.Errorf("decode result: %v (%s)", err, pr.Message)
+			}
+		})
+		client.EnqueuePacket(0, 'c', "d1", &Diagnosis{Patient: "Jane Roe", Notes: "hypertension"})
+		client.Broker().FlushNow()
+
+		if got.Patient != "Jane Roe" || got.Notes != "hypertension" {
+			t.Fatalf("unexpected result %+v", got)
+		}
+		if len(rec.raw) != 2 {
+			t.Fatalf("expected request and response recorded, got %d", len(rec.raw))
+		}
+		for _, raw := range rec.raw {
+			if bytes.Contains(raw, []byte("hypertension")) {
+				t.Errorf("plaintext on the wire: %s", raw)
+			}
+		}
+	})
+
+	t.Run("Key Rotation", func(t *testing.T) {
+		keys := &rotatingKeys{current: "k1", keys: map[string][]byte{
+			"k1": key,
+			"k2": []byte("fedcba9876543210"),
+		}}
+		codec := crudp.NewEncryptedCodec(nil, keys)
+
+		old, err := codec.Encode(&Diagnosis{Patient: "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys.current = "k2"
+		current, _ := codec.Encode(&Diagnosis{Patient: "b"})
+
+		var d Diagnosis
+		if err := codec.Decode(old, &d); err != nil || d.Patient != "a" {
+			t.Errorf("item encrypted with rotated key: %v %+v", err, d)
+		}
+		if err := codec.Decode(current, &d); err != nil || d.Patient != "b" {
+			t.Errorf("item encrypted with current key: %v %+v", err, d)
+		}
+
+		delete(keys.keys, "k1")
+		if err := codec.Decode(old, &d); err == nil {
+			t.Error("item decoded after its key was removed")
+		}
+	})
+
+	t.Run("Tampered Or Wrong Key", func(t *testing.T) {
+		codec := crudp.NewEncryptedCodec(nil, crudp.StaticEncryptionKey(key))
+		sealed, _ := codec.Encode(&Diagnosis{Patient: "a"})
+
+		tampered := append([]byte(nil), sealed...)
+		tampered[len(tampered)-1] ^= 1
+		var d Diagnosis
+		if err := codec.Decode(tampered, &d); err == nil {
+			t.Error("tampered item decoded")
+		}
+
+		other := crudp.NewEncryptedCodec(nil, crudp.StaticEncryptionKey([]byte("fedcba9876543210")))
+		if err := other.Decode(sealed, &d); err == nil {
+			t.Error("item decoded with another key")
+		}
+	})
+}
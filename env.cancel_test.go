@@ -0,0 +1,68 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cdvelop/crudp"
+)
+
+// Blocker runs until the request context is cancelled
+type Blocker struct{}
+
+var blockerStarted = make(chan struct{}, 1)
+
+func (h *Blocker) Read(ctx context.Context, data ...any) any {
+	blockerStarted <- struct{}{}
+	<-ctx.Done()
+	return "late"
+}
+
+func TestCancellation_ClientDisconnect(t *testing.T) {
+	audits := make(chan crudp.AuditRecord, 2)
+	cfg := crudp.DefaultConfig()
+	cfg.Auditor = crudp.AuditFunc(func(ctx context.Context, rec crudp.AuditRecord) error {
+		audits <- rec
+		return nil
+	})
+	cp := crudp.New(cfg, crudp.WithHandlers(&Blocker{}, &Chart{}))
+	chartCalls = 0
+
+	srv := httptest.NewServer(cp.BuildRouter())
+	defer srv.Close()
+
+	batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{
+		{Action: 'r', HandlerID: 0, ReqID: "block"},
+		{Action: 'r', HandlerID: 1, ReqID: "next"},
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+cfg.APIEndpoint, bytes.NewReader(batch))
+	go func() {
+		<-blockerStarted
+		cancel()
+	}()
+	if _, err := http.DefaultClient.Do(req); err == nil {
+		t.Fatal("expected the aborted request to fail")
+	}
+
+	// The blocker only returns once its context is cancelled
+	for _, reqID := range []string{"block", "next"} {
+		select {
+		case rec := <-audits:
+			if rec.ReqID != reqID || (reqID == "next" && rec.Success) {
+				t.Errorf("unexpected audit record %+v", rec)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("packet %s not finished: handler not cancelled", reqID)
+		}
+	}
+	if chartCalls != 0 {
+		t.Errorf("packet after the disconnect reached the handler")
+	}
+}
@@ -0,0 +1,18 @@
+//go:build wasm
+
+package crudp
+
+// checkRoutes is a no-op on WASM: there is no HTTP router to validate
+func (cp *CrudP) checkRoutes() []string {
+	return nil
+}
+
+// AddSchedule is a no-op on WASM: only servers run schedules
+func (cp *CrudP) AddSchedule(s Schedule) error {
+	return nil
+}
+
+// addSchedules is a no-op on WASM: only servers run schedules
+func (cp *CrudP) addSchedules() error {
+	return nil
+}
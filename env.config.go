@@ -0,0 +1,378 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// envPrefix starts the environment variables read by LoadEnv
+const envPrefix = "CRUDP_"
+
+// ConfigError lists every bad field found while loading a Config
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	msg := "crudp config invalid:"
+	for _, p := range e.Problems {
+		msg += "\n - " + p
+	}
+	return msg
+}
+
+// configFields maps the keys of config files to the fields of c they set
+// Environment variables use the same keys in upper case after CRUDP_,
+// e.g. batch_window = CRUDP_BATCH_WINDOW. "codec" is handled apart.
+func configFields(c *Config) map[string]any {
+	return map[string]any{
+		"port":               &c.Port,
+		"api_endpoint":       &c.APIEndpoint,
+		"sse_endpoint":       &c.SSEEndpoint,
+		"upload_endpoint":    &c.UploadEndpoint,
+		"export_endpoint":    &c.ExportEndpoint,
+		"import_endpoint":    &c.ImportEndpoint,
+		"base_path":          &c.BasePath,
+		"server_url":         &c.ServerURL,
+		"primary_url":        &c.PrimaryURL,
+		"profile":            &c.Profile,
+		"locale":             &c.Locale,
+		"tls_cert":           &c.TLSCert,
+		"tls_key":            &c.TLSKey,
+		"batch_window":       &c.BatchWindow,
+		"max_retries":        &c.MaxRetries,
+		"retry_interval":     &c.RetryInterval,
+		"packet_ttl":         &c.PacketTTL,
+		"sse_heartbeat":      &c.SSEHeartbeat,
+		"sse_write_timeout":  &c.SSEWriteTimeout,
+		"import_chunk":       &c.ImportChunk,
+		"change_log_size":    &c.ChangeLogSize,
+		"max_response_bytes": &c.MaxResponseBytes,
+		"handler_timeout":    &c.HandlerTimeout,
+		"job_workers":        &c.JobWorkers,
+		"read_timeout":       &c.ReadTimeout,
+		"write_timeout":      &c.WriteTimeout,
+		"idle_timeout":       &c.IdleTimeout,
+		"max_upload_bytes":   &c.MaxUploadBytes,
+		"use_binary":         &c.UseBinary,
+		"read_only":          &c.ReadOnly,
+		"presence":           &c.Presence,
+		"message_keys":       &c.MessageKeys,
+		"entity_cache":       &c.EntityCache,
+		"require_signature":  &c.RequireSignature,
+		"sagas":              &c.Sagas,
+		"http2":              &c.HTTP2,
+		"trusted_proxies":    &c.TrustedProxies,
+		"handler_ids":        &c.HandlerIDs,
+	}
+}
+
+// ConfigFromEnv returns DefaultConfig with the fields set by CRUDP_*
+// environment variables, see LoadEnv
+func ConfigFromEnv() (*Config, error) {
+	cfg := DefaultConfig()
+	if err := cfg.LoadEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadEnv sets the fields of c named by CRUDP_* environment variables, e.g.
+// CRUDP_PORT=:8080, CRUDP_BATCH_WINDOW=20, CRUDP_CODEC=binary or
+// CRUDP_TRUSTED_PROXIES=10.0.0.0/8,192.168.1.1 (lists are comma separated),
+// so a file loaded first can be overridden per deployment. Unknown CRUDP_
+// variables are errors too: a typo would go unnoticed otherwise.
+func (c *Config) LoadEnv() error {
+	values := map[string]any{}
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		if name, ok := strings.CutPrefix(key, envPrefix); ok {
+			values[strings.ToLower(name)] = value
+		}
+	}
+	return c.load(values, envPrefix, true)
+}
+
+// ConfigFromJSON returns DefaultConfig with the fields set by a JSON object
+// of r, e.g. {"port": ":8080", "batch_window": 20, "trusted_proxies": ["10.0.0.0/8"]}
+func ConfigFromJSON(r io.Reader) (*Config, error) {
+	var values map[string]any
+	if err := json.NewDecoder(r).Decode(&values); err != nil {
+		return nil, &ConfigError{Problems: []string{"json: " + err.Error()}}
+	}
+	cfg := DefaultConfig()
+	if err := cfg.load(values, "", false); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ConfigFromYAML returns DefaultConfig with the fields set by the YAML of r.
+// Only flat "key: value" documents are read: lists as [a, b] or "- item"
+// lines, comments with #. A key without value nor items is "".
+func ConfigFromYAML(r io.Reader) (*Config, error) {
+	values, problems := parseFlatYAML(r)
+	cfg := DefaultConfig()
+	if err := cfg.load(values, "", false); err != nil {
+		problems = append(problems, err.(*ConfigError).Problems...)
+	}
+	if len(problems) > 0 {
+		return nil, &ConfigError{Problems: problems}
+	}
+	return cfg, nil
+}
+
+// load sets the fields of c from values by key, then validates c; prefix
+// and upper name the keys in problems (environment variables)
+func (c *Config) load(values map[string]any, prefix string, upper bool) error {
+	label := func(key string) string {
+		if upper {
+			key = strings.ToUpper(key)
+		}
+		return prefix + key
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // Stable problem order
+
+	fields := configFields(c)
+	var problems []string
+	for _, key := range keys {
+		var err error
+		if key == "codec" {
+			err = c.setCodec(values[key])
+		} else if field, ok := fields[key]; ok {
+			err = setConfigField(field, values[key])
+		} else {
+			err = Errf("unknown field")
+		}
+		if err != nil {
+			problems = append(problems, label(key)+": "+err.Error())
+		}
+	}
+	for _, p := range c.validate() {
+		problems = append(problems, label(p[0])+": "+p[1])
+	}
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// setCodec applies the "codec" setting: json or binary (see UseBinary)
+func (c *Config) setCodec(value any) error {
+	switch value {
+	case "json":
+		c.UseBinary = false
+	case "binary":
+		c.UseBinary = true
+	default:
+		return Err(Fmt("%s is not json or binary", describe(value)))
+	}
+	return nil
+}
+
+// setConfigField sets field to value: a string (environment, YAML) or a
+// JSON value of the field type
+func setConfigField(field, value any) error {
+	s, isString := value.(string)
+	switch f := field.(type) {
+	case *string:
+		if !isString {
+			return Err(Fmt("expected a string, got %s", describe(value)))
+		}
+		*f = s
+	case *int, *int64:
+		var n int64
+		switch v := value.(type) {
+		case float64:
+			if v != float64(int64(v)) {
+				return Err(Fmt("expected an integer, got %s", describe(v)))
+			}
+			n = int64(v)
+		case string:
+			var err error
+			if n, err = strconv.ParseInt(strings.TrimSpace(v), 10, 64); err != nil {
+				return Err(Fmt("expected an integer, got %q", v))
+			}
+		default:
+			return Err(Fmt("expected an integer, got %s", describe(value)))
+		}
+		if p, ok := f.(*int); ok {
+			*p = int(n)
+		} else {
+			*f.(*int64) = n
+		}
+	case *bool:
+		switch v := value.(type) {
+		case bool:
+			*f = v
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return Err(Fmt("expected true or false, got %q", v))
+			}
+			*f = b
+		default:
+			return Err(Fmt("expected true or false, got %s", describe(value)))
+		}
+	case *[]string:
+		switch v := value.(type) {
+		case string:
+			*f = nil
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*f = append(*f, item)
+				}
+			}
+		case []any:
+			list := make([]string, 0, len(v))
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return Err(Fmt("expected a list of strings, got %s", describe(item)))
+				}
+				list = append(list, s)
+			}
+			*f = list
+		default:
+			return Err(Fmt("expected a list of strings, got %s", describe(value)))
+		}
+	}
+	return nil
+}
+
+// describe writes a value of a config file in problems as JSON would
+func describe(value any) string {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "?"
+	}
+	return string(b)
+}
+
+// validate returns the key and problem of each field of c with a value no
+// server could run with
+func (c *Config) validate() [][2]string {
+	var problems [][2]string
+	for key, field := range configFields(c) {
+		switch f := field.(type) {
+		case *int:
+			if *f < 0 {
+				problems = append(problems, [2]string{key, Fmt("must not be negative, got %d", *f)})
+			}
+		case *int64:
+			if *f < 0 {
+				problems = append(problems, [2]string{key, Fmt("must not be negative, got %d", *f)})
+			}
+		case *string:
+			if strings.HasSuffix(key, "_endpoint") && *f != "" && (*f)[0] != '/' {
+				problems = append(problems, [2]string{key, Fmt("%q must start with /", *f)})
+			}
+		}
+	}
+	if c.APIEndpoint == "" {
+		problems = append(problems, [2]string{"api_endpoint", "must not be empty"})
+	}
+	if c.Port != "" && !strings.Contains(c.Port, ":") {
+		problems = append(problems, [2]string{"port", Fmt("%q is not host:port or :port", c.Port)})
+	}
+	if base := c.BasePath; base != "" && (base[0] != '/' || base[len(base)-1] == '/') {
+		problems = append(problems, [2]string{"base_path", Fmt("%q must start with / and not end with it", base)})
+	}
+	sort.Slice(problems, func(i, j int) bool { return problems[i][0] < problems[j][0] })
+	return problems
+}
+
+// parseFlatYAML reads the "key: value" pairs of a flat YAML document
+func parseFlatYAML(r io.Reader) (map[string]any, []string) {
+	values := map[string]any{}
+	var problems []string
+	var list string // Key of the "- item" lines being read
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := stripYAMLComment(scanner.Text())
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if item, ok := strings.CutPrefix(trimmed, "- "); ok && list != "" {
+			items, _ := values[list].([]any) // "" until the first item
+			values[list] = append(items, yamlScalar(item))
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			problems = append(problems, Fmt("line %d: nested values are not supported", n))
+			continue
+		}
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			problems = append(problems, Fmt("line %d: expected key: value", n))
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		list = ""
+		switch {
+		case value == "":
+			values[key], list = "", key // A list if "- item" lines follow
+		case value[0] == '[' && value[len(value)-1] == ']':
+			items := []any{}
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, yamlScalar(item))
+				}
+			}
+			values[key] = items
+		default:
+			values[key] = yamlScalar(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		problems = append(problems, "yaml: "+err.Error())
+	}
+	return values, problems
+}
+
+// yamlScalar returns a scalar without its quotes; numbers and booleans stay
+// strings, parsed by the field they set
+func yamlScalar(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		if s[0] == '"' {
+			if unquoted, err := strconv.Unquote(s); err == nil {
+				return unquoted
+			}
+		}
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// stripYAMLComment removes a # comment outside quotes
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,127 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("CRUDP_PORT", ":9090")
+	t.Setenv("CRUDP_BATCH_WINDOW", "25")
+	t.Setenv("CRUDP_MAX_UPLOAD_BYTES", "1048576")
+	t.Setenv("CRUDP_CODEC", "binary")
+	t.Setenv("CRUDP_TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.1")
+
+	cfg, err := crudp.ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != ":9090" || cfg.BatchWindow != 25 || cfg.MaxUploadBytes != 1048576 || !cfg.UseBinary {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if len(cfg.TrustedProxies) != 2 || cfg.TrustedProxies[1] != "192.168.1.1" {
+		t.Errorf("unexpected trusted proxies: %v", cfg.TrustedProxies)
+	}
+	if cfg.APIEndpoint != crudp.DefaultConfig().APIEndpoint {
+		t.Errorf("expected default api endpoint, got %q", cfg.APIEndpoint)
+	}
+}
+
+func TestConfigFromJSON(t *testing.T) {
+	cfg, err := crudp.ConfigFromJSON(strings.NewReader(`{
+		"port": ":8081",
+		"api_endpoint": "/v2/api",
+		"batch_window": 10,
+		"read_only": true,
+		"handler_ids": ["user", "patient"]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != ":8081" || cfg.APIEndpoint != "/v2/api" || cfg.BatchWindow != 10 || !cfg.ReadOnly {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if len(cfg.HandlerIDs) != 2 || cfg.HandlerIDs[0] != "user" {
+		t.Errorf("unexpected handler ids: %v", cfg.HandlerIDs)
+	}
+}
+
+func TestConfigFromYAML(t *testing.T) {
+	cfg, err := crudp.ConfigFromYAML(strings.NewReader(`
+# deployment overrides
+port: ":8082"
+tls_cert:
+codec: json
+sse_heartbeat: 5000 # ms
+locale: 'es'
+trusted_proxies:
+  - 10.0.0.0/8
+  - "172.16.0.0/12"
+handler_ids: [user, patient]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != ":8082" || cfg.UseBinary || cfg.SSEHeartbeat != 5000 || cfg.Locale != "es" {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if len(cfg.TrustedProxies) != 2 || cfg.TrustedProxies[1] != "172.16.0.0/12" {
+		t.Errorf("unexpected trusted proxies: %v", cfg.TrustedProxies)
+	}
+	if len(cfg.HandlerIDs) != 2 || cfg.HandlerIDs[1] != "patient" {
+		t.Errorf("unexpected handler ids: %v", cfg.HandlerIDs)
+	}
+	if cfg.TLSCert != "" {
+		t.Errorf("expected an empty tls_cert, got %q", cfg.TLSCert)
+	}
+}
+
+func TestConfig_ValidationListsEveryProblem(t *testing.T) {
+	_, err := crudp.ConfigFromJSON(strings.NewReader(`{
+		"port": "8080",
+		"batch_window": "soon",
+		"max_retries": -1,
+		"sse_endpoint": "events",
+		"codec": "xml",
+		"colour": "blue"
+	}`))
+	var cfgErr *crudp.ConfigError
+	if !errors.As(err, &cfgErr) {
+		t.Fatalf("expected ConfigError, got %v", err)
+	}
+	for _, want := range []string{`batch_window: expected an integer, got "soon"`, `codec: "xml" is not json or binary`} {
+		found := false
+		for _, p := range cfgErr.Problems {
+			found = found || p == want
+		}
+		if !found {
+			t.Errorf("expected %s in %v", want, cfgErr.Problems)
+		}
+	}
+	for _, field := range []string{"port", "batch_window", "max_retries", "sse_endpoint", "codec", "colour"} {
+		found := false
+		for _, p := range cfgErr.Problems {
+			found = found || strings.HasPrefix(p, field+":")
+		}
+		if !found {
+			t.Errorf("expected a problem for %s in %v", field, cfgErr.Problems)
+		}
+	}
+
+	_, err = crudp.ConfigFromJSON(strings.NewReader(`{"trusted_proxies": ["10.0.0.0/8", 3], "read_only": [true]}`))
+	if err == nil || !strings.Contains(err.Error(), "trusted_proxies: expected a list of strings, got 3") ||
+		!strings.Contains(err.Error(), "read_only: expected true or false, got [true]") {
+		t.Errorf("expected the bad values in the error, got %v", err)
+	}
+
+	t.Setenv("CRUDP_JOB_WORKERS", "many")
+	_, err = crudp.ConfigFromEnv()
+	if err == nil || !strings.Contains(err.Error(), `CRUDP_JOB_WORKERS: expected an integer, got "many"`) {
+		t.Errorf("expected the env variable in the error, got %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+//go:build wasm
+
+package crudp
+
+import (
+	"syscall/js"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// SSETransport reads the event stream with fetch and a streaming body, so
+// named events and cookies of the page work as with any other request
+func SSETransport() EventTransport { return sseTransport{} }
+
+// WebSocketTransport opens the events endpoint as a WebSocket (ws:// or wss://
+// after the scheme of ServerURL or of the page)
+func WebSocketTransport() EventTransport { return wsTransport{} }
+
+// LongPollTransport asks the events endpoint with ?poll=1 in a loop, for
+// proxies that buffer streamed responses or drop upgrades
+func LongPollTransport() EventTransport { return pollTransport{} }
+
+type sseTransport struct{}
+
+func (sseTransport) Name() string { return "sse" }
+
+func (sseTransport) Open(url string, opened func(), receive func(string), closed func(error)) func() {
+	abort := js.Global().Get("AbortController").New()
+	headers := js.Global().Get("Object").New()
+	headers.Set("Accept", "text/event-stream")
+	init := js.Global().Get("Object").New()
+	init.Set("headers", headers)
+	init.Set("signal", abort.Get("signal"))
+
+	// Functions are released on the last callback; after stop the abort
+	// rejects the pending promise, which ends up in onError
+	var stopped bool
+	var reader js.Value
+	var buf []byte
+	var onResponse, onChunk, onError js.Func
+	end := func(err error) {
+		onResponse.Release()
+		onChunk.Release()
+		onError.Release()
+		if !stopped {
+			stopped = true
+			closed(err)
+		}
+	}
+	onError = js.FuncOf(func(this js.Value, args []js.Value) any {
+		end(Err(Fmt("sse: %s", args[0].String())))
+		return nil
+	})
+	onChunk = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if args[0].Get("done").Bool() {
+			end(Errf("sse: stream ended"))
+			return nil
+		}
+		data := args[0].Get("value")
+		chunk := make([]byte, data.Get("length").Int())
+		js.CopyBytesToGo(chunk, data)
+		buf = splitSSE(append(buf, chunk...), receive)
+		return reader.Call("read").Call("then", onChunk, onError)
+	})
+	onResponse = js.FuncOf(func(this js.Value, args []js.Value) any {
+		resp := args[0]
+		if !resp.Get("ok").Bool() || resp.Get("body").IsNull() {
+			end(Err(Fmt("sse: HTTP %d", resp.Get("status").Int())))
+			return nil
+		}
+		reader = resp.Get("body").Call("getReader")
+		opened()
+		return reader.Call("read").Call("then", onChunk, onError)
+	})
+
+	js.Global().Call("fetch", url, init).Call("then", onResponse).Call("catch", onError)
+	return func() {
+		stopped = true
+		abort.Call("abort")
+	}
+}
+
+type wsTransport struct{}
+
+func (wsTransport) Name() string { return "websocket" }
+
+func (wsTransport) Open(url string, opened func(), receive func(string), closed func(error)) func() {
+	ws := js.Global().Get("WebSocket").New(wsURL(url))
+
+	var onOpen, onMessage, onClose js.Func
+	release := func() {
+		ws.Set("onopen", js.Null())
+		ws.Set("onmessage", js.Null())
+		ws.Set("onclose", js.Null())
+		onOpen.Release()
+		onMessage.Release()
+		onClose.Release()
+	}
+	onOpen = js.FuncOf(func(this js.Value, args []js.Value) any {
+		opened()
+		return nil
+	})
+	onMessage = js.FuncOf(func(this js.Value, args []js.Value) any {
+		receive(args[0].Get("data").String())
+		return nil
+	})
+	// Errors are always followed by close, which carries the code
+	onClose = js.FuncOf(func(this js.Value, args []js.Value) any {
+		release()
+		closed(Err(Fmt("websocket: closed (%d)", args[0].Get("code").Int())))
+		return nil
+	})
+	ws.Set("onopen", onOpen)
+	ws.Set("onmessage", onMessage)
+	ws.Set("onclose", onClose)
+
+	return func() {
+		release()
+		ws.Call("close")
+	}
+}
+
+// wsURL turns an http(s) or page relative URL into a ws(s) one
+func wsURL(url string) string {
+	switch {
+	case len(url) >= 5 && url[:5] == "https":
+		return "wss" + url[5:]
+	case len(url) >= 4 && url[:4] == "http":
+		return "ws" + url[4:]
+	}
+	location := js.Global().Get("location")
+	scheme := "ws://"
+	if location.Get("protocol").String() == "https:" {
+		scheme = "wss://"
+	}
+	return scheme + location.Get("host").String() + url
+}
+
+type pollTransport struct{}
+
+func (pollTransport) Name() string { return "longpoll" }
+
+func (pollTransport) Open(url string, opened func(), receive func(string), closed func(error)) func() {
+	abort := js.Global().Get("AbortController").New()
+	init := js.Global().Get("Object").New()
+	init.Set("signal", abort.Get("signal"))
+	sep := "?"
+	for i := 0; i < len(url); i++ {
+		if url[i] == '?' {
+			sep = "&"
+			break
+		}
+	}
+	url += sep + "poll=1"
+
+	// The server sends headers at once and the events when there are any
+	var stopped, connected bool
+	var onResponse, onBody, onError js.Func
+	end := func(err error) {
+		onResponse.Release()
+		onBody.Release()
+		onError.Release()
+		if !stopped {
+			stopped = true
+			closed(err)
+		}
+	}
+	poll := func() {
+		js.Global().Call("fetch", url, init).Call("then", onResponse).Call("catch", onError)
+	}
+	onError = js.FuncOf(func(this js.Value, args []js.Value) any {
+		end(Err(Fmt("longpoll: %s", args[0].String())))
+		return nil
+	})
+	onBody = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if splitSSE([]byte(args[0].String()), receive); stopped {
+			end(nil)
+			return nil
+		}
+		poll()
+		return nil
+	})
+	onResponse = js.FuncOf(func(this js.Value, args []js.Value) any {
+		resp := args[0]
+		if !resp.Get("ok").Bool() {
+			end(Err(Fmt("longpoll: HTTP %d", resp.Get("status").Int())))
+			return nil
+		}
+		if !connected {
+			connected = true
+			opened()
+		}
+		return resp.Call("text").Call("then", onBody, onError)
+	})
+
+	poll()
+	return func() {
+		stopped = true
+		abort.Call("abort")
+	}
+}
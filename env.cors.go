@@ -0,0 +1,83 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// corsMiddleware applies Config.CORS to the API and SSE endpoints
+// Preflight (OPTIONS) requests are answered here and never reach handlers.
+func (cp *CrudP) corsMiddleware(next http.Handler) http.Handler {
+	cors := cp.config.CORS
+	if cors == nil {
+		return next
+	}
+
+	methods := cors.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodPost, http.MethodGet, http.MethodOptions}
+	}
+	headers := cors.AllowedHeaders
+	if len(headers) == 0 {
+		headers = []string{"Content-Type"}
+		if cp.config.FileStore != nil {
+			headers = append(headers, UploadIDHeader, UploadOffsetHeader, UploadNameHeader, UploadTypeHeader)
+		}
+	}
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(headers, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != cp.config.APIEndpoint && r.URL.Path != cp.config.SSEEndpoint && r.URL.Path != cp.config.UploadEndpoint && r.URL.Path != cp.schemaEndpoint() &&
+			!strings.HasPrefix(r.URL.Path, cp.config.ExportEndpoint+"/") &&
+			!(cp.config.ImportEndpoint != "" && strings.HasPrefix(r.URL.Path, cp.config.ImportEndpoint+"/")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		origin := r.Header.Get("Origin")
+		allowed, ok := cp.allowedOrigin(origin)
+		if origin == "" || !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		h.Set("Access-Control-Allow-Origin", allowed)
+		if cors.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		// Preflight
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", allowMethods)
+			h.Set("Access-Control-Allow-Headers", allowHeaders)
+			if cors.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(cors.MaxAge))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for origin
+// Credentials are only granted to origins listed explicitly.
+func (cp *CrudP) allowedOrigin(origin string) (string, bool) {
+	cors := cp.config.CORS
+	for _, o := range cors.AllowedOrigins {
+		if o == "*" && !cors.AllowCredentials { // Rejected by New with credentials
+			return "*", true
+		}
+		if o == origin {
+			return origin, true
+		}
+	}
+	return "", false
+}
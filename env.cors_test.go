@@ -0,0 +1,108 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+func newCORSRouter(cors *crudp.CORSConfig) http.Handler {
+	cfg := crudp.DefaultConfig()
+	cfg.CORS = cors
+	cp := crudp.New(cfg)
+	cp.RegisterHandler(&mockBasicHandler{})
+	return cp.BuildRouter()
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	router := newCORSRouter(&crudp.CORSConfig{
+		AllowedOrigins: []string{"https://app.example.com"},
+		MaxAge:         600,
+	})
+
+	req := httptest.NewRequest("OPTIONS", "/api", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("unexpected allow origin: %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "POST, GET, OPTIONS" {
+		t.Errorf("unexpected allow methods: %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Max-Age"); got != "600" {
+		t.Errorf("unexpected max age: %q", got)
+	}
+}
+
+func TestCORS_DisallowedOrigin(t *testing.T) {
+	router := newCORSRouter(&crudp.CORSConfig{AllowedOrigins: []string{"https://app.example.com"}})
+
+	req := httptest.NewRequest("POST", "/api", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("expected no CORS header, got %q", got)
+	}
+}
+
+func TestCORS_WildcardWithCredentials(t *testing.T) {
+	cfg := crudp.DefaultConfig()
+	cfg.CORS = &crudp.CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+	cp := crudp.New(cfg)
+	cp.RegisterHandler(&mockBasicHandler{})
+	if err := cp.SelfCheck(); err == nil || !strings.Contains(err.Error(), "AllowCredentials") {
+		t.Errorf("expected SelfCheck to reject \"*\" with credentials, got %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/events", nil)
+	req.Header.Set("Origin", "https://other.example.com")
+	w := httptest.NewRecorder()
+	cp.BuildRouter().ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("expected no CORS header for an unlisted origin, got %q", got)
+	}
+}
+
+func TestCORS_CredentialsForListedOrigin(t *testing.T) {
+	router := newCORSRouter(&crudp.CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true})
+
+	req := httptest.NewRequest("POST", "/events", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("expected echoed origin with credentials, got %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("expected credentials header, got %q", got)
+	}
+}
+
+func TestCORS_DisabledByDefault(t *testing.T) {
+	router := newCORSRouter(nil)
+
+	req := httptest.NewRequest("OPTIONS", "/api", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("CORS must be disabled without Config.CORS")
+	}
+}
@@ -0,0 +1,224 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Exporter streams a dataset of the handler (server only)
+// BuildRouter serves it at Config.ExportEndpoint + "/" + handler name as CSV
+// or NDJSON. params holds the query string (e.g. filters). Items are written
+// to the response as they are passed to w, so a slow client slows the export
+// down instead of filling memory; stop when ctx is done.
+type Exporter interface {
+	Export(ctx context.Context, params url.Values, w ExportWriter) error
+}
+
+// ExportWriter receives the items of an export
+// Write blocks while the client is not reading and fails once it is gone.
+type ExportWriter interface {
+	Write(item any) error
+}
+
+// hasExporters reports whether a handler implements Exporter
+func (cp *CrudP) hasExporters() bool {
+	for _, h := range cp.table() {
+		if _, ok := h.handler.(Exporter); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// exportPattern is the mux pattern of the export route
+func (cp *CrudP) exportPattern() string {
+	return cp.config.ExportEndpoint + "/{handler}"
+}
+
+// exportFlushEvery is the number of items written between flushes
+const exportFlushEvery = 100
+
+// handleExport streams the export of the handler named in the path
+func (cp *CrudP) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.PathValue("handler")
+	id, ok := cp.HandlerID(name)
+	var exporter Exporter
+	if ok {
+		exporter, ok = cp.table()[id].handler.(Exporter)
+	}
+	if !ok {
+		http.Error(w, "No export for "+name, http.StatusNotFound)
+		return
+	}
+	if cp.config.ActionPolicy != nil && !cp.config.ActionPolicy.Allows(name, 'r') {
+		http.Error(w, (&ActionDisabledError{Handler: name, Action: 'r'}).Error(), http.StatusForbidden)
+		return
+	}
+
+	params := r.URL.Query()
+	format := params.Get("format")
+	var out exportEncoder
+	switch format {
+	case ExportCSV, "":
+		format = ExportCSV
+		out = &csvExport{w: csv.NewWriter(w)}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	case ExportNDJSON:
+		out = &ndjsonExport{w: w, codec: getDefaultCodec()}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	default:
+		http.Error(w, "Unknown export format "+format, http.StatusBadRequest)
+		return
+	}
+	params.Del("format")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+"."+format+`"`)
+
+	ctx := cp.withTenant(WithRemoteAddr(r.Context(), RemoteIP(r)))
+	ew := &exportWriter{ctx: ctx, out: out, w: w}
+	start := time.Now()
+	err := exporter.Export(ctx, params, ew)
+	if err == nil {
+		err = ew.flush()
+	}
+	if err != nil {
+		cp.log.Warn("export failed", "handler", name, "items", ew.items, "error", err)
+		if ew.items == 0 && r.Context().Err() == nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	cp.log.Debug("export done", "handler", name, "items", ew.items, "ms", time.Since(start).Milliseconds())
+}
+
+// exportEncoder writes items in one format
+type exportEncoder interface {
+	write(item any) error
+	flush() error
+}
+
+// exportWriter counts items, stops on cancellation and flushes periodically
+type exportWriter struct {
+	ctx   context.Context
+	out   exportEncoder
+	w     http.ResponseWriter
+	items int
+}
+
+func (e *exportWriter) Write(item any) error {
+	if err := e.ctx.Err(); err != nil {
+		return err
+	}
+	if err := e.out.write(item); err != nil {
+		return err
+	}
+	e.items++
+	if e.items%exportFlushEvery == 0 {
+		return e.flush()
+	}
+	return nil
+}
+
+func (e *exportWriter) flush() error {
+	if err := e.out.flush(); err != nil {
+		return err
+	}
+	return http.NewResponseController(e.w).Flush()
+}
+
+// ndjsonExport writes one JSON document per line
+type ndjsonExport struct {
+	w     http.ResponseWriter
+	codec Codec
+}
+
+func (n *ndjsonExport) write(item any) error {
+	line, err := n.codec.Encode(item)
+	if err != nil {
+		return err
+	}
+	_, err = n.w.Write(append(line, '\n'))
+	return err
+}
+
+func (n *ndjsonExport) flush() error { return nil }
+
+// csvExport writes a header from the fields of the first item, then a row per item
+type csvExport struct {
+	w      *csv.Writer
+	fields []int // Exported fields of the item type
+	row    []string
+	typ    reflect.Type
+}
+
+func (c *csvExport) write(item any) error {
+	v := reflect.ValueOf(item)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("export: csv needs struct items, got %T", item)
+	}
+	if c.typ == nil {
+		c.typ = v.Type()
+		var header []string
+		for i := 0; i < c.typ.NumField(); i++ {
+			f := c.typ.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			c.fields = append(c.fields, i)
+			header = append(header, jsonName(f))
+		}
+		if err := c.w.Write(header); err != nil {
+			return err
+		}
+	} else if v.Type() != c.typ {
+		return fmt.Errorf("export: csv items must share one type, got %s after %s", v.Type(), c.typ)
+	}
+
+	c.row = c.row[:0]
+	for _, i := range c.fields {
+		c.row = append(c.row, csvValue(v.Field(i)))
+	}
+	return c.w.Write(c.row)
+}
+
+func (c *csvExport) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// csvValue formats a field for a CSV cell
+func csvValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return ""
+		}
+		return csvValue(v.Elem())
+	}
+	return fmt.Sprint(v.Interface())
+}
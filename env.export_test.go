@@ -0,0 +1,81 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+// Invoice exports its rows, filtered by the "status" param
+type Invoice struct {
+	ID     int     `json:"id"`
+	Client string  `json:"client"`
+	Total  float64 `json:"total"`
+	Paid   bool
+	note   string
+}
+
+func (h *Invoice) Read(ctx context.Context, data ...any) any { return nil }
+
+func (h *Invoice) Export(ctx context.Context, params url.Values, w crudp.ExportWriter) error {
+	rows := []Invoice{{ID: 1, Client: "Ana, Inc.", Total: 10.5, Paid: true}, {ID: 2, Client: "Bea", Total: 3}}
+	for _, row := range rows {
+		if params.Get("status") == "paid" && !row.Paid {
+			continue
+		}
+		if err := w.Write(&row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestExportRoute(t *testing.T) {
+	get := func(cp *crudp.CrudP, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		cp.BuildRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	cp := crudp.New(crudp.WithHandlers(&Invoice{}, &User{}))
+
+	t.Run("CSV", func(t *testing.T) {
+		w := get(cp, "/export/invoice")
+		want := "id,client,total,Paid\n1,\"Ana, Inc.\",10.5,true\n2,Bea,3,false\n"
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("status %d, body:\n%s", w.Code, w.Body.String())
+		}
+		if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, `filename="invoice.csv"`) {
+			t.Errorf("unexpected Content-Disposition %q", cd)
+		}
+	})
+
+	t.Run("NDJSON With Params", func(t *testing.T) {
+		w := get(cp, cp.ExportURL("invoice", crudp.ExportNDJSON, "status", "paid"))
+		lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+		if w.Code != http.StatusOK || len(lines) != 1 || !strings.Contains(lines[0], `"client":"Ana, Inc."`) {
+			t.Errorf("status %d, body:\n%s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		if w := get(cp, "/export/user"); w.Code != http.StatusNotFound {
+			t.Errorf("handler without Export: expected 404, got %d", w.Code)
+		}
+		if w := get(cp, "/export/invoice?format=xml"); w.Code != http.StatusBadRequest {
+			t.Errorf("unknown format: expected 400, got %d", w.Code)
+		}
+
+		cfg := crudp.DefaultConfig()
+		cfg.ActionPolicy = crudp.ActionPolicy{"invoice": "r"}
+		if w := get(crudp.New(cfg, crudp.WithHandlers(&Invoice{})), "/export/invoice"); w.Code != http.StatusForbidden {
+			t.Errorf("reads disabled: expected 403, got %d", w.Code)
+		}
+	})
+}
@@ -0,0 +1,17 @@
+//go:build wasm
+
+package crudp
+
+import "syscall/js"
+
+// Download starts the browser download of an export (see ExportURL)
+// The browser streams the file to disk; cookies are sent as with any link.
+func (cp *CrudP) Download(handler, format string, params ...string) {
+	doc := js.Global().Get("document")
+	a := doc.Call("createElement", "a")
+	a.Set("href", cp.ExportURL(handler, format, params...))
+	a.Set("download", "")
+	doc.Get("body").Call("appendChild", a)
+	a.Call("click")
+	a.Call("remove")
+}
@@ -0,0 +1,110 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// parseProxies parses Config.TrustedProxies, IPs or CIDRs
+func parseProxies(list []string) ([]netip.Prefix, error) {
+	proxies := make([]netip.Prefix, 0, len(list))
+	for _, item := range list {
+		if prefix, err := netip.ParsePrefix(item); err == nil {
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, Err(Fmt("trusted proxy %q: not an IP or CIDR", item))
+		}
+		proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return proxies, nil
+}
+
+// trusted reports whether ip belongs to one of proxies
+func trusted(proxies []netip.Prefix, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range proxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns the client IP of X-Forwarded-For: the last address
+// not added by a trusted proxy, read from the right since clients may send
+// the header too; "" if none is valid
+func forwardedFor(proxies []netip.Prefix, values []string) string {
+	var hops []string
+	for _, v := range values {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	client := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break
+		}
+		client = hop
+		if !trusted(proxies, hop) {
+			break
+		}
+	}
+	return client
+}
+
+// forwarded takes the client IP and scheme of requests relayed by
+// Config.TrustedProxies from X-Forwarded-For and X-Forwarded-Proto, so
+// RemoteIP, RequestScheme and everything keyed on them (rate limits,
+// audit, logs) see the client instead of the proxy
+func (cp *CrudP) forwarded(next http.Handler) http.Handler {
+	proxies, err := parseProxies(cp.config.TrustedProxies)
+	if err != nil {
+		cp.log.Error("trusted proxies ignored", "error", err) // SelfCheck reports it
+		return next
+	}
+	if len(proxies) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !trusted(proxies, RemoteIP(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r2 := new(http.Request)
+		*r2 = *r
+		u := *r.URL
+		r2.URL = &u
+		if ip := forwardedFor(proxies, r.Header.Values("X-Forwarded-For")); ip != "" {
+			r2.RemoteAddr = ip
+		}
+		switch proto := strings.ToLower(r.Header.Get("X-Forwarded-Proto")); proto {
+		case "http", "https":
+			u.Scheme = proto
+		}
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// RequestScheme returns "https" or "http": the X-Forwarded-Proto of a
+// trusted proxy (see Config.TrustedProxies), else the one of the connection
+func RequestScheme(r *http.Request) string {
+	if r.URL.Scheme != "" {
+		return r.URL.Scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,91 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+// whoamiHandler answers the client IP and scheme it sees
+type whoamiHandler struct{}
+
+func (h *whoamiHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/whoami", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(crudp.RemoteIP(r) + " " + crudp.RequestScheme(r)))
+	})
+}
+
+func TestBuildRouter_BasePath(t *testing.T) {
+	cfg := crudp.DefaultConfig()
+	cfg.BasePath = "/app"
+	cfg.ServerURL = "https://example.com"
+	cp := crudp.New(cfg, crudp.WithHandlers(&whoamiHandler{}))
+	router := cp.BuildRouter()
+
+	for path, want := range map[string]int{
+		"/app/api/schema": http.StatusOK,
+		"/app/whoami":     http.StatusOK,
+		"/api/schema":     http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != want {
+			t.Errorf("%s: expected %d, got %d", path, want, w.Code)
+		}
+	}
+
+	if url := cp.EndpointURL(cfg.APIEndpoint); url != "https://example.com/app/api" {
+		t.Errorf("unexpected endpoint URL %q", url)
+	}
+	if url := cp.EventsURL(); url != "https://example.com/app/events" {
+		t.Errorf("unexpected events URL %q", url)
+	}
+}
+
+func TestBuildRouter_TrustedProxies(t *testing.T) {
+	cfg := crudp.DefaultConfig()
+	cfg.TrustedProxies = []string{"10.0.0.0/8", "192.168.1.1"}
+	router := crudp.New(cfg, crudp.WithHandlers(&whoamiHandler{})).BuildRouter()
+
+	whoami := func(remote, forwardedFor, proto string) string {
+		r := httptest.NewRequest("GET", "/whoami", nil)
+		r.RemoteAddr = remote
+		if forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		if proto != "" {
+			r.Header.Set("X-Forwarded-Proto", proto)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Body.String()
+	}
+
+	cases := []struct{ name, remote, forwardedFor, proto, want string }{
+		{"Trusted Proxy", "10.0.0.5:4000", "203.0.113.9", "https", "203.0.113.9 https"},
+		{"Proxy Chain", "192.168.1.1:4000", "203.0.113.9, 10.1.2.3", "", "203.0.113.9 http"},
+		{"Spoofed By Client", "10.0.0.5:4000", "1.2.3.4, 203.0.113.9", "", "203.0.113.9 http"},
+		{"Untrusted Peer", "198.51.100.7:4000", "203.0.113.9", "https", "198.51.100.7 http"},
+		{"Invalid Header", "10.0.0.5:4000", "unknown", "ftp", "10.0.0.5 http"},
+	}
+	for _, c := range cases {
+		if got := whoami(c.remote, c.forwardedFor, c.proto); got != c.want {
+			t.Errorf("%s: expected %q, got %q", c.name, c.want, got)
+		}
+	}
+}
+
+func TestSelfCheck_ProxySettings(t *testing.T) {
+	cfg := crudp.DefaultConfig()
+	cfg.BasePath = "app/"
+	cfg.TrustedProxies = []string{"not-an-ip"}
+	err := crudp.New(cfg, crudp.WithHandlers(&UserController{})).SelfCheck()
+	sce, ok := err.(*crudp.SelfCheckError)
+	if !ok || len(sce.Problems) != 2 {
+		t.Errorf("expected BasePath and TrustedProxies problems, got %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !wasm
+
+package crudp
+
+// ByEnv registers the handler built by server in server builds and the one
+// built by client in WASM builds, both under name at the same ID, e.g. a
+// service with its database on the server and a proxy in the browser:
+//
+//	crudp.ByEnv("user", newUserService, func() any { return crudp.NewProxyHandler(0) })
+//
+// Only the builder of the current build runs; a ProxyHandler it returns is
+// named name. A nil builder leaves the ID free in that build, see
+// ServerOnly. To keep server code out of the WASM binary, declare the
+// builders in files with build tags.
+func ByEnv(name string, server, client func() any) any {
+	return envHandler{name: name, build: server}
+}
+
+// ServerOnly registers the handler built by server in server builds only;
+// WASM builds keep its ID free, so the IDs of the handlers after it match
+func ServerOnly(name string, server func() any) any {
+	return ByEnv(name, server, nil)
+}
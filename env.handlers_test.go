@@ -0,0 +1,31 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+func TestByEnv_ServerBuilds(t *testing.T) {
+	client := func() any {
+		t.Error("client builder must not run in server builds")
+		return &UserController{}
+	}
+	cp := crudp.NewDefault()
+	err := cp.RegisterHandler(
+		crudp.ByEnv("user_controller", newUserController, client),
+		crudp.ServerOnly("validated_handler", func() any { return &ValidatedHandler{} }),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := cp.CallHandler(context.Background(), 0, 'r'); err != nil {
+		t.Errorf("server handler not registered: %v", err)
+	}
+	if cp.GetHandlerName(1) != "validated_handler" {
+		t.Errorf("ServerOnly handler not registered, got %q", cp.GetHandlerName(1))
+	}
+}
@@ -0,0 +1,14 @@
+//go:build wasm
+
+package crudp
+
+// ByEnv registers the handler built by client in WASM builds and the one
+// built by server in server builds, under name at the same ID
+func ByEnv(name string, server, client func() any) any {
+	return envHandler{name: name, build: client}
+}
+
+// ServerOnly leaves the ID of a server-only handler free in WASM builds
+func ServerOnly(name string, server func() any) any {
+	return ByEnv(name, server, nil)
+}
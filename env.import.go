@@ -0,0 +1,280 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// defaultImportChunk is the rows per Create packet when Config.ImportChunk is 0
+const defaultImportChunk = 100
+
+// importRow is a decoded row waiting for Create
+type importRow struct {
+	row  int
+	item any
+}
+
+// handleImport reads CSV or NDJSON rows into the handler type, validates
+// them and, unless dry_run is set, creates the valid ones in chunks
+func (cp *CrudP) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.PathValue("handler")
+	id, ok := cp.HandlerID(name)
+	if !ok || cp.table()[id].Create == nil || handlerType(cp.table()[id].handler).Kind() != reflect.Struct {
+		http.Error(w, "No import for "+name, http.StatusNotFound)
+		return
+	}
+	handler := &cp.table()[id]
+
+	query := r.URL.Query()
+	report := ImportReport{DryRun: query.Get("dry_run") == "1" || query.Get("dry_run") == "true"}
+	body := http.MaxBytesReader(w, r.Body, cp.maxUpload())
+
+	var rows []importRow
+	var err error
+	switch query.Get("format") {
+	case ExportCSV, "":
+		rows, err = cp.importCSV(body, handler, &report)
+	case ExportNDJSON:
+		rows, err = cp.importNDJSON(body, handler, &report)
+	default:
+		err = Err(Fmt("unknown import format %q", query.Get("format")))
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	report.Valid = len(rows)
+
+	if !report.DryRun {
+		ctx := cp.withClientKey(cp.withTenant(WithRemoteAddr(r.Context(), RemoteIP(r))))
+		cp.importRows(ctx, id, rows, &report)
+	}
+	sortRowErrors(report.Errors)
+
+	encoded, err := cp.codec.Encode(&report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(encoded)
+}
+
+// importCSV maps the header columns to fields (json tag names or Go names)
+func (cp *CrudP) importCSV(body io.Reader, handler *actionHandler, report *ImportReport) ([]importRow, error) {
+	t := handlerType(handler.handler)
+	cr := csv.NewReader(body)
+	cr.ReuseRecord = true
+	record, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	header := append([]string(nil), record...) // Records are reused
+
+	fields := make([]int, len(header))
+	for i, column := range header {
+		fields[i] = -1
+		for j := 0; j < t.NumField(); j++ {
+			if f := t.Field(j); f.IsExported() && jsonName(f) == column {
+				fields[i] = j
+				break
+			}
+		}
+		if fields[i] < 0 {
+			return nil, Err(Fmt("import: unknown column %q for %s", column, handler.name))
+		}
+	}
+
+	var rows []importRow
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		report.Rows++
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			report.Errors = append(report.Errors, RowError{Row: report.Rows, Message: err.Error()})
+			continue
+		}
+
+		item := reflect.New(t)
+		for i, value := range record {
+			if err = setField(item.Elem().Field(fields[i]), value); err != nil {
+				err = Err(Fmt("%s: %v", header[i], err))
+				break
+			}
+		}
+		if err == nil {
+			err = validateRow(handler, item.Interface())
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, RowError{Row: report.Rows, Message: err.Error()})
+			continue
+		}
+		rows = append(rows, importRow{row: report.Rows, item: item.Interface()})
+	}
+}
+
+// importNDJSON decodes one JSON document per line (blank lines are skipped)
+func (cp *CrudP) importNDJSON(body io.Reader, handler *actionHandler, report *ImportReport) ([]importRow, error) {
+	t := handlerType(handler.handler)
+	json := getDefaultCodec()
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(nil, 1<<20)
+
+	var rows []importRow
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		report.Rows++
+		item := reflect.New(t).Interface()
+		err := json.Decode(line, item)
+		if err == nil {
+			err = validateRow(handler, item)
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, RowError{Row: report.Rows, Message: err.Error()})
+			continue
+		}
+		rows = append(rows, importRow{row: report.Rows, item: item})
+	}
+	return rows, scanner.Err()
+}
+
+func validateRow(handler *actionHandler, item any) error {
+	if validator, ok := handler.handler.(Validator); ok {
+		return validator.Validate('c', item)
+	}
+	return nil
+}
+
+// importRows sends the rows as 'c' packets of Config.ImportChunk items
+// through the usual packet pipeline (policy, middleware, sinks, broadcasts)
+func (cp *CrudP) importRows(ctx context.Context, handlerID uint8, rows []importRow, report *ImportReport) {
+	size := cp.config.ImportChunk
+	if size <= 0 {
+		size = defaultImportChunk
+	}
+	co := cp.newCallOptions(nil)
+
+	for start := 0; start < len(rows); start += size {
+		chunk := rows[start:min(start+size, len(rows))]
+		packet := Packet{Action: 'c', HandlerID: handlerID, ReqID: "import." + strconv.Itoa(start/size+1)}
+		for _, row := range chunk {
+			encoded, err := co.codec.Encode(row.item)
+			if err != nil {
+				report.Errors = append(report.Errors, RowError{Row: row.row, Message: err.Error()})
+				chunk = nil
+				break
+			}
+			packet.Data = append(packet.Data, encoded)
+		}
+		if chunk == nil {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			for _, row := range chunk {
+				report.Errors = append(report.Errors, RowError{Row: row.row, Message: err.Error()})
+			}
+			continue
+		}
+		pr, _ := cp.processSinglePacket(ctx, &co, &packet)
+		failed := 0
+		for _, item := range pr.Items {
+			if item.Failed() && item.Index < len(chunk) {
+				report.Errors = append(report.Errors, RowError{Row: chunk[item.Index].row, Message: item.Message})
+				failed++
+			}
+		}
+		if pr.MessageType == uint8(Msg.Error) && len(pr.Items) == 0 {
+			for _, row := range chunk {
+				report.Errors = append(report.Errors, RowError{Row: row.row, Message: pr.Message})
+			}
+			continue
+		}
+		report.Created += len(chunk) - failed
+	}
+}
+
+// sortRowErrors orders errors by row; chunks add theirs after parse errors
+func sortRowErrors(errs []RowError) {
+	for i := 1; i < len(errs); i++ {
+		for j := i; j > 0 && errs[j].Row < errs[j-1].Row; j-- {
+			errs[j], errs[j-1] = errs[j-1], errs[j]
+		}
+	}
+}
+
+// setField parses a CSV cell into a field of a basic kind
+func setField(f reflect.Value, value string) error {
+	if value == "" {
+		return nil // Zero value
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.Pointer:
+		elem := reflect.New(f.Type().Elem())
+		if err := setField(elem.Elem(), value); err != nil {
+			return err
+		}
+		f.Set(elem)
+	default:
+		return Err(Fmt("unsupported column type %s", f.Type()))
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Contact is imported from CSV or NDJSON
+type Contact struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Age   int    `json:"age"`
+}
+
+var contactChunks [][]string
+
+func (h *Contact) Validate(action byte, data ...any) error {
+	for _, item := range data {
+		if !strings.Contains(item.(*Contact).Email, "@") {
+			return Errf("invalid email")
+		}
+	}
+	return nil
+}
+
+func (h *Contact) Create(ctx context.Context, data ...any) any {
+	var names []string
+	for _, item := range data {
+		names = append(names, item.(*Contact).Name)
+	}
+	contactChunks = append(contactChunks, names)
+	return data
+}
+
+func TestImportRoute(t *testing.T) {
+	cfg := crudp.DefaultConfig()
+	cfg.ImportChunk = 2
+	cp := crudp.New(cfg, crudp.WithHandlers(&Contact{}, &Invoice{}))
+	router := cp.BuildRouter()
+
+	post := func(url, body string) (int, crudp.ImportReport) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, url, strings.NewReader(body)))
+		var report crudp.ImportReport
+		if w.Code == http.StatusOK {
+			if err := cp.Codec().Decode(w.Body.Bytes(), &report); err != nil {
+				t.Fatalf("decode report: %v", err)
+			}
+		}
+		return w.Code, report
+	}
+	csv := "name,email,age\nAna,ana@x.io,30\nBea,bea@x.io,old\nCel,no-email,20\nDan,dan@x.io,\nEva,eva@x.io,41\n"
+
+	t.Run("Dry Run", func(t *testing.T) {
+		contactChunks = nil
+		code, report := post(cp.ImportURL("contact", crudp.ExportCSV, true), csv)
+		if code != http.StatusOK || !report.DryRun || report.Rows != 5 || report.Valid != 3 || report.Created != 0 {
+			t.Fatalf("unexpected report %d %+v", code, report)
+		}
+		if len(report.Errors) != 2 || report.Errors[0].Row != 2 || !strings.Contains(report.Errors[0].Message, "age") ||
+			report.Errors[1].Row != 3 || report.Errors[1].Message != "invalid email" {
+			t.Errorf("unexpected row errors %+v", report.Errors)
+		}
+		if len(contactChunks) != 0 {
+			t.Errorf("dry run must not create, got %v", contactChunks)
+		}
+	})
+
+	t.Run("Creates Valid Rows In Chunks", func(t *testing.T) {
+		contactChunks = nil
+		code, report := post("/import/contact", csv)
+		if code != http.StatusOK || report.Created != 3 || len(report.Errors) != 2 {
+			t.Fatalf("unexpected report %d %+v", code, report)
+		}
+		if len(contactChunks) != 2 || strings.Join(contactChunks[0], ",") != "Ana,Dan" || strings.Join(contactChunks[1], ",") != "Eva" {
+			t.Errorf("unexpected chunks %v", contactChunks)
+		}
+	})
+
+	t.Run("NDJSON", func(t *testing.T) {
+		contactChunks = nil
+		body := `{"name":"Ana","email":"ana@x.io","age":30}` + "\n\n" + `{"name":"Bob","email":"bob"}` + "\n"
+		code, report := post(cp.ImportURL("contact", crudp.ExportNDJSON, false), body)
+		if code != http.StatusOK || report.Rows != 2 || report.Created != 1 || len(report.Errors) != 1 || report.Errors[0].Row != 2 {
+			t.Errorf("unexpected report %d %+v", code, report)
+		}
+	})
+
+	t.Run("Rejected Requests", func(t *testing.T) {
+		if code, _ := post("/import/contact", "name,phone\nAna,1\n"); code != http.StatusBadRequest {
+			t.Errorf("unknown column: expected 400, got %d", code)
+		}
+		if code, _ := post("/import/invoice", "id\n1\n"); code != http.StatusNotFound {
+			t.Errorf("handler without Create: expected 404, got %d", code)
+		}
+	})
+
+	t.Run("Action Policy Applies", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.ActionPolicy = crudp.ActionPolicy{"contact": "c"}
+		locked := crudp.New(cfg, crudp.WithHandlers(&Contact{}))
+		w := httptest.NewRecorder()
+		locked.BuildRouter().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/import/contact", strings.NewReader(csv)))
+		var report crudp.ImportReport
+		locked.Codec().Decode(w.Body.Bytes(), &report)
+		if report.Created != 0 || len(report.Errors) != 5 {
+			t.Errorf("expected every row rejected, got %+v", report)
+		}
+	})
+}
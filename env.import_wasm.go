@@ -0,0 +1,56 @@
+//go:build wasm
+
+package crudp
+
+import (
+	"syscall/js"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// Import posts a browser File with CSV or NDJSON rows to the import route of
+// handler (see ImportURL) and calls done with the report. Run it with dryRun
+// first to show the rejected rows before creating anything.
+func (cp *CrudP) Import(handler string, file js.Value, format string, dryRun bool, done func(ImportReport, error)) {
+	init := js.Global().Get("Object").New()
+	init.Set("method", "POST")
+	init.Set("body", file)
+
+	var onResponse, onBody, onText, onError js.Func
+	release := func() {
+		onResponse.Release()
+		onBody.Release()
+		onText.Release()
+		onError.Release()
+	}
+	fail := func(this js.Value, args []js.Value) any {
+		release()
+		done(ImportReport{}, Err(Fmt("import %s: %s", handler, args[0].String())))
+		return nil
+	}
+	onError = js.FuncOf(fail)
+	onText = js.FuncOf(fail)
+	onBody = js.FuncOf(func(this js.Value, args []js.Value) any {
+		release()
+		data := js.Global().Get("Uint8Array").New(args[0])
+		body := make([]byte, data.Get("length").Int())
+		js.CopyBytesToGo(body, data)
+
+		var report ImportReport
+		if err := cp.codec.Decode(body, &report); err != nil {
+			done(ImportReport{}, err)
+			return nil
+		}
+		done(report, nil)
+		return nil
+	})
+	onResponse = js.FuncOf(func(this js.Value, args []js.Value) any {
+		resp := args[0]
+		if !resp.Get("ok").Bool() {
+			return resp.Call("text").Call("then", onText, onError)
+		}
+		return resp.Call("arrayBuffer").Call("then", onBody, onError)
+	})
+
+	js.Global().Call("fetch", cp.ImportURL(handler, format, dryRun), init).Call("then", onResponse).Call("catch", onError)
+}
@@ -0,0 +1,50 @@
+//go:build wasm
+
+package crudp
+
+import (
+	"syscall/js"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// FetchSchema loads the Schema of the server (APIEndpoint + "/schema"), e.g.
+// to build forms for handlers this build was not compiled with
+func (cp *CrudP) FetchSchema(done func([]HandlerSchema, error)) {
+	var onResponse, onBody, onError js.Func
+	release := func() {
+		onResponse.Release()
+		onBody.Release()
+		onError.Release()
+	}
+	onError = js.FuncOf(func(this js.Value, args []js.Value) any {
+		release()
+		done(nil, Err(Fmt("schema: %s", args[0].String())))
+		return nil
+	})
+	onBody = js.FuncOf(func(this js.Value, args []js.Value) any {
+		release()
+		data := js.Global().Get("Uint8Array").New(args[0])
+		body := make([]byte, data.Get("length").Int())
+		js.CopyBytesToGo(body, data)
+
+		var schema []HandlerSchema
+		if err := cp.codec.Decode(body, &schema); err != nil {
+			done(nil, err)
+			return nil
+		}
+		done(schema, nil)
+		return nil
+	})
+	onResponse = js.FuncOf(func(this js.Value, args []js.Value) any {
+		resp := args[0]
+		if !resp.Get("ok").Bool() {
+			release()
+			done(nil, Err(Fmt("schema: HTTP %d", resp.Get("status").Int())))
+			return nil
+		}
+		return resp.Call("arrayBuffer").Call("then", onBody, onError)
+	})
+
+	js.Global().Call("fetch", cp.EndpointURL(cp.schemaEndpoint())).Call("then", onResponse).Call("catch", onError)
+}
@@ -0,0 +1,45 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+func TestMount_Profiles(t *testing.T) {
+	admin := crudp.New(crudp.ProfileConfig("admin"), crudp.WithHandlers(&UserController{}, &ValidatedHandler{}))
+	public := crudp.New(crudp.ProfileConfig("public"), crudp.WithHandlers(&explicitNameHandler{}))
+	mux := http.NewServeMux()
+	admin.Mount(mux)
+	public.Mount(mux)
+
+	schema := func(path string) []crudp.HandlerSchema {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", path, w.Code)
+		}
+		var got []crudp.HandlerSchema
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		return got
+	}
+	if got := schema("/admin/api/schema"); len(got) != 2 || got[0].Name != "user_controller" {
+		t.Errorf("admin schema: %+v", got)
+	}
+	if got := schema("/public/api/schema"); len(got) != 1 || got[0].Name != "my_custom_name" {
+		t.Errorf("public schema: %+v", got)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/schema", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 outside the profiles, got %d", w.Code)
+	}
+}
@@ -0,0 +1,34 @@
+//go:build wasm
+
+package crudp
+
+import "syscall/js"
+
+// WatchNetwork follows navigator.onLine and the window online/offline events,
+// calling SetNetworkOnline on every change; stop removes the listeners
+func (cp *CrudP) WatchNetwork() (stop func()) {
+	window := js.Global()
+	if navigator := window.Get("navigator"); !navigator.IsUndefined() {
+		if online := navigator.Get("onLine"); online.Type() == js.TypeBoolean {
+			cp.SetNetworkOnline(online.Bool())
+		}
+	}
+
+	onOnline := js.FuncOf(func(this js.Value, args []js.Value) any {
+		cp.SetNetworkOnline(true)
+		return nil
+	})
+	onOffline := js.FuncOf(func(this js.Value, args []js.Value) any {
+		cp.SetNetworkOnline(false)
+		return nil
+	})
+	window.Call("addEventListener", "online", onOnline)
+	window.Call("addEventListener", "offline", onOffline)
+
+	return func() {
+		window.Call("removeEventListener", "online", onOnline)
+		window.Call("removeEventListener", "offline", onOffline)
+		onOnline.Release()
+		onOffline.Release()
+	}
+}
@@ -3,8 +3,13 @@
 package crudp
 
 import (
+	"context"
 	"io"
+	"net"
 	"net/http"
+	"strconv"
+
+	. "github.com/cdvelop/tinystring"
 )
 
 // Optional: Add custom HTTP routes (e.g., /upload, /export)
@@ -21,19 +26,33 @@ type MiddlewareProvider interface {
 func (cp *CrudP) BuildRouter() http.Handler {
 	mux := http.NewServeMux()
 
-	// 1. Register CRUDP's binary protocol endpoint (configurable)
+	// 1. Register CRUDP's binary protocol and event stream endpoints (configurable)
 	mux.HandleFunc(cp.config.APIEndpoint, cp.handleBinaryProtocol)
+	mux.HandleFunc(cp.schemaEndpoint(), cp.handleSchema)
+	if cp.serveSSE() {
+		mux.HandleFunc(cp.config.SSEEndpoint, cp.handleSSE)
+	}
+	if cp.config.FileStore != nil {
+		mux.HandleFunc(cp.config.UploadEndpoint, cp.handleUpload)
+	}
+	if cp.hasExporters() {
+		mux.HandleFunc(cp.exportPattern(), cp.handleExport)
+	}
+	if cp.config.ImportEndpoint != "" {
+		mux.HandleFunc(cp.config.ImportEndpoint+"/{handler}", cp.handleImport)
+	}
 
 	// 2. Collect all global middleware from handlers
+	handlers := cp.table()
 	var globalMiddleware []func(http.Handler) http.Handler
-	for _, h := range cp.handlers {
+	for _, h := range handlers {
 		if mwProvider, ok := h.handler.(MiddlewareProvider); ok {
 			globalMiddleware = append(globalMiddleware, mwProvider.Middleware)
 		}
 	}
 
 	// 3. Let handlers register their custom HTTP routes
-	for _, h := range cp.handlers {
+	for _, h := range handlers {
 		if routeProvider, ok := h.handler.(HttpRouteProvider); ok {
 			routeProvider.RegisterRoutes(mux)
 		}
@@ -45,7 +64,98 @@ func (cp *CrudP) BuildRouter() http.Handler {
 		handler = mw(handler)
 	}
 
-	return handler
+	// 5. CORS outside so preflight never reaches handler middleware
+	handler = cp.corsMiddleware(handler)
+
+	// 6. Proxies: strip Config.BasePath, then read the forwarded client
+	if cp.config.BasePath != "" {
+		handler = http.StripPrefix(cp.config.BasePath, handler)
+	}
+	return cp.forwarded(handler)
+}
+
+// Mount registers BuildRouter on mux under Config.BasePath, so instances
+// with their own handlers, endpoints and SSE hubs share one router:
+//
+//	admin := crudp.New(crudp.ProfileConfig("admin"), crudp.WithHandlers(adminModules...))
+//	public := crudp.New(crudp.ProfileConfig("public"), crudp.WithHandlers(publicModules...))
+//	admin.Mount(mux)  // /admin/api, /admin/events, ...
+//	public.Mount(mux) // /public/api, /public/events, ...
+//
+// Without BasePath the router takes "/": mount one such instance per mux.
+func (cp *CrudP) Mount(mux *http.ServeMux) {
+	pattern := cp.config.BasePath + "/"
+	mux.Handle(pattern, cp.BuildRouter())
+	cp.log.Info("router mounted", "profile", cp.config.Profile, "pattern", pattern)
+}
+
+// serveSSE reports whether SSEEndpoint is set and distinct from APIEndpoint
+func (cp *CrudP) serveSSE() bool {
+	return cp.config.SSEEndpoint != "" && cp.config.SSEEndpoint != cp.config.APIEndpoint
+}
+
+// checkRoutes registers every route on a scratch mux to detect conflicts (used by SelfCheck)
+func (cp *CrudP) checkRoutes() (problems []string) {
+	if cp.config.APIEndpoint == cp.config.SSEEndpoint {
+		problems = append(problems, "routes: APIEndpoint and SSEEndpoint are both "+cp.config.APIEndpoint)
+	}
+	if base := cp.config.BasePath; base != "" && (base[0] != '/' || base[len(base)-1] == '/') {
+		problems = append(problems, "routes: BasePath "+base+" must start with / and not end with it")
+	}
+	if _, err := parseProxies(cp.config.TrustedProxies); err != nil {
+		problems = append(problems, "routes: TrustedProxies: "+err.Error())
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(cp.config.APIEndpoint, cp.handleBinaryProtocol)
+	mux.HandleFunc(cp.schemaEndpoint(), cp.handleSchema)
+	if cp.serveSSE() {
+		mux.HandleFunc(cp.config.SSEEndpoint, cp.handleSSE)
+	}
+	if cp.config.FileStore != nil {
+		if cp.config.UploadEndpoint == cp.config.APIEndpoint || cp.config.UploadEndpoint == cp.config.SSEEndpoint {
+			problems = append(problems, "routes: UploadEndpoint "+cp.config.UploadEndpoint+" is already used")
+		} else {
+			mux.HandleFunc(cp.config.UploadEndpoint, cp.handleUpload)
+		}
+	}
+	if cp.hasExporters() {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					problems = append(problems, Fmt("routes: ExportEndpoint: %v", r))
+				}
+			}()
+			mux.HandleFunc(cp.exportPattern(), cp.handleExport)
+		}()
+	}
+	if cp.config.ImportEndpoint != "" {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					problems = append(problems, Fmt("routes: ImportEndpoint: %v", r))
+				}
+			}()
+			mux.HandleFunc(cp.config.ImportEndpoint+"/{handler}", cp.handleImport)
+		}()
+	}
+
+	for _, h := range cp.table() {
+		routeProvider, ok := h.handler.(HttpRouteProvider)
+		if !ok {
+			continue
+		}
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					problems = append(problems, Fmt("routes: handler %s: %v", h.name, r))
+				}
+			}()
+			routeProvider.RegisterRoutes(mux)
+		}()
+	}
+
+	return problems
 }
 
 // handleBinaryProtocol processes CRUDP binary batch requests
@@ -54,6 +164,10 @@ func (cp *CrudP) handleBinaryProtocol(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if mediaType(r.Header.Get("Content-Type")) == ContentTypeStream {
+		cp.handleStream(w, r)
+		return
+	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -61,12 +175,102 @@ func (cp *CrudP) handleBinaryProtocol(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, err := cp.ProcessBatch(r.Context(), body)
+	// Respond in the codec the client used; unknown types use the default codec
+	contentType := "application/octet-stream"
+	var opts []CallOption
+	if codec, ok := cp.CodecFor(r.Header.Get("Content-Type")); ok {
+		contentType = mediaType(r.Header.Get("Content-Type"))
+		opts = append(opts, WithCodec(codec))
+	}
+
+	if batchID := r.Header.Get(ChunkBatchHeader); batchID != "" {
+		seq, err := strconv.ParseUint(r.Header.Get(ChunkSeqHeader), 10, 32)
+		if err != nil {
+			http.Error(w, "invalid "+ChunkSeqHeader, http.StatusBadRequest)
+			return
+		}
+		opts = append(opts, WithChunk(batchID, uint32(seq), r.Header.Get(ChunkFinalHeader) == "1"))
+	}
+
+	ctx := WithLocale(WithRemoteAddr(r.Context(), RemoteIP(r)), AcceptLocale(r.Header.Get("Accept-Language")))
+	ctx, err = cp.VerifyRequest(ctx, r, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	response, err := cp.ProcessBatch(ctx, body, opts...)
+	if r.Context().Err() != nil {
+		return // Client disconnected, nobody reads the response
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Type", contentType)
 	w.Write(response)
 }
+
+// VerifyRequest checks the batch signature headers of r against body when
+// Config.SigningKeys is set and records the signer in ctx (see SignedBy).
+// BuildRouter calls it for every batch; other net/http transports (e.g. the
+// grpc package) call it before ProcessBatch so signing is enforced the same way.
+func (cp *CrudP) VerifyRequest(ctx context.Context, r *http.Request, body []byte) (context.Context, error) {
+	if cp.config.SigningKeys == nil {
+		return ctx, nil
+	}
+	ctx, err := cp.verifySignature(ctx, r.Header.Get(SignatureKeyHeader), r.Header.Get(SignatureTimeHeader), r.Header.Get(SignatureHeader), body)
+	if err != nil {
+		cp.log.Warn("batch signature rejected", "remote", RemoteIP(r), "error", err)
+	}
+	return ctx, err
+}
+
+// handleStream runs ProcessStream on the request body, writing results as
+// they come; signatures cover whole bodies, so they cannot be required here
+func (cp *CrudP) handleStream(w http.ResponseWriter, r *http.Request) {
+	if cp.config.SigningKeys != nil && cp.config.RequireSignature {
+		http.Error(w, "streamed batches cannot be signed", http.StatusUnauthorized)
+		return
+	}
+
+	// Results are written while the body is still being read
+	http.NewResponseController(w).EnableFullDuplex()
+	w.Header().Set("Content-Type", ContentTypeStream)
+	ctx := WithLocale(WithRemoteAddr(r.Context(), RemoteIP(r)), AcceptLocale(r.Header.Get("Accept-Language")))
+	if err := cp.ProcessStream(ctx, r.Body, w); err != nil && r.Context().Err() == nil {
+		cp.log.Warn("stream aborted", "remote", RemoteIP(r), "error", err)
+	}
+}
+
+// handleSchema answers Schema encoded with the codec the client asked for
+func (cp *CrudP) handleSchema(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	codec, contentType := cp.codec, "application/json"
+	if c, ok := cp.CodecFor(r.Header.Get("Accept")); ok {
+		codec, contentType = c, mediaType(r.Header.Get("Accept"))
+	}
+	encoded, err := codec.Encode(cp.Schema())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(encoded)
+}
+
+// RemoteIP returns the client IP of r without port, the address BuildRouter
+// stores with WithRemoteAddr; other net/http transports should use it too
+// so rate limits and audit entries key on the same value. Behind
+// Config.TrustedProxies, BuildRouter sets it from X-Forwarded-For.
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
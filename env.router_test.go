@@ -3,8 +3,10 @@
 package crudp_test
 
 import (
+	"bytes"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/cdvelop/crudp"
@@ -20,6 +22,9 @@ func (h *mockRouteHandler) RegisterRoutes(mux *http.ServeMux) {
 	})
 }
 
+// Another module registering the same route
+type mockRouteCopyHandler struct{ mockRouteHandler }
+
 // Mock handler that implements MiddlewareProvider
 type mockMiddlewareHandler struct{}
 
@@ -182,10 +187,11 @@ func TestBuildRouter_MiddlewareOrder(t *testing.T) {
 	type orderedMiddlewareHandler struct {
 		order int
 	}
+	type orderedMiddlewareHandler2 orderedMiddlewareHandler
 
 	handlers := []any{
 		&orderedMiddlewareHandler{order: 1},
-		&orderedMiddlewareHandler{order: 2},
+		&orderedMiddlewareHandler2{order: 2},
 	}
 
 	cp := crudp.NewDefault()
@@ -243,3 +249,144 @@ func TestHandleBinaryProtocol_MethodNotAllowed(t *testing.T) {
 		t.Errorf("Expected 405 Method Not Allowed, got %d", w.Code)
 	}
 }
+
+func TestHandleBinaryProtocol_Stream(t *testing.T) {
+	cp := crudp.New(crudp.WithHandlers(&Chart{}))
+	var body bytes.Buffer
+	sw := cp.NewStreamWriter(&body)
+	sw.Write('c', 0, "a", &Chart{ID: "1"})
+	sw.Write('r', 0, "b")
+	sw.Close()
+
+	req := httptest.NewRequest("POST", "/api", &body)
+	req.Header.Set("Content-Type", crudp.ContentTypeStream)
+	w := httptest.NewRecorder()
+	cp.BuildRouter().ServeHTTP(w, req)
+
+	if w.Header().Get("Content-Type") != crudp.ContentTypeStream {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var reqIDs []string
+	cp.OnResult(func(pr crudp.PacketResult) { reqIDs = append(reqIDs, pr.ReqID) })
+	if err := cp.ReceiveStream(w.Body); err != nil {
+		t.Fatal(err)
+	}
+	if len(reqIDs) != 2 || reqIDs[0] != "a" || reqIDs[1] != "b" {
+		t.Errorf("unexpected results %v", reqIDs)
+	}
+}
+
+func TestSelfCheck_RouteConflicts(t *testing.T) {
+	cp := crudp.NewDefault()
+	cp.RegisterHandler(&mockRouteHandler{}, &mockRouteCopyHandler{})
+
+	err := cp.SelfCheck()
+	if err == nil || !strings.Contains(err.Error(), "routes: handler mock_route_copy_handler") {
+		t.Errorf("expected route conflict to be reported, got %v", err)
+	}
+
+	cp2 := crudp.New(&crudp.Config{APIEndpoint: "/same", SSEEndpoint: "/same"})
+	if err := cp2.SelfCheck(); err == nil {
+		t.Error("expected endpoint conflict to be reported")
+	}
+}
+
+func TestHandleBinaryProtocol_RateLimitByRemoteIP(t *testing.T) {
+	var trace []string
+	cfg := crudp.DefaultConfig()
+	cfg.RateLimiter = crudp.NewTokenBucket(0.001, 1)
+	cp := crudp.New(cfg)
+	cp.RegisterHandler(&guardedHandler{trace: &trace})
+	router := cp.BuildRouter()
+
+	batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'r'}}})
+	send := func(addr string) crudp.PacketResult {
+		req := httptest.NewRequest("POST", "/api", strings.NewReader(string(batch)))
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp crudp.BatchResponse
+		if err := cp.Codec().Decode(w.Body.Bytes(), &resp); err != nil || len(resp.Results) != 1 {
+			t.Fatalf("unexpected response: %s", w.Body.String())
+		}
+		return resp.Results[0]
+	}
+
+	if r := send("10.0.0.1:5000"); r.RetryAfter != 0 {
+		t.Fatalf("first request must pass, got %+v", r)
+	}
+	if r := send("10.0.0.1:5001"); r.RetryAfter == 0 {
+		t.Errorf("same IP on another port must be throttled, got %+v", r)
+	}
+	if r := send("10.0.0.2:5000"); r.RetryAfter != 0 {
+		t.Errorf("other IP must pass, got %+v", r)
+	}
+}
+
+func TestHandleBinaryProtocol_CodecNegotiation(t *testing.T) {
+	cp := crudp.NewDefault()
+	cp.RegisterHandler(&Note{})
+	router := cp.BuildRouter()
+
+	post := func(contentType string, codec crudp.Codec) (*httptest.ResponseRecorder, crudp.BatchResponse) {
+		data, _ := codec.Encode(&Note{Text: "hi"})
+		batch, _ := codec.Encode(crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'c', ReqID: "n", Data: [][]byte{data}}}})
+		req := httptest.NewRequest("POST", "/api", strings.NewReader(string(batch)))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp crudp.BatchResponse
+		if err := codec.Decode(w.Body.Bytes(), &resp); err != nil || len(resp.Results) != 1 {
+			t.Fatalf("%s: unexpected response %q (%v)", contentType, w.Body.String(), err)
+		}
+		return w, resp
+	}
+
+	json, _ := cp.CodecFor(crudp.ContentTypeJSON)
+	w, resp := post("application/json; charset=utf-8", json)
+	if got := w.Header().Get("Content-Type"); got != crudp.ContentTypeJSON {
+		t.Errorf("expected JSON response, got %q", got)
+	}
+	if resp.Results[0].ReqID != "n" {
+		t.Errorf("unexpected result: %+v", resp.Results[0])
+	}
+
+	frame, _ := cp.CodecFor(crudp.ContentTypeFrame)
+	w, _ = post(crudp.ContentTypeFrame, frame)
+	if got := w.Header().Get("Content-Type"); got != crudp.ContentTypeFrame {
+		t.Errorf("expected framed response, got %q", got)
+	}
+
+	// Custom codecs are picked by their content type
+	custom := crudp.NewFrameCodec(json)
+	cp.RegisterCodec("application/x-custom", custom)
+	w, _ = post("application/x-custom", custom)
+	if got := w.Header().Get("Content-Type"); got != "application/x-custom" {
+		t.Errorf("expected custom response, got %q", got)
+	}
+
+	// Unknown types keep the default codec
+	w, _ = post("text/plain", cp.Codec())
+	if got := w.Header().Get("Content-Type"); got != "application/octet-stream" {
+		t.Errorf("expected default content type, got %q", got)
+	}
+}
+
+func TestSchemaRoute(t *testing.T) {
+	cp := crudp.New(crudp.WithHandlers(&User{}, &Product{}))
+	w := httptest.NewRecorder()
+	cp.BuildRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/schema", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var schema []crudp.HandlerSchema
+	if err := cp.Codec().Decode(w.Body.Bytes(), &schema); err != nil {
+		t.Fatalf("decode schema: %v", err)
+	}
+	if len(schema) != 2 || schema[1].Name != "product" || len(schema[1].Fields) != 6 || len(schema[1].Fields[4].Fields) != 4 {
+		t.Errorf("unexpected schema %+v", schema)
+	}
+}
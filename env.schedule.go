@@ -0,0 +1,111 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"context"
+	"time"
+)
+
+// AddSchedule runs s until Close (New adds Config.Schedules and those of
+// ScheduledHandler handlers). Runs of a schedule never overlap: a slow run
+// delays the next one. The handler is looked up on each run, so it may be
+// registered later.
+func (cp *CrudP) AddSchedule(s Schedule) error {
+	if s.Name == "" {
+		s.Name = s.Handler
+	}
+	if s.Action == 0 {
+		s.Action = 'r'
+	}
+	next, err := s.next()
+	if err != nil {
+		return err
+	}
+	go cp.runSchedule(s, next, cp.schedules.done())
+	cp.log.Info("schedule added", "schedule", s.Name, "handler", s.Handler)
+	return nil
+}
+
+// addSchedules starts Config.Schedules and the schedules of the registered
+// handlers (called by New)
+func (cp *CrudP) addSchedules() error {
+	all := cp.config.Schedules
+	for _, h := range cp.table() {
+		scheduled, ok := h.handler.(ScheduledHandler)
+		if !ok {
+			continue
+		}
+		for _, s := range scheduled.Schedules() {
+			if s.Handler == "" {
+				s.Handler = h.name
+			}
+			all = append(all, s)
+		}
+	}
+	for _, s := range all {
+		if err := cp.AddSchedule(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runSchedule processes the packet of s at each time given by next
+func (cp *CrudP) runSchedule(s Schedule, next func(time.Time) time.Time, stop <-chan struct{}) {
+	for {
+		at := next(time.Now())
+		if at.IsZero() {
+			cp.log.Warn("schedule never runs again", "schedule", s.Name)
+			return
+		}
+		timer := time.NewTimer(time.Until(at))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		cp.runScheduled(&s)
+	}
+}
+
+// runScheduled processes one packet of s through ProcessBatch
+func (cp *CrudP) runScheduled(s *Schedule) {
+	handlerID, ok := cp.HandlerID(s.Handler)
+	if !ok {
+		cp.log.Error("scheduled handler not registered", "schedule", s.Name, "handler", s.Handler)
+		return
+	}
+	packet := Packet{Action: s.Action, HandlerID: handlerID, ReqID: cp.nextReqID()}
+	for _, item := range s.Data {
+		encoded, err := cp.codec.Encode(item)
+		if err != nil {
+			cp.log.Error("schedule data encoding failed", "schedule", s.Name, "error", err)
+			return
+		}
+		packet.Data = append(packet.Data, encoded)
+	}
+	batch, err := cp.codec.Encode(BatchRequest{Packets: []Packet{packet}})
+	if err != nil {
+		cp.log.Error("schedule encoding failed", "schedule", s.Name, "error", err)
+		return
+	}
+
+	ctx := context.WithValue(WithTenant(context.Background(), s.Tenant), scheduleKey{}, s.Name)
+	response, err := cp.ProcessBatch(ctx, batch)
+	var resp BatchResponse
+	if err == nil {
+		err = cp.codec.Decode(response, &resp)
+	}
+	if err != nil {
+		cp.log.Error("scheduled packet failed", "schedule", s.Name, "error", err)
+		return
+	}
+	for i := range resp.Results {
+		if pr := &resp.Results[i]; failed(pr) {
+			cp.log.Warn("scheduled packet failed", "schedule", s.Name, "req_id", pr.ReqID, "message", pr.Message)
+		}
+	}
+	cp.log.Debug("schedule ran", "schedule", s.Name, "req_id", packet.ReqID)
+}
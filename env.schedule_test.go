@@ -0,0 +1,79 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cdvelop/crudp"
+)
+
+// Sweeper deletes expired sessions every 10 ms
+type Sweeper struct {
+	runs chan string
+}
+
+func (h *Sweeper) Schedules() []crudp.Schedule {
+	return []crudp.Schedule{{Name: "sweep", Action: 'd', Every: 10, Tenant: "acme"}}
+}
+
+func (h *Sweeper) Delete(ctx context.Context, data ...any) any {
+	h.runs <- crudp.ScheduleName(ctx) + "/" + crudp.Tenant(ctx)
+	return nil
+}
+
+func TestSchedule_HandlerRuns(t *testing.T) {
+	sweeper := &Sweeper{runs: make(chan string, 8)}
+	audits := make(chan crudp.AuditRecord, 64)
+	cfg := crudp.DefaultConfig()
+	cfg.Auditor = crudp.AuditFunc(func(ctx context.Context, rec crudp.AuditRecord) error {
+		select {
+		case audits <- rec:
+		default:
+		}
+		return nil
+	})
+	server := crudp.New(crudp.WithConfig(cfg), crudp.WithHandlers(sweeper))
+	if err := server.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		select {
+		case run := <-sweeper.runs:
+			if run != "sweep/acme" {
+				t.Fatalf("unexpected run %q", run)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("schedule did not run")
+		}
+	}
+
+	server.Close()
+	time.Sleep(30 * time.Millisecond)
+	for len(sweeper.runs) > 0 {
+		<-sweeper.runs
+	}
+	time.Sleep(30 * time.Millisecond)
+	if len(sweeper.runs) != 0 {
+		t.Fatal("schedule still running after Close")
+	}
+	if rec := <-audits; rec.Handler != "sweeper" || rec.Action != 'd' || !rec.Success {
+		t.Fatalf("scheduled packets skipped the pipeline: %+v", rec)
+	}
+}
+
+func TestSchedule_ConfigErrors(t *testing.T) {
+	cfg := crudp.DefaultConfig()
+	cfg.Schedules = []crudp.Schedule{{Handler: "sweeper", Cron: "0 25 * * *"}}
+	server := crudp.New(crudp.WithConfig(cfg))
+	defer server.Close()
+	if server.Err() == nil {
+		t.Fatal("expected an error for an invalid cron")
+	}
+	if err := server.AddSchedule(crudp.Schedule{Handler: "sweeper"}); err == nil {
+		t.Fatal("expected an error without Every or Cron")
+	}
+}
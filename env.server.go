@@ -0,0 +1,112 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"time"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// tlsConfigurer is implemented by certificate managers such as
+// *autocert.Manager (see Config.Autocert)
+type tlsConfigurer interface {
+	TLSConfig() *tls.Config
+}
+
+// Server returns the http.Server ListenAndServe runs: handler (nil =
+// BuildRouter) on Config.Port with the timeouts, TLS and HTTP/2 settings of
+// Config. Use it to serve on your own listener.
+func (cp *CrudP) Server(handler http.Handler) (*http.Server, error) {
+	if handler == nil {
+		handler = cp.BuildRouter()
+	}
+	c := cp.config
+	srv := &http.Server{
+		Addr:         c.Port,
+		Handler:      handler,
+		ReadTimeout:  time.Duration(c.ReadTimeout) * time.Millisecond,
+		WriteTimeout: time.Duration(c.WriteTimeout) * time.Millisecond,
+		IdleTimeout:  time.Duration(c.IdleTimeout) * time.Millisecond,
+	}
+
+	switch {
+	case c.Autocert != nil:
+		m, ok := c.Autocert.(tlsConfigurer)
+		if !ok {
+			return nil, Err(Fmt("Config.Autocert: %s has no TLSConfig() *tls.Config method", typeName(c.Autocert)))
+		}
+		srv.TLSConfig = m.TLSConfig()
+	case c.TLSCert != "" || c.TLSKey != "":
+		cert, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey)
+		if err != nil {
+			return nil, Err(Fmt("Config.TLSCert: %v", err))
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+
+	if c.HTTP2 {
+		srv.Protocols = new(http.Protocols)
+		srv.Protocols.SetHTTP1(true)
+		srv.Protocols.SetHTTP2(true)
+		srv.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return srv, nil
+}
+
+// ListenAndServe serves handler (nil = BuildRouter) with Server, over HTTPS
+// when Config.TLSCert or Config.Autocert is set, until Shutdown; it then
+// returns nil
+func (cp *CrudP) ListenAndServe(handler http.Handler) error {
+	srv, err := cp.Server(handler)
+	if err != nil {
+		return err
+	}
+	cp.server.mu.Lock()
+	if cp.server.shutdown != nil {
+		cp.server.mu.Unlock()
+		return Errf("server already running")
+	}
+	cp.server.shutdown = srv.Shutdown
+	cp.server.mu.Unlock()
+
+	cp.log.Info("server listening", "addr", srv.Addr, "tls", srv.TLSConfig != nil, "h2c", cp.config.HTTP2)
+	if srv.TLSConfig != nil {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	cp.server.mu.Lock()
+	cp.server.shutdown = nil
+	cp.server.mu.Unlock()
+	return err
+}
+
+// Shutdown stops the server of ListenAndServe: it ends the event streams,
+// waits for the requests in flight until ctx ends, then calls Close
+func (cp *CrudP) Shutdown(ctx context.Context) error {
+	cp.server.mu.Lock()
+	shutdown := cp.server.shutdown
+	cp.server.shutdown = nil
+	if cp.server.stop != nil {
+		close(cp.server.stop)
+		cp.server.stop = nil
+	}
+	cp.server.mu.Unlock()
+
+	var err error
+	if shutdown != nil {
+		err = shutdown(ctx)
+	}
+	if closeErr := cp.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,145 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cdvelop/crudp"
+)
+
+// certManager stands for *autocert.Manager
+type certManager struct{ config *tls.Config }
+
+func (m certManager) TLSConfig() *tls.Config { return m.config }
+
+// selfSigned writes a certificate for 127.0.0.1 and returns its files
+func selfSigned(t *testing.T) (string, string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "crudp test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+// freePort returns a local address nothing listens on
+func freePort(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestServer_Config(t *testing.T) {
+	cfg := crudp.DefaultConfig()
+	cfg.ReadTimeout, cfg.WriteTimeout, cfg.IdleTimeout = 1000, 2000, 3000
+	cfg.HTTP2 = true
+	srv, err := crudp.New(cfg).Server(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if srv.Addr != ":6060" || srv.ReadTimeout != time.Second || srv.WriteTimeout != 2*time.Second || srv.IdleTimeout != 3*time.Second {
+		t.Errorf("unexpected server: %s %v %v %v", srv.Addr, srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+	if srv.Protocols == nil || !srv.Protocols.UnencryptedHTTP2() || !srv.Protocols.HTTP1() {
+		t.Error("expected h2c next to HTTP/1")
+	}
+	if srv.TLSConfig != nil {
+		t.Error("expected no TLS without certificates")
+	}
+
+	managed := &tls.Config{MinVersion: tls.VersionTLS13}
+	cfg.Autocert = certManager{managed}
+	if srv, err := crudp.New(cfg).Server(nil); err != nil || srv.TLSConfig != managed {
+		t.Errorf("expected the TLS config of Autocert (%v)", err)
+	}
+	cfg.Autocert = struct{}{}
+	if _, err := crudp.New(cfg).Server(nil); err == nil {
+		t.Error("expected an error for an Autocert without TLSConfig")
+	}
+
+	cfg.Autocert = nil
+	cfg.TLSCert, cfg.TLSKey = "missing.pem", "missing.key"
+	if _, err := crudp.New(cfg).Server(nil); err == nil {
+		t.Error("expected an error for missing certificate files")
+	}
+}
+
+func TestServer_TLSAndShutdown(t *testing.T) {
+	cfg := crudp.DefaultConfig()
+	cfg.Port = freePort(t)
+	cfg.TLSCert, cfg.TLSKey = selfSigned(t)
+	cfg.SSEHeartbeat = 0
+	cp := crudp.New(cfg, crudp.WithHandlers(&sseHandler{}))
+
+	served := make(chan error, 1)
+	go func() { served <- cp.ListenAndServe(nil) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	var resp *http.Response
+	var err error
+	for range 50 {
+		if resp, err = client.Get("https://" + cfg.Port + cfg.SSEEndpoint); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("server not reachable: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("expected HTTP/2 over TLS, got %s", resp.Proto)
+	}
+
+	// The open event stream must not hold Shutdown until its deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := cp.Shutdown(ctx); err != nil {
+		t.Errorf("unexpected shutdown error: %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("shutdown waited %v for the event stream", time.Since(start))
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("expected nil after Shutdown, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("ListenAndServe did not return")
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SignRequest sets the signature headers of a batch request (machine to
+// machine clients); body must be the exact request body
+func SignRequest(r *http.Request, keyID string, secret []byte, body []byte) {
+	ts := time.Now().Unix()
+	r.Header.Set(SignatureKeyHeader, keyID)
+	r.Header.Set(SignatureTimeHeader, strconv.FormatInt(ts, 10))
+	r.Header.Set(SignatureHeader, Signature(secret, ts, body))
+}
@@ -0,0 +1,91 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cdvelop/crudp"
+)
+
+// Signer answers with the key ID that signed the batch
+type Signer struct {
+	KeyID string
+}
+
+func (h *Signer) Read(ctx context.Context, data ...any) any {
+	return &Signer{KeyID: crudp.SignedBy(ctx)}
+}
+
+func TestHandleBinaryProtocol_Signature(t *testing.T) {
+	keys := map[string][]byte{"billing": []byte("billing-secret")}
+	cfg := crudp.DefaultConfig()
+	cfg.SigningKeys = crudp.SigningKeyFunc(func(id string) ([]byte, bool) {
+		k, ok := keys[id]
+		return k, ok
+	})
+	cp := crudp.New(cfg, crudp.WithHandlers(&Signer{}))
+	router := cp.BuildRouter()
+
+	body, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'r', HandlerID: 0}}})
+	send := func(body []byte, set func(r *http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api", bytes.NewReader(body))
+		if set != nil {
+			set(req)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	keyID := func(w *httptest.ResponseRecorder) string {
+		var resp crudp.BatchResponse
+		if err := cp.Codec().Decode(w.Body.Bytes(), &resp); err != nil || len(resp.Results) != 1 {
+			t.Fatalf("decode: %v", err)
+		}
+		var s Signer
+		cp.DecodeData(&resp.Results[0].Packet, 0, &s)
+		return s.KeyID
+	}
+
+	w := send(body, func(r *http.Request) { crudp.SignRequest(r, "billing", keys["billing"], body) })
+	if w.Code != http.StatusOK || keyID(w) != "billing" {
+		t.Fatalf("signed batch: %d %s", w.Code, w.Body.String())
+	}
+
+	// Unsigned batches use the other authentication
+	if w := send(body, nil); w.Code != http.StatusOK || keyID(w) != "" {
+		t.Errorf("unsigned batch: %d", w.Code)
+	}
+
+	tampered := append(append([]byte(nil), body...), ' ')
+	rejected := map[string]func(r *http.Request){
+		"tampered body": func(r *http.Request) {
+			crudp.SignRequest(r, "billing", keys["billing"], body)
+			r.Body = httptest.NewRequest("POST", "/", bytes.NewReader(tampered)).Body
+		},
+		"wrong secret": func(r *http.Request) { crudp.SignRequest(r, "billing", []byte("guess"), body) },
+		"unknown key":  func(r *http.Request) { crudp.SignRequest(r, "other", keys["billing"], body) },
+		"stale": func(r *http.Request) {
+			ts := time.Now().Add(-time.Hour).Unix()
+			r.Header.Set(crudp.SignatureKeyHeader, "billing")
+			r.Header.Set(crudp.SignatureTimeHeader, strconv.FormatInt(ts, 10))
+			r.Header.Set(crudp.SignatureHeader, crudp.Signature(keys["billing"], ts, body))
+		},
+	}
+	for name, set := range rejected {
+		if w := send(body, set); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, w.Code)
+		}
+	}
+
+	cfg.RequireSignature = true
+	if w := send(body, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("RequireSignature: unsigned batch got %d", w.Code)
+	}
+}
@@ -0,0 +1,58 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"context"
+	"database/sql"
+)
+
+// SQLSinkSchema creates the table used by SQLSinkInsert (adjust types to the database)
+const SQLSinkSchema = `CREATE TABLE IF NOT EXISTS crudp_events (
+	id      INTEGER PRIMARY KEY,
+	time    BIGINT NOT NULL,
+	tenant  TEXT NOT NULL,
+	handler TEXT NOT NULL,
+	action  CHAR(1) NOT NULL,
+	req_id  TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	payload BLOB NOT NULL
+)`
+
+// SQLSinkInsert is the default insert of NewSQLSink
+// Use $1...$7 placeholders for PostgreSQL.
+const SQLSinkInsert = `INSERT INTO crudp_events (time, tenant, handler, action, req_id, user_id, payload) VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+// SQLSink is an EventSink inserting one row per MutationEvent
+// time is in Unix nanoseconds and payload is encoded with AppendPayload.
+type SQLSink struct {
+	db     *sql.DB
+	insert string
+}
+
+// NewSQLSink returns a SQLSink running insert (SQLSinkInsert if "") on db
+// insert takes time, tenant, handler, action, req_id, user_id and payload.
+func NewSQLSink(db *sql.DB, insert string) *SQLSink {
+	if insert == "" {
+		insert = SQLSinkInsert
+	}
+	return &SQLSink{db: db, insert: insert}
+}
+
+type sqlTxKey struct{}
+
+// WithSQLTx makes SQLSink insert in tx, e.g. from a Config.Transactor, so
+// the event is only kept when the mutation commits
+func WithSQLTx(ctx context.Context, tx *sql.Tx) context.Context {
+	return context.WithValue(ctx, sqlTxKey{}, tx)
+}
+
+func (s *SQLSink) Append(ctx context.Context, ev MutationEvent) error {
+	args := []any{ev.Time.UnixNano(), ev.Tenant, ev.Handler, string(ev.Action), ev.ReqID, ev.User, AppendPayload(nil, ev.Payload)}
+	if tx, ok := ctx.Value(sqlTxKey{}).(*sql.Tx); ok {
+		_, err := tx.ExecContext(ctx, s.insert, args...)
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, s.insert, args...)
+	return err
+}
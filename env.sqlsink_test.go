@@ -0,0 +1,82 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+// execDriver records the statements executed through database/sql
+type execDriver struct {
+	execs [][]driver.Value
+}
+
+type execConn struct{ d *execDriver }
+
+type execStmt struct {
+	d     *execDriver
+	query string
+}
+
+func (d *execDriver) Open(name string) (driver.Conn, error) { return execConn{d}, nil }
+
+func (c execConn) Prepare(query string) (driver.Stmt, error) { return execStmt{c.d, query}, nil }
+func (c execConn) Close() error                              { return nil }
+func (c execConn) Begin() (driver.Tx, error)                 { return execTx{}, nil }
+
+type execTx struct{}
+
+func (execTx) Commit() error   { return nil }
+func (execTx) Rollback() error { return nil }
+
+func (s execStmt) Close() error  { return nil }
+func (s execStmt) NumInput() int { return -1 }
+func (s execStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.execs = append(s.d.execs, args)
+	return driver.RowsAffected(1), nil
+}
+func (s execStmt) Query(args []driver.Value) (driver.Rows, error) { return nil, io.EOF }
+
+func TestSQLSink(t *testing.T) {
+	d := &execDriver{}
+	sql.Register("crudp-exec", d)
+	db, err := sql.Open("crudp-exec", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cfg := crudp.DefaultConfig()
+	cfg.EventSink = crudp.NewSQLSink(db, "")
+	cp := crudp.New(cfg, crudp.WithHandlers(&Chart{}))
+	processOne(t, cp, crudp.Packet{Action: 'c', HandlerID: 0, ReqID: "c1"})
+
+	if len(d.execs) != 1 || len(d.execs[0]) != 7 {
+		t.Fatalf("expected one insert with 7 args, got %v", d.execs)
+	}
+	row := d.execs[0]
+	if row[2] != "chart" || row[3] != "c" || row[4] != "c1" {
+		t.Errorf("unexpected row %v", row)
+	}
+	items, err := crudp.SplitPayload(row[6].([]byte))
+	if err != nil || len(items) != 1 {
+		t.Errorf("payload: %v %v", items, err)
+	}
+
+	// Inside a transaction
+	tx, _ := db.Begin()
+	ctx := crudp.WithSQLTx(context.Background(), tx)
+	if err := crudp.NewSQLSink(db, "").Append(ctx, crudp.MutationEvent{Action: 'd'}); err != nil {
+		t.Fatal(err)
+	}
+	tx.Commit()
+	if len(d.execs) != 2 {
+		t.Errorf("insert in tx not executed")
+	}
+}
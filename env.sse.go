@@ -0,0 +1,235 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"encoding/base64"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// sseBuffer is the number of events queued per connection before it is
+// considered dead and dropped
+const sseBuffer = 64
+
+// handleSSE streams broadcasts to one subscriber until it disconnects
+// The stream is SSE, or WebSocket frames when the request asks for an
+// upgrade; ?poll=1 answers the events of one long-poll instead.
+// Keep-alive pings are sent every Config.SSEHeartbeat; a write blocking
+// longer than Config.SSEWriteTimeout or an overflowing buffer drops the
+// connection, so dead clients never stay in the hub. Shutdown ends the stream.
+func (cp *CrudP) handleSSE(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// ?channels=patient:*,news selects the channels, none = all
+	patterns := splitChannels(r.URL.Query().Get("channels"))
+	ctx := cp.withTenant(WithRemoteAddr(r.Context(), RemoteIP(r)))
+	if err := cp.AuthorizeSubscription(ctx, patterns...); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	patterns = cp.StreamChannels(ctx, patterns)
+
+	events := make(chan Event, sseBuffer)
+	dead := make(chan struct{})
+	var once sync.Once
+	tenant := Tenant(ctx)
+	id := cp.hub.attach(&tenant, func(ev Event) {
+		select {
+		case events <- ev:
+		default:
+			once.Do(func() { close(dead) }) // Slow consumer
+		}
+	}, patterns...)
+	defer cp.hub.detach(id)
+
+	if r.URL.Query().Get("poll") != "" {
+		cp.servePoll(w, r, events)
+		return
+	}
+
+	var stream eventStream
+	done := r.Context().Done()
+	if isWebSocket(r) {
+		ws, err := cp.acceptWebSocket(w, r)
+		if err != nil {
+			cp.log.Warn("WebSocket upgrade failed", "remote", RemoteIP(r), "error", err)
+			return
+		}
+		defer ws.close()
+		stream, done = ws, ws.done
+	} else {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		rc := http.NewResponseController(w)
+		rc.SetWriteDeadline(time.Time{}) // Streams outlive Config.WriteTimeout
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		stream = &sseStream{cp: cp, w: w, rc: rc}
+	}
+
+	// Current users first, then our own join goes through the hub
+	if patterns == nil || matchesAny(patterns, PresenceChannel) {
+		for _, ev := range cp.presenceSnapshot(tenant) {
+			if err := stream.event(ev); err != nil {
+				return
+			}
+		}
+	}
+	if on, _ := cp.Maintenance(); on && (patterns == nil || matchesAny(patterns, MaintenanceChannel)) {
+		if ev, err := cp.maintenanceEvent(); err == nil {
+			if err := stream.event(ev); err != nil {
+				return
+			}
+		}
+	}
+	defer cp.presence.Join(ctx)()
+
+	var heartbeat <-chan time.Time
+	if cp.config.SSEHeartbeat > 0 {
+		ticker := time.NewTicker(time.Duration(cp.config.SSEHeartbeat) * time.Millisecond)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	stopping := cp.server.stopping()
+	for {
+		var err error
+		select {
+		case <-done:
+			return
+		case <-stopping:
+			return
+		case <-dead:
+			cp.log.Warn("SSE subscriber dropped", "remote", RemoteIP(r), "reason", "buffer full")
+			return
+		case <-heartbeat:
+			err = stream.ping()
+		case ev := <-events:
+			err = stream.event(ev)
+		}
+
+		if err != nil {
+			cp.log.Warn("SSE subscriber dropped", "remote", RemoteIP(r), "error", err)
+			return
+		}
+	}
+}
+
+// eventStream writes events to one subscriber
+type eventStream interface {
+	event(ev Event) error
+	ping() error
+}
+
+// sseStream writes text/event-stream messages
+type sseStream struct {
+	cp *CrudP
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (s *sseStream) event(ev Event) error {
+	msg := s.cp.sseMessage(ev)
+	if msg == nil {
+		return nil
+	}
+	return s.cp.writeSSE(s.w, s.rc, msg)
+}
+
+func (s *sseStream) ping() error {
+	return s.cp.writeSSE(s.w, s.rc, []byte(": ping\n\n"))
+}
+
+// pollWait is how long a long-poll request waits for an event (ms)
+const pollWait = 25000
+
+// servePoll answers the events available within pollWait as SSE messages,
+// an empty body when none came. Events broadcast between two polls are
+// missed, and long-poll clients are not tracked by Presence.
+func (cp *CrudP) servePoll(w http.ResponseWriter, r *http.Request, events chan Event) {
+	// Headers go out first so clients know the poll is accepted
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := http.NewResponseController(w).Flush(); err != nil {
+		return
+	}
+
+	timer := time.NewTimer(pollWait * time.Millisecond)
+	defer timer.Stop()
+
+	var body []byte
+	select {
+	case <-r.Context().Done():
+		return
+	case <-timer.C:
+	case ev := <-events:
+		body = append(body, cp.sseMessage(ev)...)
+		for more := true; more; {
+			select {
+			case ev := <-events:
+				body = append(body, cp.sseMessage(ev)...)
+			default:
+				more = false
+			}
+		}
+	}
+
+	w.Write(body)
+}
+
+// writeSSE writes and flushes msg within Config.SSEWriteTimeout
+func (cp *CrudP) writeSSE(w http.ResponseWriter, rc *http.ResponseController, msg []byte) error {
+	if cp.config.SSEWriteTimeout > 0 {
+		// Not supported by every ResponseWriter (e.g. httptest.ResponseRecorder)
+		rc.SetWriteDeadline(time.Now().Add(time.Duration(cp.config.SSEWriteTimeout) * time.Millisecond))
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
+
+// sseMessage encodes ev as an SSE message, nil on error
+func (cp *CrudP) sseMessage(ev Event) []byte {
+	encoded, err := cp.codec.Encode(ev)
+	if err != nil {
+		cp.log.Error("SSE encoding failed", "channel", ev.Channel, "error", err)
+		return nil
+	}
+	return appendSSEEvent(nil, ev.Channel, encoded)
+}
+
+// appendSSEEvent formats an event; data is base64 so binary codecs survive
+func appendSSEEvent(dst []byte, channel string, encoded []byte) []byte {
+	dst = append(dst, "event: "...)
+	dst = append(dst, channel...)
+	dst = append(dst, "\ndata: "...)
+	dst = base64.StdEncoding.AppendEncode(dst, encoded)
+	return append(dst, "\n\n"...)
+}
+
+// splitChannels splits a comma separated list, "" = ["*"]
+func splitChannels(list string) []string {
+	var patterns []string
+	start := 0
+	for i := 0; i <= len(list); i++ {
+		if i == len(list) || list[i] == ',' {
+			if i > start {
+				patterns = append(patterns, list[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if len(patterns) == 0 {
+		return []string{"*"}
+	}
+	return patterns
+}
@@ -0,0 +1,338 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cdvelop/crudp"
+)
+
+func newSSEServer(t *testing.T, heartbeat int) (*crudp.CrudP, *httptest.Server) {
+	cfg := crudp.DefaultConfig()
+	cfg.SSEHeartbeat = heartbeat
+	cp := crudp.New(cfg, crudp.WithHandlers(&sseHandler{}))
+	srv := httptest.NewServer(cp.BuildRouter())
+	t.Cleanup(srv.Close)
+	return cp, srv
+}
+
+func openSSE(t *testing.T, ctx context.Context, url string) *bufio.Reader {
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /events: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// readUntil returns the first line with prefix
+func readUntil(t *testing.T, r *bufio.Reader, prefix string) string {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading stream for %q: %v", prefix, err)
+		}
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimSpace(strings.TrimPrefix(line, prefix))
+		}
+	}
+}
+
+func waitSubscribers(t *testing.T, cp *crudp.CrudP, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for cp.Subscribers() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d subscribers, got %d", want, cp.Subscribers())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSSE_HeartbeatAndEvents(t *testing.T) {
+	cp, srv := newSSEServer(t, 20)
+	stream := openSSE(t, context.Background(), srv.URL+"/events")
+
+	readUntil(t, stream, ": ping")
+
+	processOne(t, cp, crudp.Packet{Action: 'c', ReqID: "sse"})
+	if channel := readUntil(t, stream, "event: "); channel != "channel1" {
+		t.Errorf("expected channel1, got %q", channel)
+	}
+	data := readUntil(t, stream, "data: ")
+
+	client := crudp.NewDefault()
+	var got []crudp.Event
+	client.OnEvent(func(ev crudp.Event) { got = append(got, ev) })
+	if err := client.ReceiveEventData(data); err != nil {
+		t.Fatalf("ReceiveEventData: %v", err)
+	}
+	if len(got) != 1 || got[0].Channel != "channel1" || string(got[0].Data) != `{"message":"broadcast"}` {
+		t.Errorf("unexpected event: %+v", got)
+	}
+}
+
+func TestSSE_PrunesDisconnected(t *testing.T) {
+	cp, srv := newSSEServer(t, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	openSSE(t, ctx, srv.URL+"/events")
+	waitSubscribers(t, cp, 1)
+
+	cancel()
+	waitSubscribers(t, cp, 0)
+}
+
+func TestSSE_ChannelPatterns(t *testing.T) {
+	cfg := crudp.DefaultConfig()
+	cfg.SubscriptionAuthorizer = channelAuthorizer{}
+	cp := crudp.New(cfg, crudp.WithHandlers(&sseHandler{}))
+	srv := httptest.NewServer(cp.BuildRouter())
+	t.Cleanup(srv.Close) // After the stream body is closed
+
+	resp, err := http.Get(srv.URL + "/events?channels=admin:*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for denied channel, got %d", resp.StatusCode)
+	}
+
+	stream := openSSE(t, context.Background(), srv.URL+"/events?channels=channel2")
+	waitSubscribers(t, cp, 1)
+	processOne(t, cp, crudp.Packet{Action: 'c'}) // channel1 and channel2
+	if channel := readUntil(t, stream, "event: "); channel != "channel2" {
+		t.Errorf("expected only channel2, got %q", channel)
+	}
+}
+
+type fixedUser string
+
+func (u fixedUser) GetUserID(context.Context) string { return string(u) }
+
+func TestSSE_Presence(t *testing.T) {
+	cfg := crudp.DefaultConfig()
+	cfg.SSEHeartbeat = 0
+	cfg.Presence = true
+	cfg.UserProvider = fixedUser("alice")
+	cp := crudp.New(cfg)
+	srv := httptest.NewServer(cp.BuildRouter())
+	t.Cleanup(srv.Close)
+
+	client := crudp.New()
+	var got []crudp.PresenceEvent
+	client.Presence().OnPresence(func(pe crudp.PresenceEvent) { got = append(got, pe) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := openSSE(t, ctx, srv.URL+"/events?channels=presence")
+	if channel := readUntil(t, first, "event: "); channel != crudp.PresenceChannel {
+		t.Fatalf("expected presence event, got %q", channel)
+	}
+	if err := client.ReceiveEventData(readUntil(t, first, "data: ")); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].User != "alice" || !got[0].Online {
+		t.Fatalf("expected alice online, got %+v", got)
+	}
+	if list := client.Presence().List(); len(list) != 1 || list[0] != "alice" {
+		t.Fatalf("client list: %v", list)
+	}
+
+	// A second connection of the same user gets the snapshot, no new join
+	second := openSSE(t, context.Background(), srv.URL+"/events")
+	if channel := readUntil(t, second, "event: "); channel != crudp.PresenceChannel {
+		t.Fatalf("expected snapshot, got %q", channel)
+	}
+	waitSubscribers(t, cp, 2)
+	if list := cp.Presence().List(); len(list) != 1 {
+		t.Fatalf("server list: %v", list)
+	}
+
+	cancel()
+	waitSubscribers(t, cp, 1)
+	if !cp.Presence().Online("alice") {
+		t.Fatal("alice still has a connection")
+	}
+}
+
+// Direct sends Text to the user channel of User
+type Direct struct {
+	User string
+	Text string
+}
+
+type directResponse struct{ d *Direct }
+
+func (r directResponse) Response() (any, []string, error) {
+	return r.d, []string{crudp.UserChannel(r.d.User)}, nil
+}
+
+func (d *Direct) Create(ctx context.Context, data ...any) any {
+	return directResponse{d: data[0].(*Direct)}
+}
+
+// queryUser identifies SSE clients by ?user=, stored by userMiddleware
+type queryUser struct{}
+
+func (queryUser) GetUserID(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
+
+func userMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), userKey{}, r.URL.Query().Get("user"))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func TestSSE_UserChannelAcrossInstances(t *testing.T) {
+	bus := crudp.NewMemoryPubSub()
+	node := func() (*crudp.CrudP, *httptest.Server) {
+		cfg := crudp.DefaultConfig()
+		cfg.SSEHeartbeat = 0
+		cfg.PubSub = bus
+		cfg.Presence = true
+		cfg.UserProvider = queryUser{}
+		cp := crudp.New(cfg, crudp.WithHandlers(&Direct{}))
+		srv := httptest.NewServer(userMiddleware(cp.BuildRouter()))
+		t.Cleanup(srv.Close)
+		t.Cleanup(func() { cp.Close() })
+		return cp, srv
+	}
+	a, _ := node()
+	b, srvB := node()
+
+	// alice and bob only hold connections to b, listening to no shared channel
+	alice := openSSE(t, context.Background(), srvB.URL+"/events?user=alice&channels=news")
+	openSSE(t, context.Background(), srvB.URL+"/events?user=bob&channels=news")
+	waitSubscribers(t, b, 2)
+
+	if list := a.Presence().List(); len(list) != 2 || !a.Presence().Online("alice") {
+		t.Fatalf("a does not see the users of b: %v", list)
+	}
+
+	// A handler on a reaches alice through her user channel on b
+	data, _ := a.Codec().Encode(&Direct{User: "alice", Text: "hi"})
+	processOne(t, a, crudp.Packet{Action: 'c', Data: [][]byte{data}})
+
+	if channel := readUntil(t, alice, "event: "); channel != "user:alice" {
+		t.Fatalf("expected user:alice, got %q", channel)
+	}
+	var ev crudp.Event
+	raw, _ := base64.StdEncoding.DecodeString(readUntil(t, alice, "data: "))
+	if err := b.Codec().Decode(raw, &ev); err != nil {
+		t.Fatal(err)
+	}
+	var got Direct
+	if err := b.Codec().Decode(ev.Data, &got); err != nil || got.Text != "hi" {
+		t.Fatalf("unexpected payload %+v (%v)", got, err)
+	}
+
+	// A node started later learns the users already connected
+	c, _ := node()
+	if !c.Presence().Online("bob") {
+		t.Errorf("new node missing bob: %v", c.Presence().List())
+	}
+
+	// Closing b makes the others forget its users
+	b.Close()
+	if list := a.Presence().List(); len(list) != 0 {
+		t.Errorf("users of closed node still listed: %v", list)
+	}
+}
+
+func TestSSE_MaintenanceOnConnect(t *testing.T) {
+	cp, srv := newSSEServer(t, 0)
+	cp.SetMaintenance(true, "Back soon")
+
+	client := crudp.New()
+	stream := openSSE(t, context.Background(), srv.URL+"/events")
+	if channel := readUntil(t, stream, "event: "); channel != crudp.MaintenanceChannel {
+		t.Fatalf("expected maintenance event, got %q", channel)
+	}
+	if err := client.ReceiveEventData(readUntil(t, stream, "data: ")); err != nil {
+		t.Fatal(err)
+	}
+	if on, msg := client.Maintenance(); !on || msg != "Back soon" || !client.Broker().Paused() {
+		t.Errorf("client not paused: %v %q", on, msg)
+	}
+
+	cp.SetMaintenance(false, "")
+	readUntil(t, stream, "event: ")
+	if err := client.ReceiveEventData(readUntil(t, stream, "data: ")); err != nil {
+		t.Fatal(err)
+	}
+	if on, _ := client.Maintenance(); on || client.Broker().Paused() {
+		t.Error("client still paused")
+	}
+}
+
+func TestSSE_WebSocket(t *testing.T) {
+	cp, srv := newSSEServer(t, 0)
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	conn.Write([]byte("GET /events HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+	r := bufio.NewReader(conn)
+	if status, _ := r.ReadString('\n'); !strings.Contains(status, "101") {
+		t.Fatalf("unexpected handshake status %q", status)
+	}
+	if accept := readUntil(t, r, "Sec-WebSocket-Accept: "); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("unexpected accept key %q", accept)
+	}
+	readUntil(t, r, "\r\n")
+	waitSubscribers(t, cp, 1)
+
+	processOne(t, cp, crudp.Packet{Action: 'c', ReqID: "ws"})
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil || head[0] != 0x81 || head[1] >= 126 {
+		t.Fatalf("unexpected frame header %x: %v", head, err)
+	}
+	payload := make([]byte, head[1])
+	io.ReadFull(r, payload)
+
+	client := crudp.NewDefault()
+	var got []crudp.Event
+	client.OnEvent(func(ev crudp.Event) { got = append(got, ev) })
+	if err := client.ReceiveEventData(string(payload)); err != nil {
+		t.Fatalf("ReceiveEventData: %v", err)
+	}
+	if len(got) != 1 || got[0].Channel != "channel1" {
+		t.Errorf("unexpected event: %+v", got)
+	}
+}
+
+func TestSSE_LongPoll(t *testing.T) {
+	cp, srv := newSSEServer(t, 0)
+	stream := openSSE(t, context.Background(), srv.URL+"/events?poll=1")
+	waitSubscribers(t, cp, 1)
+
+	processOne(t, cp, crudp.Packet{Action: 'c', ReqID: "poll"})
+	if channel := readUntil(t, stream, "event: "); channel != "channel1" {
+		t.Errorf("expected channel1, got %q", channel)
+	}
+	readUntil(t, stream, "data: ")
+	waitSubscribers(t, cp, 0)
+}
@@ -0,0 +1,204 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// defaultMaxUpload bounds a file when Config.MaxUploadBytes is 0
+const defaultMaxUpload = 32 << 20
+
+// handleUpload stores a multipart file (field "file") or one chunk of a raw
+// body and answers the FileRef encoded with the codec of the instance
+func (cp *CrudP) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var ref FileRef
+	var err error
+	if mediaType(r.Header.Get("Content-Type")) == "multipart/form-data" {
+		ref, err = cp.uploadMultipart(w, r)
+	} else {
+		ref, err = cp.uploadChunk(w, r)
+	}
+
+	var offsetErr *UploadOffsetError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+	case errors.As(err, &offsetErr):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.As(err, &tooLarge):
+		http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	default:
+		cp.log.Warn("upload failed", "remote", RemoteIP(r), "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	encoded, err := cp.codec.Encode(&ref)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", cp.codecContentType())
+	w.Write(encoded)
+}
+
+// uploadMultipart stores the "file" part of a multipart form as a new file
+func (cp *CrudP) uploadMultipart(w http.ResponseWriter, r *http.Request) (FileRef, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, cp.maxUpload()+64<<10) // Room for the part headers
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return FileRef{}, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return FileRef{}, Errf("upload: no file part")
+		}
+		if err != nil {
+			return FileRef{}, err
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+		ref := FileRef{ID: newFileID(), Name: part.FileName(), Type: part.Header.Get("Content-Type")}
+		limited := &io.LimitedReader{R: part, N: cp.maxUpload() + 1}
+		ref.Size, err = cp.config.FileStore.Append(r.Context(), ref.ID, 0, limited)
+		part.Close()
+		if err == nil && ref.Size > cp.maxUpload() {
+			err = &http.MaxBytesError{Limit: cp.maxUpload()}
+		}
+		if err != nil {
+			cp.removeFile(r.Context(), ref.ID) // Nobody can resume a multipart upload
+			return FileRef{}, err
+		}
+		return ref, nil
+	}
+}
+
+// uploadChunk appends the request body to the file in UploadIDHeader, or to
+// a new file when the header is missing
+func (cp *CrudP) uploadChunk(w http.ResponseWriter, r *http.Request) (FileRef, error) {
+	ref := FileRef{
+		ID:   r.Header.Get(UploadIDHeader),
+		Name: r.Header.Get(UploadNameHeader),
+		Type: r.Header.Get(UploadTypeHeader),
+	}
+	var offset int64
+	if ref.ID == "" {
+		ref.ID = newFileID()
+	} else {
+		if !validFileID(ref.ID) {
+			return FileRef{}, Err(Fmt("upload: invalid file id %q", ref.ID))
+		}
+		var err error
+		if offset, err = strconv.ParseInt(r.Header.Get(UploadOffsetHeader), 10, 64); err != nil || offset < 0 {
+			return FileRef{}, Err(Fmt("upload: invalid offset %q", r.Header.Get(UploadOffsetHeader)))
+		}
+	}
+	if offset >= cp.maxUpload() {
+		return FileRef{}, &http.MaxBytesError{Limit: cp.maxUpload()}
+	}
+
+	body := http.MaxBytesReader(w, r.Body, cp.maxUpload()-offset)
+	size, err := cp.config.FileStore.Append(r.Context(), ref.ID, offset, body)
+	if err != nil {
+		return FileRef{}, err
+	}
+	ref.Size = size
+	return ref, nil
+}
+
+// removeFile deletes a partly written file if the FileStore can
+func (cp *CrudP) removeFile(ctx context.Context, id string) {
+	rm, ok := cp.config.FileStore.(FileRemover)
+	if !ok {
+		return
+	}
+	if err := rm.Remove(ctx, id); err != nil && !errors.Is(err, os.ErrNotExist) {
+		cp.log.Warn("upload cleanup failed", "id", id, "error", err)
+	}
+}
+
+func (cp *CrudP) maxUpload() int64 {
+	if cp.config.MaxUploadBytes > 0 {
+		return cp.config.MaxUploadBytes
+	}
+	return defaultMaxUpload
+}
+
+// newFileID returns 16 random bytes in hex
+func newFileID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// DirStore is a FileStore keeping each file in a directory, named by its ID
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore returns a DirStore in dir, created if missing
+func NewDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DirStore{dir: dir}, nil
+}
+
+func (s *DirStore) Append(ctx context.Context, id string, offset int64, r io.Reader) (int64, error) {
+	if !validFileID(id) {
+		return 0, Err(Fmt("upload: invalid file id %q", id))
+	}
+	f, err := os.OpenFile(filepath.Join(s.dir, id), os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() != offset {
+		return info.Size(), &UploadOffsetError{ID: id, Offset: offset, Size: info.Size()}
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+	n, err := io.Copy(f, r)
+	return offset + n, err
+}
+
+func (s *DirStore) Remove(ctx context.Context, id string) error {
+	if !validFileID(id) {
+		return Err(Fmt("upload: invalid file id %q", id))
+	}
+	return os.Remove(filepath.Join(s.dir, id))
+}
+
+func (s *DirStore) Open(ctx context.Context, id string) (io.ReadCloser, error) {
+	if !validFileID(id) {
+		return nil, Err(Fmt("upload: invalid file id %q", id))
+	}
+	return os.Open(filepath.Join(s.dir, id))
+}
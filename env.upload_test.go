@@ -0,0 +1,161 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+func TestUploadRoute(t *testing.T) {
+	dir := t.TempDir()
+	store, err := crudp.NewDirStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := crudp.DefaultConfig()
+	cfg.FileStore = store
+	cfg.MaxUploadBytes = 10
+	cp := crudp.New(cfg)
+	router := cp.BuildRouter()
+
+	post := func(body io.Reader, contentType string, headers ...string) (*httptest.ResponseRecorder, crudp.FileRef) {
+		req := httptest.NewRequest(http.MethodPost, "/upload", body)
+		req.Header.Set("Content-Type", contentType)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var ref crudp.FileRef
+		if w.Code == http.StatusOK {
+			if err := cp.Codec().Decode(w.Body.Bytes(), &ref); err != nil {
+				t.Fatalf("decode FileRef: %v", err)
+			}
+		}
+		return w, ref
+	}
+	content := func(ref crudp.FileRef) string {
+		r, err := store.Open(context.Background(), ref.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		b, _ := io.ReadAll(r)
+		return string(b)
+	}
+
+	t.Run("Multipart", func(t *testing.T) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("note", "ignored")
+		fw, _ := mw.CreateFormFile("file", "a.txt")
+		fw.Write([]byte("hello"))
+		mw.Close()
+
+		w, ref := post(&body, mw.FormDataContentType())
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body.String())
+		}
+		if ref.Name != "a.txt" || ref.Size != 5 || ref.ID == "" || content(ref) != "hello" {
+			t.Errorf("unexpected ref %+v", ref)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != crudp.ContentTypeJSON {
+			t.Errorf("expected the codec content type, got %q", ct)
+		}
+	})
+
+	t.Run("Multipart Too Large Is Removed", func(t *testing.T) {
+		before, _ := os.ReadDir(dir)
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("file", "big.txt")
+		fw.Write([]byte("0123456789abcdef"))
+		mw.Close()
+
+		if w, _ := post(&body, mw.FormDataContentType()); w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("expected 413, got %d", w.Code)
+		}
+		if after, _ := os.ReadDir(dir); len(after) != len(before) {
+			t.Errorf("partial upload left in the store: %d files, had %d", len(after), len(before))
+		}
+	})
+
+	t.Run("Chunked", func(t *testing.T) {
+		w, ref := post(bytes.NewReader([]byte("abcd")), "application/octet-stream",
+			crudp.UploadNameHeader, "b.bin", crudp.UploadTypeHeader, "application/x-test")
+		if w.Code != http.StatusOK || ref.Size != 4 {
+			t.Fatalf("first chunk: %d %+v", w.Code, ref)
+		}
+		w, ref = post(bytes.NewReader([]byte("efg")), "application/octet-stream",
+			crudp.UploadIDHeader, ref.ID, crudp.UploadOffsetHeader, "4", crudp.UploadNameHeader, "b.bin")
+		if w.Code != http.StatusOK || ref.Size != 7 || content(ref) != "abcdefg" {
+			t.Fatalf("second chunk: %d %+v", w.Code, ref)
+		}
+
+		// A chunk sent twice is rejected so the client resumes from Size
+		w, _ = post(bytes.NewReader([]byte("efg")), "application/octet-stream",
+			crudp.UploadIDHeader, ref.ID, crudp.UploadOffsetHeader, "4")
+		if w.Code != http.StatusConflict {
+			t.Errorf("expected 409 for a stale offset, got %d", w.Code)
+		}
+		w, _ = post(bytes.NewReader([]byte("hijkl")), "application/octet-stream",
+			crudp.UploadIDHeader, ref.ID, crudp.UploadOffsetHeader, strconv.Itoa(int(ref.Size)))
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected 413 past MaxUploadBytes, got %d", w.Code)
+		}
+	})
+
+	t.Run("Rejects Invalid IDs", func(t *testing.T) {
+		w, _ := post(bytes.NewReader([]byte("x")), "application/octet-stream",
+			crudp.UploadIDHeader, "../crudp.go", crudp.UploadOffsetHeader, "0")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("Disabled Without FileStore", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader([]byte("x")))
+		w := httptest.NewRecorder()
+		crudp.New().BuildRouter().ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", w.Code)
+		}
+	})
+}
+
+// Avatar receives the FileRef of an upload inside its packets
+type Avatar struct {
+	UserID string        `json:"user_id"`
+	File   crudp.FileRef `json:"file"`
+}
+
+var avatarFiles []crudp.FileRef
+
+func (h *Avatar) Create(ctx context.Context, data ...any) any {
+	avatarFiles = append(avatarFiles, data[0].(*Avatar).File)
+	return data[0]
+}
+
+func TestUploadRefInPacket(t *testing.T) {
+	cp := crudp.New(crudp.WithHandlers(&Avatar{}))
+	ref := crudp.FileRef{ID: "0123456789abcdef0123456789abcdef", Name: "me.png", Type: "image/png", Size: 42}
+	data, err := cp.Codec().Encode(&Avatar{UserID: "u1", File: ref})
+	if err != nil {
+		t.Fatal(err)
+	}
+	avatarFiles = nil
+	processOne(t, cp, crudp.Packet{Action: 'c', HandlerID: 0, ReqID: "a1", Data: [][]byte{data}})
+	if len(avatarFiles) != 1 || avatarFiles[0] != ref {
+		t.Errorf("handler got %+v, want %+v", avatarFiles, ref)
+	}
+}
@@ -0,0 +1,92 @@
+//go:build wasm
+
+package crudp
+
+import (
+	"strconv"
+	"syscall/js"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// UploadFile streams a browser File or Blob to EndpointURL(UploadEndpoint) in
+// UploadChunkSize chunks and calls done with its FileRef, ready to be sent in
+// a packet. progress, if not nil, is called after each chunk.
+func (cp *CrudP) UploadFile(file js.Value, progress func(sent, total int64), done func(FileRef, error)) {
+	ref := FileRef{Name: file.Get("name").String(), Type: file.Get("type").String()}
+	if file.Get("name").IsUndefined() {
+		ref.Name = "" // Blob
+	}
+	cp.uploadChunk(file, int64(file.Get("size").Float()), ref, progress, done)
+}
+
+// uploadChunk sends the chunk of file starting at ref.Size and continues
+// with the next one until total bytes are stored
+func (cp *CrudP) uploadChunk(file js.Value, total int64, ref FileRef, progress func(sent, total int64), done func(FileRef, error)) {
+	end := ref.Size + UploadChunkSize
+	if end > total {
+		end = total
+	}
+
+	headers := js.Global().Get("Object").New()
+	headers.Set("Content-Type", "application/octet-stream")
+	headers.Set(UploadNameHeader, ref.Name)
+	headers.Set(UploadTypeHeader, ref.Type)
+	if ref.ID != "" {
+		headers.Set(UploadIDHeader, ref.ID)
+		headers.Set(UploadOffsetHeader, strconv.FormatInt(ref.Size, 10))
+	}
+	init := js.Global().Get("Object").New()
+	init.Set("method", "POST")
+	init.Set("headers", headers)
+	init.Set("body", file.Call("slice", float64(ref.Size), float64(end)))
+
+	var onResponse, onBody, onText, onError js.Func
+	release := func() {
+		onResponse.Release()
+		onBody.Release()
+		onText.Release()
+		onError.Release()
+	}
+	onError = js.FuncOf(func(this js.Value, args []js.Value) any {
+		release()
+		done(FileRef{}, Err(Fmt("upload %s: %s", ref.Name, args[0].String())))
+		return nil
+	})
+	onText = js.FuncOf(func(this js.Value, args []js.Value) any {
+		release()
+		done(FileRef{}, Err(Fmt("upload %s: %s", ref.Name, args[0].String())))
+		return nil
+	})
+	onBody = js.FuncOf(func(this js.Value, args []js.Value) any {
+		release()
+		data := js.Global().Get("Uint8Array").New(args[0])
+		body := make([]byte, data.Get("length").Int())
+		js.CopyBytesToGo(body, data)
+
+		var stored FileRef
+		if err := cp.codec.Decode(body, &stored); err != nil {
+			done(FileRef{}, err)
+			return nil
+		}
+		if progress != nil {
+			progress(stored.Size, total)
+		}
+		if stored.Size >= total {
+			done(stored, nil)
+			return nil
+		}
+		cp.uploadChunk(file, total, stored, progress, done)
+		return nil
+	})
+	onResponse = js.FuncOf(func(this js.Value, args []js.Value) any {
+		resp := args[0]
+		if !resp.Get("ok").Bool() {
+			return resp.Call("text").Call("then", onText, onError)
+		}
+		return resp.Call("arrayBuffer").Call("then", onBody, onError)
+	})
+
+	url := cp.EndpointURL(cp.config.UploadEndpoint)
+	js.Global().Call("fetch", url, init).Call("then", onResponse).Call("catch", onError)
+}
@@ -0,0 +1,157 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"bytes"
+	"html"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// WASMLoader serves the files that start a WASM client built on this
+// package, so deployments need not copy wasm_exec.js by hand:
+//
+//	loader, err := crudp.WASMLoader{}.Handler()
+//	mux.Handle("/", http.FileServer(http.Dir("public"))) // main.wasm
+//	mux.Handle("/wasm_exec.js", loader)
+//	mux.Handle("/loader.js", loader)
+type WASMLoader struct {
+	// Module is the URL of the client module, relative to the page.
+	// Default: "main.wasm"
+	Module string
+
+	// TinyGo serves the wasm_exec.js of TinyGo: the glue must match the
+	// compiler of the module
+	TinyGo bool
+
+	// ExecJS is the wasm_exec.js file to serve, e.g. one shipped next to the
+	// server binary. Default: the one of the installed toolchain
+	ExecJS string
+
+	// Title of the generated index page. Default: "WebAssembly"
+	Title string
+}
+
+// WASMExecJS returns the wasm_exec.js of the installed Go toolchain, or of
+// TinyGo: $(go env GOROOT)/lib/wasm since Go 1.24, misc/wasm before
+func WASMExecJS(tinygo bool) ([]byte, error) {
+	var candidates []string
+	if tinygo {
+		root, err := toolEnv("tinygo", "TINYGOROOT")
+		if err != nil {
+			return nil, err
+		}
+		candidates = []string{filepath.Join(root, "targets", "wasm_exec.js")}
+	} else {
+		root := os.Getenv("GOROOT")
+		if root == "" {
+			var err error
+			if root, err = toolEnv("go", "GOROOT"); err != nil {
+				return nil, err
+			}
+		}
+		candidates = []string{
+			filepath.Join(root, "lib", "wasm", "wasm_exec.js"),
+			filepath.Join(root, "misc", "wasm", "wasm_exec.js"),
+		}
+	}
+	for _, file := range candidates {
+		if js, err := os.ReadFile(file); err == nil {
+			return js, nil
+		}
+	}
+	return nil, Err(Fmt("wasm_exec.js not found: tried %s", strings.Join(candidates, ", ")))
+}
+
+// toolEnv returns a variable of "tool env", e.g. "go env GOROOT"
+func toolEnv(tool, name string) (string, error) {
+	out, err := exec.Command(tool, "env", name).Output()
+	if err != nil {
+		return "", Err(Fmt("%s env %s: %v", tool, name, err))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// LoaderJS returns the bootstrap script that instantiates the module and
+// runs it; it expects wasm_exec.js loaded first
+func (l WASMLoader) LoaderJS() string {
+	module := l.Module
+	if module == "" {
+		module = "main.wasm"
+	}
+	return `"use strict";
+(async () => {
+	const go = new Go();
+	const module = ` + strconv.Quote(module) + `;
+	const { instance } = WebAssembly.instantiateStreaming
+		? await WebAssembly.instantiateStreaming(fetch(module), go.importObject)
+		: await WebAssembly.instantiate(await (await fetch(module)).arrayBuffer(), go.importObject);
+	go.run(instance);
+})().catch((err) => console.error("wasm:", err));
+`
+}
+
+// IndexHTML returns a page loading wasm_exec.js and loader.js
+func (l WASMLoader) IndexHTML() string {
+	title := l.Title
+	if title == "" {
+		title = "WebAssembly"
+	}
+	return `<!doctype html><html lang="en">
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width,initial-scale=1">
+<title>` + html.EscapeString(title) + `</title>
+</head>
+<body>
+<script src="wasm_exec.js"></script>
+<script src="loader.js"></script>
+</body>
+</html>
+`
+}
+
+// Handler returns the handler serving wasm_exec.js, loader.js and the index
+// page ("/" or index.html) by the last element of the request path, so it
+// can be mounted under any prefix; other paths are not found. wasm_exec.js
+// is read once here: an error means it was not found.
+func (l WASMLoader) Handler() (http.Handler, error) {
+	var js []byte
+	var err error
+	if l.ExecJS != "" {
+		js, err = os.ReadFile(l.ExecJS)
+	} else {
+		js, err = WASMExecJS(l.TinyGo)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{
+		"wasm_exec.js": js,
+		"loader.js":    []byte(l.LoaderJS()),
+		"index.html":   []byte(l.IndexHTML()),
+	}
+	started := time.Now()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Base(r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/") {
+			name = "index.html"
+		}
+		content, ok := files[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, name, started, bytes.NewReader(content))
+	}), nil
+}
@@ -0,0 +1,61 @@
+//go:build !wasm
+
+package crudp_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+func TestWASMLoader(t *testing.T) {
+	execJS := filepath.Join(t.TempDir(), "wasm_exec.js")
+	os.WriteFile(execJS, []byte("globalThis.Go = class {};"), 0o644)
+
+	loader, err := crudp.WASMLoader{Module: "app.wasm", ExecJS: execJS, Title: "Clinic"}.Handler()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/static/", http.StripPrefix("/static", loader))
+
+	get := func(path string) (int, string, string) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		body, _ := io.ReadAll(rec.Body)
+		return rec.Code, rec.Header().Get("Content-Type"), string(body)
+	}
+
+	if code, ctype, body := get("/static/wasm_exec.js"); code != http.StatusOK || body != "globalThis.Go = class {};" || !strings.Contains(ctype, "javascript") {
+		t.Errorf("wasm_exec.js: %d %q %q", code, ctype, body)
+	}
+	if _, _, body := get("/static/loader.js"); !strings.Contains(body, `"app.wasm"`) || !strings.Contains(body, "new Go()") {
+		t.Errorf("loader.js does not load the module: %s", body)
+	}
+	if _, ctype, body := get("/static/"); !strings.Contains(ctype, "text/html") || !strings.Contains(body, "<title>Clinic</title>") || !strings.Contains(body, `src="loader.js"`) {
+		t.Errorf("index: %q %s", ctype, body)
+	}
+	if code, _, _ := get("/static/other.js"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for other files, got %d", code)
+	}
+
+	if _, err := (crudp.WASMLoader{ExecJS: filepath.Join(t.TempDir(), "missing.js")}).Handler(); err == nil {
+		t.Error("expected an error for a missing wasm_exec.js")
+	}
+}
+
+func TestWASMExecJS_Toolchain(t *testing.T) {
+	js, err := crudp.WASMExecJS(false)
+	if err != nil {
+		t.Skipf("no Go toolchain: %v", err)
+	}
+	if !strings.Contains(string(js), "class") || !strings.Contains(string(js), "Go") {
+		t.Error("unexpected wasm_exec.js content")
+	}
+}
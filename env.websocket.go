@@ -0,0 +1,173 @@
+//go:build !wasm
+
+package crudp
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// WebSocket opcodes (RFC 6455)
+const (
+	wsText  = 0x1
+	wsClose = 0x8
+	wsPing  = 0x9
+	wsPong  = 0xA
+)
+
+// wsGUID is appended to Sec-WebSocket-Key to build the accept hash
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsStream sends each event as a text frame holding the base64 data of the
+// SSE message, so clients pass it to ReceiveEventData unchanged
+// Frames sent by the client are read only to answer pings and see the close.
+type wsStream struct {
+	cp      *CrudP
+	conn    net.Conn
+	mu      sync.Mutex // Serializes writes from the stream and the reader
+	closing bool       // Close frame sent, guarded by mu
+	done    chan struct{}
+}
+
+// isWebSocket reports whether r asks for a WebSocket upgrade
+func isWebSocket(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
+// acceptWebSocket completes the handshake and starts reading client frames
+func (cp *CrudP) acceptWebSocket(w http.ResponseWriter, r *http.Request) (*wsStream, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		http.Error(w, "unsupported WebSocket version", http.StatusBadRequest)
+		return nil, Errf("missing key or unsupported version")
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{}) // Hijacked with the deadlines of the server
+
+	hash := sha1.Sum([]byte(key + wsGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ")
+	rw.WriteString(base64.StdEncoding.EncodeToString(hash[:]))
+	rw.WriteString("\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ws := &wsStream{cp: cp, conn: conn, done: make(chan struct{})}
+	go ws.read(rw.Reader)
+	return ws, nil
+}
+
+func (ws *wsStream) event(ev Event) error {
+	encoded, err := ws.cp.codec.Encode(ev)
+	if err != nil {
+		ws.cp.log.Error("WebSocket encoding failed", "channel", ev.Channel, "error", err)
+		return nil
+	}
+	return ws.write(wsText, base64.StdEncoding.AppendEncode(nil, encoded))
+}
+
+func (ws *wsStream) ping() error {
+	return ws.write(wsPing, nil)
+}
+
+// write sends one unmasked final frame within Config.SSEWriteTimeout
+func (ws *wsStream) write(op byte, payload []byte) error {
+	frame := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, payload...)
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closing {
+		return net.ErrClosed
+	}
+	ws.closing = op == wsClose
+	if ws.cp.config.SSEWriteTimeout > 0 {
+		ws.conn.SetWriteDeadline(time.Now().Add(time.Duration(ws.cp.config.SSEWriteTimeout) * time.Millisecond))
+	}
+	_, err := ws.conn.Write(frame)
+	return err
+}
+
+// read consumes client frames until a close frame or a read error
+func (ws *wsStream) read(r *bufio.Reader) {
+	defer close(ws.done)
+	for {
+		var head [2]byte
+		if _, err := io.ReadFull(r, head[:]); err != nil {
+			return
+		}
+		op := head[0] & 0x0F
+		n := uint64(head[1] & 0x7F)
+		switch n {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(r, ext[:]); err != nil {
+				return
+			}
+			n = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(r, ext[:]); err != nil {
+				return
+			}
+			n = binary.BigEndian.Uint64(ext[:])
+		}
+		if n > 1<<16 { // Clients only send control frames
+			return
+		}
+		var mask [4]byte
+		if head[1]&0x80 != 0 {
+			if _, err := io.ReadFull(r, mask[:]); err != nil {
+				return
+			}
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return
+		}
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+
+		switch op {
+		case wsClose:
+			ws.write(wsClose, nil)
+			return
+		case wsPing:
+			ws.write(wsPong, payload)
+		}
+	}
+}
+
+// close sends a close frame (best effort) and closes the connection
+func (ws *wsStream) close() {
+	ws.write(wsClose, nil)
+	ws.conn.Close()
+}
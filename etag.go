@@ -0,0 +1,67 @@
+package crudp
+
+import (
+	. "github.com/cdvelop/tinystring"
+)
+
+// WithIfNoneMatch sends the ETag of the last Read result for the same query
+// When the data is unchanged the result has no Data and Code CodeNotModified.
+func WithIfNoneMatch(etag string) CallOption {
+	return callOptionFunc(func(co *callOptions) {
+		co.ifNoneMatch = etag
+	})
+}
+
+// IsNotModified reports whether a Read result was answered with CodeNotModified
+// The client keeps the data of the result whose ETag it sent.
+func IsNotModified(pr PacketResult) bool {
+	return pr.Code == CodeNotModified
+}
+
+// tagRead sets the ETag of a successful Read result and drops its payload
+// when it matches the one sent by the client
+func tagRead(packet *Packet, pr *PacketResult) {
+	if packet.Action != 'r' || pr.MessageType != uint8(Msg.Success) {
+		return
+	}
+	pr.ETag = fingerprint(pr)
+	if packet.IfNoneMatch == "" || packet.IfNoneMatch != pr.ETag {
+		return
+	}
+	pr.Data, pr.Attachments, pr.PageInfo, pr.Items = nil, nil, nil, nil
+	pr.Code = CodeNotModified
+	pr.Message = "not modified"
+}
+
+// fingerprint hashes the data and page info of a result (FNV-1a, 64 bit)
+func fingerprint(pr *PacketResult) string {
+	hash := uint64(14695981039346656037)
+	write := func(b []byte) {
+		for _, c := range b {
+			hash ^= uint64(c)
+			hash *= 1099511628211
+		}
+	}
+	for _, item := range pr.Data {
+		write([]byte(Fmt("%d:", len(item))))
+		write(item)
+	}
+	for _, blob := range pr.Attachments {
+		write([]byte(Fmt("a%d:", len(blob))))
+		write(blob)
+	}
+	if info := pr.PageInfo; info != nil {
+		write([]byte(Fmt("p%d,%s", info.Total, info.NextCursor)))
+		if info.HasMore {
+			write([]byte{'+'})
+		}
+	}
+
+	const digits = "0123456789abcdef"
+	tag := make([]byte, 16)
+	for i := 15; i >= 0; i-- {
+		tag[i] = digits[hash&15]
+		hash >>= 4
+	}
+	return string(tag)
+}
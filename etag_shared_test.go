@@ -0,0 +1,66 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Menu returns its dishes, which tests change between Reads
+type Menu struct {
+	dishes []string
+}
+
+func (h *Menu) Read(ctx context.Context, data ...any) any { return h.dishes }
+
+func ETagShared(t *testing.T) {
+	for _, binary := range []bool{false, true} {
+		t.Run(Fmt("Not Modified binary=%v", binary), func(t *testing.T) {
+			h := &Menu{dishes: []string{"soup"}}
+			cfg := crudp.DefaultConfig()
+			cfg.UseBinary = binary
+			cp := crudp.New(cfg, crudp.WithHandlers(h))
+
+			first := processOne(t, cp, crudp.Packet{Action: 'r', ReqID: "r1"})
+			if first.ETag == "" || len(first.Data) != 1 {
+				t.Fatalf("first read: etag %q, %d items", first.ETag, len(first.Data))
+			}
+
+			// The tag travels in the encoded packet
+			encoded, err := cp.EncodePacket('r', 0, "r2", crudp.WithIfNoneMatch(first.ETag))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var packet crudp.Packet
+			cp.DecodePacket(encoded, &packet)
+			pr := processOne(t, cp, packet)
+			if !crudp.IsNotModified(pr) || len(pr.Data) != 0 || pr.MessageType != uint8(Msg.Success) || pr.ETag != first.ETag {
+				t.Errorf("expected not modified, got %q %q, %d items", pr.Code, pr.Message, len(pr.Data))
+			}
+
+			h.dishes = append(h.dishes, "salad")
+			pr = processOne(t, cp, packet)
+			if crudp.IsNotModified(pr) || len(pr.Data) != 1 || pr.ETag == first.ETag {
+				t.Errorf("changed data reported as not modified: %q", pr.ETag)
+			}
+		})
+	}
+
+	t.Run("Only Reads Are Tagged", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&Chart{}))
+		if pr := processOne(t, cp, crudp.Packet{Action: 'c'}); pr.ETag != "" {
+			t.Errorf("create tagged %q", pr.ETag)
+		}
+	})
+
+	t.Run("Conditional Packets Are Not Consolidated", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&Menu{}))
+		cp.EnqueuePacket(0, 'r', "a", nil, crudp.WithIfNoneMatch("x"))
+		cp.EnqueuePacket(0, 'r', "b", nil)
+		if n := cp.Broker().QueueLength(); n != 2 {
+			t.Errorf("expected 2 queued packets, got %d", n)
+		}
+	})
+}
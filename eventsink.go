@@ -0,0 +1,189 @@
+package crudp
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// MutationEvent is an immutable record of a successful 'c', 'u', 'd' or 'p' packet
+type MutationEvent struct {
+	Time    time.Time
+	Tenant  string
+	Handler string
+	Action  byte
+	ReqID   string
+	User    string   // UserProvider user ID, "" if none
+	Payload [][]byte // Encoded items of the handler result, as sent to the client
+}
+
+// EventSink receives every MutationEvent (optional, server only)
+// Set it in Config.EventSink for audit, replay or projections. Errors are
+// logged and never fail the packet.
+type EventSink interface {
+	Append(ctx context.Context, ev MutationEvent) error
+}
+
+// EventSinkFunc adapts a function to EventSink
+type EventSinkFunc func(ctx context.Context, ev MutationEvent) error
+
+func (f EventSinkFunc) Append(ctx context.Context, ev MutationEvent) error {
+	return f(ctx, ev)
+}
+
+// sinkMutation passes a successful mutation to Config.EventSink
+func (cp *CrudP) sinkMutation(ctx context.Context, handler *actionHandler, pr *PacketResult) {
+	if cp.config.EventSink == nil || !mutating(pr.Action) {
+		return
+	}
+	ev := MutationEvent{
+		Time:    time.Now(),
+		Tenant:  Tenant(ctx),
+		Handler: handler.name,
+		Action:  pr.Action,
+		ReqID:   pr.ReqID,
+		Payload: make([][]byte, len(pr.Data)),
+	}
+	for i, item := range pr.Data { // Data may share pooled buffers
+		ev.Payload[i] = append([]byte(nil), item...)
+	}
+	if cp.config.UserProvider != nil {
+		ev.User = cp.config.UserProvider.GetUserID(ctx)
+	}
+	if err := cp.config.EventSink.Append(ctx, ev); err != nil {
+		cp.log.Error("event sink failed", "handler", ev.Handler, "action", string(ev.Action), "error", err)
+	}
+}
+
+// mutationMagic starts every record written by FileSink
+const mutationMagic byte = 'M'
+
+// FileSink is an EventSink appending length-prefixed records to a writer
+// Read them back with ReadMutations.
+type FileSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewFileSink returns a FileSink appending to w (e.g. an *os.File)
+func NewFileSink(w io.Writer) *FileSink {
+	return &FileSink{w: w}
+}
+
+func (s *FileSink) Append(ctx context.Context, ev MutationEvent) error {
+	body := appendMutation(nil, &ev)
+	record := make([]byte, 0, len(body)+binary.MaxVarintLen64+1)
+	record = append(record, mutationMagic)
+	record = binary.AppendUvarint(record, uint64(len(body)))
+	record = append(record, body...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.w.Write(record)
+	return err
+}
+
+// ReadMutations calls fn with every record written by FileSink, in order
+// Use it to rebuild projections or replay a history; fn errors stop the read.
+func ReadMutations(r io.Reader, fn func(MutationEvent) error) error {
+	br := bufio.NewReader(r)
+	for {
+		magic, err := br.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if magic != mutationMagic {
+			return Errf("invalid mutation record")
+		}
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return err
+		}
+		body := make([]byte, n)
+		if _, err := io.ReadFull(br, body); err != nil {
+			return err
+		}
+		ev, err := readMutation(body)
+		if err != nil {
+			return err
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+}
+
+// appendMutation encodes ev as varint-prefixed fields
+func appendMutation(dst []byte, ev *MutationEvent) []byte {
+	dst = binary.AppendVarint(dst, ev.Time.UnixNano())
+	for _, s := range [...]string{ev.Tenant, ev.Handler, ev.ReqID, ev.User} {
+		dst = binary.AppendUvarint(dst, uint64(len(s)))
+		dst = append(dst, s...)
+	}
+	dst = append(dst, ev.Action)
+	return AppendPayload(dst, ev.Payload)
+}
+
+// readMutation decodes a record written by appendMutation
+func readMutation(b []byte) (MutationEvent, error) {
+	var ev MutationEvent
+	nanos, n := binary.Varint(b)
+	if n <= 0 {
+		return ev, Errf("invalid mutation record")
+	}
+	b = b[n:]
+	ev.Time = time.Unix(0, nanos)
+	for _, s := range [...]*string{&ev.Tenant, &ev.Handler, &ev.ReqID, &ev.User} {
+		l, n := binary.Uvarint(b)
+		if n <= 0 || uint64(len(b)-n) < l {
+			return ev, Errf("invalid mutation record")
+		}
+		*s = string(b[n : n+int(l)])
+		b = b[n+int(l):]
+	}
+	if len(b) == 0 {
+		return ev, Errf("invalid mutation record")
+	}
+	ev.Action = b[0]
+	var err error
+	ev.Payload, err = SplitPayload(b[1:])
+	return ev, err
+}
+
+// AppendPayload encodes items as a count followed by length-prefixed items
+// SQLSink stores MutationEvent.Payload in this form.
+func AppendPayload(dst []byte, items [][]byte) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(items)))
+	for _, item := range items {
+		dst = binary.AppendUvarint(dst, uint64(len(item)))
+		dst = append(dst, item...)
+	}
+	return dst
+}
+
+// SplitPayload decodes the items encoded by AppendPayload
+func SplitPayload(b []byte) ([][]byte, error) {
+	count, n := binary.Uvarint(b)
+	if n <= 0 || count > uint64(len(b)) {
+		return nil, Errf("invalid payload")
+	}
+	b = b[n:]
+	items := make([][]byte, 0, count)
+	for i := uint64(0); i < count; i++ {
+		l, n := binary.Uvarint(b)
+		if n <= 0 || uint64(len(b)-n) < l {
+			return nil, Errf("invalid payload")
+		}
+		items = append(items, b[n:n+int(l)])
+		b = b[n+int(l):]
+	}
+	return items, nil
+}
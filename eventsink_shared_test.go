@@ -0,0 +1,68 @@
+package crudp_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+func EventSinkShared(t *testing.T) {
+	t.Run("Successful Mutations Only", func(t *testing.T) {
+		var got []crudp.MutationEvent
+		cfg := crudp.DefaultConfig()
+		cfg.EventSink = crudp.EventSinkFunc(func(ctx context.Context, ev crudp.MutationEvent) error {
+			got = append(got, ev)
+			return nil
+		})
+		cp := crudp.New(cfg, crudp.WithHandlers(&Chart{}, &Flaky{}))
+		flakyFailing = true
+
+		processOne(t, cp, crudp.Packet{Action: 'c', HandlerID: 0, ReqID: "c1"})
+		processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 0, ReqID: "r1"})
+		processOne(t, cp, crudp.Packet{Action: 'd', HandlerID: 0, ReqID: "d1"})
+		processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 1, ReqID: "f1"})
+
+		if len(got) != 2 || got[0].ReqID != "c1" || got[1].Action != 'd' {
+			t.Fatalf("unexpected events %+v", got)
+		}
+		if got[0].Handler != "chart" || got[0].Time.IsZero() || len(got[0].Payload) != 1 {
+			t.Errorf("incomplete event %+v", got[0])
+		}
+	})
+
+	t.Run("File Sink Round Trip", func(t *testing.T) {
+		var buf bytes.Buffer
+		cfg := crudp.DefaultConfig()
+		cfg.EventSink = crudp.NewFileSink(&buf)
+		cp := crudp.New(cfg, crudp.WithHandlers(&Chart{}))
+
+		processOne(t, cp, crudp.Packet{Action: 'c', HandlerID: 0, ReqID: "c1"})
+		processOne(t, cp, crudp.Packet{Action: 'u', HandlerID: 0, ReqID: "u1"})
+
+		var replayed []crudp.MutationEvent
+		err := crudp.ReadMutations(&buf, func(ev crudp.MutationEvent) error {
+			replayed = append(replayed, ev)
+			return nil
+		})
+		if err != nil || len(replayed) != 2 {
+			t.Fatalf("ReadMutations: %d events, %v", len(replayed), err)
+		}
+		ev := replayed[1]
+		if ev.Handler != "chart" || ev.Action != 'u' || ev.ReqID != "u1" || len(ev.Payload) != 1 {
+			t.Errorf("unexpected replayed event %+v", ev)
+		}
+		var result string
+		if err := cp.Codec().Decode(ev.Payload[0], &result); err != nil || result != "ok" {
+			t.Errorf("payload: %q %v", result, err)
+		}
+	})
+
+	t.Run("Corrupt File", func(t *testing.T) {
+		err := crudp.ReadMutations(bytes.NewReader([]byte{'M', 3, 1}), func(crudp.MutationEvent) error { return nil })
+		if err == nil {
+			t.Error("expected an error for a truncated record")
+		}
+	})
+}
@@ -0,0 +1,9 @@
+//go:build !wasm
+
+package crudp_test
+
+import "testing"
+
+func TestEventSink_Stdlib(t *testing.T) {
+	EventSinkShared(t)
+}
@@ -1,14 +1,20 @@
 package modules
 
 import (
+	"github.com/cdvelop/crudp"
 	"github.com/cdvelop/crudp/example/modules/patient"
 	"github.com/cdvelop/crudp/example/modules/user"
 )
 
 // Init returns all business modules
-func Init() []any {
+// Order defines handler IDs; ByEnv and ServerOnly entries keep them aligned
+// in server and WASM builds, so the same list serves both. session is the
+// auth session handler of each side: JWT.SessionHandler on the server,
+// &auth.Session{} on the client.
+func Init(session any) []any {
 	return []any{
-		&user.Handler{},
-		&patient.Handler{},
+		crudp.ByEnv("user", user.Server, user.Client),
+		crudp.ServerOnly("patient", patient.Server),
+		session,
 	}
 }
@@ -0,0 +1,69 @@
+//go:build !wasm
+
+package patient
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/cdvelop/crudp/auth"
+)
+
+// Server builds the patient handler (see crudp.ServerOnly)
+func Server() any { return &Patient{} }
+
+// patients keeps the patients in memory; replace it with a database (see
+// the store package)
+var patients struct {
+	mu     sync.Mutex
+	list   []*Patient
+	nextID int
+}
+
+// denied fails the packets of anonymous callers
+type denied struct{}
+
+func (denied) Response() (any, []string, error) {
+	return nil, nil, errors.New("sign in to see patients")
+}
+
+// Create stores the patients with new IDs, owned by the caller
+func (p *Patient) Create(ctx context.Context, data ...any) any {
+	claims, ok := auth.FromContext(ctx)
+	if !ok {
+		return denied{}
+	}
+	patients.mu.Lock()
+	defer patients.mu.Unlock()
+
+	created := make([]*Patient, 0, len(data))
+	for _, item := range data {
+		patient := *item.(*Patient)
+		patients.nextID++
+		patient.ID = patients.nextID
+		patient.Owner = claims.Subject
+		patients.list = append(patients.list, &patient)
+		created = append(created, &patient)
+	}
+	return created
+}
+
+// Read returns the patients of the caller
+func (p *Patient) Read(ctx context.Context, data ...any) any {
+	claims, ok := auth.FromContext(ctx)
+	if !ok {
+		return denied{}
+	}
+	patients.mu.Lock()
+	defer patients.mu.Unlock()
+
+	found := make([]*Patient, 0, len(patients.list))
+	for _, patient := range patients.list {
+		if patient.Owner == claims.Subject {
+			copied := *patient
+			found = append(found, &copied)
+		}
+	}
+	return found
+}
@@ -0,0 +1,6 @@
+//go:build wasm
+
+package patient
+
+// Server is nil in WASM builds: the patient handler runs on the server only
+var Server func() any
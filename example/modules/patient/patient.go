@@ -1,21 +1,12 @@
 package patient
 
-import "context"
-
-type Handler struct{}
-
+// Patient is both the entity and its handler; its CRUD methods are
+// compiled in server builds only (back.go)
 type Patient struct {
-	ID   int
-	Name string
-	Age  int
+	ID    int
+	Name  string
+	Age   int
+	Owner string // Subject of the user who created it
 }
 
-func (h *Handler) Create(ctx context.Context, data ...any) (any, error) {
-	// Specific implementation for patients
-	return nil, nil
-}
-
-func (h *Handler) Read(ctx context.Context, data ...any) (any, error) {
-	// Specific implementation for patients
-	return nil, nil
-}
+func (p *Patient) HandlerName() string { return "patient" }
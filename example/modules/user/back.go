@@ -0,0 +1,155 @@
+//go:build !wasm
+
+package user
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/cdvelop/crudp"
+	"github.com/cdvelop/crudp/auth"
+)
+
+// Server builds the user handler (see crudp.ByEnv)
+func Server() any { return &User{} }
+
+// users keeps the users in memory; replace it with a database (see the
+// store package)
+var users struct {
+	mu     sync.Mutex
+	list   []*User
+	nextID int
+}
+
+// change is the result of a write, broadcast on its channel
+type change struct {
+	user    *User
+	channel string
+	err     error
+}
+
+func (c change) Response() (any, []string, error) {
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+	return c.user, []string{c.channel}, nil
+}
+
+// signedIn fails writes of anonymous callers (see auth.JWT.Middleware)
+func signedIn(ctx context.Context) error {
+	if _, ok := auth.FromContext(ctx); !ok {
+		return errors.New("sign in to change users")
+	}
+	return nil
+}
+
+// Create stores the users with new IDs
+func (u *User) Create(ctx context.Context, data ...any) any {
+	if err := signedIn(ctx); err != nil {
+		return change{err: err}
+	}
+	users.mu.Lock()
+	defer users.mu.Unlock()
+
+	created := make([]crudp.Response, 0, len(data))
+	for _, item := range data {
+		user := *item.(*User)
+		users.nextID++
+		user.ID = users.nextID
+		users.list = append(users.list, &user)
+		created = append(created, change{user: &user, channel: Saved})
+	}
+	return created
+}
+
+// Read returns the users with the IDs of the items; an ID of 0 or no
+// items returns every user
+func (u *User) Read(ctx context.Context, data ...any) any {
+	users.mu.Lock()
+	defer users.mu.Unlock()
+
+	all := len(data) == 0
+	ids := make([]int, 0, len(data))
+	for _, item := range data {
+		id := item.(*User).ID
+		all = all || id == 0
+		ids = append(ids, id)
+	}
+
+	found := make([]*User, 0, len(users.list))
+	for _, user := range users.list {
+		if all || contains(ids, user.ID) {
+			copied := *user
+			found = append(found, &copied)
+		}
+	}
+	return found
+}
+
+// Update replaces the users with the IDs of the items
+func (u *User) Update(ctx context.Context, data ...any) any {
+	if err := signedIn(ctx); err != nil {
+		return change{err: err}
+	}
+	users.mu.Lock()
+	defer users.mu.Unlock()
+
+	updated := make([]crudp.Response, 0, len(data))
+	for _, item := range data {
+		user := *item.(*User)
+		i := index(user.ID)
+		if i < 0 {
+			return change{err: notFound(user.ID)}
+		}
+		users.list[i] = &user
+		updated = append(updated, change{user: &user, channel: Saved})
+	}
+	return updated
+}
+
+// Delete removes the users with the IDs of the items
+func (u *User) Delete(ctx context.Context, data ...any) any {
+	if err := signedIn(ctx); err != nil {
+		return change{err: err}
+	}
+	users.mu.Lock()
+	defer users.mu.Unlock()
+
+	deleted := make([]crudp.Response, 0, len(data))
+	for _, item := range data {
+		id := item.(*User).ID
+		i := index(id)
+		if i < 0 {
+			return change{err: notFound(id)}
+		}
+		user := users.list[i]
+		users.list = append(users.list[:i], users.list[i+1:]...)
+		deleted = append(deleted, change{user: user, channel: Deleted})
+	}
+	return deleted
+}
+
+// index returns the position of the user with id, -1 if none
+func index(id int) int {
+	for i, user := range users.list {
+		if user.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func contains(ids []int, id int) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func notFound(id int) error {
+	return errors.New("user " + strconv.Itoa(id) + " not found")
+}
@@ -0,0 +1,6 @@
+//go:build wasm
+
+package user
+
+// Server is nil in WASM builds: calls go through the proxy (see Client)
+var Server func() any
@@ -1,30 +1,25 @@
 package user
 
-import "context"
+import "github.com/cdvelop/crudp"
 
-type Handler struct{}
+// Live update channels: the server broadcasts each saved user on Saved and
+// each deleted one on Deleted; clients subscribe to "user:*"
+const (
+	Saved   = "user:saved"
+	Deleted = "user:deleted"
+)
 
+// User is both the entity and its handler: the framework decodes packet
+// data into this type and passes *User items to the CRUD methods, which
+// only server builds compile (back.go).
 type User struct {
 	ID    int
 	Name  string
 	Email string
 }
 
-func (h *Handler) Create(ctx context.Context, data ...any) (any, error) {
-	created := make([]*User, 0, len(data))
-	for _, item := range data {
-		user := item.(*User)
-		user.ID = 123
-		created = append(created, user)
-	}
-	return created, nil
-}
+func (u *User) HandlerName() string { return "user" }
 
-func (h *Handler) Read(ctx context.Context, data ...any) (any, error) {
-	results := make([]*User, 0, len(data))
-	for _, item := range data {
-		user := item.(*User)
-		results = append(results, &User{ID: user.ID, Name: "Found " + user.Name, Email: user.Email})
-	}
-	return results, nil
-}
+// Client builds the proxy WASM builds register for the user handler, at
+// its ID in modules.Init
+func Client() any { return crudp.NewProxyHandler(0).Of(&User{}) }
@@ -5,14 +5,15 @@ import (
 	"github.com/cdvelop/crudp/example/modules"
 )
 
-func NewRouter() *crudp.CrudP {
-	cp := crudp.NewDefault()
+// NewRouter returns a CrudP with all business modules registered after
+// opts (e.g. crudp.WithConfig); session is the auth session handler of
+// this side, see modules.Init
+func NewRouter(session any, opts ...crudp.Option) (*crudp.CrudP, error) {
+	cp := crudp.New(append(opts, crudp.WithHandlers(modules.Init(session)...))...)
 
-	// Get handlers from modules
-	handlers := modules.Init()
+	if err := cp.SelfCheck(); err != nil {
+		return nil, err
+	}
 
-	// Register handlers in CRUDP
-	cp.RegisterHandler(handlers...)
-
-	return cp
+	return cp, nil
 }
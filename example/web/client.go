@@ -3,12 +3,141 @@
 package main
 
 import (
+	"strconv"
+	"syscall/js"
+
+	"github.com/cdvelop/crudp"
+	"github.com/cdvelop/crudp/auth"
+	"github.com/cdvelop/crudp/example/modules/user"
 	"github.com/cdvelop/crudp/example/pkg/router"
+	"github.com/cdvelop/tinystring"
 )
 
+// app keeps the users shown by the page in sync with the server
+type app struct {
+	cp      *crudp.CrudP
+	session *auth.Client
+	doc     js.Value
+	userID  uint8
+	users   []user.User
+}
+
 func main() {
-	// Get CRUDP client for WASM
-	_ = router.NewRouter() // TODO: Implement WASM client logic
+	a := &app{doc: js.Global().Get("document")}
+
+	cfg := crudp.DefaultConfig()
+	cfg.OnMessage = a.message // Results, errors and offline notices
+
+	cp, err := router.NewRouter(&auth.Session{}, crudp.WithConfig(cfg))
+	if err != nil {
+		a.message(uint8(tinystring.Msg.Error), err.Error())
+		return
+	}
+	a.cp = cp
+	a.userID, _ = cp.HandlerID("user")
+
+	// Auth: the session handler logs in; batches carry its cookies
+	a.session = auth.NewClient(cp, auth.NewLocalStorage("example.session"))
+	auth.Transport(cp, a.session)
+
+	// Offline queue: packets enqueued while offline wait in the broker and
+	// are sent once the network or the event stream is back
+	cp.WatchNetwork()
+
+	// Live updates: subscribe before Connect so EventsURL asks for them
+	cp.Subscribe("user:*", a.live)
+	cp.OnResult(a.result)
+	cp.Connect(crudp.SSETransport(), crudp.LongPollTransport())
+
+	a.bind()
+	a.cp.EnqueuePacket(a.userID, 'r', "", &user.User{}) // Every user
 
 	select {}
 }
+
+// bind connects the forms of index.html
+func (a *app) bind() {
+	a.onSubmit("login", func(form js.Value) {
+		a.session.SignIn(field(form, "username"), field(form, "password"))
+	})
+	a.onSubmit("logout", func(form js.Value) {
+		a.session.SignOut()
+	})
+	a.onSubmit("add-user", func(form js.Value) {
+		a.cp.EnqueuePacket(a.userID, 'c', "", &user.User{Name: field(form, "name"), Email: field(form, "email")})
+		form.Call("reset")
+	})
+}
+
+// onSubmit runs fn instead of submitting the form with id
+func (a *app) onSubmit(id string, fn func(form js.Value)) {
+	form := a.doc.Call("getElementById", id)
+	form.Call("addEventListener", "submit", js.FuncOf(func(this js.Value, args []js.Value) any {
+		args[0].Call("preventDefault")
+		fn(form)
+		return nil
+	}))
+}
+
+func field(form js.Value, name string) string {
+	return form.Get("elements").Get(name).Get("value").String()
+}
+
+// result replaces the list with the users of a Read
+func (a *app) result(pr crudp.PacketResult) {
+	if pr.HandlerID != a.userID || pr.Action != 'r' || pr.MessageType == uint8(tinystring.Msg.Error) {
+		return
+	}
+	var users []user.User // Read returns the list as one item
+	if len(pr.Data) > 0 && a.cp.DecodeData(&pr.Packet, 0, &users) != nil {
+		return
+	}
+	a.users = users
+	a.render()
+}
+
+// live applies a user saved or deleted by anyone
+func (a *app) live(ev crudp.Event) {
+	var u user.User
+	if err := a.cp.Codec().Decode(ev.Data, &u); err != nil {
+		return
+	}
+	kept := a.users[:0]
+	for _, existing := range a.users {
+		if existing.ID != u.ID {
+			kept = append(kept, existing)
+		}
+	}
+	a.users = kept
+	if ev.Channel == user.Saved {
+		a.users = append(a.users, u)
+	}
+	a.render()
+}
+
+// render lists the users, each with a delete button
+func (a *app) render() {
+	list := a.doc.Call("getElementById", "users")
+	list.Set("textContent", "")
+	for _, u := range a.users {
+		id := u.ID
+		item := a.doc.Call("createElement", "li")
+		item.Set("textContent", u.Name+" <"+u.Email+"> ")
+		remove := a.doc.Call("createElement", "button")
+		remove.Set("textContent", "Delete")
+		remove.Call("addEventListener", "click", js.FuncOf(func(this js.Value, args []js.Value) any {
+			a.cp.EnqueuePacket(a.userID, 'd', "", &user.User{ID: id})
+			return nil
+		}))
+		item.Call("appendChild", remove)
+		list.Call("appendChild", item)
+	}
+	a.doc.Call("getElementById", "count").Set("textContent", strconv.Itoa(len(a.users)))
+}
+
+// message shows results, errors and network notices in the status line
+func (a *app) message(msgType uint8, message string) {
+	status := a.doc.Call("getElementById", "status")
+	status.Set("textContent", message)
+	status.Set("className", "type-"+strconv.Itoa(int(msgType)))
+}
@@ -4,69 +4,76 @@ package main
 
 import (
 	"context"
-	"io"
+	"crypto/rand"
+	"errors"
 	"log"
 	"net/http"
 	"os"
 
+	"github.com/cdvelop/crudp"
+	"github.com/cdvelop/crudp/auth"
 	"github.com/cdvelop/crudp/example/pkg/router"
 )
 
 func main() {
+	cfg := crudp.DefaultConfig()
+	cfg.UserProvider = auth.Provider{}
 
-	publicDir := "public" // Template variable
+	// Sessions live in HttpOnly cookies, which EventSource sends too
+	jwt := auth.New(secret())
+	jwt.Cookie = "example_session"
 
-	// Debug: Print working directory and check if public exists
-	_, err := os.Getwd()
+	cp, err := router.NewRouter(jwt.SessionHandler(demoUsers), crudp.WithConfig(cfg))
 	if err != nil {
-		log.Printf("Error getting working directory: %v", err)
+		log.Fatal(err)
 	}
 
-	if _, err := os.Stat(publicDir); os.IsNotExist(err) {
-		log.Printf("WARNING: Public directory '%s' does not exist!", publicDir)
+	// wasm_exec.js of the installed toolchain and the module bootstrap
+	loader, err := crudp.WASMLoader{}.Handler()
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	// Serve static files with no-cache headers
-	fs := http.FileServer(http.Dir(publicDir))
-
-	// Middleware to disable caching for static files (useful in dev/test)
+	// No caching of the static files, so rebuilt modules load at once
 	noCache := func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Prevent browser caching
 			w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
-			w.Header().Set("Pragma", "no-cache")
-			w.Header().Set("Expires", "0")
 			h.ServeHTTP(w, r)
 		})
 	}
 
-	// Use a dedicated ServeMux so we can pass it to an http.Server
+	api := jwt.Middleware(cp.BuildRouter())
 	mux := http.NewServeMux()
-	mux.Handle("/", noCache(fs))
-
-	// Initialize CRUDP router
-	cp := router.NewRouter()
+	mux.Handle("/", noCache(http.FileServer(http.Dir("public"))))
+	mux.Handle("/wasm_exec.js", loader)
+	mux.Handle("/loader.js", loader)
+	mux.Handle(cfg.APIEndpoint, api)
+	mux.Handle(cfg.SSEEndpoint, api)
 
-	// API endpoint for CRUDP protocol
-	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
-		payload, _ := io.ReadAll(r.Body)
-		response, err := cp.ProcessPacket(context.Background(), payload)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/octet-stream")
-		w.Write(response)
-	})
-
-	// Create http.Server with Addr and Handler set
-	server := &http.Server{
-		Addr:    ":6060",
-		Handler: mux,
+	// Port, TLS, timeouts and HTTP/2 come from the CRUDP config
+	log.Println("example listening on", cfg.Port)
+	if err := cp.ListenAndServe(mux); err != nil {
+		log.Fatal("Server failed to start:", err)
 	}
+}
 
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatal("Server failed to start:", err)
+// secret returns the token signing key: JWT_SECRET, else a random key, so
+// sessions end when the server restarts
+func secret() []byte {
+	if s := os.Getenv("JWT_SECRET"); s != "" {
+		return []byte(s)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatal(err)
 	}
+	return key
 }
+
+// demoUsers accepts demo/demo; replace it with a lookup of your users
+var demoUsers = auth.VerifierFunc(func(ctx context.Context, username, password string) (auth.Claims, error) {
+	if username != "demo" || password != "demo" {
+		return auth.Claims{}, errors.New("invalid username or password")
+	}
+	return auth.Claims{Subject: username}, nil
+})
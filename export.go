@@ -0,0 +1,26 @@
+package crudp
+
+import "net/url"
+
+// Export formats
+const (
+	ExportCSV    = "csv"
+	ExportNDJSON = "ndjson"
+)
+
+// ExportURL returns the address of the export of handler (see Exporter) in
+// format (ExportCSV, ExportNDJSON), with params as key, value pairs
+func (cp *CrudP) ExportURL(handler, format string, params ...string) string {
+	query := url.Values{}
+	if format != "" {
+		query.Set("format", format)
+	}
+	for i := 0; i+1 < len(params); i += 2 {
+		query.Add(params[i], params[i+1])
+	}
+	u := cp.EndpointURL(cp.config.ExportEndpoint) + "/" + url.PathEscape(handler)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
@@ -0,0 +1,82 @@
+package crudp
+
+// FlushStrategy decides when the broker sends its queue (client only)
+// Set it in Config.FlushStrategy or with Broker().SetFlushStrategy.
+// Methods are called with the broker lock held.
+type FlushStrategy interface {
+	// Delay returns the ms to wait before flushing after a packet is queued.
+	// scheduled reports whether a flush is already pending; KeepSchedule
+	// leaves it as is (or schedules none).
+	Delay(queued int, scheduled bool) int
+}
+
+// KeepSchedule is returned by FlushStrategy.Delay to keep the pending flush
+const KeepSchedule = -1
+
+// LatencyObserver is implemented by strategies that adapt to the network
+// The broker reports the ms between a flush and the next ReceiveBatch.
+type LatencyObserver interface {
+	ObserveLatency(ms int)
+}
+
+// Debounce flushes ms after the last queued packet (default, with BatchWindow)
+// Suits form submits: bursts of packets leave in one batch.
+func Debounce(ms int) FlushStrategy { return debounce(ms) }
+
+type debounce int
+
+func (d debounce) Delay(queued int, scheduled bool) int { return int(d) }
+
+// FixedWindow flushes ms after the first queued packet
+// Suits chat-like streams where debouncing would delay sending indefinitely.
+func FixedWindow(ms int) FlushStrategy { return fixedWindow(ms) }
+
+type fixedWindow int
+
+func (w fixedWindow) Delay(queued int, scheduled bool) int {
+	if scheduled {
+		return KeepSchedule
+	}
+	return int(w)
+}
+
+// ManualFlush never schedules a flush; call Broker().FlushNow()
+func ManualFlush() FlushStrategy { return manualFlush{} }
+
+type manualFlush struct{}
+
+func (manualFlush) Delay(queued int, scheduled bool) int { return KeepSchedule }
+
+// Adaptive is a fixed window of half the recent round trip, within [min, max] ms
+// Fast networks send almost immediately; slow ones batch more per request.
+func Adaptive(min, max int) FlushStrategy {
+	return &adaptiveFlush{min: min, max: max, rtt: min * 2}
+}
+
+type adaptiveFlush struct {
+	min, max int
+	rtt      int // Moving average in ms
+}
+
+func (a *adaptiveFlush) Delay(queued int, scheduled bool) int {
+	if scheduled {
+		return KeepSchedule
+	}
+	return a.window()
+}
+
+func (a *adaptiveFlush) window() int {
+	w := a.rtt / 2
+	if w < a.min {
+		return a.min
+	}
+	if w > a.max {
+		return a.max
+	}
+	return w
+}
+
+// ObserveLatency updates the average with a weight of 1/4 per sample
+func (a *adaptiveFlush) ObserveLatency(ms int) {
+	a.rtt += (ms - a.rtt) / 4
+}
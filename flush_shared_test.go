@@ -0,0 +1,82 @@
+package crudp_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cdvelop/crudp"
+)
+
+func FlushStrategyShared(t *testing.T) {
+	newCP := func(s crudp.FlushStrategy) (*crudp.CrudP, *int32) {
+		cfg := crudp.DefaultConfig()
+		cfg.FlushStrategy = s
+		cp := crudp.New(cfg)
+		var flushes int32
+		cp.Broker().SetOnFlush(func([]byte) { atomic.AddInt32(&flushes, 1) })
+		return cp, &flushes
+	}
+
+	t.Run("Debounce Waits For Quiet", func(t *testing.T) {
+		cp, flushes := newCP(crudp.Debounce(30))
+		for i := 0; i < 4; i++ {
+			cp.Broker().Enqueue(0, 'c', "", []byte(`{}`))
+			time.Sleep(15 * time.Millisecond)
+		}
+		if n := atomic.LoadInt32(flushes); n != 0 {
+			t.Fatalf("flushed %d times while packets kept coming", n)
+		}
+		time.Sleep(60 * time.Millisecond)
+		if n := atomic.LoadInt32(flushes); n != 1 {
+			t.Errorf("expected 1 flush, got %d", n)
+		}
+	})
+
+	t.Run("Fixed Window Flushes During Stream", func(t *testing.T) {
+		cp, flushes := newCP(crudp.FixedWindow(30))
+		for i := 0; i < 6; i++ {
+			cp.Broker().Enqueue(0, 'c', "", []byte(`{}`))
+			time.Sleep(15 * time.Millisecond)
+		}
+		if n := atomic.LoadInt32(flushes); n == 0 {
+			t.Error("fixed window was postponed by new packets")
+		}
+	})
+
+	t.Run("Manual Only", func(t *testing.T) {
+		cp, flushes := newCP(crudp.ManualFlush())
+		cp.Broker().Enqueue(0, 'c', "", []byte(`{}`))
+		time.Sleep(80 * time.Millisecond)
+		if n := atomic.LoadInt32(flushes); n != 0 {
+			t.Fatalf("manual strategy flushed %d times", n)
+		}
+		cp.Broker().FlushNow()
+		if n := atomic.LoadInt32(flushes); n != 1 || cp.Broker().QueueLength() != 0 {
+			t.Errorf("FlushNow: %d flushes, %d queued", n, cp.Broker().QueueLength())
+		}
+	})
+
+	t.Run("Adaptive Follows Latency", func(t *testing.T) {
+		s := crudp.Adaptive(5, 100)
+		if d := s.Delay(1, false); d != 5 {
+			t.Errorf("initial window %d, want 5", d)
+		}
+		o := s.(crudp.LatencyObserver)
+		for i := 0; i < 20; i++ {
+			o.ObserveLatency(120)
+		}
+		if d := s.Delay(1, false); d < 50 || d > 60 {
+			t.Errorf("window after slow round trips %d, want about 60", d)
+		}
+		for i := 0; i < 40; i++ {
+			o.ObserveLatency(1000)
+		}
+		if d := s.Delay(1, false); d != 100 {
+			t.Errorf("window not capped: %d", d)
+		}
+		if d := s.Delay(2, true); d != crudp.KeepSchedule {
+			t.Errorf("pending flush postponed: %d", d)
+		}
+	})
+}
@@ -0,0 +1,75 @@
+//go:build wasm
+
+package form
+
+import "syscall/js"
+
+// Mount renders the form filled with value into container and wires it:
+// inputs run Validate on blur and show the message in their error span, and
+// submitting binds the inputs and enqueues the value for action. done gets
+// the submitted value or the first binding error. Call the returned release
+// when the form is removed.
+func (f *Form) Mount(container js.Value, action byte, value any, done func(any, error)) (release func()) {
+	container.Set("innerHTML", f.HTML(value))
+	var funcs []js.Func
+
+	for _, field := range f.Fields {
+		if field.Input == "hidden" {
+			continue
+		}
+		field := field
+		input := container.Call("querySelector", "#"+f.ID(field))
+		if input.IsNull() {
+			continue
+		}
+		onBlur := js.FuncOf(func(this js.Value, args []js.Value) any {
+			message := ""
+			if err := f.Validate(field, inputValue(input)); err != nil {
+				message = err.Error()
+			}
+			errSpan := container.Call("querySelector", `[data-error="`+escape(field.JSON)+`"]`)
+			if !errSpan.IsNull() {
+				errSpan.Set("textContent", message)
+			}
+			return nil
+		})
+		input.Call("addEventListener", "blur", onBlur)
+		funcs = append(funcs, onBlur)
+	}
+
+	form := container.Call("querySelector", "form")
+	onSubmit := js.FuncOf(func(this js.Value, args []js.Value) any {
+		args[0].Call("preventDefault")
+		v, err := f.Bind(func(name string) (string, bool) {
+			input := form.Call("querySelector", `[name="`+escape(name)+`"]`)
+			if input.IsNull() {
+				return "", false
+			}
+			return inputValue(input), true
+		})
+		if err == nil {
+			err = f.Submit(action, v)
+		}
+		done(v, err)
+		return nil
+	})
+	form.Call("addEventListener", "submit", onSubmit)
+	funcs = append(funcs, onSubmit)
+
+	return func() {
+		for _, fn := range funcs {
+			fn.Release()
+		}
+	}
+}
+
+// inputValue reads an input, "true"/"false" for checkboxes
+func inputValue(input js.Value) string {
+	if input.Get("type").String() == "checkbox" {
+		if input.Get("checked").Bool() {
+			return "true"
+		}
+		return "false"
+	}
+	return input.Get("value").String()
+}
@@ -0,0 +1,290 @@
+// Package form builds HTML forms from the crudp schema of a handler.
+//
+// A Form renders one input per field of the handler type, binds the input
+// values back into a new value of that type, runs the FieldValidator of the
+// handler per field and submits the value with EnqueuePacket:
+//
+//	f, err := form.New(cp, "product")
+//	container.Set("innerHTML", f.HTML(current))
+//	f.Mount(container, 'c', func(v any, err error) { ... }) // WASM
+//
+// Struct tags customize the inputs: label:"Product title" sets the label,
+// input:"email" (or textarea, password, hidden, date...) the input type and
+// form:"-" skips the field. ID fields are hidden. Fields of kinds without an
+// input (slices, maps, nested structs) are left out.
+package form
+
+import (
+	"reflect"
+	"strconv"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Form renders and binds the fields of one handler
+type Form struct {
+	cp      *crudp.CrudP
+	schema  crudp.HandlerSchema
+	handler any // Registered handler, for FieldValidator
+	typ     reflect.Type
+	Fields  []Field
+}
+
+// Field is one input of the form
+type Field struct {
+	crudp.FieldSchema
+	Label string
+	Input string // HTML input type, "textarea" or "select"... from the input tag
+	index int    // Struct field index
+}
+
+// New builds the form of the handler registered as name
+func New(cp *crudp.CrudP, name string) (*Form, error) {
+	f := &Form{cp: cp}
+	found := false
+	for _, s := range cp.Schema() {
+		if s.Name == name {
+			f.schema, found = s, true
+			break
+		}
+	}
+	if !found {
+		return nil, Err(Fmt("form: handler %s not registered", name))
+	}
+	for _, spec := range cp.Manifest() {
+		if spec.Name == name {
+			f.handler = spec.Handler
+		}
+	}
+
+	f.typ = reflect.TypeOf(f.handler)
+	if ep, ok := f.handler.(crudp.EntityProvider); ok && ep.Entity() != nil {
+		f.typ = reflect.TypeOf(ep.Entity())
+	}
+	for f.typ.Kind() == reflect.Ptr {
+		f.typ = f.typ.Elem()
+	}
+	if f.typ.Kind() != reflect.Struct {
+		return nil, Err(Fmt("form: handler %s is not a struct", name))
+	}
+
+	for _, fs := range f.schema.Fields {
+		sf, _ := f.typ.FieldByName(fs.Name)
+		if sf.Tag.Get("form") == "-" || sf.Tag.Get("json") == "-" {
+			continue
+		}
+		input := sf.Tag.Get("input")
+		if input == "" {
+			input = inputType(sf)
+		}
+		if input == "" {
+			continue
+		}
+		label := sf.Tag.Get("label")
+		if label == "" {
+			label = fs.Name
+		}
+		f.Fields = append(f.Fields, Field{FieldSchema: fs, Label: label, Input: input, index: sf.Index[0]})
+	}
+	return f, nil
+}
+
+// Handler returns the handler name of the form
+func (f *Form) Handler() string {
+	return f.schema.Name
+}
+
+// inputType picks the input of a field by kind, "" if it has none
+func inputType(sf reflect.StructField) string {
+	if sf.Name == "ID" {
+		return "hidden"
+	}
+	t := sf.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "text"
+	case reflect.Bool:
+		return "checkbox"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	}
+	return ""
+}
+
+// ID returns the element id of a field input, "<handler>-<json name>"
+func (f *Form) ID(field Field) string {
+	return f.schema.Name + "-" + field.JSON
+}
+
+// HTML renders the form filled with value (nil for an empty form)
+// Each input is followed by <span class="error" data-error="<json name>">
+// where Mount shows the FieldValidator message.
+func (f *Form) HTML(value any) string {
+	var v reflect.Value
+	if value != nil {
+		v = reflect.ValueOf(value)
+		for v.Kind() == reflect.Ptr && !v.IsNil() {
+			v = v.Elem()
+		}
+		if v.Type() != f.typ {
+			v = reflect.Value{}
+		}
+	}
+
+	html := `<form data-handler="` + escape(f.schema.Name) + `">`
+	for _, field := range f.Fields {
+		current := ""
+		if v.IsValid() {
+			current = format(v.Field(field.index))
+		}
+		id, name := escape(f.ID(field)), escape(field.JSON)
+
+		if field.Input != "hidden" {
+			html += `<label for="` + id + `">` + escape(field.Label) + `</label>`
+		}
+		switch field.Input {
+		case "textarea":
+			html += `<textarea id="` + id + `" name="` + name + `">` + escape(current) + `</textarea>`
+		case "checkbox":
+			checked := ""
+			if current == "true" {
+				checked = " checked"
+			}
+			html += `<input id="` + id + `" name="` + name + `" type="checkbox" value="true"` + checked + `>`
+		default:
+			html += `<input id="` + id + `" name="` + name + `" type="` + escape(field.Input) + `" value="` + escape(current) + `">`
+		}
+		if field.Input != "hidden" {
+			html += `<span class="error" data-error="` + name + `"></span>`
+		}
+	}
+	return html + `<button type="submit">Save</button></form>`
+}
+
+// Validate runs the FieldValidator of the handler on one input value
+func (f *Form) Validate(field Field, value string) error {
+	if validator, ok := f.handler.(crudp.FieldValidator); ok {
+		return validator.ValidateField(field.JSON, value)
+	}
+	return nil
+}
+
+// Bind returns a new value of the handler type (a pointer) with the fields
+// set from get, which returns the input value by JSON name; missing inputs
+// keep the zero value. Every field is checked with Validate.
+func (f *Form) Bind(get func(name string) (string, bool)) (any, error) {
+	ptr := reflect.New(f.typ)
+	for _, field := range f.Fields {
+		value, ok := get(field.JSON)
+		if !ok {
+			continue
+		}
+		if err := f.Validate(field, value); err != nil {
+			return nil, Err(Fmt("%s: %v", field.Label, err))
+		}
+		if err := parse(ptr.Elem().Field(field.index), value); err != nil {
+			return nil, Err(Fmt("%s: %v", field.Label, err))
+		}
+	}
+	return ptr.Interface(), nil
+}
+
+// Submit enqueues value for action ('c' or 'u') on the handler of the form
+func (f *Form) Submit(action byte, value any, opts ...crudp.CallOption) error {
+	return f.cp.EnqueuePacket(f.schema.ID, action, "", value, opts...)
+}
+
+// format returns the input value of a field
+func format(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	}
+	return ""
+}
+
+// parse sets a field from its input value; "" leaves the zero value
+func parse(v reflect.Value, value string) error {
+	if value == "" {
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		elem := reflect.New(v.Type().Elem())
+		if err := parse(elem.Elem(), value); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return Err(Fmt("%q is not a whole number", value))
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return Err(Fmt("%q is not a positive whole number", value))
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return Err(Fmt("%q is not a number", value))
+		}
+		v.SetFloat(n)
+	}
+	return nil
+}
+
+// escape makes s safe inside HTML text and double-quoted attributes
+func escape(s string) string {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '&':
+			out = append(out, "&amp;"...)
+		case '<':
+			out = append(out, "&lt;"...)
+		case '>':
+			out = append(out, "&gt;"...)
+		case '"':
+			out = append(out, "&#34;"...)
+		case '\'':
+			out = append(out, "&#39;"...)
+		default:
+			out = append(out, c)
+		}
+	}
+	return string(out)
+}
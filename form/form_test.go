@@ -0,0 +1,111 @@
+//go:build !wasm
+
+package form
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Contact is a form handler with tags, a validator and skipped fields
+type Contact struct {
+	ID      int      `json:"id"`
+	Name    string   `json:"name" label:"Full name"`
+	Email   string   `json:"email" input:"email"`
+	Age     *int     `json:"age"`
+	Notes   string   `json:"notes" input:"textarea"`
+	Active  bool     `json:"active"`
+	Tags    []string `json:"tags"`
+	Secret  string   `json:"-"`
+	Comment string   `json:"comment" form:"-"`
+}
+
+func (h *Contact) Create(ctx context.Context, data ...any) any { return data }
+
+func (h *Contact) ValidateField(fieldName, value string) error {
+	if fieldName == "email" && !strings.Contains(value, "@") {
+		return Errf("invalid email")
+	}
+	return nil
+}
+
+func newForm(t *testing.T) (*crudp.CrudP, *Form) {
+	cp := crudp.New(crudp.WithHandlers(&Contact{}))
+	f, err := New(cp, "contact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cp, f
+}
+
+func TestFields(t *testing.T) {
+	_, f := newForm(t)
+	var names []string
+	for _, field := range f.Fields {
+		names = append(names, field.JSON+":"+field.Input)
+	}
+	if got := strings.Join(names, " "); got != "id:hidden name:text email:email age:number notes:textarea active:checkbox" {
+		t.Errorf("unexpected fields %s", got)
+	}
+	if _, err := New(crudp.New(), "contact"); err == nil {
+		t.Error("expected error for an unknown handler")
+	}
+}
+
+func TestHTML(t *testing.T) {
+	_, f := newForm(t)
+	age := 30
+	html := f.HTML(&Contact{ID: 7, Name: `Ana "<b>"`, Age: &age, Active: true})
+	for _, want := range []string{
+		`<form data-handler="contact">`,
+		`<input id="contact-id" name="id" type="hidden" value="7">`,
+		`<label for="contact-name">Full name</label><input id="contact-name" name="name" type="text" value="Ana &#34;&lt;b&gt;&#34;">`,
+		`<span class="error" data-error="name"></span>`,
+		`type="email" value=""`,
+		`name="age" type="number" value="30"`,
+		`<textarea id="contact-notes" name="notes"></textarea>`,
+		`type="checkbox" value="true" checked>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("missing %s in\n%s", want, html)
+		}
+	}
+	if strings.Contains(html, "tags") || strings.Contains(html, "comment") {
+		t.Errorf("skipped fields rendered:\n%s", html)
+	}
+}
+
+func TestBindAndSubmit(t *testing.T) {
+	cp, f := newForm(t)
+	inputs := map[string]string{"id": "7", "name": "Ana", "email": "ana@x.io", "age": "30", "active": "true"}
+	get := func(name string) (string, bool) {
+		v, ok := inputs[name]
+		return v, ok
+	}
+
+	v, err := f.Bind(get)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := v.(*Contact)
+	if c.ID != 7 || c.Name != "Ana" || c.Age == nil || *c.Age != 30 || !c.Active || c.Notes != "" {
+		t.Errorf("unexpected bound value %+v", c)
+	}
+	if err := f.Submit('c', v); err != nil || cp.Broker().QueueLength() != 1 {
+		t.Errorf("expected a queued packet, got %d (%v)", cp.Broker().QueueLength(), err)
+	}
+	cp.Broker().Clear()
+
+	inputs["email"] = "nope"
+	if _, err := f.Bind(get); err == nil || !strings.Contains(err.Error(), "invalid email") {
+		t.Errorf("expected FieldValidator error, got %v", err)
+	}
+	inputs["email"], inputs["age"] = "ana@x.io", "thirty"
+	if _, err := f.Bind(get); err == nil || !strings.Contains(err.Error(), `Age: "thirty" is not`) {
+		t.Errorf("expected parse error, got %v", err)
+	}
+}
@@ -0,0 +1,440 @@
+package crudp
+
+import (
+	"encoding/binary"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// Binary framing (Config.UseBinary)
+//
+// Envelopes (BatchRequest, BatchResponse, Packet) are length-prefixed frames;
+// items in Packet.Data are encoded with the inner codec. On decode each
+// Packet.Data item is a sub-slice of the input, not a copy:
+//
+//   - The input buffer must not be modified or reused while decoded packets
+//     are in use. ProcessBatch only needs it for the duration of the call.
+//   - Data kept beyond that (e.g. in handler state) must be copied.
+//
+// Layout (integers are varints, strings and bytes are uvarint length + bytes):
+//
+//	batch   = header count packet... [continuation]  (continuation: responses only)
+//	header  = 0xCB kind | 0xCC layout kind
+//	packet  = action handlerID version reqID page? deps refs count data... count attachment... ifNoneMatch [deadline] [deferred] [readAfter]
+//	result  = packet messageType message retryAfter pageInfo? items ids redirect code etag [messageKey count messageArg...] [jobID] [writeToken]
+//	page    = 0 | 1 offset limit cursor
+//	pageInfo = 0 | 1 total nextCursor hasMore
+//
+// Fields marked [..] exist from a later layout version. Frames are written
+// with the oldest layout holding their values, so peers that predate a field
+// still read frames that do not use it; 0xCB frames are layout 1.
+const (
+	frameMagic    byte = 0xCB
+	frameMagicV   byte = 0xCC // Followed by the layout version
+	frameRequest  byte = 'q'
+	frameResponse byte = 's'
+	framePacket   byte = 'p'
+)
+
+// Frame layout versions
+const (
+	frameLayout1 byte = 1 // Up to Packet.IfNoneMatch
+	frameLayout2 byte = 2 // Packet.Deadline
+	frameLayout3 byte = 3 // PacketResult.MessageKey and MessageArgs
+	frameLayout4 byte = 4 // Packet.Deferred and PacketResult.JobID
+	frameLayout5 byte = 5 // Packet.ReadAfter and PacketResult.WriteToken
+
+	frameLayout = frameLayout5 // Newest layout this codec reads
+)
+
+// frameCodec frames protocol envelopes and delegates items to the inner codec
+type frameCodec struct {
+	inner Codec
+}
+
+// NewFrameCodec returns the binary framing codec over an item codec
+func NewFrameCodec(inner Codec) Codec {
+	return &frameCodec{inner: inner}
+}
+
+func (c *frameCodec) Encode(v any) ([]byte, error) {
+	return c.EncodeTo(nil, v)
+}
+
+func (c *frameCodec) EncodeTo(dst []byte, v any) ([]byte, error) {
+	switch m := v.(type) {
+	case BatchRequest:
+		return appendBatchRequest(dst, &m), nil
+	case *BatchRequest:
+		return appendBatchRequest(dst, m), nil
+	case BatchResponse:
+		return appendBatchResponse(dst, &m), nil
+	case *BatchResponse:
+		return appendBatchResponse(dst, m), nil
+	case Packet:
+		return appendSinglePacket(dst, &m), nil
+	case *Packet:
+		return appendSinglePacket(dst, m), nil
+	}
+	return encodeTo(c.inner, dst, v)
+}
+
+func (c *frameCodec) Decode(data []byte, v any) error {
+	switch m := v.(type) {
+	case *BatchRequest:
+		r, err := frameReader(data, frameRequest)
+		if err != nil {
+			return err
+		}
+		n := r.uvarint()
+		m.Packets = m.Packets[:0]
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			m.Packets = append(m.Packets, Packet{})
+			r.packet(&m.Packets[len(m.Packets)-1])
+		}
+		return r.err
+	case *BatchResponse:
+		r, err := frameReader(data, frameResponse)
+		if err != nil {
+			return err
+		}
+		n := r.uvarint()
+		m.Results = m.Results[:0]
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			m.Results = append(m.Results, PacketResult{})
+			r.result(&m.Results[len(m.Results)-1])
+		}
+		m.Continuation = r.string()
+		return r.err
+	case *Packet:
+		r, err := frameReader(data, framePacket)
+		if err != nil {
+			return err
+		}
+		r.packet(m)
+		return r.err
+	}
+	return c.inner.Decode(data, v)
+}
+
+// packetLayout returns the oldest layout version holding the fields of p
+func packetLayout(p *Packet) byte {
+	switch {
+	case p.ReadAfter != "":
+		return frameLayout5
+	case p.Deferred:
+		return frameLayout4
+	case p.Deadline != 0:
+		return frameLayout2
+	}
+	return frameLayout1
+}
+
+// appendHeader starts a frame of kind written with layout
+func appendHeader(dst []byte, kind, layout byte) []byte {
+	if layout == frameLayout1 {
+		return append(dst, frameMagic, kind)
+	}
+	return append(dst, frameMagicV, layout, kind)
+}
+
+// resultLayout returns the oldest layout version holding the fields of r
+func resultLayout(r *PacketResult) byte {
+	layout := packetLayout(&r.Packet)
+	switch {
+	case r.WriteToken != "":
+		layout = frameLayout5
+	case r.JobID != "":
+		layout = max(layout, frameLayout4)
+	case r.MessageKey != "" || len(r.MessageArgs) > 0:
+		layout = max(layout, frameLayout3)
+	}
+	return layout
+}
+
+func appendSinglePacket(dst []byte, p *Packet) []byte {
+	layout := packetLayout(p)
+	return appendPacket(appendHeader(dst, framePacket, layout), p, layout)
+}
+
+func appendBatchRequest(dst []byte, b *BatchRequest) []byte {
+	layout := frameLayout1
+	for i := range b.Packets {
+		layout = max(layout, packetLayout(&b.Packets[i]))
+	}
+	dst = appendHeader(dst, frameRequest, layout)
+	dst = binary.AppendUvarint(dst, uint64(len(b.Packets)))
+	for i := range b.Packets {
+		dst = appendPacket(dst, &b.Packets[i], layout)
+	}
+	return dst
+}
+
+func appendBatchResponse(dst []byte, b *BatchResponse) []byte {
+	layout := frameLayout1
+	for i := range b.Results {
+		layout = max(layout, resultLayout(&b.Results[i]))
+	}
+	dst = appendHeader(dst, frameResponse, layout)
+	dst = binary.AppendUvarint(dst, uint64(len(b.Results)))
+	for i := range b.Results {
+		r := &b.Results[i]
+		dst = appendPacket(dst, &r.Packet, layout)
+		dst = append(dst, r.MessageType)
+		dst = appendString(dst, r.Message)
+		dst = binary.AppendVarint(dst, int64(r.RetryAfter))
+		if r.PageInfo == nil {
+			dst = append(dst, 0)
+		} else {
+			dst = append(dst, 1)
+			dst = binary.AppendVarint(dst, int64(r.PageInfo.Total))
+			dst = appendString(dst, r.PageInfo.NextCursor)
+			dst = appendBool(dst, r.PageInfo.HasMore)
+		}
+		dst = binary.AppendUvarint(dst, uint64(len(r.Items)))
+		for _, item := range r.Items {
+			dst = binary.AppendVarint(dst, int64(item.Index))
+			dst = append(dst, item.Status)
+			dst = appendString(dst, item.Message)
+		}
+		dst = binary.AppendUvarint(dst, uint64(len(r.IDs)))
+		for _, m := range r.IDs {
+			dst = appendString(dst, m.TempID)
+			dst = appendString(dst, m.RealID)
+		}
+		dst = appendString(dst, r.Redirect)
+		dst = appendString(dst, r.Code)
+		dst = appendString(dst, r.ETag)
+		if layout >= frameLayout3 {
+			dst = appendString(dst, r.MessageKey)
+			dst = binary.AppendUvarint(dst, uint64(len(r.MessageArgs)))
+			for _, arg := range r.MessageArgs {
+				dst = appendString(dst, arg)
+			}
+		}
+		if layout >= frameLayout4 {
+			dst = appendString(dst, r.JobID)
+		}
+		if layout >= frameLayout5 {
+			dst = appendString(dst, r.WriteToken)
+		}
+	}
+	return appendString(dst, b.Continuation)
+}
+
+func appendPacket(dst []byte, p *Packet, layout byte) []byte {
+	dst = append(dst, p.Action, p.HandlerID, p.Version)
+	dst = appendString(dst, p.ReqID)
+	if p.Page == nil {
+		dst = append(dst, 0)
+	} else {
+		dst = append(dst, 1)
+		dst = binary.AppendVarint(dst, int64(p.Page.Offset))
+		dst = binary.AppendVarint(dst, int64(p.Page.Limit))
+		dst = appendString(dst, p.Page.Cursor)
+	}
+	dst = binary.AppendUvarint(dst, uint64(len(p.DependsOn)))
+	for _, reqID := range p.DependsOn {
+		dst = appendString(dst, reqID)
+	}
+	dst = binary.AppendUvarint(dst, uint64(len(p.Refs)))
+	for _, ref := range p.Refs {
+		dst = binary.AppendVarint(dst, int64(ref.Item))
+		dst = appendString(dst, ref.Field)
+		dst = appendString(dst, ref.ReqID)
+	}
+	dst = binary.AppendUvarint(dst, uint64(len(p.Data)))
+	for _, item := range p.Data {
+		dst = binary.AppendUvarint(dst, uint64(len(item)))
+		dst = append(dst, item...)
+	}
+	dst = binary.AppendUvarint(dst, uint64(len(p.Attachments)))
+	for _, blob := range p.Attachments {
+		dst = binary.AppendUvarint(dst, uint64(len(blob)))
+		dst = append(dst, blob...)
+	}
+	dst = appendString(dst, p.IfNoneMatch)
+	if layout >= frameLayout2 {
+		dst = binary.AppendVarint(dst, p.Deadline)
+	}
+	if layout >= frameLayout4 {
+		dst = appendBool(dst, p.Deferred)
+	}
+	if layout >= frameLayout5 {
+		dst = appendString(dst, p.ReadAfter)
+	}
+	return dst
+}
+
+func appendString(dst []byte, s string) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(s)))
+	return append(dst, s...)
+}
+
+func appendBool(dst []byte, b bool) []byte {
+	if b {
+		return append(dst, 1)
+	}
+	return append(dst, 0)
+}
+
+// reader walks a frame, recording the first error
+type reader struct {
+	buf    []byte
+	err    error
+	layout byte // Frame layout version
+}
+
+func frameReader(data []byte, kind byte) (*reader, error) {
+	if len(data) >= 2 && data[0] == frameMagic && data[1] == kind {
+		return &reader{buf: data[2:], layout: frameLayout1}, nil
+	}
+	if len(data) >= 3 && data[0] == frameMagicV && data[2] == kind {
+		if data[1] < frameLayout1 || data[1] > frameLayout {
+			return nil, Err(Fmt("frame: unsupported layout version %d", data[1]))
+		}
+		return &reader{buf: data[3:], layout: data[1]}, nil
+	}
+	return nil, Err(Fmt("frame: not a binary %c frame", kind))
+}
+
+func (r *reader) fail() {
+	if r.err == nil {
+		r.err = Errf("frame: truncated or corrupt")
+	}
+	r.buf = nil
+}
+
+func (r *reader) byte() byte {
+	if len(r.buf) < 1 {
+		r.fail()
+		return 0
+	}
+	b := r.buf[0]
+	r.buf = r.buf[1:]
+	return b
+}
+
+func (r *reader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *reader) varint() int64 {
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+// bytes returns a sub-slice of the input (zero-copy, capacity capped)
+func (r *reader) bytes() []byte {
+	n := r.uvarint()
+	if r.err != nil || n > uint64(len(r.buf)) {
+		r.fail()
+		return nil
+	}
+	b := r.buf[:n:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+// count reads a list length, failing if it can't fit in the remaining input
+// (each entry takes at least one byte)
+func (r *reader) count() uint64 {
+	n := r.uvarint()
+	if n > uint64(len(r.buf)) {
+		r.fail()
+		return 0
+	}
+	return n
+}
+
+func (r *reader) string() string {
+	return string(r.bytes())
+}
+
+func (r *reader) packet(p *Packet) {
+	p.Action = r.byte()
+	p.HandlerID = r.byte()
+	p.Version = r.byte()
+	p.ReqID = r.string()
+	p.Page = nil
+	if r.byte() == 1 {
+		p.Page = &Page{Offset: int(r.varint()), Limit: int(r.varint()), Cursor: r.string()}
+	}
+
+	p.DependsOn = nil
+	for n := r.count(); n > 0 && r.err == nil; n-- {
+		p.DependsOn = append(p.DependsOn, r.string())
+	}
+	p.Refs = nil
+	for n := r.count(); n > 0 && r.err == nil; n-- {
+		p.Refs = append(p.Refs, Ref{Item: int(r.varint()), Field: r.string(), ReqID: r.string()})
+	}
+
+	n := r.count()
+	p.Data = make([][]byte, 0, n)
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		p.Data = append(p.Data, r.bytes())
+	}
+	p.Attachments = nil
+	for n := r.count(); n > 0 && r.err == nil; n-- {
+		p.Attachments = append(p.Attachments, r.bytes())
+	}
+	p.IfNoneMatch = r.string()
+	p.Deadline = 0
+	if r.layout >= frameLayout2 {
+		p.Deadline = r.varint()
+	}
+	p.Deferred = r.layout >= frameLayout4 && r.byte() == 1
+	p.ReadAfter = ""
+	if r.layout >= frameLayout5 {
+		p.ReadAfter = r.string()
+	}
+}
+
+func (r *reader) result(pr *PacketResult) {
+	r.packet(&pr.Packet)
+	pr.MessageType = r.byte()
+	pr.Message = r.string()
+	pr.RetryAfter = int(r.varint())
+	pr.PageInfo = nil
+	if r.byte() == 1 {
+		pr.PageInfo = &PageInfo{Total: int(r.varint()), NextCursor: r.string(), HasMore: r.byte() == 1}
+	}
+
+	pr.Items = nil
+	for n := r.count(); n > 0 && r.err == nil; n-- {
+		pr.Items = append(pr.Items, ItemResult{Index: int(r.varint()), Status: r.byte(), Message: r.string()})
+	}
+	pr.IDs = nil
+	for n := r.count(); n > 0 && r.err == nil; n-- {
+		pr.IDs = append(pr.IDs, IDMapping{TempID: r.string(), RealID: r.string()})
+	}
+	pr.Redirect = r.string()
+	pr.Code = r.string()
+	pr.ETag = r.string()
+	pr.MessageKey, pr.MessageArgs = "", nil
+	if r.layout >= frameLayout3 {
+		pr.MessageKey = r.string()
+		for n := r.count(); n > 0 && r.err == nil; n-- {
+			pr.MessageArgs = append(pr.MessageArgs, r.string())
+		}
+	}
+	pr.JobID, pr.WriteToken = "", ""
+	if r.layout >= frameLayout4 {
+		pr.JobID = r.string()
+	}
+	if r.layout >= frameLayout5 {
+		pr.WriteToken = r.string()
+	}
+}
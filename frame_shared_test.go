@@ -0,0 +1,159 @@
+package crudp_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+func FrameCodecShared(t *testing.T) {
+	codec := crudp.NewFrameCodec(crudp.NewDefault().Codec())
+
+	t.Run("Round Trip", func(t *testing.T) {
+		req := crudp.BatchRequest{Packets: []crudp.Packet{
+			{Action: 'c', HandlerID: 2, ReqID: "a", Data: [][]byte{[]byte("one"), []byte("two")}},
+			{Action: 'r', HandlerID: 3, Version: 1, ReqID: "b", Page: &crudp.Page{Offset: 10, Limit: 5, Cursor: "x"}},
+		}}
+		encoded, err := codec.Encode(req)
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+
+		var got crudp.BatchRequest
+		if err := codec.Decode(encoded, &got); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(got.Packets) != 2 || string(got.Packets[0].Data[1]) != "two" || got.Packets[1].Version != 1 {
+			t.Fatalf("unexpected packets: %+v", got.Packets)
+		}
+		if p := got.Packets[1].Page; p == nil || p.Offset != 10 || p.Limit != 5 || p.Cursor != "x" {
+			t.Errorf("unexpected page: %+v", p)
+		}
+
+		resp := crudp.BatchResponse{Results: []crudp.PacketResult{{
+			Packet:      crudp.Packet{Action: 'r', ReqID: "b"},
+			MessageType: uint8(Msg.Warning),
+			Message:     "slow down",
+			RetryAfter:  250,
+			PageInfo:    &crudp.PageInfo{Total: -1, NextCursor: "y", HasMore: true},
+			Items:       []crudp.ItemResult{crudp.ItemOK(0), crudp.ItemError(1, Err("bad row"))},
+		}}}
+		encoded, _ = codec.Encode(&resp)
+		var gotResp crudp.BatchResponse
+		if err := codec.Decode(encoded, &gotResp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		r := gotResp.Results[0]
+		if r.Message != "slow down" || r.RetryAfter != 250 || r.PageInfo == nil || r.PageInfo.Total != -1 || !r.PageInfo.HasMore {
+			t.Errorf("unexpected result: %+v", r)
+		}
+		if len(r.Items) != 2 || r.Items[0].Failed() || r.Items[1].Index != 1 || r.Items[1].Message != "bad row" {
+			t.Errorf("unexpected items: %+v", r.Items)
+		}
+	})
+
+	t.Run("Data References Input", func(t *testing.T) {
+		encoded, _ := codec.Encode(crudp.BatchRequest{Packets: []crudp.Packet{{Data: [][]byte{[]byte("abc")}}}})
+
+		var got crudp.BatchRequest
+		codec.Decode(encoded, &got)
+		encoded[bytes.Index(encoded, []byte("abc"))+2] = 'Z' // Last data byte
+		if string(got.Packets[0].Data[0]) != "abZ" {
+			t.Errorf("expected Data to alias the input, got %q", got.Packets[0].Data[0])
+		}
+	})
+
+	t.Run("Layout Versions", func(t *testing.T) {
+		// Frames without a Deadline keep layout 1 so older peers read them
+		plain, _ := codec.Encode(crudp.BatchRequest{Packets: []crudp.Packet{{ReqID: "a", IfNoneMatch: "e1"}}})
+		if plain[0] != 0xCB || plain[1] != 'q' {
+			t.Fatalf("expected a layout 1 header, got % x", plain[:2])
+		}
+		var got crudp.BatchRequest
+		if err := codec.Decode(plain, &got); err != nil || got.Packets[0].IfNoneMatch != "e1" || got.Packets[0].Deadline != 0 {
+			t.Fatalf("layout 1: %+v, %v", got.Packets, err)
+		}
+
+		timed, _ := codec.Encode(crudp.BatchRequest{Packets: []crudp.Packet{{ReqID: "a"}, {ReqID: "b", Deadline: 1700000000000}}})
+		if timed[0] != 0xCC || timed[1] != 2 || timed[2] != 'q' {
+			t.Fatalf("expected a layout 2 header, got % x", timed[:3])
+		}
+		if err := codec.Decode(timed, &got); err != nil || len(got.Packets) != 2 || got.Packets[1].Deadline != 1700000000000 {
+			t.Fatalf("layout 2: %+v, %v", got.Packets, err)
+		}
+
+		keyed, _ := codec.Encode(crudp.BatchResponse{Results: []crudp.PacketResult{{MessageKey: crudp.MsgDependencyFailed, MessageArgs: []string{"a"}}}})
+		if keyed[0] != 0xCC || keyed[1] != 3 || keyed[2] != 's' {
+			t.Fatalf("expected a layout 3 header, got % x", keyed[:3])
+		}
+		var resp crudp.BatchResponse
+		if err := codec.Decode(keyed, &resp); err != nil || resp.Results[0].MessageKey != crudp.MsgDependencyFailed || len(resp.Results[0].MessageArgs) != 1 {
+			t.Fatalf("layout 3: %+v, %v", resp.Results, err)
+		}
+
+		deferred, _ := codec.Encode(crudp.BatchRequest{Packets: []crudp.Packet{{ReqID: "a", Deferred: true}}})
+		if deferred[0] != 0xCC || deferred[1] != 4 || deferred[2] != 'q' {
+			t.Fatalf("expected a layout 4 header, got % x", deferred[:3])
+		}
+		if err := codec.Decode(deferred, &got); err != nil || !got.Packets[0].Deferred {
+			t.Fatalf("layout 4: %+v, %v", got.Packets, err)
+		}
+		job, _ := codec.Encode(crudp.BatchResponse{Results: []crudp.PacketResult{{Code: crudp.CodeDeferred, JobID: "j1"}}})
+		if job[1] != 4 {
+			t.Fatalf("expected a layout 4 header, got % x", job[:3])
+		}
+		if err := codec.Decode(job, &resp); err != nil || resp.Results[0].JobID != "j1" {
+			t.Fatalf("layout 4: %+v, %v", resp.Results, err)
+		}
+
+		tokened, _ := codec.Encode(crudp.BatchResponse{Results: []crudp.PacketResult{{Packet: crudp.Packet{ReadAfter: "t0"}, WriteToken: "t1"}}})
+		if tokened[1] != 5 {
+			t.Fatalf("expected a layout 5 header, got % x", tokened[:3])
+		}
+		if err := codec.Decode(tokened, &resp); err != nil || resp.Results[0].ReadAfter != "t0" || resp.Results[0].WriteToken != "t1" {
+			t.Fatalf("layout 5: %+v, %v", resp.Results, err)
+		}
+
+		timed[1] = 99
+		if err := codec.Decode(timed, &got); err == nil {
+			t.Error("expected error for an unknown layout version")
+		}
+	})
+
+	t.Run("Corrupt Input", func(t *testing.T) {
+		encoded, _ := codec.Encode(crudp.BatchRequest{Packets: []crudp.Packet{{ReqID: "abc", Data: [][]byte{[]byte("abc")}}}})
+
+		var got crudp.BatchRequest
+		if err := codec.Decode(encoded[:len(encoded)-2], &got); err == nil {
+			t.Error("expected error for truncated frame")
+		}
+		if err := codec.Decode([]byte(`{"packets":[]}`), &got); err == nil {
+			t.Error("expected error for non-binary input")
+		}
+	})
+
+	t.Run("Binary Loopback", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.UseBinary = true
+		server := crudp.New(cfg)
+		server.RegisterHandler(&Note{})
+		client := crudp.NewLoopback(server, cfg, crudp.WithHandlers(&Note{}))
+
+		var results []crudp.PacketResult
+		client.OnResult(func(pr crudp.PacketResult) {
+			results = append(results, pr)
+		})
+		client.EnqueuePacket(0, 'c', "bin-1", &Note{Text: "framed"})
+		client.Broker().FlushNow()
+
+		if len(results) != 1 || results[0].MessageType != uint8(Msg.Success) {
+			t.Fatalf("expected 1 successful result, got %+v", results)
+		}
+		var note Note
+		if err := client.Codec().Decode(results[0].Data[0], &note); err != nil || note.ID != 1 || note.Text != "framed" {
+			t.Errorf("unexpected note: %+v (%v)", note, err)
+		}
+	})
+}
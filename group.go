@@ -0,0 +1,68 @@
+package crudp
+
+import . "github.com/cdvelop/tinystring"
+
+// groupMiddleware is packet middleware added with UseGroupMiddleware
+type groupMiddleware struct {
+	group string
+	mw    PacketMiddleware
+}
+
+// RegisterGroup adds handlers under a namespace: each is named group + "." +
+// its own name (e.g. "admin.user"), so modules of different groups may share
+// a name. Like AddHandler, IDs follow the registered handlers (or
+// Config.HandlerIDs), so call it after RegisterHandler, in the same order on
+// client and server.
+func (cp *CrudP) RegisterGroup(group string, handlers ...any) error {
+	if group == "" {
+		return Errf("group name is empty")
+	}
+	for i := 0; i < len(group); i++ {
+		if group[i] == '.' {
+			return Err(Fmt("group name %s contains '.'", group))
+		}
+	}
+
+	for i, h := range handlers {
+		if h == nil {
+			return Err(Fmt("group %s handler %d is nil", group, i))
+		}
+		if _, err := cp.addHandler(h, group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseGroupMiddleware adds packet middleware run only for the handlers of a
+// group, inside the global middleware, e.g. to authorize every admin.* handler
+func (cp *CrudP) UseGroupMiddleware(group string, mw ...PacketMiddleware) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	chain := make([]groupMiddleware, 0, len(cp.groupMiddleware)+len(mw))
+	chain = append(chain, cp.groupMiddleware...)
+	for _, m := range mw {
+		if m != nil {
+			chain = append(chain, groupMiddleware{group: group, mw: m})
+		}
+	}
+	cp.groupMiddleware = chain
+}
+
+// HandlerGroup returns the group a handler was registered in, "" if none
+func (cp *CrudP) HandlerGroup(handlerID uint8) string {
+	handlers := cp.table()
+	if int(handlerID) >= len(handlers) {
+		return ""
+	}
+	return handlers[handlerID].group
+}
+
+// groupName qualifies a handler name with its group
+func groupName(group, name string) string {
+	if group == "" {
+		return name
+	}
+	return group + "." + name
+}
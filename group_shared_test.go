@@ -0,0 +1,81 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+func HandlerGroupShared(t *testing.T) {
+	t.Run("Namespaced Names", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&User{}))
+		if err := cp.RegisterGroup("admin", &User{}, &Note{}); err != nil {
+			t.Fatal(err)
+		}
+
+		for name, want := range map[string]uint8{"user": 0, "admin.user": 1, "admin.note": 2} {
+			if id, ok := cp.HandlerID(name); !ok || id != want {
+				t.Errorf("HandlerID(%q) = %d, %v, want %d", name, id, ok, want)
+			}
+		}
+		if g := cp.HandlerGroup(1); g != "admin" {
+			t.Errorf("HandlerGroup(1) = %q", g)
+		}
+		if g := cp.HandlerGroup(0); g != "" {
+			t.Errorf("HandlerGroup(0) = %q", g)
+		}
+
+		if err := cp.ReplaceHandler(1, &User{}); err != nil {
+			t.Errorf("ReplaceHandler in group: %v", err)
+		}
+		if err := cp.SelfCheck(); err != nil {
+			t.Errorf("SelfCheck: %v", err)
+		}
+	})
+
+	t.Run("Invalid Group", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		if err := cp.RegisterGroup("", &User{}); err == nil {
+			t.Error("expected error for empty group")
+		}
+		if err := cp.RegisterGroup("a.b", &User{}); err == nil {
+			t.Error("expected error for group with '.'")
+		}
+	})
+
+	t.Run("Group Middleware", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&User{}))
+		cp.RegisterGroup("admin", &User{})
+
+		var order []string
+		cp.UsePacketMiddleware(crudp.PacketMiddlewareFunc(func(next crudp.PacketHandler) crudp.PacketHandler {
+			return func(ctx context.Context, p *crudp.Packet) (crudp.PacketResult, error) {
+				order = append(order, "global")
+				return next(ctx, p)
+			}
+		}))
+		cp.UseGroupMiddleware("admin", crudp.PacketMiddlewareFunc(func(next crudp.PacketHandler) crudp.PacketHandler {
+			return func(ctx context.Context, p *crudp.Packet) (crudp.PacketResult, error) {
+				order = append(order, "admin")
+				pr := crudp.PacketResult{Packet: *p}
+				pr.Data = nil
+				pr.MessageType = uint8(Msg.Error)
+				pr.Message = "admins only"
+				return pr, nil
+			}
+		}))
+
+		data, _ := cp.Codec().Encode(&User{Name: "a"})
+		if pr := processOne(t, cp, crudp.Packet{Action: 'c', HandlerID: 0, Data: [][]byte{data}}); pr.MessageType == uint8(Msg.Error) {
+			t.Errorf("ungrouped handler rejected: %s", pr.Message)
+		}
+		if pr := processOne(t, cp, crudp.Packet{Action: 'c', HandlerID: 1, Data: [][]byte{data}}); pr.Message != "admins only" {
+			t.Errorf("group middleware not applied, got %q", pr.Message)
+		}
+		if len(order) != 3 || order[0] != "global" || order[1] != "global" || order[2] != "admin" {
+			t.Errorf("order = %v", order)
+		}
+	})
+}
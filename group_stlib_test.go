@@ -0,0 +1,9 @@
+//go:build !wasm
+
+package crudp_test
+
+import "testing"
+
+func TestHandlerGroup_Stdlib(t *testing.T) {
+	HandlerGroupShared(t)
+}
@@ -0,0 +1,221 @@
+//go:build !wasm
+
+// Package grpc exposes the CRUDP handler table as a gRPC CrudService
+// (crudservice.proto) using the same dispatch as BuildRouter.
+//
+// It speaks the gRPC wire protocol directly over net/http, so no gRPC runtime
+// is linked. Serve it over HTTP/2: TLS, or cleartext with
+// http.Server.Protocols.SetUnencryptedHTTP2(true).
+//
+// Subscribe streams Event messages whose Data is encoded with the instance
+// codec; use crudp.WithCodec(protocodec.New()) for proto-native consumers.
+//
+// With Config.SigningKeys, Process checks the crudp signature headers sent as
+// metadata (x-crudp-key, x-crudp-timestamp, x-crudp-signature) against the
+// BatchRequest message, without the gRPC length prefix.
+//
+//	srv := &http.Server{Addr: ":9090", Handler: grpc.NewServer(cp)}
+//	srv.Protocols = new(http.Protocols)
+//	srv.Protocols.SetUnencryptedHTTP2(true)
+package grpc
+
+import (
+	_ "embed"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/cdvelop/crudp"
+	"github.com/cdvelop/crudp/protocodec"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Full method names of CrudService
+const (
+	ProcessMethod   = "/crudp.CrudService/Process"
+	SubscribeMethod = "/crudp.CrudService/Subscribe"
+)
+
+// ServiceProto is the crudservice.proto definition (imports protocodec.Proto as crudp.proto)
+//
+//go:embed crudservice.proto
+var ServiceProto string
+
+// gRPC status codes used by the server
+const (
+	codeOK               = 0
+	codeInvalidArgument  = 3
+	codePermissionDenied = 7
+	codeUnimplemented    = 12
+	codeInternal         = 13
+	codeUnauthenticated  = 16
+)
+
+// maxMessageSize bounds a request message (gRPC default)
+const maxMessageSize = 4 << 20
+
+// SubscribeRequest selects the broadcast channels to stream
+type SubscribeRequest struct {
+	Channels []string // Channel patterns (see crudp.MatchChannel), empty = all
+}
+
+// Server serves CrudService for a CrudP instance
+type Server struct {
+	cp    *crudp.CrudP
+	codec *protocodec.Codec
+}
+
+// NewServer returns the gRPC handler for cp
+func NewServer(cp *crudp.CrudP) *Server {
+	return &Server{cp: cp, codec: protocodec.New()}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ProtoMajor != 2 {
+		http.Error(w, "gRPC requires HTTP/2 POST", http.StatusBadRequest)
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "application/grpc" && ct != "application/grpc+proto" {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+
+	switch r.URL.Path {
+	case ProcessMethod:
+		s.process(w, r)
+	case SubscribeMethod:
+		s.subscribe(w, r)
+	default:
+		finish(w, codeUnimplemented, "unknown method "+r.URL.Path)
+	}
+}
+
+// process handles the unary Process RPC
+func (s *Server) process(w http.ResponseWriter, r *http.Request) {
+	msg, code, err := readMessage(r.Body)
+	if err != nil {
+		finish(w, code, err.Error())
+		return
+	}
+
+	ctx := crudp.WithLocale(crudp.WithRemoteAddr(r.Context(), crudp.RemoteIP(r)), crudp.AcceptLocale(r.Header.Get("Accept-Language")))
+	ctx, err = s.cp.VerifyRequest(ctx, r, msg)
+	if err != nil {
+		finish(w, codeUnauthenticated, err.Error())
+		return
+	}
+	response, err := s.cp.ProcessBatch(ctx, msg, crudp.WithCodec(s.codec))
+	if err != nil {
+		finish(w, codeInternal, err.Error())
+		return
+	}
+
+	writeMessage(w, response)
+	finish(w, codeOK, "")
+}
+
+// subscribe streams broadcast events until the client cancels
+func (s *Server) subscribe(w http.ResponseWriter, r *http.Request) {
+	msg, code, err := readMessage(r.Body)
+	if err != nil {
+		finish(w, code, err.Error())
+		return
+	}
+	var req SubscribeRequest
+	if err := s.codec.Decode(msg, &req); err != nil {
+		finish(w, codeInvalidArgument, err.Error())
+		return
+	}
+
+	channels := req.Channels
+	if len(channels) == 0 {
+		channels = []string{"*"}
+	}
+	ctx := crudp.WithLocale(crudp.WithRemoteAddr(r.Context(), crudp.RemoteIP(r)), crudp.AcceptLocale(r.Header.Get("Accept-Language")))
+	if err := s.cp.AuthorizeSubscription(ctx, channels...); err != nil {
+		finish(w, codePermissionDenied, err.Error())
+		return
+	}
+
+	channels = s.cp.StreamChannels(ctx, channels)
+
+	// Slow subscribers drop events instead of blocking the publisher
+	events := make(chan crudp.Event, 64)
+	sub := s.cp.ListenAs(ctx, func(ev crudp.Event) {
+		select {
+		case events <- ev:
+		default:
+		}
+	}, channels...)
+	defer sub.Close()
+
+	w.WriteHeader(http.StatusOK)
+	flush(w)
+	defer s.cp.Presence().Join(ctx)()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-events:
+			encoded, err := s.codec.Encode(&ev)
+			if err != nil {
+				finish(w, codeInternal, err.Error())
+				return
+			}
+			writeMessage(w, encoded)
+			flush(w)
+		}
+	}
+}
+
+// readMessage reads one length-prefixed gRPC message
+func readMessage(body io.Reader) ([]byte, int, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(body, header[:]); err != nil {
+		return nil, codeInvalidArgument, err
+	}
+	if header[0] != 0 {
+		return nil, codeUnimplemented, errCompressed
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxMessageSize {
+		return nil, codeInvalidArgument, errTooLarge
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(body, msg); err != nil {
+		return nil, codeInvalidArgument, err
+	}
+	return msg, codeOK, nil
+}
+
+// writeMessage writes one uncompressed length-prefixed gRPC message
+func writeMessage(w http.ResponseWriter, msg []byte) {
+	var header [5]byte
+	binary.BigEndian.PutUint32(header[1:], uint32(len(msg)))
+	w.Write(header[:])
+	w.Write(msg)
+}
+
+// finish sets the gRPC status trailers
+func finish(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set("Grpc-Message", message)
+	}
+}
+
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+var (
+	errCompressed = Err("compressed messages are not supported")
+	errTooLarge   = Err("message exceeds 4MB")
+)
@@ -0,0 +1,191 @@
+//go:build !wasm
+
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cdvelop/crudp"
+	"github.com/cdvelop/crudp/protocodec"
+)
+
+type Ping struct {
+	Text string
+}
+
+type pingResponse struct{ p *Ping }
+
+func (r pingResponse) Response() (any, []string, error) { return r.p, []string{"pings"}, nil }
+
+// pingRemote is the client address seen by the last Create
+var pingRemote string
+
+func (p *Ping) Create(ctx context.Context, data ...any) any {
+	pingRemote = crudp.RemoteAddr(ctx)
+	return pingResponse{p: &Ping{Text: "pong:" + data[0].(*Ping).Text}}
+}
+
+func frame(msg []byte) []byte {
+	var header [5]byte
+	binary.BigEndian.PutUint32(header[1:], uint32(len(msg)))
+	return append(header[:], msg...)
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, *crudp.CrudP) {
+	cp := crudp.New(crudp.WithHandlers(&Ping{}))
+	srv := httptest.NewUnstartedServer(NewServer(cp))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv, cp
+}
+
+func call(t *testing.T, ctx context.Context, srv *httptest.Server, method string, msg []byte) *http.Response {
+	req, _ := http.NewRequestWithContext(ctx, "POST", srv.URL+method, bytes.NewReader(frame(msg)))
+	req.Header.Set("Content-Type", "application/grpc")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s: %v", method, err)
+	}
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("expected HTTP/2, got %s", resp.Proto)
+	}
+	return resp
+}
+
+func TestProcess(t *testing.T) {
+	srv, _ := newTestServer(t)
+	codec := protocodec.New()
+
+	data, _ := codec.Encode(&Ping{Text: "hi"})
+	batch, _ := codec.Encode(crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'c', ReqID: "g1", Data: [][]byte{data}}}})
+
+	resp := call(t, context.Background(), srv, ProcessMethod, batch)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Fatalf("expected status 0, got %q (%s)", got, resp.Trailer.Get("Grpc-Message"))
+	}
+	if len(body) < 5 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+		t.Fatalf("invalid gRPC frame: % x", body)
+	}
+
+	var out crudp.BatchResponse
+	if err := codec.Decode(body[5:], &out); err != nil || len(out.Results) != 1 {
+		t.Fatalf("decode response: %v %+v", err, out)
+	}
+	var pong Ping
+	codec.Decode(out.Results[0].Data[0], &pong)
+	if out.Results[0].ReqID != "g1" || pong.Text != "pong:hi" {
+		t.Errorf("unexpected result: %+v %+v", out.Results[0], pong)
+	}
+	if pingRemote != "127.0.0.1" { // Same key as BuildRouter, without the port
+		t.Errorf("unexpected remote address %q", pingRemote)
+	}
+}
+
+func TestProcessSigned(t *testing.T) {
+	secret := []byte("s3cret")
+	cfg := crudp.DefaultConfig()
+	cfg.SigningKeys = crudp.StaticKey(secret)
+	cfg.RequireSignature = true
+	srv := httptest.NewUnstartedServer(NewServer(crudp.New(cfg, crudp.WithHandlers(&Ping{}))))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	codec := protocodec.New()
+	data, _ := codec.Encode(&Ping{Text: "hi"})
+	batch, _ := codec.Encode(crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'c', ReqID: "s1", Data: [][]byte{data}}}})
+
+	send := func(sign bool) string {
+		req, _ := http.NewRequest("POST", srv.URL+ProcessMethod, bytes.NewReader(frame(batch)))
+		req.Header.Set("Content-Type", "application/grpc")
+		if sign {
+			ts := time.Now().Unix()
+			req.Header.Set(crudp.SignatureKeyHeader, "client")
+			req.Header.Set(crudp.SignatureTimeHeader, strconv.FormatInt(ts, 10))
+			req.Header.Set(crudp.SignatureHeader, crudp.Signature(secret, ts, batch))
+		}
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Process: %v", err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if status := resp.Trailer.Get("Grpc-Status"); status != "" {
+			return status
+		}
+		return resp.Header.Get("Grpc-Status")
+	}
+
+	if status := send(false); status != "16" {
+		t.Errorf("expected UNAUTHENTICATED for an unsigned batch, got %q", status)
+	}
+	if status := send(true); status != "0" {
+		t.Errorf("expected OK for a signed batch, got %q", status)
+	}
+}
+
+func TestUnknownMethod(t *testing.T) {
+	srv, _ := newTestServer(t)
+	resp := call(t, context.Background(), srv, "/crudp.CrudService/Nope", nil)
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	status := resp.Trailer.Get("Grpc-Status")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+	}
+	if status != "12" {
+		t.Errorf("expected UNIMPLEMENTED, got %q", status)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	srv, cp := newTestServer(t)
+	codec := protocodec.New()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, _ := codec.Encode(&SubscribeRequest{Channels: []string{"pings"}})
+	resp := call(t, ctx, srv, SubscribeMethod, req)
+	defer resp.Body.Close()
+
+	// Trigger a broadcast through the regular dispatch
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		data, _ := codec.Encode(&Ping{Text: "sub"})
+		batch, _ := codec.Encode(crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'c', Data: [][]byte{data}}}})
+		cp.ProcessBatch(context.Background(), batch, crudp.WithCodec(codec))
+	}()
+
+	var header [5]byte
+	if _, err := io.ReadFull(resp.Body, header[:]); err != nil {
+		t.Fatalf("read event header: %v", err)
+	}
+	msg := make([]byte, binary.BigEndian.Uint32(header[1:]))
+	if _, err := io.ReadFull(resp.Body, msg); err != nil {
+		t.Fatalf("read event: %v", err)
+	}
+
+	var ev crudp.Event
+	if err := codec.Decode(msg, &ev); err != nil || ev.Channel != "pings" {
+		t.Fatalf("unexpected event: %+v (%v)", ev, err)
+	}
+	var ping Ping
+	cp.Codec().Decode(ev.Data, &ping) // Broadcast data uses the instance codec
+	if ping.Text != "pong:sub" {
+		t.Errorf("unexpected event data: %+v", ping)
+	}
+}
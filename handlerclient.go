@@ -0,0 +1,55 @@
+package crudp
+
+import (
+	"context"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// HandlerClient sends packets to one handler through the broker and waits for
+// their results. It backs the typed clients written by crudpgen -client.
+type HandlerClient struct {
+	cp   *CrudP
+	name string
+}
+
+// ResultError is returned by Call and HandlerClient for a result with MessageType Error
+// OnError hooks also receive it for failed results CRUDP answers itself.
+type ResultError struct {
+	Handler string
+	Code    string // PacketResult.Code, "" if none
+	Message string
+}
+
+func (e *ResultError) Error() string {
+	if e.Code != "" {
+		return Fmt("%s: %s (%s)", e.Handler, e.Message, e.Code)
+	}
+	return Fmt("%s: %s", e.Handler, e.Message)
+}
+
+// Client returns a HandlerClient for the handler registered as name
+func (cp *CrudP) Client(name string) HandlerClient {
+	return HandlerClient{cp: cp, name: name}
+}
+
+// Name returns the handler name the client sends to
+func (c HandlerClient) Name() string {
+	return c.name
+}
+
+// Do enqueues data (nil = no items) for action and blocks until the result
+// arrives through ReceiveBatch or ctx ends, see Call. Error results are
+// *ResultError. Do must not run on the goroutine that calls ReceiveBatch.
+func (c HandlerClient) Do(ctx context.Context, action byte, data any, opts ...CallOption) (PacketResult, error) {
+	handlerID, ok := c.cp.HandlerID(c.name)
+	if !ok {
+		return PacketResult{}, Err(Fmt("handler %s not registered", c.name))
+	}
+	return c.cp.Call(ctx, handlerID, action, data, opts...).Wait(ctx)
+}
+
+// DecodeData decodes the result item at index into target
+func (c HandlerClient) DecodeData(pr *PacketResult, index int, target any) error {
+	return c.cp.DecodeData(&pr.Packet, index, target)
+}
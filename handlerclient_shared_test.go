@@ -0,0 +1,92 @@
+package crudp_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cdvelop/crudp"
+)
+
+func HandlerClientShared(t *testing.T) {
+	newClient := func(serverCfg *crudp.Config) *crudp.CrudP {
+		server := crudp.New(serverCfg)
+		server.RegisterHandler(&Note{})
+
+		cfg := crudp.DefaultConfig()
+		cfg.BatchWindow = 5
+		return crudp.NewLoopback(server, cfg, crudp.WithHandlers(&Note{}))
+	}
+
+	t.Run("Do Returns The Matching Result", func(t *testing.T) {
+		notes := newClient(nil).Client("note")
+
+		pr, err := notes.Do(context.Background(), 'c', &Note{Text: "hi"})
+		if err != nil {
+			t.Fatalf("Do: %v", err)
+		}
+		var got Note
+		if err := notes.DecodeData(&pr, 0, &got); err != nil || got.ID != 1 || got.Text != "hi" {
+			t.Errorf("got %+v, %v", got, err)
+		}
+	})
+
+	t.Run("Concurrent Calls Are Not Consolidated", func(t *testing.T) {
+		notes := newClient(nil).Client("note")
+
+		texts := []string{"a", "b", "c"}
+		got := make([]string, len(texts))
+		var wg sync.WaitGroup
+		for i, text := range texts {
+			wg.Add(1)
+			go func(i int, text string) {
+				defer wg.Done()
+				pr, err := notes.Do(context.Background(), 'u', &Note{ID: i, Text: text})
+				if err != nil || len(pr.Data) != 1 {
+					t.Errorf("call %d: %v, %d items", i, err, len(pr.Data))
+					return
+				}
+				var n Note
+				notes.DecodeData(&pr, 0, &n)
+				got[i] = n.Text
+			}(i, text)
+		}
+		wg.Wait()
+		for i := range texts {
+			if got[i] != texts[i] {
+				t.Errorf("call %d got %q, want %q", i, got[i], texts[i])
+			}
+		}
+	})
+
+	t.Run("Error Result", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.ReadOnly = true
+		notes := newClient(cfg).Client("note")
+
+		_, err := notes.Do(context.Background(), 'c', &Note{Text: "x"})
+		var re *crudp.ResultError
+		if !errors.As(err, &re) || re.Handler != "note" || re.Message == "" {
+			t.Fatalf("expected ResultError, got %v", err)
+		}
+	})
+
+	t.Run("Context Ends The Wait", func(t *testing.T) {
+		cp := newClient(nil)
+		cp.Broker().Pause()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if _, err := cp.Client("note").Do(ctx, 'c', &Note{}); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected deadline exceeded, got %v", err)
+		}
+	})
+
+	t.Run("Unknown Handler", func(t *testing.T) {
+		if _, err := newClient(nil).Client("missing").Do(context.Background(), 'r', nil); err == nil {
+			t.Error("expected error for an unregistered handler")
+		}
+	})
+}
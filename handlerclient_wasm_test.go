@@ -0,0 +1,9 @@
+//go:build wasm
+
+package crudp_test
+
+import "testing"
+
+func TestHandlerClient_WASM(t *testing.T) {
+	HandlerClientShared(t)
+}
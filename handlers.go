@@ -3,6 +3,7 @@ package crudp
 import (
 	"context"
 	"reflect"
+	"time"
 
 	. "github.com/cdvelop/tinystring"
 )
@@ -27,10 +28,43 @@ func getHandlerName(handler any) string {
 	return Convert(t.Name()).SnakeLow().String()
 }
 
+// envHandler is a handler registered with ByEnv or ServerOnly
+type envHandler struct {
+	name  string
+	build func() any // Builder of the current build, nil = none
+}
+
+// envEntry returns the name and handler of a registered value, building
+// ByEnv handlers; a nil handler leaves its ID free in this build
+func envEntry(h any) (string, any, error) {
+	env, ok := h.(envHandler)
+	if !ok {
+		return getHandlerName(h), h, nil
+	}
+	if env.build == nil {
+		return env.name, nil, nil
+	}
+	built := env.build()
+	if built == nil {
+		return "", nil, Err(Fmt("handler %s: builder returned nil", env.name))
+	}
+	if proxy, ok := built.(*ProxyHandler); ok && proxy.name == "" {
+		proxy.name = env.name
+	}
+	if name := getHandlerName(built); name != env.name {
+		return "", nil, Err(Fmt("handler %s: built handler is named %s", env.name, name))
+	}
+	return env.name, built, nil
+}
+
 // RegisterHandler prepares the shared handler table between client and server
-// Receives the real implementations that act as prototypes and handlers.
+// Receives the real implementations that act as prototypes and handlers, or
+// ByEnv and ServerOnly entries built for the current environment.
 func (cp *CrudP) RegisterHandler(handlers ...any) error {
-	cp.handlers = make([]actionHandler, len(handlers))
+	if cp.config != nil && len(cp.config.HandlerIDs) > 0 {
+		return cp.registerStable(handlers)
+	}
+	table := make([]actionHandler, len(handlers))
 
 	for i, h := range handlers {
 		if h == nil {
@@ -38,54 +72,171 @@ func (cp *CrudP) RegisterHandler(handlers ...any) error {
 		}
 
 		// Get name (via interface or reflection)
-		name := getHandlerName(h)
+		name, h, err := envEntry(h)
+		if err != nil {
+			return err
+		}
+		if h == nil {
+			table[i] = actionHandler{index: uint8(i)} // Server only: the ID stays free
+			cp.log.Info("skipped handler in this build", "handler", name, "index", i)
+			continue
+		}
+		for j := 0; j < i; j++ {
+			if table[j].name == name {
+				return duplicateNameError(name, table[j].handler, h)
+			}
+		}
 
-		cp.handlers[i] = actionHandler{
+		table[i] = actionHandler{
 			name:    name,
 			index:   uint8(i),
 			handler: h,
 		}
 
-		cp.bind(uint8(i), h)
+		cp.bindTo(&table[i], h)
 
-		cp.log("registered handler:", name, "at index", i)
+		cp.log.Info("registered handler", "handler", name, "index", i)
 	}
 
+	cp.setTable(table)
 	return nil
 }
 
+// duplicateNameError reports two handlers resolving to the same name
+// Without it the later one would shadow the earlier one at dispatch.
+func duplicateNameError(name string, first, second any) error {
+	return Err(Fmt("handler name %s is used by both %s and %s: implement NamedHandler (HandlerName() string) on one of them to give it a distinct name",
+		name, reflect.TypeOf(first).String(), reflect.TypeOf(second).String()))
+}
+
+// registerStable registers handlers at the IDs of their names in Config.HandlerIDs
+// Names missing from it get the IDs after it, in registration order.
+func (cp *CrudP) registerStable(handlers []any) error {
+	manifest := make([]HandlerSpec, 0, len(handlers))
+	next := len(cp.config.HandlerIDs)
+	for i, h := range handlers {
+		if h == nil {
+			return Err(Fmt("handler %d is nil", i))
+		}
+		name, h, err := envEntry(h)
+		if err != nil {
+			return err
+		}
+		id := cp.stableID(name)
+		if id < 0 {
+			id = next
+			next++
+			cp.log.Warn("handler missing from Config.HandlerIDs", "handler", name, "index", id)
+		}
+		if id >= maxHandlers {
+			return Err(Fmt("handler table full: cannot add %s", name))
+		}
+		if h == nil {
+			continue // Server only: the ID stays free
+		}
+		manifest = append(manifest, HandlerSpec{ID: uint8(id), Name: name, Handler: h})
+	}
+	return cp.RegisterFromManifest(manifest)
+}
+
+// stableID returns the ID of name in Config.HandlerIDs, -1 if absent
+func (cp *CrudP) stableID(name string) int {
+	if cp.config == nil {
+		return -1
+	}
+	for id, n := range cp.config.HandlerIDs {
+		if n == name {
+			return id
+		}
+	}
+	return -1
+}
+
+// HandlerIDs returns the registered handler names by ID ("" for unused IDs)
+// Persist it and load it into Config.HandlerIDs to keep IDs stable when the
+// registration order changes.
+func (cp *CrudP) HandlerIDs() []string {
+	handlers := cp.table()
+	ids := make([]string, len(handlers))
+	for i := range handlers {
+		if handlers[i].handler != nil {
+			ids[i] = handlers[i].name
+		}
+	}
+	return ids
+}
+
+// LoadHandlers registers handlers
+//
+// Deprecated: use RegisterHandler or New(WithHandlers(...))
+func (cp *CrudP) LoadHandlers(handlers ...any) error {
+	return cp.RegisterHandler(handlers...)
+}
+
 // GetHandlerName returns the handler name by its ID
 func (cp *CrudP) GetHandlerName(handlerID uint8) string {
-	if int(handlerID) >= len(cp.handlers) {
+	handlers := cp.table()
+	if int(handlerID) >= len(handlers) {
 		return ""
 	}
-	return cp.handlers[handlerID].name
+	return handlers[handlerID].name
 }
 
-// bind copies the CRUD functions without dynamic allocations
-func (cp *CrudP) bind(index uint8, handler any) {
+// HandlerID returns the ID of the handler called name, false if not registered
+func (cp *CrudP) HandlerID(name string) (uint8, bool) {
+	for i, h := range cp.table() {
+		if h.handler != nil && h.name == name {
+			return uint8(i), true
+		}
+	}
+	return 0, false
+}
+
+// bindTo copies the CRUD functions of handler into ah and hashes its layout
+// A ProxyHandler is bound to cp to send its calls.
+func (cp *CrudP) bindTo(ah *actionHandler, handler any) {
+	ah.schema = layoutHash(handlerType(handler))
+	if proxy, ok := handler.(*ProxyHandler); ok {
+		proxy.cp = cp
+	}
+
 	if creator, ok := handler.(Creator); ok {
-		cp.handlers[index].Create = creator.Create
+		ah.Create = creator.Create
 	}
 	if reader, ok := handler.(Reader); ok {
-		cp.handlers[index].Read = reader.Read
+		ah.Read = reader.Read
+	}
+	if paginator, ok := handler.(Paginator); ok {
+		ah.ReadPage = paginator.ReadPage
 	}
 	if updater, ok := handler.(Updater); ok {
-		cp.handlers[index].Update = updater.Update
+		ah.Update = updater.Update
 	}
 	if deleter, ok := handler.(Deleter); ok {
-		cp.handlers[index].Delete = deleter.Delete
+		ah.Delete = deleter.Delete
+	}
+	if patcher, ok := handler.(Patcher); ok {
+		ah.Patch = patcher.Patch
+	}
+	if snapshotter, ok := handler.(Snapshotter); ok {
+		ah.Snapshot = snapshotter.Snapshot
+	}
+	if compensator, ok := handler.(Compensator); ok {
+		ah.Compensate = compensator.Compensate
 	}
 }
 
 // CallHandler searches and calls the handler directly by shared index
 func (cp *CrudP) CallHandler(ctx context.Context, handlerID uint8, action byte, data ...any) (any, error) {
-	if int(handlerID) >= len(cp.handlers) {
-		return nil, Errf("no handler found for id: %d", handlerID)
+	handler, err := cp.resolve(handlerID, 0)
+	if err != nil {
+		return nil, err
 	}
+	return cp.callAction(ctx, handler, action, data...)
+}
 
-	handler := cp.handlers[handlerID]
-
+// callAction validates and invokes the CRUD function of a resolved handler
+func (cp *CrudP) callAction(ctx context.Context, handler *actionHandler, action byte, data ...any) (any, error) {
 	// Optional validation before executing
 	if validator, ok := handler.handler.(Validator); ok {
 		if err := validator.Validate(action, data...); err != nil {
@@ -100,12 +251,80 @@ func (cp *CrudP) CallHandler(ctx context.Context, handlerID uint8, action byte,
 	default:
 	}
 
+	if cp.config.HandlerTimeout > 0 {
+		return cp.invokeWithTimeout(ctx, handler, action, data...)
+	}
+	return invokeAction(ctx, handler, action, data...)
+}
+
+// invokeWithTimeout runs the handler under Config.HandlerTimeout
+// Handlers should watch ctx.Done(); one that doesn't is abandoned when the
+// deadline passes and its result discarded.
+func (cp *CrudP) invokeWithTimeout(ctx context.Context, handler *actionHandler, action byte, data ...any) (any, error) {
+	timeout := time.Duration(cp.config.HandlerTimeout) * time.Millisecond
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type outcome struct {
+		result any
+		err    error
+		panic  any
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		var o outcome
+		defer func() {
+			o.panic = recover()
+			done <- o
+		}()
+		o.result, o.err = invokeAction(ctx, handler, action, data...)
+	}()
+
+	select {
+	case o := <-done:
+		if o.panic != nil {
+			panic(o.panic) // Raised where the handler used to run
+		}
+		if o.err == nil && ctx.Err() == context.DeadlineExceeded {
+			return nil, &HandlerTimeoutError{Handler: handler.name, Timeout: timeout}
+		}
+		return o.result, o.err
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			cp.log.Warn("handler timed out", "handler", handler.name, "action", string(action), "ms", timeout.Milliseconds())
+			return nil, &HandlerTimeoutError{Handler: handler.name, Timeout: timeout}
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// HandlerTimeoutError is returned when a handler exceeds Config.HandlerTimeout
+// Results carry Code CodeTimeout.
+type HandlerTimeoutError struct {
+	Handler string
+	Timeout time.Duration
+}
+
+func (e *HandlerTimeoutError) Error() string {
+	return Fmt("handler %s timed out after %dms", e.Handler, e.Timeout.Milliseconds())
+}
+
+// Unwrap lets errors.Is match context.DeadlineExceeded
+func (e *HandlerTimeoutError) Unwrap() error { return context.DeadlineExceeded }
+
+// invokeAction calls the CRUD function of handler for action
+func invokeAction(ctx context.Context, handler *actionHandler, action byte, data ...any) (any, error) {
 	switch action {
 	case 'c':
 		if handler.Create != nil {
 			return handler.Create(ctx, data...), nil
 		}
 	case 'r':
+		if handler.ReadPage != nil {
+			page, _ := PageFrom(ctx)
+			items, info := handler.ReadPage(ctx, page, data...)
+			return PageResult{Items: items, Info: info}, nil
+		}
 		if handler.Read != nil {
 			return handler.Read(ctx, data...), nil
 		}
@@ -117,26 +336,34 @@ func (cp *CrudP) CallHandler(ctx context.Context, handlerID uint8, action byte,
 		if handler.Delete != nil {
 			return handler.Delete(ctx, data...), nil
 		}
+	case ActionPatch:
+		if handler.Patch != nil {
+			mask, _ := FieldMaskFrom(ctx)
+			return handler.Patch(ctx, mask, data...), nil
+		}
+		if handler.Update != nil {
+			return handler.Update(ctx, data...), nil
+		}
 	}
 
-	return nil, Errf("action '%c' not implemented for handler: %s", action, handler.name)
+	return nil, LocErr(msgNotImplemented, action, handler.name)
 }
 
 // decodeWithKnownType decodes packet data using cached type information when available
 // This is the key method that enables handlers to receive concrete types instead of raw bytes
-func (cp *CrudP) decodeWithKnownType(packet *Packet, handlerID uint8) ([]any, error) {
+func (cp *CrudP) decodeWithKnownType(codec Codec, packet *Packet, resolved *actionHandler) ([]any, error) {
 
-	// Validate handlerID
-	if int(handlerID) >= len(cp.handlers) {
-		return nil, Errf("no handler found for id: %d", handlerID)
-	}
-
-	handler := cp.handlers[handlerID].handler
+	handler := resolved.handler
 	if handler == nil {
-		cp.log("decodeWithKnownType: handler is nil, fallback to raw bytes")
+		cp.log.Debug("handler is nil, fallback to raw bytes", "index", resolved.index)
 		return cp.decodeWithRawBytes(packet)
 	}
 
+	// Handlers backed by another type decode into a new value of it
+	if ep, ok := handler.(EntityProvider); ok && ep.Entity() != nil {
+		handler = reflect.New(handlerType(handler)).Interface()
+	}
+
 	// Get the handler type to determine what concrete type to decode to
 	handlerValue := reflect.ValueOf(handler)
 	handlerType := handlerValue.Type()
@@ -160,13 +387,15 @@ func (cp *CrudP) decodeWithKnownType(packet *Packet, handlerID uint8) ([]any, er
 
 	for _, itemBytes := range packet.Data {
 
-		// NOTE: Using handler directly - this reuses the same instance
-		// This is a known limitation. For production use, implement
-		// a proper instance factory based on your specific types.
+		// Each item gets its own instance so bulk packets keep every item
+		// (see BulkResult). Value handlers still decode into the handler.
 		targetPtr := handler
+		if handlerType.Kind() == reflect.Ptr {
+			targetPtr = reflect.New(concreteType).Interface()
+		}
 
 		// Decode bytes into the concrete type using codec
-		if err := cp.codec.Decode(itemBytes, targetPtr); err != nil {
+		if err := codec.Decode(itemBytes, targetPtr); err != nil {
 			return nil, err
 		}
 
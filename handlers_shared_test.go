@@ -2,6 +2,7 @@ package crudp_test
 
 import (
 	"context"
+	"strings"
 	"testing"
 
 	"github.com/cdvelop/crudp"
@@ -243,3 +244,237 @@ func CRUDOperationsShared(t *testing.T, cp *crudp.CrudP) {
 		}
 	})
 }
+
+func ManifestRegistrationShared(t *testing.T) {
+	t.Run("Pinned IDs With Gap", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		err := cp.RegisterFromManifest([]crudp.HandlerSpec{
+			{ID: 2, Name: "user_controller", Handler: &UserController{}},
+			{ID: 0, Name: "my_custom_name", Handler: &explicitNameHandler{}},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if cp.GetHandlerName(0) != "my_custom_name" {
+			t.Error("handler 0 name mismatch")
+		}
+		if cp.GetHandlerName(1) != "" {
+			t.Error("gap should stay empty")
+		}
+		if cp.GetHandlerName(2) != "user_controller" {
+			t.Error("handler 2 name mismatch")
+		}
+
+		if _, err := cp.CallHandler(context.Background(), 2, 'r'); err != nil {
+			t.Errorf("unexpected call error: %v", err)
+		}
+		if len(cp.Manifest()) != 2 {
+			t.Errorf("expected 2 manifest entries, got %d", len(cp.Manifest()))
+		}
+	})
+
+	t.Run("Name Mismatch", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		err := cp.RegisterFromManifest([]crudp.HandlerSpec{
+			{ID: 0, Name: "user", Handler: &UserController{}},
+		})
+		if err == nil {
+			t.Error("expected error for name mismatch")
+		}
+	})
+
+	t.Run("Duplicate ID", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		err := cp.RegisterFromManifest([]crudp.HandlerSpec{
+			{ID: 0, Name: "user_controller", Handler: &UserController{}},
+			{ID: 0, Name: "validated_handler", Handler: &ValidatedHandler{}},
+		})
+		if err == nil {
+			t.Error("expected error for duplicate id")
+		}
+	})
+
+	t.Run("ManifestSource", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		cp.RegisterHandler(&UserController{})
+
+		src := cp.ManifestSource("shared")
+		if !strings.Contains(src, `{ID: 0, Name: "user_controller", Handler: &crudp_test.UserController{}}`) {
+			t.Errorf("unexpected manifest source:\n%s", src)
+		}
+		if !strings.Contains(src, "\t\"github.com/cdvelop/crudp_test\"\n") {
+			t.Errorf("expected the handler import path in:\n%s", src)
+		}
+	})
+}
+
+// Previous version of UserController kept for old clients
+type userControllerV1 struct{}
+
+func (h *userControllerV1) HandlerName() string { return "user_controller" }
+func (h *userControllerV1) Create(ctx context.Context, data ...any) any {
+	return CreateResponse{ID: 1, Status: "created_v1"}
+}
+
+func HandlerVersioningShared(t *testing.T) {
+	cp := crudp.NewDefault()
+	if err := cp.RegisterHandler(&UserController{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cp.RegisterVersion(1, &userControllerV1{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	process := func(version byte) crudp.PacketResult {
+		batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{
+			{Action: 'c', HandlerID: 0, Version: version, ReqID: "v"},
+		}})
+		resp, err := cp.ProcessBatch(context.Background(), batch)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var batchResp crudp.BatchResponse
+		if err := cp.Codec().Decode(resp, &batchResp); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		return batchResp.Results[0]
+	}
+
+	t.Run("Current Version", func(t *testing.T) {
+		var created CreateResponse
+		cp.Codec().Decode(process(0).Data[0], &created)
+		if created.Status != "created" {
+			t.Errorf("expected current handler, got status '%s'", created.Status)
+		}
+	})
+
+	t.Run("Old Version", func(t *testing.T) {
+		result := process(1)
+		if result.Version != 1 {
+			t.Errorf("expected version echoed, got %d", result.Version)
+		}
+		var created CreateResponse
+		cp.Codec().Decode(result.Data[0], &created)
+		if created.Status != "created_v1" {
+			t.Errorf("expected v1 handler, got status '%s'", created.Status)
+		}
+	})
+
+	t.Run("Unknown Version", func(t *testing.T) {
+		if process(7).MessageType != uint8(Msg.Error) {
+			t.Error("expected error for unknown version")
+		}
+	})
+
+	t.Run("Duplicate And Unknown Name", func(t *testing.T) {
+		if err := cp.RegisterVersion(1, &userControllerV1{}); err == nil {
+			t.Error("expected error for duplicate version")
+		}
+		if err := cp.RegisterVersion(1, &ValidatedHandler{}); err == nil {
+			t.Error("expected error for unregistered name")
+		}
+	})
+}
+
+func StableIDsShared(t *testing.T) {
+	newCP := func(handlers ...any) *crudp.CrudP {
+		cfg := crudp.DefaultConfig()
+		cfg.HandlerIDs = []string{"note", "", "user"}
+		return crudp.New(cfg, crudp.WithHandlers(handlers...))
+	}
+
+	t.Run("Order Does Not Matter", func(t *testing.T) {
+		a := newCP(&User{}, &Note{})
+		b := newCP(&Note{}, &User{})
+		if err := a.Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, cp := range []*crudp.CrudP{a, b} {
+			if id, _ := cp.HandlerID("note"); id != 0 {
+				t.Errorf("note id = %d, want 0", id)
+			}
+			if id, _ := cp.HandlerID("user"); id != 2 {
+				t.Errorf("user id = %d, want 2", id)
+			}
+		}
+		if err := a.VerifySchema(b.SchemaTable()); err != nil {
+			t.Errorf("unexpected drift: %v", err)
+		}
+		if got := a.HandlerIDs(); len(got) != 3 || got[0] != "note" || got[1] != "" || got[2] != "user" {
+			t.Errorf("HandlerIDs() = %q", got)
+		}
+		if err := a.SelfCheck(); err != nil {
+			t.Errorf("SelfCheck: %v", err)
+		}
+	})
+
+	t.Run("Unpinned Names Follow The Table", func(t *testing.T) {
+		cp := newCP(&explicitNameHandler{}, &User{})
+		if id, ok := cp.HandlerID("my_custom_name"); !ok || id != 3 {
+			t.Errorf("my_custom_name id = %d, %v, want 3", id, ok)
+		}
+
+		id, err := cp.AddHandler(&Note{})
+		if err != nil || id != 0 {
+			t.Errorf("AddHandler(note) = %d, %v, want pinned id 0", id, err)
+		}
+		if _, err := cp.AddHandler(&Note{}); err == nil {
+			t.Error("expected error for a pinned id already in use")
+		}
+	})
+
+	t.Run("Handshake Reports Moved IDs", func(t *testing.T) {
+		server := newCP(&User{}, &Note{})
+		client := crudp.New(crudp.WithHandlers(&User{}, &Note{})) // Positional
+
+		err := server.VerifySchema(client.SchemaTable())
+		if err == nil || !strings.Contains(err.Error(), "user is id 2") {
+			t.Errorf("expected moved id error, got %v", err)
+		}
+	})
+}
+
+// Another module whose type also snake-cases to "user"
+type otherUser struct{ User }
+
+func (u *otherUser) HandlerName() string { return "user" }
+
+func DuplicateNamesShared(t *testing.T) {
+	check := func(t *testing.T, err error) {
+		t.Helper()
+		if err == nil {
+			t.Fatal("expected duplicate name error")
+		}
+		for _, want := range []string{"handler name user", "*crudp_test.User", "*crudp_test.otherUser", "NamedHandler"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("error %q missing %q", err, want)
+			}
+		}
+	}
+
+	t.Run("RegisterHandler", func(t *testing.T) {
+		check(t, crudp.NewDefault().RegisterHandler(&User{}, &Note{}, &otherUser{}))
+	})
+
+	t.Run("AddHandler", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&User{}))
+		_, err := cp.AddHandler(&otherUser{})
+		check(t, err)
+	})
+
+	t.Run("Manifest", func(t *testing.T) {
+		check(t, crudp.NewDefault().RegisterFromManifest([]crudp.HandlerSpec{
+			{ID: 0, Name: "user", Handler: &User{}},
+			{ID: 1, Name: "user", Handler: &otherUser{}},
+		}))
+	})
+
+	t.Run("Groups Keep Names Apart", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&User{}))
+		if err := cp.RegisterGroup("admin", &otherUser{}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
@@ -22,4 +22,20 @@ func TestHandlers_Stdlib(t *testing.T) {
 	t.Run("CRUD", func(t *testing.T) {
 		CRUDOperationsShared(t, cp)
 	})
+
+	t.Run("Manifest", func(t *testing.T) {
+		ManifestRegistrationShared(t)
+	})
+
+	t.Run("Versioning", func(t *testing.T) {
+		HandlerVersioningShared(t)
+	})
+
+	t.Run("StableIDs", func(t *testing.T) {
+		StableIDsShared(t)
+	})
+
+	t.Run("DuplicateNames", func(t *testing.T) {
+		DuplicateNamesShared(t)
+	})
 }
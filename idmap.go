@@ -0,0 +1,147 @@
+package crudp
+
+import (
+	"reflect"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// IDMapping pairs a temporary client-side ID with the ID generated by the server
+type IDMapping struct {
+	TempID string `json:"temp_id"`
+	RealID string `json:"real_id"`
+}
+
+// MapID builds an IDMapping from string or integer IDs
+func MapID(tempID, realID any) IDMapping {
+	return IDMapping{TempID: Convert(tempID).String(), RealID: Convert(realID).String()}
+}
+
+// IDResult is returned by handlers that replace temporary IDs sent by the
+// client. Data is encoded like any other result (e.g. the created rows).
+//
+//	func (h *User) Create(ctx context.Context, data ...any) any {
+//		u := data[0].(*User)
+//		temp := u.ID
+//		u.ID = h.db.Insert(u)
+//		return crudp.IDResult{Data: u, IDs: []crudp.IDMapping{crudp.MapID(temp, u.ID)}}
+//	}
+//
+// The client rewrites queued packets and cached entities still holding the
+// temporary IDs, see ReceiveBatch.
+type IDResult struct {
+	Data any
+	IDs  []IDMapping
+}
+
+// realID returns the ID mapped to id, "" if none
+func realID(ids []IDMapping, id string) string {
+	for _, m := range ids {
+		if m.TempID == id {
+			return m.RealID
+		}
+	}
+	return ""
+}
+
+// remapIDs returns a copy of the entity v (pointer to struct) with every
+// field named ID or ending in ID holding a temporary ID replaced, nil if none
+func remapIDs(v any, ids []IDMapping) any {
+	sv := structValue(v)
+	if !sv.IsValid() {
+		return nil
+	}
+
+	var out reflect.Value
+	t := sv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Name
+		if t.Field(i).PkgPath != "" || len(name) < 2 || name[len(name)-2:] != "ID" {
+			continue
+		}
+		id := realID(ids, fieldID(sv.Field(i)))
+		if id == "" {
+			continue
+		}
+		if !out.IsValid() {
+			out = reflect.New(t)
+			out.Elem().Set(sv)
+		}
+		if setID(out.Elem().Field(i), id) != nil {
+			return nil
+		}
+	}
+	if !out.IsValid() {
+		return nil
+	}
+	return out.Interface()
+}
+
+// fieldID formats a string or integer field, "" otherwise
+func fieldID(f reflect.Value) string {
+	switch f.Kind() {
+	case reflect.String:
+		return f.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Fmt("%d", f.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Fmt("%d", f.Uint())
+	}
+	return ""
+}
+
+// applyIDs rewrites queued packets and cached entities holding temporary IDs
+func (cp *CrudP) applyIDs(ids []IDMapping) {
+	cp.broker.rewrite(func(p *Packet) {
+		if p.Action == ActionSync || p.Action == ActionHandshake {
+			return
+		}
+		first := 0
+		if p.Action == ActionPatch {
+			first = 1 // Data[0] is the field mask
+		}
+		for i := first; i < len(p.Data); i++ {
+			value, _ := cp.decodeEntity(cp.codec, p.HandlerID, p.Version, p.Data[i])
+			if value == nil {
+				continue
+			}
+			remapped := remapIDs(value, ids)
+			if remapped == nil {
+				continue
+			}
+			encoded, err := cp.codec.Encode(remapped)
+			if err != nil {
+				cp.log.Error("rewriting temporary ID failed", "handler", p.HandlerID, "error", err)
+				continue
+			}
+			p.Data[i] = encoded
+			if i < len(p.keys) {
+				p.keys[i] = EntityKey(remapped)
+			}
+		}
+	})
+
+	if cp.config.EntityCache {
+		cp.cache.remap(ids)
+		cp.cache.notify()
+	}
+}
+
+// remap rewrites the ID fields of entries holding a temporary ID and re-keys them
+func (c *EntityCache) remap(ids []IDMapping) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.entries {
+		e := &c.entries[i]
+		if remapped := remapIDs(e.value, ids); remapped != nil {
+			e.value = remapped
+			if key := EntityKey(remapped); key != "" {
+				e.id = key
+			}
+			c.touch(e.handlerID)
+		} else if id := realID(ids, e.id); id != "" {
+			e.id = id
+			c.touch(e.handlerID)
+		}
+	}
+}
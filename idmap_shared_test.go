@@ -0,0 +1,99 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Ticket replaces the temporary ID sent by the client with 100
+type Ticket struct {
+	ID    int
+	Title string
+}
+
+func (h *Ticket) Create(ctx context.Context, data ...any) any {
+	t := *data[0].(*Ticket)
+	temp := t.ID
+	t.ID = 100
+	return crudp.IDResult{Data: t, IDs: []crudp.IDMapping{crudp.MapID(temp, t.ID)}}
+}
+
+// TicketComment records the TicketID received by the server
+type TicketComment struct {
+	ID       int
+	TicketID int
+	received *[]int
+}
+
+func (h *TicketComment) Create(ctx context.Context, data ...any) any {
+	c := *data[0].(*TicketComment)
+	if h.received != nil {
+		*h.received = append(*h.received, c.TicketID)
+	}
+	return c
+}
+
+func IDMappingShared(t *testing.T) {
+	for _, binary := range []bool{false, true} {
+		t.Run(Fmt("Result Reports IDs binary=%v", binary), func(t *testing.T) {
+			cfg := crudp.DefaultConfig()
+			cfg.UseBinary = binary
+			cp := crudp.New(cfg, crudp.WithHandlers(&Ticket{}))
+
+			data, _ := cp.Codec().Encode(&Ticket{ID: -1, Title: "bug"})
+			r := processOne(t, cp, crudp.Packet{Action: 'c', Data: [][]byte{data}})
+
+			if len(r.IDs) != 1 || r.IDs[0].TempID != "-1" || r.IDs[0].RealID != "100" {
+				t.Errorf("unexpected ID mapping: %+v", r.IDs)
+			}
+			var created Ticket
+			cp.Codec().Decode(r.Data[0], &created)
+			if created.ID != 100 {
+				t.Errorf("expected data encoded, got %+v", created)
+			}
+		})
+	}
+
+	t.Run("Client Rewrites Queue And Cache", func(t *testing.T) {
+		var received []int
+		server := crudp.New(crudp.WithHandlers(&Ticket{}, &TicketComment{received: &received}))
+
+		cfg := crudp.DefaultConfig()
+		cfg.EntityCache = true
+		client := crudp.NewLoopback(server, cfg, crudp.WithHandlers(&Ticket{}, &TicketComment{}))
+		codec := client.Codec()
+
+		// Cached optimistically under the temporary ID
+		temp, _ := codec.Encode(&Ticket{ID: -1, Title: "bug"})
+		optimistic, _ := codec.Encode(crudp.BatchResponse{Results: []crudp.PacketResult{{
+			Packet: crudp.Packet{Action: 'r', HandlerID: 0, Data: [][]byte{temp}},
+		}}})
+		client.ReceiveBatch(optimistic)
+
+		// Queued while the ticket create is in flight
+		client.EnqueuePacket(1, 'c', "comment", &TicketComment{TicketID: -1})
+
+		final, _ := codec.Encode(&Ticket{ID: 100, Title: "bug"})
+		created, _ := codec.Encode(crudp.BatchResponse{Results: []crudp.PacketResult{{
+			Packet:      crudp.Packet{Action: 'c', HandlerID: 0, Data: [][]byte{final}},
+			MessageType: uint8(Msg.Success),
+			IDs:         []crudp.IDMapping{crudp.MapID(-1, 100)},
+		}}})
+		client.ReceiveBatch(created)
+
+		if _, ok := client.Cache().Get(0, "-1"); ok {
+			t.Error("expected temporary cache entry to be re-keyed")
+		}
+		if v, ok := client.Cache().Get(0, "100"); !ok || v.(*Ticket).ID != 100 {
+			t.Errorf("expected ticket cached under 100, got %+v", v)
+		}
+
+		client.Broker().FlushNow()
+		if len(received) != 1 || received[0] != 100 {
+			t.Errorf("expected queued comment rewritten to ticket 100, got %v", received)
+		}
+	})
+}
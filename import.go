@@ -0,0 +1,35 @@
+package crudp
+
+import "net/url"
+
+// ImportReport is the answer of the import route
+type ImportReport struct {
+	Rows    int        `json:"rows"`    // Data rows read
+	Valid   int        `json:"valid"`   // Rows that decoded and passed Validate
+	Created int        `json:"created"` // Rows accepted by Create, 0 on a dry run
+	DryRun  bool       `json:"dry_run"`
+	Errors  []RowError `json:"errors"` // Rejected rows, in row order
+}
+
+// RowError reports why a row was not imported
+type RowError struct {
+	Row     int    `json:"row"` // 1-based, not counting the CSV header
+	Message string `json:"message"`
+}
+
+// ImportURL returns the address of the import route of handler for a body
+// in format (ExportCSV, ExportNDJSON); dryRun only validates the rows
+func (cp *CrudP) ImportURL(handler, format string, dryRun bool) string {
+	query := url.Values{}
+	if format != "" {
+		query.Set("format", format)
+	}
+	if dryRun {
+		query.Set("dry_run", "1")
+	}
+	u := cp.EndpointURL(cp.config.ImportEndpoint) + "/" + url.PathEscape(handler)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
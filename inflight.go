@@ -0,0 +1,195 @@
+package crudp
+
+import (
+	"time"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// maxInFlight bounds the unacknowledged batches kept for transports that
+// never call ReceiveBatch; the oldest is forgotten first
+const maxInFlight = 32
+
+// inflight is a flushed batch waiting for its response
+type inflight struct {
+	packets []Packet
+	tries   []uint8 // Per packet, aligned with packets
+}
+
+// sameBatch reports whether sent and other hold the same packets in order
+// ProcessBatch answers in batch order, so results match their request.
+// Extra results (dispatched follow-ups) may come after them.
+func sameBatch(sent []Packet, other func(i int) *Packet, n int) bool {
+	if n < len(sent) {
+		return false
+	}
+	for i := range sent {
+		p := other(i)
+		if p.HandlerID != sent[i].HandlerID || p.Action != sent[i].Action || p.Version != sent[i].Version || p.ReqID != sent[i].ReqID {
+			return false
+		}
+	}
+	return true
+}
+
+// retryable reports whether the server asked to send the packet again
+func retryable(r *PacketResult) bool {
+	return r.RetryAfter > 0 || r.Code == CodeTimeout || r.Code == CodeCanceled || r.Code == CodeMaintenance
+}
+
+// ack forgets the batch answered by results and re-queues its retryable packets
+// Responses that match no in-flight batch are ignored; see undecoded for
+// CodeDecode responses.
+// A partial response (see Config.MaxResponseBytes) answers the first packets;
+// the batch stays in flight with the rest. Responses to an ActionContinue
+// packet start with its echo, which acknowledges that packet first.
+func (b *broker) ack(results []PacketResult, partial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(results) > 0 && results[0].Action == ActionContinue {
+		for i, f := range b.inflight {
+			if len(f.packets) == 1 && f.packets[0].Action == ActionContinue && f.packets[0].ReqID == results[0].ReqID {
+				b.inflight = append(b.inflight[:i:i], b.inflight[i+1:]...)
+				break
+			}
+		}
+		results = results[1:]
+	}
+	if len(results) == 0 {
+		return
+	}
+
+	for i, f := range b.inflight {
+		answered := f.packets
+		if partial && len(results) < len(answered) {
+			answered = answered[:len(results)]
+		}
+		if !sameBatch(answered, func(j int) *Packet { return &results[j].Packet }, len(results)) {
+			continue
+		}
+		if len(answered) < len(f.packets) {
+			b.inflight[i] = inflight{packets: f.packets[len(answered):], tries: f.tries[len(answered):]}
+		} else {
+			b.inflight = append(b.inflight[:i:i], b.inflight[i+1:]...)
+		}
+
+		var retry []Packet
+		var tries []uint8
+		wait := 0
+		for j := range answered {
+			if !retryable(&results[j]) || b.wasCanceled(f.packets[j].ReqID) {
+				continue
+			}
+			retry = append(retry, f.packets[j])
+			tries = append(tries, f.tries[j])
+			if results[j].RetryAfter > wait {
+				wait = results[j].RetryAfter
+			}
+		}
+		b.requeueLocked(retry, tries, wait)
+		return
+	}
+}
+
+// undecoded answers a CodeDecode response: the oldest in-flight batch, the
+// first answered by transports that answer in order, is forgotten and r is
+// returned once per packet with its ReqID. Decode errors are not retried.
+// r alone is returned when nothing is in flight.
+func (b *broker) undecoded(r PacketResult) []PacketResult {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.inflight) == 0 {
+		return []PacketResult{r}
+	}
+	f := b.inflight[0]
+	b.inflight = b.inflight[1:]
+
+	results := make([]PacketResult, len(f.packets))
+	for i := range f.packets {
+		results[i] = r
+		results[i].Packet = f.packets[i].echo()
+		b.stats.Dropped += uint64(len(f.packets[i].Data))
+	}
+	return results
+}
+
+// queued reports whether a packet with reqID waits in the queue
+func (b *broker) queued(reqID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := range b.queue {
+		if b.queue[i].ReqID == reqID {
+			return true
+		}
+	}
+	return false
+}
+
+// Nack re-queues an in-flight batch the transport failed to deliver
+// batch is the encoded request passed to the SetOnFlush callback.
+func (b *broker) Nack(batch []byte) error {
+	var req BatchRequest
+	if err := b.codec.Decode(batch, &req); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, f := range b.inflight {
+		if len(f.packets) == len(req.Packets) && sameBatch(f.packets, func(j int) *Packet { return &req.Packets[j] }, len(req.Packets)) {
+			b.inflight = append(b.inflight[:i:i], b.inflight[i+1:]...)
+			b.requeueLocked(f.packets, f.tries, 0)
+			return nil
+		}
+	}
+	return Errf("batch not in flight")
+}
+
+// requeueLocked puts packets back at the front of the queue (must be called with lock)
+// Packets sent more than MaxRetries times are dropped. The flush is delayed by
+// RetryInterval, doubled per attempt, or by wait ms if the server asked for more.
+func (b *broker) requeueLocked(packets []Packet, tries []uint8, wait int) {
+	var keep []Packet
+	var kept []uint8
+	attempt := 0
+	for i := range packets {
+		t := tries[i] + 1
+		if int(t) > b.maxRetries {
+			b.stats.Dropped += uint64(len(packets[i].Data))
+			continue
+		}
+		keep = append(keep, packets[i])
+		kept = append(kept, t)
+		b.stats.Requeued += uint64(len(packets[i].Data))
+		if int(t) > attempt {
+			attempt = int(t)
+		}
+	}
+	if len(keep) == 0 {
+		return
+	}
+	b.queue = append(keep, b.queue...)
+	b.tries = append(kept, b.tries...)
+
+	delay := b.retryInterval << (attempt - 1)
+	if wait > delay {
+		delay = wait
+	}
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	b.timer = b.tp.AfterFunc(delay, b.flush)
+}
+
+// sentLocked moves the queue to the in-flight list (must be called with lock)
+func (b *broker) sentLocked(now time.Time) {
+	b.inflight = append(b.inflight, inflight{packets: b.queue, tries: b.tries})
+	if len(b.inflight) > maxInFlight {
+		b.inflight = b.inflight[1:]
+	}
+	// In-flight packets keep the old arrays
+	b.queue = make([]Packet, 0, cap(b.queue))
+	b.tries = make([]uint8, 0, cap(b.tries))
+	b.sentAt = now
+}
@@ -0,0 +1,152 @@
+package crudp_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Recovering fails while down is set; retries run on timer goroutines
+type Recovering struct{}
+
+var recoveringDown atomic.Bool
+var recoveringCalls atomic.Int32
+
+func (h *Recovering) Read(ctx context.Context, data ...any) any {
+	recoveringCalls.Add(1)
+	if recoveringDown.Load() {
+		return flakyResult{err: Errf("database down")}
+	}
+	return "ok"
+}
+
+func InFlightShared(t *testing.T) {
+	t.Run("Nack Requeues Until MaxRetries", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.FlushStrategy = crudp.ManualFlush()
+		cfg.MaxRetries = 1
+		cfg.RetryInterval = 10
+		cp := crudp.New(cfg)
+		broker := cp.Broker()
+
+		var mu sync.Mutex
+		var sent [][]byte
+		broker.SetOnFlush(func(batch []byte) {
+			mu.Lock()
+			sent = append(sent, batch)
+			mu.Unlock()
+		})
+		last := func() []byte {
+			mu.Lock()
+			defer mu.Unlock()
+			return sent[len(sent)-1]
+		}
+
+		broker.Enqueue(0, 'c', "req1", []byte(`{}`))
+		broker.FlushNow()
+		if s := broker.Stats(); s.InFlight != 1 || s.Queued != 0 {
+			t.Fatalf("expected 1 batch in flight, got %+v", s)
+		}
+
+		if err := broker.Nack(last()); err != nil {
+			t.Fatal(err)
+		}
+		if s := broker.Stats(); s.InFlight != 0 || s.Queued != 1 || s.Requeued != 1 || !s.Scheduled {
+			t.Fatalf("expected the batch back in the queue, got %+v", s)
+		}
+		time.Sleep(40 * time.Millisecond)
+		mu.Lock()
+		n := len(sent)
+		mu.Unlock()
+		if n != 2 {
+			t.Fatalf("expected the retry to be flushed, got %d sends", n)
+		}
+
+		broker.Nack(last())
+		if s := broker.Stats(); s.Queued != 0 || s.Dropped != 1 {
+			t.Errorf("expected the packet dropped after MaxRetries, got %+v", s)
+		}
+		if err := broker.Nack(last()); err == nil {
+			t.Error("expected an error for a batch not in flight")
+		}
+	})
+
+	t.Run("Response Acknowledges Batch", func(t *testing.T) {
+		server := crudp.New(crudp.WithHandlers(&UserController{}))
+		client := crudp.NewLoopback(server, crudp.WithHandlers(&UserController{}))
+		client.EnqueuePacket(0, 'c', "req1", &User{Name: "Ana"})
+		client.Broker().FlushNow()
+
+		if s := client.Broker().Stats(); s.InFlight != 0 || s.Queued != 0 || s.Requeued != 0 {
+			t.Errorf("batch not acknowledged: %+v", s)
+		}
+	})
+
+	t.Run("Throttled Packets Are Sent Again", func(t *testing.T) {
+		scfg := crudp.DefaultConfig()
+		scfg.CircuitBreaker = &crudp.CircuitBreakerConfig{Failures: 1, OpenFor: 20}
+		server := crudp.New(scfg, crudp.WithHandlers(&Recovering{}))
+
+		ccfg := crudp.DefaultConfig()
+		ccfg.FlushStrategy = crudp.ManualFlush()
+		ccfg.RetryInterval = 5
+		client := crudp.NewLoopback(server, ccfg)
+
+		recoveringDown.Store(true)
+		recoveringCalls.Store(0)
+		client.EnqueuePacket(0, 'r', "fail", nil)
+		client.Broker().FlushNow()
+		if s := client.Broker().Stats(); s.Queued != 0 || s.Requeued != 0 {
+			t.Fatalf("handler errors must not be retried: %+v", s)
+		}
+
+		client.EnqueuePacket(0, 'r', "open", nil)
+		client.Broker().FlushNow()
+		if s := client.Broker().Stats(); s.Queued != 1 || s.Requeued != 1 {
+			t.Fatalf("fast-failed packet not re-queued: %+v", s)
+		}
+
+		recoveringDown.Store(false)
+		time.Sleep(60 * time.Millisecond)
+		if s := client.Broker().Stats(); recoveringCalls.Load() != 2 || s.Queued != 0 || s.InFlight != 0 {
+			t.Errorf("retry not processed: %d calls, %+v", recoveringCalls.Load(), s)
+		}
+	})
+
+	t.Run("Undecodable Batch Fails Every Packet", func(t *testing.T) {
+		server := crudp.New(crudp.WithHandlers(&UserController{}))
+		cfg := crudp.DefaultConfig()
+		cfg.FlushStrategy = crudp.ManualFlush()
+		client := crudp.New(cfg, crudp.WithHandlers(&UserController{}))
+		client.Broker().SetOnFlush(func([]byte) {
+			response, err := server.ProcessBatch(context.Background(), []byte("{not a batch"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.ReceiveBatch(response)
+		})
+
+		var results []crudp.PacketResult
+		client.OnResult(func(pr crudp.PacketResult) { results = append(results, pr) })
+		client.EnqueuePacket(0, 'c', "req1", &User{Name: "Ana"})
+		client.EnqueuePacket(0, 'd', "req2", &User{ID: 1})
+		client.Broker().FlushNow()
+
+		if len(results) != 2 || results[0].ReqID != "req1" || results[1].ReqID != "req2" {
+			t.Fatalf("expected one result per packet in order, got %+v", results)
+		}
+		for _, pr := range results {
+			if pr.Code != crudp.CodeDecode || pr.MessageType != uint8(Msg.Error) {
+				t.Errorf("%s: expected decode_error, got %q", pr.ReqID, pr.Code)
+			}
+		}
+		if s := client.Broker().Stats(); s.InFlight != 0 || s.Queued != 0 || s.Dropped != 2 {
+			t.Errorf("expected the batch dropped, got %+v", s)
+		}
+	})
+}
@@ -0,0 +1,9 @@
+//go:build wasm
+
+package crudp_test
+
+import "testing"
+
+func TestInFlight_WASM(t *testing.T) {
+	InFlightShared(t)
+}
@@ -35,6 +35,20 @@ type NamedHandler interface {
 	HandlerName() string
 }
 
+// EntityProvider is implemented by handlers that are not their own entity,
+// e.g. store/sql (optional). Packet data decodes into the type of Entity,
+// which must return a non-nil pointer to a zero value.
+type EntityProvider interface {
+	Entity() any
+}
+
+// Keyer identifies the entity a data item stands for, e.g. "user:42" (optional)
+// Types without it are identified by their ID field, see EntityKey.
+// Return "" when the item has no identity yet.
+type Keyer interface {
+	EntityKey() string
+}
+
 // Validator validates complete data before action (optional)
 type Validator interface {
 	Validate(action byte, data ...any) error
@@ -0,0 +1,106 @@
+package crudp
+
+import "reflect"
+
+// HandlerSchema describes a registered handler for dynamic clients (forms,
+// admin tables). See Schema.
+type HandlerSchema struct {
+	ID      uint8         `json:"id"`
+	Name    string        `json:"name"`
+	Type    string        `json:"type"`    // Go type name of the entity, e.g. "User"
+	Actions string        `json:"actions"` // Implemented and allowed actions, e.g. "crud" or "crudp"
+	Paged   bool          `json:"paged"`   // Read accepts a Page (Paginator)
+	Fields  []FieldSchema `json:"fields"`
+}
+
+// FieldSchema describes an exported field of a handler type
+type FieldSchema struct {
+	Name   string        `json:"name"` // Go field name
+	JSON   string        `json:"json"` // Name in the encoded item (json tag or Go name)
+	Kind   string        `json:"kind"` // reflect.Kind: "string", "int64", "bool", "struct", "slice"...
+	Type   string        `json:"type"` // Go type, e.g. "[]string" or "crudp.FileRef"
+	Tag    string        `json:"tag"`  // Raw struct tag, for app-specific keys (labels, widgets)
+	Fields []FieldSchema `json:"fields"`
+}
+
+// Schema returns the handlers with their actions and field metadata
+// Actions disabled by Config.ActionPolicy or ReadOnly are left out, so a UI
+// built from the schema only offers what the server accepts. Clients fetch
+// the server schema from APIEndpoint + "/schema".
+func (cp *CrudP) Schema() []HandlerSchema {
+	handlers := cp.table()
+	schema := make([]HandlerSchema, 0, len(handlers))
+	for i := range handlers {
+		h := &handlers[i]
+		if h.handler == nil {
+			continue
+		}
+		t := handlerType(h.handler)
+		hs := HandlerSchema{ID: h.index, Name: h.name, Type: t.Name(), Paged: h.ReadPage != nil}
+		for _, a := range []struct {
+			action byte
+			ok     bool
+		}{{'c', h.Create != nil}, {'r', h.Read != nil || h.ReadPage != nil}, {'u', h.Update != nil}, {'d', h.Delete != nil}, {ActionPatch, h.Patch != nil}} {
+			if a.ok && cp.allows(h.name, a.action) {
+				hs.Actions += string(a.action)
+			}
+		}
+		hs.Fields = fieldSchema(t, 0)
+		schema = append(schema, hs)
+	}
+	return schema
+}
+
+// schemaEndpoint is the route of the server Schema
+func (cp *CrudP) schemaEndpoint() string {
+	return cp.config.APIEndpoint + "/schema"
+}
+
+// allows reports whether the server configuration accepts action for handler
+func (cp *CrudP) allows(name string, action byte) bool {
+	if cp.config.ReadOnly && mutating(action) {
+		return false
+	}
+	return cp.config.ActionPolicy == nil || cp.config.ActionPolicy.Allows(name, action)
+}
+
+// fieldSchema lists the exported fields of struct t (nested structs to depth 8)
+func fieldSchema(t reflect.Type, depth int) []FieldSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || depth > 8 {
+		return nil
+	}
+	fields := make([]FieldSchema, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue // Unexported fields are not encoded
+		}
+		fields = append(fields, FieldSchema{
+			Name:   f.Name,
+			JSON:   jsonName(f),
+			Kind:   f.Type.Kind().String(),
+			Type:   f.Type.String(),
+			Tag:    string(f.Tag),
+			Fields: fieldSchema(f.Type, depth+1),
+		})
+	}
+	return fields
+}
+
+// jsonName is the json tag name of a field, or its Go name
+func jsonName(f reflect.StructField) string {
+	tag := f.Tag.Get("json")
+	for i := 0; i < len(tag); i++ {
+		if tag[i] == ',' {
+			tag = tag[:i]
+			break
+		}
+	}
+	if tag == "" || tag == "-" {
+		return f.Name
+	}
+	return tag
+}
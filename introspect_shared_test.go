@@ -0,0 +1,65 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+// Product exercises the schema of tagged, nested and unexported fields
+type Product struct {
+	ID     string        `json:"id"`
+	Title  string        `json:"title" label:"Product title"`
+	Price  float64       `json:"price,omitempty"`
+	Tags   []string      `json:"tags"`
+	Image  crudp.FileRef `json:"image"`
+	Hidden bool          `json:"-"`
+	cost   float64
+}
+
+func (h *Product) Create(ctx context.Context, data ...any) any { return data }
+func (h *Product) Delete(ctx context.Context, data ...any) any { return data }
+func (h *Product) ReadPage(ctx context.Context, page crudp.Page, data ...any) (any, crudp.PageInfo) {
+	return nil, crudp.PageInfo{}
+}
+
+func IntrospectShared(t *testing.T) {
+	t.Run("Fields And Actions", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&User{}, &Product{}))
+		schema := cp.Schema()
+		if len(schema) != 2 {
+			t.Fatalf("expected 2 handlers, got %+v", schema)
+		}
+		p := schema[1]
+		if p.ID != 1 || p.Name != "product" || p.Type != "Product" || p.Actions != "crd" || !p.Paged {
+			t.Errorf("unexpected handler schema %+v", p)
+		}
+		if len(p.Fields) != 6 {
+			t.Fatalf("expected 6 exported fields, got %+v", p.Fields)
+		}
+		title := p.Fields[1]
+		if title.Name != "Title" || title.JSON != "title" || title.Kind != "string" || title.Tag != `json:"title" label:"Product title"` {
+			t.Errorf("unexpected title field %+v", title)
+		}
+		if p.Fields[2].JSON != "price" || p.Fields[3].Type != "[]string" || p.Fields[3].Kind != "slice" || p.Fields[5].JSON != "Hidden" {
+			t.Errorf("unexpected fields %+v", p.Fields)
+		}
+		if image := p.Fields[4]; image.Kind != "struct" || image.Type != "crudp.FileRef" || len(image.Fields) != 4 || image.Fields[0].JSON != "id" {
+			t.Errorf("unexpected nested field %+v", image)
+		}
+	})
+
+	t.Run("Policy Hides Actions", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.ActionPolicy = crudp.ActionPolicy{"product": "d"}
+		if actions := crudp.New(cfg, crudp.WithHandlers(&Product{})).Schema()[0].Actions; actions != "cr" {
+			t.Errorf("expected delete hidden, got %q", actions)
+		}
+		cfg = crudp.DefaultConfig()
+		cfg.ReadOnly = true
+		if actions := crudp.New(cfg, crudp.WithHandlers(&Product{})).Schema()[0].Actions; actions != "r" {
+			t.Errorf("expected read only, got %q", actions)
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package crudp
+
+import (
+	"context"
+	"sync"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// jobPrefix starts the reserved channels of job results
+const jobPrefix = "job:"
+
+// jobQueueSize bounds the deferred packets waiting for a worker
+const jobQueueSize = 1024
+
+// WithDeferred asks the server to run the packet as a background job: it is
+// acknowledged right away with Code CodeDeferred and a JobID, and its final
+// result (with follow-ups) is sent later on the JobChannel of the user, e.g.
+// for slow exports that shouldn't block the batch. Calls wait for the final
+// result. Servers without Config.JobWorkers, or packets without a
+// UserProvider user to deliver to, run inline as usual.
+func WithDeferred() CallOption {
+	return callOptionFunc(func(co *callOptions) {
+		co.deferred = true
+	})
+}
+
+// JobChannel returns the job channel of a user ("job:42")
+// SSE and gRPC streams always receive the one of their UserProvider user.
+func JobChannel(userID string) string {
+	return jobPrefix + userID
+}
+
+// job is a deferred packet waiting for a worker
+type job struct {
+	id     string
+	ctx    context.Context // Request values, without its cancellation
+	co     callOptions
+	packet Packet
+	user   string
+}
+
+// jobQueue feeds the Config.JobWorkers goroutines, started on the first job
+type jobQueue struct {
+	once sync.Once
+	work chan *job
+}
+
+// deferPacket queues a WithDeferred packet and returns its acknowledgement,
+// false to run it inline
+func (cp *CrudP) deferPacket(ctx context.Context, co *callOptions, packet *Packet) (PacketResult, bool) {
+	if !packet.Deferred || cp.config.JobWorkers <= 0 || cp.config.UserProvider == nil {
+		return PacketResult{}, false
+	}
+	user := cp.config.UserProvider.GetUserID(ctx)
+	if user == "" {
+		return PacketResult{}, false
+	}
+	cp.jobs.once.Do(func() {
+		cp.jobs.work = make(chan *job, jobQueueSize)
+		for range cp.config.JobWorkers {
+			go cp.jobWorker()
+		}
+	})
+
+	j := &job{id: randomID(), ctx: context.WithoutCancel(ctx), co: *co, packet: *packet, user: user}
+	j.co.chunk = nil
+	// Items may reference the request buffer (binary framing): keep copies
+	j.packet.Data = copyItems(packet.Data)
+	j.packet.Attachments = copyItems(packet.Attachments)
+
+	select {
+	case cp.jobs.work <- j:
+	default:
+		cp.log.Warn("job queue full, running inline", "handler", packet.HandlerID, "req_id", packet.ReqID)
+		return PacketResult{}, false
+	}
+	cp.log.Debug("packet deferred", "handler", packet.HandlerID, "req_id", packet.ReqID, "job", j.id)
+	return PacketResult{
+		Packet:      packet.echo(),
+		MessageType: uint8(Msg.Info),
+		Code:        CodeDeferred,
+		JobID:       j.id,
+	}, true
+}
+
+// jobWorker runs queued jobs until the process exits
+func (cp *CrudP) jobWorker() {
+	for j := range cp.jobs.work {
+		cp.runJob(j)
+	}
+}
+
+// runJob processes a deferred packet and sends its results to the user
+// The job can be canceled by ReqID like any running packet (see Cancel).
+func (cp *CrudP) runJob(j *job) {
+	followUps := &dispatchBatch{cp: cp, co: &j.co}
+	ctx, stop := cp.running.track(j.ctx, &j.packet)
+	result, _ := cp.processSinglePacket(followUps.with(ctx, &j.packet, 0), &j.co, &j.packet)
+	if stop() {
+		result = canceledResult(&j.packet, context.Canceled)
+		cp.translateError(j.ctx, &j.packet, &result, context.Canceled)
+	}
+	followUps.settle(&j.packet, &result)
+	result.JobID = j.id
+
+	// Events use the codec of the instance, like every broadcast
+	data, err := cp.codec.Encode(BatchResponse{Results: append([]PacketResult{result}, followUps.close()...)})
+	if err != nil {
+		cp.log.Error("job result encoding failed", "job", j.id, "error", err)
+		return
+	}
+	cp.broadcast(Tenant(j.ctx), Event{Channel: JobChannel(j.user), HandlerID: j.packet.HandlerID, Data: data})
+}
+
+// copyItems returns a deep copy of packet items
+func copyItems(items [][]byte) [][]byte {
+	if items == nil {
+		return nil
+	}
+	out := make([][]byte, len(items))
+	for i, item := range items {
+		out[i] = append([]byte(nil), item...)
+	}
+	return out
+}
+
+// isJob reports whether ev carries the results of a job
+func isJob(ev Event) bool {
+	return len(ev.Channel) > len(jobPrefix) && ev.Channel[:len(jobPrefix)] == jobPrefix
+}
+
+// receiveJob delivers the results of a job like those of a batch response
+func (cp *CrudP) receiveJob(ev Event) {
+	var resp BatchResponse
+	if err := cp.codec.Decode(ev.Data, &resp); err != nil {
+		cp.log.Warn("job result decoding failed", "error", err)
+		return
+	}
+	cp.deliverResults(resp.Results)
+}
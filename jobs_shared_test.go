@@ -0,0 +1,86 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+func JobsShared(t *testing.T) {
+	newServer := func(workers int) *crudp.CrudP {
+		cfg := crudp.DefaultConfig()
+		cfg.UserProvider = userFromCtx{}
+		cfg.JobWorkers = workers
+		return crudp.New(crudp.WithConfig(cfg), crudp.WithHandlers(&Importer{}))
+	}
+	processAsAlice := func(t *testing.T, cp *crudp.CrudP, packet crudp.Packet) crudp.PacketResult {
+		t.Helper()
+		batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{packet}})
+		resp, err := cp.ProcessBatch(context.WithValue(context.Background(), userKey{}, "alice"), batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out crudp.BatchResponse
+		if err := cp.Codec().Decode(resp, &out); err != nil || len(out.Results) != 1 {
+			t.Fatalf("decode: %v", err)
+		}
+		return out.Results[0]
+	}
+
+	t.Run("Acknowledged Then Delivered", func(t *testing.T) {
+		server := newServer(2)
+		events := make(chan crudp.Event, 1)
+		sub := server.ListenTo(func(ev crudp.Event) { events <- ev }, crudp.JobChannel("alice"))
+		defer sub.Close()
+
+		ack := processAsAlice(t, server, crudp.Packet{Action: 'c', ReqID: "job-1", Deferred: true})
+		if ack.Code != crudp.CodeDeferred || ack.JobID == "" || ack.MessageType != uint8(Msg.Info) || len(ack.Data) != 0 {
+			t.Fatalf("unexpected acknowledgement %+v", ack)
+		}
+
+		var ev crudp.Event
+		select {
+		case ev = <-events:
+		case <-time.After(2 * time.Second):
+			t.Fatal("job result not delivered")
+		}
+
+		var got []crudp.PacketResult
+		client := crudp.NewDefault()
+		client.OnResult(func(pr crudp.PacketResult) { got = append(got, pr) })
+		client.ReceiveEvent(ev)
+		if len(got) != 1 || got[0].ReqID != "job-1" || got[0].JobID != ack.JobID || got[0].MessageType != uint8(Msg.Success) || len(got[0].Data) != 1 {
+			t.Fatalf("unexpected job result %+v", got)
+		}
+	})
+
+	t.Run("Runs Inline Without Workers", func(t *testing.T) {
+		server := newServer(0)
+		pr := processAsAlice(t, server, crudp.Packet{Action: 'c', ReqID: "job-2", Deferred: true})
+		if pr.Code == crudp.CodeDeferred || pr.MessageType != uint8(Msg.Success) || len(pr.Data) != 1 {
+			t.Fatalf("expected an inline result, got %+v", pr)
+		}
+	})
+
+	t.Run("Runs Inline Without User", func(t *testing.T) {
+		server := newServer(2)
+		if pr := processOne(t, server, crudp.Packet{Action: 'c', Deferred: true}); pr.Code == crudp.CodeDeferred {
+			t.Fatalf("nobody would receive the job result: %+v", pr)
+		}
+	})
+
+	t.Run("Deferred Packets Are Not Consolidated", func(t *testing.T) {
+		client := crudp.NewDefault()
+		var sent crudp.BatchRequest
+		client.Broker().SetOnFlush(func(batch []byte) { client.Codec().Decode(batch, &sent) })
+		client.EnqueuePacket(0, 'c', "a", "x")
+		client.EnqueuePacket(0, 'c', "b", "y", crudp.WithDeferred())
+		client.Broker().FlushNow()
+		if len(sent.Packets) != 2 || sent.Packets[0].Deferred || !sent.Packets[1].Deferred {
+			t.Fatalf("unexpected batch %+v", sent.Packets)
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package crudp
+
+import (
+	"reflect"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// EntityKey returns what identifies the entity v (a struct or a pointer to
+// one) across the framework: EntityKey() when v implements Keyer, its ID field
+// otherwise; "" if none or zero. The entity cache, broker supersession,
+// conflict errors and event invalidation all use it.
+func EntityKey(v any) string {
+	if k, ok := v.(Keyer); ok {
+		return k.EntityKey()
+	}
+	return entityID(v)
+}
+
+// itemKeys returns the entity key of an enqueued item, nil if it has none
+func itemKeys(data any) []string {
+	if key := EntityKey(data); key != "" {
+		return []string{key}
+	}
+	return nil
+}
+
+// itemKeys returns the keys of the packet aligned with Data ("" = none)
+func (p *Packet) itemKeys() []string {
+	return alignKeys(p.keys, len(p.Data))
+}
+
+// alignKeys pads or cuts keys to n items ("" = none)
+func alignKeys(keys []string, n int) []string {
+	if len(keys) == n {
+		return keys
+	}
+	aligned := make([]string, n)
+	copy(aligned, keys)
+	return aligned
+}
+
+// entityID returns the ID field of a struct as a string, "" if none or zero
+func entityID(v any) string {
+	sv := structValue(v)
+	if !sv.IsValid() {
+		return ""
+	}
+	f := sv.FieldByName("ID")
+	if !f.IsValid() {
+		return ""
+	}
+	switch f.Kind() {
+	case reflect.String:
+		return f.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f.Int() != 0 {
+			return Fmt("%d", f.Int())
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if f.Uint() != 0 {
+			return Fmt("%d", f.Uint())
+		}
+	}
+	return ""
+}
@@ -0,0 +1,177 @@
+package crudp
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// Messages CRUDP answers itself, localized per request. Each LocStr keeps the
+// verbs of the English text in the same order.
+var (
+	msgNotImplemented = LocStr{
+		"action '%c' not implemented for handler: %s",
+		"acción '%c' no implementada para el manejador: %s",
+		"", "", "",
+		"ação '%c' não implementada para o manipulador: %s",
+		"action '%c' non implémentée pour le gestionnaire : %s",
+		"Aktion '%c' für Handler nicht implementiert: %s",
+	}
+	msgNoHandler = LocStr{
+		"no handler found for id: %d",
+		"no se encontró manejador para el id: %d",
+		"", "", "",
+		"nenhum manipulador encontrado para o id: %d",
+		"aucun gestionnaire trouvé pour l'id : %d",
+		"kein Handler für ID gefunden: %d",
+	}
+	msgNoVersion = LocStr{
+		"version %d not registered for handler: %s",
+		"versión %d no registrada para el manejador: %s",
+		"", "", "",
+		"versão %d não registrada para o manipulador: %s",
+		"version %d non enregistrée pour le gestionnaire : %s",
+		"Version %d für Handler nicht registriert: %s",
+	}
+	msgExpired = LocStr{
+		"packet expired",
+		"paquete expirado",
+		"", "", "",
+		"pacote expirado",
+		"paquet expiré",
+		"Paket abgelaufen",
+	}
+	msgDependencyFailed = LocStr{
+		"dependency %s failed",
+		"la dependencia %s falló",
+		"", "", "",
+		"a dependência %s falhou",
+		"la dépendance %s a échoué",
+		"Abhängigkeit %s fehlgeschlagen",
+	}
+	msgAborted = LocStr{
+		"aborted: packet %s failed",
+		"abortado: el paquete %s falló",
+		"", "", "",
+		"abortado: o pacote %s falhou",
+		"annulé : le paquet %s a échoué",
+		"abgebrochen: Paket %s fehlgeschlagen",
+	}
+	msgRefsInStream = LocStr{
+		"refs are not supported in streams",
+		"las referencias no se admiten en streams",
+		"", "", "",
+		"referências não são suportadas em streams",
+		"les références ne sont pas prises en charge dans les flux",
+		"Referenzen werden in Streams nicht unterstützt",
+	}
+)
+
+// locales maps a language subtag to its tinystring LocStr index
+var locales = map[string]int{
+	"en": int(EN), "es": int(ES), "zh": int(ZH), "hi": int(HI), "ar": int(AR),
+	"pt": int(PT), "fr": int(FR), "de": int(DE), "ru": int(RU),
+}
+
+// LocError is an error with a message localized per request
+// Error returns the English text; results sent to a client use the locale
+// of the request (see WithLocale). Handlers and validators may return it so
+// their messages are localized too.
+type LocError struct {
+	Msg  LocStr
+	Args []any
+}
+
+// LocErr returns a LocError formatting msg with args
+func LocErr(msg LocStr, args ...any) *LocError {
+	return &LocError{Msg: msg, Args: args}
+}
+
+func (e *LocError) Error() string {
+	return e.In("")
+}
+
+// In returns the message in locale, English if it has no translation
+func (e *LocError) In(locale string) string {
+	return Fmt(localized(e.Msg, locale), e.Args...)
+}
+
+// localized returns the text of msg in locale, falling back to English
+func localized(msg LocStr, locale string) string {
+	if i, ok := locales[locale]; ok && msg[i] != "" {
+		return msg[i]
+	}
+	return msg[EN]
+}
+
+// WithLocale stores the language of the client in ctx (set by BuildRouter
+// from Accept-Language), e.g. "es" or "pt-BR"
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey, localeTag(locale))
+}
+
+// Locale returns the language subtag stored by WithLocale, "" if none
+func Locale(ctx context.Context) string {
+	locale, _ := ctx.Value(localeKey).(string)
+	return locale
+}
+
+// AcceptLocale returns the first language of an Accept-Language header that
+// CRUDP has messages for, "" if none. Weights are ignored: browsers list
+// languages by preference.
+func AcceptLocale(header string) string {
+	start := 0
+	for i := 0; i <= len(header); i++ {
+		if i < len(header) && header[i] != ',' {
+			continue
+		}
+		locale := localeTag(header[start:i])
+		if _, ok := locales[locale]; ok {
+			return locale
+		}
+		start = i + 1
+	}
+	return ""
+}
+
+// localeTag reduces a language tag (with optional ";q=" weight) to its
+// lowercase primary subtag
+func localeTag(tag string) string {
+	b := make([]byte, 0, 2)
+	for i := 0; i < len(tag); i++ {
+		c := tag[i]
+		switch {
+		case c == ' ' && len(b) == 0:
+			continue
+		case c == '-' || c == '_' || c == ' ' || c == ';':
+			return string(b)
+		case c >= 'A' && c <= 'Z':
+			c += 'a' - 'A'
+		}
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+// localize rewrites the Message of pr in the locale of ctx when it is a
+// message of CRUDP or a handler built with LocErr, and sets its MessageKey
+// when the text is in the catalog. Results built without an error carry
+// their MessageKey already (e.g. expired packets).
+func (cp *CrudP) localize(ctx context.Context, pr *PacketResult, err error) {
+	locale := Locale(ctx)
+	var le *LocError
+	if errors.As(err, &le) {
+		pr.Message = le.In(locale)
+		if pr.MessageKey = messageKey(le.Msg); pr.MessageKey != "" {
+			pr.MessageArgs = formatArgs(le.Msg, le.Args)
+		}
+	} else if pr.MessageKey != "" && err == nil {
+		if text, ok := MessageText(pr.MessageKey, locale, pr.MessageArgs...); ok {
+			pr.Message = text
+		}
+	}
+	if cp.config.MessageKeys && pr.MessageKey != "" {
+		pr.Message = "" // The client renders it from its catalog
+	}
+}
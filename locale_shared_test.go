@@ -0,0 +1,88 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Polyglot validates with a localized error
+type Polyglot struct{}
+
+var msgNameRequired = LocStr{"name required", "nombre requerido"}
+
+func (h *Polyglot) Create(ctx context.Context, data ...any) any {
+	return flakyResult{err: crudp.LocErr(msgNameRequired)}
+}
+
+// processIn runs a single packet with the locale of a client
+func processLocale(t *testing.T, cp *crudp.CrudP, locale string, packet crudp.Packet) crudp.PacketResult {
+	t.Helper()
+	batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{packet}})
+	resp, err := cp.ProcessBatch(crudp.WithLocale(context.Background(), locale), batch)
+	if err != nil {
+		t.Fatalf("ProcessBatch error: %v", err)
+	}
+	var batchResp crudp.BatchResponse
+	if err := cp.Codec().Decode(resp, &batchResp); err != nil || len(batchResp.Results) != 1 {
+		t.Fatalf("decode error: %v", err)
+	}
+	return batchResp.Results[0]
+}
+
+func LocaleShared(t *testing.T) {
+	t.Run("Framework Messages", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&Flaky{}))
+
+		if pr := processLocale(t, cp, "es", crudp.Packet{Action: 'd', HandlerID: 0}); pr.Message != "acción 'd' no implementada para el manejador: flaky" {
+			t.Errorf("not implemented: %q", pr.Message)
+		}
+		if pr := processLocale(t, cp, "pt-BR", crudp.Packet{Action: 'r', HandlerID: 0, Deadline: 1}); pr.Message != "pacote expirado" || pr.Code != crudp.CodeExpired {
+			t.Errorf("expired: %q %q", pr.Message, pr.Code)
+		}
+		if pr := processLocale(t, cp, "", crudp.Packet{Action: 'd', HandlerID: 0}); pr.Message != "action 'd' not implemented for handler: flaky" {
+			t.Errorf("default locale: %q", pr.Message)
+		}
+		if pr := processLocale(t, cp, "hi", crudp.Packet{Action: 'r', HandlerID: 9}); pr.Message != "no handler found for id: 9" {
+			t.Errorf("missing translation falls back to English: %q", pr.Message)
+		}
+	})
+
+	t.Run("Handler Messages", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&Polyglot{}))
+		if pr := processLocale(t, cp, "es", crudp.Packet{Action: 'c', HandlerID: 0}); pr.Message != "nombre requerido" {
+			t.Errorf("es: %q", pr.Message)
+		}
+		if pr := processLocale(t, cp, "fr", crudp.Packet{Action: 'c', HandlerID: 0}); pr.Message != "name required" {
+			t.Errorf("fr falls back to English: %q", pr.Message)
+		}
+	})
+
+	t.Run("OnError Sees The Original Error", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&Polyglot{}))
+		var got string
+		cp.OnError(func(ctx context.Context, handlerName string, action byte, err error) error {
+			got = err.Error()
+			return nil
+		})
+		if pr := processLocale(t, cp, "es", crudp.Packet{Action: 'c', HandlerID: 0}); pr.Message != "nombre requerido" || got != "name required" {
+			t.Errorf("got %q, hook saw %q", pr.Message, got)
+		}
+	})
+
+	t.Run("Accept Language", func(t *testing.T) {
+		for header, want := range map[string]string{
+			"fr-CH, fr;q=0.9, en;q=0.8": "fr",
+			"xx-YY,DE;q=0.5":            "de",
+			"es":                        "es",
+			"xx":                        "",
+			"":                          "",
+		} {
+			if got := crudp.AcceptLocale(header); got != want {
+				t.Errorf("AcceptLocale(%q) = %q, want %q", header, got, want)
+			}
+		}
+	})
+}
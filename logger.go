@@ -0,0 +1,41 @@
+package crudp
+
+// Logger receives protocol events with a severity and key-value fields
+// *slog.Logger satisfies it directly; wrap zap, zerolog, etc. with an adapter.
+//
+//	cp.SetLeveledLogger(slog.Default())
+type Logger interface {
+	Debug(msg string, kv ...any)
+	Info(msg string, kv ...any)
+	Warn(msg string, kv ...any)
+	Error(msg string, kv ...any)
+}
+
+// noopLogger is the default logger that does nothing
+type noopLogger struct{}
+
+func (noopLogger) Debug(string, ...any) {}
+func (noopLogger) Info(string, ...any)  {}
+func (noopLogger) Warn(string, ...any)  {}
+func (noopLogger) Error(string, ...any) {}
+
+// funcLogger adapts the variadic func of SetLogger to Logger
+// Every level is written as: msg, "key:", value, "key:", value...
+type funcLogger func(...any)
+
+func (f funcLogger) Debug(msg string, kv ...any) { f.write(msg, kv) }
+func (f funcLogger) Info(msg string, kv ...any)  { f.write(msg, kv) }
+func (f funcLogger) Warn(msg string, kv ...any)  { f.write(msg, kv) }
+func (f funcLogger) Error(msg string, kv ...any) { f.write(msg, kv) }
+
+func (f funcLogger) write(msg string, kv []any) {
+	args := make([]any, 0, len(kv)+1)
+	args = append(args, msg)
+	for i, v := range kv {
+		if key, ok := v.(string); ok && i%2 == 0 {
+			v = key + ":"
+		}
+		args = append(args, v)
+	}
+	f(args...)
+}
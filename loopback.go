@@ -0,0 +1,27 @@
+package crudp
+
+import "context"
+
+// NewLoopback creates a client wired in-process to server
+// Broker flushes are processed by server.ProcessBatch and the response is fed
+// to client.ReceiveBatch; server broadcasts are delivered to client.ReceiveEvent.
+// Useful for client→server→broadcast tests without an HTTP server.
+func NewLoopback(server *CrudP, opts ...Option) *CrudP {
+	client := New(opts...)
+
+	client.broker.SetOnFlush(func(batch []byte) {
+		response, err := server.ProcessBatch(context.Background(), batch)
+		if err != nil {
+			client.log.Error("loopback ProcessBatch failed", "error", err)
+			client.broker.Nack(batch)
+			return
+		}
+		if err := client.ReceiveBatch(response); err != nil {
+			client.log.Error("loopback ReceiveBatch failed", "error", err)
+		}
+	})
+
+	server.hub.attach(nil, client.ReceiveEvent)
+
+	return client
+}
@@ -0,0 +1,67 @@
+package crudp_test
+
+import (
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+func LoopbackShared(t *testing.T) {
+	t.Run("Client To Server To Broadcast", func(t *testing.T) {
+		server := crudp.NewDefault()
+		if err := server.RegisterHandler(&sseHandler{}); err != nil {
+			t.Fatalf("Failed to register handler: %v", err)
+		}
+
+		client := crudp.NewLoopback(server, crudp.WithHandlers(&sseHandler{}))
+
+		var results []crudp.PacketResult
+		client.OnResult(func(pr crudp.PacketResult) {
+			results = append(results, pr)
+		})
+
+		var channels []string
+		client.OnEvent(func(ev crudp.Event) {
+			channels = append(channels, ev.Channel)
+		})
+
+		if err := client.EnqueuePacket(0, 'c', "loop-1", &sseHandler{}); err != nil {
+			t.Fatalf("EnqueuePacket error: %v", err)
+		}
+		client.Broker().FlushNow()
+
+		if len(results) != 1 {
+			t.Fatalf("expected 1 result, got %d", len(results))
+		}
+		if results[0].ReqID != "loop-1" {
+			t.Errorf("expected ReqID 'loop-1', got '%s'", results[0].ReqID)
+		}
+		if results[0].MessageType != uint8(Msg.Success) {
+			t.Errorf("expected success, got: %s", results[0].Message)
+		}
+
+		if len(channels) != 2 || channels[0] != "channel1" || channels[1] != "channel2" {
+			t.Errorf("expected broadcasts to channel1 and channel2, got %v", channels)
+		}
+	})
+
+	t.Run("OnMessage Receives Result Messages", func(t *testing.T) {
+		server := crudp.NewDefault()
+		server.RegisterHandler(&UserController{})
+
+		var messages []string
+		cfg := crudp.DefaultConfig()
+		cfg.OnMessage = func(msgType uint8, message string) {
+			messages = append(messages, message)
+		}
+		client := crudp.NewLoopback(server, cfg)
+
+		client.EnqueuePacket(0, 'd', "loop-2", &UserController{}) // Delete not implemented
+		client.Broker().FlushNow()
+
+		if len(messages) != 1 {
+			t.Fatalf("expected 1 message, got %d", len(messages))
+		}
+	})
+}
@@ -0,0 +1,9 @@
+//go:build !wasm
+
+package crudp_test
+
+import "testing"
+
+func TestLoopback_Stdlib(t *testing.T) {
+	LoopbackShared(t)
+}
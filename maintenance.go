@@ -0,0 +1,118 @@
+package crudp
+
+import (
+	"sync"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// MaintenanceChannel is the reserved broadcast channel for maintenance events
+const MaintenanceChannel = "maintenance"
+
+// MaintenanceEvent is published on MaintenanceChannel when maintenance mode
+// is turned on or off
+type MaintenanceEvent struct {
+	On      bool   `json:"on"`
+	Message string `json:"message"` // Shown to users, e.g. "Back at 14:00"
+}
+
+// maintenance holds the mode set by SetMaintenance (server) or received on
+// MaintenanceChannel (client)
+type maintenance struct {
+	mu    sync.Mutex
+	state MaintenanceEvent
+	funcs []func(MaintenanceEvent) // OnMaintenance callbacks
+}
+
+// SetMaintenance turns maintenance mode on or off
+// While on, ProcessBatch answers every packet with a Msg.Warning result
+// carrying message, without calling handlers. Subscribers of every tenant
+// receive a MaintenanceEvent; with Config.PubSub the other instances switch too.
+func (cp *CrudP) SetMaintenance(on bool, message string) {
+	me := MaintenanceEvent{On: on, Message: message}
+	cp.applyMaintenance(me)
+	cp.publishBus(busMessage{kind: busMaint, maint: me})
+}
+
+// Maintenance reports whether maintenance mode is on, and its message
+func (cp *CrudP) Maintenance() (on bool, message string) {
+	cp.maint.mu.Lock()
+	defer cp.maint.mu.Unlock()
+	return cp.maint.state.On, cp.maint.state.Message
+}
+
+// OnMaintenance calls fn when maintenance mode changes (e.g. to show a banner)
+func (cp *CrudP) OnMaintenance(fn func(MaintenanceEvent)) {
+	cp.maint.mu.Lock()
+	cp.maint.funcs = append(cp.maint.funcs[:len(cp.maint.funcs):len(cp.maint.funcs)], fn) // Copy-on-write
+	cp.maint.mu.Unlock()
+}
+
+// applyMaintenance stores me, pauses or resumes the broker and notifies the
+// local subscribers and callbacks
+func (cp *CrudP) applyMaintenance(me MaintenanceEvent) {
+	cp.maint.mu.Lock()
+	cp.maint.state = me
+	funcs := cp.maint.funcs
+	cp.maint.mu.Unlock()
+
+	cp.log.Info("maintenance mode", "on", me.On, "message", me.Message)
+	if me.On {
+		cp.broker.Pause()
+	} else {
+		cp.broker.Resume()
+	}
+
+	if ev, err := cp.maintenanceEvent(); err == nil {
+		cp.hub.publishAll(ev)
+	} else {
+		cp.log.Error("maintenance encoding failed", "error", err)
+	}
+	for _, fn := range funcs {
+		fn(me)
+	}
+}
+
+// maintenanceEvent returns the current state as an Event
+func (cp *CrudP) maintenanceEvent() (Event, error) {
+	cp.maint.mu.Lock()
+	me := cp.maint.state
+	cp.maint.mu.Unlock()
+	data, err := cp.codec.Encode(me)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Channel: MaintenanceChannel, Data: data}, nil
+}
+
+// receiveMaintenance applies a MaintenanceChannel event on the client
+func (cp *CrudP) receiveMaintenance(ev Event) {
+	var me MaintenanceEvent
+	if err := cp.codec.Decode(ev.Data, &me); err != nil {
+		cp.log.Warn("maintenance decoding failed", "error", err)
+		return
+	}
+	cp.applyMaintenance(me)
+}
+
+// maintenanceResponse answers every packet of batch with the maintenance warning
+func (cp *CrudP) maintenanceResponse(codec Codec, batch *BatchRequest, message string) ([]byte, error) {
+	results := make([]PacketResult, len(batch.Packets))
+	for i := range batch.Packets {
+		results[i] = maintenanceResult(&batch.Packets[i], message)
+	}
+	return codec.Encode(BatchResponse{Results: results})
+}
+
+// maintenanceResult is the maintenance warning answered to packet
+func maintenanceResult(packet *Packet, message string) PacketResult {
+	if message == "" {
+		message = "maintenance in progress" // Never empty so clients can show it
+	}
+	return PacketResult{
+		Packet:      packet.echo(),
+		MessageType: uint8(Msg.Warning),
+		Message:     message,
+		Code:        CodeMaintenance,
+	}
+}
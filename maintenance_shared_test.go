@@ -0,0 +1,71 @@
+package crudp_test
+
+import (
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+func MaintenanceShared(t *testing.T) {
+	t.Run("Server Answers Warnings And Client Pauses", func(t *testing.T) {
+		server := crudp.New(crudp.WithHandlers(&Chart{}))
+		client := crudp.NewLoopback(server, crudp.WithHandlers(&Chart{}))
+
+		var banners []crudp.MaintenanceEvent
+		client.OnMaintenance(func(me crudp.MaintenanceEvent) { banners = append(banners, me) })
+		var results []crudp.PacketResult
+		client.OnResult(func(pr crudp.PacketResult) { results = append(results, pr) })
+
+		server.SetMaintenance(true, "Back at 14:00")
+		if on, msg := client.Maintenance(); !on || msg != "Back at 14:00" || len(banners) != 1 {
+			t.Fatalf("client not in maintenance: %v %q %v", on, msg, banners)
+		}
+
+		chartCalls = 0
+		pr := processOne(t, server, crudp.Packet{Action: 'c', HandlerID: 0})
+		if pr.MessageType != uint8(Msg.Warning) || pr.Message != "Back at 14:00" || chartCalls != 0 {
+			t.Errorf("unexpected result during maintenance: %d %q, %d calls", pr.MessageType, pr.Message, chartCalls)
+		}
+
+		// The client keeps its packets instead of retrying
+		client.EnqueuePacket(0, 'c', "kept", &Chart{ID: "1"})
+		client.Broker().FlushNow()
+		if len(results) != 0 || client.Broker().QueueLength() != 1 {
+			t.Fatalf("paused broker sent packets: %d results, %d queued", len(results), client.Broker().QueueLength())
+		}
+
+		server.SetMaintenance(false, "")
+		if on, _ := client.Maintenance(); on || len(banners) != 2 {
+			t.Fatal("client still in maintenance")
+		}
+		if len(results) != 1 || results[0].ReqID != "kept" || results[0].MessageType == uint8(Msg.Error) || chartCalls != 1 {
+			t.Errorf("kept packet not sent on resume: %+v", results)
+		}
+	})
+
+	t.Run("Shared Between Instances", func(t *testing.T) {
+		bus := crudp.NewMemoryPubSub()
+		newNode := func() *crudp.CrudP {
+			cfg := crudp.DefaultConfig()
+			cfg.PubSub = bus
+			cp := crudp.New(cfg, crudp.WithHandlers(&Chart{}))
+			t.Cleanup(func() { cp.Close() })
+			return cp
+		}
+		a, b := newNode(), newNode()
+
+		a.SetMaintenance(true, "upgrading")
+		if on, msg := b.Maintenance(); !on || msg != "upgrading" {
+			t.Fatalf("other instance: %v %q", on, msg)
+		}
+		if pr := processOne(t, b, crudp.Packet{Action: 'r', HandlerID: 0}); pr.MessageType != uint8(Msg.Warning) {
+			t.Errorf("other instance served a packet: %q", pr.Message)
+		}
+
+		a.SetMaintenance(false, "")
+		if on, _ := b.Maintenance(); on {
+			t.Error("other instance still in maintenance")
+		}
+	})
+}
@@ -0,0 +1,9 @@
+//go:build wasm
+
+package crudp_test
+
+import "testing"
+
+func TestMaintenance_WASM(t *testing.T) {
+	MaintenanceShared(t)
+}
@@ -0,0 +1,181 @@
+package crudp
+
+import (
+	"path"
+	"reflect"
+	"strings"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// HandlerSpec pins a handler to a name and ID
+// A manifest ([]HandlerSpec) is meant to live in a package imported by both
+// client and server builds so their handler tables are always identical.
+type HandlerSpec struct {
+	ID      uint8
+	Name    string // Must match HandlerName() or the snake_case type name
+	Handler any
+}
+
+// RegisterFromManifest registers handlers at the IDs pinned by the manifest
+// IDs may have gaps (e.g. retired handlers) but must be unique. Handlers may
+// be ByEnv or ServerOnly entries; a ServerOnly ID stays free in WASM builds.
+func (cp *CrudP) RegisterFromManifest(manifest []HandlerSpec) error {
+	size := 0
+	built := make([]any, len(manifest))
+	for i, spec := range manifest {
+		if spec.Handler == nil {
+			return Err(Fmt("manifest entry %d (%s) has nil handler", i, spec.Name))
+		}
+
+		name, handler, err := envEntry(spec.Handler)
+		if err != nil {
+			return err
+		}
+		built[i] = handler
+		if spec.Name != name {
+			return Err(Fmt("manifest entry %d: name %s does not match handler name %s", i, spec.Name, name))
+		}
+
+		for j := 0; j < i; j++ {
+			if manifest[j].ID == spec.ID {
+				return Err(Fmt("manifest id %d used by %s and %s", spec.ID, manifest[j].Name, spec.Name))
+			}
+			if manifest[j].Name == spec.Name {
+				return duplicateNameError(spec.Name, manifest[j].Handler, spec.Handler)
+			}
+		}
+
+		if int(spec.ID)+1 > size {
+			size = int(spec.ID) + 1
+		}
+	}
+
+	table := make([]actionHandler, size)
+
+	for i, spec := range manifest {
+		if built[i] == nil {
+			table[spec.ID] = actionHandler{index: spec.ID} // Server only: the ID stays free
+			continue
+		}
+		spec.Handler = built[i]
+		table[spec.ID] = actionHandler{
+			name:    spec.Name,
+			index:   spec.ID,
+			handler: spec.Handler,
+		}
+
+		cp.bindTo(&table[spec.ID], spec.Handler)
+
+		cp.log.Info("registered handler", "handler", spec.Name, "index", spec.ID)
+	}
+
+	cp.setTable(table)
+	return nil
+}
+
+// Manifest returns the current handler table as a manifest
+// Empty slots left by manifest gaps are omitted.
+func (cp *CrudP) Manifest() []HandlerSpec {
+	handlers := cp.table()
+	manifest := make([]HandlerSpec, 0, len(handlers))
+	for _, h := range handlers {
+		if h.handler == nil {
+			continue
+		}
+		manifest = append(manifest, HandlerSpec{
+			ID:      h.index,
+			Name:    h.name,
+			Handler: h.handler,
+		})
+	}
+	return manifest
+}
+
+// ManifestSource renders the manifest as Go source for a shared package
+// The output is meant to be written to a file via go:generate.
+func (cp *CrudP) ManifestSource(pkg string) string {
+	manifest := cp.Manifest()
+
+	// Handler types are qualified by import path: packages sharing a name
+	// (a/user, b/user) get numbered aliases (user, user2)
+	var imports, aliases []string
+	exprs := make([]string, len(manifest))
+	for i, spec := range manifest {
+		t := implType(spec.Handler)
+		pkgPath, name := t.PkgPath(), t.String()
+		if dot := strings.LastIndexByte(name, '.'); dot >= 0 {
+			name = name[:dot] // Package name, which may differ from the last path element
+		}
+		if pkgPath != "" && pkgPath != "github.com/cdvelop/crudp" {
+			alias := ""
+			for j, imp := range imports {
+				if imp == pkgPath {
+					alias = aliases[j]
+				}
+			}
+			if alias == "" {
+				alias = name
+				for n := 2; aliasTaken(aliases, alias) || alias == "crudp"; n++ {
+					alias = name + Convert(n).String()
+				}
+				imports = append(imports, pkgPath)
+				aliases = append(aliases, alias)
+			}
+			name = alias
+		}
+		exprs[i] = name + "." + t.Name() + "{}"
+		if reflect.TypeOf(spec.Handler).Kind() == reflect.Ptr {
+			exprs[i] = "&" + exprs[i]
+		}
+	}
+
+	src := "// Code generated by crudp. DO NOT EDIT.\n\n"
+	src += "package " + pkg + "\n\n"
+	src += "import (\n\t\"github.com/cdvelop/crudp\"\n"
+	for i, imp := range imports {
+		if alias := aliases[i]; alias != path.Base(imp) {
+			src += "\t" + alias + " \"" + imp + "\"\n"
+		} else {
+			src += "\t\"" + imp + "\"\n"
+		}
+	}
+	src += ")\n\n"
+	src += "// Manifest pins handler names and IDs shared by client and server\n"
+	src += "var Manifest = []crudp.HandlerSpec{\n"
+	for i, spec := range manifest {
+		src += "\t{ID: " + Convert(spec.ID).String() + ", Name: \"" + spec.Name + "\", Handler: " + exprs[i] + "},\n"
+	}
+	src += "}\n"
+	return src
+}
+
+// aliasTaken reports whether alias is in aliases
+func aliasTaken(aliases []string, alias string) bool {
+	for _, a := range aliases {
+		if a == alias {
+			return true
+		}
+	}
+	return false
+}
+
+// handlerType returns the struct type packets of a handler decode into,
+// dereferencing pointers (the Entity type of an EntityProvider)
+func handlerType(handler any) reflect.Type {
+	if ep, ok := handler.(EntityProvider); ok {
+		if entity := ep.Entity(); entity != nil {
+			handler = entity
+		}
+	}
+	return implType(handler)
+}
+
+// implType returns the type implementing a handler, dereferencing pointers
+func implType(handler any) reflect.Type {
+	t := reflect.TypeOf(handler)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
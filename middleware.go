@@ -0,0 +1,61 @@
+package crudp
+
+import "context"
+
+// PacketHandler processes a single packet inside ProcessBatch
+type PacketHandler func(ctx context.Context, packet *Packet) (PacketResult, error)
+
+// PacketMiddleware wraps packet processing at the protocol level (optional)
+// Unlike MiddlewareProvider it runs per packet and also works on WASM.
+// Handlers implementing it wrap only their own packets; instances passed to
+// UsePacketMiddleware wrap every packet.
+type PacketMiddleware interface {
+	Wrap(next PacketHandler) PacketHandler
+}
+
+// PacketMiddlewareFunc adapts a function to PacketMiddleware
+type PacketMiddlewareFunc func(next PacketHandler) PacketHandler
+
+func (f PacketMiddlewareFunc) Wrap(next PacketHandler) PacketHandler { return f(next) }
+
+// UsePacketMiddleware adds global packet middleware
+// The first one added is the outermost; handler middleware runs innermost.
+func (cp *CrudP) UsePacketMiddleware(mw ...PacketMiddleware) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	chain := make([]PacketMiddleware, 0, len(cp.packetMiddleware)+len(mw))
+	chain = append(chain, cp.packetMiddleware...)
+	for _, m := range mw {
+		if m != nil {
+			chain = append(chain, m)
+		}
+	}
+	cp.packetMiddleware = chain
+}
+
+// wrapPacketHandler builds the middleware chain for a handler's packet
+// Global middleware is the outermost, then its group's, then the handler's.
+func (cp *CrudP) wrapPacketHandler(handler *actionHandler, next PacketHandler) PacketHandler {
+	if mw, ok := handler.handler.(PacketMiddleware); ok {
+		next = mw.Wrap(next)
+	}
+
+	cp.mu.RLock()
+	global := cp.packetMiddleware
+	groups := cp.groupMiddleware
+	cp.mu.RUnlock()
+
+	if handler.group != "" {
+		for i := len(groups) - 1; i >= 0; i-- {
+			if groups[i].group == handler.group {
+				next = groups[i].mw.Wrap(next)
+			}
+		}
+	}
+
+	for i := len(global) - 1; i >= 0; i-- {
+		next = global[i].Wrap(next)
+	}
+	return next
+}
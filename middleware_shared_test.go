@@ -0,0 +1,98 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Handler that wraps its own packets
+type guardedHandler struct {
+	trace *[]string
+}
+
+func (h *guardedHandler) Read(ctx context.Context, data ...any) any {
+	*h.trace = append(*h.trace, "handler")
+	return "ok"
+}
+
+func (h *guardedHandler) Wrap(next crudp.PacketHandler) crudp.PacketHandler {
+	return func(ctx context.Context, p *crudp.Packet) (crudp.PacketResult, error) {
+		*h.trace = append(*h.trace, "own")
+		return next(ctx, p)
+	}
+}
+
+func processOne(t *testing.T, cp *crudp.CrudP, packet crudp.Packet) crudp.PacketResult {
+	t.Helper()
+	batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{packet}})
+	resp, err := cp.ProcessBatch(context.Background(), batch)
+	if err != nil {
+		t.Fatalf("ProcessBatch error: %v", err)
+	}
+	var batchResp crudp.BatchResponse
+	if err := cp.Codec().Decode(resp, &batchResp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if len(batchResp.Results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(batchResp.Results))
+	}
+	return batchResp.Results[0]
+}
+
+func PacketMiddlewareShared(t *testing.T) {
+	t.Run("Global Then Handler Order", func(t *testing.T) {
+		var trace []string
+		cp := crudp.NewDefault()
+		cp.RegisterHandler(&guardedHandler{trace: &trace})
+
+		tag := func(name string) crudp.PacketMiddleware {
+			return crudp.PacketMiddlewareFunc(func(next crudp.PacketHandler) crudp.PacketHandler {
+				return func(ctx context.Context, p *crudp.Packet) (crudp.PacketResult, error) {
+					trace = append(trace, name)
+					return next(ctx, p)
+				}
+			})
+		}
+		cp.UsePacketMiddleware(tag("first"), tag("second"))
+
+		result := processOne(t, cp, crudp.Packet{Action: 'r'})
+		if result.MessageType != uint8(Msg.Success) {
+			t.Fatalf("expected success, got %s", result.Message)
+		}
+
+		want := []string{"first", "second", "own", "handler"}
+		if len(trace) != len(want) {
+			t.Fatalf("expected %v, got %v", want, trace)
+		}
+		for i := range want {
+			if trace[i] != want[i] {
+				t.Errorf("expected %v, got %v", want, trace)
+				break
+			}
+		}
+	})
+
+	t.Run("Middleware Short Circuit", func(t *testing.T) {
+		var trace []string
+		cp := crudp.NewDefault()
+		cp.RegisterHandler(&guardedHandler{trace: &trace})
+
+		cp.UsePacketMiddleware(crudp.PacketMiddlewareFunc(func(next crudp.PacketHandler) crudp.PacketHandler {
+			return func(ctx context.Context, p *crudp.Packet) (crudp.PacketResult, error) {
+				err := Err("unauthorized")
+				return crudp.PacketResult{Packet: *p, MessageType: uint8(Msg.Error), Message: err.Error()}, err
+			}
+		}))
+
+		result := processOne(t, cp, crudp.Packet{Action: 'r', ReqID: "deny"})
+		if result.Message != "unauthorized" || result.ReqID != "deny" {
+			t.Errorf("expected unauthorized result, got %+v", result)
+		}
+		if len(trace) != 0 {
+			t.Errorf("handler must not run, got %v", trace)
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package crudp
+
+import . "github.com/cdvelop/tinystring"
+
+// Connectivity notifications passed to Config.OnMessage by SetNetworkOnline
+const (
+	MessageOffline = "You are offline. Changes will be sent when the connection is back"
+	MessageOnline  = "Back online"
+)
+
+// SetNetworkOnline tells the client whether the network is reachable, as
+// WatchNetwork does from navigator.onLine on WASM (client only)
+// While offline the broker keeps enqueued packets; going online flushes them
+// at once. Changes are logged and passed to Config.OnMessage, MessageOffline
+// as Msg.Warning and MessageOnline as Msg.Success, so the UI can show them.
+func (cp *CrudP) SetNetworkOnline(online bool) {
+	if cp.broker.offlineFor(offlineNetwork) != online {
+		return // No change
+	}
+	if !online {
+		cp.broker.setOffline(offlineNetwork, true)
+	}
+
+	msgType, message := uint8(Msg.Success), MessageOnline
+	if !online {
+		msgType, message = uint8(Msg.Warning), MessageOffline
+	}
+	cp.log.Info("network status", "online", online)
+	if cp.config.OnMessage != nil {
+		cp.config.OnMessage(msgType, message)
+	}
+
+	// Notify before the flush so results of held packets come after MessageOnline
+	if online {
+		cp.broker.setOffline(offlineNetwork, false)
+	}
+}
+
+// NetworkOnline reports the last state given to SetNetworkOnline, true by default
+func (cp *CrudP) NetworkOnline() bool {
+	return !cp.broker.offlineFor(offlineNetwork)
+}
@@ -0,0 +1,44 @@
+package crudp_test
+
+import (
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+func NetworkShared(t *testing.T) {
+	t.Run("Offline Holds Packets And Notifies", func(t *testing.T) {
+		var notes []string
+		cfg := crudp.DefaultConfig()
+		cfg.OnMessage = func(msgType uint8, message string) {
+			if msgType == uint8(Msg.Warning) || msgType == uint8(Msg.Success) {
+				notes = append(notes, message)
+			}
+		}
+		server := crudp.New(crudp.WithHandlers(&Chart{}))
+		client := crudp.NewLoopback(server, cfg, crudp.WithHandlers(&Chart{}))
+		var results []crudp.PacketResult
+		client.OnResult(func(pr crudp.PacketResult) { results = append(results, pr) })
+
+		if !client.NetworkOnline() {
+			t.Fatal("expected online by default")
+		}
+		client.SetNetworkOnline(false)
+		client.SetNetworkOnline(false) // No second notification
+		client.EnqueuePacket(0, 'c', "kept", &Chart{ID: "1"})
+		client.Broker().FlushNow()
+		if len(results) != 0 || !client.Broker().Stats().Offline {
+			t.Fatalf("offline broker sent packets: %d results", len(results))
+		}
+
+		client.SetNetworkOnline(true)
+		if len(results) != 1 || results[0].ReqID != "kept" {
+			t.Errorf("kept packet not sent on reconnect: %+v", results)
+		}
+		// The result of the held packet is reported after MessageOnline
+		if len(notes) != 3 || notes[0] != crudp.MessageOffline || notes[1] != crudp.MessageOnline || notes[2] != "OK" {
+			t.Errorf("unexpected notifications %q", notes)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package crudp
+
+import (
+	"context"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// notifyPrefix starts the reserved channels of notifications
+const notifyPrefix = "notify:"
+
+// Notification is a toast-level message sent to a user with Notify
+// Clients pass it to Config.OnMessage, like result messages.
+type Notification struct {
+	MessageType uint8  `json:"message_type"` // tinystring.MessageType, e.g. Msg.Warning
+	Message     string `json:"message"`
+}
+
+// NotifyChannel returns the notification channel of a user ("notify:42")
+// SSE and gRPC streams always receive the one of their UserProvider user.
+func NotifyChannel(userID string) string {
+	return notifyPrefix + userID
+}
+
+// Notify sends a message to the open streams of a user in the tenant of ctx,
+// on any instance (see Config.PubSub), without using a data channel:
+//
+//	cp.Notify(ctx, userID, Msg.Warning, "session expiring")
+//
+// Inside a handler the notification waits for the packet like its other
+// broadcasts (see Config.Outbox). Returns an error if the message cannot be
+// encoded.
+func (cp *CrudP) Notify(ctx context.Context, userID string, msgType MessageType, message string) error {
+	if userID == "" {
+		return Errf("notify: empty user ID")
+	}
+	data, err := cp.codec.Encode(Notification{MessageType: uint8(msgType), Message: message})
+	if err != nil {
+		return err
+	}
+	cp.emit(ctx, Event{Channel: NotifyChannel(userID), Data: data})
+	return nil
+}
+
+// isNotification reports whether ev was sent by Notify
+func isNotification(ev Event) bool {
+	return len(ev.Channel) > len(notifyPrefix) && ev.Channel[:len(notifyPrefix)] == notifyPrefix
+}
+
+// receiveNotification passes a notification to Config.OnMessage on the client
+func (cp *CrudP) receiveNotification(ev Event) {
+	var n Notification
+	if err := cp.codec.Decode(ev.Data, &n); err != nil {
+		cp.log.Warn("notification decoding failed", "error", err)
+		return
+	}
+	if cp.config.OnMessage != nil && n.Message != "" {
+		cp.config.OnMessage(n.MessageType, n.Message)
+	}
+}
@@ -0,0 +1,73 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+func NotifyShared(t *testing.T) {
+	t.Run("Server Sends To The User", func(t *testing.T) {
+		server := crudp.NewDefault()
+		var got []crudp.Event
+		sub := server.ListenTo(func(ev crudp.Event) { got = append(got, ev) }, crudp.NotifyChannel("alice"))
+		defer sub.Close()
+
+		if err := server.Notify(context.Background(), "alice", Msg.Warning, "session expiring"); err != nil {
+			t.Fatal(err)
+		}
+		if err := server.Notify(context.Background(), "bob", Msg.Info, "not for alice"); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0].Channel != "notify:alice" {
+			t.Fatalf("unexpected events %+v", got)
+		}
+
+		var n crudp.Notification
+		if err := server.Codec().Decode(got[0].Data, &n); err != nil || n.MessageType != uint8(Msg.Warning) || n.Message != "session expiring" {
+			t.Fatalf("unexpected notification %+v (%v)", n, err)
+		}
+		if err := server.Notify(context.Background(), "", Msg.Info, "nobody"); err == nil {
+			t.Error("expected error for an empty user ID")
+		}
+	})
+
+	t.Run("Client Passes It To OnMessage", func(t *testing.T) {
+		server := crudp.NewDefault()
+		var got crudp.Event
+		sub := server.ListenTo(func(ev crudp.Event) { got = ev }, crudp.NotifyChannel("alice"))
+		defer sub.Close()
+		server.Notify(context.Background(), "alice", Msg.Warning, "session expiring")
+
+		var types []uint8
+		var messages []string
+		cfg := crudp.DefaultConfig()
+		cfg.OnMessage = func(msgType uint8, message string) {
+			types, messages = append(types, msgType), append(messages, message)
+		}
+		client := crudp.New(crudp.WithConfig(cfg))
+		client.ReceiveEvent(got)
+		client.ReceiveEvent(crudp.Event{Channel: "notify", Data: got.Data}) // Not a notification channel
+
+		if len(messages) != 1 || messages[0] != "session expiring" || types[0] != uint8(Msg.Warning) {
+			t.Fatalf("unexpected messages %v %q", types, messages)
+		}
+	})
+
+	t.Run("Streams Receive Their Notify Channel", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.UserProvider = userFromCtx{}
+		cp := crudp.New(crudp.WithConfig(cfg))
+
+		ctx := context.WithValue(context.Background(), userKey{}, "alice")
+		channels := cp.StreamChannels(ctx, []string{"news"})
+		if len(channels) != 5 || channels[1] != "user:alice" || channels[2] != "notify:alice" || channels[3] != "progress:alice" || channels[4] != "job:alice" {
+			t.Fatalf("unexpected channels %v", channels)
+		}
+		if channels := cp.StreamChannels(ctx, []string{"notify:*"}); len(channels) != 4 {
+			t.Errorf("covered channel added again: %v", channels)
+		}
+	})
+}
@@ -0,0 +1,9 @@
+//go:build wasm
+
+package crudp_test
+
+import "testing"
+
+func TestNotify_WASM(t *testing.T) {
+	NotifyShared(t)
+}
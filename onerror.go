@@ -0,0 +1,73 @@
+package crudp
+
+import "context"
+
+// ErrorHook translates an error of a packet before it reaches the client
+// handlerName is "" when the packet named no registered handler or the batch
+// could not be decoded. Return nil to
+// keep err, a *UserError to set the result Code and Message, or any other error
+// to use its text as the Message.
+type ErrorHook func(ctx context.Context, handlerName string, action byte, err error) error
+
+// UserError is a user-facing error returned by an ErrorHook
+type UserError struct {
+	Code    string // PacketResult.Code, "" keeps the code set by CRUDP
+	Message string
+}
+
+func (e *UserError) Error() string {
+	return e.Message
+}
+
+// OnError registers a hook translating the errors of failed packets, e.g.
+// SQL constraint violations or driver errors, into user-facing messages.
+// Hooks run in order; the first returning a non-nil error wins. The original
+// error is still logged and returned to server-side callers.
+func (cp *CrudP) OnError(fn ErrorHook) {
+	if fn == nil {
+		return
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	hooks := make([]ErrorHook, len(cp.errorHooks), len(cp.errorHooks)+1)
+	copy(hooks, cp.errorHooks)
+	cp.errorHooks = append(hooks, fn)
+}
+
+// translateError rewrites the Message and Code of a failed pr with the OnError
+// hooks. packet is nil for a batch that could not be decoded; err is nil for
+// results CRUDP answers itself (expired, aborted saga), which reach the hooks
+// as a *ResultError.
+func (cp *CrudP) translateError(ctx context.Context, packet *Packet, pr *PacketResult, err error) {
+	if !failed(pr) {
+		return
+	}
+	cp.localize(ctx, pr, err)
+	cp.mu.RLock()
+	hooks := cp.errorHooks
+	cp.mu.RUnlock()
+	if len(hooks) == 0 {
+		return
+	}
+
+	var name string
+	var action byte
+	if packet != nil {
+		name, action = cp.GetHandlerName(packet.HandlerID), packet.Action
+	}
+	if err == nil {
+		err = &ResultError{Handler: name, Code: pr.Code, Message: pr.Message}
+	}
+	for _, hook := range hooks {
+		user := hook(ctx, name, action, err)
+		if user == nil {
+			continue
+		}
+		if ue, ok := user.(*UserError); ok && ue.Code != "" {
+			pr.Code = ue.Code
+		}
+		pr.Message = user.Error()
+		pr.MessageKey, pr.MessageArgs = "", nil
+		return
+	}
+}
@@ -0,0 +1,90 @@
+package crudp_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+func OnErrorShared(t *testing.T) {
+	t.Run("Translates Handler Errors", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&Flaky{}))
+		var gotName string
+		var gotAction byte
+		cp.OnError(func(ctx context.Context, handlerName string, action byte, err error) error {
+			gotName, gotAction = handlerName, action
+			if err.Error() == "database down" {
+				return &crudp.UserError{Code: "unavailable", Message: "Service unavailable, try again later"}
+			}
+			return nil
+		})
+
+		flakyFailing = true
+		defer func() { flakyFailing = false }()
+		pr := processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 0})
+		if pr.MessageType != uint8(Msg.Error) || pr.Code != "unavailable" || pr.Message != "Service unavailable, try again later" {
+			t.Fatalf("not translated: %d %q %q", pr.MessageType, pr.Code, pr.Message)
+		}
+		if gotName != "flaky" || gotAction != 'r' {
+			t.Errorf("hook got %q %c", gotName, gotAction)
+		}
+	})
+
+	t.Run("Nil Keeps Error And Plain Errors Keep Code", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&Flaky{}))
+		cp.OnError(func(ctx context.Context, handlerName string, action byte, err error) error {
+			return nil
+		})
+		cp.OnError(func(ctx context.Context, handlerName string, action byte, err error) error {
+			if handlerName == "" {
+				return Errf("unknown operation")
+			}
+			return nil
+		})
+
+		flakyFailing = true
+		defer func() { flakyFailing = false }()
+		if pr := processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 0}); pr.Message != "database down" {
+			t.Errorf("expected original message, got %q", pr.Message)
+		}
+		if pr := processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 9}); pr.Message != "unknown operation" || pr.Code != "" {
+			t.Errorf("expected translated unknown handler, got %q %q", pr.Message, pr.Code)
+		}
+	})
+
+	t.Run("Successful Packets Untouched", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&Flaky{}))
+		called := false
+		cp.OnError(func(ctx context.Context, handlerName string, action byte, err error) error {
+			called = true
+			return err
+		})
+		if pr := processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 0}); pr.MessageType != uint8(Msg.Success) || called {
+			t.Errorf("hook called for success: %q", pr.Message)
+		}
+	})
+
+	t.Run("Translates Batch Level Errors", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&Flaky{}))
+		var gotName string
+		cp.OnError(func(ctx context.Context, handlerName string, action byte, err error) error {
+			var re *crudp.ResultError
+			if errors.As(err, &re) && re.Code == crudp.CodeExpired {
+				gotName = handlerName
+				return &crudp.UserError{Message: "Request took too long"}
+			}
+			return nil
+		})
+
+		pr := processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 0, Deadline: 1})
+		if pr.Code != crudp.CodeExpired || pr.Message != "Request took too long" {
+			t.Fatalf("expired result not translated: %q %q", pr.Code, pr.Message)
+		}
+		if gotName != "flaky" {
+			t.Errorf("hook got %q", gotName)
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package crudp
+
+// Option configures a CrudP instance during New
+// *Config also implements Option so New(cfg) keeps working
+type Option interface {
+	apply(cp *CrudP)
+}
+
+// optionFunc adapts a function to the Option interface
+type optionFunc func(cp *CrudP)
+
+func (f optionFunc) apply(cp *CrudP) { f(cp) }
+
+// apply makes *Config usable directly as an Option (nil keeps defaults)
+func (c *Config) apply(cp *CrudP) {
+	if c != nil {
+		cp.config = c
+	}
+}
+
+// WithConfig sets the configuration. Nil uses DefaultConfig()
+func WithConfig(cfg *Config) Option {
+	return optionFunc(func(cp *CrudP) {
+		cp.config = cfg
+	})
+}
+
+// WithLogger sets the logging function (same as SetLogger)
+func WithLogger(logger func(...any)) Option {
+	return optionFunc(func(cp *CrudP) {
+		cp.SetLogger(logger)
+	})
+}
+
+// WithLeveledLogger sets a Logger with levels (same as SetLeveledLogger)
+func WithLeveledLogger(logger Logger) Option {
+	return optionFunc(func(cp *CrudP) {
+		cp.SetLeveledLogger(logger)
+	})
+}
+
+// WithHandlers registers the handlers once the instance is ready
+// Registration errors are available via Err()
+func WithHandlers(handlers ...any) Option {
+	return optionFunc(func(cp *CrudP) {
+		cp.pending = append(cp.pending, handlers...)
+	})
+}
@@ -0,0 +1,183 @@
+package crudp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+)
+
+// OutboxEvent is a broadcast held by Config.Outbox until it is delivered
+type OutboxEvent struct {
+	ID     string
+	Tenant string
+	Event  Event
+}
+
+// Outbox persists the broadcasts of a packet so clients only see events of
+// committed mutations (server only). With Config.Transactor, Save runs inside
+// the packet transaction: store the events in the same database.
+type Outbox interface {
+	Save(ctx context.Context, events []OutboxEvent) error
+	// Pending lists saved events not delivered yet, oldest first
+	Pending(ctx context.Context) ([]OutboxEvent, error)
+	Delivered(ctx context.Context, ids []string) error
+}
+
+// Transactor begins the transaction of a mutating packet (server only)
+// The returned ctx is passed to the handler and to Outbox.Save.
+type Transactor interface {
+	Begin(ctx context.Context) (context.Context, Tx, error)
+}
+
+// Tx is committed when the packet succeeds and rolled back otherwise
+type Tx interface {
+	Commit() error
+	Rollback() error
+}
+
+type outboxKey struct{}
+
+// outboxBuffer collects the broadcasts of one packet
+type outboxBuffer struct {
+	events []OutboxEvent
+}
+
+// emit broadcasts ev, or holds it in the packet outbox (see Config.Outbox)
+func (cp *CrudP) emit(ctx context.Context, ev Event) {
+	if buf, ok := ctx.Value(outboxKey{}).(*outboxBuffer); ok {
+		buf.events = append(buf.events, OutboxEvent{ID: randomID(), Tenant: Tenant(ctx), Event: ev})
+		return
+	}
+	cp.broadcast(Tenant(ctx), ev)
+}
+
+// withOutbox runs a packet with its broadcasts held until the transaction commits
+// Failed packets, failed saves and failed commits discard the events.
+func (cp *CrudP) withOutbox(ctx context.Context, packet *Packet, run func(context.Context) (PacketResult, error)) (PacketResult, error) {
+	if _, nested := ctx.Value(outboxKey{}).(*outboxBuffer); nested {
+		return run(ctx) // Dispatched packet: part of the parent transaction
+	}
+
+	base := ctx
+	buf := &outboxBuffer{}
+	ctx = context.WithValue(ctx, outboxKey{}, buf)
+
+	var tx Tx
+	if cp.config.Transactor != nil && mutating(packet.Action) {
+		var err error
+		if ctx, tx, err = cp.config.Transactor.Begin(ctx); err != nil {
+			cp.log.Error("transaction begin failed", "handler", packet.HandlerID, "error", err)
+			return errorResult(packet, err), err
+		}
+	}
+
+	pr, err := run(ctx)
+	if err == nil && len(buf.events) > 0 {
+		if err = cp.config.Outbox.Save(ctx, buf.events); err != nil {
+			cp.log.Error("outbox save failed", "handler", packet.HandlerID, "error", err)
+			pr = errorResult(packet, err)
+		}
+	}
+
+	if tx != nil {
+		if err != nil {
+			if rerr := tx.Rollback(); rerr != nil {
+				cp.log.Error("transaction rollback failed", "handler", packet.HandlerID, "error", rerr)
+			}
+			return pr, err
+		}
+		if err = tx.Commit(); err != nil {
+			cp.log.Error("transaction commit failed", "handler", packet.HandlerID, "error", err)
+			return errorResult(packet, err), err
+		}
+	}
+	if err != nil {
+		return pr, err
+	}
+
+	cp.deliver(base, buf.events)
+	return pr, nil
+}
+
+// DeliverOutbox broadcasts the events left pending in Config.Outbox, e.g.
+// saved before a crash. Call it at startup or periodically; delivery is at
+// least once, so clients may see an event twice.
+func (cp *CrudP) DeliverOutbox(ctx context.Context) (int, error) {
+	if cp.config.Outbox == nil {
+		return 0, nil
+	}
+	events, err := cp.config.Outbox.Pending(ctx)
+	if err != nil {
+		return 0, err
+	}
+	cp.deliver(ctx, events)
+	return len(events), nil
+}
+
+// deliver broadcasts events and marks them delivered
+func (cp *CrudP) deliver(ctx context.Context, events []OutboxEvent) {
+	if len(events) == 0 {
+		return
+	}
+	ids := make([]string, len(events))
+	for i, e := range events {
+		cp.broadcast(e.Tenant, e.Event)
+		ids[i] = e.ID
+	}
+	if err := cp.config.Outbox.Delivered(ctx, ids); err != nil {
+		cp.log.Error("outbox delivered failed", "events", len(ids), "error", err)
+	}
+}
+
+// randomID returns a random hex ID (outbox events, response continuations)
+func randomID() string {
+	var id [12]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// MemoryOutbox keeps events in memory (tests, single process)
+// It cannot join a database transaction nor survive restarts.
+type MemoryOutbox struct {
+	mu     sync.Mutex
+	events []OutboxEvent
+}
+
+// NewMemoryOutbox creates an empty MemoryOutbox
+func NewMemoryOutbox() *MemoryOutbox {
+	return &MemoryOutbox{}
+}
+
+func (o *MemoryOutbox) Save(ctx context.Context, events []OutboxEvent) error {
+	o.mu.Lock()
+	o.events = append(o.events, events...)
+	o.mu.Unlock()
+	return nil
+}
+
+func (o *MemoryOutbox) Pending(ctx context.Context) ([]OutboxEvent, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]OutboxEvent(nil), o.events...), nil
+}
+
+func (o *MemoryOutbox) Delivered(ctx context.Context, ids []string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	kept := o.events[:0]
+	for _, e := range o.events {
+		delivered := false
+		for _, id := range ids {
+			if e.ID == id {
+				delivered = true
+				break
+			}
+		}
+		if !delivered {
+			kept = append(kept, e)
+		}
+	}
+	o.events = kept
+	return nil
+}
@@ -0,0 +1,143 @@
+package crudp_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// txStore stages outbox events in the transaction like a database would
+type txStore struct {
+	failCommit bool
+	committed  []crudp.OutboxEvent
+	rollbacks  int
+}
+
+type txKey struct{}
+
+type stagedTx struct {
+	store  *txStore
+	staged []crudp.OutboxEvent
+}
+
+func (s *txStore) Begin(ctx context.Context) (context.Context, crudp.Tx, error) {
+	tx := &stagedTx{store: s}
+	return context.WithValue(ctx, txKey{}, tx), tx, nil
+}
+
+func (tx *stagedTx) Commit() error {
+	if tx.store.failCommit {
+		return Errf("commit failed")
+	}
+	tx.store.committed = append(tx.store.committed, tx.staged...)
+	return nil
+}
+
+func (tx *stagedTx) Rollback() error {
+	tx.store.rollbacks++
+	return nil
+}
+
+func (s *txStore) Save(ctx context.Context, events []crudp.OutboxEvent) error {
+	tx := ctx.Value(txKey{}).(*stagedTx)
+	tx.staged = append(tx.staged, events...)
+	return nil
+}
+
+func (s *txStore) Pending(ctx context.Context) ([]crudp.OutboxEvent, error) {
+	return s.committed, nil
+}
+
+func (s *txStore) Delivered(ctx context.Context, ids []string) error {
+	s.committed = nil
+	return nil
+}
+
+// partialHandler broadcasts once and then fails
+type partialHandler struct{}
+
+type failedResponse struct{}
+
+func (failedResponse) Response() (any, []string, error) { return nil, nil, Errf("second write failed") }
+
+func (h *partialHandler) Create(ctx context.Context, data ...any) any {
+	return []crudp.Response{sseResponse{Message: "first"}, failedResponse{}}
+}
+
+func OutboxShared(t *testing.T) {
+	newCP := func(store *txStore) (*crudp.CrudP, func() []crudp.Event) {
+		cfg := crudp.DefaultConfig()
+		cfg.Outbox = store
+		cfg.Transactor = store
+		cp := crudp.New(cfg, crudp.WithHandlers(&sseHandler{}, &partialHandler{}))
+		var mu sync.Mutex
+		var events []crudp.Event
+		cp.Listen(func(ev crudp.Event) {
+			mu.Lock()
+			events = append(events, ev)
+			mu.Unlock()
+		})
+		return cp, func() []crudp.Event {
+			mu.Lock()
+			defer mu.Unlock()
+			return events
+		}
+	}
+
+	t.Run("Delivered After Commit", func(t *testing.T) {
+		store := &txStore{}
+		cp, events := newCP(store)
+		if pr := processOne(t, cp, crudp.Packet{Action: 'c', HandlerID: 0}); pr.MessageType != uint8(Msg.Success) {
+			t.Fatalf("unexpected result %q", pr.Message)
+		}
+		if got := events(); len(got) != 2 || got[0].Channel != "channel1" {
+			t.Errorf("expected 2 delivered events, got %+v", got)
+		}
+		if len(store.committed) != 0 {
+			t.Errorf("delivered events still pending: %d", len(store.committed))
+		}
+	})
+
+	t.Run("Failed Commit Discards Events", func(t *testing.T) {
+		store := &txStore{failCommit: true}
+		cp, events := newCP(store)
+		if pr := processOne(t, cp, crudp.Packet{Action: 'c', HandlerID: 0}); pr.MessageType != uint8(Msg.Error) {
+			t.Fatalf("expected commit error, got %q", pr.Message)
+		}
+		if len(events()) != 0 || len(store.committed) != 0 {
+			t.Errorf("events of a rolled-back mutation leaked: %d", len(events()))
+		}
+	})
+
+	t.Run("Failed Packet Rolls Back", func(t *testing.T) {
+		store := &txStore{}
+		cp, events := newCP(store)
+		if pr := processOne(t, cp, crudp.Packet{Action: 'c', HandlerID: 1}); pr.MessageType != uint8(Msg.Error) {
+			t.Fatalf("expected error, got %q", pr.Message)
+		}
+		if len(events()) != 0 || store.rollbacks != 1 {
+			t.Errorf("expected rollback without events, got %d events %d rollbacks", len(events()), store.rollbacks)
+		}
+	})
+
+	t.Run("DeliverOutbox Sends Pending Events", func(t *testing.T) {
+		outbox := crudp.NewMemoryOutbox()
+		cfg := crudp.DefaultConfig()
+		cfg.Outbox = outbox
+		cp := crudp.New(cfg)
+		var delivered []crudp.Event
+		cp.Listen(func(ev crudp.Event) { delivered = append(delivered, ev) })
+
+		outbox.Save(context.Background(), []crudp.OutboxEvent{{ID: "1", Event: crudp.Event{Channel: "patient:42"}}})
+		n, err := cp.DeliverOutbox(context.Background())
+		if err != nil || n != 1 || len(delivered) != 1 {
+			t.Fatalf("DeliverOutbox: %d %v, %d delivered", n, err, len(delivered))
+		}
+		if pending, _ := outbox.Pending(context.Background()); len(pending) != 0 {
+			t.Errorf("event still pending after delivery")
+		}
+	})
+}
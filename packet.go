@@ -3,6 +3,7 @@ package crudp
 import (
 	"context"
 	"reflect"
+	"time"
 
 	. "github.com/cdvelop/tinystring"
 )
@@ -11,8 +12,21 @@ import (
 type Packet struct {
 	Action    byte     `json:"action"`
 	HandlerID uint8    `json:"handler_id"`
+	Version   byte     `json:"version"` // Handler version, 0 = current
 	ReqID     string   `json:"req_id"`
+	Page      *Page    `json:"page"`       // Pagination request for Read, nil = none
+	DependsOn []string `json:"depends_on"` // ReqIDs processed first, see WithDependsOn
+	Refs      []Ref    `json:"refs"`       // Generated IDs set into Data items, see WithRef
 	Data      [][]byte `json:"data"`
+
+	IfNoneMatch string `json:"if_none_match"` // ETag of the last Read result, see WithIfNoneMatch
+	Deadline    int64  `json:"deadline"`      // Unix ms after which the server skips the packet, 0 = none, see WithTTL
+	Deferred    bool   `json:"deferred"`      // Run by a background job, see WithDeferred
+	ReadAfter   string `json:"read_after"`    // WriteToken a Read must reflect, see ConsistencyTokens
+
+	Attachments [][]byte `json:"attachments"` // Raw blobs, not encoded with the codec, see WithAttachments
+
+	keys []string // Entity keys of Data items, client side only, see Keyer
 }
 
 // BatchRequest is what is sent in the POST /sync
@@ -23,33 +37,90 @@ type BatchRequest struct {
 // BatchResponse is what is received by SSE
 type BatchResponse struct {
 	Results []PacketResult `json:"results"`
+
+	// Continuation is set when Config.MaxResponseBytes cut the results; the
+	// rest is fetched with an ActionContinue packet. "" = complete
+	Continuation string `json:"continuation"`
 }
 
 type PacketResult struct {
-	Packet             // Embed Packet complete for symmetry with BatchRequest
-	MessageType uint8  `json:"message_type"` // tinystring.MessageType (0=Normal, 1=Info, 2=Error, 3=Warning, 4=Success)
-	Message     string `json:"message"`      // Message for the user
+	Packet                   // Embed Packet complete for symmetry with BatchRequest
+	MessageType uint8        `json:"message_type"` // tinystring.MessageType (0=Normal, 1=Info, 2=Error, 3=Warning, 4=Success)
+	Message     string       `json:"message"`      // Message for the user
+	RetryAfter  int          `json:"retry_after"`  // Milliseconds to wait when throttled, 0 = not throttled
+	PageInfo    *PageInfo    `json:"page_info"`    // Set for paged Read results
+	Items       []ItemResult `json:"items"`        // Per-item outcomes, set by handlers returning BulkResult
+	IDs         []IDMapping  `json:"ids"`          // Temporary → generated IDs, set by handlers returning IDResult
+	Redirect    string       `json:"redirect"`     // Server to retry the packet on, set by read-only replicas
+	Code        string       `json:"code"`         // Machine-readable error code, e.g. CodeTimeout; "" = none
+	ETag        string       `json:"etag"`         // Fingerprint of a Read result, see WithIfNoneMatch
+	MessageKey  string       `json:"message_key"`  // Catalog key of Message, see RegisterMessages; "" = none
+	MessageArgs []string     `json:"message_args"` // Values of the verbs of the MessageKey text
+	JobID       string       `json:"job_id"`       // Job running a deferred packet, see WithDeferred
+	WriteToken  string       `json:"write_token"`  // Consistency token of a mutation, see ConsistencyTokens
 }
 
+// PacketResult.Code values
+const (
+	CodeTimeout     = "timeout"      // Handler or batch deadline exceeded
+	CodeCanceled    = "canceled"     // Client aborted the request
+	CodeMaintenance = "maintenance"  // Server in maintenance mode, see SetMaintenance
+	CodeNotModified = "not_modified" // Read data matches WithIfNoneMatch, sent without Data
+	CodeChunkOrder  = "chunk_order"  // Chunk sent out of sequence, see ExpectedChunk
+	CodeDecode      = "decode_error" // The batch could not be decoded; the only result, with no ReqID
+	CodeDeferred    = "deferred"     // Accepted as a job; the final result arrives on JobChannel
+	CodeConflict    = "conflict"     // Stale VersionedEntity, see IsConflict and ConflictError
+
+	// Config.Sagas outcomes
+	CodeAborted            = "aborted"             // Skipped after an earlier packet failed
+	CodeCompensated        = "compensated"         // Succeeded, then undone by its Compensator
+	CodeCompensationFailed = "compensation_failed" // Succeeded, and Compensate returned an error
+)
+
 // EncodePacket encodes a packet for a known handler using this CrudP's codec instance
+// CallOption values (e.g. WithCodec) may be mixed into data and are not encoded
 func (cp *CrudP) EncodePacket(action byte, handlerID uint8, reqID string, data ...any) ([]byte, error) {
-	encoded := make([][]byte, 0, len(data))
+	data, opts := splitCallOptions(data)
+	co := cp.newCallOptions(opts)
+	if reqID == "" {
+		reqID = co.idempotencyKey
+	}
+	if reqID == "" {
+		reqID = cp.nextReqID()
+	}
+
+	// Item encodings share a pooled buffer: only the final packet encoding escapes
+	buf, encoded := getBuf(), getData()
+	defer putBuf(buf)
+	defer putData(encoded)
+
 	for _, item := range data {
-		bytes, err := cp.codec.Encode(item)
-		if err != nil {
+		start := len(*buf)
+		var err error
+		if *buf, err = encodeTo(co.codec, *buf, item); err != nil {
 			return nil, err
 		}
-		encoded = append(encoded, bytes)
+		*encoded = append(*encoded, (*buf)[start:len(*buf):len(*buf)])
 	}
 
 	packet := Packet{
 		Action:    action,
 		HandlerID: handlerID,
+		Version:   co.version,
 		ReqID:     reqID,
-		Data:      encoded,
+		Page:      co.page,
+		DependsOn: co.dependsOn,
+		Refs:      co.refs,
+		Data:      *encoded,
+
+		Attachments: co.attachments,
+		IfNoneMatch: co.ifNoneMatch,
+		Deadline:    deadlineIn(co.ttl),
+		Deferred:    co.deferred,
+		ReadAfter:   cp.readAfter(&co, action, handlerID),
 	}
 
-	return cp.codec.Encode(packet)
+	return co.codec.Encode(packet)
 }
 
 // DecodePacket decodes a packet using this CrudP's codec instance
@@ -66,78 +137,347 @@ func (cp *CrudP) DecodeData(packet *Packet, index int, target any) error {
 }
 
 // ProcessBatch automatically processes a batch of packets and returns batch results
-func (cp *CrudP) ProcessBatch(ctx context.Context, requestBytes []byte) ([]byte, error) {
-	cp.log("ProcessBatch called with bytes:", len(requestBytes))
-	var batchReq BatchRequest
-	if err := cp.codec.Decode(requestBytes, &batchReq); err != nil {
-		cp.log("ProcessBatch decode error:", err)
-		return cp.createErrorBatchResponse("decode_error", err)
+func (cp *CrudP) ProcessBatch(ctx context.Context, requestBytes []byte, opts ...CallOption) ([]byte, error) {
+	response, err := cp.processBatch(ctx, requestBytes, opts)
+	cp.record(requestBytes, response)
+	return response, err
+}
+
+func (cp *CrudP) processBatch(ctx context.Context, requestBytes []byte, opts []CallOption) ([]byte, error) {
+	co := cp.newCallOptions(opts)
+	ctx = cp.withClientKey(cp.withTenant(ctx))
+	if co.idempotencyKey != "" {
+		// Keys are per client: another user must never get this response
+		co.idempotencyKey = tenantScoped(ctx, ClientKey(ctx)+"|"+co.idempotencyKey)
+		cached, ok, err := cp.idem.reserve(ctx, co.idempotencyKey)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			cp.log.Debug("ProcessBatch idempotent replay", "key", co.idempotencyKey)
+			return cached, nil
+		}
+		defer cp.idem.release(co.idempotencyKey) // No-op once runBatch put the response
+	}
+	if co.chunk != nil {
+		return cp.processChunk(ctx, requestBytes, co)
 	}
+	return cp.runBatch(ctx, requestBytes, co)
+}
 
-	cp.log("ProcessBatch decoded packets:", len(batchReq.Packets))
+// runBatch decodes and processes one batch with the resolved call options
+func (cp *CrudP) runBatch(ctx context.Context, requestBytes []byte, co callOptions) ([]byte, error) {
+	ctx, cancel := co.context(ctx)
+	defer cancel()
+
+	cp.log.Debug("ProcessBatch", "bytes", len(requestBytes))
+	batchReq := getBatch()
+	defer putBatch(batchReq)
+	if err := co.codec.Decode(requestBytes, batchReq); err != nil {
+		cp.log.Warn("ProcessBatch decode failed", "error", err)
+		co.chunk.reject()
+		return cp.createErrorBatchResponse(ctx, co.codec, err)
+	}
 
-	results := make([]PacketResult, 0, len(batchReq.Packets))
+	cp.log.Debug("ProcessBatch decoded", "packets", len(batchReq.Packets))
 
-	for _, packet := range batchReq.Packets {
-		result, err := cp.processSinglePacket(ctx, &packet)
-		results = append(results, result)
-		if err != nil {
-			// Continue processing other packets even if one fails
-			continue
+	if len(batchReq.Packets) == 1 && batchReq.Packets[0].Action == ActionContinue {
+		return cp.continueResponse(ctx, co.codec, &batchReq.Packets[0])
+	}
+
+	// Not cached for idempotency: the batch runs once maintenance is over
+	if on, message := cp.Maintenance(); on {
+		co.chunk.reject()
+		return cp.maintenanceResponse(co.codec, batchReq, message)
+	}
+
+	results := getResults()
+	defer putResults(results)
+
+	// Results keep the batch order even when dependencies reorder processing
+	packets := batchReq.Packets
+	for range packets {
+		*results = append(*results, PacketResult{})
+	}
+	deps := newBatchDeps(packets)
+	skipped := 0
+	followUps := &dispatchBatch{cp: cp, co: &co}
+	var sg *saga
+	if cp.config.Sagas {
+		sg = &saga{}
+	}
+
+	now := time.Now()
+	for i := range packets {
+		idx := deps.at(i)
+		packet := &packets[idx]
+
+		var start time.Time
+		if cp.config.Auditor != nil {
+			start = time.Now()
+		}
+
+		// Failed packets don't stop the batch
+		var result PacketResult
+		var cause error // Why the packet failed before its handler ran, for OnError
+		translate := true
+		if err := ctx.Err(); err != nil { // Client gone or batch deadline passed
+			result, cause = canceledResult(packet, err), err
+			skipped++
+		} else if packet.expired(now) {
+			result = expiredResult(packet)
+		} else if sg != nil && sg.failed {
+			result, cause = sg.abortedResult(packet)
+		} else if dep := co.chunk.failedDep(packet); dep != "" {
+			cause = LocErr(msgDependencyFailed, dep)
+			result = errorResult(packet, cause)
+		} else if pctx, err := cp.prepareDeps(ctx, co.codec, deps, packets, *results, idx); err != nil {
+			result, cause = errorResult(packet, err), err
+		} else if ack, ok := cp.deferPacket(pctx, &co, packet); ok {
+			result = ack
+		} else {
+			pctx, stop := cp.running.track(pctx, packet)
+			result, _ = cp.processSinglePacket(followUps.with(pctx, packet, 0), &co, packet)
+			translate = false // processSinglePacket ran the OnError hooks
+			if stop() {
+				result, cause, translate = canceledResult(packet, context.Canceled), context.Canceled, true
+			}
+			followUps.settle(packet, &result)
+		}
+		if translate {
+			cp.translateError(ctx, packet, &result, cause)
 		}
+
+		if cp.config.Auditor != nil {
+			cp.audit(ctx, packet, &result, start)
+		}
+		(*results)[idx] = result
+		co.chunk.track(packet, &result)
+		if sg != nil && !sg.failed {
+			sg.track(idx, packet, &result)
+		}
+	}
+	if sg != nil && sg.failed {
+		cp.compensate(ctx, &co, sg, *results)
 	}
+	if skipped > 0 {
+		cp.log.Warn("ProcessBatch stopped", "skipped", skipped, "error", ctx.Err())
+	}
+
+	// Follow-up packets emitted through a Dispatcher come after the batch
+	*results = append(*results, followUps.close()...)
 
 	batchResp := BatchResponse{
-		Results: results,
+		Results: *results,
+	}
+
+	response, err := co.codec.Encode(batchResp)
+	if err == nil && cp.config.MaxResponseBytes > 0 && len(response) > cp.config.MaxResponseBytes {
+		response, err = cp.budgetResponse(ctx, co.codec, nil, *results)
+	}
+	if err == nil && co.idempotencyKey != "" && ctx.Err() == nil { // Aborted batches run again on retry
+		cp.idem.put(co.idempotencyKey, response)
+	}
+	return response, err
+}
+
+func (cp *CrudP) processSinglePacket(ctx context.Context, co *callOptions, packet *Packet) (PacketResult, error) {
+	pr, err := cp.runPacket(ctx, co, packet)
+	if err != nil {
+		cp.translateError(ctx, packet, &pr, err)
+	}
+	return pr, err
+}
+
+// runPacket answers a packet before OnError hooks translate its error
+func (cp *CrudP) runPacket(ctx context.Context, co *callOptions, packet *Packet) (PacketResult, error) {
+	if packet.Action == ActionHandshake {
+		return cp.processHandshake(co.codec, packet)
+	}
+	if packet.Action == ActionCancel {
+		return cp.processCancel(ctx, packet), nil
+	}
+
+	handler, err := cp.resolve(packet.HandlerID, packet.Version)
+	if err != nil {
+		return errorResult(packet, err), err
 	}
 
-	return cp.codec.Encode(batchResp)
+	if pr, err := cp.checkReadOnly(packet); err != nil {
+		return pr, err
+	}
+
+	if pr, err := cp.checkActionPolicy(handler, packet); err != nil {
+		return pr, err
+	}
+
+	if pr, err := cp.checkRateLimit(ctx, packet); err != nil {
+		return pr, err
+	}
+
+	if pr, err := cp.checkCircuit(handler, packet); err != nil {
+		return pr, err
+	}
+
+	next := func(ctx context.Context, packet *Packet) (PacketResult, error) {
+		ctx, pr, err := cp.awaitReadAfter(ctx, handler, packet)
+		if err != nil {
+			return pr, err
+		}
+		pr, err = cp.dispatchCached(ctx, co, handler, packet)
+		tagRead(packet, &pr)
+		if err == nil {
+			cp.stampWriteToken(ctx, handler, packet, &pr)
+		}
+		return pr, err
+	}
+
+	if cp.config.Outbox != nil {
+		return cp.withOutbox(ctx, packet, func(ctx context.Context) (PacketResult, error) {
+			return cp.wrapPacketHandler(handler, next)(ctx, packet)
+		})
+	}
+	return cp.wrapPacketHandler(handler, next)(ctx, packet)
+}
+
+// errorResult builds an error PacketResult echoing the packet
+func errorResult(packet *Packet, err error) PacketResult {
+	return PacketResult{
+		Packet:      packet.echo(),
+		MessageType: uint8(Msg.Error),
+		Message:     err.Error(),
+	}
+}
+
+// canceledResult reports a packet skipped because the batch context ended
+func canceledResult(packet *Packet, err error) PacketResult {
+	pr := errorResult(packet, err)
+	pr.Code = CodeCanceled
+	if err == context.DeadlineExceeded {
+		pr.Code = CodeTimeout
+	}
+	return pr
 }
 
-func (cp *CrudP) processSinglePacket(ctx context.Context, packet *Packet) (PacketResult, error) {
+// dispatchPacket decodes, calls the resolved handler and encodes its result
+func (cp *CrudP) dispatchPacket(ctx context.Context, co *callOptions, handler *actionHandler, packet *Packet) (PacketResult, error) {
+	if packet.Action == ActionSync {
+		return cp.processSync(ctx, co.codec, handler, packet)
+	}
+
 	pr := PacketResult{
-		Packet: *packet, // Embed original packet (includes Data [][]byte)
+		Packet: packet.echo(), // Embed original packet (includes Data [][]byte)
+	}
+
+	// Patch: Data[0] is the field mask, passed through ctx
+	payload := packet
+	if packet.Action == ActionPatch {
+		var err error
+		if ctx, payload, err = splitPatch(ctx, co.codec, packet); err != nil {
+			pr.MessageType = uint8(Msg.Error)
+			pr.Message = err.Error()
+			return pr, err
+		}
 	}
 
 	// Decode data with known types
-	decodedData, err := cp.decodeWithKnownType(packet, packet.HandlerID)
+	decodedData, err := cp.decodeWithKnownType(co.codec, payload, handler)
 	if err != nil {
 		pr.MessageType = uint8(Msg.Error)
 		pr.Message = err.Error()
 		return pr, err
 	}
 
+	// Generated IDs of the packets referenced by Refs
+	if err := applyRefs(ctx, decodedData); err != nil {
+		pr.MessageType = uint8(Msg.Error)
+		pr.Message = err.Error()
+		return pr, err
+	}
+
+	// Optimistic concurrency for versioned entities
+	if err := checkVersions(ctx, handler, packet.Action, decodedData); err != nil {
+		cp.log.Warn("version check failed", "handler", handler.name, "action", string(packet.Action), "error", err)
+		pr.MessageType = uint8(Msg.Error)
+		pr.Message = err.Error()
+		conflictCode(&pr, err)
+		return pr, err
+	}
+
 	// Call handler
-	result, err := cp.CallHandler(ctx, packet.HandlerID, packet.Action, decodedData...)
+	start := time.Now()
+	result, err := cp.callAction(withAttachments(withPage(ctx, packet), packet), handler, packet.Action, decodedData...)
 	if err != nil {
-		cp.log("processSinglePacket CallHandler error:", err)
+		if timedOut(ctx, err) { // Validation errors say nothing about the handler health
+			cp.recordCall(handler, time.Since(start), true)
+			pr.Code = CodeTimeout
+		} else if ctx.Err() == context.Canceled {
+			pr.Code = CodeCanceled
+		} else {
+			conflictCode(&pr, err)
+		}
+		cp.log.Error("handler failed", "handler", handler.name, "action", string(packet.Action), "error", err)
 		pr.MessageType = uint8(Msg.Error)
 		pr.Message = err.Error()
 		return pr, err
 	}
 
-	cp.log("processSinglePacket CallHandler success, result type:", reflect.TypeOf(result))
+	cp.log.Debug("handler succeeded", "handler", handler.name, "action", string(packet.Action), "result", reflect.TypeOf(result))
 
 	// Process result - can be multiple Response
-	if err := cp.encodeResultToPacket(&pr, result); err != nil {
+	err = cp.encodeResultToPacket(ctx, co.codec, &pr, result)
+	cp.recordCall(handler, time.Since(start), err != nil || timedOut(ctx, nil))
+	if err != nil {
 		pr.MessageType = uint8(Msg.Error)
 		pr.Message = err.Error()
+		conflictCode(&pr, err)
 		return pr, err
 	}
 
+	cp.recordResult(ctx, &pr)
+	cp.sinkMutation(ctx, handler, &pr)
+
 	pr.MessageType = uint8(Msg.Success)
 	pr.Message = "OK"
+	if len(pr.Items) > 0 {
+		bulkStatus(&pr)
+	}
 	return pr, nil
 }
 
 // encodeResultToPacket encodes handler result to Data [][]byte
-func (cp *CrudP) encodeResultToPacket(pr *PacketResult, result any) error {
+func (cp *CrudP) encodeResultToPacket(ctx context.Context, codec Codec, pr *PacketResult, result any) error {
 	if result == nil {
 		return nil
 	}
 
+	// Paged Read: report page info and encode the items
+	if page, ok := result.(PageResult); ok {
+		info := page.Info
+		pr.PageInfo = &info
+		return cp.encodeResultToPacket(ctx, codec, pr, page.Items)
+	}
+
+	// Bulk: report per-item outcomes and encode the data
+	if bulk, ok := result.(BulkResult); ok {
+		pr.Items = bulk.Items
+		return cp.encodeResultToPacket(ctx, codec, pr, bulk.Data)
+	}
+
+	// Blobs: sent raw next to the encoded data
+	if attached, ok := result.(AttachmentResult); ok {
+		pr.Attachments = attached.Attachments
+		return cp.encodeResultToPacket(ctx, codec, pr, attached.Data)
+	}
+
+	// Generated IDs: report the mapping and encode the data
+	if mapped, ok := result.(IDResult); ok {
+		pr.IDs = mapped.IDs
+		return cp.encodeResultToPacket(ctx, codec, pr, mapped.Data)
+	}
+
 	// Case 1: Slice of Response for multiple broadcast
-	cp.log("encodeResultToPacket result type:", reflect.TypeOf(result).String())
+	cp.log.Debug("encodeResultToPacket", "result", reflect.TypeOf(result).String())
 	if responses, ok := result.([]Response); ok {
 		pr.Data = make([][]byte, 0, len(responses))
 		for _, resp := range responses {
@@ -148,10 +488,10 @@ func (cp *CrudP) encodeResultToPacket(pr *PacketResult, result any) error {
 
 			// SSE routing if broadcast targets exist
 			if len(broadcast) > 0 {
-				cp.routeToSSE(data, broadcast, pr.HandlerID)
+				cp.routeToSSE(ctx, data, broadcast, pr.HandlerID)
 			}
 
-			encoded, err := cp.codec.Encode(data)
+			encoded, err := codec.Encode(data)
 			if err != nil {
 				return err
 			}
@@ -168,10 +508,10 @@ func (cp *CrudP) encodeResultToPacket(pr *PacketResult, result any) error {
 		}
 
 		if len(broadcast) > 0 {
-			cp.routeToSSE(data, broadcast, pr.HandlerID)
+			cp.routeToSSE(ctx, data, broadcast, pr.HandlerID)
 		}
 
-		encoded, err := cp.codec.Encode(data)
+		encoded, err := codec.Encode(data)
 		if err != nil {
 			return err
 		}
@@ -180,7 +520,7 @@ func (cp *CrudP) encodeResultToPacket(pr *PacketResult, result any) error {
 	}
 
 	// Case 3: Direct value
-	encoded, err := cp.codec.Encode(result)
+	encoded, err := codec.Encode(result)
 	if err != nil {
 		return err
 	}
@@ -188,14 +528,18 @@ func (cp *CrudP) encodeResultToPacket(pr *PacketResult, result any) error {
 	return nil
 }
 
-func (cp *CrudP) createErrorBatchResponse(reqID string, err error) ([]byte, error) {
+// createErrorBatchResponse answers a batch that could not be decoded
+// Its packets and ReqIDs are unknown, so ReqID stays empty and Code tells the
+// client to fail every packet of the batch (see ReceiveBatch).
+func (cp *CrudP) createErrorBatchResponse(ctx context.Context, codec Codec, err error) ([]byte, error) {
 	result := PacketResult{
-		Packet:      Packet{ReqID: reqID},
 		MessageType: uint8(Msg.Error),
 		Message:     err.Error(),
+		Code:        CodeDecode,
 	}
+	cp.translateError(ctx, nil, &result, err)
 
-	return cp.codec.Encode(BatchResponse{Results: []PacketResult{result}})
+	return codec.Encode(BatchResponse{Results: []PacketResult{result}})
 }
 
 // ProcessPacket processes a single packet (for backward compatibility)
@@ -235,7 +579,9 @@ func (cp *CrudP) ProcessPacket(ctx context.Context, requestBytes []byte) ([]byte
 	responsePacket := Packet{
 		Action:    packet.Action,
 		HandlerID: packet.HandlerID,
+		Version:   packet.Version,
 		ReqID:     result.ReqID,
+		Page:      packet.Page,
 		Data:      result.Data,
 	}
 
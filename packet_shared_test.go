@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cdvelop/crudp"
 	. "github.com/cdvelop/tinystring"
@@ -154,13 +155,157 @@ func SSERoutingShared(t *testing.T, cp *crudp.CrudP) {
 
 	// Verify log output
 	logOutput := buf.String()
-	if !strings.Contains(logOutput, "Broadcasting to channel: channel1") {
-		t.Error("Expected log output to contain 'Broadcasting to channel: channel1'")
+	if !strings.Contains(logOutput, "channel: channel1") {
+		t.Error("Expected log output to contain 'channel: channel1'")
 	}
-	if !strings.Contains(logOutput, "Broadcasting to channel: channel2") {
-		t.Error("Expected log output to contain 'Broadcasting to channel: channel2'")
+	if !strings.Contains(logOutput, "channel: channel2") {
+		t.Error("Expected log output to contain 'channel: channel2'")
 	}
 	if !strings.Contains(logOutput, `data: {"message":"broadcast"}`) {
 		t.Errorf("Expected log output to contain 'data: {\"message\":\"broadcast\"}', got:\n%s", logOutput)
 	}
 }
+
+// Counts calls and reports whether ctx carried a deadline
+type countingHandler struct {
+	calls       int
+	hadDeadline bool
+}
+
+func (h *countingHandler) Create(ctx context.Context, data ...any) any {
+	h.calls++
+	_, h.hadDeadline = ctx.Deadline()
+	return h.calls
+}
+
+// blockingHandler holds Create until release is closed
+type blockingHandler struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (h *blockingHandler) Create(ctx context.Context, data ...any) any {
+	h.started <- struct{}{}
+	<-h.release
+	return "done"
+}
+
+func CallOptionsShared(t *testing.T) {
+	t.Run("EncodePacket IdempotencyKey As ReqID", func(t *testing.T) {
+		cp := crudp.NewDefault()
+
+		encoded, err := cp.EncodePacket('c', 0, "", &User{Name: "A"}, crudp.WithIdempotencyKey("idem-1"), crudp.WithCodec(cp.Codec()))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var packet crudp.Packet
+		if err := cp.DecodePacket(encoded, &packet); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if packet.ReqID != "idem-1" {
+			t.Errorf("expected ReqID 'idem-1', got '%s'", packet.ReqID)
+		}
+		if len(packet.Data) != 1 {
+			t.Errorf("options must not be encoded as data, got %d items", len(packet.Data))
+		}
+	})
+
+	t.Run("ProcessBatch IdempotencyKey Replays", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		h := &countingHandler{}
+		cp.RegisterHandler(h)
+
+		batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'c', ReqID: "r1"}}})
+
+		first, err := cp.ProcessBatch(context.Background(), batch, crudp.WithIdempotencyKey("k1"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		second, err := cp.ProcessBatch(context.Background(), batch, crudp.WithIdempotencyKey("k1"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if h.calls != 1 {
+			t.Errorf("expected handler called once, got %d", h.calls)
+		}
+		if !bytes.Equal(first, second) {
+			t.Error("expected cached response for repeated key")
+		}
+	})
+
+	t.Run("ProcessBatch IdempotencyKey Per User", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.UserProvider = userFromCtx{}
+		cp := crudp.New(cfg)
+		h := &countingHandler{}
+		cp.RegisterHandler(h)
+
+		batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'c', ReqID: "r1"}}})
+		for _, user := range []string{"alice", "bob", "alice"} {
+			ctx := context.WithValue(context.Background(), userKey{}, user)
+			if _, err := cp.ProcessBatch(ctx, batch, crudp.WithIdempotencyKey("k1")); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if h.calls != 2 {
+			t.Errorf("expected one call per user, got %d", h.calls)
+		}
+	})
+
+	t.Run("ProcessBatch IdempotencyKey Waits In Flight", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		h := &blockingHandler{started: make(chan struct{}, 2), release: make(chan struct{})}
+		cp.RegisterHandler(h)
+
+		batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'c', ReqID: "r1"}}})
+		responses := make(chan []byte, 2)
+		for range 2 {
+			go func() {
+				response, _ := cp.ProcessBatch(context.Background(), batch, crudp.WithIdempotencyKey("k1"))
+				responses <- response
+			}()
+		}
+		<-h.started
+		select {
+		case <-h.started:
+			t.Fatal("the repeated key ran its batch while the first was in flight")
+		case <-time.After(20 * time.Millisecond):
+		}
+		close(h.release)
+		if first, second := <-responses, <-responses; !bytes.Equal(first, second) {
+			t.Error("expected the waiting batch to get the first response")
+		}
+	})
+
+	t.Run("ProcessBatch Timeout Sets Deadline", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		h := &countingHandler{}
+		cp.RegisterHandler(h)
+
+		batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'c'}}})
+		if _, err := cp.ProcessBatch(context.Background(), batch, crudp.WithTimeout(1000)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !h.hadDeadline {
+			t.Error("expected handler context to carry a deadline")
+		}
+	})
+
+	t.Run("EnqueuePacket High Priority Flushes", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.BatchWindow = 5000
+		cp := crudp.New(cfg)
+
+		flushed := false
+		cp.Broker().SetOnFlush(func([]byte) { flushed = true })
+
+		if err := cp.EnqueuePacket(0, 'c', "r1", "data", crudp.WithPriority(crudp.PriorityHigh)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !flushed {
+			t.Error("expected immediate flush for high priority")
+		}
+	})
+}
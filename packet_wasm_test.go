@@ -17,6 +17,10 @@ func TestPacketResult_WASM(t *testing.T) {
 		ActionConversionShared(t)
 	})
 
+	t.Run("CallOptions", func(t *testing.T) {
+		CallOptionsShared(t)
+	})
+
 	t.Run("SSERouting", func(t *testing.T) {
 		SSERoutingShared(t, cp)
 	})
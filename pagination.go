@@ -0,0 +1,56 @@
+package crudp
+
+import "context"
+
+// Page is the pagination request carried in Packet.Page
+// Use Offset/Limit for numbered pages or Cursor for infinite scrolling.
+// Limit 0 lets the handler pick its default.
+type Page struct {
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"`
+	Cursor string `json:"cursor"`
+}
+
+// PageInfo describes the page returned in PacketResult.PageInfo
+type PageInfo struct {
+	Total      int    `json:"total"`       // Total items, -1 if unknown
+	NextCursor string `json:"next_cursor"` // Cursor for the next page, "" if none
+	HasMore    bool   `json:"has_more"`
+}
+
+// Paginator is implemented by handlers returning paged Read results (optional)
+// When implemented, ReadPage is called instead of Read for 'r' packets.
+type Paginator interface {
+	ReadPage(ctx context.Context, page Page, data ...any) (items any, info PageInfo)
+}
+
+// PageResult is a Read result with pagination info
+// Returned by CallHandler for Paginator handlers; Read may also return it directly.
+type PageResult struct {
+	Items any
+	Info  PageInfo
+}
+
+type pageKey struct{}
+
+// WithPage requests a page per call (EncodePacket/EnqueuePacket)
+// Paged packets are never consolidated by the broker.
+func WithPage(page Page) CallOption {
+	return callOptionFunc(func(co *callOptions) {
+		co.page = &page
+	})
+}
+
+// PageFrom returns the page requested by the packet being processed
+func PageFrom(ctx context.Context) (Page, bool) {
+	page, ok := ctx.Value(pageKey{}).(Page)
+	return page, ok
+}
+
+// withPage exposes packet.Page to handlers through ctx
+func withPage(ctx context.Context, packet *Packet) context.Context {
+	if packet.Page == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, pageKey{}, *packet.Page)
+}
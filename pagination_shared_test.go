@@ -0,0 +1,86 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// pagedUsers serves a fixed list with cursor = next offset
+type pagedUsers struct {
+	names []string
+}
+
+func (h *pagedUsers) ReadPage(ctx context.Context, page crudp.Page, data ...any) (any, crudp.PageInfo) {
+	limit := page.Limit
+	if limit == 0 {
+		limit = 10
+	}
+	start := page.Offset
+	end := start + limit
+	if end > len(h.names) {
+		end = len(h.names)
+	}
+
+	info := crudp.PageInfo{Total: len(h.names), HasMore: end < len(h.names)}
+	if info.HasMore {
+		info.NextCursor = Fmt("%d", end)
+	}
+	return h.names[start:end], info
+}
+
+func PaginationShared(t *testing.T) {
+	t.Run("Read Page With Info", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		cp.RegisterHandler(&pagedUsers{names: []string{"a", "b", "c", "d", "e"}})
+
+		result := processOne(t, cp, crudp.Packet{Action: 'r', ReqID: "p1", Page: &crudp.Page{Offset: 2, Limit: 2}})
+		if result.MessageType != uint8(Msg.Success) {
+			t.Fatalf("expected success, got %s", result.Message)
+		}
+		if result.PageInfo == nil {
+			t.Fatal("expected PageInfo in result")
+		}
+		if result.PageInfo.Total != 5 || !result.PageInfo.HasMore || result.PageInfo.NextCursor != "4" {
+			t.Errorf("unexpected page info: %+v", *result.PageInfo)
+		}
+
+		var items []string
+		if err := cp.Codec().Decode(result.Data[0], &items); err != nil {
+			t.Fatalf("decode items: %v", err)
+		}
+		if len(items) != 2 || items[0] != "c" || items[1] != "d" {
+			t.Errorf("unexpected items: %v", items)
+		}
+	})
+
+	t.Run("Default Page Without Request", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		cp.RegisterHandler(&pagedUsers{names: []string{"a", "b"}})
+
+		result := processOne(t, cp, crudp.Packet{Action: 'r'})
+		if result.PageInfo == nil || result.PageInfo.HasMore || result.PageInfo.Total != 2 {
+			t.Errorf("unexpected page info: %+v", result.PageInfo)
+		}
+	})
+
+	t.Run("EncodePacket With Page", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		encoded, err := cp.EncodePacket('r', 0, "p2", crudp.WithPage(crudp.Page{Cursor: "abc", Limit: 20}))
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		var packet crudp.Packet
+		if err := cp.DecodePacket(encoded, &packet); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if packet.Page == nil || packet.Page.Cursor != "abc" || packet.Page.Limit != 20 {
+			t.Errorf("expected page in packet, got %+v", packet.Page)
+		}
+		if len(packet.Data) != 0 {
+			t.Errorf("page option must not be encoded as data, got %d items", len(packet.Data))
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package crudp
+
+import (
+	"context"
+	"reflect"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// ActionPatch is a partial update: Data[0] is the FieldMask, Data[1] the entity
+// Only the fields listed in the mask are meant to be written.
+const ActionPatch byte = 'p'
+
+// FieldMask lists the exported field names changed by a patch
+type FieldMask struct {
+	Fields []string `json:"fields"`
+}
+
+// Has reports whether field is part of the mask
+func (m FieldMask) Has(field string) bool {
+	for _, f := range m.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply copies the masked fields from src into dst (pointers to the same struct type)
+// Example: mask.Apply(stored, patch) before saving stored.
+func (m FieldMask) Apply(dst, src any) error {
+	dv, sv := structValue(dst), structValue(src)
+	if !dv.IsValid() || !sv.IsValid() || !dv.CanSet() || dv.Type() != sv.Type() {
+		return Errf("field mask: dst and src must be pointers to the same struct type")
+	}
+	for _, name := range m.Fields {
+		f := dv.FieldByName(name)
+		if !f.IsValid() || !f.CanSet() {
+			return Err(Fmt("field mask: unknown field %s", name))
+		}
+		f.Set(sv.FieldByName(name))
+	}
+	return nil
+}
+
+// Patcher receives partial updates (optional)
+// Handlers without Patch get 'p' packets in Update, with the mask in FieldMaskFrom(ctx).
+type Patcher interface {
+	Patch(ctx context.Context, mask FieldMask, data ...any) any
+}
+
+// DiffFields returns the mask of exported fields that differ between old and new
+// Both must be structs (or pointers to structs) of the same type, otherwise the mask is empty.
+func DiffFields(old, new any) FieldMask {
+	ov, nv := structValue(old), structValue(new)
+	if !ov.IsValid() || !nv.IsValid() || ov.Type() != nv.Type() {
+		return FieldMask{}
+	}
+
+	var mask FieldMask
+	t := nv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath != "" {
+			continue // Unexported fields are not encoded
+		}
+		if !reflect.DeepEqual(ov.Field(i).Interface(), nv.Field(i).Interface()) {
+			mask.Fields = append(mask.Fields, t.Field(i).Name)
+		}
+	}
+	return mask
+}
+
+// EnqueuePatch queues a partial update with the fields changed from old to new
+// Unchanged fields are sent as zero values. Nothing is sent if no field changed.
+func (cp *CrudP) EnqueuePatch(handlerID uint8, reqID string, old, new any, opts ...CallOption) error {
+	mask := DiffFields(old, new)
+	if len(mask.Fields) == 0 {
+		return nil
+	}
+
+	partial := reflect.New(structValue(new).Type()).Interface()
+	if err := mask.Apply(partial, new); err != nil {
+		return err
+	}
+
+	co := cp.newCallOptions(opts)
+	if reqID == "" {
+		reqID = co.idempotencyKey
+	}
+	if reqID == "" {
+		reqID = cp.nextReqID()
+	}
+
+	encodedMask, err := co.codec.Encode(mask)
+	if err != nil {
+		return err
+	}
+	encoded, err := co.codec.Encode(partial)
+	if err != nil {
+		return err
+	}
+
+	cp.broker.enqueue(Packet{
+		Action:    ActionPatch,
+		HandlerID: handlerID,
+		Version:   co.version,
+		ReqID:     reqID,
+		Deadline:  deadlineIn(co.ttl),
+	}, encodedMask, encoded)
+
+	if co.priority >= PriorityHigh {
+		cp.broker.FlushNow()
+	}
+	return nil
+}
+
+type fieldMaskKey struct{}
+
+// FieldMaskFrom returns the mask of the 'p' packet being processed
+func FieldMaskFrom(ctx context.Context) (FieldMask, bool) {
+	mask, ok := ctx.Value(fieldMaskKey{}).(FieldMask)
+	return mask, ok
+}
+
+// splitPatch decodes the mask of a 'p' packet and returns the packet without it
+func splitPatch(ctx context.Context, codec Codec, packet *Packet) (context.Context, *Packet, error) {
+	if len(packet.Data) == 0 {
+		return ctx, packet, Errf("patch without field mask")
+	}
+
+	var mask FieldMask
+	if err := codec.Decode(packet.Data[0], &mask); err != nil {
+		return ctx, packet, err
+	}
+
+	rest := *packet
+	rest.Data = packet.Data[1:]
+	return context.WithValue(ctx, fieldMaskKey{}, mask), &rest, nil
+}
+
+// structValue dereferences v down to a struct value
+func structValue(v any) reflect.Value {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return reflect.Value{}
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	return rv
+}
@@ -0,0 +1,117 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Profile applies patches to a stored copy
+type Profile struct {
+	ID    int
+	Name  string
+	Email string
+
+	stored *Profile
+}
+
+func (p *Profile) Patch(ctx context.Context, mask crudp.FieldMask, data ...any) any {
+	for _, item := range data {
+		if err := mask.Apply(p.stored, item); err != nil {
+			return err
+		}
+	}
+	return "patched"
+}
+
+// profileUpdater has no Patch and reads the mask from ctx
+type profileUpdater struct {
+	Name string
+
+	mask *crudp.FieldMask
+}
+
+func (p *profileUpdater) Update(ctx context.Context, data ...any) any {
+	if mask, ok := crudp.FieldMaskFrom(ctx); ok {
+		*p.mask = mask
+	}
+	return "updated"
+}
+
+func PatchShared(t *testing.T) {
+	t.Run("DiffFields", func(t *testing.T) {
+		old := &Profile{ID: 1, Name: "Ana", Email: "a@x.com"}
+		new := &Profile{ID: 1, Name: "Ana", Email: "ana@x.com"}
+
+		mask := crudp.DiffFields(old, new)
+		if len(mask.Fields) != 1 || mask.Fields[0] != "Email" {
+			t.Errorf("expected [Email], got %v", mask.Fields)
+		}
+		if !mask.Has("Email") || mask.Has("Name") {
+			t.Errorf("unexpected Has results for %v", mask.Fields)
+		}
+
+		if m := crudp.DiffFields(old, &User{}); len(m.Fields) != 0 {
+			t.Errorf("different types must give an empty mask, got %v", m.Fields)
+		}
+	})
+
+	t.Run("Patch Through Loopback", func(t *testing.T) {
+		stored := &Profile{ID: 7, Name: "Ana", Email: "a@x.com"}
+		server := crudp.NewDefault()
+		server.RegisterHandler(&Profile{stored: stored})
+
+		client := crudp.NewLoopback(server, crudp.WithHandlers(&Profile{}))
+		var results []crudp.PacketResult
+		client.OnResult(func(pr crudp.PacketResult) {
+			results = append(results, pr)
+		})
+
+		// Client has a stale Name: only Email must be written
+		old := Profile{ID: 7, Name: "Old", Email: "a@x.com"}
+		new := Profile{ID: 7, Name: "Old", Email: "ana@x.com"}
+		if err := client.EnqueuePatch(0, "patch-1", &old, &new); err != nil {
+			t.Fatalf("EnqueuePatch error: %v", err)
+		}
+		client.Broker().FlushNow()
+
+		if len(results) != 1 || results[0].MessageType != uint8(Msg.Success) {
+			t.Fatalf("expected 1 successful result, got %+v", results)
+		}
+		if results[0].Action != crudp.ActionPatch {
+			t.Errorf("expected action 'p', got %c", results[0].Action)
+		}
+		if stored.Email != "ana@x.com" || stored.Name != "Ana" || stored.ID != 7 {
+			t.Errorf("unexpected stored profile: %+v", *stored)
+		}
+	})
+
+	t.Run("No Changes Sends Nothing", func(t *testing.T) {
+		client := crudp.NewDefault()
+		p := Profile{Name: "Ana"}
+		if err := client.EnqueuePatch(0, "", &p, &p); err != nil {
+			t.Fatalf("EnqueuePatch error: %v", err)
+		}
+		if client.Broker().QueueLength() != 0 {
+			t.Errorf("expected empty queue, got %d", client.Broker().QueueLength())
+		}
+	})
+
+	t.Run("Update Fallback With Mask In Context", func(t *testing.T) {
+		var got crudp.FieldMask
+		cp := crudp.NewDefault()
+		cp.RegisterHandler(&profileUpdater{mask: &got})
+
+		mask, _ := cp.Codec().Encode(crudp.FieldMask{Fields: []string{"Name"}})
+		data, _ := cp.Codec().Encode(&profileUpdater{Name: "Bea"})
+		result := processOne(t, cp, crudp.Packet{Action: crudp.ActionPatch, Data: [][]byte{mask, data}})
+		if result.MessageType != uint8(Msg.Success) {
+			t.Fatalf("expected success, got %s", result.Message)
+		}
+		if !got.Has("Name") {
+			t.Errorf("expected mask in ctx, got %v", got.Fields)
+		}
+	})
+}
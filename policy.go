@@ -0,0 +1,95 @@
+package crudp
+
+import (
+	. "github.com/cdvelop/tinystring"
+)
+
+// ActionPolicy disables handler actions without touching handler code
+// Keys are handler names ("*" = every handler), values the disabled actions.
+// 'u' also disables patches ('p'), which are partial updates.
+//
+//	cfg.ActionPolicy = crudp.ActionPolicy{"patient": "d", "*": "p"}
+type ActionPolicy map[string]string
+
+// Allows reports whether action may reach the handler called name
+func (p ActionPolicy) Allows(name string, action byte) bool {
+	return !disables(p[name], action) && !disables(p["*"], action)
+}
+
+func disables(actions string, action byte) bool {
+	for i := 0; i < len(actions); i++ {
+		if actions[i] == action || (actions[i] == 'u' && action == ActionPatch) {
+			return true
+		}
+	}
+	return false
+}
+
+// ActionDisabledError is the result of a packet rejected by Config.ActionPolicy
+type ActionDisabledError struct {
+	Handler string
+	Action  byte
+}
+
+func (e *ActionDisabledError) Error() string {
+	return Fmt("action disabled: %s %c", e.Handler, e.Action)
+}
+
+// checkActionPolicy rejects packets disabled by Config.ActionPolicy
+func (cp *CrudP) checkActionPolicy(handler *actionHandler, packet *Packet) (PacketResult, error) {
+	if cp.config.ActionPolicy == nil || cp.config.ActionPolicy.Allows(handler.name, packet.Action) {
+		return PacketResult{}, nil
+	}
+	err := &ActionDisabledError{Handler: handler.name, Action: packet.Action}
+	cp.log.Warn("action disabled", "handler", handler.name, "action", string(packet.Action))
+	return errorResult(packet, err), err
+}
+
+// ReadOnlyError is the result of a mutating packet sent to a read-only
+// replica (Config.ReadOnly); PacketResult.Redirect names the primary
+type ReadOnlyError struct {
+	Primary string
+}
+
+func (e *ReadOnlyError) Error() string {
+	if e.Primary == "" {
+		return "read-only replica"
+	}
+	return "read-only replica: send writes to " + e.Primary
+}
+
+// mutating reports whether action changes data
+func mutating(action byte) bool {
+	return action == 'c' || action == 'u' || action == 'd' || action == ActionPatch
+}
+
+// checkReadOnly rejects mutating packets on a read-only replica
+func (cp *CrudP) checkReadOnly(packet *Packet) (PacketResult, error) {
+	if !cp.config.ReadOnly || !mutating(packet.Action) {
+		return PacketResult{}, nil
+	}
+	err := &ReadOnlyError{Primary: cp.config.PrimaryURL}
+	pr := errorResult(packet, err)
+	pr.Redirect = cp.config.PrimaryURL
+	return pr, err
+}
+
+// checkActionPolicyNames reports ActionPolicy entries naming no handler (used by SelfCheck)
+func (cp *CrudP) checkActionPolicyNames() (problems []string) {
+	for name := range cp.config.ActionPolicy {
+		if name == "*" {
+			continue
+		}
+		found := false
+		for _, h := range cp.table() {
+			if h.handler != nil && h.name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, "action policy: unknown handler "+name)
+		}
+	}
+	return problems
+}
@@ -0,0 +1,93 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Chart is a handler with every action, counting the calls that reach it
+type Chart struct {
+	ID string
+}
+
+var chartCalls int
+
+func (h *Chart) Create(ctx context.Context, data ...any) any { chartCalls++; return "ok" }
+func (h *Chart) Read(ctx context.Context, data ...any) any   { chartCalls++; return "ok" }
+func (h *Chart) Update(ctx context.Context, data ...any) any { chartCalls++; return "ok" }
+func (h *Chart) Delete(ctx context.Context, data ...any) any { chartCalls++; return "ok" }
+
+func ActionPolicyShared(t *testing.T) {
+	t.Run("Disabled Actions Never Reach Handlers", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.ActionPolicy = crudp.ActionPolicy{"chart": "du"}
+		cp := crudp.New(cfg, crudp.WithHandlers(&Chart{}))
+
+		chartCalls = 0
+		for _, action := range []byte{'d', 'u', crudp.ActionPatch} {
+			pr := processOne(t, cp, crudp.Packet{Action: action, HandlerID: 0})
+			if pr.MessageType != uint8(Msg.Error) || pr.Message != Fmt("action disabled: chart %c", action) {
+				t.Errorf("%c: unexpected result %d %q", action, pr.MessageType, pr.Message)
+			}
+		}
+		if chartCalls != 0 {
+			t.Errorf("disabled actions reached the handler %d times", chartCalls)
+		}
+
+		if pr := processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 0}); pr.MessageType == uint8(Msg.Error) {
+			t.Errorf("read rejected: %s", pr.Message)
+		}
+		if chartCalls != 1 {
+			t.Errorf("expected the read to reach the handler, got %d calls", chartCalls)
+		}
+	})
+
+	t.Run("Wildcard", func(t *testing.T) {
+		policy := crudp.ActionPolicy{"*": "c", "chart": "d"}
+		if policy.Allows("chart", 'c') || policy.Allows("user", 'c') || policy.Allows("chart", 'd') {
+			t.Error("disabled action allowed")
+		}
+		if !policy.Allows("user", 'd') || !policy.Allows("chart", 'r') {
+			t.Error("enabled action rejected")
+		}
+	})
+
+	t.Run("Read Only Replica", func(t *testing.T) {
+		for _, binary := range []bool{false, true} {
+			cfg := crudp.DefaultConfig()
+			cfg.ReadOnly = true
+			cfg.PrimaryURL = "https://primary.example.com"
+			cfg.UseBinary = binary
+			cp := crudp.New(cfg, crudp.WithHandlers(&Chart{}))
+
+			chartCalls = 0
+			for _, action := range []byte{'c', 'u', 'd', crudp.ActionPatch} {
+				pr := processOne(t, cp, crudp.Packet{Action: action, HandlerID: 0})
+				if pr.MessageType != uint8(Msg.Error) || pr.Redirect != "https://primary.example.com" {
+					t.Errorf("binary=%v %c: unexpected result %q redirect %q", binary, action, pr.Message, pr.Redirect)
+				}
+			}
+			if pr := processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 0}); pr.MessageType == uint8(Msg.Error) || pr.Redirect != "" {
+				t.Errorf("binary=%v: read rejected: %s", binary, pr.Message)
+			}
+			if chartCalls != 1 {
+				t.Errorf("binary=%v: expected only the read to reach the handler, got %d calls", binary, chartCalls)
+			}
+		}
+	})
+
+	t.Run("SelfCheck Reports Unknown Handlers", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.ActionPolicy = crudp.ActionPolicy{"charts": "d"}
+		cp := crudp.New(cfg, crudp.WithHandlers(&Chart{}))
+
+		err := cp.SelfCheck()
+		sc, ok := err.(*crudp.SelfCheckError)
+		if !ok || len(sc.Problems) != 1 || sc.Problems[0] != "action policy: unknown handler charts" {
+			t.Errorf("unexpected self-check result: %v", err)
+		}
+	})
+}
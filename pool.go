@@ -0,0 +1,72 @@
+package crudp
+
+import "sync"
+
+// EncoderTo is an optional Codec extension that appends the encoding of v to dst
+// Codecs implementing it let EncodePacket reuse a pooled buffer for packet data.
+type EncoderTo interface {
+	EncodeTo(dst []byte, v any) ([]byte, error)
+}
+
+// encodeTo appends the encoding of v to dst, falling back to Encode
+func encodeTo(codec Codec, dst []byte, v any) ([]byte, error) {
+	if enc, ok := codec.(EncoderTo); ok {
+		return enc.EncodeTo(dst, v)
+	}
+	encoded, err := codec.Encode(v)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, encoded...), nil
+}
+
+// Pools for the per-call scratch values of EncodePacket and ProcessBatch.
+// Nothing taken from a pool may escape the call that took it.
+var (
+	bufPool = sync.Pool{New: func() any {
+		b := make([]byte, 0, 512)
+		return &b
+	}}
+	dataPool = sync.Pool{New: func() any {
+		d := make([][]byte, 0, 8)
+		return &d
+	}}
+	batchPool = sync.Pool{New: func() any {
+		return &BatchRequest{Packets: make([]Packet, 0, 8)}
+	}}
+	resultPool = sync.Pool{New: func() any {
+		r := make([]PacketResult, 0, 8)
+		return &r
+	}}
+)
+
+func getBuf() *[]byte { return bufPool.Get().(*[]byte) }
+
+func putBuf(b *[]byte) {
+	*b = (*b)[:0]
+	bufPool.Put(b)
+}
+
+func getData() *[][]byte { return dataPool.Get().(*[][]byte) }
+
+func putData(d *[][]byte) {
+	clear(*d)
+	*d = (*d)[:0]
+	dataPool.Put(d)
+}
+
+func getBatch() *BatchRequest { return batchPool.Get().(*BatchRequest) }
+
+func putBatch(b *BatchRequest) {
+	clear(b.Packets)
+	b.Packets = b.Packets[:0]
+	batchPool.Put(b)
+}
+
+func getResults() *[]PacketResult { return resultPool.Get().(*[]PacketResult) }
+
+func putResults(r *[]PacketResult) {
+	clear(*r)
+	*r = (*r)[:0]
+	resultPool.Put(r)
+}
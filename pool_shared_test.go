@@ -0,0 +1,80 @@
+package crudp_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// appendCodec wraps the default codec and counts EncodeTo calls
+type appendCodec struct {
+	crudp.Codec
+	mu      sync.Mutex
+	appends int
+}
+
+func (c *appendCodec) EncodeTo(dst []byte, v any) ([]byte, error) {
+	c.mu.Lock()
+	c.appends++
+	c.mu.Unlock()
+	encoded, err := c.Encode(v)
+	return append(dst, encoded...), err
+}
+
+func PoolingShared(t *testing.T) {
+	t.Run("EncodePacket Uses EncodeTo", func(t *testing.T) {
+		codec := &appendCodec{Codec: crudp.NewDefault().Codec()}
+		cp := crudp.New(crudp.WithCodec(codec))
+
+		encoded, err := cp.EncodePacket('c', 0, "", &User{Name: "a"}, &User{Name: "b"})
+		if err != nil {
+			t.Fatalf("EncodePacket error: %v", err)
+		}
+		if codec.appends != 2 {
+			t.Errorf("expected 2 EncodeTo calls, got %d", codec.appends)
+		}
+
+		var packet crudp.Packet
+		cp.DecodePacket(encoded, &packet)
+		var second User
+		if err := cp.Codec().Decode(packet.Data[1], &second); err != nil || second.Name != "b" {
+			t.Errorf("items must not overlap in the shared buffer, got %+v (%v)", second, err)
+		}
+	})
+
+	t.Run("Concurrent ProcessBatch", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		cp.RegisterHandler(&Note{})
+
+		var wg sync.WaitGroup
+		errs := make(chan string, 64)
+		for i := 0; i < 32; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				text := Fmt("note-%d", i)
+				data, _ := cp.Codec().Encode(&Note{ID: i + 1, Text: text})
+				batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'u', ReqID: text, Data: [][]byte{data}}}})
+
+				resp, err := cp.ProcessBatch(context.Background(), batch)
+				if err != nil {
+					errs <- err.Error()
+					return
+				}
+				var batchResp crudp.BatchResponse
+				cp.Codec().Decode(resp, &batchResp)
+				if len(batchResp.Results) != 1 || batchResp.Results[0].ReqID != text {
+					errs <- Fmt("response mixed up for %s", text)
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for e := range errs {
+			t.Error(e)
+		}
+	})
+}
@@ -0,0 +1,270 @@
+package crudp
+
+import (
+	"context"
+	"sync"
+)
+
+// PresenceChannel is the reserved broadcast channel for join/leave events
+const PresenceChannel = "presence"
+
+// PresenceEvent is published on PresenceChannel when a user opens their
+// first connection (Online) or closes their last one
+type PresenceEvent struct {
+	User   string `json:"user"`
+	Online bool   `json:"online"`
+}
+
+// Presence tracks the connected users (Config.Presence)
+// On the server users join through their SSE or gRPC streams; with
+// Config.PubSub the instances share their users, so the list covers the
+// whole cluster. On the client the list is rebuilt from the events received
+// on PresenceChannel.
+// Uses slices instead of maps for TinyGo compatibility
+type Presence struct {
+	cp    *CrudP
+	mu    sync.Mutex
+	users []presenceUser
+	funcs []func(PresenceEvent) // Client-side OnPresence callbacks
+}
+
+type presenceUser struct {
+	tenant string
+	id     string
+	node   string // Instance holding the connections, "" = this one
+	conns  int    // Open connections on this instance
+}
+
+// Presence returns the presence tracker of this instance
+func (cp *CrudP) Presence() *Presence {
+	return &cp.presence
+}
+
+// List returns the IDs of the connected users of every tenant in join order
+func (p *Presence) List() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var users []string
+	for _, u := range p.users {
+		if !contains(users, u.id) {
+			users = append(users, u.id)
+		}
+	}
+	return users
+}
+
+// ListTenant returns the IDs of the connected users of tenant in join order
+func (p *Presence) ListTenant(tenant string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var users []string
+	for _, u := range p.users {
+		if u.tenant == tenant && !contains(users, u.id) {
+			users = append(users, u.id)
+		}
+	}
+	return users
+}
+
+// Online reports whether user of the "" tenant is connected to any instance
+func (p *Presence) Online(user string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, u := range p.users {
+		if u.tenant == "" && u.id == user {
+			return true
+		}
+	}
+	return false
+}
+
+// Join marks the UserProvider user of ctx as connected until leave is called
+// No-op when Config.Presence is off or the caller is anonymous. Used by the
+// SSE endpoint and the grpc package; other transports call it the same way.
+// Join/leave events only reach the tenant of the user.
+func (p *Presence) Join(ctx context.Context) (leave func()) {
+	cfg := p.cp.config
+	if !cfg.Presence || cfg.UserProvider == nil {
+		return func() {}
+	}
+	user := cfg.UserProvider.GetUserID(ctx)
+	if user == "" {
+		return func() {}
+	}
+
+	tenant := Tenant(p.cp.withTenant(ctx))
+	if first, elsewhere := p.add(tenant, user); first {
+		p.cp.publishBus(busMessage{kind: busJoin, tenant: tenant, user: user})
+		if !elsewhere {
+			p.cp.publishPresence(tenant, PresenceEvent{User: user, Online: true})
+		}
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if last, elsewhere := p.remove(tenant, user); last {
+				p.cp.publishBus(busMessage{kind: busLeave, tenant: tenant, user: user})
+				if !elsewhere {
+					p.cp.publishPresence(tenant, PresenceEvent{User: user})
+				}
+			}
+		})
+	}
+}
+
+// OnPresence registers a client-side callback for join/leave events
+func (p *Presence) OnPresence(fn func(PresenceEvent)) {
+	if fn == nil {
+		return
+	}
+	p.mu.Lock()
+	p.funcs = append(p.funcs, fn)
+	p.mu.Unlock()
+}
+
+// add counts a local connection of user, reporting whether it is the first
+// on this instance and whether other instances hold connections of user
+func (p *Presence) add(tenant, user string) (first, elsewhere bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	elsewhere = p.elsewhere(tenant, user, "")
+	if i := p.find(tenant, user, ""); i >= 0 {
+		p.users[i].conns++
+		return false, elsewhere
+	}
+	p.users = append(p.users, presenceUser{tenant: tenant, id: user, conns: 1})
+	return true, elsewhere
+}
+
+// remove drops a local connection of user, reporting whether it was the
+// last on this instance and whether other instances hold connections of user
+func (p *Presence) remove(tenant, user string) (last, elsewhere bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	elsewhere = p.elsewhere(tenant, user, "")
+	i := p.find(tenant, user, "")
+	if i < 0 {
+		return false, elsewhere
+	}
+	if p.users[i].conns--; p.users[i].conns > 0 {
+		return false, elsewhere
+	}
+	p.users = append(p.users[:i], p.users[i+1:]...)
+	return true, elsewhere
+}
+
+// setRemote records that node holds (or no longer holds) connections of user
+func (p *Presence) setRemote(node, tenant, user string, online bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i := p.find(tenant, user, node)
+	switch {
+	case online && i < 0:
+		p.users = append(p.users, presenceUser{tenant: tenant, id: user, node: node})
+	case !online && i >= 0:
+		p.users = append(p.users[:i], p.users[i+1:]...)
+	}
+}
+
+// dropNode forgets the users of a closed instance
+func (p *Presence) dropNode(node string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	kept := p.users[:0]
+	for _, u := range p.users {
+		if u.node != node {
+			kept = append(kept, u)
+		}
+	}
+	p.users = kept
+}
+
+// local returns the users connected to this instance
+func (p *Presence) local() []presenceUser {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var users []presenceUser
+	for _, u := range p.users {
+		if u.node == "" {
+			users = append(users, u)
+		}
+	}
+	return users
+}
+
+func (p *Presence) find(tenant, user, node string) int {
+	for i, u := range p.users {
+		if u.tenant == tenant && u.id == user && u.node == node {
+			return i
+		}
+	}
+	return -1
+}
+
+// elsewhere reports whether an instance other than node holds user
+func (p *Presence) elsewhere(tenant, user, node string) bool {
+	for _, u := range p.users {
+		if u.tenant == tenant && u.id == user && u.node != node {
+			return true
+		}
+	}
+	return false
+}
+
+// publishPresence broadcasts a join/leave event on PresenceChannel of tenant
+func (cp *CrudP) publishPresence(tenant string, pe PresenceEvent) {
+	ev, err := cp.presenceEvent(pe)
+	if err != nil {
+		cp.log.Error("presence encoding failed", "user", pe.User, "error", err)
+		return
+	}
+	cp.broadcast(tenant, ev)
+}
+
+func (cp *CrudP) presenceEvent(pe PresenceEvent) (Event, error) {
+	data, err := cp.codec.Encode(pe)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Channel: PresenceChannel, Data: data}, nil
+}
+
+// presenceSnapshot returns one Online event per connected user of tenant,
+// sent to new subscribers so they start with the full list
+func (cp *CrudP) presenceSnapshot(tenant string) []Event {
+	if !cp.config.Presence {
+		return nil
+	}
+	var events []Event
+	for _, user := range cp.presence.ListTenant(tenant) {
+		if ev, err := cp.presenceEvent(PresenceEvent{User: user, Online: true}); err == nil {
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+// receivePresence updates the client-side list from a PresenceChannel event
+func (cp *CrudP) receivePresence(ev Event) {
+	var pe PresenceEvent
+	if err := cp.codec.Decode(ev.Data, &pe); err != nil {
+		cp.log.Warn("presence decoding failed", "error", err)
+		return
+	}
+
+	p := &cp.presence
+	p.mu.Lock()
+	i := p.find("", pe.User, "")
+	switch {
+	case pe.Online && i < 0:
+		p.users = append(p.users, presenceUser{id: pe.User, conns: 1})
+	case !pe.Online && i >= 0:
+		p.users = append(p.users[:i], p.users[i+1:]...)
+	}
+	funcs := p.funcs
+	p.mu.Unlock()
+
+	for _, fn := range funcs {
+		fn(pe)
+	}
+}
@@ -0,0 +1,96 @@
+package crudp
+
+import "context"
+
+// progressPrefix starts the reserved channels of progress events
+const progressPrefix = "progress:"
+
+// ProgressEvent reports how far a long-running packet got, e.g. an import
+type ProgressEvent struct {
+	ReqID   string `json:"req_id"`  // Packet being processed
+	Percent int    `json:"percent"` // 0-100
+	Note    string `json:"note"`    // e.g. "row 500 of 2000", "" = none
+}
+
+// ProgressChannel returns the progress channel of a user ("progress:42")
+// SSE and gRPC streams always receive the one of their UserProvider user.
+func ProgressChannel(userID string) string {
+	return progressPrefix + userID
+}
+
+// Progress streams the progress of the packet being processed to the
+// client that sent it. Get it with ProgressFrom.
+type Progress struct {
+	cp      *CrudP
+	ctx     context.Context
+	reqID   string
+	percent int
+	note    string
+}
+
+// ProgressFrom returns the Progress of a packet being processed by
+// ProcessBatch, nil in other contexts; Report on nil is a no-op.
+func ProgressFrom(ctx context.Context) *Progress {
+	d := DispatcherFrom(ctx)
+	if d == nil {
+		return nil
+	}
+	return &Progress{cp: d.batch.cp, ctx: ctx, reqID: d.parent.ReqID, percent: -1}
+}
+
+// Report sends a ProgressEvent to the progress channel of the UserProvider
+// user of the packet, right away: unlike broadcasts it does not wait for the
+// packet (Config.Outbox). Repeated values are sent once. No-op without a
+// user, since nobody could receive it.
+func (p *Progress) Report(percent int, note string) {
+	if p == nil || p.cp.config.UserProvider == nil {
+		return
+	}
+	percent = min(max(percent, 0), 100)
+	if percent == p.percent && note == p.note {
+		return
+	}
+	p.percent, p.note = percent, note
+
+	user := p.cp.config.UserProvider.GetUserID(p.ctx)
+	if user == "" {
+		return
+	}
+	data, err := p.cp.codec.Encode(ProgressEvent{ReqID: p.reqID, Percent: percent, Note: note})
+	if err != nil {
+		p.cp.log.Error("progress encoding failed", "req_id", p.reqID, "error", err)
+		return
+	}
+	p.cp.broadcast(Tenant(p.ctx), Event{Channel: ProgressChannel(user), Data: data})
+}
+
+// OnProgress registers a callback for the ProgressEvent received by
+// ReceiveEvent, e.g. to drive the progress bar of the packet with its ReqID
+func (cp *CrudP) OnProgress(fn func(ProgressEvent)) {
+	if fn == nil {
+		return
+	}
+	cp.listeners.mu.Lock()
+	cp.listeners.onProgress = append(cp.listeners.onProgress, fn)
+	cp.listeners.mu.Unlock()
+}
+
+// isProgress reports whether ev was sent by Progress.Report
+func isProgress(ev Event) bool {
+	return len(ev.Channel) > len(progressPrefix) && ev.Channel[:len(progressPrefix)] == progressPrefix
+}
+
+// receiveProgress passes a progress event to the OnProgress callbacks
+func (cp *CrudP) receiveProgress(ev Event) {
+	var pe ProgressEvent
+	if err := cp.codec.Decode(ev.Data, &pe); err != nil {
+		cp.log.Warn("progress decoding failed", "error", err)
+		return
+	}
+	cp.listeners.mu.Lock()
+	callbacks := cp.listeners.onProgress
+	cp.listeners.mu.Unlock()
+	for _, fn := range callbacks {
+		fn(pe)
+	}
+}
@@ -0,0 +1,63 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Importer reports its progress while creating
+type Importer struct{}
+
+func (h *Importer) Create(ctx context.Context, data ...any) any {
+	p := crudp.ProgressFrom(ctx)
+	p.Report(50, "half")
+	p.Report(50, "half") // Repeated, sent once
+	p.Report(150, "")
+	return "done"
+}
+
+func ProgressShared(t *testing.T) {
+	t.Run("Reports Reach The User", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.UserProvider = userFromCtx{}
+		server := crudp.New(crudp.WithConfig(cfg), crudp.WithHandlers(&Importer{}))
+
+		var events []crudp.Event
+		sub := server.ListenTo(func(ev crudp.Event) { events = append(events, ev) }, crudp.ProgressChannel("alice"))
+		defer sub.Close()
+
+		batch, _ := server.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'c', ReqID: "imp-1"}}})
+		if _, err := server.ProcessBatch(context.WithValue(context.Background(), userKey{}, "alice"), batch); err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 2 {
+			t.Fatalf("expected 2 progress events, got %d", len(events))
+		}
+
+		var got []crudp.ProgressEvent
+		client := crudp.NewDefault()
+		client.OnProgress(func(pe crudp.ProgressEvent) { got = append(got, pe) })
+		for _, ev := range events {
+			client.ReceiveEvent(ev)
+		}
+		if len(got) != 2 || got[0] != (crudp.ProgressEvent{ReqID: "imp-1", Percent: 50, Note: "half"}) || got[1].Percent != 100 {
+			t.Fatalf("unexpected progress %+v", got)
+		}
+	})
+
+	t.Run("No Reporter Outside ProcessBatch", func(t *testing.T) {
+		p := crudp.ProgressFrom(context.Background())
+		if p != nil {
+			t.Fatal("expected nil Progress")
+		}
+		p.Report(10, "ignored")
+
+		cp := crudp.New(crudp.WithHandlers(&Importer{})) // No UserProvider
+		if pr := processOne(t, cp, crudp.Packet{Action: 'c'}); pr.MessageType != uint8(Msg.Success) {
+			t.Fatalf("unexpected result %q", pr.Message)
+		}
+	})
+}
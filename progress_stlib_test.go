@@ -0,0 +1,9 @@
+//go:build !wasm
+
+package crudp_test
+
+import "testing"
+
+func TestProgress_Stdlib(t *testing.T) {
+	ProgressShared(t)
+}
@@ -0,0 +1,281 @@
+package protocodec
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// Structs map to proto3 messages: exported fields are numbered 1, 2, 3...
+// in declaration order. Ints map to int64, uints to uint64, slices to
+// repeated fields (packed for numbers) and maps to map<K, V>.
+
+// exportedFields returns the exported fields of a struct type in order
+func exportedFields(t reflect.Type) []reflect.StructField {
+	fields := make([]reflect.StructField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.PkgPath == "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// appendMessage encodes a struct (or pointer to struct) as a message body
+func appendMessage(dst []byte, v any) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return dst, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return dst, Err(Fmt("protocodec: cannot encode %s, only structs", rv.Kind().String()))
+	}
+	return appendStruct(dst, rv)
+}
+
+func appendStruct(dst []byte, rv reflect.Value) ([]byte, error) {
+	var err error
+	for i, f := range exportedFields(rv.Type()) {
+		if dst, err = appendField(dst, i+1, rv.FieldByIndex(f.Index)); err != nil {
+			return dst, err
+		}
+	}
+	return dst, nil
+}
+
+func appendField(dst []byte, field int, v reflect.Value) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return dst, nil
+		}
+		return appendField(dst, field, v.Elem())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return appendBytesField(dst, field, v.Bytes()), nil
+		}
+		if isPackable(v.Type().Elem().Kind()) {
+			if v.Len() == 0 {
+				return dst, nil
+			}
+			var body []byte
+			for i := 0; i < v.Len(); i++ {
+				body = appendScalar(body, v.Index(i))
+			}
+			return appendBytes(appendTag(dst, field, wireBytes), body), nil
+		}
+		var err error
+		for i := 0; i < v.Len(); i++ {
+			if dst, err = appendElement(dst, field, v.Index(i)); err != nil {
+				return dst, err
+			}
+		}
+		return dst, nil
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			var entry []byte
+			var err error
+			if entry, err = appendElement(entry, 1, iter.Key()); err != nil {
+				return dst, err
+			}
+			if entry, err = appendElement(entry, 2, iter.Value()); err != nil {
+				return dst, err
+			}
+			dst = appendBytes(appendTag(dst, field, wireBytes), entry)
+		}
+		return dst, nil
+	case reflect.Struct:
+		body, err := appendStruct(nil, v)
+		if err != nil {
+			return dst, err
+		}
+		return appendBytes(appendTag(dst, field, wireBytes), body), nil
+	}
+
+	if v.IsZero() {
+		return dst, nil // proto3: zero scalars are not sent
+	}
+	return appendElement(dst, field, v)
+}
+
+// appendElement always writes the value, even when zero (repeated items, map entries)
+func appendElement(dst []byte, field int, v reflect.Value) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.String:
+		return appendBytes(appendTag(dst, field, wireBytes), []byte(v.String())), nil
+	case reflect.Struct:
+		body, err := appendStruct(nil, v)
+		if err != nil {
+			return dst, err
+		}
+		return appendBytes(appendTag(dst, field, wireBytes), body), nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return appendBytes(appendTag(dst, field, wireBytes), nil), nil
+		}
+		return appendElement(dst, field, v.Elem())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return appendBytes(appendTag(dst, field, wireBytes), v.Bytes()), nil
+		}
+	}
+	if isPackable(v.Kind()) {
+		return appendScalar(appendTag(dst, field, wireType(v.Kind())), v), nil
+	}
+	return dst, Err(Fmt("protocodec: unsupported type %s", v.Type().String()))
+}
+
+func isPackable(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func wireType(k reflect.Kind) int {
+	switch k {
+	case reflect.Float32:
+		return wireFixed32
+	case reflect.Float64:
+		return wireFixed64
+	}
+	return wireVarint
+}
+
+// appendScalar writes a number or bool without tag
+func appendScalar(dst []byte, v reflect.Value) []byte {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(dst, 1)
+		}
+		return append(dst, 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.AppendUvarint(dst, uint64(v.Int()))
+	case reflect.Float32:
+		return appendFixed32(dst, float32(v.Float()))
+	case reflect.Float64:
+		return appendFixed64(dst, v.Float())
+	}
+	return binary.AppendUvarint(dst, v.Uint())
+}
+
+// decodeMessage decodes a message body into a pointer to struct
+func decodeMessage(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return Errf("protocodec: decode target must be a non-nil pointer")
+	}
+	rv = rv.Elem()
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return Err(Fmt("protocodec: cannot decode into %s, only structs", rv.Kind().String()))
+	}
+	rv.Set(reflect.Zero(rv.Type()))
+	r := &reader{buf: data}
+	readStruct(r, rv)
+	return r.err
+}
+
+func readStruct(r *reader, rv reflect.Value) {
+	fields := exportedFields(rv.Type())
+	for r.more() {
+		field, wire := r.tag()
+		if field < 1 || field > len(fields) {
+			r.skip(wire)
+			continue
+		}
+		readField(r, wire, rv.FieldByIndex(fields[field-1].Index))
+	}
+}
+
+func readField(r *reader, wire int, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		readField(r, wire, v.Elem())
+	case reflect.Slice:
+		elem := v.Type().Elem()
+		if elem.Kind() == reflect.Uint8 {
+			v.SetBytes(r.bytes())
+			return
+		}
+		if isPackable(elem.Kind()) && wire == wireBytes {
+			packed := r.message()
+			for packed.more() {
+				item := reflect.New(elem).Elem()
+				readScalar(packed, item)
+				v.Set(reflect.Append(v, item))
+			}
+			r.join(packed)
+			return
+		}
+		item := reflect.New(elem).Elem()
+		readField(r, wire, item)
+		v.Set(reflect.Append(v, item))
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		entry := r.message()
+		key := reflect.New(v.Type().Key()).Elem()
+		value := reflect.New(v.Type().Elem()).Elem()
+		for entry.more() {
+			f, w := entry.tag()
+			switch f {
+			case 1:
+				readField(entry, w, key)
+			case 2:
+				readField(entry, w, value)
+			default:
+				entry.skip(w)
+			}
+		}
+		r.join(entry)
+		v.SetMapIndex(key, value)
+	case reflect.Struct:
+		sub := r.message()
+		readStruct(sub, v)
+		r.join(sub)
+	case reflect.String:
+		v.SetString(string(r.bytes()))
+	default:
+		if !isPackable(v.Kind()) || wire != wireType(v.Kind()) {
+			r.skip(wire)
+			return
+		}
+		readScalar(r, v)
+	}
+}
+
+// readScalar reads a number or bool without tag
+func readScalar(r *reader, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(r.uvarint() != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(r.uvarint()))
+	case reflect.Float32:
+		v.SetFloat(float64(math.Float32frombits(r.fixed32())))
+	case reflect.Float64:
+		v.SetFloat(math.Float64frombits(r.fixed64()))
+	default:
+		v.SetUint(r.uvarint())
+	}
+}
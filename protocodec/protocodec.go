@@ -0,0 +1,374 @@
+// Package protocodec is a crudp.Codec speaking Protocol Buffers, so services
+// written in other languages can use the CRUDP protocol.
+//
+// Envelopes (Packet, BatchRequest, BatchResponse) follow crudp.proto. Items in
+// Packet.Data are encoded as proto3 messages derived from the Go structs:
+// exported fields are numbered in declaration order starting at 1. Use
+// Schema to generate the matching .proto messages for registered handlers.
+//
+//	cp := crudp.New(crudp.WithCodec(protocodec.New()))
+//	cp.RegisterCodec(protocodec.ContentType, protocodec.New())
+package protocodec
+
+import (
+	_ "embed"
+
+	"github.com/cdvelop/crudp"
+)
+
+// ContentType for RegisterCodec
+const ContentType = "application/x-protobuf"
+
+// Proto is the crudp.proto definition of the envelopes
+//
+//go:embed crudp.proto
+var Proto string
+
+// Codec encodes envelopes and handler structs as protobuf
+type Codec struct{}
+
+// New returns the protobuf codec
+func New() *Codec {
+	return &Codec{}
+}
+
+// Encode encodes envelopes per crudp.proto and structs as reflected messages
+func (c *Codec) Encode(v any) ([]byte, error) {
+	return c.EncodeTo(nil, v)
+}
+
+// EncodeTo appends the encoding of v to dst (see crudp.EncoderTo)
+func (c *Codec) EncodeTo(dst []byte, v any) ([]byte, error) {
+	switch m := v.(type) {
+	case crudp.Packet:
+		return appendPacket(dst, &m), nil
+	case *crudp.Packet:
+		return appendPacket(dst, m), nil
+	case crudp.BatchRequest:
+		return appendBatchRequest(dst, &m), nil
+	case *crudp.BatchRequest:
+		return appendBatchRequest(dst, m), nil
+	case crudp.BatchResponse:
+		return appendBatchResponse(dst, &m), nil
+	case *crudp.BatchResponse:
+		return appendBatchResponse(dst, m), nil
+	}
+	return appendMessage(dst, v)
+}
+
+// Decode decodes into envelopes or pointers to structs
+// Bytes fields of the result reference data (no copy).
+func (c *Codec) Decode(data []byte, v any) error {
+	r := &reader{buf: data}
+	switch m := v.(type) {
+	case *crudp.Packet:
+		*m = crudp.Packet{}
+		readPacket(r, m)
+	case *crudp.BatchRequest:
+		m.Packets = m.Packets[:0]
+		for r.more() {
+			field, wire := r.tag()
+			if field == 1 && wire == wireBytes {
+				var p crudp.Packet
+				sub := r.message()
+				readPacket(sub, &p)
+				r.join(sub)
+				m.Packets = append(m.Packets, p)
+				continue
+			}
+			r.skip(wire)
+		}
+	case *crudp.BatchResponse:
+		m.Results = m.Results[:0]
+		m.Continuation = ""
+		for r.more() {
+			field, wire := r.tag()
+			if field == 1 && wire == wireBytes {
+				var pr crudp.PacketResult
+				sub := r.message()
+				readResult(sub, &pr)
+				r.join(sub)
+				m.Results = append(m.Results, pr)
+				continue
+			}
+			if field == 2 && wire == wireBytes {
+				m.Continuation = string(r.bytes())
+				continue
+			}
+			r.skip(wire)
+		}
+	default:
+		return decodeMessage(data, v)
+	}
+	return r.err
+}
+
+func appendBatchRequest(dst []byte, b *crudp.BatchRequest) []byte {
+	for i := range b.Packets {
+		p := &b.Packets[i]
+		dst = appendMessageField(dst, 1, func(body []byte) []byte { return appendPacket(body, p) })
+	}
+	return dst
+}
+
+func appendBatchResponse(dst []byte, b *crudp.BatchResponse) []byte {
+	for i := range b.Results {
+		pr := &b.Results[i]
+		dst = appendMessageField(dst, 1, func(body []byte) []byte { return appendResult(body, pr) })
+	}
+	return appendStringField(dst, 2, b.Continuation)
+}
+
+// Packet: action=1 handler_id=2 version=3 req_id=4 page=5 data=6 depends_on=7 refs=8 attachments=9
+// if_none_match=10 deadline=11 deferred=12 read_after=13
+func appendPacket(dst []byte, p *crudp.Packet) []byte {
+	dst = appendVarintField(dst, 1, uint64(p.Action))
+	dst = appendVarintField(dst, 2, uint64(p.HandlerID))
+	dst = appendVarintField(dst, 3, uint64(p.Version))
+	dst = appendStringField(dst, 4, p.ReqID)
+	if p.Page != nil {
+		page := p.Page
+		dst = appendMessageField(dst, 5, func(body []byte) []byte {
+			body = appendVarintField(body, 1, uint64(int64(page.Offset)))
+			body = appendVarintField(body, 2, uint64(int64(page.Limit)))
+			return appendStringField(body, 3, page.Cursor)
+		})
+	}
+	for _, item := range p.Data {
+		// Repeated bytes: empty items are still sent to keep positions
+		dst = appendBytes(appendTag(dst, 6, wireBytes), item)
+	}
+	for _, reqID := range p.DependsOn {
+		dst = appendBytes(appendTag(dst, 7, wireBytes), []byte(reqID))
+	}
+	for i := range p.Refs {
+		ref := &p.Refs[i]
+		dst = appendMessageField(dst, 8, func(body []byte) []byte {
+			body = appendVarintField(body, 1, uint64(int64(ref.Item)))
+			body = appendStringField(body, 2, ref.Field)
+			return appendStringField(body, 3, ref.ReqID)
+		})
+	}
+	for _, blob := range p.Attachments {
+		dst = appendBytes(appendTag(dst, 9, wireBytes), blob)
+	}
+	dst = appendStringField(dst, 10, p.IfNoneMatch)
+	dst = appendVarintField(dst, 11, uint64(p.Deadline))
+	dst = appendBoolField(dst, 12, p.Deferred)
+	return appendStringField(dst, 13, p.ReadAfter)
+}
+
+// PacketResult: packet=1 message_type=2 message=3 retry_after=4 page_info=5 items=6 ids=7 redirect=8 code=9
+// etag=10 message_key=11 message_args=12 job_id=13 write_token=14
+func appendResult(dst []byte, pr *crudp.PacketResult) []byte {
+	dst = appendMessageField(dst, 1, func(body []byte) []byte { return appendPacket(body, &pr.Packet) })
+	dst = appendVarintField(dst, 2, uint64(pr.MessageType))
+	dst = appendStringField(dst, 3, pr.Message)
+	dst = appendVarintField(dst, 4, uint64(int64(pr.RetryAfter)))
+	if pr.PageInfo != nil {
+		info := pr.PageInfo
+		dst = appendMessageField(dst, 5, func(body []byte) []byte {
+			body = appendVarintField(body, 1, uint64(int64(info.Total)))
+			body = appendStringField(body, 2, info.NextCursor)
+			return appendBoolField(body, 3, info.HasMore)
+		})
+	}
+	for i := range pr.Items {
+		item := &pr.Items[i]
+		dst = appendMessageField(dst, 6, func(body []byte) []byte {
+			body = appendVarintField(body, 1, uint64(int64(item.Index)))
+			body = appendVarintField(body, 2, uint64(item.Status))
+			return appendStringField(body, 3, item.Message)
+		})
+	}
+	for i := range pr.IDs {
+		m := &pr.IDs[i]
+		dst = appendMessageField(dst, 7, func(body []byte) []byte {
+			body = appendStringField(body, 1, m.TempID)
+			return appendStringField(body, 2, m.RealID)
+		})
+	}
+	dst = appendStringField(dst, 8, pr.Redirect)
+	dst = appendStringField(dst, 9, pr.Code)
+	dst = appendStringField(dst, 10, pr.ETag)
+	dst = appendStringField(dst, 11, pr.MessageKey)
+	for _, arg := range pr.MessageArgs {
+		dst = appendBytes(appendTag(dst, 12, wireBytes), []byte(arg))
+	}
+	dst = appendStringField(dst, 13, pr.JobID)
+	return appendStringField(dst, 14, pr.WriteToken)
+}
+
+func readPacket(r *reader, p *crudp.Packet) {
+	for r.more() {
+		field, wire := r.tag()
+		switch {
+		case field == 1 && wire == wireVarint:
+			p.Action = byte(r.uvarint())
+		case field == 2 && wire == wireVarint:
+			p.HandlerID = uint8(r.uvarint())
+		case field == 3 && wire == wireVarint:
+			p.Version = byte(r.uvarint())
+		case field == 4 && wire == wireBytes:
+			p.ReqID = string(r.bytes())
+		case field == 5 && wire == wireBytes:
+			sub := r.message()
+			p.Page = readPage(sub)
+			r.join(sub)
+		case field == 6 && wire == wireBytes:
+			p.Data = append(p.Data, r.bytes())
+		case field == 7 && wire == wireBytes:
+			p.DependsOn = append(p.DependsOn, string(r.bytes()))
+		case field == 8 && wire == wireBytes:
+			sub := r.message()
+			p.Refs = append(p.Refs, readRef(sub))
+			r.join(sub)
+		case field == 9 && wire == wireBytes:
+			p.Attachments = append(p.Attachments, r.bytes())
+		case field == 10 && wire == wireBytes:
+			p.IfNoneMatch = string(r.bytes())
+		case field == 11 && wire == wireVarint:
+			p.Deadline = int64(r.uvarint())
+		case field == 12 && wire == wireVarint:
+			p.Deferred = r.uvarint() != 0
+		case field == 13 && wire == wireBytes:
+			p.ReadAfter = string(r.bytes())
+		default:
+			r.skip(wire)
+		}
+	}
+}
+
+func readPage(r *reader) *crudp.Page {
+	page := &crudp.Page{}
+	for r.more() {
+		field, wire := r.tag()
+		switch {
+		case field == 1 && wire == wireVarint:
+			page.Offset = int(int64(r.uvarint()))
+		case field == 2 && wire == wireVarint:
+			page.Limit = int(int64(r.uvarint()))
+		case field == 3 && wire == wireBytes:
+			page.Cursor = string(r.bytes())
+		default:
+			r.skip(wire)
+		}
+	}
+	return page
+}
+
+func readResult(r *reader, pr *crudp.PacketResult) {
+	for r.more() {
+		field, wire := r.tag()
+		switch {
+		case field == 1 && wire == wireBytes:
+			sub := r.message()
+			readPacket(sub, &pr.Packet)
+			r.join(sub)
+		case field == 2 && wire == wireVarint:
+			pr.MessageType = uint8(r.uvarint())
+		case field == 3 && wire == wireBytes:
+			pr.Message = string(r.bytes())
+		case field == 4 && wire == wireVarint:
+			pr.RetryAfter = int(int64(r.uvarint()))
+		case field == 5 && wire == wireBytes:
+			sub := r.message()
+			pr.PageInfo = readPageInfo(sub)
+			r.join(sub)
+		case field == 6 && wire == wireBytes:
+			sub := r.message()
+			pr.Items = append(pr.Items, readItemResult(sub))
+			r.join(sub)
+		case field == 7 && wire == wireBytes:
+			sub := r.message()
+			pr.IDs = append(pr.IDs, readIDMapping(sub))
+			r.join(sub)
+		case field == 8 && wire == wireBytes:
+			pr.Redirect = string(r.bytes())
+		case field == 9 && wire == wireBytes:
+			pr.Code = string(r.bytes())
+		case field == 10 && wire == wireBytes:
+			pr.ETag = string(r.bytes())
+		case field == 11 && wire == wireBytes:
+			pr.MessageKey = string(r.bytes())
+		case field == 12 && wire == wireBytes:
+			pr.MessageArgs = append(pr.MessageArgs, string(r.bytes()))
+		case field == 13 && wire == wireBytes:
+			pr.JobID = string(r.bytes())
+		case field == 14 && wire == wireBytes:
+			pr.WriteToken = string(r.bytes())
+		default:
+			r.skip(wire)
+		}
+	}
+}
+
+func readPageInfo(r *reader) *crudp.PageInfo {
+	info := &crudp.PageInfo{}
+	for r.more() {
+		field, wire := r.tag()
+		switch {
+		case field == 1 && wire == wireVarint:
+			info.Total = int(int64(r.uvarint()))
+		case field == 2 && wire == wireBytes:
+			info.NextCursor = string(r.bytes())
+		case field == 3 && wire == wireVarint:
+			info.HasMore = r.uvarint() != 0
+		default:
+			r.skip(wire)
+		}
+	}
+	return info
+}
+
+func readItemResult(r *reader) crudp.ItemResult {
+	var item crudp.ItemResult
+	for r.more() {
+		field, wire := r.tag()
+		switch {
+		case field == 1 && wire == wireVarint:
+			item.Index = int(int64(r.uvarint()))
+		case field == 2 && wire == wireVarint:
+			item.Status = uint8(r.uvarint())
+		case field == 3 && wire == wireBytes:
+			item.Message = string(r.bytes())
+		default:
+			r.skip(wire)
+		}
+	}
+	return item
+}
+
+func readRef(r *reader) crudp.Ref {
+	var ref crudp.Ref
+	for r.more() {
+		field, wire := r.tag()
+		switch {
+		case field == 1 && wire == wireVarint:
+			ref.Item = int(int64(r.uvarint()))
+		case field == 2 && wire == wireBytes:
+			ref.Field = string(r.bytes())
+		case field == 3 && wire == wireBytes:
+			ref.ReqID = string(r.bytes())
+		default:
+			r.skip(wire)
+		}
+	}
+	return ref
+}
+
+func readIDMapping(r *reader) crudp.IDMapping {
+	var m crudp.IDMapping
+	for r.more() {
+		field, wire := r.tag()
+		switch {
+		case field == 1 && wire == wireBytes:
+			m.TempID = string(r.bytes())
+		case field == 2 && wire == wireBytes:
+			m.RealID = string(r.bytes())
+		default:
+			r.skip(wire)
+		}
+	}
+	return m
+}
@@ -0,0 +1,259 @@
+package protocodec
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+type Address struct {
+	City string
+	Zip  uint32
+}
+
+type Customer struct {
+	ID      int64
+	Name    string
+	Active  bool
+	Score   float64
+	Ratio   float32
+	Delta   int
+	Tags    []string
+	Points  []int32
+	Avatar  []byte
+	Home    Address
+	Others  []Address
+	Labels  map[string]int
+	Manager *Address
+
+	secret string
+}
+
+func (c *Customer) Create(ctx context.Context, data ...any) any {
+	in := data[0].(*Customer)
+	out := *in
+	out.ID = 42
+	return &out
+}
+
+func TestPacketWireFormat(t *testing.T) {
+	encoded, err := New().Encode(crudp.Packet{Action: 'c', HandlerID: 1, ReqID: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x08, 'c', 0x10, 0x01, 0x22, 0x01, 'a'}
+	if !bytes.Equal(encoded, want) {
+		t.Errorf("expected % x, got % x", want, encoded)
+	}
+}
+
+func TestAttachmentsRoundTrip(t *testing.T) {
+	codec := New()
+	encoded, _ := codec.Encode(crudp.Packet{Action: 'c', Data: [][]byte{{1}}, Attachments: [][]byte{{0xff, 0}, {}}})
+	var p crudp.Packet
+	if err := codec.Decode(encoded, &p); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Attachments) != 2 || !bytes.Equal(p.Attachments[0], []byte{0xff, 0}) || len(p.Attachments[1]) != 0 || len(p.Data) != 1 {
+		t.Errorf("unexpected packet %+v", p)
+	}
+}
+
+func TestConditionalReadRoundTrip(t *testing.T) {
+	codec := New()
+	encoded, _ := codec.Encode(crudp.Packet{Action: 'r', IfNoneMatch: "e1"})
+	var p crudp.Packet
+	if err := codec.Decode(encoded, &p); err != nil || p.IfNoneMatch != "e1" {
+		t.Fatalf("unexpected packet %+v, %v", p, err)
+	}
+
+	encoded, _ = codec.Encode(crudp.BatchResponse{Results: []crudp.PacketResult{{Packet: p, Code: crudp.CodeNotModified, ETag: "e1"}}})
+	var got crudp.BatchResponse
+	if err := codec.Decode(encoded, &got); err != nil || len(got.Results) != 1 {
+		t.Fatalf("decode: %v", err)
+	}
+	if r := got.Results[0]; r.ETag != "e1" || r.IfNoneMatch != "e1" || r.Code != crudp.CodeNotModified {
+		t.Errorf("unexpected result %+v", r)
+	}
+}
+
+func TestDeadlineRoundTrip(t *testing.T) {
+	codec := New()
+	encoded, _ := codec.Encode(crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'u', Deadline: 1700000000000}}})
+	var got crudp.BatchRequest
+	if err := codec.Decode(encoded, &got); err != nil || len(got.Packets) != 1 || got.Packets[0].Deadline != 1700000000000 {
+		t.Fatalf("unexpected request %+v, %v", got, err)
+	}
+}
+
+func TestContinuationRoundTrip(t *testing.T) {
+	codec := New()
+	encoded, _ := codec.Encode(crudp.BatchResponse{Results: []crudp.PacketResult{{Message: "OK"}}, Continuation: "c1"})
+	var got crudp.BatchResponse
+	if err := codec.Decode(encoded, &got); err != nil || len(got.Results) != 1 || got.Continuation != "c1" {
+		t.Fatalf("unexpected response %+v, %v", got, err)
+	}
+}
+
+func TestMessageKeyRoundTrip(t *testing.T) {
+	codec := New()
+	encoded, _ := codec.Encode(crudp.BatchResponse{Results: []crudp.PacketResult{{MessageKey: crudp.MsgDependencyFailed, MessageArgs: []string{"a", ""}}}})
+	var got crudp.BatchResponse
+	if err := codec.Decode(encoded, &got); err != nil || len(got.Results) != 1 {
+		t.Fatalf("decode: %v", err)
+	}
+	if r := got.Results[0]; r.MessageKey != crudp.MsgDependencyFailed || len(r.MessageArgs) != 2 || r.MessageArgs[0] != "a" {
+		t.Errorf("unexpected result %+v", r)
+	}
+}
+
+func TestDeferredRoundTrip(t *testing.T) {
+	codec := New()
+	encoded, _ := codec.Encode(crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'c', Deferred: true}}})
+	var req crudp.BatchRequest
+	if err := codec.Decode(encoded, &req); err != nil || len(req.Packets) != 1 || !req.Packets[0].Deferred {
+		t.Fatalf("unexpected request %+v, %v", req, err)
+	}
+	encoded, _ = codec.Encode(crudp.BatchResponse{Results: []crudp.PacketResult{{Code: crudp.CodeDeferred, JobID: "j1"}}})
+	var resp crudp.BatchResponse
+	if err := codec.Decode(encoded, &resp); err != nil || len(resp.Results) != 1 || resp.Results[0].JobID != "j1" {
+		t.Fatalf("unexpected response %+v, %v", resp, err)
+	}
+}
+
+func TestConsistencyTokensRoundTrip(t *testing.T) {
+	codec := New()
+	encoded, _ := codec.Encode(crudp.BatchResponse{Results: []crudp.PacketResult{{Packet: crudp.Packet{ReadAfter: "t0"}, WriteToken: "t1"}}})
+	var got crudp.BatchResponse
+	if err := codec.Decode(encoded, &got); err != nil || len(got.Results) != 1 {
+		t.Fatalf("decode: %v", err)
+	}
+	if r := got.Results[0]; r.ReadAfter != "t0" || r.WriteToken != "t1" {
+		t.Errorf("unexpected result %+v", r)
+	}
+}
+
+func TestItemResultsRoundTrip(t *testing.T) {
+	codec := New()
+	resp := crudp.BatchResponse{Results: []crudp.PacketResult{{
+		Packet:   crudp.Packet{Action: 'c'},
+		Items:    []crudp.ItemResult{crudp.ItemOK(0), {Index: 1, Status: 2, Message: "bad row"}},
+		Redirect: "https://primary",
+		Code:     crudp.CodeTimeout,
+	}}}
+	encoded, _ := codec.Encode(resp)
+
+	var got crudp.BatchResponse
+	if err := codec.Decode(encoded, &got); err != nil {
+		t.Fatal(err)
+	}
+	items := got.Results[0].Items
+	if len(items) != 2 || items[0].Failed() || !items[1].Failed() || items[1].Index != 1 || items[1].Message == "" {
+		t.Errorf("unexpected items: %+v", items)
+	}
+	if got.Results[0].Redirect != "https://primary" || got.Results[0].Code != crudp.CodeTimeout {
+		t.Errorf("unexpected redirect %q code %q", got.Results[0].Redirect, got.Results[0].Code)
+	}
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	in := Customer{
+		ID: 7, Name: "Ana", Active: true, Score: 9.5, Ratio: 0.25, Delta: -3,
+		Tags: []string{"a", ""}, Points: []int32{1, -2, 0}, Avatar: []byte{1, 2},
+		Home:    Address{City: "Lima", Zip: 15001},
+		Others:  []Address{{City: "Cusco"}, {}},
+		Labels:  map[string]int{"x": 1, "zero": 0},
+		Manager: &Address{City: "Quito"},
+		secret:  "not sent",
+	}
+	codec := New()
+	encoded, err := codec.Encode(&in)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	var out Customer
+	if err := codec.Decode(encoded, &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.ID != 7 || out.Name != "Ana" || !out.Active || out.Score != 9.5 || out.Ratio != 0.25 || out.Delta != -3 {
+		t.Errorf("scalars differ: %+v", out)
+	}
+	if len(out.Tags) != 2 || out.Tags[1] != "" || len(out.Points) != 3 || out.Points[1] != -2 {
+		t.Errorf("repeated fields differ: %v %v", out.Tags, out.Points)
+	}
+	if !bytes.Equal(out.Avatar, in.Avatar) || out.Home != in.Home || len(out.Others) != 2 || out.Others[0].City != "Cusco" {
+		t.Errorf("nested fields differ: %+v", out)
+	}
+	if len(out.Labels) != 2 || out.Labels["x"] != 1 || out.Manager == nil || out.Manager.City != "Quito" {
+		t.Errorf("map/pointer fields differ: %+v", out)
+	}
+	if out.secret != "" {
+		t.Error("unexported fields must not be encoded")
+	}
+}
+
+func TestProcessBatchOverProtobuf(t *testing.T) {
+	codec := New()
+	cp := crudp.New(crudp.WithCodec(codec), crudp.WithHandlers(&Customer{}))
+
+	data, _ := codec.Encode(&Customer{Name: "Bea"})
+	batch, _ := codec.Encode(crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'c', ReqID: "r1", Data: [][]byte{data}}}})
+
+	response, err := cp.ProcessBatch(context.Background(), batch)
+	if err != nil {
+		t.Fatalf("ProcessBatch: %v", err)
+	}
+	var resp crudp.BatchResponse
+	if err := codec.Decode(response, &resp); err != nil || len(resp.Results) != 1 {
+		t.Fatalf("decode response: %v %+v", err, resp)
+	}
+	result := resp.Results[0]
+	if result.ReqID != "r1" || result.Message != "OK" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	var created Customer
+	if err := codec.Decode(result.Data[0], &created); err != nil || created.ID != 42 || created.Name != "Bea" {
+		t.Errorf("unexpected created customer: %+v (%v)", created, err)
+	}
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	var resp crudp.BatchResponse
+	if err := New().Decode([]byte{0x0a, 0x05, 0x08}, &resp); err == nil {
+		t.Error("expected error for truncated message")
+	}
+}
+
+func TestSchema(t *testing.T) {
+	cp := crudp.New(crudp.WithHandlers(&Customer{}))
+	src, err := Schema(cp, "shop")
+	if err != nil {
+		t.Fatalf("Schema: %v", err)
+	}
+	for _, want := range []string{
+		"package shop;",
+		"// handler_id 0: customer -> Customer",
+		"message Customer {",
+		"  int64 id = 1;",
+		"  repeated int64 points = 8;",
+		"  bytes avatar = 9;",
+		"  Address home = 10;",
+		"  map<string, int64> labels = 12;",
+		"message Address {",
+		"  uint64 zip = 2;",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("schema missing %q:\n%s", want, src)
+		}
+	}
+	if strings.Count(src, "message Address {") != 1 {
+		t.Error("nested messages must be emitted once")
+	}
+	if !strings.Contains(Proto, "message BatchResponse") {
+		t.Error("embedded crudp.proto missing")
+	}
+}
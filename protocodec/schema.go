@@ -0,0 +1,125 @@
+package protocodec
+
+import (
+	"reflect"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Schema generates the proto3 messages of the handlers registered in cp
+// Field numbers follow the encoding used by Codec. Non-Go clients compile
+// it together with crudp.proto (see Proto).
+func Schema(cp *crudp.CrudP, pkg string) (string, error) {
+	g := &generator{}
+	var header string
+	for _, spec := range cp.Manifest() {
+		t := reflect.TypeOf(spec.Handler)
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return "", Err(Fmt("protocodec: handler %s is not a struct", spec.Name))
+		}
+		header += Fmt("// handler_id %d: %s -> %s\n", spec.ID, spec.Name, t.Name())
+		if err := g.message(t); err != nil {
+			return "", err
+		}
+	}
+
+	src := "// Code generated by crudp protocodec. DO NOT EDIT.\n"
+	src += "syntax = \"proto3\";\n\n"
+	src += "package " + pkg + ";\n\n"
+	src += header
+	for _, m := range g.out {
+		src += "\n" + m
+	}
+	return src, nil
+}
+
+// generator emits each struct message once, nested types first
+type generator struct {
+	seen []reflect.Type
+	out  []string
+}
+
+func (g *generator) message(t reflect.Type) error {
+	for _, s := range g.seen {
+		if s == t {
+			return nil
+		}
+	}
+	g.seen = append(g.seen, t)
+
+	body := "message " + t.Name() + " {\n"
+	for i, f := range exportedFields(t) {
+		typ, err := g.fieldType(f.Type)
+		if err != nil {
+			return Err(Fmt("%s.%s: %v", t.Name(), f.Name, err))
+		}
+		body += Fmt("  %s %s = %d;\n", typ, Convert(f.Name).SnakeLow().String(), i+1)
+	}
+	g.out = append(g.out, body+"}\n")
+	return nil
+}
+
+func (g *generator) fieldType(t reflect.Type) (string, error) {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.fieldType(t.Elem())
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "bytes", nil
+		}
+		elem, err := g.fieldType(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		if !singular(elem) {
+			return "", Errf("nested repeated or map fields are not supported")
+		}
+		return "repeated " + elem, nil
+	case reflect.Map:
+		key, err := g.fieldType(t.Key())
+		if err != nil {
+			return "", err
+		}
+		value, err := g.fieldType(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		if !singular(value) {
+			return "", Errf("map values cannot be repeated or maps")
+		}
+		return "map<" + key + ", " + value + ">", nil
+	case reflect.Struct:
+		if t.Name() == "" {
+			return "", Errf("anonymous structs are not supported")
+		}
+		return t.Name(), g.message(t)
+	}
+	return scalarType(t.Kind())
+}
+
+func scalarType(k reflect.Kind) (string, error) {
+	switch k {
+	case reflect.String:
+		return "string", nil
+	case reflect.Bool:
+		return "bool", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "int64", nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "uint64", nil
+	case reflect.Float32:
+		return "float", nil
+	case reflect.Float64:
+		return "double", nil
+	}
+	return "", Err(Fmt("unsupported type %s", k.String()))
+}
+
+// singular reports whether a proto type can be repeated or used as map value
+func singular(typ string) bool {
+	return !(len(typ) > 9 && typ[:9] == "repeated ") && !(len(typ) > 4 && typ[:4] == "map<")
+}
@@ -0,0 +1,161 @@
+package protocodec
+
+import (
+	"encoding/binary"
+	"math"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func appendTag(dst []byte, field int, wire int) []byte {
+	return binary.AppendUvarint(dst, uint64(field)<<3|uint64(wire))
+}
+
+func appendVarintField(dst []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return dst // proto3: zero values are not sent
+	}
+	return binary.AppendUvarint(appendTag(dst, field, wireVarint), v)
+}
+
+func appendBoolField(dst []byte, field int, v bool) []byte {
+	if !v {
+		return dst
+	}
+	return appendVarintField(dst, field, 1)
+}
+
+func appendBytesField(dst []byte, field int, v []byte) []byte {
+	if len(v) == 0 {
+		return dst
+	}
+	return appendBytes(appendTag(dst, field, wireBytes), v)
+}
+
+func appendStringField(dst []byte, field int, v string) []byte {
+	if v == "" {
+		return dst
+	}
+	dst = binary.AppendUvarint(appendTag(dst, field, wireBytes), uint64(len(v)))
+	return append(dst, v...)
+}
+
+func appendBytes(dst []byte, v []byte) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(v)))
+	return append(dst, v...)
+}
+
+// appendMessageField encodes a nested message; build appends its body
+func appendMessageField(dst []byte, field int, build func([]byte) []byte) []byte {
+	body := build(nil)
+	return appendBytes(appendTag(dst, field, wireBytes), body)
+}
+
+// reader decodes protobuf fields, recording the first error
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) fail() {
+	if r.err == nil {
+		r.err = Errf("protocodec: truncated or corrupt message")
+	}
+	r.buf = nil
+}
+
+func (r *reader) more() bool {
+	return r.err == nil && len(r.buf) > 0
+}
+
+func (r *reader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+// tag returns the next field number and wire type
+func (r *reader) tag() (int, int) {
+	t := r.uvarint()
+	return int(t >> 3), int(t & 7)
+}
+
+func (r *reader) bytes() []byte {
+	n := r.uvarint()
+	if r.err != nil || n > uint64(len(r.buf)) {
+		r.fail()
+		return nil
+	}
+	b := r.buf[:n:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *reader) fixed32() uint32 {
+	if len(r.buf) < 4 {
+		r.fail()
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(r.buf)
+	r.buf = r.buf[4:]
+	return v
+}
+
+func (r *reader) fixed64() uint64 {
+	if len(r.buf) < 8 {
+		r.fail()
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(r.buf)
+	r.buf = r.buf[8:]
+	return v
+}
+
+// message returns a reader over the next length-delimited field
+func (r *reader) message() *reader {
+	return &reader{buf: r.bytes()}
+}
+
+// join adopts the error of a nested message reader
+func (r *reader) join(sub *reader) {
+	if sub.err != nil && r.err == nil {
+		r.err = sub.err
+		r.buf = nil
+	}
+}
+
+// skip discards a field of an unknown number
+func (r *reader) skip(wire int) {
+	switch wire {
+	case wireVarint:
+		r.uvarint()
+	case wireFixed64:
+		r.fixed64()
+	case wireBytes:
+		r.bytes()
+	case wireFixed32:
+		r.fixed32()
+	default:
+		r.fail()
+	}
+}
+
+func appendFixed32(dst []byte, v float32) []byte {
+	return binary.LittleEndian.AppendUint32(dst, math.Float32bits(v))
+}
+
+func appendFixed64(dst []byte, v float64) []byte {
+	return binary.LittleEndian.AppendUint64(dst, math.Float64bits(v))
+}
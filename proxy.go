@@ -0,0 +1,73 @@
+package crudp
+
+import (
+	"context"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// ProxyHandler implements the CRUD interfaces by sending each call as a
+// packet to the server handler at its ID and waiting for the result, so
+// client code calls user.Create(ctx, u) the same way on both sides of the
+// wire. Register it in WASM builds under the name of the server handler:
+//
+//	crudp.ByEnv("user", user.NewService, func() any { return crudp.NewProxyHandler(0) })
+//
+// Methods return the PacketResult (decode its items with DecodeData), or a
+// *ResultError for error results. Like HandlerClient.Do they block: don't
+// call them on the goroutine that calls ReceiveBatch.
+type ProxyHandler struct {
+	id     uint8
+	name   string // Set by ByEnv
+	entity any
+	opts   []CallOption
+	cp     *CrudP // Set by bindTo
+}
+
+// NewProxyHandler returns a proxy for the handler at handlerID, sending
+// every call with opts (e.g. WithTimeout)
+func NewProxyHandler(handlerID uint8, opts ...CallOption) *ProxyHandler {
+	return &ProxyHandler{id: handlerID, opts: opts}
+}
+
+// Of sets the entity of the server handler, so Handshake and SchemaTable
+// see the same field layout on both sides
+func (p *ProxyHandler) Of(entity any) *ProxyHandler {
+	p.entity = entity
+	return p
+}
+
+// HandlerID returns the ID the proxy sends to
+func (p *ProxyHandler) HandlerID() uint8 { return p.id }
+
+func (p *ProxyHandler) HandlerName() string { return p.name }
+
+func (p *ProxyHandler) Entity() any { return p.entity }
+
+func (p *ProxyHandler) Create(ctx context.Context, data ...any) any {
+	return p.do(ctx, 'c', data)
+}
+
+func (p *ProxyHandler) Read(ctx context.Context, data ...any) any {
+	return p.do(ctx, 'r', data)
+}
+
+func (p *ProxyHandler) Update(ctx context.Context, data ...any) any {
+	return p.do(ctx, 'u', data)
+}
+
+func (p *ProxyHandler) Delete(ctx context.Context, data ...any) any {
+	return p.do(ctx, 'd', data)
+}
+
+// do sends data as the items of one packet and waits for its result
+func (p *ProxyHandler) do(ctx context.Context, action byte, data []any) any {
+	if p.cp == nil {
+		return Err(Fmt("proxy handler %d (%s) not registered", p.id, p.name))
+	}
+	pr, err := p.cp.call(ctx, p.id, action, data, p.opts).Wait(ctx)
+	if err != nil {
+		return err
+	}
+	return pr
+}
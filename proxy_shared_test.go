@@ -0,0 +1,84 @@
+package crudp_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cdvelop/crudp"
+)
+
+// Mirror echoes the names of the items it receives
+type Mirror struct {
+	ID   int
+	Name string
+}
+
+func (m *Mirror) Create(ctx context.Context, data ...any) any {
+	names := make([]string, 0, len(data))
+	for _, item := range data {
+		names = append(names, item.(*Mirror).Name)
+	}
+	return names
+}
+
+func ProxyShared(t *testing.T) {
+	newClient := func(proxy *crudp.ProxyHandler) *crudp.CrudP {
+		server := crudp.New(crudp.WithHandlers(&UserController{}, &Mirror{}))
+		cfg := crudp.DefaultConfig()
+		cfg.BatchWindow = 1
+		build := func() any { return proxy }
+		return crudp.NewLoopback(server, cfg, crudp.WithHandlers(
+			crudp.ServerOnly("user_controller", newUserController),
+			crudp.ByEnv("mirror", build, build),
+		))
+	}
+
+	t.Run("Calls Reach The Server Handler", func(t *testing.T) {
+		proxy := crudp.NewProxyHandler(1).Of(&Mirror{})
+		client := newClient(proxy)
+		if proxy.HandlerName() != "mirror" {
+			t.Errorf("expected the ByEnv name, got %q", proxy.HandlerName())
+		}
+		if err := client.SelfCheck(); err != nil {
+			t.Errorf("unexpected self-check error: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		var creator crudp.Creator = proxy
+		result := creator.Create(ctx, &Mirror{Name: "Ana"}, &Mirror{Name: "Luis"})
+		pr, ok := result.(crudp.PacketResult)
+		if !ok {
+			t.Fatalf("expected a PacketResult, got %v", result)
+		}
+		var names []string
+		if err := client.DecodeData(&pr.Packet, 0, &names); err != nil || len(names) != 2 || names[1] != "Luis" {
+			t.Errorf("expected both items, got %v (%v)", names, err)
+		}
+	})
+
+	t.Run("Error Results", func(t *testing.T) {
+		proxy := crudp.NewProxyHandler(1)
+		newClient(proxy)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		var re *crudp.ResultError
+		if err, _ := proxy.Read(ctx).(error); !errors.As(err, &re) { // Read not implemented
+			t.Errorf("expected a ResultError, got %v", err)
+		}
+	})
+
+	t.Run("Unregistered And Misplaced", func(t *testing.T) {
+		proxy := crudp.NewProxyHandler(1)
+		if _, ok := proxy.Read(context.Background()).(error); !ok {
+			t.Error("expected an error from an unregistered proxy")
+		}
+
+		client := newClient(crudp.NewProxyHandler(0))
+		if err := client.SelfCheck(); err == nil {
+			t.Error("expected a self-check error for a proxy at another ID")
+		}
+	})
+}
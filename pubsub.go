@@ -0,0 +1,234 @@
+package crudp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// PubSub relays broadcasts between server instances (Config.PubSub)
+// Every broadcast is delivered to the local subscribers and published; each
+// instance delivers the messages published by the others to its subscribers.
+// Adapters: NewMemoryPubSub (one process), pubsub/redis and pubsub/nats.
+type PubSub interface {
+	// Publish sends msg to every instance subscribed to the backend
+	Publish(msg []byte) error
+	// Subscribe calls fn for every published message, including our own,
+	// until stop is called
+	Subscribe(fn func(msg []byte)) (stop func(), err error)
+}
+
+// busVersion prefixes relayed messages so the format can evolve
+const busVersion byte = 1
+
+// Bus message kinds
+const (
+	busEvent byte = 'e' // Broadcast
+	busJoin  byte = 'j' // First connection of a user on the sending node
+	busLeave byte = 'l' // Last connection of a user on the sending node
+	busHello byte = 'h' // Node started: the others announce their users
+	busBye   byte = 'b' // Node closed: forget its users
+	busMaint byte = 'm' // Maintenance mode changed
+)
+
+// busMessage is a message relayed between instances
+type busMessage struct {
+	kind   byte
+	node   string
+	tenant string
+	user   string           // busJoin, busLeave
+	ev     Event            // busEvent
+	maint  MaintenanceEvent // busMaint
+}
+
+// startPubSub subscribes to Config.PubSub (called by New)
+func (cp *CrudP) startPubSub() error {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return err
+	}
+	cp.node = hex.EncodeToString(id[:])
+	if cp.config.Profile != "" {
+		cp.node = cp.config.Profile + "/" + cp.node // See busProfile
+	}
+
+	stop, err := cp.config.PubSub.Subscribe(cp.receiveBus)
+	if err != nil {
+		return Err(Fmt("pubsub subscribe: %v", err))
+	}
+	cp.stopPubSub = stop
+	cp.publishBus(busMessage{kind: busHello})
+	return nil
+}
+
+// Close stops receiving broadcasts from Config.PubSub, so the other
+// instances forget the users connected to this one, and stops the schedules
+func (cp *CrudP) Close() error {
+	cp.schedules.close()
+	if cp.stopPubSub != nil {
+		cp.publishBus(busMessage{kind: busBye})
+		cp.stopPubSub()
+		cp.stopPubSub = nil
+	}
+	return nil
+}
+
+// broadcast delivers an event of tenant to the local subscribers and to the
+// other instances through Config.PubSub
+func (cp *CrudP) broadcast(tenant string, ev Event) {
+	cp.hub.publish(tenant, ev)
+	cp.publishBus(busMessage{kind: busEvent, tenant: tenant, ev: ev})
+}
+
+// publishBus sends m to the other instances, no-op without Config.PubSub
+func (cp *CrudP) publishBus(m busMessage) {
+	if cp.config.PubSub == nil {
+		return
+	}
+	m.node = cp.node
+	if err := cp.config.PubSub.Publish(appendBusMessage(nil, &m)); err != nil {
+		cp.log.Error("pubsub publish failed", "kind", string(m.kind), "error", err)
+	}
+}
+
+// receiveBus handles a message published by another instance
+func (cp *CrudP) receiveBus(msg []byte) {
+	m, err := readBusMessage(msg)
+	if err != nil {
+		cp.log.Warn("pubsub message dropped", "error", err)
+		return
+	}
+	if m.node == cp.node {
+		return // Already delivered locally
+	}
+	if busProfile(m.node) != cp.config.Profile {
+		return // Another protocol sharing the backend
+	}
+
+	switch m.kind {
+	case busEvent:
+		cp.hub.publish(m.tenant, m.ev)
+	case busJoin:
+		cp.presence.setRemote(m.node, m.tenant, m.user, true)
+	case busLeave:
+		cp.presence.setRemote(m.node, m.tenant, m.user, false)
+	case busHello:
+		for _, u := range cp.presence.local() {
+			cp.publishBus(busMessage{kind: busJoin, tenant: u.tenant, user: u.id})
+		}
+	case busBye:
+		cp.presence.dropNode(m.node)
+	case busMaint:
+		cp.applyMaintenance(m.maint)
+	}
+}
+
+// busProfile returns the Config.Profile of the node that sent a message
+func busProfile(node string) string {
+	if i := strings.LastIndexByte(node, '/'); i >= 0 {
+		return node[:i]
+	}
+	return ""
+}
+
+// Bus message: version kind node tenant, then by kind (frame.go encoding):
+//
+//	event      = channel handlerID data
+//	join/leave = user
+//	maint      = on message
+func appendBusMessage(dst []byte, m *busMessage) []byte {
+	dst = append(dst, busVersion, m.kind)
+	dst = appendString(dst, m.node)
+	dst = appendString(dst, m.tenant)
+	switch m.kind {
+	case busEvent:
+		dst = appendString(dst, m.ev.Channel)
+		dst = append(dst, m.ev.HandlerID)
+		dst = binary.AppendUvarint(dst, uint64(len(m.ev.Data)))
+		dst = append(dst, m.ev.Data...)
+	case busJoin, busLeave:
+		dst = appendString(dst, m.user)
+	case busMaint:
+		dst = appendBool(dst, m.maint.On)
+		dst = appendString(dst, m.maint.Message)
+	}
+	return dst
+}
+
+func readBusMessage(msg []byte) (busMessage, error) {
+	var m busMessage
+	if len(msg) < 2 || msg[0] != busVersion {
+		return m, Errf("pubsub: unknown message version")
+	}
+	m.kind = msg[1]
+	r := &reader{buf: msg[2:]}
+	m.node = r.string()
+	m.tenant = r.string()
+	switch m.kind {
+	case busEvent:
+		m.ev.Channel = r.string()
+		m.ev.HandlerID = r.byte()
+		m.ev.Data = append([]byte(nil), r.bytes()...)
+	case busJoin, busLeave:
+		m.user = r.string()
+	case busMaint:
+		m.maint.On = r.byte() == 1
+		m.maint.Message = r.string()
+	case busHello, busBye:
+	default:
+		return m, Err(Fmt("pubsub: unknown message kind %c", m.kind))
+	}
+	return m, r.err
+}
+
+// memoryPubSub relays messages between instances of one process
+type memoryPubSub struct {
+	mu     sync.Mutex
+	subs   []memorySub
+	nextID int
+}
+
+type memorySub struct {
+	id int
+	fn func([]byte)
+}
+
+// NewMemoryPubSub returns an in-process PubSub shared by several instances
+// (tests, or several CrudP mounted in one server)
+func NewMemoryPubSub() PubSub {
+	return &memoryPubSub{}
+}
+
+func (m *memoryPubSub) Publish(msg []byte) error {
+	m.mu.Lock()
+	subs := m.subs
+	m.mu.Unlock()
+	for _, s := range subs {
+		s.fn(msg)
+	}
+	return nil
+}
+
+func (m *memoryPubSub) Subscribe(fn func([]byte)) (func(), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	id := m.nextID
+	m.subs = append(m.subs[:len(m.subs):len(m.subs)], memorySub{id: id, fn: fn}) // Copy-on-write
+
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		kept := make([]memorySub, 0, len(m.subs))
+		for _, s := range m.subs {
+			if s.id != id {
+				kept = append(kept, s)
+			}
+		}
+		m.subs = kept
+	}, nil
+}
@@ -0,0 +1,261 @@
+//go:build !wasm
+
+// Package nats relays crudp broadcasts between server instances through a
+// NATS subject.
+//
+// It speaks the NATS text protocol directly over net.Conn, so no NATS client
+// is linked.
+//
+//	cfg.PubSub = nats.New("localhost:4222", "crudp.events")
+package nats
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// PubSub implements crudp.PubSub over one NATS subject
+// Connections are opened on first use and re-dialed after errors.
+type PubSub struct {
+	Addr    string
+	Subject string
+	Token   string        // auth_token sent in CONNECT, "" = none
+	Timeout time.Duration // Dial and handshake timeout. Default: 5s
+
+	mu  sync.Mutex // Guards the publish connection
+	pub *conn
+}
+
+// New returns a PubSub for the NATS server at addr (host:port)
+func New(addr, subject string) *PubSub {
+	return &PubSub{Addr: addr, Subject: subject}
+}
+
+func (p *PubSub) timeout() time.Duration {
+	if p.Timeout > 0 {
+		return p.Timeout
+	}
+	return 5 * time.Second
+}
+
+// conn is a NATS connection; writes are serialized so the reader can answer
+// server PINGs while publishing
+type conn struct {
+	net.Conn
+	r  *bufio.Reader
+	mu sync.Mutex
+}
+
+func (c *conn) write(b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.Write(b)
+	return err
+}
+
+// dial connects, reads INFO, sends CONNECT and waits for the PONG
+// confirming it was accepted
+func (p *PubSub) dial() (*conn, error) {
+	nc, err := net.DialTimeout("tcp", p.Addr, p.timeout())
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{Conn: nc, r: bufio.NewReader(nc)}
+	nc.SetDeadline(time.Now().Add(p.timeout()))
+
+	line, err := readLine(c.r)
+	if err == nil && !hasPrefix(line, "INFO") {
+		err = Err(Fmt("nats: expected INFO, got %s", line))
+	}
+	if err == nil {
+		connect := `CONNECT {"verbose":false,"pedantic":false,"name":"crudp"`
+		if p.Token != "" {
+			connect += `,"auth_token":` + strconv.Quote(p.Token)
+		}
+		err = c.write([]byte(connect + "}\r\nPING\r\n"))
+	}
+	for err == nil {
+		if line, err = readLine(c.r); err != nil {
+			break
+		}
+		if hasPrefix(line, "PONG") {
+			nc.SetDeadline(time.Time{})
+			return c, nil
+		}
+		if hasPrefix(line, "-ERR") {
+			err = Err(Fmt("nats: %s", line))
+		}
+	}
+	nc.Close()
+	return nil, err
+}
+
+// Publish sends msg with PUB
+func (p *PubSub) Publish(msg []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pub == nil {
+		c, err := p.dial()
+		if err != nil {
+			return err
+		}
+		p.pub = c
+		go p.serve(c, nil) // Answers PINGs, notices dropped connections
+	}
+
+	buf := append([]byte("PUB "), p.Subject...)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, int64(len(msg)), 10)
+	buf = append(buf, "\r\n"...)
+	buf = append(buf, msg...)
+	buf = append(buf, "\r\n"...)
+
+	p.pub.SetWriteDeadline(time.Now().Add(p.timeout()))
+	if err := p.pub.write(buf); err != nil {
+		p.pub.Close() // Re-dial on the next publish
+		p.pub = nil
+		return err
+	}
+	return nil
+}
+
+// Subscribe calls fn for every message on the subject until stop is called
+// The subscription connection is re-dialed after errors.
+func (p *PubSub) Subscribe(fn func(msg []byte)) (stop func(), err error) {
+	c, err := p.subscribe()
+	if err != nil {
+		return nil, err
+	}
+	sub := &subscription{conn: c}
+
+	go func() {
+		for {
+			p.serve(c, fn)
+			for {
+				if sub.done() {
+					return
+				}
+				time.Sleep(time.Second)
+				next, err := p.subscribe()
+				if err != nil {
+					continue
+				}
+				if !sub.replace(next) {
+					return
+				}
+				c = next
+				break
+			}
+		}
+	}()
+	return sub.stop, nil
+}
+
+// subscribe dials a connection subscribed to the subject
+func (p *PubSub) subscribe() (*conn, error) {
+	c, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.write([]byte("SUB " + p.Subject + " 1\r\n")); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// subscription owns the current subscribe connection
+type subscription struct {
+	mu      sync.Mutex
+	conn    *conn
+	stopped bool
+}
+
+func (s *subscription) done() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+// replace swaps in a re-dialed connection, false (and closes it) if stopped
+func (s *subscription) replace(c *conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		c.Close()
+		return false
+	}
+	s.conn = c
+	return true
+}
+
+// stop closes the connection, which unblocks serve
+func (s *subscription) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	s.conn.Close()
+}
+
+// serve reads server messages until the connection fails, answering PINGs
+// and passing MSG payloads to fn
+func (p *PubSub) serve(c *conn, fn func([]byte)) {
+	defer c.Close()
+	for {
+		line, err := readLine(c.r)
+		if err != nil {
+			return // Closed by stop, or dropped: the caller re-dials
+		}
+		switch {
+		case hasPrefix(line, "PING"):
+			if c.write([]byte("PONG\r\n")) != nil {
+				return
+			}
+		case hasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			n, err := strconv.Atoi(lastField(line))
+			if err != nil || n < 0 {
+				return
+			}
+			payload := make([]byte, n+2)
+			if _, err := io.ReadFull(c.r, payload); err != nil {
+				return
+			}
+			if fn != nil {
+				fn(payload[:n])
+			}
+		}
+	}
+}
+
+// readLine reads a CRLF terminated line without the terminator
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", Errf("nats: malformed line")
+	}
+	return line[:len(line)-2], nil
+}
+
+func hasPrefix(s, prefix string) bool {
+	return len(s) >= len(prefix) && s[:len(prefix)] == prefix
+}
+
+func lastField(s string) string {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] == ' ' {
+			return s[i+1:]
+		}
+	}
+	return s
+}
@@ -0,0 +1,130 @@
+//go:build !wasm
+
+package nats
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeNATS implements CONNECT, PING, SUB and PUB for one subject
+type fakeNATS struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	subs []net.Conn
+}
+
+func newFakeNATS(t *testing.T) *fakeNATS {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeNATS{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(c)
+		}
+	}()
+	return f
+}
+
+func (f *fakeNATS) serve(c net.Conn) {
+	defer c.Close()
+	c.Write([]byte("INFO {\"server_id\":\"fake\"}\r\n"))
+	r := bufio.NewReader(c)
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return
+		}
+		switch {
+		case hasPrefix(line, "PING"):
+			c.Write([]byte("PONG\r\n"))
+		case hasPrefix(line, "SUB "):
+			f.mu.Lock()
+			f.subs = append(f.subs, c)
+			f.mu.Unlock()
+			c.Write([]byte("PING\r\n")) // The client must answer
+		case hasPrefix(line, "PUB "):
+			n, _ := strconv.Atoi(lastField(line))
+			payload := make([]byte, n+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			msg := append([]byte("MSG crudp.events 1 "+strconv.Itoa(n)+"\r\n"), payload...)
+			f.mu.Lock()
+			subs := f.subs
+			f.mu.Unlock()
+			for _, s := range subs {
+				s.Write(msg)
+			}
+		}
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	f := newFakeNATS(t)
+	ps := New(f.ln.Addr().String(), "crudp.events")
+
+	got := make(chan []byte, 2)
+	stop, err := ps.Subscribe(func(msg []byte) { got <- msg })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binary := []byte{1, 0, '\r', '\n', 0xff}
+	if err := ps.Publish(binary); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-got:
+		if string(msg) != string(binary) {
+			t.Fatalf("expected %v, got %v", binary, msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not received")
+	}
+
+	stop()
+	if err := ps.Publish([]byte("after stop")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-got:
+		t.Fatalf("received %q after stop", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDialRejected(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.Write([]byte("INFO {}\r\n-ERR 'Authorization Violation'\r\n"))
+		io.Copy(io.Discard, c)
+	}()
+
+	ps := New(ln.Addr().String(), "crudp.events")
+	ps.Timeout = time.Second
+	if _, err := ps.Subscribe(func([]byte) {}); err == nil {
+		t.Fatal("expected authorization error")
+	}
+}
@@ -0,0 +1,260 @@
+//go:build !wasm
+
+// Package redis relays crudp broadcasts between server instances through
+// Redis PUBLISH/SUBSCRIBE.
+//
+// It speaks RESP directly over net.Conn, so no Redis client is linked.
+//
+//	cfg.PubSub = redis.New("localhost:6379", "crudp")
+package redis
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// PubSub implements crudp.PubSub over one Redis channel
+// Connections are opened on first use and re-dialed after errors.
+type PubSub struct {
+	Addr     string
+	Channel  string
+	Password string        // AUTH before use, "" = none
+	Timeout  time.Duration // Dial and publish timeout. Default: 5s
+
+	mu  sync.Mutex // Guards the publish connection
+	pub net.Conn
+	r   *bufio.Reader
+}
+
+// New returns a PubSub for the Redis server at addr
+func New(addr, channel string) *PubSub {
+	return &PubSub{Addr: addr, Channel: channel}
+}
+
+func (p *PubSub) timeout() time.Duration {
+	if p.Timeout > 0 {
+		return p.Timeout
+	}
+	return 5 * time.Second
+}
+
+// dial connects and authenticates
+func (p *PubSub) dial() (net.Conn, *bufio.Reader, error) {
+	conn, err := net.DialTimeout("tcp", p.Addr, p.timeout())
+	if err != nil {
+		return nil, nil, err
+	}
+	r := bufio.NewReader(conn)
+	if p.Password != "" {
+		conn.SetDeadline(time.Now().Add(p.timeout()))
+		if err := writeCommand(conn, "AUTH", []byte(p.Password)); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		if _, err := readReply(r); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		conn.SetDeadline(time.Time{})
+	}
+	return conn, r, nil
+}
+
+// Publish sends msg with PUBLISH
+func (p *PubSub) Publish(msg []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pub == nil {
+		conn, r, err := p.dial()
+		if err != nil {
+			return err
+		}
+		p.pub, p.r = conn, r
+	}
+
+	p.pub.SetDeadline(time.Now().Add(p.timeout()))
+	err := writeCommand(p.pub, "PUBLISH", []byte(p.Channel), msg)
+	if err == nil {
+		_, err = readReply(p.r)
+	}
+	if err != nil {
+		p.pub.Close() // Re-dial on the next publish
+		p.pub, p.r = nil, nil
+	}
+	return err
+}
+
+// Subscribe calls fn for every message on the channel until stop is called
+// The subscription connection is re-dialed after errors.
+func (p *PubSub) Subscribe(fn func(msg []byte)) (stop func(), err error) {
+	conn, r, err := p.subscribe()
+	if err != nil {
+		return nil, err
+	}
+	sub := &subscription{conn: conn}
+
+	go func() {
+		for {
+			p.receive(r, fn)
+			for {
+				if sub.done() {
+					return
+				}
+				time.Sleep(time.Second)
+				c, rd, err := p.subscribe()
+				if err != nil {
+					continue
+				}
+				if !sub.replace(c) {
+					return
+				}
+				r = rd
+				break
+			}
+		}
+	}()
+	return sub.stop, nil
+}
+
+// subscription owns the current subscribe connection
+type subscription struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	stopped bool
+}
+
+func (s *subscription) done() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+// replace swaps in a re-dialed connection, false (and closes it) if stopped
+func (s *subscription) replace(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		conn.Close()
+		return false
+	}
+	s.conn = conn
+	return true
+}
+
+// stop closes the connection, which unblocks receive
+func (s *subscription) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	s.conn.Close()
+}
+
+// subscribe dials a connection in subscribe mode
+func (p *PubSub) subscribe() (net.Conn, *bufio.Reader, error) {
+	conn, r, err := p.dial()
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Now().Add(p.timeout()))
+	if err := writeCommand(conn, "SUBSCRIBE", []byte(p.Channel)); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if _, err := readReply(r); err != nil { // ["subscribe", channel, count]
+		conn.Close()
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, r, nil
+}
+
+// receive reads pushed messages until the connection fails
+func (p *PubSub) receive(r *bufio.Reader, fn func([]byte)) {
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return // Closed by stop, or dropped: the caller re-dials
+		}
+		push, ok := reply.([]any)
+		if !ok || len(push) != 3 {
+			continue
+		}
+		if kind, _ := push[0].([]byte); string(kind) != "message" {
+			continue
+		}
+		if msg, ok := push[2].([]byte); ok {
+			fn(msg)
+		}
+	}
+}
+
+// writeCommand writes a RESP array of bulk strings
+func writeCommand(conn net.Conn, name string, args ...[]byte) error {
+	buf := append([]byte{'*'}, strconv.Itoa(len(args)+1)...)
+	buf = append(buf, "\r\n"...)
+	buf = appendBulk(buf, []byte(name))
+	for _, arg := range args {
+		buf = appendBulk(buf, arg)
+	}
+	_, err := conn.Write(buf)
+	return err
+}
+
+func appendBulk(buf, b []byte) []byte {
+	buf = append(buf, '$')
+	buf = strconv.AppendInt(buf, int64(len(b)), 10)
+	buf = append(buf, "\r\n"...)
+	buf = append(buf, b...)
+	return append(buf, "\r\n"...)
+}
+
+// readReply reads one RESP value: []byte, int64, string (status) or []any
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, Errf("redis: malformed reply")
+	}
+	body := string(line[1 : len(line)-2])
+
+	switch line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, Err(Fmt("redis: %s", body))
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err // Null bulk string
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, Err(Fmt("redis: unknown reply type %c", line[0]))
+}
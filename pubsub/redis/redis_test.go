@@ -0,0 +1,116 @@
+//go:build !wasm
+
+package redis
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis implements SUBSCRIBE and PUBLISH for one process
+type fakeRedis struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	subs []net.Conn
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(c)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		cmd, _ := reply.([]any)
+		if len(cmd) < 2 {
+			return
+		}
+		name, _ := cmd[0].([]byte)
+		switch string(name) {
+		case "SUBSCRIBE":
+			f.mu.Lock()
+			f.subs = append(f.subs, c)
+			f.mu.Unlock()
+			c.Write(append(appendBulk([]byte("*3\r\n"), []byte("subscribe")), appendBulk(nil, cmd[1].([]byte))...))
+			c.Write([]byte(":1\r\n"))
+		case "PUBLISH":
+			f.mu.Lock()
+			subs := f.subs
+			f.mu.Unlock()
+			push := appendBulk([]byte("*3\r\n"), []byte("message"))
+			push = appendBulk(push, cmd[1].([]byte))
+			push = appendBulk(push, cmd[2].([]byte))
+			for _, s := range subs {
+				s.Write(push)
+			}
+			c.Write([]byte(":1\r\n"))
+		default:
+			c.Write([]byte("-ERR unknown command\r\n"))
+		}
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	f := newFakeRedis(t)
+	ps := New(f.ln.Addr().String(), "crudp")
+
+	got := make(chan []byte, 2)
+	stop, err := ps.Subscribe(func(msg []byte) { got <- msg })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binary := []byte{1, 0, '\r', '\n', 0xff}
+	if err := ps.Publish(binary); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-got:
+		if string(msg) != string(binary) {
+			t.Fatalf("expected %v, got %v", binary, msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not received")
+	}
+
+	stop()
+	if err := ps.Publish([]byte("after stop")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-got:
+		t.Fatalf("received %q after stop", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestPublishError(t *testing.T) {
+	ps := New("127.0.0.1:1", "crudp")
+	ps.Timeout = 100 * time.Millisecond
+	if err := ps.Publish([]byte("x")); err == nil {
+		t.Fatal("expected dial error")
+	}
+}
@@ -0,0 +1,89 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+func PubSubShared(t *testing.T) {
+	newNode := func(bus crudp.PubSub) *crudp.CrudP {
+		cfg := crudp.DefaultConfig()
+		cfg.PubSub = bus
+		cfg.UserProvider = orgUsers{}
+		cp := crudp.New(cfg, crudp.WithHandlers(&sseHandler{}))
+		if err := cp.Err(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { cp.Close() })
+		return cp
+	}
+
+	t.Run("Broadcasts Reach Every Node Once", func(t *testing.T) {
+		bus := crudp.NewMemoryPubSub()
+		a, b := newNode(bus), newNode(bus)
+
+		var onA, onB []crudp.Event
+		a.Listen(func(ev crudp.Event) { onA = append(onA, ev) })
+		b.Listen(func(ev crudp.Event) { onB = append(onB, ev) })
+
+		processOne(t, a, crudp.Packet{Action: 'c'})
+
+		if len(onA) != 2 || len(onB) != 2 {
+			t.Fatalf("expected 2 events per node, got a=%d b=%d", len(onA), len(onB))
+		}
+		if onB[0].Channel != "channel1" || string(onB[0].Data) != string(onA[0].Data) {
+			t.Errorf("relayed event differs: %+v vs %+v", onB[0], onA[0])
+		}
+	})
+
+	t.Run("Profiles Share The Backend", func(t *testing.T) {
+		bus := crudp.NewMemoryPubSub()
+		node := func(profile string) *crudp.CrudP {
+			cfg := crudp.ProfileConfig(profile)
+			cfg.PubSub = bus
+			cp := crudp.New(cfg, crudp.WithHandlers(&sseHandler{}))
+			t.Cleanup(func() { cp.Close() })
+			return cp
+		}
+		admin, admin2, public := node("admin"), node("admin"), node("public")
+
+		onAdmin, onPublic := 0, 0
+		admin2.Listen(func(crudp.Event) { onAdmin++ })
+		public.Listen(func(crudp.Event) { onPublic++ })
+		processOne(t, admin, crudp.Packet{Action: 'c'})
+
+		if onAdmin != 2 || onPublic != 0 {
+			t.Errorf("expected admin=2 public=0, got admin=%d public=%d", onAdmin, onPublic)
+		}
+	})
+
+	t.Run("Tenant Survives Relay", func(t *testing.T) {
+		bus := crudp.NewMemoryPubSub()
+		a, b := newNode(bus), newNode(bus)
+
+		acme, globex := 0, 0
+		b.ListenAs(context.WithValue(context.Background(), orgKey{}, "acme"), func(crudp.Event) { acme++ }, "*")
+		b.ListenAs(context.WithValue(context.Background(), orgKey{}, "globex"), func(crudp.Event) { globex++ }, "*")
+
+		processIn(t, a, "acme", crudp.Packet{Action: 'c'})
+
+		if acme != 2 || globex != 0 {
+			t.Errorf("expected acme=2 globex=0, got acme=%d globex=%d", acme, globex)
+		}
+	})
+
+	t.Run("Close Stops Relay", func(t *testing.T) {
+		bus := crudp.NewMemoryPubSub()
+		a, b := newNode(bus), newNode(bus)
+		got := 0
+		b.Listen(func(crudp.Event) { got++ })
+
+		b.Close()
+		processOne(t, a, crudp.Packet{Action: 'c'})
+		if got != 0 {
+			t.Errorf("closed node received %d events", got)
+		}
+	})
+}
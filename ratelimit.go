@@ -0,0 +1,183 @@
+package crudp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// RateLimiter decides whether a packet may reach its handler (optional)
+// Return a *RateLimitError to send a retry-after hint to the client;
+// any other error is reported as is.
+type RateLimiter interface {
+	Allow(ctx context.Context, handlerID uint8, action byte) error
+}
+
+// RateLimitError is returned by a RateLimiter when a client is throttled
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return Fmt("rate limited: retry after %dms", e.RetryAfter.Milliseconds())
+}
+
+type ctxKey uint8
+
+const (
+	remoteAddrKey ctxKey = iota
+	clientKeyKey
+	signerKey
+	localeKey
+)
+
+// WithRemoteAddr stores the client address in ctx (set by BuildRouter)
+func WithRemoteAddr(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, remoteAddrKey, addr)
+}
+
+// RemoteAddr returns the client address stored by WithRemoteAddr
+func RemoteAddr(ctx context.Context) string {
+	addr, _ := ctx.Value(remoteAddrKey).(string)
+	return addr
+}
+
+// ClientKey returns the identity used for rate limiting: the UserProvider
+// user ID if any, then the signing key ID, otherwise the remote address
+func ClientKey(ctx context.Context) string {
+	key, _ := ctx.Value(clientKeyKey).(string)
+	return key
+}
+
+// withClientKey resolves the client identity once per batch
+func (cp *CrudP) withClientKey(ctx context.Context) context.Context {
+	var key string
+	if cp.config.UserProvider != nil {
+		key = cp.config.UserProvider.GetUserID(ctx)
+	}
+	if key == "" {
+		if id := SignedBy(ctx); id != "" {
+			key = "key:" + id
+		}
+	}
+	if key == "" {
+		key = RemoteAddr(ctx)
+	}
+	return context.WithValue(ctx, clientKeyKey, key)
+}
+
+// checkRateLimit returns a throttled result when the configured limiter rejects the packet
+func (cp *CrudP) checkRateLimit(ctx context.Context, packet *Packet) (PacketResult, error) {
+	limiter := cp.config.RateLimiter
+	if limiter == nil {
+		return PacketResult{}, nil
+	}
+
+	err := limiter.Allow(ctx, packet.HandlerID, packet.Action)
+	if err == nil {
+		return PacketResult{}, nil
+	}
+
+	cp.log.Warn("rate limited", "client", ClientKey(ctx), "handler", packet.HandlerID, "action", string(packet.Action))
+	pr := errorResult(packet, err)
+	pr.Data = nil
+	if rl, ok := err.(*RateLimitError); ok {
+		pr.MessageType = uint8(Msg.Warning)
+		pr.RetryAfter = retryAfterMs(rl.RetryAfter)
+	}
+	return pr, err
+}
+
+// retryAfterMs rounds d up to whole ms so a throttled result never reports 0
+func retryAfterMs(d time.Duration) int {
+	return int((d + time.Millisecond - 1) / time.Millisecond)
+}
+
+// maxBuckets bounds memory: the least recently used bucket is dropped when
+// a new client would exceed it
+const maxBuckets = 10000
+
+// TokenBucket is a RateLimiter allowing Rate packets per second with bursts
+// of up to Burst packets for each client (see ClientKey).
+type TokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets []bucket // slice, no maps for TinyGo
+	now     func() time.Time
+}
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a limiter refilling rate tokens per second up to burst
+// Example: crudp.NewTokenBucket(10, 20) allows 10 packets/s with bursts of 20.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:  rate,
+		burst: float64(burst),
+		now:   time.Now,
+	}
+}
+
+// Allow consumes one token for the client in ctx
+func (tb *TokenBucket) Allow(ctx context.Context, handlerID uint8, action byte) error {
+	key := ClientKey(ctx)
+	now := tb.now()
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	b := tb.bucket(key, now)
+	b.tokens = tb.refill(b, now)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return nil
+	}
+
+	if tb.rate <= 0 {
+		return &RateLimitError{RetryAfter: time.Second}
+	}
+	wait := time.Duration((1 - b.tokens) / tb.rate * float64(time.Second))
+	return &RateLimitError{RetryAfter: wait}
+}
+
+// bucket returns the bucket of key, adding a full one for a new client in
+// place of the least recently used once maxBuckets is reached
+func (tb *TokenBucket) bucket(key string, now time.Time) *bucket {
+	oldest := 0
+	for i := range tb.buckets {
+		if tb.buckets[i].key == key {
+			return &tb.buckets[i]
+		}
+		if tb.buckets[i].last.Before(tb.buckets[oldest].last) {
+			oldest = i
+		}
+	}
+	fresh := bucket{key: key, tokens: tb.burst, last: now}
+	if len(tb.buckets) < maxBuckets {
+		tb.buckets = append(tb.buckets, fresh)
+		return &tb.buckets[len(tb.buckets)-1]
+	}
+	tb.buckets[oldest] = fresh
+	return &tb.buckets[oldest]
+}
+
+func (tb *TokenBucket) refill(b *bucket, now time.Time) float64 {
+	tokens := b.tokens + now.Sub(b.last).Seconds()*tb.rate
+	if tokens > tb.burst {
+		tokens = tb.burst
+	}
+	return tokens
+}
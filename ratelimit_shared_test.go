@@ -0,0 +1,118 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// userFromCtx identifies clients by a context value
+type userFromCtx struct{}
+
+type userKey struct{}
+
+func (userFromCtx) GetUserID(ctx context.Context) string {
+	id, _ := ctx.Value(userKey{}).(string)
+	return id
+}
+
+func processAs(t *testing.T, cp *crudp.CrudP, user string, count int) []crudp.PacketResult {
+	t.Helper()
+	packets := make([]crudp.Packet, count)
+	for i := range packets {
+		packets[i] = crudp.Packet{Action: 'r'}
+	}
+	batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: packets})
+
+	ctx := context.WithValue(context.Background(), userKey{}, user)
+	resp, err := cp.ProcessBatch(ctx, batch)
+	if err != nil {
+		t.Fatalf("ProcessBatch error: %v", err)
+	}
+	var batchResp crudp.BatchResponse
+	if err := cp.Codec().Decode(resp, &batchResp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	return batchResp.Results
+}
+
+func RateLimitShared(t *testing.T) {
+	t.Run("Token Bucket Per User", func(t *testing.T) {
+		var trace []string
+		cfg := crudp.DefaultConfig()
+		cfg.UserProvider = userFromCtx{}
+		cfg.RateLimiter = crudp.NewTokenBucket(0.001, 2)
+		cp := crudp.New(cfg)
+		cp.RegisterHandler(&guardedHandler{trace: &trace})
+
+		results := processAs(t, cp, "alice", 3)
+		if results[0].MessageType != uint8(Msg.Success) || results[1].MessageType != uint8(Msg.Success) {
+			t.Fatalf("burst must be allowed, got %+v", results)
+		}
+		throttled := results[2]
+		if throttled.MessageType != uint8(Msg.Warning) || throttled.RetryAfter <= 0 {
+			t.Errorf("expected throttled result with retry-after, got %+v", throttled)
+		}
+		if len(trace) != 4 { // own + handler for each allowed packet
+			t.Errorf("handler must not run when throttled, got %v", trace)
+		}
+
+		// Other users have their own bucket
+		results = processAs(t, cp, "bob", 1)
+		if results[0].MessageType != uint8(Msg.Success) {
+			t.Errorf("expected bob to be allowed, got %s", results[0].Message)
+		}
+	})
+
+	t.Run("Token Bucket Evicts Least Recently Used", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.UserProvider = userFromCtx{}
+		cfg.RateLimiter = crudp.NewTokenBucket(0.001, 1)
+		cp := crudp.New(cfg)
+		var trace []string
+		cp.RegisterHandler(&guardedHandler{trace: &trace})
+
+		if results := processAs(t, cp, "alice", 2); results[1].MessageType != uint8(Msg.Warning) {
+			t.Fatalf("expected alice throttled, got %+v", results[1])
+		}
+		// 10000 buckets are kept: the last new client takes alice's
+		for i := range 10000 {
+			processAs(t, cp, Fmt("user%d", i), 1)
+		}
+		if results := processAs(t, cp, "alice", 1); results[0].MessageType != uint8(Msg.Success) {
+			t.Errorf("expected alice's bucket evicted, got %s", results[0].Message)
+		}
+		if results := processAs(t, cp, "user9999", 1); results[0].MessageType != uint8(Msg.Warning) {
+			t.Errorf("expected a recent client to keep its bucket, got %s", results[0].Message)
+		}
+	})
+
+	t.Run("Custom Limiter Error", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.RateLimiter = limiterFunc(func(ctx context.Context, handlerID uint8, action byte) error {
+			if action == 'r' {
+				return Err("reads disabled")
+			}
+			return nil
+		})
+		cp := crudp.New(cfg)
+		var trace []string
+		cp.RegisterHandler(&guardedHandler{trace: &trace})
+
+		result := processOne(t, cp, crudp.Packet{Action: 'r', ReqID: "r1"})
+		if result.MessageType != uint8(Msg.Error) || result.Message != "reads disabled" || result.RetryAfter != 0 {
+			t.Errorf("expected custom error result, got %+v", result)
+		}
+		if result.ReqID != "r1" {
+			t.Errorf("expected ReqID echoed, got %q", result.ReqID)
+		}
+	})
+}
+
+type limiterFunc func(ctx context.Context, handlerID uint8, action byte) error
+
+func (f limiterFunc) Allow(ctx context.Context, handlerID uint8, action byte) error {
+	return f(ctx, handlerID, action)
+}
@@ -0,0 +1,139 @@
+package crudp
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// ReadCacheTTL caches successful Read results without touching handler code
+// Keys are handler names ("*" = every handler), values the time to live in
+// milliseconds. Results are keyed by handler, version, page, tenant and the
+// encoded packet data; a 'c', 'u', 'd' or 'p' packet to the handler drops
+// them. Cached results are shared by every caller of the tenant: don't cache
+// handlers whose Read depends on the user.
+//
+//	cfg.ReadCache = crudp.ReadCacheTTL{"product": 30000}
+type ReadCacheTTL map[string]int
+
+// TTL returns the time to live of the Reads of the handler called name, 0 = not cached
+func (c ReadCacheTTL) TTL(name string) time.Duration {
+	ms, ok := c[name]
+	if !ok {
+		ms = c["*"]
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// readCacheLimit is the number of results kept over all handlers
+const readCacheLimit = 256
+
+// readCache keeps Read results by handler and query (slice, no maps for TinyGo)
+type readCache struct {
+	mu      sync.Mutex
+	entries []readCacheEntry
+}
+
+type readCacheEntry struct {
+	handler uint8
+	key     string
+	expires time.Time
+	result  PacketResult
+}
+
+func (c *readCache) get(handler uint8, key string, now time.Time) (PacketResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range c.entries {
+		if e.handler == handler && e.key == key && now.Before(e.expires) {
+			return e.result, true
+		}
+	}
+	return PacketResult{}, false
+}
+
+func (c *readCache) put(handler uint8, key string, expires time.Time, result PacketResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	kept := c.entries[:0]
+	for _, e := range c.entries {
+		if now.Before(e.expires) && (e.handler != handler || e.key != key) {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) >= readCacheLimit {
+		// Drop oldest
+		kept = append(kept[:0], kept[1:]...)
+	}
+	c.entries = append(kept, readCacheEntry{handler: handler, key: key, expires: expires, result: result})
+}
+
+// invalidate drops the results of handler
+func (c *readCache) invalidate(handler uint8) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	kept := c.entries[:0]
+	for _, e := range c.entries {
+		if e.handler != handler {
+			kept = append(kept, e)
+		}
+	}
+	c.entries = kept
+}
+
+// InvalidateReads drops the cached Read results of the handler called name,
+// e.g. after its data changed outside crudp (see Config.ReadCache)
+func (cp *CrudP) InvalidateReads(name string) {
+	if id, ok := cp.HandlerID(name); ok {
+		cp.reads.invalidate(id)
+	}
+}
+
+// dispatchCached answers Reads from Config.ReadCache and drops the cached
+// Reads of a handler after its mutations
+func (cp *CrudP) dispatchCached(ctx context.Context, co *callOptions, handler *actionHandler, packet *Packet) (PacketResult, error) {
+	ttl := cp.config.ReadCache.TTL(handler.name)
+	if ttl <= 0 {
+		return cp.dispatchPacket(ctx, co, handler, packet)
+	}
+
+	// Reads after a write skip the cache, which may predate it
+	if packet.Action != 'r' || packet.ReadAfter != "" {
+		pr, err := cp.dispatchPacket(ctx, co, handler, packet)
+		if mutating(packet.Action) { // Even failed ones: bulk packets may have applied some items
+			cp.reads.invalidate(handler.index)
+		}
+		return pr, err
+	}
+
+	key := readKey(ctx, co.codec, packet)
+	if cached, ok := cp.reads.get(handler.index, key, time.Now()); ok {
+		echo := packet.echo()
+		echo.Data, echo.Attachments = cached.Data, cached.Attachments
+		cached.Packet = echo
+		cp.log.Debug("read cache hit", "handler", handler.name)
+		return cached, nil
+	}
+
+	pr, err := cp.dispatchPacket(ctx, co, handler, packet)
+	if err == nil && pr.MessageType == uint8(Msg.Success) {
+		cp.reads.put(handler.index, key, time.Now().Add(ttl), pr)
+	}
+	return pr, err
+}
+
+// readKey identifies the query of a Read packet within its handler
+func readKey(ctx context.Context, codec Codec, packet *Packet) string {
+	key := Fmt("%s|%d|", reflect.TypeOf(codec).String(), packet.Version)
+	if packet.Page != nil {
+		key += Fmt("%d,%d,%s|", packet.Page.Offset, packet.Page.Limit, packet.Page.Cursor)
+	}
+	for _, item := range packet.Data {
+		key += Fmt("%d:", len(item)) + string(item)
+	}
+	return tenantScoped(ctx, key)
+}
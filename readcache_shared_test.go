@@ -0,0 +1,97 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Catalog counts the Reads reaching it and returns the count
+type Catalog struct {
+	reads int
+}
+
+func (h *Catalog) Read(ctx context.Context, data ...any) any   { h.reads++; return h.reads }
+func (h *Catalog) Update(ctx context.Context, data ...any) any { return "ok" }
+
+func ReadCacheShared(t *testing.T) {
+	newCatalog := func(ttl int) (*crudp.CrudP, *Catalog) {
+		h := &Catalog{}
+		cfg := crudp.DefaultConfig()
+		cfg.ReadCache = crudp.ReadCacheTTL{"catalog": ttl}
+		return crudp.New(cfg, crudp.WithHandlers(h)), h
+	}
+	read := func(t *testing.T, cp *crudp.CrudP, reqID string, data ...[]byte) crudp.PacketResult {
+		t.Helper()
+		pr := processOne(t, cp, crudp.Packet{Action: 'r', ReqID: reqID, Data: data})
+		if pr.MessageType != uint8(Msg.Success) {
+			t.Fatalf("read failed: %s", pr.Message)
+		}
+		return pr
+	}
+
+	t.Run("Hits Share The Result", func(t *testing.T) {
+		cp, h := newCatalog(60000)
+		read(t, cp, "r1")
+		pr := read(t, cp, "r2")
+		if h.reads != 1 {
+			t.Errorf("expected 1 handler read, got %d", h.reads)
+		}
+		if pr.ReqID != "r2" || string(pr.Data[0]) != "1" {
+			t.Errorf("cached result %q %q", pr.ReqID, pr.Data)
+		}
+
+		read(t, cp, "r3", []byte(`{"query":"other"}`))
+		if h.reads != 2 {
+			t.Errorf("different data must miss, got %d reads", h.reads)
+		}
+	})
+
+	t.Run("Mutations Invalidate", func(t *testing.T) {
+		cp, h := newCatalog(60000)
+		read(t, cp, "r1")
+		processOne(t, cp, crudp.Packet{Action: 'u', ReqID: "u1"})
+		if pr := read(t, cp, "r2"); string(pr.Data[0]) != "2" {
+			t.Errorf("stale read after update: %q", pr.Data)
+		}
+
+		cp.InvalidateReads("catalog")
+		read(t, cp, "r3")
+		if h.reads != 3 {
+			t.Errorf("expected 3 handler reads, got %d", h.reads)
+		}
+	})
+
+	t.Run("Expires", func(t *testing.T) {
+		cp, h := newCatalog(5)
+		read(t, cp, "r1")
+		time.Sleep(10 * time.Millisecond)
+		read(t, cp, "r2")
+		if h.reads != 2 {
+			t.Errorf("expired result served, %d reads", h.reads)
+		}
+	})
+
+	t.Run("Tenants Do Not Share", func(t *testing.T) {
+		cp, h := newCatalog(60000)
+		for _, tenant := range []string{"a", "b", "a"} {
+			batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'r'}}})
+			if _, err := cp.ProcessBatch(crudp.WithTenant(context.Background(), tenant), batch); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if h.reads != 2 {
+			t.Errorf("expected one read per tenant, got %d", h.reads)
+		}
+	})
+
+	t.Run("Wildcard", func(t *testing.T) {
+		ttl := crudp.ReadCacheTTL{"*": 1000, "live": 0}
+		if ttl.TTL("catalog") != time.Second || ttl.TTL("live") != 0 {
+			t.Errorf("TTL %v %v", ttl.TTL("catalog"), ttl.TTL("live"))
+		}
+	})
+}
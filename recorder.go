@@ -0,0 +1,121 @@
+package crudp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"sync"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// Recorder persists the raw batches handled by ProcessBatch (optional)
+// Set it in Config.Recorder; errors are logged and never fail the batch.
+type Recorder interface {
+	Record(request, response []byte) error
+}
+
+// recordMagic starts every record written by NewRecorder
+const recordMagic byte = 'R'
+
+// writerRecorder appends records to an io.Writer
+type writerRecorder struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewRecorder returns a Recorder appending length-prefixed records to w
+// (e.g. an *os.File). Read them back with Replay.
+func NewRecorder(w io.Writer) Recorder {
+	return &writerRecorder{w: w}
+}
+
+func (r *writerRecorder) Record(request, response []byte) error {
+	record := make([]byte, 0, len(request)+len(response)+2*binary.MaxVarintLen64+1)
+	record = append(record, recordMagic)
+	record = binary.AppendUvarint(record, uint64(len(request)))
+	record = append(record, request...)
+	record = binary.AppendUvarint(record, uint64(len(response)))
+	record = append(record, response...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.w.Write(record)
+	return err
+}
+
+// ReplayResult compares a recorded batch with its re-processed response
+type ReplayResult struct {
+	Index    int
+	Request  []byte
+	Recorded []byte
+	Replayed []byte
+	Match    bool // Replayed == Recorded (responses with timestamps or IDs may differ)
+}
+
+// Replay re-processes every batch recorded by NewRecorder, in order
+// Use the same handlers and codec as the recording instance to reproduce bugs.
+// Replayed batches are not recorded again.
+func (cp *CrudP) Replay(ctx context.Context, r io.Reader, opts ...CallOption) ([]ReplayResult, error) {
+	br := bufio.NewReader(r)
+	var results []ReplayResult
+
+	for index := 0; ; index++ {
+		magic, err := br.ReadByte()
+		if err == io.EOF {
+			return results, nil
+		}
+		if err != nil {
+			return results, err
+		}
+		if magic != recordMagic {
+			return results, Err(Fmt("replay: record %d is corrupt", index))
+		}
+
+		request, err := readRecordField(br)
+		if err != nil {
+			return results, Err(Fmt("replay: record %d: %v", index, err))
+		}
+		recorded, err := readRecordField(br)
+		if err != nil {
+			return results, Err(Fmt("replay: record %d: %v", index, err))
+		}
+
+		replayed, err := cp.processBatch(ctx, request, opts)
+		if err != nil {
+			return results, Err(Fmt("replay: record %d: %v", index, err))
+		}
+
+		results = append(results, ReplayResult{
+			Index:    index,
+			Request:  request,
+			Recorded: recorded,
+			Replayed: replayed,
+			Match:    bytes.Equal(recorded, replayed),
+		})
+	}
+}
+
+func readRecordField(br *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	field := make([]byte, n)
+	if _, err := io.ReadFull(br, field); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+// record passes a handled batch to Config.Recorder
+func (cp *CrudP) record(request, response []byte) {
+	if cp.config.Recorder == nil {
+		return
+	}
+	if err := cp.config.Recorder.Record(request, response); err != nil {
+		cp.log.Error("recorder failed", "error", err)
+	}
+}
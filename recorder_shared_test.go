@@ -0,0 +1,57 @@
+package crudp_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+func RecorderShared(t *testing.T) {
+	var capture bytes.Buffer
+
+	cfg := crudp.DefaultConfig()
+	cfg.Recorder = crudp.NewRecorder(&capture)
+	cp := crudp.New(crudp.WithConfig(cfg))
+	cp.RegisterHandler(&Note{})
+
+	for _, text := range []string{"first", "second"} {
+		data, _ := cp.Codec().Encode(&Note{Text: text})
+		processOne(t, cp, crudp.Packet{Action: 'c', Data: [][]byte{data}, ReqID: text})
+	}
+
+	t.Run("Replay reproduces responses", func(t *testing.T) {
+		replica := crudp.NewDefault()
+		replica.RegisterHandler(&Note{})
+
+		results, err := replica.Replay(context.Background(), bytes.NewReader(capture.Bytes()))
+		if err != nil {
+			t.Fatalf("Replay error: %v", err)
+		}
+		if len(results) != 2 {
+			t.Fatalf("expected 2 replayed batches, got %d", len(results))
+		}
+		for _, r := range results {
+			if !r.Match {
+				t.Errorf("batch %d differs:\nrecorded %s\nreplayed %s", r.Index, r.Recorded, r.Replayed)
+			}
+		}
+	})
+
+	t.Run("Replay is not recorded", func(t *testing.T) {
+		before := capture.Len()
+		if _, err := cp.Replay(context.Background(), bytes.NewReader(capture.Bytes())); err != nil {
+			t.Fatalf("Replay error: %v", err)
+		}
+		if capture.Len() != before {
+			t.Error("replayed batches were recorded again")
+		}
+	})
+
+	t.Run("Corrupt capture", func(t *testing.T) {
+		if _, err := cp.Replay(context.Background(), bytes.NewReader([]byte("garbage"))); err == nil {
+			t.Error("expected error for corrupt capture")
+		}
+	})
+}
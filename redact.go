@@ -0,0 +1,165 @@
+package crudp
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Fields tagged `crudp:"redact"` are masked in broadcasts and in the data
+// logged by crudp; direct results to the caller keep them.
+//
+//	type Patient struct {
+//		ID   string
+//		Name string
+//		SSN  string `crudp:"redact"`
+//	}
+
+// Redactor masks a redacted field (Config.Redactor)
+// channel is the broadcast channel, "" when the value is logged. Return
+// value unchanged to publish it, or a replacement of the same type; any
+// other result zeroes the field.
+type Redactor interface {
+	Redact(channel, field string, value any) any
+}
+
+// RedactFunc adapts a function to Redactor
+type RedactFunc func(channel, field string, value any) any
+
+func (f RedactFunc) Redact(channel, field string, value any) any { return f(channel, field, value) }
+
+// Redact returns v with its redacted fields masked for channel ("" = logs)
+// Values without redacted fields are returned as is; otherwise v is copied,
+// never modified.
+func (cp *CrudP) Redact(channel string, v any) any {
+	if v == nil || !hasRedacted(reflect.TypeOf(v)) {
+		return v
+	}
+	return cp.redactValue(channel, reflect.ValueOf(v)).Interface()
+}
+
+// redactValue returns a copy of v with the redacted fields masked
+func (cp *CrudP) redactValue(channel string, v reflect.Value) reflect.Value {
+	if !hasRedacted(v.Type()) {
+		return v
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(cp.redactValue(channel, v.Elem()))
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(cp.redactValue(channel, v.Index(i)))
+		}
+		return out
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			f := out.Field(i)
+			if redactTag(sf) {
+				cp.mask(channel, sf.Name, f)
+			} else {
+				f.Set(cp.redactValue(channel, f))
+			}
+		}
+		return out
+	}
+	return v
+}
+
+// mask sets f to what Config.Redactor returns, zero by default
+func (cp *CrudP) mask(channel, field string, f reflect.Value) {
+	if r := cp.config.Redactor; r != nil {
+		if out := r.Redact(channel, field, f.Interface()); out != nil {
+			if ov := reflect.ValueOf(out); ov.Type().AssignableTo(f.Type()) {
+				f.Set(ov)
+				return
+			}
+		}
+	}
+	f.Set(reflect.Zero(f.Type()))
+}
+
+// redactTag reports whether the crudp tag of sf includes "redact"
+func redactTag(sf reflect.StructField) bool {
+	tag := sf.Tag.Get("crudp")
+	start := 0
+	for i := 0; i <= len(tag); i++ {
+		if i == len(tag) || tag[i] == ',' {
+			if tag[start:i] == "redact" {
+				return true
+			}
+			start = i + 1
+		}
+	}
+	return false
+}
+
+// redactTypes caches whether a type holds redacted fields (copy-on-write)
+var redactTypes struct {
+	mu    sync.Mutex
+	types []redactType
+}
+
+type redactType struct {
+	t   reflect.Type
+	has bool
+}
+
+// hasRedacted reports whether values of t can hold redacted fields
+func hasRedacted(t reflect.Type) bool {
+	redactTypes.mu.Lock()
+	types := redactTypes.types
+	redactTypes.mu.Unlock()
+	for _, rt := range types {
+		if rt.t == t {
+			return rt.has
+		}
+	}
+
+	has := scanRedacted(t, nil)
+	redactTypes.mu.Lock()
+	redactTypes.types = append(redactTypes.types[:len(redactTypes.types):len(redactTypes.types)], redactType{t: t, has: has})
+	redactTypes.mu.Unlock()
+	return has
+}
+
+// scanRedacted walks t; seen guards recursive types
+func scanRedacted(t reflect.Type, seen []reflect.Type) bool {
+	for _, s := range seen {
+		if s == t {
+			return false
+		}
+	}
+	seen = append(seen, t)
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		return scanRedacted(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			if redactTag(sf) || scanRedacted(sf.Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package crudp_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+type PatientRecord struct {
+	ID      string
+	Name    string
+	SSN     string `crudp:"redact"`
+	Contact struct {
+		Phone string `crudp:"redact"`
+	}
+}
+
+// patientCreated broadcasts the created record to "patients" and "admin"
+type patientCreated struct{ record *PatientRecord }
+
+func (r patientCreated) Response() (any, []string, error) {
+	return r.record, []string{"patients", "admin"}, nil
+}
+
+func (h *PatientRecord) Create(ctx context.Context, data ...any) any {
+	return patientCreated{record: data[0].(*PatientRecord)}
+}
+
+func RedactShared(t *testing.T) {
+	newRecord := func() *PatientRecord {
+		p := &PatientRecord{ID: "p1", Name: "Jane", SSN: "123-45-6789"}
+		p.Contact.Phone = "555-0100"
+		return p
+	}
+
+	t.Run("Broadcasts And Logs Are Redacted", func(t *testing.T) {
+		logger := &levelLogger{}
+		cp := crudp.New(crudp.WithLeveledLogger(logger), crudp.WithHandlers(&PatientRecord{}))
+
+		var events []crudp.Event
+		cp.Listen(func(ev crudp.Event) { events = append(events, ev) })
+
+		item, _ := cp.Codec().Encode(newRecord())
+		pr := processOne(t, cp, crudp.Packet{Action: 'c', HandlerID: 0, Data: [][]byte{item}})
+
+		var direct PatientRecord
+		cp.DecodeData(&pr.Packet, 0, &direct)
+		if direct.SSN != "123-45-6789" {
+			t.Errorf("direct result lost the redacted field: %+v", direct)
+		}
+
+		if len(events) != 2 {
+			t.Fatalf("expected 2 events, got %d", len(events))
+		}
+		for _, ev := range events {
+			var got PatientRecord
+			cp.Codec().Decode(ev.Data, &got)
+			if got.Name != "Jane" || got.SSN != "" || got.Contact.Phone != "" {
+				t.Errorf("%s: unexpected record %+v", ev.Channel, got)
+			}
+		}
+
+		for _, entry := range logger.entries["debug"] {
+			line := Fmt("%v", entry)
+			if strings.Contains(line, "123-45-6789") || strings.Contains(line, "555-0100") {
+				t.Errorf("redacted value logged: %s", line)
+			}
+		}
+	})
+
+	t.Run("Redactor Decides Per Channel", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.Redactor = crudp.RedactFunc(func(channel, field string, value any) any {
+			if channel == "admin" {
+				return value
+			}
+			if field == "SSN" {
+				s := value.(string)
+				return "***-**-" + s[len(s)-4:]
+			}
+			return nil
+		})
+		cp := crudp.New(cfg, crudp.WithHandlers(&PatientRecord{}))
+
+		got := map[string]PatientRecord{}
+		cp.Listen(func(ev crudp.Event) {
+			var p PatientRecord
+			cp.Codec().Decode(ev.Data, &p)
+			got[ev.Channel] = p
+		})
+
+		item, _ := cp.Codec().Encode(newRecord())
+		processOne(t, cp, crudp.Packet{Action: 'c', HandlerID: 0, Data: [][]byte{item}})
+
+		if p := got["admin"]; p.SSN != "123-45-6789" || p.Contact.Phone != "555-0100" {
+			t.Errorf("admin: %+v", p)
+		}
+		if p := got["patients"]; p.SSN != "***-**-6789" || p.Contact.Phone != "" {
+			t.Errorf("patients: %+v", p)
+		}
+	})
+
+	t.Run("Redact Copies", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		in := []*PatientRecord{newRecord()}
+
+		out := cp.Redact("", in).([]*PatientRecord)
+		if out[0].SSN != "" || out[0].Name != "Jane" {
+			t.Errorf("unexpected redacted value %+v", out[0])
+		}
+		if in[0].SSN != "123-45-6789" {
+			t.Error("Redact modified its input")
+		}
+
+		plain := &sseResponse{Message: "x"}
+		if cp.Redact("", plain) != any(plain) {
+			t.Error("value without redacted fields was copied")
+		}
+	})
+}
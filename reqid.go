@@ -0,0 +1,91 @@
+package crudp
+
+import (
+	"crypto/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// ReqIDProvider generates the ReqID of packets sent without one (client only)
+// Set it in Config.ReqIDs. NextReqID may be called from several goroutines.
+type ReqIDProvider interface {
+	NextReqID() string
+}
+
+// ReqIDFunc adapts a function to ReqIDProvider
+type ReqIDFunc func() string
+
+func (f ReqIDFunc) NextReqID() string { return f() }
+
+// MonotonicReqIDs numbers ReqIDs per instance: prefix1, prefix2... (default,
+// with an empty prefix). Short, but only unique within one client.
+func MonotonicReqIDs(prefix string) ReqIDProvider {
+	return &monotonicReqIDs{prefix: prefix}
+}
+
+type monotonicReqIDs struct {
+	prefix string
+	n      atomic.Uint64
+}
+
+func (m *monotonicReqIDs) NextReqID() string {
+	return Fmt("%s%d", m.prefix, m.n.Add(1))
+}
+
+// ULIDReqIDs returns 26-character IDs sorting by creation time, like ULIDs:
+// 48 bits of milliseconds and 80 random bits in Crockford base32. Unique
+// across clients, e.g. for server-side logs and dedup.
+func ULIDReqIDs() ReqIDProvider {
+	return &ulidReqIDs{}
+}
+
+type ulidReqIDs struct {
+	mu   sync.Mutex
+	last uint64   // Milliseconds of the previous ID
+	rand [10]byte // Incremented within the same millisecond to stay sorted
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (u *ulidReqIDs) NextReqID() string {
+	u.mu.Lock()
+	ms := uint64(time.Now().UnixMilli())
+	if ms > u.last {
+		u.last = ms
+		rand.Read(u.rand[:])
+	} else {
+		for i := len(u.rand) - 1; i >= 0; i-- { // Same (or earlier) ms: next value
+			if u.rand[i]++; u.rand[i] != 0 {
+				break
+			}
+		}
+	}
+	ms = u.last
+	r := u.rand
+	u.mu.Unlock()
+
+	var id [26]byte
+	for i := 9; i >= 0; i-- {
+		id[i] = crockford[ms&31]
+		ms >>= 5
+	}
+	// 80 random bits as 16 groups of 5
+	var acc uint32
+	bits, n := 0, 10
+	for _, b := range r {
+		acc = acc<<8 | uint32(b)
+		for bits += 8; bits >= 5; bits -= 5 {
+			id[n] = crockford[(acc>>(bits-5))&31]
+			n++
+		}
+	}
+	return string(id[:])
+}
+
+// nextReqID returns the ReqID for a packet sent without one
+func (cp *CrudP) nextReqID() string {
+	return cp.reqIDs.NextReqID()
+}
@@ -0,0 +1,53 @@
+package crudp_test
+
+import (
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+func ReqIDShared(t *testing.T) {
+	reqIDOf := func(t *testing.T, cp *crudp.CrudP, reqID string) string {
+		t.Helper()
+		encoded, err := cp.EncodePacket('c', 0, reqID, &User{Name: "Ana"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var packet crudp.Packet
+		if err := cp.DecodePacket(encoded, &packet); err != nil {
+			t.Fatal(err)
+		}
+		return packet.ReqID
+	}
+
+	t.Run("Monotonic By Default", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&UserController{}))
+		if a, b := reqIDOf(t, cp, ""), reqIDOf(t, cp, ""); a != "1" || b != "2" {
+			t.Errorf("expected 1 and 2, got %q %q", a, b)
+		}
+		if got := reqIDOf(t, cp, "mine"); got != "mine" {
+			t.Errorf("caller ReqID replaced by %q", got)
+		}
+	})
+
+	t.Run("ULID Sorted And Unique", func(t *testing.T) {
+		ids := crudp.ULIDReqIDs()
+		prev := ""
+		for i := 0; i < 1000; i++ {
+			id := ids.NextReqID()
+			if len(id) != 26 || id <= prev {
+				t.Fatalf("id %d: %q after %q", i, id, prev)
+			}
+			prev = id
+		}
+	})
+
+	t.Run("Custom Provider", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.ReqIDs = crudp.ReqIDFunc(func() string { return "fixed" })
+		cp := crudp.New(cfg, crudp.WithHandlers(&UserController{}))
+		if got := reqIDOf(t, cp, ""); got != "fixed" {
+			t.Errorf("expected the custom ReqID, got %q", got)
+		}
+	})
+}
@@ -0,0 +1,9 @@
+//go:build wasm
+
+package crudp_test
+
+import "testing"
+
+func TestReqID_WASM(t *testing.T) {
+	ReqIDShared(t)
+}
@@ -0,0 +1,79 @@
+package crudp
+
+import (
+	"context"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// Compensator undoes a successful packet when a later packet of the same
+// batch fails (Config.Sagas). data holds the items the handler returned,
+// decoded into the handler type, e.g. the created entity with its ID.
+type Compensator interface {
+	Compensate(ctx context.Context, action byte, data ...any) error
+}
+
+// saga tracks the packets of a batch processed with Config.Sagas
+type saga struct {
+	done    []int // Batch indexes of successful mutations, in processing order
+	failed  bool
+	abortBy string // ReqID of the failed packet
+}
+
+// track records the outcome of a packet; a failed mutation aborts the saga
+func (s *saga) track(idx int, packet *Packet, result *PacketResult) {
+	if !mutating(packet.Action) {
+		return
+	}
+	if result.MessageType == uint8(Msg.Error) || result.MessageType == uint8(Msg.Warning) {
+		s.failed = true
+		s.abortBy = packet.ReqID
+		return
+	}
+	s.done = append(s.done, idx)
+}
+
+// abortedResult reports a packet skipped because the saga failed
+func (s *saga) abortedResult(packet *Packet) (PacketResult, error) {
+	err := LocErr(msgAborted, s.abortBy)
+	pr := errorResult(packet, err)
+	pr.Code = CodeAborted
+	return pr, err
+}
+
+// compensate undoes the successful mutations in reverse order and reports
+// the outcome in their results. It runs even if the client went away.
+func (cp *CrudP) compensate(ctx context.Context, co *callOptions, s *saga, results []PacketResult) {
+	ctx = context.WithoutCancel(ctx)
+	for i := len(s.done) - 1; i >= 0; i-- {
+		idx := s.done[i]
+		pr := &results[idx]
+		handler, err := cp.resolve(pr.HandlerID, pr.Version)
+		if err != nil || handler.Compensate == nil {
+			continue // Not undoable, reported as done
+		}
+
+		err = cp.runCompensation(ctx, co, handler, pr)
+		pr.Data = nil
+		if err != nil {
+			cp.log.Error("compensation failed", "handler", handler.name, "action", string(pr.Action), "req", pr.ReqID, "error", err)
+			pr.MessageType = uint8(Msg.Error)
+			pr.Message = Fmt("compensation failed: %v", err)
+			pr.Code = CodeCompensationFailed
+			continue
+		}
+		cp.log.Info("compensated", "handler", handler.name, "action", string(pr.Action), "req", pr.ReqID)
+		pr.MessageType = uint8(Msg.Warning)
+		pr.Message = Fmt("compensated: packet %s failed", s.abortBy)
+		pr.Code = CodeCompensated
+	}
+}
+
+// runCompensation decodes the result items and calls Compensate
+func (cp *CrudP) runCompensation(ctx context.Context, co *callOptions, handler *actionHandler, pr *PacketResult) error {
+	data, err := cp.decodeWithKnownType(co.codec, &Packet{Data: pr.Data}, handler)
+	if err != nil {
+		return err
+	}
+	return handler.Compensate(ctx, pr.Action, data...)
+}
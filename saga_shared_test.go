@@ -0,0 +1,108 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Booking is undone by cancelling the booking
+type Booking struct {
+	ID   string `json:"id"`
+	Fail bool   `json:"fail"`
+}
+
+var bookingsCreated, bookingsUndone []string
+
+func (h *Booking) Create(ctx context.Context, data ...any) any {
+	b := data[0].(*Booking)
+	if b.Fail {
+		return flakyResult{err: Errf("no rooms left")}
+	}
+	bookingsCreated = append(bookingsCreated, b.ID)
+	return b
+}
+
+func (h *Booking) Compensate(ctx context.Context, action byte, data ...any) error {
+	bookingsUndone = append(bookingsUndone, data[0].(*Booking).ID)
+	return nil
+}
+
+// Charge cannot be refunded
+type Charge struct {
+	Amount int `json:"amount"`
+}
+
+func (h *Charge) Create(ctx context.Context, data ...any) any {
+	if data[0].(*Charge).Amount < 0 {
+		return flakyResult{err: Errf("card declined")}
+	}
+	return data[0]
+}
+
+func (h *Charge) Compensate(ctx context.Context, action byte, data ...any) error {
+	return Errf("refunds disabled")
+}
+
+func SagaShared(t *testing.T) {
+	newCP := func(sagas bool) *crudp.CrudP {
+		cfg := crudp.DefaultConfig()
+		cfg.Sagas = sagas
+		bookingsCreated, bookingsUndone = nil, nil
+		return crudp.New(cfg, crudp.WithHandlers(&Booking{}, &Charge{}))
+	}
+	packet := func(cp *crudp.CrudP, handlerID uint8, reqID string, v any) crudp.Packet {
+		data, _ := cp.Codec().Encode(v)
+		return crudp.Packet{Action: 'c', HandlerID: handlerID, ReqID: reqID, Data: [][]byte{data}}
+	}
+
+	t.Run("Compensates In Reverse Order", func(t *testing.T) {
+		cp := newCP(true)
+		results := processBatchResults(t, cp,
+			packet(cp, 0, "b1", &Booking{ID: "1"}),
+			packet(cp, 0, "b2", &Booking{ID: "2"}),
+			packet(cp, 1, "c1", &Charge{Amount: -1}),
+			packet(cp, 0, "b3", &Booking{ID: "3"}),
+		)
+
+		if len(bookingsUndone) != 2 || bookingsUndone[0] != "2" || bookingsUndone[1] != "1" {
+			t.Errorf("unexpected compensations %v", bookingsUndone)
+		}
+		for _, pr := range results[:2] {
+			if pr.Code != crudp.CodeCompensated || pr.MessageType != uint8(Msg.Warning) {
+				t.Errorf("%s: expected compensated, got %d %q %q", pr.ReqID, pr.MessageType, pr.Code, pr.Message)
+			}
+		}
+		if results[2].MessageType != uint8(Msg.Error) || results[2].Code != "" {
+			t.Errorf("failed packet: %q %q", results[2].Code, results[2].Message)
+		}
+		if results[3].Code != crudp.CodeAborted || len(bookingsCreated) != 2 {
+			t.Errorf("expected b3 aborted before running, got %q, created %v", results[3].Code, bookingsCreated)
+		}
+	})
+
+	t.Run("Reports Failed Compensation", func(t *testing.T) {
+		cp := newCP(true)
+		results := processBatchResults(t, cp,
+			packet(cp, 1, "c1", &Charge{Amount: 10}),
+			packet(cp, 0, "b1", &Booking{ID: "1", Fail: true}),
+		)
+		if results[0].Code != crudp.CodeCompensationFailed || results[0].MessageType != uint8(Msg.Error) {
+			t.Errorf("expected compensation failure, got %q %q", results[0].Code, results[0].Message)
+		}
+	})
+
+	t.Run("Disabled By Default", func(t *testing.T) {
+		cp := newCP(false)
+		results := processBatchResults(t, cp,
+			packet(cp, 0, "b1", &Booking{ID: "1"}),
+			packet(cp, 1, "c1", &Charge{Amount: -1}),
+			packet(cp, 0, "b2", &Booking{ID: "2"}),
+		)
+		if len(bookingsUndone) != 0 || results[2].MessageType != uint8(Msg.Success) {
+			t.Errorf("batch should continue without sagas: undone %v, b2 %q", bookingsUndone, results[2].Message)
+		}
+	})
+}
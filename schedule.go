@@ -0,0 +1,217 @@
+package crudp
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// Schedule is a recurring packet processed by the server through
+// ProcessBatch like one sent by a client, so periodic cleanups and reports
+// reuse handler logic: middleware, validation, audit and broadcasts apply.
+// Register it in Config.Schedules, from a ScheduledHandler or AddSchedule.
+type Schedule struct {
+	// Name identifies the schedule in logs and ScheduleName. Default: Handler
+	Name string
+
+	// Handler is the registered handler name; "" in ScheduledHandler = itself
+	Handler string
+
+	// Action of the packet, e.g. 'd' for a cleanup. Default: 'r'
+	Action byte
+
+	// Data items of the packet, encoded with the codec of the instance
+	Data []any
+
+	// Every runs the packet every Every ms
+	Every int
+
+	// Cron runs the packet at the minutes matching "minute hour day month
+	// weekday" in UTC, e.g. "0 3 * * *" or "*/15 8-18 * * 1-5"; instead of Every
+	Cron string
+
+	// Tenant the packet runs as (see WithTenant). Default: ""
+	Tenant string
+}
+
+// ScheduledHandler registers recurring packets of a handler (optional)
+// Only servers run them: WASM builds ignore schedules.
+type ScheduledHandler interface {
+	Schedules() []Schedule
+}
+
+type scheduleKey struct{}
+
+// ScheduleName returns the Name of the Schedule that sent the packet being
+// processed, "" for packets of clients. Authorization middleware uses it to
+// let scheduled packets through without a user.
+func ScheduleName(ctx context.Context) string {
+	name, _ := ctx.Value(scheduleKey{}).(string)
+	return name
+}
+
+// Next returns the first run of s after t, zero if it never runs again;
+// an error if Every and Cron are both or neither set, or Cron is invalid
+func (s Schedule) Next(t time.Time) (time.Time, error) {
+	next, err := s.next()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return next(t), nil
+}
+
+// next returns the function giving the next run of s after a time
+func (s *Schedule) next() (func(time.Time) time.Time, error) {
+	switch {
+	case s.Cron != "" && s.Every > 0:
+		return nil, Err(Fmt("schedule %s: set Every or Cron, not both", s.Name))
+	case s.Every > 0:
+		every := time.Duration(s.Every) * time.Millisecond
+		return func(t time.Time) time.Time { return t.Add(every) }, nil
+	case s.Cron != "":
+		c, err := parseCron(s.Cron)
+		if err != nil {
+			return nil, Err(Fmt("schedule %s: %v", s.Name, err))
+		}
+		return c.next, nil
+	}
+	return nil, Err(Fmt("schedule %s: Every or Cron required", s.Name))
+}
+
+// cronSpec holds the allowed values of each cron field as bit sets
+type cronSpec struct {
+	fields [5]uint64 // minute, hour, day, month, weekday
+	anyDay bool      // Day is "*": only weekday restricts days
+	anyDow bool      // Weekday is "*": only day restricts days
+}
+
+// cronRanges are the bounds of the cron fields
+var cronRanges = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// parseCron parses a 5-field cron expression; each field is a list of
+// "*", "n", "a-b", optionally followed by "/step"
+func parseCron(expr string) (cronSpec, error) {
+	var c cronSpec
+	parts := strings.Fields(expr)
+	if len(parts) != 5 {
+		return c, Err(Fmt("cron %q: expected 5 fields, got %d", expr, len(parts)))
+	}
+	for i, part := range parts {
+		for _, item := range strings.Split(part, ",") {
+			bits, err := cronItem(item, cronRanges[i][0], cronRanges[i][1])
+			if err != nil {
+				return c, Err(Fmt("cron %q: %v", expr, err))
+			}
+			c.fields[i] |= bits
+		}
+	}
+	if c.fields[4]&(1<<7) != 0 { // 7 is Sunday too
+		c.fields[4] |= 1
+	}
+	c.anyDay, c.anyDow = parts[2] == "*", parts[4] == "*"
+	return c, nil
+}
+
+// cronItem returns the bits of one item of a cron field
+func cronItem(item string, lo, hi int) (uint64, error) {
+	step := 1
+	if i := strings.IndexByte(item, '/'); i >= 0 {
+		n, err := strconv.Atoi(item[i+1:])
+		if err != nil || n <= 0 {
+			return 0, Err(Fmt("invalid step %q", item))
+		}
+		step, item = n, item[:i]
+	}
+	from, to := lo, hi
+	if item != "*" {
+		a, b, isRange := strings.Cut(item, "-")
+		var err error
+		if from, err = strconv.Atoi(a); err != nil {
+			return 0, Err(Fmt("invalid value %q", item))
+		}
+		to = from
+		if isRange {
+			if to, err = strconv.Atoi(b); err != nil {
+				return 0, Err(Fmt("invalid range %q", item))
+			}
+		} else if step > 1 {
+			to = hi // "5/15" = from 5 on
+		}
+	}
+	if from < lo || to > hi || from > to {
+		return 0, Err(Fmt("%q out of range %d-%d", item, lo, hi))
+	}
+	var bits uint64
+	for v := from; v <= to; v += step {
+		bits |= 1 << v
+	}
+	return bits, nil
+}
+
+func (c *cronSpec) has(field, v int) bool {
+	return c.fields[field]&(1<<v) != 0
+}
+
+// day reports whether t is a day of c; like cron, a restricted day and
+// weekday match either
+func (c *cronSpec) day(t time.Time) bool {
+	day, dow := c.has(2, t.Day()), c.has(4, int(t.Weekday()))
+	switch {
+	case c.anyDay:
+		return dow
+	case c.anyDow:
+		return day
+	}
+	return day || dow
+}
+
+// next returns the first minute after t matching c, zero if none within 5
+// years (e.g. "0 0 31 2 *")
+func (c cronSpec) next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	for end := t.AddDate(5, 0, 0); t.Before(end); {
+		switch {
+		case !c.has(3, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.day(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case !c.has(1, t.Hour()):
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case !c.has(0, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// schedules stops the goroutines of AddSchedule on Close
+type schedules struct {
+	mu   sync.Mutex
+	stop chan struct{}
+}
+
+// done returns the channel closed by Close
+func (s *schedules) done() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop == nil {
+		s.stop = make(chan struct{})
+	}
+	return s.stop
+}
+
+// close stops the running schedules
+func (s *schedules) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
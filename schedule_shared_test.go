@@ -0,0 +1,61 @@
+package crudp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cdvelop/crudp"
+)
+
+func ScheduleShared(t *testing.T) {
+	// Wednesday 2024-01-10 10:07:30 UTC
+	now := time.Date(2024, 1, 10, 10, 7, 30, 0, time.UTC)
+
+	t.Run("Cron Next", func(t *testing.T) {
+		cases := []struct {
+			cron string
+			want time.Time
+		}{
+			{"* * * * *", time.Date(2024, 1, 10, 10, 8, 0, 0, time.UTC)},
+			{"*/15 * * * *", time.Date(2024, 1, 10, 10, 15, 0, 0, time.UTC)},
+			{"0 3 * * *", time.Date(2024, 1, 11, 3, 0, 0, 0, time.UTC)},
+			{"30 9 * * 1-5", time.Date(2024, 1, 11, 9, 30, 0, 0, time.UTC)},
+			{"0 0 * * 0", time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+			{"0 0 * * 7", time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+			{"0 12 1 * *", time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC)},
+			{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+			{"0 0 13 * 5", time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)}, // Day or weekday
+			{"5,50 10 * * *", time.Date(2024, 1, 10, 10, 50, 0, 0, time.UTC)},
+			{"0 0 31 2 *", time.Time{}},
+		}
+		for _, c := range cases {
+			got, err := crudp.Schedule{Cron: c.cron}.Next(now)
+			if err != nil || !got.Equal(c.want) {
+				t.Errorf("%q: got %v, %v; want %v", c.cron, got, err, c.want)
+			}
+		}
+	})
+
+	t.Run("Every", func(t *testing.T) {
+		got, err := crudp.Schedule{Every: 1500}.Next(now)
+		if err != nil || !got.Equal(now.Add(1500*time.Millisecond)) {
+			t.Fatalf("got %v, %v", got, err)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, s := range []crudp.Schedule{
+			{},
+			{Every: 1000, Cron: "* * * * *"},
+			{Cron: "* * * *"},
+			{Cron: "60 * * * *"},
+			{Cron: "*/0 * * * *"},
+			{Cron: "5-1 * * * *"},
+			{Cron: "a * * * *"},
+		} {
+			if _, err := s.Next(now); err == nil {
+				t.Errorf("expected an error for %+v", s)
+			}
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package crudp
+
+import (
+	"reflect"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// ActionHandshake is the reserved action carrying the client schema table
+const ActionHandshake byte = 'h'
+
+// SchemaEntry describes the field layout of a registered handler
+type SchemaEntry struct {
+	HandlerID uint8  `json:"handler_id"`
+	Version   byte   `json:"version"`
+	Name      string `json:"name"`
+	Hash      uint32 `json:"hash"`
+}
+
+// SchemaTable returns the layout hash of every registered handler and version
+func (cp *CrudP) SchemaTable() []SchemaEntry {
+	handlers := cp.table()
+	table := make([]SchemaEntry, 0, len(handlers))
+	for i := range handlers {
+		h := &handlers[i]
+		if h.handler == nil {
+			continue
+		}
+		table = append(table, SchemaEntry{HandlerID: h.index, Name: h.name, Hash: h.schema})
+		for _, v := range h.versions {
+			table = append(table, SchemaEntry{HandlerID: v.index, Version: v.version, Name: v.name, Hash: v.schema})
+		}
+	}
+	return table
+}
+
+// VerifySchema compares a remote schema table against the local one
+// Returns "schema drift for handler <name>" on the first mismatch.
+func (cp *CrudP) VerifySchema(remote []SchemaEntry) error {
+	for _, entry := range remote {
+		local, err := cp.resolve(entry.HandlerID, entry.Version)
+		if err != nil || local.handler == nil {
+			if id, ok := cp.HandlerID(entry.Name); ok && entry.Version == 0 {
+				return Err(Fmt("schema drift for handler %s: not registered at id %d, %s is id %d on this side", entry.Name, entry.HandlerID, entry.Name, id))
+			}
+			return Err(Fmt("schema drift for handler %s: not registered at id %d version %d", entry.Name, entry.HandlerID, entry.Version))
+		}
+		if local.name != entry.Name {
+			if id, ok := cp.HandlerID(entry.Name); ok {
+				return Err(Fmt("schema drift for handler %s: id %d is %s on this side, %s is id %d", entry.Name, entry.HandlerID, local.name, entry.Name, id))
+			}
+			return Err(Fmt("schema drift for handler %s: id %d is %s on this side", entry.Name, entry.HandlerID, local.name))
+		}
+		if local.schema != entry.Hash {
+			return Err(Fmt("schema drift for handler %s", entry.Name))
+		}
+	}
+	return nil
+}
+
+// Handshake sends the local schema table to the server immediately
+// The matching PacketResult reports an error if client and server builds differ.
+func (cp *CrudP) Handshake() error {
+	for _, entry := range cp.SchemaTable() {
+		encoded, err := cp.codec.Encode(entry)
+		if err != nil {
+			return err
+		}
+		cp.broker.enqueue(Packet{Action: ActionHandshake, ReqID: "handshake"}, encoded)
+	}
+	cp.broker.FlushNow()
+	return nil
+}
+
+// processHandshake verifies a handshake packet received by the server
+func (cp *CrudP) processHandshake(codec Codec, packet *Packet) (PacketResult, error) {
+	pr := PacketResult{Packet: *packet}
+	pr.Data = nil
+
+	remote := make([]SchemaEntry, len(packet.Data))
+	for i, item := range packet.Data {
+		if err := codec.Decode(item, &remote[i]); err != nil {
+			pr.MessageType = uint8(Msg.Error)
+			pr.Message = err.Error()
+			return pr, err
+		}
+	}
+
+	if err := cp.VerifySchema(remote); err != nil {
+		cp.log.Warn("handshake failed", "error", err)
+		pr.MessageType = uint8(Msg.Error)
+		pr.Message = err.Error()
+		return pr, err
+	}
+
+	pr.MessageType = uint8(Msg.Success)
+	pr.Message = "OK"
+	return pr, nil
+}
+
+// layoutHash returns the FNV-1a hash of a type's field layout
+func layoutHash(t reflect.Type) uint32 {
+	hash := uint32(2166136261)
+	for _, c := range []byte(typeLayout(t, 0)) {
+		hash ^= uint32(c)
+		hash *= 16777619
+	}
+	return hash
+}
+
+// typeLayout describes field names and kinds recursively
+// Depth is bounded to stop on self-referencing types.
+func typeLayout(t reflect.Type, depth int) string {
+	if depth > 8 {
+		return t.Kind().String()
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + typeLayout(t.Elem(), depth+1)
+	case reflect.Slice:
+		return "[]" + typeLayout(t.Elem(), depth+1)
+	case reflect.Map:
+		return "map[" + typeLayout(t.Key(), depth+1) + "]" + typeLayout(t.Elem(), depth+1)
+	case reflect.Struct:
+		layout := "struct{"
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue // Unexported fields are not encoded
+			}
+			layout += f.Name + " " + typeLayout(f.Type, depth+1) + ";"
+		}
+		return layout + "}"
+	default:
+		return t.Kind().String()
+	}
+}
@@ -0,0 +1,61 @@
+package crudp_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Client build where User lost a field
+type driftUser struct {
+	ID   int
+	Name string
+}
+
+func (u *driftUser) HandlerName() string                         { return "user" }
+func (u *driftUser) Create(ctx context.Context, data ...any) any { return nil }
+
+func SchemaHashShared(t *testing.T) {
+	t.Run("Matching Builds", func(t *testing.T) {
+		server := crudp.New(crudp.WithHandlers(&User{}))
+		client := crudp.New(crudp.WithHandlers(&User{}))
+
+		if err := server.VerifySchema(client.SchemaTable()); err != nil {
+			t.Errorf("unexpected drift: %v", err)
+		}
+	})
+
+	t.Run("Drift Detected", func(t *testing.T) {
+		server := crudp.New(crudp.WithHandlers(&User{}))
+		client := crudp.New(crudp.WithHandlers(&driftUser{}))
+
+		err := server.VerifySchema(client.SchemaTable())
+		if err == nil || !strings.Contains(err.Error(), "schema drift for handler user") {
+			t.Errorf("expected schema drift error, got %v", err)
+		}
+	})
+
+	t.Run("Handshake Over Loopback", func(t *testing.T) {
+		server := crudp.New(crudp.WithHandlers(&User{}))
+		client := crudp.NewLoopback(server, crudp.WithHandlers(&driftUser{}))
+
+		var results []crudp.PacketResult
+		client.OnResult(func(pr crudp.PacketResult) {
+			results = append(results, pr)
+		})
+
+		if err := client.Handshake(); err != nil {
+			t.Fatalf("handshake error: %v", err)
+		}
+
+		if len(results) != 1 {
+			t.Fatalf("expected 1 result, got %d", len(results))
+		}
+		if results[0].MessageType != uint8(Msg.Error) || !strings.Contains(results[0].Message, "schema drift for handler user") {
+			t.Errorf("expected drift error result, got %q", results[0].Message)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package crudp
+
+import (
+	"reflect"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// SelfCheckError lists every problem found by SelfCheck
+type SelfCheckError struct {
+	Problems []string
+}
+
+func (e *SelfCheckError) Error() string {
+	msg := "crudp self-check failed:"
+	for _, p := range e.Problems {
+		msg += "\n - " + p
+	}
+	return msg
+}
+
+// SelfCheck verifies the handler table at startup instead of at first request:
+//   - options passed to New applied without error
+//   - every handler implements at least one CRUD interface
+//   - handler IDs and names are consistent with the table (manifest), and
+//     proxies send to their own ID
+//   - decode types are instantiable and round-trip through the codec
+//   - custom routes don't conflict (server only)
+//   - Config.ActionPolicy only names registered handlers
+//
+// Returns nil or a *SelfCheckError listing all problems.
+func (cp *CrudP) SelfCheck() error {
+	var problems []string
+
+	if cp.initErr != nil {
+		problems = append(problems, "init: "+cp.initErr.Error())
+	}
+
+	handlers := cp.table()
+	for i := range handlers {
+		h := &handlers[i]
+		if h.handler == nil {
+			continue // Manifest gap
+		}
+		problems = cp.checkHandler(problems, uint8(i), h)
+		for j := range h.versions {
+			problems = cp.checkHandler(problems, uint8(i), &h.versions[j])
+		}
+	}
+
+	problems = append(problems, cp.checkRoutes()...)
+	problems = append(problems, cp.checkActionPolicyNames()...)
+
+	if len(problems) > 0 {
+		return &SelfCheckError{Problems: problems}
+	}
+	return nil
+}
+
+// checkHandler appends the problems found for a single table entry
+func (cp *CrudP) checkHandler(problems []string, id uint8, h *actionHandler) []string {
+	label := Fmt("handler %d (%s v%d)", id, h.name, h.version)
+
+	if h.index != id {
+		problems = append(problems, Fmt("%s: registered index %d does not match table position", label, h.index))
+	}
+	if proxy, ok := h.handler.(*ProxyHandler); ok && proxy.id != id {
+		problems = append(problems, Fmt("%s: proxy sends to handler %d", label, proxy.id))
+	}
+	if h.name == "" {
+		problems = append(problems, label+": empty name")
+	} else if name := groupName(h.group, getHandlerName(h.handler)); name != h.name {
+		problems = append(problems, Fmt("%s: name does not match handler name %s", label, name))
+	}
+
+	if h.Create == nil && h.Read == nil && h.ReadPage == nil && h.Update == nil && h.Patch == nil && h.Delete == nil {
+		problems = append(problems, label+": implements none of Creator, Reader, Paginator, Updater, Patcher, Deleter")
+	}
+
+	t := handlerType(h.handler)
+	switch t.Kind() {
+	case reflect.Interface, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return append(problems, Fmt("%s: decode type %s is not instantiable", label, t.String()))
+	}
+
+	// Codec round-trip of the zero value
+	sample := reflect.New(t).Interface()
+	encoded, err := cp.codec.Encode(sample)
+	if err != nil {
+		return append(problems, Fmt("%s: codec cannot encode %s: %v", label, t.String(), err))
+	}
+	if err := cp.codec.Decode(encoded, reflect.New(t).Interface()); err != nil {
+		problems = append(problems, Fmt("%s: codec cannot decode %s: %v", label, t.String(), err))
+	}
+
+	return problems
+}
@@ -0,0 +1,52 @@
+package crudp_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+// Handler without any CRUD method
+type noCrudHandler struct{}
+
+// Handler whose type the codec can't round-trip
+type funcFieldHandler struct {
+	Callback func()
+}
+
+func (h *funcFieldHandler) Create(ctx context.Context, data ...any) any { return nil }
+
+func SelfCheckShared(t *testing.T) {
+	t.Run("Valid Table Passes", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		cp.RegisterHandler(&User{}, &UserController{})
+
+		if err := cp.SelfCheck(); err != nil {
+			t.Errorf("unexpected self-check error: %v", err)
+		}
+	})
+
+	t.Run("Reports All Problems", func(t *testing.T) {
+		cp := crudp.NewDefault()
+		cp.RegisterHandler(&User{}, &noCrudHandler{}, &funcFieldHandler{})
+
+		err := cp.SelfCheck()
+		var report *crudp.SelfCheckError
+		if !errors.As(err, &report) {
+			t.Fatalf("expected *SelfCheckError, got %v", err)
+		}
+		if len(report.Problems) != 2 {
+			t.Errorf("expected 2 problems, got %d: %v", len(report.Problems), report.Problems)
+		}
+	})
+
+	t.Run("Includes Init Error", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(nil))
+
+		if cp.SelfCheck() == nil {
+			t.Error("expected init error in self-check")
+		}
+	})
+}
@@ -0,0 +1,23 @@
+package crudp
+
+import (
+	"context"
+	"sync"
+)
+
+// serverState tracks the server started by ListenAndServe
+type serverState struct {
+	mu       sync.Mutex
+	shutdown func(context.Context) error // Nil unless serving
+	stop     chan struct{}               // Closed by Shutdown: ends the event streams
+}
+
+// stopping returns the channel closed by Shutdown
+func (s *serverState) stopping() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop == nil {
+		s.stop = make(chan struct{})
+	}
+	return s.stop
+}
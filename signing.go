@@ -0,0 +1,83 @@
+package crudp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// Batch signature headers (Config.SigningKeys)
+// The signature is the hex HMAC-SHA256 of "<timestamp>.<body>" with the key
+// named by SignatureKeyHeader; timestamp is unix seconds.
+const (
+	SignatureHeader     = "X-Crudp-Signature"
+	SignatureKeyHeader  = "X-Crudp-Key"
+	SignatureTimeHeader = "X-Crudp-Timestamp"
+)
+
+// signatureWindow is how far a signed timestamp may be from the server clock;
+// it bounds replays of a captured batch
+const signatureWindow = 5 * time.Minute
+
+// SigningKeys returns the secret of a key ID (a client, or a user with its
+// own key), false if unknown
+type SigningKeys interface {
+	SigningKey(keyID string) ([]byte, bool)
+}
+
+// SigningKeyFunc adapts a function to SigningKeys
+type SigningKeyFunc func(keyID string) ([]byte, bool)
+
+func (f SigningKeyFunc) SigningKey(keyID string) ([]byte, bool) { return f(keyID) }
+
+// StaticKey returns SigningKeys accepting one shared secret for any key ID
+func StaticKey(secret []byte) SigningKeys {
+	return SigningKeyFunc(func(string) ([]byte, bool) { return secret, true })
+}
+
+// Signature returns the SignatureHeader value of body signed at timestamp
+func Signature(secret []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(strconv.AppendInt(nil, timestamp, 10))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignedBy returns the key ID of a verified batch signature, "" if unsigned
+func SignedBy(ctx context.Context) string {
+	id, _ := ctx.Value(signerKey).(string)
+	return id
+}
+
+// verifySignature checks a batch signature before the body is decoded and
+// records the key ID in ctx. Unsigned batches pass unless RequireSignature.
+func (cp *CrudP) verifySignature(ctx context.Context, keyID, timestamp, signature string, body []byte) (context.Context, error) {
+	if signature == "" {
+		if cp.config.RequireSignature {
+			return ctx, Errf("signature required")
+		}
+		return ctx, nil
+	}
+
+	secret, ok := cp.config.SigningKeys.SigningKey(keyID)
+	if !ok {
+		return ctx, Err(Fmt("unknown signing key %s", keyID))
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ctx, Errf("invalid signature timestamp")
+	}
+	if skew := time.Since(time.Unix(ts, 0)); skew > signatureWindow || skew < -signatureWindow {
+		return ctx, Errf("signature timestamp outside the allowed window")
+	}
+	if !hmac.Equal([]byte(signature), []byte(Signature(secret, ts, body))) {
+		return ctx, Errf("invalid signature")
+	}
+	return context.WithValue(ctx, signerKey, keyID), nil
+}
@@ -0,0 +1,99 @@
+package crudp
+
+import (
+	"context"
+	"reflect"
+)
+
+// Snapshotter returns the current state of a handler (e.g. all rows)
+// Sync packets asking for a snapshot (see Bootstrap) or too old for the
+// change log get it, followed by the changes made while it was taken.
+// A slice result is encoded one entity per item.
+type Snapshotter interface {
+	Snapshot(ctx context.Context) (any, error)
+}
+
+// Bootstrap queues a sync packet asking for the snapshot of a handler plus
+// the later changes, so a new client loads it in one round trip instead of
+// unbounded Reads. The result Data[0] decodes into a SyncDelta; keep its Seq
+// for the next Sync. With Config.EntityCache the entities are cached.
+func (cp *CrudP) Bootstrap(handlerID uint8, opts ...CallOption) error {
+	return cp.EnqueuePacket(handlerID, ActionSync, "", SyncCursor{Snapshot: true}, opts...)
+}
+
+// snapshotDelta takes the snapshot of handler and the changes recorded since
+// The sequence is read first: changes made during the snapshot are sent
+// again, which is safe because they are applied as upserts and deletes.
+func (cp *CrudP) snapshotDelta(ctx context.Context, codec Codec, handler *actionHandler, handlerID uint8) (SyncDelta, error) {
+	tenant := Tenant(ctx)
+	start := cp.changes.last(handlerID)
+
+	state, err := handler.Snapshot(ctx)
+	if err != nil {
+		return SyncDelta{}, err
+	}
+	items, err := encodeItems(codec, state)
+	if err != nil {
+		return SyncDelta{}, err
+	}
+
+	delta := cp.changes.since(tenant, handlerID, start)
+	delta.Reset = false // Evicted while snapshotting: the snapshot covers it
+	delta.Snapshot = items
+	return delta, nil
+}
+
+// encodeItems encodes each element of a slice, or v as a single item
+func encodeItems(codec Codec, v any) ([][]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+		encoded, err := codec.Encode(v)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{encoded}, nil
+	}
+	items := make([][]byte, rv.Len())
+	for i := range items {
+		encoded, err := codec.Encode(rv.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		items[i] = encoded
+	}
+	return items, nil
+}
+
+// cacheSync applies a SyncDelta result to the entity cache
+// A snapshot replaces the cached entities of the handler.
+func (cp *CrudP) cacheSync(pr *PacketResult) {
+	if len(pr.Data) == 0 {
+		return
+	}
+	var delta SyncDelta
+	if err := cp.codec.Decode(pr.Data[0], &delta); err != nil {
+		return
+	}
+	if delta.Snapshot != nil || delta.Reset {
+		cp.cache.invalidate(pr.HandlerID)
+	}
+	for _, item := range delta.Snapshot {
+		if value, id := cp.decodeEntity(cp.codec, pr.HandlerID, pr.Version, item); id != "" {
+			cp.cache.put(pr.HandlerID, id, value)
+		}
+	}
+	for _, c := range delta.Changes {
+		value, id := cp.decodeEntity(cp.codec, pr.HandlerID, pr.Version, c.Data)
+		if id == "" {
+			continue
+		}
+		if c.Action == 'd' {
+			cp.cache.remove(pr.HandlerID, id)
+		} else {
+			cp.cache.put(pr.HandlerID, id, value)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package crudp_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Ledger keeps its rows in memory and implements Snapshotter
+type Ledger struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+var ledgerMu sync.Mutex
+var ledgerRows []Ledger
+
+func (h *Ledger) Create(ctx context.Context, data ...any) any {
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+	row := *data[0].(*Ledger)
+	ledgerRows = append(ledgerRows, row)
+	return row
+}
+
+func (h *Ledger) Snapshot(ctx context.Context) (any, error) {
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+	return append([]Ledger(nil), ledgerRows...), nil
+}
+
+func snapshotSync(t *testing.T, cp *crudp.CrudP, cursor crudp.SyncCursor) crudp.SyncDelta {
+	t.Helper()
+	encoded, _ := cp.Codec().Encode(cursor)
+	result := processOne(t, cp, crudp.Packet{Action: crudp.ActionSync, Data: [][]byte{encoded}})
+	if result.MessageType != uint8(Msg.Success) {
+		t.Fatalf("sync failed: %s", result.Message)
+	}
+	var delta crudp.SyncDelta
+	if err := cp.Codec().Decode(result.Data[0], &delta); err != nil {
+		t.Fatalf("decode delta: %v", err)
+	}
+	return delta
+}
+
+func SnapshotShared(t *testing.T) {
+	newServer := func(size int) *crudp.CrudP {
+		ledgerRows = []Ledger{{ID: "1", Title: "rent"}, {ID: "2", Title: "food"}}
+		cfg := crudp.DefaultConfig()
+		cfg.ChangeLogSize = size
+		return crudp.New(cfg, crudp.WithHandlers(&Ledger{}))
+	}
+
+	t.Run("Snapshot Then Deltas", func(t *testing.T) {
+		cp := newServer(10)
+		row, _ := cp.Codec().Encode(&Ledger{ID: "3", Title: "gas"})
+		processOne(t, cp, crudp.Packet{Action: 'c', Data: [][]byte{row}})
+
+		delta := snapshotSync(t, cp, crudp.SyncCursor{Snapshot: true})
+		if len(delta.Snapshot) != 3 || delta.Reset || delta.Seq != 1 {
+			t.Fatalf("unexpected delta: %d items, reset %v, seq %d", len(delta.Snapshot), delta.Reset, delta.Seq)
+		}
+		var first Ledger
+		if err := cp.Codec().Decode(delta.Snapshot[0], &first); err != nil || first.Title != "rent" {
+			t.Errorf("snapshot item: %+v %v", first, err)
+		}
+
+		// Next sync from Seq only returns new changes
+		row, _ = cp.Codec().Encode(&Ledger{ID: "4", Title: "tax"})
+		processOne(t, cp, crudp.Packet{Action: 'c', Data: [][]byte{row}})
+		if next := snapshotSync(t, cp, crudp.SyncCursor{Since: delta.Seq}); len(next.Changes) != 1 || next.Snapshot != nil {
+			t.Errorf("unexpected follow-up delta %+v", next)
+		}
+	})
+
+	t.Run("Snapshot Replaces Reset", func(t *testing.T) {
+		cp := newServer(1)
+		for _, id := range []string{"3", "4"} {
+			row, _ := cp.Codec().Encode(&Ledger{ID: id})
+			processOne(t, cp, crudp.Packet{Action: 'c', Data: [][]byte{row}})
+		}
+		delta := snapshotSync(t, cp, crudp.SyncCursor{Since: 0})
+		if delta.Reset || len(delta.Snapshot) != 4 {
+			t.Errorf("expected a snapshot instead of reset, got reset %v, %d items", delta.Reset, len(delta.Snapshot))
+		}
+	})
+
+	t.Run("Bootstrap Fills Client Cache", func(t *testing.T) {
+		server := newServer(10)
+		cfg := crudp.DefaultConfig()
+		cfg.EntityCache = true
+		client := crudp.NewLoopback(server, cfg, crudp.WithHandlers(&Ledger{}))
+
+		if err := client.Bootstrap(0); err != nil {
+			t.Fatal(err)
+		}
+		client.Broker().FlushNow()
+		if list := client.Cache().List(0); len(list) != 2 {
+			t.Fatalf("expected 2 cached rows, got %d", len(list))
+		}
+		if v, ok := client.Cache().Get(0, "2"); !ok || v.(*Ledger).Title != "food" {
+			t.Errorf("unexpected cached row %+v", v)
+		}
+	})
+}
@@ -0,0 +1,9 @@
+//go:build wasm
+
+package crudp_test
+
+import "testing"
+
+func TestSnapshot_WASM(t *testing.T) {
+	SnapshotShared(t)
+}
@@ -1,18 +1,308 @@
 package crudp
 
-// routeToSSE encodes data and sends it to the appropriate SSE broadcast channels.
-func (cp *CrudP) routeToSSE(data any, broadcast []string, handlerID uint8) {
-	cp.log("routeToSSE called for handler", handlerID, "with broadcast targets:", broadcast)
+import (
+	"context"
+	"reflect"
+	"sync"
+)
 
-	encodedData, err := cp.codec.Encode(data)
+// Event is a broadcast delivered to SSE subscribers
+type Event struct {
+	Channel   string `json:"channel"`
+	HandlerID uint8  `json:"handler_id"`
+	Data      []byte `json:"data"`
+}
+
+// sseSubscriber receives the events published on matching channels
+type sseSubscriber struct {
+	id       int
+	deliver  func(Event)
+	patterns []string // Channel patterns, nil = all channels
+	tenant   *string  // Only broadcasts of this tenant, nil = every tenant
+}
+
+// wants reports whether the subscriber listens on channel of tenant
+func (s *sseSubscriber) wants(tenant, channel string) bool {
+	if s.tenant != nil && *s.tenant != tenant {
+		return false
+	}
+	return s.patterns == nil || matchesAny(s.patterns, channel)
+}
+
+// matchesAny reports whether channel matches one of patterns
+func matchesAny(patterns []string, channel string) bool {
+	for _, p := range patterns {
+		if MatchChannel(p, channel) {
+			return true
+		}
+	}
+	return false
+}
+
+// sseHub fans out broadcasts to in-process subscribers
+// Uses slices instead of maps for TinyGo compatibility
+type sseHub struct {
+	mu     sync.Mutex
+	subs   []sseSubscriber
+	nextID int
+}
+
+// attach adds a subscriber and returns its id for detach
+// nil patterns receive every channel, a nil tenant every tenant.
+func (h *sseHub) attach(tenant *string, deliver func(Event), patterns ...string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nextID++
+	h.subs = append(h.subs, sseSubscriber{id: h.nextID, deliver: deliver, patterns: patterns, tenant: tenant})
+	return h.nextID
+}
+
+// detach removes a subscriber by id
+func (h *sseHub) detach(id int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, s := range h.subs {
+		if s.id == id {
+			h.subs = append(h.subs[:i], h.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+// update replaces the patterns of a subscriber (copy-on-write for publish)
+func (h *sseHub) update(id int, fn func(patterns []string) []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := range h.subs {
+		if h.subs[i].id == id {
+			h.subs[i].patterns = fn(append([]string{}, h.subs[i].patterns...))
+			return
+		}
+	}
+}
+
+// patterns returns a copy of the patterns of a subscriber
+func (h *sseHub) patterns(id int) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, s := range h.subs {
+		if s.id == id {
+			return append([]string{}, s.patterns...)
+		}
+	}
+	return nil
+}
+
+// publish delivers an event of tenant to the matching subscribers (outside the lock)
+func (h *sseHub) publish(tenant string, ev Event) {
+	h.mu.Lock()
+	subs := make([]sseSubscriber, len(h.subs))
+	copy(subs, h.subs)
+	h.mu.Unlock()
+
+	for i := range subs {
+		if subs[i].wants(tenant, ev.Channel) {
+			subs[i].deliver(ev)
+		}
+	}
+}
+
+// publishAll delivers ev to the matching subscribers of every tenant
+func (h *sseHub) publishAll(ev Event) {
+	h.mu.Lock()
+	subs := make([]sseSubscriber, len(h.subs))
+	copy(subs, h.subs)
+	h.mu.Unlock()
+
+	for i := range subs {
+		if subs[i].patterns == nil || matchesAny(subs[i].patterns, ev.Channel) {
+			subs[i].deliver(ev)
+		}
+	}
+}
+
+// MatchChannel reports whether channel matches pattern
+// '*' matches any sequence of characters: "patient:*" matches "patient:42".
+func MatchChannel(pattern, channel string) bool {
+	p, c := 0, 0
+	star, mark := -1, 0
+	for c < len(channel) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, c
+			p++
+		case p < len(pattern) && pattern[p] == channel[c]:
+			p++
+			c++
+		case star >= 0:
+			p = star + 1
+			mark++
+			c = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// Listen receives every broadcast published by this instance, of every
+// tenant (server side). Call stop to unsubscribe.
+func (cp *CrudP) Listen(fn func(Event)) (stop func()) {
+	if fn == nil {
+		return func() {}
+	}
+	id := cp.hub.attach(nil, fn)
+	return func() { cp.hub.detach(id) }
+}
+
+// Subscription is a hub subscriber limited to channel patterns (server side)
+type Subscription struct {
+	cp *CrudP
+	id int
+}
+
+// ListenTo receives the broadcasts of every tenant on channels matching patterns
+// Patterns are not authorized, see AuthorizeSubscription. Without patterns
+// nothing is received until Subscribe.
+func (cp *CrudP) ListenTo(fn func(Event), patterns ...string) *Subscription {
+	return &Subscription{cp: cp, id: cp.hub.attach(nil, fn, append([]string{}, patterns...)...)}
+}
+
+// ListenAs is ListenTo limited to the broadcasts of the tenant of ctx
+// Transports serving remote clients use it so broadcasts never cross tenants.
+func (cp *CrudP) ListenAs(ctx context.Context, fn func(Event), patterns ...string) *Subscription {
+	tenant := Tenant(cp.withTenant(ctx))
+	return &Subscription{cp: cp, id: cp.hub.attach(&tenant, fn, append([]string{}, patterns...)...)}
+}
+
+// Subscribe adds channel patterns after checking Config.SubscriptionAuthorizer
+func (s *Subscription) Subscribe(ctx context.Context, patterns ...string) error {
+	if err := s.cp.AuthorizeSubscription(ctx, patterns...); err != nil {
+		return err
+	}
+	s.cp.hub.update(s.id, func(current []string) []string {
+		for _, p := range patterns {
+			if !contains(current, p) {
+				current = append(current, p)
+			}
+		}
+		return current
+	})
+	return nil
+}
+
+// Unsubscribe removes channel patterns
+func (s *Subscription) Unsubscribe(patterns ...string) {
+	s.cp.hub.update(s.id, func(current []string) []string {
+		kept := current[:0]
+		for _, p := range current {
+			if !contains(patterns, p) {
+				kept = append(kept, p)
+			}
+		}
+		return kept
+	})
+}
+
+// Channels returns the current channel patterns
+func (s *Subscription) Channels() []string {
+	return s.cp.hub.patterns(s.id)
+}
+
+// Close detaches the subscription from the hub
+func (s *Subscription) Close() {
+	s.cp.hub.detach(s.id)
+}
+
+// UserChannel returns the channel of a user ("user:42")
+// SSE and gRPC streams always receive the channel of their UserProvider
+// user, so a handler reaches a user on any instance (see Config.PubSub) by
+// broadcasting to UserChannel(id).
+func UserChannel(userID string) string {
+	return "user:" + userID
+}
+
+// StreamChannels returns patterns plus the user, notification, progress and
+// job channels of the UserProvider user of ctx, if any. Patterns must be authorized first;
+// those channels are not. Nil patterns (all channels) are returned as is.
+func (cp *CrudP) StreamChannels(ctx context.Context, patterns []string) []string {
+	if cp.config.UserProvider == nil {
+		return patterns
+	}
+	user := cp.config.UserProvider.GetUserID(ctx)
+	if user == "" || patterns == nil {
+		return patterns
+	}
+	patterns = patterns[:len(patterns):len(patterns)]
+	for _, channel := range []string{UserChannel(user), NotifyChannel(user), ProgressChannel(user), JobChannel(user)} {
+		if !matchesAny(patterns, channel) {
+			patterns = append(patterns, channel)
+		}
+	}
+	return patterns
+}
+
+// SubscriptionAuthorizer decides which channel patterns a caller may
+// subscribe to (optional, server only). Set it in Config.SubscriptionAuthorizer.
+type SubscriptionAuthorizer interface {
+	AuthorizeSubscription(ctx context.Context, pattern string) error
+}
+
+// AuthorizeSubscription checks every pattern with Config.SubscriptionAuthorizer
+// Allows everything when no authorizer is set.
+func (cp *CrudP) AuthorizeSubscription(ctx context.Context, patterns ...string) error {
+	auth := cp.config.SubscriptionAuthorizer
+	if auth == nil {
+		return nil
+	}
+	for _, p := range patterns {
+		if err := auth.AuthorizeSubscription(ctx, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribers returns the number of SSE connections and Listen callbacks
+func (cp *CrudP) Subscribers() int {
+	cp.hub.mu.Lock()
+	defer cp.hub.mu.Unlock()
+	return len(cp.hub.subs)
+}
+
+// routeToSSE encodes data and sends it to the SSE broadcast channels of the
+// tenant of ctx. Data with redacted fields is encoded once per channel.
+func (cp *CrudP) routeToSSE(ctx context.Context, data any, broadcast []string, handlerID uint8) {
+	cp.log.Debug("routeToSSE", "handler", handlerID, "channels", broadcast)
+
+	redacted := data != nil && hasRedacted(reflect.TypeOf(data))
+	logged, err := cp.codec.Encode(cp.Redact("", data))
 	if err != nil {
-		cp.log("routeToSSE encoding error:", err)
+		cp.log.Error("routeToSSE encoding failed", "handler", handlerID, "error", err)
 		return
 	}
 
-	// In a real implementation, this would send the encodedData to the specified broadcast channels.
-	// For now, we will just log the encoded data.
 	for _, channel := range broadcast {
-		cp.log("Broadcasting to channel:", channel, "data:", string(encodedData))
+		encodedData := logged
+		if redacted {
+			if encodedData, err = cp.codec.Encode(cp.Redact(channel, data)); err != nil {
+				cp.log.Error("routeToSSE encoding failed", "handler", handlerID, "channel", channel, "error", err)
+				continue
+			}
+		}
+		cp.log.Debug("broadcasting", "channel", channel, "data", string(logged))
+		cp.emit(ctx, Event{Channel: channel, HandlerID: handlerID, Data: encodedData})
 	}
 }
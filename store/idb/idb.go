@@ -0,0 +1,242 @@
+//go:build wasm
+
+// Package idb is a store.Backend over the browser IndexedDB, so the handlers
+// built with store.New run fully offline in the WASM client with the same
+// module code as the server.
+//
+//	db, err := idb.Open("app", "note", "task")
+//	notes, err := store.New(db, &Note{})
+//
+// Every table used must be passed to Open, which creates the missing object
+// stores by upgrading the database version. Calls block the calling goroutine
+// until IndexedDB answers, so they must not run inside a js.FuncOf callback.
+package idb
+
+import (
+	"context"
+	"syscall/js"
+
+	"github.com/cdvelop/crudp/store"
+	. "github.com/cdvelop/tinystring"
+)
+
+// seqStore holds the last ID handed out by NextID, keyed by table
+const seqStore = "_seq"
+
+var _ store.Backend = (*DB)(nil)
+
+// DB is a store.Backend backed by one IndexedDB database
+type DB struct {
+	db     js.Value
+	tables []string
+}
+
+// Open opens the IndexedDB database name with an object store per table
+func Open(name string, tables ...string) (*DB, error) {
+	tables = append(tables, seqStore)
+	db, err := open(name, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	names := db.Get("objectStoreNames")
+	for _, t := range tables {
+		if !names.Call("contains", t).Bool() {
+			missing = append(missing, t)
+		}
+	}
+	if len(missing) > 0 {
+		version := db.Get("version").Int()
+		db.Call("close")
+		if db, err = open(name, version+1, missing); err != nil {
+			return nil, err
+		}
+	}
+	return &DB{db: db, tables: tables}, nil
+}
+
+// Close closes the database; db must not be used afterwards
+func (d *DB) Close() error {
+	d.db.Call("close")
+	return nil
+}
+
+func (d *DB) Get(ctx context.Context, table, key string) ([]byte, bool, error) {
+	_, store, err := d.store(table, "readonly")
+	if err != nil {
+		return nil, false, err
+	}
+	v, err := wait(store.Call("get", key))
+	if err != nil || v.IsUndefined() {
+		return nil, false, err
+	}
+	return bytesFromJS(v), true, nil
+}
+
+func (d *DB) Put(ctx context.Context, table, key string, value []byte) error {
+	tx, store, err := d.store(table, "readwrite")
+	if err != nil {
+		return err
+	}
+	store.Call("put", bytesToJS(value), key)
+	return waitTx(tx)
+}
+
+func (d *DB) Delete(ctx context.Context, table, key string) (bool, error) {
+	tx, store, err := d.store(table, "readwrite")
+	if err != nil {
+		return false, err
+	}
+	count := store.Call("count", key) // Requests run in order within tx
+	store.Call("delete", key)
+	if err := waitTx(tx); err != nil {
+		return false, err
+	}
+	return count.Get("result").Int() > 0, nil
+}
+
+// Scan reads the whole table in one transaction, then visits it in key order
+func (d *DB) Scan(ctx context.Context, table string, fn func(key string, value []byte) error) error {
+	tx, store, err := d.store(table, "readonly")
+	if err != nil {
+		return err
+	}
+	keys := store.Call("getAllKeys")
+	values := store.Call("getAll")
+	if err := waitTx(tx); err != nil {
+		return err
+	}
+
+	k, v := keys.Get("result"), values.Get("result")
+	for i := 0; i < k.Length(); i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(k.Index(i).String(), bytesFromJS(v.Index(i))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NextID increments the sequence of table in a single transaction
+func (d *DB) NextID(ctx context.Context, table string) (uint64, error) {
+	tx, store, err := d.store(seqStore, "readwrite")
+	if err != nil {
+		return 0, err
+	}
+
+	var next uint64
+	get := store.Call("get", table)
+	onGet := js.FuncOf(func(this js.Value, args []js.Value) any {
+		if last := get.Get("result"); !last.IsUndefined() {
+			next = uint64(last.Float())
+		}
+		next++
+		store.Call("put", float64(next), table) // Before tx auto-commits
+		return nil
+	})
+	defer onGet.Release()
+	get.Set("onsuccess", onGet)
+
+	if err := waitTx(tx); err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+// store starts a transaction on the object store of table
+func (d *DB) store(table, mode string) (tx, store js.Value, err error) {
+	for _, t := range d.tables {
+		if t == table {
+			tx = d.db.Call("transaction", table, mode)
+			return tx, tx.Call("objectStore", table), nil
+		}
+	}
+	return js.Undefined(), js.Undefined(), Err(Fmt("idb: table %s was not passed to Open", table))
+}
+
+// open opens name at version (0 = current), creating the create stores
+func open(name string, version int, create []string) (js.Value, error) {
+	factory := js.Global().Get("indexedDB")
+	if factory.IsUndefined() {
+		return js.Undefined(), Errf("idb: indexedDB is not available")
+	}
+	var req js.Value
+	if version > 0 {
+		req = factory.Call("open", name, version)
+	} else {
+		req = factory.Call("open", name)
+	}
+
+	onUpgrade := js.FuncOf(func(this js.Value, args []js.Value) any {
+		db := req.Get("result")
+		for _, t := range create {
+			db.Call("createObjectStore", t)
+		}
+		return nil
+	})
+	defer onUpgrade.Release()
+	req.Set("onupgradeneeded", onUpgrade)
+	return wait(req)
+}
+
+// wait blocks until the IDBRequest req settles and returns its result
+func wait(req js.Value) (js.Value, error) {
+	done := make(chan error, 1)
+	onSuccess := js.FuncOf(func(this js.Value, args []js.Value) any {
+		done <- nil
+		return nil
+	})
+	onError := js.FuncOf(func(this js.Value, args []js.Value) any {
+		done <- Err(Fmt("idb: %s", errorString(req.Get("error"))))
+		return nil
+	})
+	defer onSuccess.Release()
+	defer onError.Release()
+	req.Set("onsuccess", onSuccess)
+	req.Set("onerror", onError)
+
+	if err := <-done; err != nil {
+		return js.Undefined(), err
+	}
+	return req.Get("result"), nil
+}
+
+// waitTx blocks until the IDBTransaction tx commits or aborts
+func waitTx(tx js.Value) error {
+	done := make(chan error, 1)
+	onComplete := js.FuncOf(func(this js.Value, args []js.Value) any {
+		done <- nil
+		return nil
+	})
+	onAbort := js.FuncOf(func(this js.Value, args []js.Value) any {
+		done <- Err(Fmt("idb: transaction aborted: %s", errorString(tx.Get("error"))))
+		return nil
+	})
+	defer onComplete.Release()
+	defer onAbort.Release()
+	tx.Set("oncomplete", onComplete)
+	tx.Set("onabort", onAbort) // Failed requests abort tx as well
+	return <-done
+}
+
+func errorString(err js.Value) string {
+	if err.IsNull() || err.IsUndefined() {
+		return "unknown error"
+	}
+	return err.Call("toString").String()
+}
+
+func bytesToJS(b []byte) js.Value {
+	v := js.Global().Get("Uint8Array").New(len(b))
+	js.CopyBytesToJS(v, b)
+	return v
+}
+
+func bytesFromJS(v js.Value) []byte {
+	b := make([]byte, v.Get("length").Int())
+	js.CopyBytesToGo(b, v)
+	return b
+}
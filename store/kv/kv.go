@@ -0,0 +1,284 @@
+//go:build !wasm
+
+// Package kv is an embedded store.Backend kept in a single append-only file,
+// for small self-hosted deployments where a SQL database is overkill.
+//
+//	db, err := kv.Open("data/app.kv")
+//	defer db.Close()
+//	notes, err := store.New(db, &Note{})
+//
+// Every write appends one record and syncs the file; the whole data set is
+// indexed in memory. Overwritten and deleted records stay in the file until
+// Compact rewrites it. A record cut short by a crash is dropped on Open.
+package kv
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/cdvelop/crudp/store"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Record operations
+const (
+	opPut    = 'p'
+	opDelete = 'd'
+	opSeq    = 's' // Value is the last ID handed out by NextID
+)
+
+var _ store.Backend = (*DB)(nil)
+
+// DB is a store.Backend backed by one file
+type DB struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	tables map[string]*table
+}
+
+type table struct {
+	seq    uint64
+	values map[string][]byte
+}
+
+// Open loads the file at path, creating it if missing
+func Open(path string) (*DB, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{path: path, file: f, tables: map[string]*table{}}
+	if err := db.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Close closes the file; db must not be used afterwards
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.file == nil {
+		return nil
+	}
+	err := db.file.Close()
+	db.file = nil
+	return err
+}
+
+func (db *DB) Get(ctx context.Context, tbl, key string) ([]byte, bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	value, ok := db.table(tbl).values[key]
+	return value, ok, nil
+}
+
+func (db *DB) Put(ctx context.Context, tbl, key string, value []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	value = append([]byte(nil), value...)
+	if err := db.write(opPut, tbl, key, value); err != nil {
+		return err
+	}
+	db.table(tbl).values[key] = value
+	return nil
+}
+
+func (db *DB) Delete(ctx context.Context, tbl, key string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t := db.table(tbl)
+	if _, ok := t.values[key]; !ok {
+		return false, nil
+	}
+	if err := db.write(opDelete, tbl, key, nil); err != nil {
+		return false, err
+	}
+	delete(t.values, key)
+	return true, nil
+}
+
+// Scan visits a snapshot of the table in key order, so fn may write to db
+func (db *DB) Scan(ctx context.Context, tbl string, fn func(key string, value []byte) error) error {
+	db.mu.Lock()
+	t := db.table(tbl)
+	keys := make([]string, 0, len(t.values))
+	for k := range t.values {
+		keys = append(keys, k)
+	}
+	values := make([][]byte, len(keys))
+	sort.Strings(keys)
+	for i, k := range keys {
+		values[i] = t.values[k]
+	}
+	db.mu.Unlock()
+
+	for i, k := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(k, values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NextID persists and returns the next sequence number of the table
+// IDs are never reused, even after the entity holding one is deleted.
+func (db *DB) NextID(ctx context.Context, tbl string) (uint64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t := db.table(tbl)
+	if err := db.write(opSeq, tbl, "", binary.AppendUvarint(nil, t.seq+1)); err != nil {
+		return 0, err
+	}
+	t.seq++
+	return t.seq, nil
+}
+
+// Compact rewrites the file with only the live records
+func (db *DB) Compact() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.file == nil {
+		return Err(Fmt("kv: %s is closed", db.path))
+	}
+
+	var buf []byte
+	for name, t := range db.tables {
+		if t.seq > 0 {
+			buf = appendRecord(buf, opSeq, name, "", binary.AppendUvarint(nil, t.seq))
+		}
+		for k, v := range t.values {
+			buf = appendRecord(buf, opPut, name, k, v)
+		}
+	}
+
+	tmp := db.path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0o644); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(tmp, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := os.Rename(tmp, db.path); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(0, 2); err != nil {
+		f.Close()
+		return err
+	}
+	db.file.Close()
+	db.file = f
+	return nil
+}
+
+// table returns the named table, creating it. Called with mu held
+func (db *DB) table(name string) *table {
+	t := db.tables[name]
+	if t == nil {
+		t = &table{values: map[string][]byte{}}
+		db.tables[name] = t
+	}
+	return t
+}
+
+// write appends and syncs one record. Called with mu held
+func (db *DB) write(op byte, tbl, key string, value []byte) error {
+	if db.file == nil {
+		return Err(Fmt("kv: %s is closed", db.path))
+	}
+	if _, err := db.file.Write(appendRecord(nil, op, tbl, key, value)); err != nil {
+		return err
+	}
+	return db.file.Sync()
+}
+
+// load replays the file into memory, truncating a torn last record
+func (db *DB) load() error {
+	data, err := os.ReadFile(db.path)
+	if err != nil {
+		return err
+	}
+
+	offset := 0
+	for offset < len(data) {
+		op, tbl, key, value, n := readRecord(data[offset:])
+		if n == 0 {
+			break
+		}
+		t := db.table(tbl)
+		switch op {
+		case opPut:
+			t.values[key] = value
+		case opDelete:
+			delete(t.values, key)
+		case opSeq:
+			t.seq, _ = binary.Uvarint(value)
+		default:
+			return Err(Fmt("kv: %s: unknown record %q at offset %d", db.path, op, offset))
+		}
+		offset += n
+	}
+
+	if offset < len(data) {
+		if err := db.file.Truncate(int64(offset)); err != nil {
+			return err
+		}
+	}
+	_, err = db.file.Seek(int64(offset), 0)
+	return err
+}
+
+// appendRecord encodes uvarint(len) op uvarint(len) table uvarint(len) key value
+func appendRecord(buf []byte, op byte, tbl, key string, value []byte) []byte {
+	payload := []byte{op}
+	payload = binary.AppendUvarint(payload, uint64(len(tbl)))
+	payload = append(payload, tbl...)
+	payload = binary.AppendUvarint(payload, uint64(len(key)))
+	payload = append(payload, key...)
+	payload = append(payload, value...)
+
+	buf = binary.AppendUvarint(buf, uint64(len(payload)))
+	return append(buf, payload...)
+}
+
+// readRecord decodes one record, n is 0 if data holds no complete record
+func readRecord(data []byte) (op byte, tbl, key string, value []byte, n int) {
+	size, head := binary.Uvarint(data)
+	if head <= 0 || size == 0 || uint64(len(data)-head) < size {
+		return 0, "", "", nil, 0
+	}
+	payload := data[head : head+int(size)]
+	op, payload = payload[0], payload[1:]
+
+	field := func() (string, bool) {
+		l, k := binary.Uvarint(payload)
+		if k <= 0 || uint64(len(payload)-k) < l {
+			return "", false
+		}
+		s := string(payload[k : k+int(l)])
+		payload = payload[k+int(l):]
+		return s, true
+	}
+	tbl, ok := field()
+	if !ok {
+		return 0, "", "", nil, 0
+	}
+	if key, ok = field(); !ok {
+		return 0, "", "", nil, 0
+	}
+	return op, tbl, key, append([]byte(nil), payload...), head + int(size)
+}
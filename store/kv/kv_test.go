@@ -0,0 +1,105 @@
+//go:build !wasm
+
+package kv
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDB(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "app.kv")
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put(ctx, "note", "b", []byte("2"))
+	db.Put(ctx, "note", "a", []byte("1"))
+	db.Put(ctx, "note", "c", []byte("3"))
+	db.Put(ctx, "note", "a", []byte("one"))
+	if found, _ := db.Delete(ctx, "note", "c"); !found {
+		t.Error("delete: not found")
+	}
+	if found, _ := db.Delete(ctx, "note", "c"); found {
+		t.Error("delete twice: found")
+	}
+	db.NextID(ctx, "note")
+	db.NextID(ctx, "note")
+	db.Close()
+	if err := db.Put(ctx, "note", "d", nil); err == nil || err.Error() != "kv: "+path+" is closed" {
+		t.Errorf("expected closed error, got %v", err)
+	}
+
+	check := func(db *DB) {
+		t.Helper()
+		var keys, values []string
+		db.Scan(ctx, "note", func(k string, v []byte) error {
+			keys, values = append(keys, k), append(values, string(v))
+			return nil
+		})
+		if len(keys) != 2 || keys[0] != "a" || values[0] != "one" || keys[1] != "b" {
+			t.Errorf("scan %v %v", keys, values)
+		}
+		if id, _ := db.NextID(ctx, "note"); id != 3 {
+			t.Errorf("sequence not persisted: %d", id)
+		}
+	}
+
+	t.Run("Reopen", func(t *testing.T) {
+		db, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		check(db)
+	})
+
+	t.Run("Torn Record", func(t *testing.T) {
+		f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+		f.Write(appendRecord(nil, opPut, "note", "z", []byte("partial"))[:6])
+		f.Close()
+
+		db, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, found, _ := db.Get(ctx, "note", "z"); found {
+			t.Error("torn record loaded")
+		}
+		db.Put(ctx, "note", "d", []byte("4"))
+		db.Close()
+
+		db, _ = Open(path)
+		defer db.Close()
+		if v, _, _ := db.Get(ctx, "note", "d"); string(v) != "4" {
+			t.Errorf("write after torn record lost: %q", v)
+		}
+	})
+
+	t.Run("Compact", func(t *testing.T) {
+		db, _ := Open(path)
+		before, _ := os.Stat(path)
+		if err := db.Compact(); err != nil {
+			t.Fatal(err)
+		}
+		after, _ := os.Stat(path)
+		if after.Size() >= before.Size() {
+			t.Errorf("size %d -> %d", before.Size(), after.Size())
+		}
+		db.Put(ctx, "note", "e", []byte("5"))
+		db.Close()
+
+		db, _ = Open(path)
+		defer db.Close()
+		if v, _, _ := db.Get(ctx, "note", "e"); string(v) != "5" {
+			t.Errorf("write after compact lost: %q", v)
+		}
+		if v, _, _ := db.Get(ctx, "note", "a"); string(v) != "one" {
+			t.Errorf("compacted value %q", v)
+		}
+	})
+}
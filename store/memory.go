@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory is a Backend kept in process memory, for tests and throwaway data
+type Memory struct {
+	mu     sync.Mutex
+	tables []memTable
+}
+
+type memTable struct {
+	name    string
+	seq     uint64
+	entries []memEntry // Sorted by key
+}
+
+type memEntry struct {
+	key   string
+	value []byte
+}
+
+// NewMemory returns an empty Memory backend
+func NewMemory() *Memory { return &Memory{} }
+
+func (m *Memory) Get(ctx context.Context, table, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.table(table)
+	if i, ok := t.find(key); ok {
+		return t.entries[i].value, true, nil
+	}
+	return nil, false, nil
+}
+
+func (m *Memory) Put(ctx context.Context, table, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.table(table)
+	value = append([]byte(nil), value...)
+	i, ok := t.find(key)
+	if ok {
+		t.entries[i].value = value
+		return nil
+	}
+	t.entries = append(t.entries, memEntry{})
+	copy(t.entries[i+1:], t.entries[i:])
+	t.entries[i] = memEntry{key: key, value: value}
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, table, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.table(table)
+	i, ok := t.find(key)
+	if ok {
+		t.entries = append(t.entries[:i], t.entries[i+1:]...)
+	}
+	return ok, nil
+}
+
+// Scan visits a snapshot of the table, so fn may write to m
+func (m *Memory) Scan(ctx context.Context, table string, fn func(key string, value []byte) error) error {
+	m.mu.Lock()
+	entries := append([]memEntry(nil), m.table(table).entries...)
+	m.mu.Unlock()
+	for _, e := range entries {
+		if err := fn(e.key, e.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) NextID(ctx context.Context, table string) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.table(table)
+	t.seq++
+	return t.seq, nil
+}
+
+// table returns the named table, creating it. Called with mu held
+func (m *Memory) table(name string) *memTable {
+	for i := range m.tables {
+		if m.tables[i].name == name {
+			return &m.tables[i]
+		}
+	}
+	m.tables = append(m.tables, memTable{name: name})
+	return &m.tables[len(m.tables)-1]
+}
+
+// find returns the index of key, or where it would be inserted
+func (t *memTable) find(key string) (int, bool) {
+	lo, hi := 0, len(t.entries)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if t.entries[mid].key < key {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, lo < len(t.entries) && t.entries[lo].key == key
+}
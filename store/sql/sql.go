@@ -0,0 +1,419 @@
+//go:build !wasm
+
+// Package sql is a ready-made crudp handler keeping one struct type in a SQL
+// table through database/sql, so simple tables need no handler code.
+//
+//	users, err := sql.New(db, &User{}, sql.Table("users"))
+//	cp := crudp.New(crudp.WithHandlers(users))
+//
+// Columns are the exported fields, named by their `db` tag or the snake_case
+// field name; `db:"-"` skips a field. The key is the field tagged
+// `db:",key"`, else the one named ID. Integer keys left at zero on Create are
+// generated by the database.
+//
+// An integer field tagged `db:",version"` enables optimistic concurrency:
+// Update only writes the row still at the version sent, in the same
+// statement (UPDATE ... WHERE version = ?), increments it, and reports a
+// *crudp.ConflictError otherwise.
+//
+// The client build registers the plain struct under the same name
+// (sql.New uses the snake_case type name, see Name).
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Placeholder styles of the generated queries
+const (
+	Question = iota // ?, ?, ? (SQLite, MySQL)
+	Dollar          // $1, $2, $3 (PostgreSQL), keys are read with RETURNING
+)
+
+// Handler implements crudp.Creator, Reader, Updater and Deleter for one table
+// Read returns the rows matching each item: by key when it is set, else by its
+// non-zero fields; no items returns every row.
+type Handler struct {
+	db          *stdsql.DB
+	typ         reflect.Type
+	name        string
+	table       string
+	placeholder int
+	columns     []column
+	key         int // Index of the key in columns
+	version     int // Index of the version in columns, -1 if none
+	tokens      crudp.ConsistencyTokens
+}
+
+// column maps a struct field to a table column
+type column struct {
+	name  string
+	index []int
+	auto  bool // Integer key generated by the database when zero
+}
+
+// Option configures New
+type Option func(h *Handler)
+
+// Table sets the table name. Default: snake_case type name
+func Table(name string) Option {
+	return func(h *Handler) { h.table = name }
+}
+
+// Name sets the handler name. Default: snake_case type name
+func Name(name string) Option {
+	return func(h *Handler) { h.name = name }
+}
+
+// Placeholders sets the placeholder style, Question or Dollar. Default: Question
+func Placeholders(style int) Option {
+	return func(h *Handler) { h.placeholder = style }
+}
+
+// Consistency sets the read-your-writes tokens of db, e.g. the WAL position
+// of a PostgreSQL primary awaited on its replica. Default: nil
+func Consistency(tokens crudp.ConsistencyTokens) Option {
+	return func(h *Handler) { h.tokens = tokens }
+}
+
+// New returns a Handler storing values of the struct type of prototype in db
+func New(db *stdsql.DB, prototype any, opts ...Option) (*Handler, error) {
+	if db == nil {
+		return nil, Errf("sql: db is nil")
+	}
+	t := reflect.TypeOf(prototype)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		got := "nil"
+		if prototype != nil {
+			got = reflect.TypeOf(prototype).String()
+		}
+		return nil, Err(Fmt("sql: prototype %s is not a struct", got))
+	}
+
+	snake := Convert(t.Name()).SnakeLow().String()
+	h := &Handler{db: db, typ: t, name: snake, table: snake, key: -1, version: -1}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := f.Tag.Get("db")
+		name, flags, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = Convert(f.Name).SnakeLow().String()
+		}
+		col := column{name: name, index: f.Index}
+		if flags == "version" {
+			if !isInteger(f.Type.Kind()) {
+				return nil, Err(Fmt("sql: version field %s is not an integer", f.Name))
+			}
+			h.version = len(h.columns)
+		} else if flags == "key" || (h.key < 0 && f.Name == "ID") {
+			h.key = len(h.columns)
+			col.auto = isInteger(f.Type.Kind())
+		}
+		h.columns = append(h.columns, col)
+	}
+	if h.key < 0 {
+		return nil, Err(Fmt("sql: %s has no ID field or `db:\",key\"` tag", t.Name()))
+	}
+	return h, nil
+}
+
+func (h *Handler) HandlerName() string { return h.name }
+
+// Consistency returns the tokens set with the Consistency option
+func (h *Handler) Consistency() crudp.ConsistencyTokens { return h.tokens }
+
+// Entity makes crudp decode packet data into the stored type
+func (h *Handler) Entity() any { return reflect.New(h.typ).Interface() }
+
+func (h *Handler) Create(ctx context.Context, data ...any) any {
+	return h.each(data, func(v reflect.Value) (any, error) {
+		key := v.FieldByIndex(h.columns[h.key].index)
+		generate := h.columns[h.key].auto && key.IsZero()
+
+		var names []string
+		var args []any
+		for i, c := range h.columns {
+			if i == h.key && generate {
+				continue
+			}
+			names = append(names, c.name)
+			args = append(args, v.FieldByIndex(c.index).Interface())
+		}
+		query := "INSERT INTO " + h.table + " (" + strings.Join(names, ", ") + ") VALUES (" + h.params(1, len(args)) + ")"
+
+		if !generate {
+			_, err := h.db.ExecContext(ctx, query, args...)
+			return v.Addr().Interface(), err
+		}
+		if h.placeholder == Dollar {
+			if err := h.db.QueryRowContext(ctx, query+" RETURNING "+h.columns[h.key].name, args...).Scan(key.Addr().Interface()); err != nil {
+				return nil, err
+			}
+			return v.Addr().Interface(), nil
+		}
+		res, err := h.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		if key.CanInt() {
+			key.SetInt(id)
+		} else {
+			key.SetUint(uint64(id))
+		}
+		return v.Addr().Interface(), nil
+	})
+}
+
+func (h *Handler) Read(ctx context.Context, data ...any) any {
+	if len(data) == 0 {
+		rows, err := h.query(ctx, "", nil)
+		if err != nil {
+			return response{err: err}
+		}
+		return rows
+	}
+
+	var out []crudp.Response
+	for _, item := range data {
+		v, err := h.value(item)
+		if err != nil {
+			return response{err: err}
+		}
+
+		var where []string
+		var args []any
+		for i, c := range h.columns {
+			f := v.FieldByIndex(c.index)
+			if f.IsZero() || (i != h.key && !v.FieldByIndex(h.columns[h.key].index).IsZero()) {
+				continue // By key when set, else by the non-zero fields
+			}
+			args = append(args, f.Interface())
+			where = append(where, c.name+" = "+h.param(len(args)))
+		}
+
+		rows, err := h.query(ctx, strings.Join(where, " AND "), args)
+		if err != nil {
+			return response{err: err}
+		}
+		out = append(out, rows...)
+	}
+	return out
+}
+
+func (h *Handler) Update(ctx context.Context, data ...any) any {
+	return h.each(data, func(v reflect.Value) (any, error) {
+		var set []string
+		var args []any
+		var expected any // Version sent, matched by the WHERE clause
+		for i, c := range h.columns {
+			if i == h.key {
+				continue
+			}
+			f := v.FieldByIndex(c.index)
+			if i == h.version {
+				expected = f.Interface()
+				setInteger(f, integer(f)+1)
+			}
+			args = append(args, f.Interface())
+			set = append(set, c.name+" = "+h.param(len(args)))
+		}
+		key := v.FieldByIndex(h.columns[h.key].index).Interface()
+		args = append(args, key)
+		query := "UPDATE " + h.table + " SET " + strings.Join(set, ", ") + " WHERE " + h.columns[h.key].name + " = " + h.param(len(args))
+		if h.version < 0 {
+			return v.Addr().Interface(), h.exec(ctx, query, args)
+		}
+
+		args = append(args, expected)
+		query += " AND " + h.columns[h.version].name + " = " + h.param(len(args))
+		found, err := h.affects(ctx, query, args)
+		if err != nil || found {
+			return v.Addr().Interface(), err
+		}
+		return nil, h.conflict(ctx, v, key)
+	})
+}
+
+// conflict explains an Update matching no row: a stale version, or no row
+// with that key at all
+func (h *Handler) conflict(ctx context.Context, v reflect.Value, key any) error {
+	f := v.FieldByIndex(h.columns[h.version].index)
+	expected := integer(f) - 1
+	setInteger(f, expected)
+
+	var current uint64
+	query := "SELECT " + h.columns[h.version].name + " FROM " + h.table + " WHERE " + h.columns[h.key].name + " = " + h.param(1)
+	switch err := h.db.QueryRowContext(ctx, query, key).Scan(&current); err {
+	case nil:
+		return &crudp.ConflictError{Key: crudp.EntityKey(v.Addr().Interface()), Expected: expected, Current: current}
+	case stdsql.ErrNoRows:
+		return Err(Fmt("sql: %s %v not found", h.name, key))
+	default:
+		return err
+	}
+}
+
+func (h *Handler) Delete(ctx context.Context, data ...any) any {
+	return h.each(data, func(v reflect.Value) (any, error) {
+		key := v.FieldByIndex(h.columns[h.key].index).Interface()
+		query := "DELETE FROM " + h.table + " WHERE " + h.columns[h.key].name + " = " + h.param(1)
+		return v.Addr().Interface(), h.exec(ctx, query, []any{key})
+	})
+}
+
+// each runs fn for every item, stopping at the first error
+func (h *Handler) each(data []any, fn func(v reflect.Value) (any, error)) any {
+	out := make([]crudp.Response, 0, len(data))
+	for _, item := range data {
+		v, err := h.value(item)
+		if err != nil {
+			return response{err: err}
+		}
+		result, err := fn(v)
+		if err != nil {
+			return response{err: err}
+		}
+		out = append(out, response{data: result})
+	}
+	return out
+}
+
+// exec runs a statement that must affect one row
+func (h *Handler) exec(ctx context.Context, query string, args []any) error {
+	found, err := h.affects(ctx, query, args)
+	if err == nil && !found {
+		return Err(Fmt("sql: %s %v not found", h.name, args[len(args)-1]))
+	}
+	return err
+}
+
+// affects runs a statement and reports whether it changed a row (true when
+// the driver cannot tell)
+func (h *Handler) affects(ctx context.Context, query string, args []any) (bool, error) {
+	res, err := h.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return err != nil || n > 0, nil
+}
+
+// query selects the rows matching where ("" = all)
+func (h *Handler) query(ctx context.Context, where string, args []any) ([]crudp.Response, error) {
+	names := make([]string, len(h.columns))
+	for i, c := range h.columns {
+		names[i] = c.name
+	}
+	query := "SELECT " + strings.Join(names, ", ") + " FROM " + h.table
+	if where != "" {
+		query += " WHERE " + where
+	}
+
+	rows, err := h.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []crudp.Response
+	dest := make([]any, len(h.columns))
+	for rows.Next() {
+		ptr := reflect.New(h.typ)
+		for i, c := range h.columns {
+			dest[i] = ptr.Elem().FieldByIndex(c.index).Addr().Interface()
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		out = append(out, response{data: ptr.Interface()})
+	}
+	return out, rows.Err()
+}
+
+// value returns the addressable struct behind a decoded item
+func (h *Handler) value(item any) (reflect.Value, error) {
+	v := reflect.ValueOf(item)
+	if v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Type() == h.typ {
+		return v.Elem(), nil
+	}
+	got := "nil"
+	if item != nil {
+		got = v.Type().String()
+	}
+	return reflect.Value{}, Err(Fmt("sql: %s expects *%s, got %s", h.name, h.typ.Name(), got))
+}
+
+func isInteger(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// integer reads a signed or unsigned integer field
+func integer(f reflect.Value) uint64 {
+	if f.CanInt() {
+		return uint64(f.Int())
+	}
+	return f.Uint()
+}
+
+// setInteger writes a signed or unsigned integer field
+func setInteger(f reflect.Value, n uint64) {
+	if f.CanInt() {
+		f.SetInt(int64(n))
+	} else {
+		f.SetUint(n)
+	}
+}
+
+// param returns the nth placeholder (from 1)
+func (h *Handler) param(n int) string {
+	if h.placeholder == Dollar {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// params returns count placeholders starting at from
+func (h *Handler) params(from, count int) string {
+	list := make([]string, count)
+	for i := range list {
+		list[i] = h.param(from + i)
+	}
+	return strings.Join(list, ", ")
+}
+
+// response sends one item (or the error) as its own result Data entry
+type response struct {
+	data any
+	err  error
+}
+
+func (r response) Response() (any, []string, error) { return r.data, nil, r.err }
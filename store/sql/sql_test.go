@@ -0,0 +1,266 @@
+//go:build !wasm
+
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+type Contact struct {
+	ID    int
+	Email string
+	Note  string `db:"-"`
+	Phone string `db:"tel"`
+}
+
+// Note is a Contact-like row with a version column
+type Note struct {
+	ID   int
+	Body string
+	Rev  uint64 `db:",version"`
+}
+
+// fakeDriver records statements and answers SELECTs with rows
+type fakeDriver struct {
+	mu       sync.Mutex
+	queries  []string
+	args     [][]driver.Value
+	cols     []string // Columns of the rows, default id, email, tel
+	rows     [][]driver.Value
+	affected int64
+}
+
+type fakeConn struct{ d *fakeDriver }
+
+type fakeStmt struct {
+	d     *fakeDriver
+	query string
+}
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{d}, nil }
+
+func (d *fakeDriver) record(query string, args []driver.Value) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queries = append(d.queries, query)
+	d.args = append(d.args, args)
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.d, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return nil, io.EOF }
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.record(s.query, args)
+	return fakeResult{s.d.affected}, nil
+}
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.record(s.query, args)
+	cols := s.d.cols
+	if cols == nil {
+		cols = []string{"id", "email", "tel"}
+	}
+	return &fakeRows{cols: cols, rows: s.d.rows}, nil
+}
+
+type fakeResult struct{ affected int64 }
+
+func (r fakeResult) LastInsertId() (int64, error) { return 42, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+var registerOnce sync.Once
+var driverInstance = &fakeDriver{}
+
+func newStore(t *testing.T, opts ...Option) (*Handler, *fakeDriver, *crudp.CrudP) {
+	t.Helper()
+	return newStoreOf(t, &Contact{}, opts...)
+}
+
+// newStoreOf is newStore for another prototype
+func newStoreOf(t *testing.T, prototype any, opts ...Option) (*Handler, *fakeDriver, *crudp.CrudP) {
+	t.Helper()
+	registerOnce.Do(func() { stdsql.Register("crudp-store-fake", driverInstance) })
+	d := driverInstance
+	d.mu.Lock()
+	d.queries, d.args, d.cols, d.rows, d.affected = nil, nil, nil, nil, 1
+	d.mu.Unlock()
+
+	db, err := stdsql.Open("crudp-store-fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	h, err := New(db, prototype, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h, d, crudp.New(crudp.WithHandlers(h))
+}
+
+// call sends one packet through cp and returns its result
+func call(t *testing.T, cp *crudp.CrudP, action byte, items ...any) crudp.PacketResult {
+	t.Helper()
+	packet, err := cp.EncodePacket(action, 0, "r1", items...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p crudp.Packet
+	cp.DecodePacket(packet, &p)
+	batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{p}})
+	resp, err := cp.ProcessBatch(context.Background(), batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var br crudp.BatchResponse
+	if err := cp.Codec().Decode(resp, &br); err != nil || len(br.Results) != 1 {
+		t.Fatalf("decode: %v", err)
+	}
+	return br.Results[0]
+}
+
+func TestHandler(t *testing.T) {
+	t.Run("Create Generates Key", func(t *testing.T) {
+		_, d, cp := newStore(t)
+		pr := call(t, cp, 'c', &Contact{Email: "a@b.c", Phone: "1", Note: "x"})
+		if pr.MessageType == uint8(Msg.Error) {
+			t.Fatal(pr.Message)
+		}
+		if d.queries[0] != "INSERT INTO contact (email, tel) VALUES (?, ?)" || len(d.args[0]) != 2 {
+			t.Errorf("query %q args %v", d.queries[0], d.args[0])
+		}
+		var got Contact
+		cp.DecodeData(&pr.Packet, 0, &got)
+		if got.ID != 42 || got.Email != "a@b.c" {
+			t.Errorf("created %+v", got)
+		}
+	})
+
+	t.Run("Read By Key Or Example", func(t *testing.T) {
+		_, d, cp := newStore(t, Table("contacts"))
+		d.rows = [][]driver.Value{{int64(7), "a@b.c", "1"}}
+		pr := call(t, cp, 'r', &Contact{ID: 7, Email: "ignored"})
+		if d.queries[0] != "SELECT id, email, tel FROM contacts WHERE id = ?" || len(pr.Data) != 1 {
+			t.Errorf("query %q, %d items", d.queries[0], len(pr.Data))
+		}
+		var got Contact
+		cp.DecodeData(&pr.Packet, 0, &got)
+		if got.ID != 7 || got.Phone != "1" {
+			t.Errorf("read %+v", got)
+		}
+
+		call(t, cp, 'r', &Contact{Email: "a@b.c", Phone: "1"})
+		if d.queries[1] != "SELECT id, email, tel FROM contacts WHERE email = ? AND tel = ?" {
+			t.Errorf("query %q", d.queries[1])
+		}
+	})
+
+	t.Run("Update And Delete", func(t *testing.T) {
+		_, d, cp := newStore(t, Placeholders(Dollar))
+		call(t, cp, 'u', &Contact{ID: 3, Email: "n", Phone: "2"})
+		call(t, cp, 'd', &Contact{ID: 3})
+		if d.queries[0] != "UPDATE contact SET email = $1, tel = $2 WHERE id = $3" {
+			t.Errorf("update %q", d.queries[0])
+		}
+		if d.queries[1] != "DELETE FROM contact WHERE id = $1" || d.args[1][0] != int64(3) {
+			t.Errorf("delete %q %v", d.queries[1], d.args[1])
+		}
+	})
+
+	t.Run("Missing Row", func(t *testing.T) {
+		_, d, cp := newStore(t)
+		d.affected = 0
+		pr := call(t, cp, 'd', &Contact{ID: 9})
+		if pr.MessageType != uint8(Msg.Error) || !strings.Contains(pr.Message, "contact 9 not found") {
+			t.Errorf("expected not found, got %q", pr.Message)
+		}
+	})
+
+	t.Run("Update Checks The Version", func(t *testing.T) {
+		_, d, cp := newStoreOf(t, &Note{})
+		pr := call(t, cp, 'u', &Note{ID: 3, Body: "b", Rev: 2})
+		if d.queries[0] != "UPDATE note SET body = ?, rev = ? WHERE id = ? AND rev = ?" {
+			t.Errorf("update %q", d.queries[0])
+		}
+		if args := d.args[0]; args[1] != int64(3) || args[3] != int64(2) {
+			t.Errorf("expected version 2 replaced by 3, got %v", args)
+		}
+		var got Note
+		cp.DecodeData(&pr.Packet, 0, &got)
+		if got.Rev != 3 {
+			t.Errorf("expected the new version sent back, got %+v", got)
+		}
+	})
+
+	t.Run("Stale Version Conflicts", func(t *testing.T) {
+		_, d, cp := newStoreOf(t, &Note{})
+		d.affected, d.cols, d.rows = 0, []string{"rev"}, [][]driver.Value{{int64(5)}}
+		pr := call(t, cp, 'u', &Note{ID: 3, Body: "b", Rev: 2})
+		if !crudp.IsConflict(pr) || !strings.Contains(pr.Message, "expected 2, current 5") {
+			t.Errorf("expected conflict, got %q (code %q)", pr.Message, pr.Code)
+		}
+
+		d.rows = nil
+		pr = call(t, cp, 'u', &Note{ID: 3, Body: "b", Rev: 2})
+		if crudp.IsConflict(pr) || !strings.Contains(pr.Message, "note 3 not found") {
+			t.Errorf("expected not found, got %q", pr.Message)
+		}
+	})
+
+	t.Run("Shares The Client Schema", func(t *testing.T) {
+		_, _, server := newStore(t)
+		client := crudp.New(crudp.WithHandlers(&Contact{}))
+		if err := server.VerifySchema(client.SchemaTable()); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestNewErrors(t *testing.T) {
+	registerOnce.Do(func() { stdsql.Register("crudp-store-fake", driverInstance) })
+	db, _ := stdsql.Open("crudp-store-fake", "")
+	type noKey struct{ Name string }
+	if _, err := New(db, &noKey{}); err == nil {
+		t.Error("expected error without a key")
+	}
+	if _, err := New(db, 3); err == nil || !strings.Contains(err.Error(), "prototype int") {
+		t.Error("expected error for a non-struct")
+	}
+	type textVersion struct {
+		ID  int
+		Rev string `db:",version"`
+	}
+	if _, err := New(db, &textVersion{}); err == nil {
+		t.Error("expected error for a non-integer version")
+	}
+	if _, err := New(nil, &Contact{}); err == nil {
+		t.Error("expected error for a nil db")
+	}
+}
@@ -0,0 +1,303 @@
+// Package store is a ready-made crudp handler keeping one struct type in a
+// key-value Backend, so the same module runs on an embedded file (store/kv),
+// in the browser (store/idb) or in memory (NewMemory) without handler code.
+//
+//	notes, err := store.New(kv, &Note{})
+//	cp := crudp.New(crudp.WithHandlers(notes))
+//
+// The key is the field tagged `store:"key"`, else the one named ID. Integer
+// keys left at zero on Create take the next sequence number of the table,
+// empty string keys a random hex ID.
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"reflect"
+
+	"github.com/cdvelop/crudp"
+	"github.com/cdvelop/tinyjson"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Backend keeps encoded values by table and key
+// Scan visits the keys of a table in ascending byte order. Backends reading
+// from eventually consistent replicas also implement crudp.ConsistencyTokens,
+// so clients read their own writes.
+type Backend interface {
+	Get(ctx context.Context, table, key string) (value []byte, found bool, err error)
+	Put(ctx context.Context, table, key string, value []byte) error
+	Delete(ctx context.Context, table, key string) (found bool, err error)
+	Scan(ctx context.Context, table string, fn func(key string, value []byte) error) error
+	NextID(ctx context.Context, table string) (uint64, error)
+}
+
+// Handler implements crudp.Creator, Reader, Updater and Deleter over a Backend
+// Read returns the entities matching each item: by key when it is set, else
+// by its non-zero fields; no items returns every entity.
+type Handler struct {
+	backend Backend
+	codec   crudp.Codec
+	typ     reflect.Type
+	name    string
+	table   string
+	key     []int // Field index of the key
+}
+
+// Option configures New
+type Option func(h *Handler)
+
+// Table sets the table (object store) name. Default: snake_case type name
+func Table(name string) Option {
+	return func(h *Handler) { h.table = name }
+}
+
+// Name sets the handler name. Default: snake_case type name
+func Name(name string) Option {
+	return func(h *Handler) { h.name = name }
+}
+
+// Codec sets the encoding of stored values. Default: tinyjson
+func Codec(c crudp.Codec) Option {
+	return func(h *Handler) { h.codec = c }
+}
+
+// New returns a Handler storing values of the struct type of prototype in b
+func New(b Backend, prototype any, opts ...Option) (*Handler, error) {
+	if b == nil {
+		return nil, Errf("store: backend is nil")
+	}
+	t := reflect.TypeOf(prototype)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		got := "nil"
+		if prototype != nil {
+			got = reflect.TypeOf(prototype).String()
+		}
+		return nil, Err(Fmt("store: prototype %s is not a struct", got))
+	}
+
+	snake := Convert(t.Name()).SnakeLow().String()
+	h := &Handler{backend: b, codec: tinyjson.New(), typ: t, name: snake, table: snake}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("store") == "key" || (h.key == nil && f.Name == "ID") {
+			h.key = f.Index
+		}
+	}
+	if h.key == nil {
+		return nil, Err(Fmt("store: %s has no ID field or `store:\"key\"` tag", t.Name()))
+	}
+	switch t.FieldByIndex(h.key).Type.Kind() {
+	case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return nil, Err(Fmt("store: key of %s must be a string or an integer", t.Name()))
+	}
+	return h, nil
+}
+
+func (h *Handler) HandlerName() string { return h.name }
+
+// Consistency returns the crudp.ConsistencyTokens of the backend, nil if it
+// has none
+func (h *Handler) Consistency() crudp.ConsistencyTokens {
+	tokens, _ := h.backend.(crudp.ConsistencyTokens)
+	return tokens
+}
+
+// Entity makes crudp decode packet data into the stored type
+func (h *Handler) Entity() any { return reflect.New(h.typ).Interface() }
+
+func (h *Handler) Create(ctx context.Context, data ...any) any {
+	return h.each(data, func(v reflect.Value) error {
+		key := v.FieldByIndex(h.key)
+		if key.IsZero() {
+			if err := h.generate(ctx, key); err != nil {
+				return err
+			}
+		} else if _, found, err := h.backend.Get(ctx, h.table, keyString(key)); err != nil {
+			return err
+		} else if found {
+			return Err(Fmt("store: %s %s already exists", h.name, keyString(key)))
+		}
+		return h.put(ctx, v)
+	})
+}
+
+func (h *Handler) Read(ctx context.Context, data ...any) any {
+	if len(data) == 0 {
+		data = []any{reflect.New(h.typ).Interface()} // Zero example matches all
+	}
+
+	var out []crudp.Response
+	for _, item := range data {
+		v, err := h.value(item)
+		if err != nil {
+			return response{err: err}
+		}
+
+		if key := v.FieldByIndex(h.key); !key.IsZero() {
+			raw, found, err := h.backend.Get(ctx, h.table, keyString(key))
+			if err != nil {
+				return response{err: err}
+			}
+			if found {
+				entity, err := h.decode(raw)
+				if err != nil {
+					return response{err: err}
+				}
+				out = append(out, response{data: entity.Interface()})
+			}
+			continue
+		}
+
+		err = h.backend.Scan(ctx, h.table, func(key string, raw []byte) error {
+			entity, err := h.decode(raw)
+			if err != nil {
+				return err
+			}
+			if matches(v, entity.Elem()) {
+				out = append(out, response{data: entity.Interface()})
+			}
+			return nil
+		})
+		if err != nil {
+			return response{err: err}
+		}
+	}
+	return out
+}
+
+func (h *Handler) Update(ctx context.Context, data ...any) any {
+	return h.each(data, func(v reflect.Value) error {
+		key := keyString(v.FieldByIndex(h.key))
+		if _, found, err := h.backend.Get(ctx, h.table, key); err != nil {
+			return err
+		} else if !found {
+			return Err(Fmt("store: %s %s not found", h.name, key))
+		}
+		return h.put(ctx, v)
+	})
+}
+
+func (h *Handler) Delete(ctx context.Context, data ...any) any {
+	return h.each(data, func(v reflect.Value) error {
+		key := keyString(v.FieldByIndex(h.key))
+		found, err := h.backend.Delete(ctx, h.table, key)
+		if err == nil && !found {
+			err = Err(Fmt("store: %s %s not found", h.name, key))
+		}
+		return err
+	})
+}
+
+// each runs fn for every item, stopping at the first error
+func (h *Handler) each(data []any, fn func(v reflect.Value) error) any {
+	out := make([]crudp.Response, 0, len(data))
+	for _, item := range data {
+		v, err := h.value(item)
+		if err != nil {
+			return response{err: err}
+		}
+		if err := fn(v); err != nil {
+			return response{err: err}
+		}
+		out = append(out, response{data: v.Addr().Interface()})
+	}
+	return out
+}
+
+func (h *Handler) put(ctx context.Context, v reflect.Value) error {
+	raw, err := h.codec.Encode(v.Addr().Interface())
+	if err != nil {
+		return err
+	}
+	return h.backend.Put(ctx, h.table, keyString(v.FieldByIndex(h.key)), raw)
+}
+
+func (h *Handler) decode(raw []byte) (reflect.Value, error) {
+	ptr := reflect.New(h.typ)
+	return ptr, h.codec.Decode(raw, ptr.Interface())
+}
+
+// generate fills a zero key: the next table sequence or a random hex string
+func (h *Handler) generate(ctx context.Context, key reflect.Value) error {
+	if key.Kind() == reflect.String {
+		var b [16]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return err
+		}
+		const hex = "0123456789abcdef"
+		s := make([]byte, 32)
+		for i, c := range b {
+			s[i*2], s[i*2+1] = hex[c>>4], hex[c&15]
+		}
+		key.SetString(string(s))
+		return nil
+	}
+
+	id, err := h.backend.NextID(ctx, h.table)
+	if err != nil {
+		return err
+	}
+	if key.CanInt() {
+		key.SetInt(int64(id))
+	} else {
+		key.SetUint(id)
+	}
+	return nil
+}
+
+// value returns the addressable struct behind a decoded item
+func (h *Handler) value(item any) (reflect.Value, error) {
+	v := reflect.ValueOf(item)
+	if v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Type() == h.typ {
+		return v.Elem(), nil
+	}
+	got := "nil"
+	if item != nil {
+		got = v.Type().String()
+	}
+	return reflect.Value{}, Err(Fmt("store: %s expects *%s, got %s", h.name, h.typ.Name(), got))
+}
+
+// keyString encodes a key so Scan order is numeric for integers
+func keyString(key reflect.Value) string {
+	switch {
+	case key.Kind() == reflect.String:
+		return key.String()
+	case key.CanInt():
+		return Fmt("%020d", key.Int())
+	default:
+		return Fmt("%020d", key.Uint())
+	}
+}
+
+// matches reports whether every non-zero field of example equals entity's
+func matches(example, entity reflect.Value) bool {
+	for i := 0; i < example.NumField(); i++ {
+		f := example.Field(i)
+		if !f.CanInterface() || f.IsZero() {
+			continue
+		}
+		if !reflect.DeepEqual(f.Interface(), entity.Field(i).Interface()) {
+			return false
+		}
+	}
+	return true
+}
+
+// response sends one entity (or the error) as its own result Data entry
+type response struct {
+	data any
+	err  error
+}
+
+func (r response) Response() (any, []string, error) { return r.data, nil, r.err }
@@ -0,0 +1,190 @@
+//go:build !wasm
+
+package store
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+type Task struct {
+	ID    int
+	Title string
+	Done  bool
+}
+
+type Tag struct {
+	Slug string `store:"key"`
+	Name string
+}
+
+func newStore(t *testing.T, prototype any, opts ...Option) (*Memory, *crudp.CrudP) {
+	t.Helper()
+	mem := NewMemory()
+	h, err := New(mem, prototype, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mem, crudp.New(crudp.WithHandlers(h))
+}
+
+// call sends one packet through cp and returns its result
+func call(t *testing.T, cp *crudp.CrudP, action byte, items ...any) crudp.PacketResult {
+	t.Helper()
+	packet, err := cp.EncodePacket(action, 0, "r1", items...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p crudp.Packet
+	cp.DecodePacket(packet, &p)
+	batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{p}})
+	resp, err := cp.ProcessBatch(context.Background(), batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var br crudp.BatchResponse
+	if err := cp.Codec().Decode(resp, &br); err != nil || len(br.Results) != 1 {
+		t.Fatalf("decode: %v", err)
+	}
+	return br.Results[0]
+}
+
+func TestHandler(t *testing.T) {
+	t.Run("Create Assigns Sequential IDs", func(t *testing.T) {
+		_, cp := newStore(t, &Task{})
+		pr := call(t, cp, 'c', &Task{Title: "a"}, &Task{Title: "b"})
+		if pr.MessageType == uint8(Msg.Error) || len(pr.Data) != 2 {
+			t.Fatalf("create: %q, %d items", pr.Message, len(pr.Data))
+		}
+		var second Task
+		cp.DecodeData(&pr.Packet, 1, &second)
+		if second.ID != 2 || second.Title != "b" {
+			t.Errorf("created %+v", second)
+		}
+
+		pr = call(t, cp, 'c', &Task{ID: 2, Title: "dup"})
+		if pr.MessageType != uint8(Msg.Error) || !strings.Contains(pr.Message, "already exists") {
+			t.Errorf("expected already exists, got %q", pr.Message)
+		}
+	})
+
+	t.Run("Read By Key Example Or All", func(t *testing.T) {
+		_, cp := newStore(t, &Task{})
+		call(t, cp, 'c', &Task{Title: "a"}, &Task{Title: "b", Done: true}, &Task{Title: "c", Done: true})
+
+		var got Task
+		pr := call(t, cp, 'r', &Task{ID: 2, Title: "ignored"})
+		cp.DecodeData(&pr.Packet, 0, &got)
+		if len(pr.Data) != 1 || got.Title != "b" {
+			t.Errorf("by key: %d items, %+v", len(pr.Data), got)
+		}
+
+		if pr = call(t, cp, 'r', &Task{Done: true}); len(pr.Data) != 2 {
+			t.Errorf("by example: %d items", len(pr.Data))
+		}
+		if pr = call(t, cp, 'r'); len(pr.Data) != 3 {
+			t.Errorf("all: %d items", len(pr.Data))
+		}
+	})
+
+	t.Run("Update And Delete", func(t *testing.T) {
+		mem, cp := newStore(t, &Task{}, Table("tasks"))
+		call(t, cp, 'c', &Task{Title: "a"})
+		if pr := call(t, cp, 'u', &Task{ID: 1, Title: "renamed"}); pr.MessageType == uint8(Msg.Error) {
+			t.Fatal(pr.Message)
+		}
+		raw, _, _ := mem.Get(context.Background(), "tasks", "00000000000000000001")
+		if !strings.Contains(string(raw), "renamed") {
+			t.Errorf("stored %s", raw)
+		}
+
+		call(t, cp, 'd', &Task{ID: 1})
+		for _, action := range []byte{'u', 'd'} {
+			pr := call(t, cp, action, &Task{ID: 1})
+			if pr.MessageType != uint8(Msg.Error) || !strings.Contains(pr.Message, "not found") {
+				t.Errorf("%c: expected not found, got %q", action, pr.Message)
+			}
+		}
+	})
+
+	t.Run("String Keys", func(t *testing.T) {
+		_, cp := newStore(t, &Tag{})
+		pr := call(t, cp, 'c', &Tag{Name: "generated"}, &Tag{Slug: "go", Name: "Go"})
+		var generated Tag
+		cp.DecodeData(&pr.Packet, 0, &generated)
+		if len(generated.Slug) != 32 {
+			t.Errorf("generated key %q", generated.Slug)
+		}
+		if pr = call(t, cp, 'r', &Tag{Slug: "go"}); len(pr.Data) != 1 {
+			t.Errorf("read: %d items", len(pr.Data))
+		}
+	})
+
+	t.Run("Shares The Client Schema", func(t *testing.T) {
+		_, server := newStore(t, &Task{})
+		client := crudp.New(crudp.WithHandlers(&Task{}))
+		if err := server.VerifySchema(client.SchemaTable()); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// replicated is a Memory read through a replica, tracking write positions
+type replicated struct {
+	*Memory
+	writes int
+	waited []string
+}
+
+func (r *replicated) Put(ctx context.Context, table, key string, value []byte) error {
+	r.writes++
+	return r.Memory.Put(ctx, table, key, value)
+}
+
+func (r *replicated) WriteToken(ctx context.Context) (string, error) {
+	return Fmt("%d", r.writes), nil
+}
+
+func (r *replicated) WaitFor(ctx context.Context, token string) error {
+	r.waited = append(r.waited, token)
+	return nil
+}
+
+func TestConsistency(t *testing.T) {
+	backend := &replicated{Memory: NewMemory()}
+	h, err := New(backend, &Task{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := crudp.New(crudp.WithHandlers(h))
+
+	if pr := call(t, cp, 'c', &Task{Title: "a"}, &Task{Title: "b"}); pr.WriteToken != "2" {
+		t.Fatalf("expected write token 2, got %+v", pr)
+	}
+	call(t, cp, 'r', crudp.WithReadAfter("2"))
+	if len(backend.waited) != 1 || backend.waited[0] != "2" {
+		t.Fatalf("backend did not wait for the token: %v", backend.waited)
+	}
+
+	if _, plain := newStore(t, &Task{}); call(t, plain, 'c', &Task{Title: "a"}).WriteToken != "" {
+		t.Fatal("Memory issued a write token")
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	type noKey struct{ Name string }
+	type floatKey struct{ ID float64 }
+	mem := NewMemory()
+	for _, prototype := range []any{&noKey{}, &floatKey{}, 3} {
+		if _, err := New(mem, prototype); err == nil {
+			t.Errorf("expected error for %T", prototype)
+		}
+	}
+	if _, err := New(nil, &Task{}); err == nil {
+		t.Error("expected error for a nil backend")
+	}
+}
@@ -0,0 +1,251 @@
+package crudp
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"time"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// Streamed batches (ProcessStream)
+//
+// A stream is a sequence of length-prefixed records, each encoded with the
+// instance codec, ended by a zero length:
+//
+//	request  = 0xCB 'S' (uvarint len, Packet)... 0
+//	response = 0xCB 'T' (uvarint len, BatchResponse)... 0
+//
+// Each response record holds the result of one packet followed by the
+// results of its Dispatcher follow-ups, in stream order.
+const (
+	streamRequest  byte = 'S'
+	streamResponse byte = 'T'
+
+	// ContentTypeStream selects ProcessStream on the API endpoint
+	ContentTypeStream = "application/x-crudp-stream"
+)
+
+// maxStreamRecord bounds one encoded packet of a stream (16 MiB)
+const maxStreamRecord = 16 << 20
+
+// ProcessStream processes packets read one at a time from r and writes each
+// result to w as soon as it is ready, so memory stays bounded by the largest
+// packet instead of the whole batch (e.g. imports of tens of thousands of items)
+// Packets run in stream order: DependsOn fails a packet when an earlier one
+// failed, Refs and Config.Sagas are not supported, and streams are neither
+// recorded nor cached for idempotency. The error reports a broken stream or
+// a failed write; packet errors are results like in ProcessBatch.
+func (cp *CrudP) ProcessStream(ctx context.Context, r io.Reader, w io.Writer, opts ...CallOption) error {
+	co := cp.newCallOptions(opts)
+	ctx = cp.withTenant(ctx)
+	ctx, cancel := co.context(ctx)
+	defer cancel()
+	ctx = cp.withClientKey(ctx)
+
+	br := bufio.NewReader(r)
+	if err := readStreamHeader(br, streamRequest); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{frameMagic, streamResponse}); err != nil {
+		return err
+	}
+
+	var record []byte // Reused: packets are done with before the next read
+	var failedReqIDs []string
+	var out []byte
+	processed := 0
+	for {
+		var err error
+		record, err = readStreamRecord(br, record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			cp.log.Warn("ProcessStream read failed", "processed", processed, "error", err)
+			return err
+		}
+
+		var packet Packet
+		if err := co.codec.Decode(record, &packet); err != nil {
+			cp.log.Warn("ProcessStream decode failed", "processed", processed, "error", err)
+			return err
+		}
+		processed++
+
+		results := cp.processStreamPacket(ctx, &co, &packet, failedReqIDs)
+		if packet.ReqID != "" && failed(&results[0]) {
+			failedReqIDs = append(failedReqIDs, packet.ReqID)
+		}
+
+		encoded, err := co.codec.Encode(BatchResponse{Results: results})
+		if err != nil {
+			return err
+		}
+		out = binary.AppendUvarint(out[:0], uint64(len(encoded)))
+		if _, err := w.Write(append(out, encoded...)); err != nil {
+			return err
+		}
+	}
+
+	cp.log.Debug("ProcessStream done", "packets", processed)
+	_, err := w.Write([]byte{0})
+	return err
+}
+
+// processStreamPacket returns the result of packet followed by its follow-ups
+func (cp *CrudP) processStreamPacket(ctx context.Context, co *callOptions, packet *Packet, failedReqIDs []string) []PacketResult {
+	if on, message := cp.Maintenance(); on {
+		return []PacketResult{maintenanceResult(packet, message)}
+	}
+
+	var start time.Time
+	if cp.config.Auditor != nil {
+		start = time.Now()
+	}
+
+	followUps := &dispatchBatch{cp: cp, co: co}
+	var result PacketResult
+	var cause error // Why the packet failed before its handler ran, for OnError
+	translate := true
+	if err := ctx.Err(); err != nil {
+		result, cause = canceledResult(packet, err), err
+	} else if packet.expired(time.Now()) {
+		result = expiredResult(packet)
+	} else if len(packet.Refs) > 0 {
+		cause = LocErr(msgRefsInStream)
+		result = errorResult(packet, cause)
+	} else if dep := failedDependency(packet, failedReqIDs); dep != "" {
+		cause = LocErr(msgDependencyFailed, dep)
+		result = errorResult(packet, cause)
+	} else {
+		pctx, stop := cp.running.track(ctx, packet)
+		result, _ = cp.processSinglePacket(followUps.with(pctx, packet, 0), co, packet)
+		translate = false // processSinglePacket ran the OnError hooks
+		if stop() {
+			result, cause, translate = canceledResult(packet, context.Canceled), context.Canceled, true
+		}
+		followUps.settle(packet, &result)
+	}
+	if translate {
+		cp.translateError(ctx, packet, &result, cause)
+	}
+
+	if cp.config.Auditor != nil {
+		cp.audit(ctx, packet, &result, start)
+	}
+	return append([]PacketResult{result}, followUps.close()...)
+}
+
+// failedDependency returns the first DependsOn entry listed in failedReqIDs
+func failedDependency(packet *Packet, failedReqIDs []string) string {
+	for _, dep := range packet.DependsOn {
+		for _, f := range failedReqIDs {
+			if f == dep {
+				return dep
+			}
+		}
+	}
+	return ""
+}
+
+// readStreamHeader checks the magic and kind bytes of a stream
+func readStreamHeader(r *bufio.Reader, kind byte) error {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return Err(Fmt("stream: missing header: %v", err))
+	}
+	if head[0] != frameMagic || head[1] != kind {
+		return Err(Fmt("stream: not a %c stream", kind))
+	}
+	return nil
+}
+
+// readStreamRecord reads the next record into buf; io.EOF marks the end
+func readStreamRecord(r *bufio.Reader, buf []byte) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return buf, Err(Fmt("stream: truncated: %v", err))
+	}
+	if n == 0 {
+		return buf, io.EOF
+	}
+	if n > maxStreamRecord {
+		return buf, Err(Fmt("stream: record of %d bytes exceeds %d", n, maxStreamRecord))
+	}
+	if uint64(cap(buf)) < n {
+		buf = make([]byte, n)
+	}
+	buf = buf[:n]
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return buf, Err(Fmt("stream: truncated: %v", err))
+	}
+	return buf, nil
+}
+
+// StreamWriter writes the packets of a streamed batch, see ProcessStream
+type StreamWriter struct {
+	cp  *CrudP
+	w   io.Writer
+	buf []byte
+	err error // First write error, returned from then on
+}
+
+// NewStreamWriter starts a streamed batch on w (e.g. the pipe of a request body)
+func (cp *CrudP) NewStreamWriter(w io.Writer) *StreamWriter {
+	s := &StreamWriter{cp: cp, w: w}
+	_, s.err = w.Write([]byte{frameMagic, streamRequest})
+	return s
+}
+
+// Write encodes and writes one packet like EncodePacket (CallOption values
+// may be mixed into data)
+func (s *StreamWriter) Write(action byte, handlerID uint8, reqID string, data ...any) error {
+	if s.err != nil {
+		return s.err
+	}
+	encoded, err := s.cp.EncodePacket(action, handlerID, reqID, data...)
+	if err != nil {
+		return err // Nothing written, the stream is still usable
+	}
+	s.buf = binary.AppendUvarint(s.buf[:0], uint64(len(encoded)))
+	_, s.err = s.w.Write(append(s.buf, encoded...))
+	return s.err
+}
+
+// Close ends the stream; it does not close w
+func (s *StreamWriter) Close() error {
+	if s.err != nil {
+		return s.err
+	}
+	_, s.err = s.w.Write([]byte{0})
+	if s.err == nil {
+		s.err = Errf("stream: closed")
+		return nil
+	}
+	return s.err
+}
+
+// ReceiveStream reads a response of ProcessStream and passes each record to
+// ReceiveBatch as it arrives
+func (cp *CrudP) ReceiveStream(r io.Reader) error {
+	br := bufio.NewReader(r)
+	if err := readStreamHeader(br, streamResponse); err != nil {
+		return err
+	}
+	for {
+		// Not reused: decoded results may keep sub-slices of the record
+		record, err := readStreamRecord(br, nil)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := cp.ReceiveBatch(record); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package crudp_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+func StreamShared(t *testing.T) {
+	t.Run("Results Follow Stream Order", func(t *testing.T) {
+		for _, binary := range []bool{false, true} {
+			cfg := crudp.DefaultConfig()
+			cfg.UseBinary = binary
+			server := crudp.New(cfg, crudp.WithHandlers(&Chart{}))
+			client := crudp.New(cfg, crudp.WithHandlers(&Chart{}))
+
+			var req bytes.Buffer
+			sw := client.NewStreamWriter(&req)
+			for i := 0; i < 100; i++ {
+				if err := sw.Write('c', 0, Fmt("c%d", i), &Chart{ID: Fmt("%d", i)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sw.Write('c', 9, "bad")
+			sw.Write('c', 0, "after", &Chart{ID: "x"}, crudp.WithDependsOn("bad"))
+			if err := sw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			var resp bytes.Buffer
+			chartCalls = 0
+			if err := server.ProcessStream(context.Background(), &req, &resp); err != nil {
+				t.Fatalf("binary=%v: %v", binary, err)
+			}
+			if chartCalls != 100 {
+				t.Errorf("binary=%v: expected 100 calls, got %d", binary, chartCalls)
+			}
+
+			var results []crudp.PacketResult
+			client.OnResult(func(pr crudp.PacketResult) { results = append(results, pr) })
+			if err := client.ReceiveStream(&resp); err != nil {
+				t.Fatalf("binary=%v: ReceiveStream: %v", binary, err)
+			}
+			if len(results) != 102 || results[0].ReqID != "c0" || results[99].ReqID != "c99" {
+				t.Fatalf("binary=%v: unexpected results (%d)", binary, len(results))
+			}
+			if results[100].MessageType != uint8(Msg.Error) || results[101].Message != "dependency bad failed" {
+				t.Errorf("binary=%v: unexpected tail %q %q", binary, results[100].Message, results[101].Message)
+			}
+		}
+	})
+
+	t.Run("Truncated Stream", func(t *testing.T) {
+		cp := crudp.New(crudp.WithHandlers(&Chart{}))
+		var req bytes.Buffer
+		sw := cp.NewStreamWriter(&req)
+		sw.Write('c', 0, "a", &Chart{ID: "1"}) // No Close
+
+		var resp bytes.Buffer
+		if err := cp.ProcessStream(context.Background(), &req, &resp); err == nil {
+			t.Error("expected an error for a stream without end")
+		}
+		if err := cp.ProcessStream(context.Background(), bytes.NewReader([]byte("{}")), &resp); err == nil {
+			t.Error("expected an error for a missing header")
+		}
+	})
+}
@@ -0,0 +1,9 @@
+//go:build !wasm
+
+package crudp_test
+
+import "testing"
+
+func TestStream_Stdlib(t *testing.T) {
+	StreamShared(t)
+}
@@ -0,0 +1,107 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// channelAuthorizer only allows channels starting with "channel"
+type channelAuthorizer struct{}
+
+func (channelAuthorizer) AuthorizeSubscription(ctx context.Context, pattern string) error {
+	if !crudp.MatchChannel("channel*", pattern) {
+		return Err(Fmt("forbidden channel %s", pattern))
+	}
+	return nil
+}
+
+func SubscriptionsShared(t *testing.T) {
+	t.Run("MatchChannel", func(t *testing.T) {
+		cases := []struct {
+			pattern, channel string
+			want             bool
+		}{
+			{"patient:*", "patient:42", true},
+			{"patient:*", "patients", false},
+			{"*", "anything", true},
+			{"news", "news", true},
+			{"news", "newsletter", false},
+			{"*:updated", "patient:updated", true},
+			{"a*b*c", "axxbyyc", true},
+			{"a*b*c", "axxbyy", false},
+		}
+		for _, c := range cases {
+			if got := crudp.MatchChannel(c.pattern, c.channel); got != c.want {
+				t.Errorf("MatchChannel(%q, %q) = %v", c.pattern, c.channel, got)
+			}
+		}
+	})
+
+	t.Run("ListenTo Subscribe Unsubscribe", func(t *testing.T) {
+		cfg := crudp.DefaultConfig()
+		cfg.SubscriptionAuthorizer = channelAuthorizer{}
+		cp := crudp.New(cfg, crudp.WithHandlers(&sseHandler{}))
+
+		var got []string
+		sub := cp.ListenTo(func(ev crudp.Event) { got = append(got, ev.Channel) }, "channel1")
+		defer sub.Close()
+		broadcast := func() { processOne(t, cp, crudp.Packet{Action: 'c'}) } // channel1 and channel2
+
+		broadcast()
+		if len(got) != 1 || got[0] != "channel1" {
+			t.Fatalf("expected channel1 only, got %v", got)
+		}
+
+		if err := sub.Subscribe(context.Background(), "channel2"); err != nil {
+			t.Fatal(err)
+		}
+		got = nil
+		broadcast()
+		if len(got) != 2 {
+			t.Errorf("expected both channels, got %v", got)
+		}
+
+		if err := sub.Subscribe(context.Background(), "admin:*"); err == nil {
+			t.Error("expected authorizer to deny admin:*")
+		}
+
+		sub.Unsubscribe("channel1", "channel2")
+		got = nil
+		broadcast()
+		if len(got) != 0 || len(sub.Channels()) != 0 {
+			t.Errorf("expected no events after unsubscribe, got %v (channels %v)", got, sub.Channels())
+		}
+	})
+
+	t.Run("Client Subscribe", func(t *testing.T) {
+		server := crudp.New(crudp.WithHandlers(&sseHandler{}))
+		cfg := crudp.DefaultConfig()
+		cfg.ServerURL = "https://api.example.com"
+		client := crudp.NewLoopback(server, cfg, crudp.WithHandlers(&sseHandler{}))
+
+		var got []string
+		unsubscribe := client.Subscribe("channel2", func(ev crudp.Event) { got = append(got, ev.Channel) })
+		client.Subscribe("patient:*", func(crudp.Event) {})
+
+		if url := client.EventsURL(); url != "https://api.example.com/events?channels=channel2,patient:*" {
+			t.Errorf("unexpected events URL %q", url)
+		}
+
+		processOne(t, server, crudp.Packet{Action: 'c'})
+		if len(got) != 1 || got[0] != "channel2" {
+			t.Fatalf("expected channel2 only, got %v", got)
+		}
+
+		unsubscribe()
+		processOne(t, server, crudp.Packet{Action: 'c'})
+		if len(got) != 1 {
+			t.Errorf("expected no events after unsubscribe, got %v", got)
+		}
+		if channels := client.Channels(); len(channels) != 1 || channels[0] != "patient:*" {
+			t.Errorf("unexpected channels %v", channels)
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package crudp
+
+import "context"
+
+// TenantProvider is optionally implemented by Config.UserProvider to scope
+// every connection and packet to a tenant. Broadcasts, presence, the change
+// log and idempotency keys never cross tenants; "" is a tenant of its own.
+//
+//	func (a *Auth) GetTenantID(ctx context.Context) string {
+//		return sessionFrom(ctx).OrgID
+//	}
+type TenantProvider interface {
+	GetTenantID(ctx context.Context) string
+}
+
+type tenantKey struct{}
+
+// WithTenant stores the tenant of the caller in ctx
+// ProcessBatch and the SSE endpoint set it from TenantProvider; transports
+// resolving the tenant themselves can set it directly.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// Tenant returns the tenant of the caller, "" if none
+// Handlers use it to scope their queries.
+func Tenant(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// withTenant resolves the tenant once per batch or connection
+func (cp *CrudP) withTenant(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(tenantKey{}).(string); ok {
+		return ctx
+	}
+	provider, ok := cp.config.UserProvider.(TenantProvider)
+	if !ok {
+		return ctx
+	}
+	return WithTenant(ctx, provider.GetTenantID(ctx))
+}
+
+// tenantScoped prefixes key with the tenant so equal keys of different
+// tenants don't collide
+func tenantScoped(ctx context.Context, key string) string {
+	if tenant := Tenant(ctx); tenant != "" {
+		return tenant + "\x00" + key
+	}
+	return key
+}
@@ -0,0 +1,122 @@
+package crudp_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+// orgUsers scopes callers to the organization stored in ctx
+type orgUsers struct{}
+
+type orgKey struct{}
+
+func (orgUsers) GetUserID(ctx context.Context) string { return "user" }
+
+func (orgUsers) GetTenantID(ctx context.Context) string {
+	org, _ := ctx.Value(orgKey{}).(string)
+	return org
+}
+
+func processIn(t *testing.T, cp *crudp.CrudP, org string, packet crudp.Packet) crudp.PacketResult {
+	t.Helper()
+	batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{packet}})
+	resp, err := cp.ProcessBatch(context.WithValue(context.Background(), orgKey{}, org), batch)
+	if err != nil {
+		t.Fatalf("ProcessBatch: %v", err)
+	}
+	var out crudp.BatchResponse
+	if err := cp.Codec().Decode(resp, &out); err != nil || len(out.Results) != 1 {
+		t.Fatalf("decode response: %v", err)
+	}
+	return out.Results[0]
+}
+
+func TenantIsolationShared(t *testing.T) {
+	newCP := func() *crudp.CrudP {
+		cfg := crudp.DefaultConfig()
+		cfg.UserProvider = orgUsers{}
+		cfg.ChangeLogSize = 10
+		return crudp.New(cfg, crudp.WithHandlers(&sseHandler{}))
+	}
+	listen := func(cp *crudp.CrudP, org string) func() int {
+		var mu sync.Mutex
+		count := 0
+		ctx := context.WithValue(context.Background(), orgKey{}, org)
+		cp.ListenAs(ctx, func(crudp.Event) {
+			mu.Lock()
+			count++
+			mu.Unlock()
+		}, "*")
+		return func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return count
+		}
+	}
+
+	t.Run("Broadcasts Stay In Tenant", func(t *testing.T) {
+		cp := newCP()
+		acme, globex, none := listen(cp, "acme"), listen(cp, "globex"), listen(cp, "")
+		all := 0
+		cp.Listen(func(crudp.Event) { all++ })
+
+		processIn(t, cp, "acme", crudp.Packet{Action: 'c'})
+
+		if acme() != 2 {
+			t.Errorf("acme: expected 2 events, got %d", acme())
+		}
+		if globex() != 0 || none() != 0 {
+			t.Errorf("broadcast crossed tenants: globex %d, none %d", globex(), none())
+		}
+		if all != 2 {
+			t.Errorf("Listen sees every tenant, got %d", all)
+		}
+	})
+
+	t.Run("Tenant In Context", func(t *testing.T) {
+		ctx := crudp.WithTenant(context.Background(), "acme")
+		if crudp.Tenant(ctx) != "acme" || crudp.Tenant(context.Background()) != "" {
+			t.Error("unexpected tenant")
+		}
+	})
+
+	t.Run("Change Log Per Tenant", func(t *testing.T) {
+		cp := newCP()
+		processIn(t, cp, "acme", crudp.Packet{Action: 'c'})
+
+		sync := func(org string) crudp.SyncDelta {
+			cursor, _ := cp.Codec().Encode(crudp.SyncCursor{})
+			r := processIn(t, cp, org, crudp.Packet{Action: crudp.ActionSync, Data: [][]byte{cursor}})
+			var delta crudp.SyncDelta
+			if err := cp.Codec().Decode(r.Data[0], &delta); err != nil {
+				t.Fatalf("decode delta: %v", err)
+			}
+			return delta
+		}
+		if d := sync("acme"); len(d.Changes) != 1 {
+			t.Errorf("acme: expected 1 change, got %+v", d)
+		}
+		if d := sync("globex"); len(d.Changes) != 0 {
+			t.Errorf("globex sees acme changes: %+v", d)
+		}
+	})
+
+	t.Run("Idempotency Keys Per Tenant", func(t *testing.T) {
+		cp := newCP()
+		acme, globex := listen(cp, "acme"), listen(cp, "globex")
+		batch, _ := cp.Codec().Encode(crudp.BatchRequest{Packets: []crudp.Packet{{Action: 'c'}}})
+		for _, org := range []string{"acme", "acme", "globex"} {
+			ctx := context.WithValue(context.Background(), orgKey{}, org)
+			if _, err := cp.ProcessBatch(ctx, batch, crudp.WithIdempotencyKey("k1")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// The acme retry is replayed; globex's equal key is processed
+		if acme() != 2 || globex() != 2 {
+			t.Errorf("expected one processing per tenant, got acme %d globex %d", acme(), globex())
+		}
+	})
+}
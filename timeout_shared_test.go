@@ -0,0 +1,65 @@
+package crudp_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cdvelop/crudp"
+	. "github.com/cdvelop/tinystring"
+)
+
+// Waiter blocks until its context is cancelled
+type Waiter struct{}
+
+var waiterCancelled = make(chan error, 1)
+
+func (h *Waiter) Read(ctx context.Context, data ...any) any {
+	<-ctx.Done()
+	waiterCancelled <- ctx.Err()
+	return "late"
+}
+
+func HandlerTimeoutShared(t *testing.T) {
+	newCP := func(timeout int) *crudp.CrudP {
+		cfg := crudp.DefaultConfig()
+		cfg.HandlerTimeout = timeout
+		return crudp.New(cfg, crudp.WithHandlers(&Waiter{}, &Sleepy{}))
+	}
+
+	t.Run("Cancels Long Running Handler", func(t *testing.T) {
+		cp := newCP(10)
+		pr := processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 0})
+		if pr.MessageType != uint8(Msg.Error) || pr.Code != crudp.CodeTimeout {
+			t.Fatalf("expected timeout result, got %d %q code %q", pr.MessageType, pr.Message, pr.Code)
+		}
+		select {
+		case err := <-waiterCancelled:
+			if err != context.DeadlineExceeded {
+				t.Errorf("unexpected ctx error %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("handler context not cancelled")
+		}
+	})
+
+	t.Run("Abandons Handler Ignoring Context", func(t *testing.T) {
+		cp := newCP(5)
+		start := time.Now()
+		pr := processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 1})
+		if pr.Code != crudp.CodeTimeout {
+			t.Fatalf("expected timeout code, got %q %q", pr.Code, pr.Message)
+		}
+		if d := time.Since(start); d >= 15*time.Millisecond {
+			t.Errorf("waited for the handler: %v", d)
+		}
+	})
+
+	t.Run("Fast Handler Has No Code", func(t *testing.T) {
+		cp := newCP(1000)
+		pr := processOne(t, cp, crudp.Packet{Action: 'r', HandlerID: 1})
+		if pr.MessageType != uint8(Msg.Success) || pr.Code != "" {
+			t.Fatalf("unexpected result %d %q code %q", pr.MessageType, pr.Message, pr.Code)
+		}
+	})
+}
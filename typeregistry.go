@@ -0,0 +1,122 @@
+package crudp
+
+import (
+	"reflect"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// Keys of a tagged interface value: {"$type": name, "$value": ...}
+const (
+	typeKey  = "$type"
+	valueKey = "$value"
+)
+
+// typeEntry is a type registered with RegisterType
+type typeEntry struct {
+	name    string
+	factory func() any
+	t       reflect.Type // Type returned by factory
+}
+
+// RegisterType names a concrete type stored in interface-valued fields, so
+// the default codec and AdaptCodec codecs can rebuild it on decode
+// factory returns a new value, usually a pointer (e.g. func() any { return
+// &EmailBody{} }); the field gets the pointer, or the value it points to when
+// only that satisfies the interface. Encoded values are tagged as
+// {"$type": name, "$value": ...}; unregistered types in interface fields are
+// encoded as is and decoded as generic maps, slices and leaf values.
+// Register the same names on server and client.
+func RegisterType(name string, factory func() any) error {
+	if name == "" || factory == nil {
+		return Errf("type registry: name and factory are required")
+	}
+	t := reflect.TypeOf(factory())
+	if t == nil {
+		return Err(Fmt("type registry: factory of %s returned nil", name))
+	}
+
+	typeAdapters.mu.Lock()
+	defer typeAdapters.mu.Unlock()
+	types := make([]typeEntry, 0, len(typeAdapters.types)+1)
+	for _, e := range typeAdapters.types {
+		if e.name == name {
+			continue
+		}
+		if e.t == t {
+			return Err(Fmt("type registry: %s already registered as %s", t, e.name))
+		}
+		types = append(types, e)
+	}
+	typeAdapters.types = append(types, typeEntry{name: name, factory: factory, t: t})
+	typeAdapters.scanned = nil // Interface fields now need tagging
+	return nil
+}
+
+// hasRegisteredTypes reports whether RegisterType was called
+func hasRegisteredTypes() bool {
+	typeAdapters.mu.Lock()
+	defer typeAdapters.mu.Unlock()
+	return len(typeAdapters.types) > 0
+}
+
+// registeredName returns the name of t, or of the pointer to t
+func registeredName(t reflect.Type) (string, bool) {
+	typeAdapters.mu.Lock()
+	types := typeAdapters.types
+	typeAdapters.mu.Unlock()
+	for _, e := range types {
+		if e.t == t || (e.t.Kind() == reflect.Ptr && e.t.Elem() == t) {
+			return e.name, true
+		}
+	}
+	return "", false
+}
+
+// typedFromTree builds the value of an interface field of type it from tree
+func typedFromTree(it reflect.Type, tree any) (reflect.Value, error) {
+	m, ok := tree.(map[string]any)
+	name, tagged := m[typeKey].(string)
+	if !ok || !tagged {
+		v := reflect.ValueOf(tree)
+		if !v.Type().AssignableTo(it) {
+			return reflect.Value{}, Err(Fmt("type registry: untagged %s does not implement %s", typeName(tree), it))
+		}
+		return v, nil
+	}
+
+	typeAdapters.mu.Lock()
+	types := typeAdapters.types
+	typeAdapters.mu.Unlock()
+	var factory func() any
+	for _, e := range types {
+		if e.name == name {
+			factory = e.factory
+			break
+		}
+	}
+	if factory == nil {
+		return reflect.Value{}, Err(Fmt("type registry: unknown type %s", name))
+	}
+
+	v := reflect.ValueOf(factory())
+	target := v
+	if v.Kind() == reflect.Ptr {
+		target = v.Elem()
+	} else {
+		target = reflect.New(v.Type()).Elem()
+		target.Set(v)
+		v = target
+	}
+	if err := fromTree(target, m[valueKey]); err != nil {
+		return reflect.Value{}, err
+	}
+
+	switch {
+	case v.Type().AssignableTo(it):
+		return v, nil
+	case v.Kind() == reflect.Ptr && v.Elem().Type().AssignableTo(it):
+		return v.Elem(), nil
+	}
+	return reflect.Value{}, Err(Fmt("type registry: %s (%s) does not implement %s", name, v.Type(), it))
+}
@@ -0,0 +1,83 @@
+package crudp_test
+
+import (
+	"testing"
+
+	"github.com/cdvelop/crudp"
+)
+
+type NoticeBody interface{ Kind() string }
+
+type EmailBody struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+}
+
+func (*EmailBody) Kind() string { return "email" }
+
+type SMSBody struct {
+	Phone string `json:"phone"`
+}
+
+func (SMSBody) Kind() string { return "sms" }
+
+type Notice struct {
+	ID   string       `json:"id"`
+	Body NoticeBody   `json:"body"`
+	More []NoticeBody `json:"more"`
+}
+
+func TypeRegistryShared(t *testing.T) {
+	crudp.RegisterType("email", func() any { return &EmailBody{} })
+	crudp.RegisterType("sms", func() any { return SMSBody{} })
+
+	t.Run("Polymorphic Fields Round Trip", func(t *testing.T) {
+		for _, binary := range []bool{false, true} {
+			cfg := crudp.DefaultConfig()
+			cfg.UseBinary = binary
+			cp := crudp.New(cfg)
+
+			in := Notice{ID: "n1", Body: &EmailBody{To: "a@b.c", Subject: "hi"}, More: []NoticeBody{SMSBody{Phone: "555"}, nil}}
+			encoded, err := cp.EncodePacket('c', 0, "a", in)
+			if err != nil {
+				t.Fatalf("binary=%v encode: %v", binary, err)
+			}
+			var packet crudp.Packet
+			if err := cp.DecodePacket(encoded, &packet); err != nil {
+				t.Fatalf("binary=%v decode packet: %v", binary, err)
+			}
+			var got Notice
+			if err := cp.DecodeData(&packet, 0, &got); err != nil {
+				t.Fatalf("binary=%v decode data: %v", binary, err)
+			}
+
+			email, ok := got.Body.(*EmailBody)
+			if !ok || email.To != "a@b.c" || email.Subject != "hi" {
+				t.Errorf("binary=%v: unexpected body %#v", binary, got.Body)
+			}
+			if len(got.More) != 2 || got.More[1] != nil {
+				t.Fatalf("binary=%v: unexpected more %#v", binary, got.More)
+			}
+			if sms, ok := got.More[0].(SMSBody); !ok || sms.Phone != "555" {
+				t.Errorf("binary=%v: value factory not rebuilt as a value: %#v", binary, got.More[0])
+			}
+		}
+	})
+
+	t.Run("Rejects Invalid Registrations", func(t *testing.T) {
+		if err := crudp.RegisterType("", func() any { return &EmailBody{} }); err == nil {
+			t.Error("expected an error for an empty name")
+		}
+		if err := crudp.RegisterType("mail", func() any { return &EmailBody{} }); err == nil {
+			t.Error("expected an error for a type registered under another name")
+		}
+	})
+
+	t.Run("Unknown Name", func(t *testing.T) {
+		codec := crudp.NewDefault().Codec()
+		var got Notice
+		if err := codec.Decode([]byte(`{"id":"x","body":{"$type":"fax","$value":{}}}`), &got); err == nil {
+			t.Error("expected an error for an unregistered name")
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package crudp
+
+import (
+	"context"
+	"io"
+
+	. "github.com/cdvelop/tinystring"
+)
+
+// FileRef references a file stored through Config.FileStore
+// The upload route returns it; clients put it in their packets (e.g. a field
+// Avatar crudp.FileRef) so handlers get the file without touching HTTP.
+type FileRef struct {
+	ID   string `json:"id"`
+	Name string `json:"name"` // Original file name
+	Type string `json:"type"` // MIME type sent by the client
+	Size int64  `json:"size"` // Bytes stored so far
+}
+
+// FileStore keeps the uploaded files (server only), e.g. NewDirStore
+type FileStore interface {
+	// Append writes r at offset of file id, creating it at offset 0, and
+	// returns the new size. An offset other than the current size is an
+	// *UploadOffsetError so the client can resume from Size.
+	Append(ctx context.Context, id string, offset int64, r io.Reader) (int64, error)
+
+	// Open returns the content of file id
+	Open(ctx context.Context, id string) (io.ReadCloser, error)
+}
+
+// FileRemover is implemented by FileStores that can delete a file; uploads
+// rejected after they started writing (e.g. over MaxUploadBytes) are removed
+type FileRemover interface {
+	Remove(ctx context.Context, id string) error
+}
+
+// Chunked upload headers: a POST to Config.UploadEndpoint without
+// UploadIDHeader starts a file; the next chunks send the returned ID and the
+// offset they start at.
+const (
+	UploadIDHeader     = "X-Crudp-Upload-Id"
+	UploadOffsetHeader = "X-Crudp-Upload-Offset"
+	UploadNameHeader   = "X-Crudp-Upload-Name"
+	UploadTypeHeader   = "X-Crudp-Upload-Type"
+)
+
+// UploadChunkSize is the chunk size used by the client upload helper
+const UploadChunkSize = 1 << 20
+
+// UploadOffsetError reports a chunk that does not continue the stored file
+type UploadOffsetError struct {
+	ID     string
+	Offset int64 // Sent by the client
+	Size   int64 // Stored
+}
+
+func (e *UploadOffsetError) Error() string {
+	return Fmt("upload %s: chunk at offset %d, stored %d bytes", e.ID, e.Offset, e.Size)
+}
+
+// validFileID reports whether id is a file ID made by the upload route
+// (lowercase hex), so it can be used as a file name
+func validFileID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if c := id[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
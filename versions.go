@@ -0,0 +1,82 @@
+package crudp
+
+import . "github.com/cdvelop/tinystring"
+
+// RegisterVersion adds an alternate implementation for an already registered
+// handler, selected by Packet.Version. The handler must resolve to the same
+// name (HandlerName() or snake_case type name) as the registered one.
+// Version 0 is reserved for the current handler.
+// Example: cp.RegisterVersion(1, &userV1.Handler{}) keeps old WASM clients working.
+func (cp *CrudP) RegisterVersion(version byte, handler any) error {
+	if handler == nil {
+		return Errf("versioned handler is nil")
+	}
+	if version == 0 {
+		return Errf("version 0 is reserved for the current handler")
+	}
+
+	name := getHandlerName(handler)
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	for i := range cp.handlers {
+		current := cp.handlers[i]
+		if current.name != name {
+			continue
+		}
+
+		for _, v := range current.versions {
+			if v.version == version {
+				return Err(Fmt("version %d already registered for handler %s", version, name))
+			}
+		}
+
+		ah := actionHandler{
+			name:    name,
+			index:   current.index,
+			handler: handler,
+			version: version,
+		}
+		cp.bindTo(&ah, handler)
+
+		// Copy-on-write: never mutate the published table or versions slice
+		versions := make([]actionHandler, len(current.versions), len(current.versions)+1)
+		copy(versions, current.versions)
+		current.versions = append(versions, ah)
+
+		table := make([]actionHandler, len(cp.handlers))
+		copy(table, cp.handlers)
+		table[i] = current
+		cp.handlers = table
+
+		cp.log.Info("registered handler", "handler", name, "version", version, "index", current.index)
+		return nil
+	}
+
+	return Err(Fmt("no handler registered with name: %s", name))
+}
+
+// resolve returns the handler for an id and version (0 = current)
+func (cp *CrudP) resolve(handlerID uint8, version byte) (*actionHandler, error) {
+	handlers := cp.table()
+	if int(handlerID) >= len(handlers) {
+		return nil, LocErr(msgNoHandler, handlerID)
+	}
+
+	handler := &handlers[handlerID]
+	if handler.handler == nil {
+		return nil, LocErr(msgNoHandler, handlerID) // Removed or manifest gap
+	}
+	if version == 0 {
+		return handler, nil
+	}
+
+	for i := range handler.versions {
+		if handler.versions[i].version == version {
+			return &handler.versions[i], nil
+		}
+	}
+
+	return nil, LocErr(msgNoVersion, version, handler.name)
+}